@@ -0,0 +1,178 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/ota"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	aaCmd.AddCommand(aaExtractCmd)
+
+	aaExtractCmd.Flags().StringP("output", "o", "", "Folder to extract files to")
+	viper.BindPFlag("aa.extract.output", aaExtractCmd.Flags().Lookup("output"))
+	aaExtractCmd.MarkZshCompPositionalArgumentFile(1)
+}
+
+// aaExtractCmd represents the aa extract command
+var aaExtractCmd = &cobra.Command{
+	Use:   "extract <archive> [REGEX]",
+	Short: "Extract the entries of an Apple Archive (or OTA payload)",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		output, err := filepath.Abs(viper.GetString("aa.extract.output"))
+		if err != nil {
+			return errors.Wrapf(err, "invalid output folder")
+		}
+
+		var re *regexp.Regexp
+		if len(args) > 1 {
+			if re, err = regexp.Compile(args[1]); err != nil {
+				return errors.Wrapf(err, "invalid regex %s", args[1])
+			}
+		}
+
+		f, err := os.Open(filepath.Clean(args[0]))
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %s", args[0])
+		}
+		defer f.Close()
+
+		pr, err := ota.NewPayloadReader(f, 0)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", args[0])
+		}
+		defer pr.Close()
+
+		ar := ota.NewReader(pr)
+		for {
+			ent, data, err := ar.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to parse %s", args[0])
+			}
+			if re != nil && !re.MatchString(ent.Path) {
+				continue
+			}
+			if err := extractAAEntry(output, ent, data); err != nil {
+				return errors.Wrapf(err, "failed to extract %s", ent.Path)
+			}
+		}
+
+		return nil
+	},
+}
+
+func extractAAEntry(output string, ent *ota.Entry, data io.Reader) error {
+	// keep entries inside of the output folder
+	fname := filepath.Join(output, filepath.Clean(string(filepath.Separator)+ent.Path))
+	if link := throughSymlink(output, fname); len(link) > 0 {
+		utils.Indent(log.Warn, 2)(fmt.Sprintf("Skipping %s (its parent %s is a symlink)", ent.Path, link))
+		return nil
+	}
+
+	switch ent.Type {
+	case ota.Directory:
+		return os.MkdirAll(fname, 0755)
+	case ota.SymbolicLink:
+		if !insideFolder(output, filepath.Join(filepath.Dir(fname), ent.Link)) || filepath.IsAbs(ent.Link) {
+			utils.Indent(log.Warn, 2)(fmt.Sprintf("Skipping symlink %s -> %s (it points outside of the output folder)", ent.Path, ent.Link))
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			return err
+		}
+		os.Remove(fname)
+		utils.Indent(log.Debug, 2)(fmt.Sprintf("Creating symlink %s -> %s", fname, ent.Link))
+		return os.Symlink(ent.Link, fname)
+	case ota.RegularFile:
+		if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+			return err
+		}
+		utils.Indent(log.Info, 2)(fmt.Sprintf("Extracting %s\t%s\t%s", ent.Mod, humanize.Bytes(ent.Size), strings.TrimPrefix(fname, output)))
+		// never write through a symlink
+		if fi, err := os.Lstat(fname); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(fname); err != nil {
+				return err
+			}
+		}
+		f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, ent.Mod.Perm()|0200)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := io.Copy(f, data); err != nil {
+			return err
+		}
+		if !ent.Mtm.IsZero() {
+			os.Chtimes(fname, ent.Mtm, ent.Mtm)
+		}
+	default:
+		utils.Indent(log.Debug, 2)(fmt.Sprintf("Skipping %c entry %s", ent.Type, ent.Path))
+	}
+
+	return nil
+}
+
+// throughSymlink returns the first existing parent of fname (below output) that is a symlink (or "")
+func throughSymlink(output, fname string) string {
+	rel, err := filepath.Rel(output, filepath.Dir(fname))
+	if err != nil || rel == "." {
+		return ""
+	}
+	dir := output
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		if fi, err := os.Lstat(dir); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return dir
+		} else if err != nil {
+			return "" // the rest of the path does NOT exist yet
+		}
+	}
+	return ""
+}
+
+// insideFolder returns true if path is the folder or is inside of it
+func insideFolder(folder, path string) bool {
+	rel, err := filepath.Rel(folder, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
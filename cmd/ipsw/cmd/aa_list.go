@@ -0,0 +1,89 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/ota"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	aaCmd.AddCommand(aaListCmd)
+
+	aaListCmd.MarkZshCompPositionalArgumentFile(1)
+}
+
+// aaListCmd represents the aa list command
+var aaListCmd = &cobra.Command{
+	Use:   "list <archive>",
+	Short: "List the entries of an Apple Archive (or OTA payload)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		f, err := os.Open(filepath.Clean(args[0]))
+		if err != nil {
+			return errors.Wrapf(err, "failed to open %s", args[0])
+		}
+		defer f.Close()
+
+		pr, err := ota.NewPayloadReader(f, 0)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", args[0])
+		}
+		defer pr.Close()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.DiscardEmptyColumns)
+		defer w.Flush()
+
+		ar := ota.NewReader(pr)
+		for {
+			ent, _, err := ar.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to parse %s", args[0])
+			}
+			name := ent.Path
+			if ent.Type == ota.SymbolicLink {
+				name += " -> " + ent.Link
+			}
+			fmt.Fprintf(w, "%c %s\t%s\t%s\t%d\t%d\t%s\n", ent.Type, ent.Mod, ent.Mtm.Format(time.RFC3339), humanize.Bytes(ent.Size), ent.Uid, ent.Gid, name)
+		}
+
+		return nil
+	},
+}
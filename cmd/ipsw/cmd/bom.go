@@ -0,0 +1,93 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/ota"
+	"github.com/blacktop/ipsw/pkg/ota/bom"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(bomCmd)
+
+	bomCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	bomCmd.MarkZshCompPositionalArgumentFile(1)
+}
+
+// openBOM parses a BOM file or the post.bom of an OTA zip
+func openBOM(path string) (*bom.BOM, error) {
+	path = filepath.Clean(path)
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("file %s does not exist", path)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return ota.OpenBOM(path)
+	}
+
+	return bom.Open(path)
+}
+
+// bomCmd represents the bom command
+var bomCmd = &cobra.Command{
+	Use:   "bom <BOM|OTA.zip>",
+	Short: "List the contents of a BOM (lsbom)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		b, err := openBOM(args[0])
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse BOM %s", args[0])
+		}
+
+		if asJSON {
+			j, err := json.Marshal(b)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(j))
+			return nil
+		}
+
+		for _, f := range b.Files {
+			fmt.Println(f)
+		}
+
+		return nil
+	},
+}
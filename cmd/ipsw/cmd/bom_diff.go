@@ -0,0 +1,87 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/ota/bom"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	bomCmd.AddCommand(bomDiffCmd)
+
+	bomDiffCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	bomDiffCmd.MarkZshCompPositionalArgumentFile(1)
+	bomDiffCmd.MarkZshCompPositionalArgumentFile(2)
+}
+
+// bomDiffCmd represents the bom diff command
+var bomDiffCmd = &cobra.Command{
+	Use:   "diff <OLD> <NEW>",
+	Short: "Diff the files of two BOMs (or OTA zips)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		oldBOM, err := openBOM(args[0])
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse BOM %s", args[0])
+		}
+		newBOM, err := openBOM(args[1])
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse BOM %s", args[1])
+		}
+
+		diff := bom.Diff(oldBOM, newBOM)
+
+		if asJSON {
+			j, err := json.Marshal(diff)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(j))
+			return nil
+		}
+
+		for _, f := range diff.Removed {
+			fmt.Printf("- %s\n", f)
+		}
+		for _, f := range diff.Added {
+			fmt.Printf("+ %s\n", f)
+		}
+		for _, c := range diff.Changed {
+			fmt.Printf("~ %s\n", c)
+		}
+
+		return nil
+	},
+}
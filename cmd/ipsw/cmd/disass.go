@@ -33,6 +33,7 @@ import (
 	"github.com/blacktop/go-arm64"
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/ipsw/internal/demangle"
+	"github.com/blacktop/ipsw/internal/emu"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -407,6 +408,11 @@ var disCmd = &cobra.Command{
 			return errors.Wrapf(err, "failed to parse got(s)")
 		}
 
+		var jumpTables emu.JumpTables
+		if sec := m.FindSectionForVMAddr(startAddr); sec != nil {
+			jumpTables = emu.FindJumpTables(emu.MachO(m), data, startAddr, sec.Addr, sec.Addr+sec.Size)
+		}
+
 		var prevInstruction arm64.Instruction
 
 		for i := range arm64.Disassemble(bytes.NewReader(data), arm64.Options{StartAddress: int64(startAddr)}) {
@@ -470,6 +476,14 @@ var disCmd = &cobra.Command{
 				}
 			}
 
+			// markup switch dispatches and their cases
+			if jt := jumpTables.At(i.Instruction.Address()); jt != nil {
+				opStr += fmt.Sprintf(" ; %s", jt)
+			}
+			if label := jumpTables.Label(i.Instruction.Address()); len(label) > 0 {
+				opStr += fmt.Sprintf(" ; %s", label)
+			}
+
 			fmt.Printf("%#08x:  %s\t%-10v%s\n", i.Instruction.Address(), i.Instruction.OpCodes(), i.Instruction.Operation(), opStr)
 
 			prevInstruction = *i.Instruction
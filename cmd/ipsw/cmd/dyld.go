@@ -22,11 +22,26 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 func init() {
 	rootCmd.AddCommand(dyldCmd)
+
+	dyldCmd.PersistentFlags().Bool("mmap", false, "Memory-map the dyld_shared_cache and its subcaches")
+	dyldCmd.PersistentFlags().Int("workers", 0, "Number of images to analyze concurrently (defaults to the number of CPUs)")
+	viper.BindPFlag("dyld.mmap", dyldCmd.PersistentFlags().Lookup("mmap"))
+	viper.BindPFlag("dyld.workers", dyldCmd.PersistentFlags().Lookup("workers"))
+}
+
+// dyldConfig returns the dyld.Config set by the dyld command's persistent flags
+func dyldConfig() *dyld.Config {
+	return &dyld.Config{
+		MMap:    viper.GetBool("dyld.mmap"),
+		Workers: viper.GetInt("dyld.workers"),
+	}
 }
 
 // dyldCmd represents the dyld command
@@ -40,7 +40,7 @@ func init() {
 	a2fCmd.Flags().Uint64P("slide", "s", 0, "dyld_shared_cache slide to apply")
 	a2fCmd.Flags().StringP("in", "i", "", "Path to file containing list of addresses to lookup")
 	a2fCmd.Flags().StringP("out", "o", "", "Path to output JSON file")
-	a2fCmd.Flags().StringP("cache", "c", "", "Path to .a2s addr to sym cache file (speeds up analysis)")
+	a2fCmd.Flags().StringP("cache", "c", "", "Path to symbol index file (defaults to the cache's UUID in the user cache dir)")
 	a2fCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
 }
 
@@ -91,7 +91,7 @@ var a2fCmd = &cobra.Command{
 			dscPath = filepath.Join(linkRoot, symlinkPath)
 		}
 
-		f, err := dyld.Open(dscPath)
+		f, err := dyld.Open(dscPath, dyldConfig())
 		if err != nil {
 			return err
 		}
@@ -146,10 +146,7 @@ var a2fCmd = &cobra.Command{
 				enc = json.NewEncoder(os.Stdout)
 			}
 
-			if len(cacheFile) == 0 {
-				cacheFile = dscPath + ".a2s"
-			}
-			if err := f.OpenOrCreateA2SCache(cacheFile); err != nil {
+			if _, err := f.OpenOrCreateSymbolIndex(cacheFile); err != nil {
 				return err
 			}
 
@@ -162,7 +159,7 @@ var a2fCmd = &cobra.Command{
 
 				for _, ptr := range ptrs {
 					if fn, err := m.GetFunctionForVMAddr(ptr); err == nil {
-						if symName, ok := f.AddressToSymbol[fn.StartAddr]; ok {
+						if symName, ok := f.LookupSymbol(fn.StartAddr); ok {
 							fn.Name = symName
 						}
 						fs = append(fs, Func{
@@ -207,12 +204,12 @@ var a2fCmd = &cobra.Command{
 			defer m.Close()
 
 			// Load all symbols
-			if err := f.AnalyzeImage(image); err != nil {
+			if _, err := f.OpenOrCreateSymbolIndex(cacheFile); err != nil {
 				return err
 			}
 
 			if fn, err := m.GetFunctionForVMAddr(unslidAddr); err == nil {
-				if symName, ok := f.AddressToSymbol[fn.StartAddr]; ok {
+				if symName, ok := f.LookupSymbol(fn.StartAddr); ok {
 					if unslidAddr-fn.StartAddr == 0 {
 						fmt.Printf("\n%#x: %s (start: %#x, end: %#x)\n", addr, symName, fn.StartAddr, fn.EndAddr)
 					} else {
@@ -85,7 +85,7 @@ var a2oCmd = &cobra.Command{
 			dscPath = filepath.Join(linkRoot, symlinkPath)
 		}
 
-		f, err := dyld.Open(dscPath)
+		f, err := dyld.Open(dscPath, dyldConfig())
 		if err != nil {
 			return err
 		}
@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"text/tabwriter"
 
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/internal/utils"
@@ -38,6 +39,8 @@ func init() {
 	a2sCmd.Flags().Uint64P("slide", "s", 0, "dyld_shared_cache slide to apply")
 	a2sCmd.Flags().BoolP("image", "i", false, "Only lookup address's dyld_shared_cache mapping")
 	a2sCmd.Flags().BoolP("mapping", "m", false, "Only lookup address's image segment/section")
+	a2sCmd.Flags().StringP("cache", "c", "", "Path to symbol index file (defaults to the cache's UUID in the user cache dir)")
+	a2sCmd.Flags().Uint64P("end", "e", 0, "List all symbols from <vaddr> up to this unslid address")
 
 	a2sCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
 }
@@ -56,6 +59,8 @@ var a2sCmd = &cobra.Command{
 		slide, _ := cmd.Flags().GetUint64("slide")
 		showImage, _ := cmd.Flags().GetBool("image")
 		showMapping, _ := cmd.Flags().GetBool("mapping")
+		cacheFile, _ := cmd.Flags().GetString("cache")
+		endAddr, _ := cmd.Flags().GetUint64("end")
 
 		secondAttempt := false
 
@@ -89,66 +94,30 @@ var a2sCmd = &cobra.Command{
 			dscPath = filepath.Join(linkRoot, symlinkPath)
 		}
 
-		f, err := dyld.Open(dscPath)
+		f, err := dyld.Open(dscPath, dyldConfig())
 		if err != nil {
 			return err
 		}
 		defer f.Close()
 
 		// Load all symbols
-		// if _, err := os.Stat(dscPath + ".a2s"); os.IsNotExist(err) {
-		// 	log.Info("Generating dyld_shared_cache companion symbol map file...")
-
-		// 	// utils.Indent(log.Warn, 2)("parsing public symbols...")
-		// 	// err = f.GetAllExportedSymbols(false)
-		// 	// if err != nil {
-		// 	// 	return err
-		// 	// }
-		// 	utils.Indent(log.Warn, 2)("parsing private symbols...")
-		// 	err = f.ParseLocalSyms()
-		// 	if err != nil {
-		// 		utils.Indent(log.Warn, 2)(err.Error())
-		// 		utils.Indent(log.Warn, 2)("parsing patch exports...")
-		// 		for _, img := range f.Images {
-		// 			for _, patch := range img.PatchableExports {
-		// 				addr, err := f.GetVMAddress(uint64(patch.OffsetOfImpl))
-		// 				if err != nil {
-		// 					return err
-		// 				}
-		// 				f.AddressToSymbol[addr] = patch.Name
-		// 			}
-		// 		}
-		// 	}
-		// 	// cache all sels
-		// 	f.GetAllSelectors(false)
-		// 	f.GetAllClasses(false)
-		// 	f.GetAllProtocols(false)
-		// 	// save lookup map to disk to speed up subsequent requests
-		// 	err = f.SaveAddrToSymMap(dscPath + ".a2s")
-		// 	if err != nil {
-		// 		return err
-		// 	}
-
-		// } else {
-		// 	log.Info("Found dyld_shared_cache companion symbol map file...")
-		// 	a2sFile, err := os.Open(dscPath + ".a2s")
-		// 	if err != nil {
-		// 		return fmt.Errorf("failed to open companion file %s; %v", dscPath+".a2s", err)
-		// 	}
-
-		// 	gzr, err := gzip.NewReader(a2sFile)
-		// 	if err != nil {
-		// 		return fmt.Errorf("failed to create gzip reader: %v", err)
-		// 	}
-
-		// 	// Decoding the serialized data
-		// 	err = gob.NewDecoder(gzr).Decode(&f.AddressToSymbol)
-		// 	if err != nil {
-		// 		return fmt.Errorf("failed to decode addr2sym map; %v", err)
-		// 	}
-		// 	gzr.Close()
-		// 	a2sFile.Close()
-		// }
+		idx, err := f.OpenOrCreateSymbolIndex(cacheFile)
+		if err != nil {
+			return err
+		}
+
+		if endAddr > 0 {
+			syms, err := idx.Range(unslidAddr, endAddr)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+			for _, sym := range syms {
+				fmt.Fprintln(w, sym)
+			}
+			return w.Flush()
+		}
+
 	retry:
 		if showMapping {
 			_, mapping, err := f.GetMappingForVMAddress(unslidAddr)
@@ -202,6 +171,14 @@ var a2sCmd = &cobra.Command{
 			}
 		}
 
+		if symName, ok := f.LookupSymbol(unslidAddr); ok {
+			if secondAttempt {
+				symName = "_ptr." + symName
+			}
+			fmt.Printf("\n%#x: %s\n", addr, symName)
+			return nil
+		}
+
 		// Load all symbols
 		if err := f.AnalyzeImage(image); err != nil {
 			return err
@@ -227,7 +204,7 @@ var a2sCmd = &cobra.Command{
 			if unslidAddr-fn.StartAddr != 0 {
 				delta = fmt.Sprintf(" + %d", unslidAddr-fn.StartAddr)
 			}
-			if symName, ok := f.AddressToSymbol[fn.StartAddr]; ok {
+			if symName, ok := f.LookupSymbol(fn.StartAddr); ok {
 				if secondAttempt {
 					symName = "_ptr." + symName
 				}
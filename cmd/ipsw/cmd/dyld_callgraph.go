@@ -0,0 +1,119 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dyldCmd.AddCommand(dyldCallgraphCmd)
+
+	dyldCallgraphCmd.Flags().StringP("symbol", "s", "", "Only graph the functions reachable from this symbol (or address)")
+	dyldCallgraphCmd.Flags().IntP("depth", "d", 3, "Maximum call depth from --symbol or from every function (0 is unlimited, defaults to 1 without --symbol)")
+	dyldCallgraphCmd.Flags().StringP("format", "f", "dot", fmt.Sprintf("Output format (%s)", strings.Join(callgraph.Formats, ", ")))
+	dyldCallgraphCmd.Flags().StringP("output", "o", "", "Output file (default is stdout)")
+	dyldCallgraphCmd.Flags().StringP("cache", "c", "", "Path to symbol index file (defaults to the cache's UUID in the user cache dir)")
+
+	dyldCallgraphCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
+}
+
+// dyldCallgraphCmd represents the dyld callgraph command
+var dyldCallgraphCmd = &cobra.Command{
+	Use:           "callgraph <dyld_shared_cache> <image>",
+	Short:         "Export the call graph of a dylib as DOT, JSON or GraphML",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		symbol, _ := cmd.Flags().GetString("symbol")
+		depth, _ := cmd.Flags().GetInt("depth")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		cacheFile, _ := cmd.Flags().GetString("cache")
+
+		f, err := openDSC(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err := f.OpenOrCreateSymbolIndex(cacheFile); err != nil {
+			return err
+		}
+
+		var roots []uint64
+		if len(symbol) > 0 {
+			addr, err := utils.ConvertStrToInt(symbol)
+			if err != nil {
+				if addr, _, err = f.GetSymbolAddress(symbol, args[1]); err != nil {
+					return err
+				}
+			}
+			roots = append(roots, addr)
+		} else if !cmd.Flags().Changed("depth") {
+			depth = 1 // only the direct calls of every function
+		}
+
+		g, err := f.CallGraph(args[1], roots, depth)
+		if err != nil {
+			return err
+		}
+
+		return writeCallGraph(g, format, output)
+	},
+}
+
+func writeCallGraph(g *callgraph.Graph, format, output string) error {
+	if len(output) == 0 {
+		return g.Write(os.Stdout, format)
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", output, err)
+	}
+	defer out.Close()
+
+	if err := g.Write(out, format); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"nodes": len(g.Nodes),
+		"edges": len(g.Edges),
+	}).Infof("Created %s", output)
+
+	return nil
+}
@@ -0,0 +1,78 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dyldCmd.AddCommand(dyldCatCmd)
+
+	dyldCatCmd.Flags().StringP("output", "o", "", "Write the dylib to a file instead of stdout")
+	dyldCatCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
+}
+
+// dyldCatCmd represents the dyld cat command
+var dyldCatCmd = &cobra.Command{
+	Use:           "cat <dyld_shared_cache> <path>",
+	Short:         "Write an extracted dylib to stdout",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+
+		f, err := openDSC(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		dat, err := fs.ReadFile(f.FS(), fsPath(args[1]))
+		if err != nil {
+			return err
+		}
+
+		if len(output) > 0 {
+			if err := ioutil.WriteFile(output, dat, 0755); err != nil {
+				return fmt.Errorf("failed to write dylib %s: %v", output, err)
+			}
+			log.Infof("Created %s", output)
+			return nil
+		}
+
+		_, err = os.Stdout.Write(dat)
+		return err
+	},
+}
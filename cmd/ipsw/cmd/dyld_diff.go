@@ -0,0 +1,121 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dyldCmd.AddCommand(dyldDiffCmd)
+
+	dyldDiffCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	dyldDiffCmd.Flags().BoolP("quick", "q", false, "Skip diffing each image's exported symbols")
+	dyldDiffCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
+	dyldDiffCmd.MarkZshCompPositionalArgumentFile(2, "dyld_shared_cache*")
+}
+
+// openDSC opens a dyld_shared_cache following a symlinked cache path
+func openDSC(path string) (*dyld.File, error) {
+	dscPath := filepath.Clean(path)
+
+	fileInfo, err := os.Lstat(dscPath)
+	if err != nil {
+		return nil, fmt.Errorf("file %s does not exist", dscPath)
+	}
+
+	// Check if file is a symlink
+	if fileInfo.Mode()&os.ModeSymlink != 0 {
+		symlinkPath, err := os.Readlink(dscPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read symlink %s", dscPath)
+		}
+		// TODO: this seems like it would break
+		linkParent := filepath.Dir(dscPath)
+		linkRoot := filepath.Dir(linkParent)
+
+		dscPath = filepath.Join(linkRoot, symlinkPath)
+	}
+
+	return dyld.Open(dscPath, dyldConfig())
+}
+
+// dyldDiffCmd represents the dyld diff command
+var dyldDiffCmd = &cobra.Command{
+	Use:           "diff <old_dyld_shared_cache> <new_dyld_shared_cache>",
+	Short:         "Diff two dyld_shared_caches",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		asJSON, _ := cmd.Flags().GetBool("json")
+		quick, _ := cmd.Flags().GetBool("quick")
+
+		oldDSC, err := openDSC(args[0])
+		if err != nil {
+			return err
+		}
+		defer oldDSC.Close()
+
+		newDSC, err := openDSC(args[1])
+		if err != nil {
+			return err
+		}
+		defer newDSC.Close()
+
+		log.Info("Diffing dyld_shared_caches...")
+		diff, err := dyld.Diff(oldDSC, newDSC, &dyld.DiffConfig{
+			Exports:  !quick,
+			ObjC:     true,
+			Sections: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			j, err := json.Marshal(diff)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(j))
+			return nil
+		}
+
+		fmt.Print(diff)
+
+		return nil
+	},
+}
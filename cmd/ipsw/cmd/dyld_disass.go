@@ -45,7 +45,7 @@ func init() {
 	dyldDisassCmd.Flags().Uint64P("vaddr", "a", 0, "Virtual address to start disassembling")
 	dyldDisassCmd.Flags().Uint64P("count", "c", 0, "Number of instructions to disassemble")
 	dyldDisassCmd.Flags().BoolVarP(&demangleFlag, "demangle", "d", false, "Demangle symbol names")
-	dyldDisassCmd.Flags().String("cache", "", "Path to .a2s addr to sym cache file (speeds up analysis)")
+	dyldDisassCmd.Flags().String("cache", "", "Path to symbol index file (defaults to the cache's UUID in the user cache dir and only used without --image)")
 	dyldDisassCmd.Flags().StringP("image", "i", "", "dylib image to search")
 
 	symaddrCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
@@ -104,7 +104,7 @@ var dyldDisassCmd = &cobra.Command{
 			dscPath = filepath.Join(linkRoot, symlinkPath)
 		}
 
-		f, err := dyld.Open(dscPath)
+		f, err := dyld.Open(dscPath, dyldConfig())
 		if err != nil {
 			return err
 		}
@@ -115,33 +115,31 @@ var dyldDisassCmd = &cobra.Command{
 			return nil
 		}
 
-		if len(symbolName) > 0 {
-			if len(imageName) == 0 {
-				if len(cacheFile) == 0 {
-					cacheFile = dscPath + ".a2s"
-				}
-				if err := f.OpenOrCreateA2SCache(cacheFile); err != nil {
+		if len(imageName) == 0 {
+			// the whole cache symbol index is only needed when the image is NOT known
+			if _, err := f.OpenOrCreateSymbolIndex(cacheFile); err != nil {
+				return err
+			}
+		} else {
+			image, err = f.Image(imageName)
+			if err != nil {
+				return fmt.Errorf("image not in %s: %v", dscPath, err)
+			}
+			utils.Indent(log.Warn, 2)("parsing public symbols...")
+			if err := f.GetAllExportedSymbolsForImage(image, false); err != nil {
+				log.Error("failed to parse exported symbols")
+			}
+			utils.Indent(log.Warn, 2)("parsing private symbols...")
+			if err := f.GetLocalSymbolsForImage(image); err != nil {
+				if errors.Is(err, dyld.ErrNoLocals) {
+					utils.Indent(log.Warn, 2)(err.Error())
+				} else if err != nil {
 					return err
 				}
-			} else {
-				image, err = f.Image(imageName)
-				if err != nil {
-					return fmt.Errorf("image not in %s: %v", dscPath, err)
-				}
-				utils.Indent(log.Warn, 2)("parsing public symbols...")
-				if err := f.GetAllExportedSymbolsForImage(image, false); err != nil {
-					log.Error("failed to parse exported symbols")
-				}
-				utils.Indent(log.Warn, 2)("parsing private symbols...")
-				if err := f.GetLocalSymbolsForImage(image); err != nil {
-					if errors.Is(err, dyld.ErrNoLocals) {
-						utils.Indent(log.Warn, 2)(err.Error())
-					} else if err != nil {
-						return err
-					}
-				}
 			}
+		}
 
+		if len(symbolName) > 0 {
 			log.Info("Locating symbol: " + symbolName)
 			symAddr, image, err = f.GetSymbolAddress(symbolName, imageName)
 			if err != nil {
@@ -217,21 +215,6 @@ var dyldDisassCmd = &cobra.Command{
 		// 		}
 		// 	}
 		// }
-		if len(symbolName) == 0 {
-			utils.Indent(log.Warn, 2)("parsing public symbols...")
-			if err := f.GetAllExportedSymbolsForImage(image, false); err != nil {
-				log.Error("failed to parse exported symbols")
-			}
-			utils.Indent(log.Warn, 2)("parsing private symbols...")
-			if err := f.GetLocalSymbolsForImage(image); err != nil {
-				if errors.Is(err, dyld.ErrNoLocals) {
-					utils.Indent(log.Warn, 2)(err.Error())
-				} else if err != nil {
-					return err
-				}
-			}
-		}
-
 		//***********************
 		//* First pass ANALYSIS *
 		//***********************
@@ -399,6 +382,14 @@ var dyldDisassCmd = &cobra.Command{
 				}
 			}
 
+			// markup switch dispatches and their cases
+			if jt := triage.JumpTables().At(i.Instruction.Address()); jt != nil {
+				opStr += fmt.Sprintf(" ; %s", jt)
+			}
+			if label := triage.JumpTables().Label(i.Instruction.Address()); len(label) > 0 {
+				opStr += fmt.Sprintf(" ; %s", label)
+			}
+
 			if isMiddle && i.Instruction.Address() == symAddr {
 				fmt.Printf("👉%08x:  %s\t%-10v%s\n", i.Instruction.Address(), i.Instruction.OpCodes(), i.Instruction.Operation(), opStr)
 			} else {
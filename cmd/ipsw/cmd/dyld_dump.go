@@ -117,7 +117,7 @@ var dyldDumpCmd = &cobra.Command{
 			dscPath = filepath.Join(linkRoot, symlinkPath)
 		}
 
-		f, err := dyld.Open(dscPath)
+		f, err := dyld.Open(dscPath, dyldConfig())
 		if err != nil {
 			return err
 		}
@@ -25,7 +25,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
 
 	"github.com/apex/log"
 	"github.com/blacktop/ipsw/pkg/dyld"
@@ -56,10 +55,6 @@ var extractDyldCmd = &cobra.Command{
 			return fmt.Errorf("file %s does not exist", ipswPath)
 		}
 
-		if runtime.GOOS == "windows" {
-			log.Fatal("dyld_shared_cache extraction does not work on Windows :(")
-		}
-
 		log.Info("Extracting dyld_shared_cache")
 		return dyld.Extract(ipswPath, destPath)
 	},
@@ -0,0 +1,137 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/gadget"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dyldCmd.AddCommand(dyldGadgetsCmd)
+
+	dyldGadgetsCmd.Flags().StringP("image", "i", "", "Only search this dylib")
+	dyldGadgetsCmd.Flags().IntP("depth", "d", gadget.DefaultDepth, "Maximum number of instructions before the ret/branch")
+	dyldGadgetsCmd.Flags().StringSliceP("reg", "r", []string{}, "Only show gadgets that use these registers")
+	dyldGadgetsCmd.Flags().StringP("regex", "e", "", "Only show gadgets that match this regex")
+	dyldGadgetsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+
+	dyldGadgetsCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
+}
+
+// printGadgets prints the gadgets (or their JSON)
+func printGadgets(gadgets []*gadget.Gadget, asJSON bool) error {
+	if asJSON {
+		if gadgets == nil {
+			gadgets = []*gadget.Gadget{}
+		}
+		j, err := json.Marshal(gadgets)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(j))
+		return nil
+	}
+
+	if len(gadgets) == 0 {
+		log.Warn("no gadgets found")
+		return nil
+	}
+
+	for _, g := range gadgets {
+		loc := g.Locations[0]
+		fmt.Printf("%#x: %s", loc.Address, g)
+		if g.PAC {
+			fmt.Print("\t[PAC]")
+		}
+		if len(loc.Image) > 0 {
+			fmt.Printf("\t(%s", filepath.Base(loc.Image))
+			if len(g.Locations) > 1 {
+				fmt.Printf(" +%d more", len(g.Locations)-1)
+			}
+			fmt.Print(")")
+		} else if len(g.Locations) > 1 {
+			fmt.Printf("\t(+%d more)", len(g.Locations)-1)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+// dyldGadgetsCmd represents the dyld gadgets command
+var dyldGadgetsCmd = &cobra.Command{
+	Use:           "gadgets <dyld_shared_cache>",
+	Short:         "Find the ROP/JOP gadgets of every dylib",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		imageName, _ := cmd.Flags().GetString("image")
+		depth, _ := cmd.Flags().GetInt("depth")
+		regs, _ := cmd.Flags().GetStringSlice("reg")
+		regex, _ := cmd.Flags().GetString("regex")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		filter, err := gadget.Filters(regs, regex)
+		if err != nil {
+			return err
+		}
+
+		f, err := openDSC(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if !f.IsArm64() {
+			return fmt.Errorf("can only find the gadgets of arm64 caches")
+		}
+
+		var images []*dyld.CacheImage
+		if len(imageName) > 0 {
+			image, err := f.Image(imageName)
+			if err != nil {
+				return fmt.Errorf("image not in %s: %v", args[0], err)
+			}
+			images = append(images, image)
+		}
+
+		gadgets, err := f.FindGadgets(depth, images...)
+		if err != nil {
+			return err
+		}
+
+		return printGadgets(gadgets.Filter(filter), asJSON)
+	},
+}
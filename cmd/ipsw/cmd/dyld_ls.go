@@ -0,0 +1,119 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dyldCmd.AddCommand(dyldLsCmd)
+
+	dyldLsCmd.Flags().BoolP("recursive", "r", false, "List all the dylibs below the directory")
+	dyldLsCmd.Flags().BoolP("long", "l", false, "Show the (estimated) size of the extracted dylibs")
+	dyldLsCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
+}
+
+// dyldLsCmd represents the dyld ls command
+var dyldLsCmd = &cobra.Command{
+	Use:           "ls <dyld_shared_cache> [path]",
+	Short:         "List the dylibs in a dyld_shared_cache by install name",
+	Args:          cobra.RangeArgs(1, 2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		recursive, _ := cmd.Flags().GetBool("recursive")
+		long, _ := cmd.Flags().GetBool("long")
+
+		f, err := openDSC(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		dir := "."
+		if len(args) > 1 {
+			dir = fsPath(args[1])
+		}
+
+		fsys := f.FS()
+
+		printEntry := func(name string, d fs.DirEntry) error {
+			if d.IsDir() {
+				name += "/"
+			}
+			if long && !d.IsDir() {
+				fi, err := d.Info()
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%10d  %s\n", fi.Size(), name)
+			} else {
+				fmt.Println(name)
+			}
+			return nil
+		}
+
+		if recursive {
+			return fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					return nil
+				}
+				return printEntry("/"+name, d)
+			})
+		}
+
+		entries, err := fs.ReadDir(fsys, dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := printEntry(path.Join("/", dir, entry.Name()), entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+// fsPath converts an install name (e.g. /usr/lib/libobjc.A.dylib) to a dyld.File.FS path
+func fsPath(name string) string {
+	if name = strings.Trim(path.Clean("/"+name), "/"); len(name) == 0 {
+		return "."
+	}
+	return name
+}
@@ -23,9 +23,9 @@ package cmd
 
 import (
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -33,7 +33,6 @@ import (
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho"
-	"github.com/blacktop/go-macho/pkg/fixupchains"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -60,56 +59,6 @@ func init() {
 	dyldMachoCmd.MarkZshCompPositionalArgumentFile(1)
 }
 
-func rebaseMachO(dsc *dyld.File, machoPath string) error {
-	f, err := os.OpenFile(machoPath, os.O_RDWR, 0755)
-	if err != nil {
-		return fmt.Errorf("failed to open exported MachO %s: %v", machoPath, err)
-	}
-	defer f.Close()
-
-	mm, err := macho.NewFile(f)
-	if err != nil {
-		return err
-	}
-
-	for _, seg := range mm.Segments() {
-		uuid, mapping, err := dsc.GetMappingForVMAddress(seg.Addr)
-		if err != nil {
-			return err
-		}
-
-		if mapping.SlideInfoOffset == 0 {
-			continue
-		}
-
-		startAddr := seg.Addr - mapping.Address
-		endAddr := ((seg.Addr + seg.Memsz) - mapping.Address) + uint64(dsc.SlideInfo.GetPageSize())
-
-		start := startAddr / uint64(dsc.SlideInfo.GetPageSize())
-		end := endAddr / uint64(dsc.SlideInfo.GetPageSize())
-
-		rebases, err := dsc.GetRebaseInfoForPages(uuid, mapping, start, end)
-		if err != nil {
-			return err
-		}
-
-		for _, rebase := range rebases {
-			off, err := mm.GetOffset(rebase.CacheVMAddress)
-			if err != nil {
-				continue
-			}
-			if _, err := f.Seek(int64(off), io.SeekStart); err != nil {
-				return fmt.Errorf("failed to seek in exported file to offset %#x from the start: %v", off, err)
-			}
-			if err := binary.Write(f, dsc.ByteOrder, rebase.Target); err != nil {
-				return fmt.Errorf("failed to write rebase address %#x: %v", rebase.Target, err)
-			}
-		}
-	}
-
-	return nil
-}
-
 // dyldMachoCmd represents the macho command
 var dyldMachoCmd = &cobra.Command{
 	Use:   "macho <dyld_shared_cache> <dylib>",
@@ -158,7 +107,7 @@ var dyldMachoCmd = &cobra.Command{
 			dscPath = filepath.Join(linkRoot, symlinkPath)
 		}
 
-		f, err := dyld.Open(dscPath)
+		f, err := dyld.Open(dscPath, dyldConfig())
 		if err != nil {
 			return err
 		}
@@ -228,32 +177,19 @@ var dyldMachoCmd = &cobra.Command{
 					}
 
 					if _, err := os.Stat(fname); os.IsNotExist(err) || forceExtract {
-						var dcf *fixupchains.DyldChainedFixups
-						if m.HasFixups() {
-							dcf, err = m.DyldChainedFixups()
-							if err != nil {
-								return fmt.Errorf("failed to parse fixups from in memory MachO: %v", err)
-							}
+						dat, err := f.ExtractDylib(i)
+						if err != nil {
+							return fmt.Errorf("failed to extract dylib %s; %v", i.Name, err)
 						}
 
-						f.GetLocalSymbolsForImage(i)
-
-						// cc, err := m.GetObjCClasses()
-						// if err != nil {
-						// 	return err
-						// }
-						// for _, c := range cc {
-						// 	fmt.Println(c)
-						// }
-
-						err = m.Export(fname, dcf, m.GetBaseAddress(), i.GetLocalSymbols())
-						if err != nil {
-							return fmt.Errorf("failed to export entry MachO %s; %v", i.Name, err)
+						if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+							return fmt.Errorf("failed to create folder %s: %v", filepath.Dir(fname), err)
 						}
 
-						if err := rebaseMachO(f, fname); err != nil {
-							return fmt.Errorf("failed to rebase macho via cache slide info: %v", err)
+						if err := ioutil.WriteFile(fname, dat, 0755); err != nil {
+							return fmt.Errorf("failed to write dylib %s; %v", fname, err)
 						}
+
 						if !dumpALL {
 							log.Infof("Created %s", fname)
 						} else {
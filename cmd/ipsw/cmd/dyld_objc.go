@@ -27,6 +27,7 @@ import (
 	"path/filepath"
 
 	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/classdump"
 	"github.com/blacktop/ipsw/pkg/dyld"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -39,6 +40,8 @@ func init() {
 	dyldObjcCmd.Flags().BoolP("sel", "s", false, "Print the selectors")
 	dyldObjcCmd.Flags().BoolP("proto", "p", false, "Print the protocols")
 	dyldObjcCmd.Flags().BoolP("imp-cache", "i", false, "Print the imp-caches")
+	dyldObjcCmd.Flags().String("headers", "", "Generate the Objective-C headers into this folder")
+	dyldObjcCmd.Flags().String("image", "", "dylib image to generate the headers for (default: all)")
 
 	dyldObjcCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
 }
@@ -58,6 +61,8 @@ var dyldObjcCmd = &cobra.Command{
 		printSelectors, _ := cmd.Flags().GetBool("sel")
 		printProtocols, _ := cmd.Flags().GetBool("proto")
 		printImpCaches, _ := cmd.Flags().GetBool("imp-cache")
+		headersDir, _ := cmd.Flags().GetString("headers")
+		imageName, _ := cmd.Flags().GetString("image")
 
 		dscPath := filepath.Clean(args[0])
 
@@ -79,7 +84,7 @@ var dyldObjcCmd = &cobra.Command{
 			dscPath = filepath.Join(linkRoot, symlinkPath)
 		}
 
-		f, err := dyld.Open(dscPath)
+		f, err := dyld.Open(dscPath, dyldConfig())
 		if err != nil {
 			return err
 		}
@@ -113,6 +118,41 @@ var dyldObjcCmd = &cobra.Command{
 			}
 		}
 
+		if len(headersDir) > 0 {
+			var images []string
+			if len(imageName) > 0 {
+				images = append(images, imageName)
+			} else {
+				for _, image := range f.Images {
+					images = append(images, image.Name)
+				}
+			}
+			count := 0
+			for _, name := range images {
+				img, err := f.GetObjCHeaders(name)
+				if err != nil {
+					if len(imageName) > 0 {
+						return errors.Wrapf(err, "failed to parse objc metadata of %s", name)
+					}
+					if !errors.Is(err, classdump.ErrNoObjC) {
+						log.Warnf("failed to parse objc metadata of %s: %v", name, err)
+					}
+					continue
+				}
+				dir := headersDir
+				if len(imageName) == 0 {
+					dir = filepath.Join(headersDir, filepath.Base(name))
+				}
+				paths, err := img.WriteHeaders(dir)
+				if err != nil {
+					return err
+				}
+				log.WithField("folder", dir).Debugf("Wrote %d headers for %s", len(paths), name)
+				count += len(paths)
+			}
+			log.Infof("Wrote %d headers to %s", count, headersDir)
+		}
+
 		return nil
 	},
 }
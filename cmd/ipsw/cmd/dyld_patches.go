@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/tabwriter"
 
@@ -38,7 +39,9 @@ func init() {
 	dyldCmd.AddCommand(patchesCmd)
 
 	patchesCmd.Flags().StringP("image", "i", "", "dylib image to search")
-	patchesCmd.Flags().StringP("sym", "s", "", "dylib image symbol to dump patches for")
+	patchesCmd.Flags().StringP("symbol", "s", "", "Symbol to dump the patch locations of (every location rewritten when it is interposed)")
+	patchesCmd.Flags().String("sym", "", "dylib image symbol to dump patches for")
+	patchesCmd.Flags().MarkDeprecated("sym", "use --symbol instead")
 	patchesCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
 }
 
@@ -53,7 +56,10 @@ var patchesCmd = &cobra.Command{
 		}
 
 		imageName, _ := cmd.Flags().GetString("image")
-		symbolName, _ := cmd.Flags().GetString("sym")
+		symbolName, _ := cmd.Flags().GetString("symbol")
+		if len(symbolName) == 0 {
+			symbolName, _ = cmd.Flags().GetString("sym")
+		}
 
 		dscPath := filepath.Clean(args[0])
 
@@ -75,20 +81,35 @@ var patchesCmd = &cobra.Command{
 			dscPath = filepath.Join(linkRoot, symlinkPath)
 		}
 
-		f, err := dyld.Open(dscPath)
+		f, err := dyld.Open(dscPath, dyldConfig())
 		if err != nil {
 			return err
 		}
 		defer f.Close()
 
-		if f.IsDyld4 {
-			return fmt.Errorf("this command does NOT support the NEW iOS15+ dyld_shared_caches yet")
-		}
-
 		if err := f.ParsePatchInfo(); err != nil {
 			return err
 		}
 
+		if len(imageName) == 0 && len(symbolName) > 0 {
+			locations, err := f.GetPatchLocations(symbolName)
+			if err != nil {
+				return err
+			}
+			var images []string
+			for image := range locations {
+				images = append(images, image)
+			}
+			sort.Strings(images)
+			for _, image := range images {
+				log.Infof("%s (%s) patch locations", symbolName, image)
+				for _, loc := range locations[image] {
+					fmt.Println(loc)
+				}
+			}
+			return nil
+		}
+
 		if len(imageName) > 0 {
 			image, err := f.Image(imageName)
 			if err != nil {
@@ -99,15 +120,15 @@ var patchesCmd = &cobra.Command{
 					for _, patch := range image.PatchableExports {
 						if strings.EqualFold(strings.ToLower(patch.Name), strings.ToLower(symbolName)) {
 							log.Infof("%s patch locations", patch.Name)
-							for _, loc := range patch.PatchLocations {
-								fmt.Println(loc.String(f.Headers[f.UUID].SharedRegionStart))
+							for _, loc := range patch.Locations {
+								fmt.Println(loc)
 							}
 						}
 					}
 				} else {
 					w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.DiscardEmptyColumns)
 					for _, patch := range image.PatchableExports {
-						fmt.Fprintf(w, "0x%08X\t(%d patches)\t%s\n", patch.OffsetOfImpl, len(patch.PatchLocations), patch.Name)
+						fmt.Fprintf(w, "%#x\t(%d patches)\t%s\n", patch.Address, len(patch.Locations), patch.Name)
 					}
 					w.Flush()
 				}
@@ -120,7 +141,7 @@ var patchesCmd = &cobra.Command{
 					log.Infof("[%d entries] %s", len(img.PatchableExports), img.Name)
 					w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.DiscardEmptyColumns)
 					for _, patch := range img.PatchableExports {
-						fmt.Printf("0x%08X\t(%d patches)\t%s\n", patch.OffsetOfImpl, len(patch.PatchLocations), patch.Name)
+						fmt.Fprintf(w, "%#x\t(%d patches)\t%s\n", patch.Address, len(patch.Locations), patch.Name)
 					}
 					w.Flush()
 				}
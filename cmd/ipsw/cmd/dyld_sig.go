@@ -0,0 +1,152 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/blacktop/ipsw/pkg/signature"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dyldCmd.AddCommand(dyldSigCmd)
+
+	dyldSigCmd.Flags().StringP("image", "i", "", "Only scan this dylib")
+	dyldSigCmd.Flags().StringP("bytes", "b", "", "Byte pattern to scan for (e.g. \"fd 7b bf a9 ?? ?? ?? 94\")")
+	dyldSigCmd.Flags().StringP("instrs", "n", "", "Instruction pattern to scan for (e.g. \"adrp x?, *; ldr x?, [x?, #0x18]; blr x?\")")
+	dyldSigCmd.Flags().StringP("cache", "c", "", "Path to symbol index file (defaults to the cache's UUID in the user cache dir)")
+	dyldSigCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+
+	dyldSigCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
+	dyldSigCmd.MarkZshCompPositionalArgumentFile(2, "*.yaml", "*.yml")
+}
+
+// loadSignatures returns the signatures in the rules file (if given) plus the --bytes/--instrs signature
+func loadSignatures(args []string, bytesPattern, instrsPattern string) ([]*signature.Signature, error) {
+	var sigs []*signature.Signature
+
+	if len(args) > 0 {
+		rules, err := signature.LoadRules(args[0])
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, rules...)
+	}
+
+	if len(bytesPattern) > 0 || len(instrsPattern) > 0 {
+		sig, err := signature.Parse(signature.Rule{
+			Name:   "pattern",
+			Bytes:  bytesPattern,
+			Instrs: instrsPattern,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+
+	if len(sigs) == 0 {
+		return nil, fmt.Errorf("you must supply a rules file or a --bytes/--instrs pattern")
+	}
+
+	return sigs, nil
+}
+
+// dyldSigCmd represents the dyld sig command
+var dyldSigCmd = &cobra.Command{
+	Use:           "sig <dyld_shared_cache> [rules.yaml]",
+	Short:         "Scan the code of every dylib for byte and instruction signatures",
+	Args:          cobra.RangeArgs(1, 2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		imageName, _ := cmd.Flags().GetString("image")
+		bytesPattern, _ := cmd.Flags().GetString("bytes")
+		instrsPattern, _ := cmd.Flags().GetString("instrs")
+		cacheFile, _ := cmd.Flags().GetString("cache")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		sigs, err := loadSignatures(args[1:], bytesPattern, instrsPattern)
+		if err != nil {
+			return err
+		}
+
+		f, err := openDSC(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		for _, sig := range sigs {
+			if len(sig.Instrs) > 0 && !f.IsArm64() {
+				return fmt.Errorf("can only scan arm64 caches for instruction patterns")
+			}
+		}
+
+		var images []*dyld.CacheImage
+		if len(imageName) > 0 {
+			image, err := f.Image(imageName)
+			if err != nil {
+				return fmt.Errorf("image not in %s: %v", args[0], err)
+			}
+			images = append(images, image)
+		}
+
+		if _, err := f.OpenOrCreateSymbolIndex(cacheFile); err != nil {
+			return err
+		}
+
+		matches, err := f.ScanSignatures(sigs, images...)
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			j, err := json.Marshal(matches)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(j))
+			return nil
+		}
+
+		if len(matches) == 0 {
+			log.Warn("no signatures matched")
+			return nil
+		}
+
+		for _, match := range matches {
+			fmt.Println(match)
+		}
+
+		return nil
+	},
+}
@@ -36,11 +36,20 @@ import (
 func init() {
 	dyldCmd.AddCommand(slideCmd)
 	slideCmd.Flags().BoolP("auth", "a", false, "Print only slide info for mappings with auth flags")
-	slideCmd.Flags().Bool("json", false, "Output as JSON")
-	slideCmd.Flags().StringP("cache", "c", "", "path to addr to sym cache file")
+	slideCmd.Flags().Bool("auth-only", false, "Print only authenticated pointers")
+	slideCmd.Flags().StringP("image", "i", "", "Only dump the slide info of the given image's data segments")
+	slideCmd.Flags().StringP("mapping", "m", "", "Only dump the slide info of the mapping with the given name (e.g. __AUTH_CONST)")
+	slideCmd.Flags().BoolP("sym", "s", false, "Symbolicate the pointer targets (creates the symbol index the first time)")
+	slideCmd.Flags().Bool("json", false, "Output as JSON (an array of the decoded pointers per mapping)")
+	slideCmd.Flags().StringP("cache", "c", "", "Path to symbol index file (defaults to the cache's UUID in the user cache dir)")
 	slideCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
 }
 
+type slidPointer struct {
+	*dyld.SlidPointer
+	Symbol string `json:"symbol,omitempty"`
+}
+
 // slideCmd represents the slide command
 var slideCmd = &cobra.Command{
 	Use:   "slide <dyld_shared_cache>",
@@ -53,8 +62,12 @@ var slideCmd = &cobra.Command{
 		}
 
 		printAuthSlideInfo, _ := cmd.Flags().GetBool("auth")
+		authOnly, _ := cmd.Flags().GetBool("auth-only")
+		imageName, _ := cmd.Flags().GetString("image")
 		dumpJSON, _ := cmd.Flags().GetBool("json")
 		cacheFile, _ := cmd.Flags().GetString("cache")
+		mappingName, _ := cmd.Flags().GetString("mapping")
+		symbolicate, _ := cmd.Flags().GetBool("sym")
 
 		enc := json.NewEncoder(os.Stdout)
 
@@ -78,54 +91,56 @@ var slideCmd = &cobra.Command{
 			dscPath = filepath.Join(linkRoot, symlinkPath)
 		}
 
-		f, err := dyld.Open(dscPath)
+		f, err := dyld.Open(dscPath, dyldConfig())
 		if err != nil {
 			return err
 		}
 		defer f.Close()
 
-		if len(cacheFile) == 0 {
-			cacheFile = dscPath + ".a2s"
+		if symbolicate {
+			if _, err := f.OpenOrCreateSymbolIndex(cacheFile); err != nil {
+				return err
+			}
 		}
 
-		if err := f.OpenOrCreateA2SCache(cacheFile); err != nil {
-			return err
+		filter := dyld.SlideInfoFilter{
+			Image:    imageName,
+			Mapping:  mappingName,
+			AuthOnly: authOnly,
+			AuthData: printAuthSlideInfo,
 		}
 
-		for uuid := range f.Mappings {
-			if f.Headers[uuid].SlideInfoOffsetUnused > 0 {
-				mapping := &dyld.CacheMappingWithSlideInfo{CacheMappingAndSlideInfo: dyld.CacheMappingAndSlideInfo{
-					Address:         f.Mappings[uuid][1].Address,    // __DATA
-					Size:            f.Mappings[uuid][1].Size,       // __DATA
-					FileOffset:      f.Mappings[uuid][1].FileOffset, // __DATA
-					SlideInfoOffset: f.Headers[uuid].SlideInfoOffsetUnused,
-					SlideInfoSize:   f.Headers[uuid].SlideInfoSizeUnused,
-				}, Name: "__DATA"}
+		for _, sm := range f.SlideMappings() {
+			if !filter.MatchMapping(sm.CacheMappingWithSlideInfo) {
+				continue
+			}
+			if !dumpJSON && len(imageName) == 0 && !authOnly {
+				if err := f.DumpSlideInfo(sm.UUID, sm.CacheMappingWithSlideInfo); err != nil {
+					return err
+				}
+				continue
+			}
+			// one JSON array of pointers per mapping
+			var pointers []slidPointer
+			if err := f.MappingSlidPointers(sm, filter, func(p *dyld.SlidPointer) error {
+				ptr := slidPointer{SlidPointer: p}
+				if symbolicate {
+					ptr.Symbol, _ = f.LookupSymbol(p.Target)
+				}
 				if dumpJSON {
-					rebases, err := f.GetRebaseInfoForPages(uuid, mapping, 0, 0)
-					if err != nil {
-						return err
-					}
-					enc.Encode(rebases)
+					pointers = append(pointers, ptr)
+				} else if len(ptr.Symbol) > 0 {
+					fmt.Printf("%s\t%s\n", p, ptr.Symbol)
 				} else {
-					f.DumpSlideInfo(uuid, mapping)
+					fmt.Println(p)
 				}
-			} else {
-				for _, extMapping := range f.MappingsWithSlideInfo[uuid] {
-					if printAuthSlideInfo && !extMapping.Flags.IsAuthData() {
-						continue
-					}
-					if extMapping.SlideInfoSize > 0 {
-						if dumpJSON {
-							rebases, err := f.GetRebaseInfoForPages(uuid, extMapping, 0, 0)
-							if err != nil {
-								return err
-							}
-							enc.Encode(rebases)
-						} else {
-							f.DumpSlideInfo(uuid, extMapping)
-						}
-					}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if dumpJSON && len(pointers) > 0 {
+				if err := enc.Encode(pointers); err != nil {
+					return err
 				}
 			}
 		}
@@ -4,6 +4,7 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -19,7 +20,7 @@ func init() {
 	dyldCmd.AddCommand(splitCmd)
 	splitCmd.Flags().BoolP("all", "a", false, "Split ALL dylibs")
 	splitCmd.Flags().Bool("force", false, "Overwrite existing extracted dylib(s)")
-	splitCmd.Flags().String("output", "o", "Directory to extract the dylib(s)")
+	splitCmd.Flags().StringP("output", "o", "", "Directory to extract the dylib(s)")
 	splitCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
 }
 
@@ -62,7 +63,7 @@ var splitCmd = &cobra.Command{
 			dscPath = filepath.Join(linkRoot, symlinkPath)
 		}
 
-		f, err := dyld.Open(dscPath)
+		f, err := dyld.Open(dscPath, dyldConfig())
 		if err != nil {
 			return err
 		}
@@ -101,12 +102,7 @@ var splitCmd = &cobra.Command{
 				images = append(images, image)
 			}
 
-			for _, i := range images {
-				m, err := i.GetMacho()
-				if err != nil {
-					return err
-				}
-
+			extract := func(i *dyld.CacheImage) error {
 				folder := filepath.Dir(dscPath) // default to folder of shared cache
 				if len(extractPath) > 0 {
 					folder = extractPath
@@ -118,15 +114,17 @@ var splitCmd = &cobra.Command{
 				}
 
 				if _, err := os.Stat(fname); os.IsNotExist(err) || forceExtract {
+					dat, err := f.ExtractDylib(i)
+					if err != nil {
+						return fmt.Errorf("failed to extract dylib %s; %v", i.Name, err)
+					}
 
-					f.GetLocalSymbolsForImage(i)
-
-					if err := m.Export(fname, nil, m.GetBaseAddress(), i.GetLocalSymbols()); err != nil {
-						return fmt.Errorf("failed to export entry MachO %s; %v", i.Name, err)
+					if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+						return fmt.Errorf("failed to create folder %s: %v", filepath.Dir(fname), err)
 					}
 
-					if err := rebaseMachO(f, fname); err != nil {
-						return fmt.Errorf("failed to rebase macho via cache slide info: %v", err)
+					if err := ioutil.WriteFile(fname, dat, 0755); err != nil {
+						return fmt.Errorf("failed to write dylib %s; %v", fname, err)
 					}
 
 					if !dumpALL {
@@ -141,7 +139,18 @@ var splitCmd = &cobra.Command{
 						bar.Increment()
 					}
 				}
-				m.Close()
+				return nil
+			}
+
+			if dumpALL {
+				// extract the dylibs concurrently
+				return f.ForEachImage(extract)
+			}
+
+			for _, i := range images {
+				if err := extract(i); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -0,0 +1,204 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/dyld"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	dyldCmd.AddCommand(dyldStrCmd)
+
+	dyldStrCmd.Flags().StringP("image", "i", "", "Only search this dylib")
+	dyldStrCmd.Flags().BoolP("refs", "r", false, "Show the functions that reference each string (uses the symbol and xref indexes)")
+	dyldStrCmd.Flags().StringP("cache", "c", "", "Path to symbol index file (defaults to the cache's UUID in the user cache dir)")
+	dyldStrCmd.Flags().StringP("xrefs", "x", "", "Path to xref index file (defaults to the cache's UUID in the user cache dir)")
+	dyldStrCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+
+	dyldStrCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
+}
+
+type strOutput struct {
+	dyld.StringMatch
+	Refs []string `json:"refs,omitempty"`
+}
+
+// dyldStrCmd represents the dyld str command
+var dyldStrCmd = &cobra.Command{
+	Use:           "str <dyld_shared_cache> <regex>",
+	Short:         "Search the C strings, CFStrings, selectors and os_log strings of every dylib",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		imageName, _ := cmd.Flags().GetString("image")
+		showRefs, _ := cmd.Flags().GetBool("refs")
+		cacheFile, _ := cmd.Flags().GetString("cache")
+		xrefsFile, _ := cmd.Flags().GetString("xrefs")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		re, err := regexp.Compile(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid regex %s: %v", args[1], err)
+		}
+
+		f, err := openDSC(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		var images []*dyld.CacheImage
+		if len(imageName) > 0 {
+			image, err := f.Image(imageName)
+			if err != nil {
+				return fmt.Errorf("image not in %s: %v", args[0], err)
+			}
+			images = append(images, image)
+		}
+
+		matches, err := f.SearchStrings(re, images...)
+		if err != nil {
+			return err
+		}
+
+		var symIdx *dyld.SymbolIndex
+		var xrefIdx *dyld.XrefIndex
+		if showRefs {
+			if !f.IsArm64() {
+				return fmt.Errorf("can only find the references of arm64 caches (disassembly required to find Xrefs)")
+			}
+			if symIdx, err = f.OpenOrCreateSymbolIndex(cacheFile); err != nil {
+				return err
+			}
+			if xrefIdx, err = f.OpenOrCreateXrefIndex(xrefsFile); err != nil {
+				return err
+			}
+			defer xrefIdx.Close()
+		}
+
+		selRefs := make(map[string]map[string][]dyld.SelRef)
+		// xrefTargets returns the addresses whose xrefs reference the string
+		// (selectors are loaded through their __objc_selrefs which point to the uniqued selector strings)
+		xrefTargets := func(match dyld.StringMatch) ([]uint64, error) {
+			targets := []uint64{match.Address}
+			if !strings.HasSuffix(match.Section, ".__objc_methname") {
+				return targets, nil
+			}
+			refs, ok := selRefs[match.Image]
+			if !ok {
+				image, err := f.Image(match.Image)
+				if err != nil {
+					return nil, err
+				}
+				if refs, err = f.SelectorRefs(image); err != nil {
+					return nil, err
+				}
+				selRefs[match.Image] = refs
+			}
+			for _, ref := range refs[match.String] {
+				targets = append(targets, ref.Addr)
+				if ref.Selector != match.Address {
+					targets = append(targets, ref.Selector)
+				}
+			}
+			return targets, nil
+		}
+
+		var out []strOutput
+		for _, match := range matches {
+			o := strOutput{StringMatch: match}
+			if showRefs {
+				targets, err := xrefTargets(match)
+				if err != nil {
+					return err
+				}
+				var xrefs []dyld.Xref
+				seen := make(map[uint64]bool)
+				for _, target := range targets {
+					if seen[target] {
+						continue
+					}
+					seen[target] = true
+					txrefs, err := xrefIdx.To(target)
+					if err != nil {
+						return err
+					}
+					xrefs = append(xrefs, txrefs...)
+				}
+				funcs := make(map[string]bool)
+				for _, xref := range xrefs {
+					ref := fmt.Sprintf("%#x", xref.From)
+					if sym, err := symIdx.Containing(xref.From); err == nil {
+						ref = sym.Name
+					}
+					if img, err := f.GetImageContainingTextAddr(xref.From); err == nil {
+						ref += fmt.Sprintf(" (%s)", filepath.Base(img.Name))
+					}
+					if !funcs[ref] {
+						funcs[ref] = true
+						o.Refs = append(o.Refs, ref)
+					}
+				}
+				sort.Strings(o.Refs)
+			}
+			out = append(out, o)
+		}
+
+		if asJSON {
+			j, err := json.Marshal(out)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(j))
+			return nil
+		}
+
+		if len(out) == 0 {
+			log.Warnf("no strings matching %q", args[1])
+			return nil
+		}
+
+		for _, o := range out {
+			fmt.Printf("%#x: %q\t(%s|%s)\n", o.Address, o.String, o.Section, filepath.Base(o.Image))
+			for _, ref := range o.Refs {
+				fmt.Printf("\t%s\n", ref)
+			}
+		}
+
+		return nil
+	},
+}
@@ -22,9 +22,13 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/apex/log"
@@ -39,7 +43,9 @@ func init() {
 
 	symaddrCmd.Flags().BoolP("all", "a", false, "Find all symbol matches")
 	symaddrCmd.Flags().StringP("image", "i", "", "dylib image to search")
-	// symaddrCmd.Flags().StringP("cache", "c", "", "path to addr to sym cache file")
+	symaddrCmd.Flags().BoolP("prefix", "p", false, "Find all symbols starting with <SYMBOL>")
+	symaddrCmd.Flags().BoolP("regex", "r", false, "Find all symbols matching the <SYMBOL> regex")
+	symaddrCmd.Flags().StringP("cache", "c", "", "Path to symbol index file (defaults to the cache's UUID in the user cache dir)")
 	symaddrCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
 }
 
@@ -58,6 +64,13 @@ var symaddrCmd = &cobra.Command{
 
 		imageName, _ := cmd.Flags().GetString("image")
 		allMatches, _ := cmd.Flags().GetBool("all")
+		asPrefix, _ := cmd.Flags().GetBool("prefix")
+		asRegex, _ := cmd.Flags().GetBool("regex")
+		cacheFile, _ := cmd.Flags().GetString("cache")
+
+		if asPrefix && asRegex {
+			return fmt.Errorf("you can only use --prefix OR --regex (not both)")
+		}
 
 		dscPath := filepath.Clean(args[0])
 
@@ -79,13 +92,62 @@ var symaddrCmd = &cobra.Command{
 			dscPath = filepath.Join(linkRoot, symlinkPath)
 		}
 
-		f, err := dyld.Open(dscPath)
+		f, err := dyld.Open(dscPath, dyldConfig())
 		if err != nil {
 			return err
 		}
 		defer f.Close()
 
 		if len(args) > 1 {
+			/****************************
+			 * Search the symbol index *
+			 ****************************/
+			idx, err := f.OpenOrCreateSymbolIndex(cacheFile)
+			if err != nil {
+				return err
+			}
+
+			var syms []*dyld.IndexedSymbol
+			switch {
+			case asRegex:
+				re, err := regexp.Compile(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid regex %s: %v", args[1], err)
+				}
+				syms, err = idx.Regex(re)
+				if err != nil {
+					return err
+				}
+			case asPrefix:
+				if syms, err = idx.Prefix(args[1]); err != nil {
+					return err
+				}
+			default:
+				if syms, err = idx.Find(args[1]); err != nil {
+					return err
+				}
+			}
+
+			found := false
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+			for _, sym := range syms {
+				if len(imageName) > 0 && !strings.EqualFold(sym.Image, imageName) && !strings.EqualFold(filepath.Base(sym.Image), imageName) {
+					continue
+				}
+				fmt.Fprintln(w, sym)
+				found = true
+				if !allMatches && !asPrefix && !asRegex {
+					break
+				}
+			}
+			w.Flush()
+
+			if found {
+				return nil
+			} else if asPrefix || asRegex {
+				return fmt.Errorf("no symbols matched %s", args[1])
+			}
+
 			/**********************************
 			 * Search for symbol inside dylib *
 			 **********************************/
@@ -150,19 +212,22 @@ var symaddrCmd = &cobra.Command{
 				fmt.Println(lSym)
 			}
 			log.Warn("searching in exported symbols...")
-			for _, image := range f.Images {
+			searchImage := func(image *dyld.CacheImage, out io.Writer) (bool, error) {
 				// utils.Indent(log.Debug, 2)("Searching " + image.Name)
 				m, err := image.GetPartialMacho()
 				if err != nil {
-					return err
+					return false, err
 				}
 
-				w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+				w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+				defer w.Flush()
+
+				var found bool
 				if sym, err := f.FindExportedSymbolInImage(image.Name, args[1]); err != nil {
 					if !errors.Is(err, dyld.ErrSymbolNotInImage) {
 						m, err := image.GetMacho()
 						if err != nil {
-							return err
+							return false, err
 						}
 						for _, sym := range m.Symtab.Syms {
 							if sym.Name == args[1] {
@@ -171,10 +236,9 @@ var symaddrCmd = &cobra.Command{
 									sec = fmt.Sprintf("%s.%s", m.Sections[sym.Sect-1].Seg, m.Sections[sym.Sect-1].Name)
 								}
 								fmt.Fprintf(w, "%#09x:\t(%s)\t%s\t%s\n", sym.Value, sym.Type.String(sec), sym.Name, image.Name)
-
+								found = true
 								if !allMatches {
-									w.Flush()
-									return nil
+									return true, nil
 								}
 							}
 						}
@@ -182,10 +246,9 @@ var symaddrCmd = &cobra.Command{
 							for _, bind := range binds {
 								if bind.Name == args[1] {
 									fmt.Fprintf(w, "%#09x:\t(%s.%s|from %s)\t%s\t%s\n", bind.Start+bind.Offset, bind.Segment, bind.Section, bind.Dylib, bind.Name, image.Name)
-
+									found = true
 									if !allMatches {
-										w.Flush()
-										return nil
+										return true, nil
 									}
 								}
 							}
@@ -200,12 +263,36 @@ var symaddrCmd = &cobra.Command{
 						}
 					}
 					fmt.Fprintf(w, "%s\t%s\n", sym, image.Name)
+					found = true
+				}
 
-					if !allMatches {
-						return nil
-					}
+				return found, nil
+			}
+
+			if allMatches {
+				// search the images concurrently and print the matches in cache order
+				results := make(map[string]*bytes.Buffer, len(f.Images))
+				for _, image := range f.Images {
+					results[image.Name] = new(bytes.Buffer)
+				}
+				if err := f.ForEachImage(func(image *dyld.CacheImage) error {
+					_, err := searchImage(image, results[image.Name])
+					return err
+				}); err != nil {
+					return err
+				}
+				for _, image := range f.Images {
+					os.Stdout.Write(results[image.Name].Bytes())
+				}
+				return nil
+			}
+
+			for _, image := range f.Images {
+				if found, err := searchImage(image, os.Stdout); err != nil {
+					return err
+				} else if found {
+					return nil
 				}
-				w.Flush()
 			}
 
 			return nil
@@ -22,34 +22,41 @@ THE SOFTWARE.
 package cmd
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/apex/log"
-	"github.com/blacktop/go-arm64"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/blacktop/ipsw/pkg/dyld"
-	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	dyldCmd.AddCommand(xrefCmd)
 
-	xrefCmd.Flags().StringP("image", "i", "", "dylib image to search")
+	xrefCmd.Flags().StringP("image", "i", "", "Only show the xrefs from this dylib")
 	xrefCmd.Flags().Uint64P("slide", "s", 0, "dyld_shared_cache slide to apply")
-	xrefCmd.Flags().BoolP("imports", "", false, "Search all other dylibs that import the dylib containing the xref src")
+	xrefCmd.Flags().StringP("cache", "c", "", "Path to symbol index file (defaults to the cache's UUID in the user cache dir)")
+	xrefCmd.Flags().StringP("xrefs", "x", "", "Path to xref index file (defaults to the cache's UUID in the user cache dir)")
+	xrefCmd.Flags().Bool("cstring", false, "Find the xrefs to a cstring or selector name (instead of an address or symbol)")
+	xrefCmd.Flags().BoolP("json", "j", false, "Output as JSON")
 
 	xrefCmd.MarkZshCompPositionalArgumentFile(1, "dyld_shared_cache*")
 }
 
+type xrefOutput struct {
+	dyld.Xref
+	Image  string `json:"image,omitempty"`
+	Symbol string `json:"symbol,omitempty"`
+}
+
 // xrefCmd represents the xref command
 var xrefCmd = &cobra.Command{
-	Use:   "xref <dyld_shared_cache> <vaddr>",
-	Short: "🚧 [WIP] Find all cross references to an address",
-	Args:  cobra.MinimumNArgs(2),
+	Use:   "xref <dyld_shared_cache> <vaddr|symbol|cstring>",
+	Short: "Find all cross references to an address, symbol, selector or cstring",
+	Args:  cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		if Verbose {
@@ -57,157 +64,119 @@ var xrefCmd = &cobra.Command{
 		}
 
 		imageName, _ := cmd.Flags().GetString("image")
-
-		// TODO: add slide support (add to output addrs)
 		slide, _ := cmd.Flags().GetUint64("slide")
-		searchImports, _ := cmd.Flags().GetBool("imports")
+		cacheFile, _ := cmd.Flags().GetString("cache")
+		xrefsFile, _ := cmd.Flags().GetString("xrefs")
+		isCString, _ := cmd.Flags().GetBool("cstring")
+		asJSON, _ := cmd.Flags().GetBool("json")
 
-		addr, err := utils.ConvertStrToInt(args[1])
+		f, err := openDSC(args[0])
 		if err != nil {
 			return err
 		}
+		defer f.Close()
 
-		var unslidAddr uint64 = addr
-		if slide > 0 {
-			unslidAddr = addr - slide
+		if !f.IsArm64() {
+			log.Errorf("can only disassemble arm64 caches (disassembly required to find Xrefs)")
+			return nil
 		}
 
-		dscPath := filepath.Clean(args[0])
-
-		fileInfo, err := os.Lstat(dscPath)
+		symIdx, err := f.OpenOrCreateSymbolIndex(cacheFile)
 		if err != nil {
-			return fmt.Errorf("file %s does not exist", dscPath)
-		}
-
-		// Check if file is a symlink
-		if fileInfo.Mode()&os.ModeSymlink != 0 {
-			symlinkPath, err := os.Readlink(dscPath)
-			if err != nil {
-				return errors.Wrapf(err, "failed to read symlink %s", dscPath)
-			}
-			// TODO: this seems like it would break
-			linkParent := filepath.Dir(dscPath)
-			linkRoot := filepath.Dir(linkParent)
-
-			dscPath = filepath.Join(linkRoot, symlinkPath)
+			return err
 		}
 
-		f, err := dyld.Open(dscPath)
+		xrefIdx, err := f.OpenOrCreateXrefIndex(xrefsFile)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-
-		if !f.IsArm64() {
-			log.Errorf("can only disassemble arm64 caches (disassembly required to find Xrefs)")
-			return nil
-		}
+		defer xrefIdx.Close()
 
 		var srcImage *dyld.CacheImage
-		var images []*dyld.CacheImage
 		if len(imageName) > 0 {
-			srcImage, err = f.Image(imageName)
-			if err != nil {
-				return fmt.Errorf("image not in %s: %v", dscPath, err)
+			if srcImage, err = f.Image(imageName); err != nil {
+				return fmt.Errorf("image not in %s: %v", args[0], err)
 			}
-			images = append(images, srcImage)
+		}
+
+		// resolve the xrefs' target addresses
+		var targets []uint64
+		if isCString {
+			if targets, err = xrefIdx.FindString(args[1]); err != nil {
+				return err
+			}
+			if len(targets) == 0 {
+				return fmt.Errorf("no xrefs to cstring %q", args[1])
+			}
+		} else if addr, err := utils.ConvertStrToInt(args[1]); err == nil {
+			targets = append(targets, addr-slide)
 		} else {
-			srcImage, err = f.GetImageContainingVMAddr(unslidAddr)
+			syms, err := symIdx.Find(args[1])
 			if err != nil {
 				return err
 			}
-			images = append(images, srcImage)
-		}
-
-		if searchImports {
-			log.Info("Searching for importing dylibs")
-			for _, i := range f.Images {
-				m, err := i.GetPartialMacho()
-				if err != nil {
-					return err
-				}
-				if utils.StrSliceContains(m.ImportedLibraries(), srcImage.Name) {
-					images = append(images, i)
-				}
-				m.Close()
+			if len(syms) == 0 {
+				return fmt.Errorf("failed to find symbol %s", args[1])
 			}
-		}
-
-		for _, img := range images {
-			xrefs := make(map[uint64]string)
-
-			if err := f.AnalyzeImage(img); err != nil {
-				return fmt.Errorf("failed to analyze image: %s; %v", img.Name, err)
+			for _, sym := range syms {
+				targets = append(targets, sym.Address)
 			}
+		}
 
-			m, err := img.GetMacho()
+		var out []xrefOutput
+		for _, target := range targets {
+			xrefs, err := xrefIdx.To(target)
 			if err != nil {
 				return err
 			}
-			defer m.Close()
 
-			if m.HasObjC() {
-				log.Debug("Parsing ObjC runtime structures...")
-				if err := f.ParseObjcForImage(img.Name); err != nil {
-					return fmt.Errorf("failed to parse objc data for image %s: %v", img.Name, err)
+			var found []xrefOutput
+			for _, xref := range xrefs {
+				img, err := f.GetImageContainingTextAddr(xref.From)
+				if err != nil || (srcImage != nil && img != srcImage) {
+					continue
 				}
-			}
-
-			for _, fn := range m.GetFunctions() {
-				uuid, soff, err := f.GetOffset(fn.StartAddr)
-				if err != nil {
-					return err
-				}
-
-				data, err := f.ReadBytesForUUID(uuid, int64(soff), uint64(fn.EndAddr-fn.StartAddr))
-				if err != nil {
-					return err
-				}
-
-				triage, err := f.FirstPassTriage(m, &fn, bytes.NewReader(data), arm64.Options{StartAddress: int64(fn.StartAddr)}, false)
-				if err != nil {
-					return err
+				x := xrefOutput{Xref: xref, Image: img.Name}
+				if sym, err := symIdx.Containing(xref.From); err == nil {
+					x.Symbol = fmt.Sprintf("%s + %d", sym.Name, xref.From-sym.Address)
 				}
+				x.From += slide
+				x.Target += slide
+				found = append(found, x)
+			}
+			sort.Slice(found, func(i, j int) bool { return found[i].From < found[j].From })
 
-				if ok, loc := triage.Contains(unslidAddr); ok {
-					if sym := f.FindSymbol(fn.StartAddr, false); len(sym) > 0 {
-						xrefs[loc] = fmt.Sprintf("%s + %d", sym, loc-fn.StartAddr)
-					} else {
-						xrefs[loc] = fmt.Sprintf("func_%x + %d", fn.StartAddr, loc-fn.StartAddr)
-					}
-					// } else if triage.IsData(unslidAddr) {
-					// 	xrefs[fn.StartAddr] = fmt.Sprintf("data_%x", fn.StartAddr)
-					// } else {
-					// 	if detail, ok := triage.Details[unslidAddr]; ok {
-					// 		xrefs[fn.StartAddr] = detail.String()
-					// 	}
-					// }
-				}
+			if asJSON {
+				out = append(out, found...)
+				continue
 			}
 
 			msg := "XREFS"
-			if len(xrefs) == 0 {
+			if len(found) == 0 {
 				msg = "No XREFS found"
 			}
-			if symName, ok := f.AddressToSymbol[unslidAddr]; ok {
-				log.WithFields(log.Fields{
-					"sym":   symName,
-					"dylib": img.Name,
-					"xrefs": len(xrefs),
-				}).Info(msg)
-			} else {
-				log.WithFields(log.Fields{
-					"dylib": img.Name,
-					"xrefs": len(xrefs),
-				}).Info(msg)
+			fields := log.Fields{"target": fmt.Sprintf("%#x", target+slide), "xrefs": len(found)}
+			if symName, ok := f.LookupSymbol(target); ok {
+				fields["sym"] = symName
 			}
-			if len(xrefs) > 0 {
-				for addr, sym := range xrefs {
-					fmt.Printf("%#x: %s\n", addr, sym)
+			log.WithFields(fields).Info(msg)
+			for _, x := range found {
+				if len(x.Symbol) > 0 {
+					fmt.Printf("%#x: %s\t(%s|%s)\n", x.From, x.Symbol, x.Type, filepath.Base(x.Image))
+				} else {
+					fmt.Printf("%#x: (%s|%s)\n", x.From, x.Type, filepath.Base(x.Image))
 				}
 			}
 		}
 
+		if asJSON {
+			j, err := json.Marshal(out)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(j))
+		}
+
 		return nil
 	},
 }
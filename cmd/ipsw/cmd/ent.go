@@ -27,6 +27,8 @@ import (
 	"compress/gzip"
 	"encoding/gob"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -99,46 +101,45 @@ var entCmd = &cobra.Command{
 				return fmt.Errorf("failed to parse ipsw info: %v", err)
 			}
 
-			fileSystem, err := utils.Unzip(ipswPath, "", func(f *zip.File) bool {
+			dmg, err := utils.OpenZipFile(ipswPath, func(f *zip.File) bool {
 				return strings.EqualFold(f.Name, fsDMG)
 			})
-			if err != nil || len(fileSystem) != 1 {
-				return fmt.Errorf("failed extract %s from ipsw, found %v: %v", fsDMG, fileSystem, err)
-			}
-			defer os.Remove(fileSystem[0])
-
-			mountPoint := "/tmp/filesystem_dmg"
-			utils.Indent(log.Info, 2)(fmt.Sprintf("Mounting DMG %s", fileSystem[0]))
-			if err := utils.Mount(fileSystem[0], mountPoint); err != nil {
-				return fmt.Errorf("failed to mount %s: %v", fileSystem[0], err)
+			if err != nil {
+				return fmt.Errorf("failed to open %s in ipsw: %v", fsDMG, err)
 			}
-			defer func() {
-				utils.Indent(log.Info, 2)(fmt.Sprintf("Unmounting DMG %s", fileSystem[0]))
-				if err := utils.Unmount(mountPoint, false); err != nil {
-					utils.Indent(log.Fatal, 2)(fmt.Sprintf("failed to unmount %s: %v", mountPoint, err))
-				}
-			}()
+			defer dmg.Close()
 
-			var files []string
-			if err := filepath.Walk(mountPoint, func(path string, info os.FileInfo, err error) error {
-				if !info.IsDir() {
-					files = append(files, path)
-				}
-				return nil
-			}); err != nil {
-				return fmt.Errorf("failed to walk files in dir %s: %v", mountPoint, err)
+			utils.Indent(log.Info, 2)(fmt.Sprintf("Reading DMG %s", dmg.Name))
+			vol, err := utils.OpenDMGVolume(dmg, dmg.Size)
+			if err != nil {
+				return fmt.Errorf("failed to read filesystem in %s: %v", dmg.Name, err)
 			}
 
 			entDB = make(map[string]string)
 
-			for _, file := range files {
-				if m, err := macho.Open(file); err == nil {
+			if err := fs.WalkDir(vol, ".", func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					log.Debugf("failed to walk %s: %v", path, err)
+					return nil
+				}
+				if !d.Type().IsRegular() {
+					return nil
+				}
+				f, err := vol.Open(path)
+				if err != nil {
+					return nil
+				}
+				defer f.Close()
+				if m, err := macho.NewFile(f.(io.ReaderAt)); err == nil {
 					if m.CodeSignature() != nil && len(m.CodeSignature().Entitlements) > 0 {
-						entDB[strings.TrimPrefix(file, mountPoint)] = m.CodeSignature().Entitlements
+						entDB["/"+path] = m.CodeSignature().Entitlements
 					} else {
-						entDB[strings.TrimPrefix(file, mountPoint)] = ""
+						entDB["/"+path] = ""
 					}
 				}
+				return nil
+			}); err != nil {
+				return fmt.Errorf("failed to walk files in %s: %v", dmg.Name, err)
 			}
 
 			if _, err := os.Stat(entDBPath); os.IsNotExist(err) {
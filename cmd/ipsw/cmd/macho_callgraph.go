@@ -0,0 +1,155 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	machoCmd.AddCommand(machoCallgraphCmd)
+
+	machoCallgraphCmd.Flags().StringP("arch", "a", "", "Which architecture to use for fat/universal MachO")
+	machoCallgraphCmd.Flags().StringP("symbol", "s", "", "Only graph the functions reachable from this symbol (or address)")
+	machoCallgraphCmd.Flags().IntP("depth", "d", 3, "Maximum call depth from --symbol or from every function (0 is unlimited, defaults to 1 without --symbol)")
+	machoCallgraphCmd.Flags().StringP("format", "f", "dot", fmt.Sprintf("Output format (%s)", strings.Join(callgraph.Formats, ", ")))
+	machoCallgraphCmd.Flags().StringP("output", "o", "", "Output file (default is stdout)")
+	viper.BindPFlag("macho.callgraph.arch", machoCallgraphCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("macho.callgraph.symbol", machoCallgraphCmd.Flags().Lookup("symbol"))
+	viper.BindPFlag("macho.callgraph.depth", machoCallgraphCmd.Flags().Lookup("depth"))
+	viper.BindPFlag("macho.callgraph.format", machoCallgraphCmd.Flags().Lookup("format"))
+	viper.BindPFlag("macho.callgraph.output", machoCallgraphCmd.Flags().Lookup("output"))
+	machoCallgraphCmd.MarkZshCompPositionalArgumentFile(1)
+}
+
+// machoCallgraphCmd represents the macho callgraph command
+var machoCallgraphCmd = &cobra.Command{
+	Use:           "callgraph <macho>",
+	Short:         "Export the call graph of a MachO as DOT, JSON or GraphML",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		var m *macho.File
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		// flags
+		selectedArch := viper.GetString("macho.callgraph.arch")
+		symbol := viper.GetString("macho.callgraph.symbol")
+		depth := viper.GetInt("macho.callgraph.depth")
+		format := viper.GetString("macho.callgraph.format")
+		output := viper.GetString("macho.callgraph.output")
+
+		machoPath := filepath.Clean(args[0])
+
+		// first check for fat file
+		fat, err := macho.OpenFat(machoPath)
+		if err != nil && err != macho.ErrNotFat {
+			return err
+		}
+		if err == macho.ErrNotFat {
+			m, err = macho.Open(machoPath)
+			if err != nil {
+				return err
+			}
+		} else {
+			var options []string
+			var shortOptions []string
+			for _, arch := range fat.Arches {
+				options = append(options, fmt.Sprintf("%s, %s", arch.CPU, arch.SubCPU.String(arch.CPU)))
+				shortOptions = append(shortOptions, strings.ToLower(arch.SubCPU.String(arch.CPU)))
+			}
+
+			if len(selectedArch) > 0 {
+				found := false
+				for i, opt := range shortOptions {
+					if strings.Contains(strings.ToLower(opt), strings.ToLower(selectedArch)) {
+						m = fat.Arches[i].File
+						found = true
+						break
+					}
+				}
+				if !found {
+					return fmt.Errorf("--arch '%s' not found in: %s", selectedArch, strings.Join(shortOptions, ", "))
+				}
+			} else {
+				choice := 0
+				prompt := &survey.Select{
+					Message: "Detected a universal MachO file, please select an architecture to analyze:",
+					Options: options,
+				}
+				survey.AskOne(prompt, &choice)
+				m = fat.Arches[choice].File
+			}
+		}
+
+		if !strings.Contains(strings.ToLower(m.CPU.String()), "arm64") {
+			return fmt.Errorf("can only build the call graph of arm64 MachOs")
+		}
+
+		p, err := callgraph.NewMachO(m, filepath.Base(machoPath))
+		if err != nil {
+			return err
+		}
+
+		var roots []uint64
+		if len(symbol) > 0 {
+			addr, err := utils.ConvertStrToInt(symbol)
+			if err != nil {
+				sym, err := m.FindSymbolAddress(symbol)
+				if err != nil {
+					return fmt.Errorf("failed to find symbol %s: %v", symbol, err)
+				}
+				addr = sym
+			}
+			roots = append(roots, addr)
+		} else {
+			for _, fn := range m.GetFunctions() {
+				roots = append(roots, fn.StartAddr)
+			}
+			if !cmd.Flags().Changed("depth") {
+				depth = 1 // only the direct calls of every function
+			}
+		}
+
+		g, err := callgraph.Build(p, roots, depth)
+		if err != nil {
+			return err
+		}
+
+		return writeCallGraph(g, format, output)
+	},
+}
@@ -0,0 +1,134 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/pkg/gadget"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	machoCmd.AddCommand(machoGadgetsCmd)
+
+	machoGadgetsCmd.Flags().StringP("arch", "a", "", "Which architecture to use for fat/universal MachO")
+	machoGadgetsCmd.Flags().IntP("depth", "d", gadget.DefaultDepth, "Maximum number of instructions before the ret/branch")
+	machoGadgetsCmd.Flags().StringSliceP("reg", "r", []string{}, "Only show gadgets that use these registers")
+	machoGadgetsCmd.Flags().StringP("regex", "e", "", "Only show gadgets that match this regex")
+	machoGadgetsCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	viper.BindPFlag("macho.gadgets.arch", machoGadgetsCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("macho.gadgets.depth", machoGadgetsCmd.Flags().Lookup("depth"))
+	viper.BindPFlag("macho.gadgets.reg", machoGadgetsCmd.Flags().Lookup("reg"))
+	viper.BindPFlag("macho.gadgets.regex", machoGadgetsCmd.Flags().Lookup("regex"))
+	viper.BindPFlag("macho.gadgets.json", machoGadgetsCmd.Flags().Lookup("json"))
+	machoGadgetsCmd.MarkZshCompPositionalArgumentFile(1)
+}
+
+// machoGadgetsCmd represents the macho gadgets command
+var machoGadgetsCmd = &cobra.Command{
+	Use:           "gadgets <macho>",
+	Short:         "Find the ROP/JOP gadgets of an arm64 MachO",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		var m *macho.File
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		// flags
+		selectedArch := viper.GetString("macho.gadgets.arch")
+		depth := viper.GetInt("macho.gadgets.depth")
+		regs := viper.GetStringSlice("macho.gadgets.reg")
+		regex := viper.GetString("macho.gadgets.regex")
+		asJSON := viper.GetBool("macho.gadgets.json")
+
+		filter, err := gadget.Filters(regs, regex)
+		if err != nil {
+			return err
+		}
+
+		machoPath := filepath.Clean(args[0])
+
+		// first check for fat file
+		fat, err := macho.OpenFat(machoPath)
+		if err != nil && err != macho.ErrNotFat {
+			return err
+		}
+		if err == macho.ErrNotFat {
+			m, err = macho.Open(machoPath)
+			if err != nil {
+				return err
+			}
+		} else {
+			var options []string
+			var shortOptions []string
+			for _, arch := range fat.Arches {
+				options = append(options, fmt.Sprintf("%s, %s", arch.CPU, arch.SubCPU.String(arch.CPU)))
+				shortOptions = append(shortOptions, strings.ToLower(arch.SubCPU.String(arch.CPU)))
+			}
+
+			if len(selectedArch) > 0 {
+				found := false
+				for i, opt := range shortOptions {
+					if strings.Contains(strings.ToLower(opt), strings.ToLower(selectedArch)) {
+						m = fat.Arches[i].File
+						found = true
+						break
+					}
+				}
+				if !found {
+					return fmt.Errorf("--arch '%s' not found in: %s", selectedArch, strings.Join(shortOptions, ", "))
+				}
+			} else {
+				choice := 0
+				prompt := &survey.Select{
+					Message: "Detected a universal MachO file, please select an architecture to analyze:",
+					Options: options,
+				}
+				survey.AskOne(prompt, &choice)
+				m = fat.Arches[choice].File
+			}
+		}
+
+		if !strings.Contains(strings.ToLower(m.CPU.String()), "arm64") {
+			return fmt.Errorf("can only find the gadgets of arm64 MachOs")
+		}
+
+		gadgets := gadget.NewSet(depth)
+		if err := gadgets.AddMachO(m, ""); err != nil {
+			return err
+		}
+
+		return printGadgets(gadgets.Filter(filter), asJSON)
+	},
+}
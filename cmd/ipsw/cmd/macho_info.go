@@ -36,6 +36,8 @@ import (
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/go-macho/pkg/fixupchains"
 	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/classdump"
+	"github.com/blacktop/ipsw/pkg/swift"
 	"github.com/fullsailor/pkcs7"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -52,6 +54,8 @@ func init() {
 	machoInfoCmd.Flags().BoolP("ent", "e", false, "Print entitlements")
 	machoInfoCmd.Flags().BoolP("objc", "o", false, "Print ObjC info")
 	machoInfoCmd.Flags().BoolP("objc-refs", "r", false, "Print ObjC references")
+	machoInfoCmd.Flags().String("headers", "", "Generate the ObjC headers into this folder (with --objc)")
+	machoInfoCmd.Flags().Bool("swift", false, "Print Swift info")
 	machoInfoCmd.Flags().BoolP("symbols", "n", false, "Print symbols")
 	machoInfoCmd.Flags().BoolP("strings", "c", false, "Print cstrings")
 	machoInfoCmd.Flags().BoolP("starts", "f", false, "Print function starts")
@@ -66,6 +70,8 @@ func init() {
 	viper.BindPFlag("macho.info.ent", machoInfoCmd.Flags().Lookup("ent"))
 	viper.BindPFlag("macho.info.objc", machoInfoCmd.Flags().Lookup("objc"))
 	viper.BindPFlag("macho.info.objc-refs", machoInfoCmd.Flags().Lookup("objc-refs"))
+	viper.BindPFlag("macho.info.headers", machoInfoCmd.Flags().Lookup("headers"))
+	viper.BindPFlag("macho.info.swift", machoInfoCmd.Flags().Lookup("swift"))
 	viper.BindPFlag("macho.info.symbols", machoInfoCmd.Flags().Lookup("symbols"))
 	viper.BindPFlag("macho.info.starts", machoInfoCmd.Flags().Lookup("starts"))
 	viper.BindPFlag("macho.info.strings", machoInfoCmd.Flags().Lookup("strings"))
@@ -97,6 +103,8 @@ var machoInfoCmd = &cobra.Command{
 		showEntitlements := viper.GetBool("macho.info.ent")
 		showObjC := viper.GetBool("macho.info.objc")
 		showObjcRefs := viper.GetBool("macho.info.objc-refs")
+		headersDir := viper.GetString("macho.info.headers")
+		showSwift := viper.GetBool("macho.info.swift")
 		showSymbols := viper.GetBool("macho.info.symbols")
 		showFuncStarts := viper.GetBool("macho.info.starts")
 		dumpStrings := viper.GetBool("macho.info.strings")
@@ -108,12 +116,12 @@ var machoInfoCmd = &cobra.Command{
 			return fmt.Errorf("you must supply a --fileset-entry|-t AND --extract-fileset-entry|-x to extract a file-set entry")
 		}
 
-		onlySig := !showHeader && !showLoadCommands && showSignature && !showEntitlements && !showObjC && !showSymbols && !showFixups && !showFuncStarts && !dumpStrings
-		onlyEnt := !showHeader && !showLoadCommands && !showSignature && showEntitlements && !showObjC && !showSymbols && !showFixups && !showFuncStarts && !dumpStrings
-		onlyFixups := !showHeader && !showLoadCommands && !showSignature && !showEntitlements && !showObjC && !showSymbols && showFixups && !showFuncStarts && !dumpStrings
-		onlyFuncStarts := !showHeader && !showLoadCommands && !showSignature && !showEntitlements && !showObjC && !showSymbols && !showFixups && showFuncStarts && !dumpStrings
-		onlyStrings := !showHeader && !showLoadCommands && !showSignature && !showEntitlements && !showObjC && !showSymbols && !showFixups && !showFuncStarts && dumpStrings
-		onlySymbols := !showHeader && !showLoadCommands && !showSignature && !showEntitlements && !showObjC && showSymbols && !showFixups && !showFuncStarts && !dumpStrings
+		onlySig := !showHeader && !showLoadCommands && showSignature && !showEntitlements && !showObjC && !showSwift && !showSymbols && !showFixups && !showFuncStarts && !dumpStrings
+		onlyEnt := !showHeader && !showLoadCommands && !showSignature && showEntitlements && !showObjC && !showSwift && !showSymbols && !showFixups && !showFuncStarts && !dumpStrings
+		onlyFixups := !showHeader && !showLoadCommands && !showSignature && !showEntitlements && !showObjC && !showSwift && !showSymbols && showFixups && !showFuncStarts && !dumpStrings
+		onlyFuncStarts := !showHeader && !showLoadCommands && !showSignature && !showEntitlements && !showObjC && !showSwift && !showSymbols && !showFixups && showFuncStarts && !dumpStrings
+		onlyStrings := !showHeader && !showLoadCommands && !showSignature && !showEntitlements && !showObjC && !showSwift && !showSymbols && !showFixups && !showFuncStarts && dumpStrings
+		onlySymbols := !showHeader && !showLoadCommands && !showSignature && !showEntitlements && !showObjC && !showSwift && showSymbols && !showFixups && !showFuncStarts && !dumpStrings
 
 		machoPath := filepath.Clean(args[0])
 
@@ -196,7 +204,7 @@ var machoInfoCmd = &cobra.Command{
 		if showHeader && !showLoadCommands {
 			fmt.Println(m.FileHeader.String())
 		}
-		if showLoadCommands || (!showHeader && !showLoadCommands && !showSignature && !showEntitlements && !showObjC && !showSymbols && !showFixups && !showFuncStarts && !dumpStrings) {
+		if showLoadCommands || (!showHeader && !showLoadCommands && !showSignature && !showEntitlements && !showObjC && !showSwift && !showSymbols && !showFixups && !showFuncStarts && !dumpStrings) {
 			fmt.Println(m.FileTOC.String())
 		}
 
@@ -309,101 +317,129 @@ var machoInfoCmd = &cobra.Command{
 			fmt.Println("Objective-C")
 			fmt.Println("===========")
 			if m.HasObjC() {
-				if info, err := m.GetObjCImageInfo(); err == nil {
-					fmt.Println(info.Flags)
-				} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
-					log.Error(err.Error())
-				}
-				if Verbose {
-					fmt.Println(m.GetObjCToc())
-				}
-				if protos, err := m.GetObjCProtocols(); err == nil {
-					for _, proto := range protos {
-						if Verbose {
-							fmt.Println(proto.Verbose())
-						} else {
-							fmt.Println(proto.String())
-						}
+				if len(headersDir) > 0 {
+					img, err := classdump.ParseMachO(m)
+					if err != nil {
+						return fmt.Errorf("failed to parse objc metadata: %v", err)
 					}
-				} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
-					log.Error(err.Error())
-				}
-				if classes, err := m.GetObjCClasses(); err == nil {
-					for _, class := range classes {
-						if Verbose {
-							fmt.Println(class.Verbose())
-						} else {
-							fmt.Println(class.String())
-						}
+					img.Name = filepath.Base(machoPath)
+					if len(filesetEntry) > 0 {
+						img.Name = filesetEntry
 					}
-				} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
-					log.Error(err.Error())
-				}
-				if cats, err := m.GetObjCCategories(); err == nil {
-					for _, cat := range cats {
-						if Verbose {
-							fmt.Println(cat.Verbose())
-						} else {
-							fmt.Println(cat.String())
-						}
+					paths, err := img.WriteHeaders(headersDir)
+					if err != nil {
+						return err
 					}
-				} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
-					log.Error(err.Error())
-				}
-				if showObjcRefs {
-					if protRefs, err := m.GetObjCProtoReferences(); err == nil {
-						fmt.Printf("\n@protocol refs\n")
-						for off, prot := range protRefs {
-							fmt.Printf("0x%011x => 0x%011x: %s\n", off, prot.Ptr, prot.Name)
-						}
+					log.Infof("Wrote %d headers to %s", len(paths), headersDir)
+				} else {
+					if info, err := m.GetObjCImageInfo(); err == nil {
+						fmt.Println(info.Flags)
 					} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
 						log.Error(err.Error())
 					}
-					if clsRefs, err := m.GetObjCClassReferences(); err == nil {
-						fmt.Printf("\n@class refs\n")
-						for off, cls := range clsRefs {
-							fmt.Printf("0x%011x => 0x%011x: %s\n", off, cls.ClassPtr, cls.Name)
-							// if Verbose {
-							// 	fmt.Println(cls.Verbose())
-							// } else {
-							// 	fmt.Println(cls.String())
-							// }
+					if Verbose {
+						fmt.Println(m.GetObjCToc())
+					}
+					if protos, err := m.GetObjCProtocols(); err == nil {
+						for _, proto := range protos {
+							if Verbose {
+								fmt.Println(proto.Verbose())
+							} else {
+								fmt.Println(proto.String())
+							}
 						}
 					} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
 						log.Error(err.Error())
 					}
-					if supRefs, err := m.GetObjCSuperReferences(); err == nil {
-						fmt.Printf("\n@super refs\n")
-						for off, sup := range supRefs {
-							fmt.Printf("0x%011x => 0x%011x: %s\n", off, sup.ClassPtr, sup.Name)
+					if classes, err := m.GetObjCClasses(); err == nil {
+						for _, class := range classes {
+							if Verbose {
+								fmt.Println(class.Verbose())
+							} else {
+								fmt.Println(class.String())
+							}
 						}
 					} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
 						log.Error(err.Error())
 					}
-					if selRefs, err := m.GetObjCSelectorReferences(); err == nil {
-						fmt.Printf("\n@selectors refs\n")
-						for off, sel := range selRefs {
-							fmt.Printf("0x%011x => 0x%011x: %s\n", off, sel.VMAddr, sel.Name)
+					if cats, err := m.GetObjCCategories(); err == nil {
+						for _, cat := range cats {
+							if Verbose {
+								fmt.Println(cat.Verbose())
+							} else {
+								fmt.Println(cat.String())
+							}
 						}
 					} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
 						log.Error(err.Error())
 					}
-					if methods, err := m.GetObjCMethodNames(); err == nil {
-						fmt.Printf("\n@methods\n")
-						for method, vmaddr := range methods {
-							fmt.Printf("0x%011x: %s\n", vmaddr, method)
+					if showObjcRefs {
+						if protRefs, err := m.GetObjCProtoReferences(); err == nil {
+							fmt.Printf("\n@protocol refs\n")
+							for off, prot := range protRefs {
+								fmt.Printf("0x%011x => 0x%011x: %s\n", off, prot.Ptr, prot.Name)
+							}
+						} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
+							log.Error(err.Error())
+						}
+						if clsRefs, err := m.GetObjCClassReferences(); err == nil {
+							fmt.Printf("\n@class refs\n")
+							for off, cls := range clsRefs {
+								fmt.Printf("0x%011x => 0x%011x: %s\n", off, cls.ClassPtr, cls.Name)
+								// if Verbose {
+								// 	fmt.Println(cls.Verbose())
+								// } else {
+								// 	fmt.Println(cls.String())
+								// }
+							}
+						} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
+							log.Error(err.Error())
+						}
+						if supRefs, err := m.GetObjCSuperReferences(); err == nil {
+							fmt.Printf("\n@super refs\n")
+							for off, sup := range supRefs {
+								fmt.Printf("0x%011x => 0x%011x: %s\n", off, sup.ClassPtr, sup.Name)
+							}
+						} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
+							log.Error(err.Error())
+						}
+						if selRefs, err := m.GetObjCSelectorReferences(); err == nil {
+							fmt.Printf("\n@selectors refs\n")
+							for off, sel := range selRefs {
+								fmt.Printf("0x%011x => 0x%011x: %s\n", off, sel.VMAddr, sel.Name)
+							}
+						} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
+							log.Error(err.Error())
+						}
+						if methods, err := m.GetObjCMethodNames(); err == nil {
+							fmt.Printf("\n@methods\n")
+							for method, vmaddr := range methods {
+								fmt.Printf("0x%011x: %s\n", vmaddr, method)
+							}
+						} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
+							log.Error(err.Error())
 						}
-					} else if !errors.Is(err, macho.ErrObjcSectionNotFound) {
-						log.Error(err.Error())
 					}
 				}
-
 			} else {
 				fmt.Println("  - no objc")
 			}
 			fmt.Println()
 		}
 
+		if showSwift {
+			fmt.Println("Swift")
+			fmt.Println("=====")
+			if md, err := swift.ParseMachO(m); err == nil {
+				fmt.Println(md)
+			} else if errors.Is(err, swift.ErrNoSwift) {
+				fmt.Println("  - no swift")
+			} else {
+				log.Error(err.Error())
+			}
+			fmt.Println()
+		}
+
 		if showFuncStarts {
 			if !onlyFuncStarts {
 				fmt.Println("FUNCTION STARTS")
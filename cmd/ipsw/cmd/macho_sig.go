@@ -0,0 +1,153 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/apex/log"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/pkg/signature"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	machoCmd.AddCommand(machoSigCmd)
+
+	machoSigCmd.Flags().StringP("arch", "a", "", "Which architecture to use for fat/universal MachO")
+	machoSigCmd.Flags().StringP("bytes", "b", "", "Byte pattern to scan for (e.g. \"fd 7b bf a9 ?? ?? ?? 94\")")
+	machoSigCmd.Flags().StringP("instrs", "n", "", "Instruction pattern to scan for (e.g. \"adrp x?, *; ldr x?, [x?, #0x18]; blr x?\")")
+	machoSigCmd.Flags().BoolP("json", "j", false, "Output as JSON")
+	viper.BindPFlag("macho.sig.arch", machoSigCmd.Flags().Lookup("arch"))
+	viper.BindPFlag("macho.sig.bytes", machoSigCmd.Flags().Lookup("bytes"))
+	viper.BindPFlag("macho.sig.instrs", machoSigCmd.Flags().Lookup("instrs"))
+	viper.BindPFlag("macho.sig.json", machoSigCmd.Flags().Lookup("json"))
+	machoSigCmd.MarkZshCompPositionalArgumentFile(1)
+	machoSigCmd.MarkZshCompPositionalArgumentFile(2, "*.yaml", "*.yml")
+}
+
+// machoSigCmd represents the macho sig command
+var machoSigCmd = &cobra.Command{
+	Use:           "sig <macho> [rules.yaml]",
+	Short:         "Scan the code of a MachO for byte and instruction signatures",
+	Args:          cobra.RangeArgs(1, 2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		var m *macho.File
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		// flags
+		selectedArch := viper.GetString("macho.sig.arch")
+		bytesPattern := viper.GetString("macho.sig.bytes")
+		instrsPattern := viper.GetString("macho.sig.instrs")
+		asJSON := viper.GetBool("macho.sig.json")
+
+		sigs, err := loadSignatures(args[1:], bytesPattern, instrsPattern)
+		if err != nil {
+			return err
+		}
+
+		machoPath := filepath.Clean(args[0])
+
+		// first check for fat file
+		fat, err := macho.OpenFat(machoPath)
+		if err != nil && err != macho.ErrNotFat {
+			return err
+		}
+		if err == macho.ErrNotFat {
+			m, err = macho.Open(machoPath)
+			if err != nil {
+				return err
+			}
+		} else {
+			var options []string
+			var shortOptions []string
+			for _, arch := range fat.Arches {
+				options = append(options, fmt.Sprintf("%s, %s", arch.CPU, arch.SubCPU.String(arch.CPU)))
+				shortOptions = append(shortOptions, strings.ToLower(arch.SubCPU.String(arch.CPU)))
+			}
+
+			if len(selectedArch) > 0 {
+				found := false
+				for i, opt := range shortOptions {
+					if strings.Contains(strings.ToLower(opt), strings.ToLower(selectedArch)) {
+						m = fat.Arches[i].File
+						found = true
+						break
+					}
+				}
+				if !found {
+					return fmt.Errorf("--arch '%s' not found in: %s", selectedArch, strings.Join(shortOptions, ", "))
+				}
+			} else {
+				choice := 0
+				prompt := &survey.Select{
+					Message: "Detected a universal MachO file, please select an architecture to analyze:",
+					Options: options,
+				}
+				survey.AskOne(prompt, &choice)
+				m = fat.Arches[choice].File
+			}
+		}
+
+		for _, sig := range sigs {
+			if len(sig.Instrs) > 0 && !strings.Contains(strings.ToLower(m.CPU.String()), "arm64") {
+				return fmt.Errorf("can only scan arm64 MachOs for instruction patterns")
+			}
+		}
+
+		matches, err := signature.ScanMachO(m, sigs)
+		if err != nil {
+			return err
+		}
+
+		if asJSON {
+			j, err := json.Marshal(matches)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(j))
+			return nil
+		}
+
+		if len(matches) == 0 {
+			log.Warn("no signatures matched")
+			return nil
+		}
+
+		for _, match := range matches {
+			fmt.Println(match)
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,72 @@
+/*
+Copyright © 2021 blacktop
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/ota"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	otaCmd.AddCommand(otaPatchCmd)
+
+	otaPatchCmd.Flags().StringP("base", "b", "", "Folder containing the files of the base (source) OS version")
+	otaPatchCmd.Flags().StringP("output", "o", "", "Folder to write the patched files to")
+	viper.BindPFlag("ota.patch.base", otaPatchCmd.Flags().Lookup("base"))
+	viper.BindPFlag("ota.patch.output", otaPatchCmd.Flags().Lookup("output"))
+	otaPatchCmd.MarkFlagRequired("base")
+	otaPatchCmd.MarkFlagDirname("base")
+	otaPatchCmd.MarkZshCompPositionalArgumentFile(1, "*.zip")
+}
+
+// otaPatchCmd represents the ota patch command
+var otaPatchCmd = &cobra.Command{
+	Use:   "patch <OTA.zip>",
+	Short: "Rebuild the files of a delta OTA by applying its BXDIFF50 patches",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		if Verbose {
+			log.SetLevel(log.DebugLevel)
+		}
+
+		otaPath := filepath.Clean(args[0])
+
+		if _, err := os.Stat(otaPath); os.IsNotExist(err) {
+			return fmt.Errorf("file %s does not exist", otaPath)
+		}
+
+		baseDir := viper.GetString("ota.patch.base")
+		if fi, err := os.Stat(baseDir); err != nil || !fi.IsDir() {
+			return fmt.Errorf("base folder %s does not exist", baseDir)
+		}
+
+		log.Info("Patching files...")
+		return ota.Patch(otaPath, baseDir, viper.GetString("ota.patch.output"))
+	},
+}
@@ -41,6 +41,7 @@ func init() {
 
 	symbolicateCmd.Flags().BoolP("unslide", "u", false, "Unslide the crashlog for easier static analysis")
 	symbolicateCmd.Flags().BoolVarP(&demangleFlag, "demangle", "d", false, "Demangle symbol names")
+	symbolicateCmd.Flags().StringP("cache", "c", "", "Path to symbol index file (defaults to the cache's UUID in the user cache dir)")
 	symbolicateCmd.MarkZshCompPositionalArgumentFile(2, "dyld_shared_cache*")
 }
 
@@ -58,6 +59,7 @@ var symbolicateCmd = &cobra.Command{
 		}
 
 		unslide, _ := cmd.Flags().GetBool("unslide")
+		cacheFile, _ := cmd.Flags().GetString("cache")
 
 		crashLog, err := crashlog.Open(args[0])
 		if err != nil {
@@ -93,59 +95,9 @@ var symbolicateCmd = &cobra.Command{
 			defer f.Close()
 
 			// Load all symbols
-			// if _, err := os.Stat(dscPath + ".a2s"); os.IsNotExist(err) {
-			// 	log.Info("Generating dyld_shared_cache companion symbol map file...")
-
-			// 	// utils.Indent(log.Warn, 2)("parsing public symbols...")
-			// 	// err = f.GetAllExportedSymbols(false)
-			// 	// if err != nil {
-			// 	// 	return err
-			// 	// }
-			// 	utils.Indent(log.Warn, 2)("parsing private symbols...")
-			// 	err = f.ParseLocalSyms()
-			// 	if err != nil {
-			// 		utils.Indent(log.Warn, 2)(err.Error())
-			// 		utils.Indent(log.Warn, 2)("parsing patch exports...")
-			// 		for _, img := range f.Images {
-			// 			for _, patch := range img.PatchableExports {
-			// 				addr, err := f.GetVMAddress(uint64(patch.OffsetOfImpl))
-			// 				if err != nil {
-			// 					return err
-			// 				}
-			// 				f.AddressToSymbol[addr] = patch.Name
-			// 			}
-			// 		}
-			// 	}
-			// 	// cache all sels
-			// f.GetAllSelectors(false)
-			// f.GetAllClasses(false)
-			// f.GetAllProtocols(false)
-			// 	// save lookup map to disk to speed up subsequent requests
-			// 	err = f.SaveAddrToSymMap(dscPath + ".a2s")
-			// 	if err != nil {
-			// 		return err
-			// 	}
-
-			// } else {
-			// 	log.Info("Found dyld_shared_cache companion symbol map file...")
-			// 	a2sFile, err := os.Open(dscPath + ".a2s")
-			// 	if err != nil {
-			// 		return fmt.Errorf("failed to open companion file %s; %v", dscPath+".a2s", err)
-			// 	}
-
-			// 	gzr, err := gzip.NewReader(a2sFile)
-			// 	if err != nil {
-			// 		return fmt.Errorf("failed to create gzip reader: %v", err)
-			// 	}
-
-			// 	// Decoding the serialized data
-			// 	err = gob.NewDecoder(gzr).Decode(&f.AddressToSymbol)
-			// 	if err != nil {
-			// 		return fmt.Errorf("failed to decode addr2sym map; %v", err)
-			// 	}
-			// 	gzr.Close()
-			// 	a2sFile.Close()
-			// }
+			if _, err := f.OpenOrCreateSymbolIndex(cacheFile); err != nil {
+				return err
+			}
 
 			// Symbolicate the crashing thread's backtrace
 			for idx, bt := range crashLog.Threads[crashLog.CrashedThread].BackTrace {
@@ -166,7 +118,7 @@ var symbolicateCmd = &cobra.Command{
 				defer m.Close()
 
 				// check if symbol is cached
-				if symName, ok := f.AddressToSymbol[unslidAddr]; ok {
+				if symName, ok := f.LookupSymbol(unslidAddr); ok {
 					if demangleFlag {
 						symName = demangle.Do(symName, false, false)
 					}
@@ -175,7 +127,7 @@ var symbolicateCmd = &cobra.Command{
 				}
 
 				if fn, err := m.GetFunctionForVMAddr(unslidAddr); err == nil {
-					if symName, ok := f.AddressToSymbol[fn.StartAddr]; ok {
+					if symName, ok := f.LookupSymbol(fn.StartAddr); ok {
 						if demangleFlag {
 							symName = demangle.Do(symName, false, false)
 						}
@@ -191,11 +143,7 @@ var symbolicateCmd = &cobra.Command{
 				}
 
 				for _, patch := range image.PatchableExports {
-					addr, err := image.GetVMAddress(uint64(patch.OffsetOfImpl))
-					if err != nil {
-						return err
-					}
-					f.AddressToSymbol[addr] = patch.Name
+					f.AddressToSymbol[patch.Address] = patch.Name
 				}
 
 				// Load all symbol
@@ -215,7 +163,7 @@ var symbolicateCmd = &cobra.Command{
 				// 	return fmt.Errorf("failed to analyze image %s; %v", image.Name, err)
 				// }
 
-				if symName, ok := f.AddressToSymbol[unslidAddr]; ok {
+				if symName, ok := f.LookupSymbol(unslidAddr); ok {
 					if demangleFlag {
 						symName = demangle.Do(symName, false, false)
 					}
@@ -224,7 +172,7 @@ var symbolicateCmd = &cobra.Command{
 				}
 
 				if fn, err := m.GetFunctionForVMAddr(unslidAddr); err == nil {
-					if symName, ok := f.AddressToSymbol[fn.StartAddr]; ok {
+					if symName, ok := f.LookupSymbol(fn.StartAddr); ok {
 						if demangleFlag {
 							symName = demangle.Do(symName, false, false)
 						}
@@ -5,6 +5,8 @@
 // Package demangle defines functions that demangle GCC/LLVM C++ symbol names.
 // This package recognizes names that were mangled according to the C++ ABI
 // defined at http://codesourcery.com/cxx-abi/.
+// It also demangles Swift symbol names (both the current "$s" mangling and
+// the legacy "_T" one), see SwiftToString.
 //
 // Most programs will want to call Filter or ToString.
 package demangle
@@ -44,6 +46,7 @@ const (
 )
 
 // Do demangle a string just as the GNU c++filt program does.
+// Swift symbols are demangled just as swift-demangle does.
 func Do(name string, verbose, llvmStyle bool) string {
 	var deStr string
 	var options []Option
@@ -60,6 +63,13 @@ func Do(name string, verbose, llvmStyle bool) string {
 		return name
 	}
 
+	if IsSwiftSymbol(name) {
+		if s, err := SwiftToString(name); err == nil {
+			return s
+		}
+		return name
+	}
+
 	skip := 0
 	if name[0] == '.' || name[0] == '$' {
 		skip++
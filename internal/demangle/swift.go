@@ -0,0 +1,594 @@
+package demangle
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotSwiftMangledName is returned by SwiftToString if the string does
+// not appear to be a Swift symbol name.
+var ErrNotSwiftMangledName = errors.New("not a Swift mangled name")
+
+// IsSwiftSymbol returns true if name looks like a mangled Swift symbol
+// (with or without the MachO leading underscore).
+func IsSwiftSymbol(name string) bool {
+	_, _, ok := swiftPrefix(name)
+	return ok
+}
+
+// swiftPrefix strips the Swift mangling prefix off of name and returns
+// the remainder and whether it is the legacy (pre Swift 4) mangling.
+func swiftPrefix(name string) (string, bool, bool) {
+	for _, p := range []string{"_$s", "$s", "_$S", "$S", "_$e", "$e", "__T0", "_T0"} {
+		if strings.HasPrefix(name, p) && len(name) > len(p) {
+			return name[len(p):], false, true
+		}
+	}
+	for _, p := range []string{"__T", "_T"} {
+		if strings.HasPrefix(name, p) && len(name) > len(p)+1 && !strings.HasPrefix(name, p+"0") {
+			switch name[len(p)] {
+			case 'F', 'v', 'I', 'i', 'M', 'W', 'T', 'Z', 'P', 't':
+				return name[len(p):], true, true
+			}
+		}
+	}
+	return "", false, false
+}
+
+// SwiftToString demangles a Swift symbol name, returning a human-readable
+// name or an error. If the name does not appear to be a Swift symbol name
+// at all, the error will be ErrNotSwiftMangledName.
+func SwiftToString(name string) (ret string, err error) {
+	mangled, legacy, ok := swiftPrefix(name)
+	if !ok {
+		return "", ErrNotSwiftMangledName
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if se, ok := r.(swiftErr); ok {
+				ret = ""
+				err = se
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	var n *swiftNode
+	if legacy {
+		st := &swiftLegacyState{swiftState{str: mangled}}
+		n = st.global()
+	} else {
+		st := &swiftState{str: mangled}
+		n = st.global()
+	}
+
+	return swiftNodeToString(n), nil
+}
+
+// A swiftErr is an error at a specific offset in the mangled Swift name.
+type swiftErr struct {
+	err string
+	off int
+}
+
+// Error implements the builtin error interface for swiftErr.
+func (se swiftErr) Error() string {
+	return fmt.Sprintf("%s at %d", se.err, se.off)
+}
+
+// swiftKind is the kind of a node in a demangled Swift symbol tree.
+type swiftKind int
+
+const (
+	skGlobal swiftKind = iota
+	skSuffix
+	skType
+	skTypeMangling
+	skIdentifier
+	skModule
+	skClass
+	skStructure
+	skEnum
+	skProtocol
+	skTypeAlias
+	skOtherNominalType
+	skExtension
+	skBoundGeneric
+	skTypeList
+	skFirstElementMarker
+	skEmptyList
+	skVariadicMarker
+	skTuple
+	skTupleElement
+	skTupleElementName
+	skFunctionType
+	skArgumentTuple
+	skReturnType
+	skLabelList
+	skThrowsAnnotation
+	skAsyncAnnotation
+	skSendableAnnotation
+	skGlobalActor
+	skTypeAttribute // inout, __shared, __owned, weak, unowned, ...
+	skMetatype
+	skExistentialMetatype
+	skProtocolList
+	skProtocolListWithClass
+	skProtocolListWithAnyObject
+	skBuiltinType
+	skGenericParam
+	skDependentMemberType
+	skAssociatedTypeRef
+	skDependentGenericType
+	skGenericSignature
+	skGenericParamCount
+	skConformanceRequirement
+	skSameTypeRequirement
+	skLayoutRequirement
+	skOpaqueReturnTypeOf
+	skOpaqueType
+	skDynamicSelf
+	skFunction
+	skVariable
+	skSubscript
+	skConstructor
+	skAllocator
+	skDestructor
+	skDeallocator
+	skIVarInitializer
+	skIVarDestroyer
+	skInitializer
+	skDefaultArgumentInitializer
+	skExplicitClosure
+	skImplicitClosure
+	skAccessor
+	skStatic
+	skLocalDeclName
+	skPrivateDeclName
+	skRelatedEntityDeclName
+	skOperator
+	skIndex
+	skProtocolConformance
+	skSymbolicReference
+	skDescriptor   // "<text> <child>"
+	skDescriptor2  // two children joined by text
+	skFunctionAttr // "<text><child>" prefixes of the Global's entity
+	skSpecialization
+	skSpecializationParam
+)
+
+// A swiftNode is a node in a demangled Swift symbol tree.
+type swiftNode struct {
+	kind     swiftKind
+	text     string
+	index    uint64
+	children []*swiftNode
+}
+
+func (n *swiftNode) add(c ...*swiftNode) *swiftNode {
+	for _, child := range c {
+		if child != nil {
+			n.children = append(n.children, child)
+		}
+	}
+	return n
+}
+
+func (n *swiftNode) child(i int) *swiftNode {
+	if n == nil || i >= len(n.children) {
+		return nil
+	}
+	return n.children[i]
+}
+
+func (n *swiftNode) reverse(from int) {
+	c := n.children[from:]
+	for i, j := 0, len(c)-1; i < j; i, j = i+1, j-1 {
+		c[i], c[j] = c[j], c[i]
+	}
+}
+
+func swiftNew(k swiftKind, children ...*swiftNode) *swiftNode {
+	return (&swiftNode{kind: k}).add(children...)
+}
+
+func swiftText(k swiftKind, text string, children ...*swiftNode) *swiftNode {
+	return (&swiftNode{kind: k, text: text}).add(children...)
+}
+
+func swiftType(child *swiftNode) *swiftNode {
+	return swiftNew(skType, child)
+}
+
+// isContext returns true if the node kind can be the parent context of an entity.
+func (k swiftKind) isContext() bool {
+	switch k {
+	case skModule, skClass, skStructure, skEnum, skProtocol, skTypeAlias, skOtherNominalType,
+		skExtension, skFunction, skVariable, skSubscript, skConstructor, skAllocator,
+		skDestructor, skDeallocator, skIVarInitializer, skIVarDestroyer, skInitializer,
+		skDefaultArgumentInitializer, skExplicitClosure, skImplicitClosure, skAccessor,
+		skStatic, skOpaqueReturnTypeOf:
+		return true
+	}
+	return false
+}
+
+// isLocalContext returns true if entities in this context are printed as "<entity> in <context>".
+func (k swiftKind) isLocalContext() bool {
+	switch k {
+	case skFunction, skVariable, skSubscript, skConstructor, skAllocator, skDestructor,
+		skDeallocator, skIVarInitializer, skIVarDestroyer, skInitializer,
+		skDefaultArgumentInitializer, skExplicitClosure, skImplicitClosure, skAccessor, skStatic:
+		return true
+	}
+	return false
+}
+
+func (k swiftKind) isDeclName() bool {
+	switch k {
+	case skIdentifier, skLocalDeclName, skPrivateDeclName, skRelatedEntityDeclName, skOperator, skSymbolicReference:
+		return true
+	}
+	return false
+}
+
+func (k swiftKind) isEntity() bool {
+	return k == skType || k.isContext()
+}
+
+func (k swiftKind) isNominal() bool {
+	switch k {
+	case skClass, skStructure, skEnum, skProtocol, skTypeAlias, skOtherNominalType:
+		return true
+	}
+	return false
+}
+
+func (k swiftKind) isRequirement() bool {
+	switch k {
+	case skConformanceRequirement, skSameTypeRequirement, skLayoutRequirement:
+		return true
+	}
+	return false
+}
+
+func isSwiftWordStart(c byte) bool {
+	return !isDigit(c) && c != '_' && c != 0
+}
+
+func isSwiftWordEnd(c, prev byte) bool {
+	return c == '_' || c == 0 || (!isUpper(prev) && isUpper(c))
+}
+
+const swiftMaxWords = 26
+
+// swiftState holds the current state of demangling a Swift 4+ symbol.
+// The mangling is postfix: operands are pushed on a node stack and
+// operators pop them to build the symbol tree.
+type swiftState struct {
+	str   string
+	pos   int
+	stack []*swiftNode
+	subs  []*swiftNode
+	words []string
+}
+
+// fail panics with swiftErr, to be caught in SwiftToString.
+func (st *swiftState) fail(err string) {
+	panic(swiftErr{err: err, off: st.pos})
+}
+
+func (st *swiftState) peek() byte {
+	if st.pos >= len(st.str) {
+		return 0
+	}
+	return st.str[st.pos]
+}
+
+func (st *swiftState) next() byte {
+	if st.pos >= len(st.str) {
+		st.fail("unexpected end of mangled name")
+	}
+	c := st.str[st.pos]
+	st.pos++
+	return c
+}
+
+func (st *swiftState) nextIf(c byte) bool {
+	if st.peek() == c && st.pos < len(st.str) {
+		st.pos++
+		return true
+	}
+	return false
+}
+
+func (st *swiftState) push(n *swiftNode) {
+	st.stack = append(st.stack, n)
+}
+
+// pop pops the top node off of the stack if it matches pred (or any node if pred is nil).
+func (st *swiftState) pop(pred func(swiftKind) bool) *swiftNode {
+	if len(st.stack) == 0 {
+		return nil
+	}
+	n := st.stack[len(st.stack)-1]
+	if pred != nil && !pred(n.kind) {
+		return nil
+	}
+	st.stack = st.stack[:len(st.stack)-1]
+	return n
+}
+
+func (st *swiftState) popKind(k swiftKind) *swiftNode {
+	return st.pop(func(kind swiftKind) bool { return kind == k })
+}
+
+func (st *swiftState) mustPop(k swiftKind) *swiftNode {
+	n := st.popKind(k)
+	if n == nil {
+		st.fail("missing operand")
+	}
+	return n
+}
+
+func (st *swiftState) addSubst(n *swiftNode) {
+	st.subs = append(st.subs, n)
+}
+
+func (st *swiftState) subst(idx int) *swiftNode {
+	if idx < 0 || idx >= len(st.subs) {
+		st.fail("invalid substitution index")
+	}
+	return st.subs[idx]
+}
+
+// natural parses a decimal number, returning -1 if there is none.
+func (st *swiftState) natural() int {
+	if !isDigit(st.peek()) {
+		return -1
+	}
+	n := 0
+	for isDigit(st.peek()) {
+		n = n*10 + int(st.next()-'0')
+		if n > 1<<24 {
+			st.fail("number too large")
+		}
+	}
+	return n
+}
+
+// index parses "_" (0) or NUMBER "_" (NUMBER+1).
+func (st *swiftState) index() int {
+	if st.nextIf('_') {
+		return 0
+	}
+	if n := st.natural(); n >= 0 && st.nextIf('_') {
+		return n + 1
+	}
+	st.fail("invalid index")
+	return 0
+}
+
+func (st *swiftState) indexNode() *swiftNode {
+	return &swiftNode{kind: skIndex, index: uint64(st.index())}
+}
+
+// global parses a whole symbol.
+func (st *swiftState) global() *swiftNode {
+	for st.pos < len(st.str) {
+		st.push(st.operator())
+	}
+
+	top := swiftNew(skGlobal)
+	parent := top
+	for {
+		attr := st.popKind(skFunctionAttr)
+		if attr == nil {
+			if attr = st.popKind(skSpecialization); attr == nil {
+				break
+			}
+		}
+		parent.add(attr)
+		if attr.text == "partial apply forwarder" || attr.text == "partial apply ObjC forwarder" {
+			parent = attr
+		}
+	}
+	for i, n := range st.stack {
+		// anything besides the symbol (and its suffix) is input that no operator consumed
+		if i > 0 && n.kind != skSuffix {
+			st.fail("unconsumed input")
+		}
+		if n.kind == skType {
+			parent.add(n.child(0))
+		} else {
+			parent.add(n)
+		}
+	}
+	if len(top.children) == 0 {
+		st.fail("empty symbol")
+	}
+
+	return top
+}
+
+// identifier parses an identifier with word substitutions or punycode.
+func (st *swiftState) identifier() *swiftNode {
+	hasWordSubsts := false
+	isPunycoded := false
+	if !isDigit(st.peek()) {
+		st.fail("expected identifier")
+	}
+	if st.nextIf('0') {
+		if st.nextIf('0') {
+			isPunycoded = true
+		} else {
+			hasWordSubsts = true
+		}
+	}
+
+	var id strings.Builder
+	for {
+		for hasWordSubsts && isSwiftLetter(st.peek()) {
+			c := st.next()
+			var idx int
+			if isLower(c) {
+				idx = int(c - 'a')
+			} else {
+				idx = int(c - 'A')
+				hasWordSubsts = false
+			}
+			if idx >= len(st.words) {
+				st.fail("invalid word substitution")
+			}
+			id.WriteString(st.words[idx])
+		}
+		if st.nextIf('0') {
+			break
+		}
+		n := st.natural()
+		if n <= 0 {
+			st.fail("invalid identifier length")
+		}
+		if isPunycoded {
+			st.nextIf('_')
+		}
+		if st.pos+n > len(st.str) {
+			st.fail("identifier too long")
+		}
+		slice := st.str[st.pos : st.pos+n]
+		st.pos += n
+		if isPunycoded {
+			dec, ok := swiftPunycodeDecode(slice)
+			if !ok {
+				st.fail("invalid punycode")
+			}
+			id.WriteString(dec)
+		} else {
+			id.WriteString(slice)
+			wordStart := -1
+			for i := 0; i <= len(slice); i++ {
+				var c byte
+				if i < len(slice) {
+					c = slice[i]
+				}
+				if wordStart >= 0 && isSwiftWordEnd(c, slice[i-1]) {
+					if i-wordStart >= 2 && len(st.words) < swiftMaxWords {
+						st.words = append(st.words, slice[wordStart:i])
+					}
+					wordStart = -1
+				}
+				if wordStart < 0 && isSwiftWordStart(c) {
+					wordStart = i
+				}
+			}
+		}
+		if !hasWordSubsts {
+			break
+		}
+	}
+
+	if id.Len() == 0 {
+		st.fail("empty identifier")
+	}
+	n := swiftText(skIdentifier, id.String())
+	st.addSubst(n)
+	return n
+}
+
+func isSwiftLetter(c byte) bool {
+	return isLower(c) || isUpper(c)
+}
+
+// swiftPunycodeDecode decodes Swift's punycode variant which uses
+// a-z and A-J as digits and '_' as the delimiter.
+func swiftPunycodeDecode(in string) (string, bool) {
+	const (
+		base        = 36
+		tmin        = 1
+		tmax        = 26
+		skew        = 38
+		damp        = 700
+		initialBias = 72
+		initialN    = 128
+	)
+	digit := func(c byte) int {
+		switch {
+		case c >= 'a' && c <= 'z':
+			return int(c - 'a')
+		case c >= 'A' && c <= 'J':
+			return int(c-'A') + 26
+		}
+		return -1
+	}
+	adapt := func(delta, numPoints int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / numPoints
+		k := 0
+		for delta > ((base-tmin)*tmax)/2 {
+			delta /= base - tmin
+			k += base
+		}
+		return k + (base-tmin+1)*delta/(delta+skew)
+	}
+
+	var out []rune
+	if d := strings.LastIndexByte(in, '_'); d >= 0 {
+		for i := 0; i < d; i++ {
+			if in[i] >= 0x80 {
+				return "", false
+			}
+			out = append(out, rune(in[i]))
+		}
+		in = in[d+1:]
+	}
+
+	n, bias, i := initialN, initialBias, 0
+	for pos := 0; pos < len(in); {
+		oldi, w := i, 1
+		for k := base; ; k += base {
+			if pos >= len(in) {
+				return "", false
+			}
+			d := digit(in[pos])
+			pos++
+			if d < 0 {
+				return "", false
+			}
+			i += d * w
+			t := k - bias
+			if k <= bias {
+				t = tmin
+			} else if k >= bias+tmax {
+				t = tmax
+			}
+			if d < t {
+				break
+			}
+			w *= base - t
+		}
+		bias = adapt(i-oldi, len(out)+1, oldi == 0)
+		n += i / (len(out) + 1)
+		i %= len(out) + 1
+		if n < 0x80 {
+			return "", false
+		}
+		out = append(out[:i], append([]rune{rune(n)}, out[i:]...)...)
+		i++
+	}
+
+	// symbols that are not valid identifier characters are mapped to 0xD800+
+	for idx, r := range out {
+		if r >= 0xD800 && r < 0xD880 {
+			out[idx] = r - 0xD800
+		}
+	}
+
+	return string(out), true
+}
@@ -0,0 +1,646 @@
+package demangle
+
+import (
+	"fmt"
+	"strings"
+)
+
+// swiftLegacyState holds the current state of demangling a pre Swift 4
+// ("_T") symbol. Unlike the current mangling it is prefix: every production
+// is parsed top-down, but it builds the same trees so both share a printer.
+type swiftLegacyState struct {
+	swiftState
+}
+
+func (st *swiftLegacyState) nextPrefix(p string) bool {
+	if strings.HasPrefix(st.str[st.pos:], p) {
+		st.pos += len(p)
+		return true
+	}
+	return false
+}
+
+// global parses a whole symbol.
+func (st *swiftLegacyState) global() *swiftNode {
+	top := swiftNew(skGlobal)
+	parent := top
+	for {
+		switch {
+		case st.nextPrefix("PA"):
+			text := "partial apply forwarder"
+			if st.nextIf('o') {
+				text = "partial apply ObjC forwarder"
+			}
+			attr := swiftText(skFunctionAttr, text)
+			parent.add(attr)
+			parent = attr
+			if !st.nextPrefix("__T") {
+				st.fail("expected partial apply target")
+			}
+		case st.nextPrefix("To"):
+			parent.add(swiftText(skFunctionAttr, "@objc "))
+		case st.nextPrefix("TO"):
+			parent.add(swiftText(skFunctionAttr, "@nonobjc "))
+		case st.nextPrefix("TD"):
+			parent.add(swiftText(skFunctionAttr, "dynamic "))
+		case st.nextPrefix("Td"):
+			parent.add(swiftText(skFunctionAttr, "super "))
+		case st.nextPrefix("TS"):
+			parent.add(st.specialization())
+		default:
+			parent.add(st.globalBody())
+			if st.pos < len(st.str) {
+				top.add(swiftText(skSuffix, st.str[st.pos:]))
+				st.pos = len(st.str)
+			}
+			return top
+		}
+	}
+}
+
+func (st *swiftLegacyState) globalBody() *swiftNode {
+	switch {
+	case st.nextIf('t'):
+		return swiftNew(skTypeMangling, st.typ())
+	case st.nextIf('M'):
+		return st.metadata()
+	case st.nextIf('W'):
+		return st.witness()
+	case st.nextPrefix("TW"):
+		conf := st.protocolConformance()
+		entity := st.entity()
+		return swiftText(skDescriptor2, "protocol witness for %s in conformance %s", entity, conf)
+	case st.nextPrefix("TR"), st.nextPrefix("Tr"):
+		prefix := "reabstraction thunk "
+		if st.str[st.pos-1] == 'R' {
+			prefix = "reabstraction thunk helper "
+		}
+		if st.nextIf('G') {
+			prefix += swiftNodeToString(st.genericSignature()) + " "
+		}
+		from := st.typ()
+		to := st.typ()
+		return swiftText(skDescriptor2, prefix+"from %s to %s", from, to)
+	case st.nextPrefix("Tw"):
+		if st.pos+2 > len(st.str) {
+			st.fail("invalid value witness")
+		}
+		name, ok := swiftLegacyValueWitnesses[st.str[st.pos:st.pos+2]]
+		if !ok {
+			st.fail("unknown value witness")
+		}
+		st.pos += 2
+		return swiftText(skDescriptor, name+" value witness for", st.typ())
+	}
+	return st.entity()
+}
+
+var swiftLegacyValueWitnesses = map[string]string{
+	"al": "allocateBuffer",
+	"ca": "assignWithCopy",
+	"ta": "assignWithTake",
+	"de": "deallocateBuffer",
+	"xx": "destroy",
+	"XX": "destroyBuffer",
+	"Xx": "destroyArray",
+	"CP": "initializeBufferWithCopyOfBuffer",
+	"Cp": "initializeBufferWithCopy",
+	"cp": "initializeWithCopy",
+	"TK": "initializeBufferWithTakeOfBuffer",
+	"Tk": "initializeBufferWithTake",
+	"tk": "initializeWithTake",
+	"pr": "projectBuffer",
+	"xs": "storeExtraInhabitant",
+	"xg": "getExtraInhabitantIndex",
+	"Cc": "initializeArrayWithCopy",
+	"Tt": "initializeArrayWithTakeFrontToBack",
+	"tT": "initializeArrayWithTakeBackToFront",
+	"ug": "getEnumTag",
+	"up": "destructiveProjectEnumData",
+	"ui": "destructiveInjectEnumTag",
+}
+
+func (st *swiftLegacyState) specialization() *swiftNode {
+	var text string
+	switch c := st.next(); c {
+	case 'g':
+		text = "generic specialization"
+	case 'r':
+		text = "generic not re-abstracted specialization"
+	default:
+		st.fail(fmt.Sprintf("unsupported specialization %q", c))
+	}
+	if !isDigit(st.next()) {
+		st.fail("invalid specialization pass ID")
+	}
+	spec := swiftText(skSpecialization, text)
+	for !st.nextIf('_') {
+		spec.add(swiftNew(skSpecializationParam, st.typ()))
+		for !st.nextIf('_') {
+			st.protocolConformance()
+		}
+	}
+	if !st.nextPrefix("_T") {
+		st.fail("expected specialized function")
+	}
+	return spec
+}
+
+func (st *swiftLegacyState) metadata() *swiftNode {
+	var text string
+	switch st.peek() {
+	case 'a':
+		text = "type metadata accessor for"
+	case 'L':
+		text = "lazy cache variable for type metadata for"
+	case 'm':
+		text = "metaclass for"
+	case 'n':
+		text = "nominal type descriptor for"
+	case 'P':
+		text = "generic type metadata pattern for"
+	case 'f':
+		text = "full type metadata for"
+	case 'o':
+		text = "class metadata base offset for"
+	case 'd':
+		text = "type metadata for"
+	case 'p':
+		st.pos++
+		return swiftText(skDescriptor, "protocol descriptor for", st.protocol())
+	default:
+		return swiftText(skDescriptor, "type metadata for", st.typ())
+	}
+	st.pos++
+	return swiftText(skDescriptor, text, st.typ())
+}
+
+func (st *swiftLegacyState) witness() *swiftNode {
+	switch c := st.next(); c {
+	case 'V':
+		return swiftText(skDescriptor, "value witness table for", st.typ())
+	case 'v':
+		text := "direct field offset for"
+		if st.next() == 'i' {
+			text = "indirect field offset for"
+		}
+		return swiftText(skDescriptor, text, st.entity())
+	case 'o':
+		return swiftText(skDescriptor, "witness table offset for", st.entity())
+	case 'P':
+		return swiftText(skDescriptor, "protocol witness table for", st.protocolConformance())
+	case 'G':
+		return swiftText(skDescriptor, "generic protocol witness table for", st.protocolConformance())
+	case 'I':
+		return swiftText(skDescriptor, "instantiation function for generic protocol witness table for", st.protocolConformance())
+	case 'a':
+		return swiftText(skDescriptor, "protocol witness table accessor for", st.protocolConformance())
+	case 'l', 'L':
+		text := "lazy protocol witness table accessor for type %s and conformance %s"
+		if c == 'L' {
+			text = "lazy protocol witness table cache variable for type %s and conformance %s"
+		}
+		typ := st.typ()
+		return swiftText(skDescriptor2, text, typ, st.protocolConformance())
+	case 't':
+		conf := st.protocolConformance()
+		return swiftText(skDescriptor2, "associated type metadata accessor for %s in %s", st.declName(), conf)
+	case 'T':
+		conf := st.protocolConformance()
+		name := st.declName()
+		return swiftText(skDescriptor2, "associated type witness table accessor for %s in %s",
+			swiftText(skDescriptor2, "%s : %s", name, st.protocol()), conf)
+	default:
+		st.fail(fmt.Sprintf("unknown witness %q", c))
+	}
+	return nil
+}
+
+// protocolConformance parses a "type protocol module" conformance.
+func (st *swiftLegacyState) protocolConformance() *swiftNode {
+	var sig *swiftNode
+	if st.nextIf('u') {
+		sig = st.genericSignature()
+	}
+	typ := st.typ()
+	if sig != nil {
+		typ = swiftType(swiftNew(skDependentGenericType, sig, typ))
+	}
+	proto := st.protocol()
+	mod := st.context()
+	return swiftNew(skProtocolConformance, typ, proto, mod)
+}
+
+// entity parses a (possibly static) declaration or a nominal type.
+func (st *swiftLegacyState) entity() *swiftNode {
+	static := st.nextIf('Z')
+	var n *swiftNode
+	switch c := st.next(); c {
+	case 'F':
+		n = st.functionEntity(st.context())
+	case 'v':
+		ctx := st.context()
+		name := st.declName()
+		n = swiftNew(skVariable, ctx, name, st.typ())
+	case 'i':
+		ctx := st.context()
+		st.declName()
+		n = swiftNew(skSubscript, ctx, st.typ())
+	case 'I':
+		ctx := st.context()
+		switch c := st.next(); c {
+		case 'i':
+			n = swiftNew(skInitializer, ctx)
+		case 'A':
+			n = swiftNew(skDefaultArgumentInitializer, ctx, st.indexNode())
+		default:
+			st.fail(fmt.Sprintf("unknown initializer %q", c))
+		}
+	case 'C', 'V', 'O':
+		if static {
+			st.fail("static nominal type")
+		}
+		st.pos--
+		return st.typ().child(0)
+	default:
+		st.fail(fmt.Sprintf("unknown entity %q", c))
+	}
+	if static {
+		return swiftNew(skStatic, n)
+	}
+	return n
+}
+
+func (st *swiftLegacyState) functionEntity(ctx *swiftNode) *swiftNode {
+	accessors := map[byte]string{'g': "getter", 's': "setter", 'm': "materializeForSet", 'w': "willset", 'W': "didset"}
+	switch c := st.peek(); c {
+	case 'D':
+		st.pos++
+		return swiftNew(skDeallocator, ctx)
+	case 'd':
+		st.pos++
+		return swiftNew(skDestructor, ctx)
+	case 'e':
+		st.pos++
+		return swiftNew(skIVarInitializer, ctx)
+	case 'E':
+		st.pos++
+		return swiftNew(skIVarDestroyer, ctx)
+	case 'i':
+		st.pos++
+		return swiftNew(skInitializer, ctx)
+	case 'C':
+		st.pos++
+		return swiftNew(skAllocator, ctx, st.typ())
+	case 'c':
+		st.pos++
+		return swiftNew(skConstructor, ctx, st.typ())
+	case 'A':
+		st.pos++
+		return swiftNew(skDefaultArgumentInitializer, ctx, st.indexNode())
+	case 'U', 'u':
+		st.pos++
+		k := skExplicitClosure
+		if c == 'u' {
+			k = skImplicitClosure
+		}
+		idx := st.indexNode()
+		return swiftNew(k, ctx, st.typ(), idx)
+	case 'g', 's', 'm', 'w', 'W':
+		st.pos++
+		name := st.declName()
+		return swiftText(skAccessor, accessors[c], swiftNew(skVariable, ctx, name, st.typ()))
+	case 'a', 'l':
+		st.pos++
+		names := map[byte]string{'O': "owningMutableAddressor", 'o': "nativeOwningMutableAddressor", 'p': "nativePinningMutableAddressor", 'u': "mutableAddressor"}
+		if c == 'l' {
+			names = map[byte]string{'O': "owningAddressor", 'o': "nativeOwningAddressor", 'p': "nativePinningAddressor", 'u': "unsafeAddressor"}
+		}
+		text, ok := names[st.next()]
+		if !ok {
+			st.fail("unknown addressor")
+		}
+		name := st.declName()
+		return swiftText(skAccessor, text, swiftNew(skVariable, ctx, name, st.typ()))
+	}
+	name := st.declName()
+	return swiftNew(skFunction, ctx, name, st.typ())
+}
+
+// context parses the parent context of a declaration.
+func (st *swiftLegacyState) context() *swiftNode {
+	switch c := st.peek(); c {
+	case 'E', 'e':
+		st.pos++
+		mod := st.context()
+		var sig *swiftNode
+		if c == 'e' {
+			sig = st.genericSignature()
+		}
+		return swiftNew(skExtension, mod, st.context(), sig)
+	case 'S':
+		st.pos++
+		n := st.substitution()
+		if n.kind == skType {
+			return n.child(0)
+		}
+		return n
+	case 's':
+		st.pos++
+		return swiftText(skModule, "Swift")
+	case 'P':
+		st.pos++
+		ctx := st.context()
+		n := swiftType(swiftNew(skProtocol, ctx, st.declName()))
+		st.addSubst(n)
+		return n.child(0)
+	case 'G', 'C', 'V', 'O':
+		return st.typ().child(0)
+	case 'F', 'I', 'v', 'i', 'Z':
+		return st.entity()
+	}
+	mod := swiftText(skModule, st.identifier().text)
+	st.addSubst(mod)
+	return mod
+}
+
+var swiftLegacyStdTypes = map[byte]struct {
+	kind swiftKind
+	name string
+}{
+	'a': {skStructure, "Array"},
+	'b': {skStructure, "Bool"},
+	'c': {skStructure, "UnicodeScalar"},
+	'd': {skStructure, "Double"},
+	'f': {skStructure, "Float"},
+	'i': {skStructure, "Int"},
+	'V': {skStructure, "UnsafeRawPointer"},
+	'v': {skStructure, "UnsafeMutableRawPointer"},
+	'P': {skStructure, "UnsafePointer"},
+	'p': {skStructure, "UnsafeMutablePointer"},
+	'q': {skEnum, "Optional"},
+	'Q': {skEnum, "ImplicitlyUnwrappedOptional"},
+	'R': {skStructure, "UnsafeBufferPointer"},
+	'r': {skStructure, "UnsafeMutableBufferPointer"},
+	'S': {skStructure, "String"},
+	'u': {skStructure, "UInt"},
+}
+
+// substitution parses the rest of an 'S' substitution.
+func (st *swiftLegacyState) substitution() *swiftNode {
+	switch c := st.peek(); c {
+	case 'o':
+		st.pos++
+		return swiftText(skModule, "__ObjC")
+	case 'C':
+		st.pos++
+		return swiftText(skModule, "__C")
+	case 's':
+		st.pos++
+		return swiftText(skModule, "Swift")
+	default:
+		if std, ok := swiftLegacyStdTypes[c]; ok {
+			st.pos++
+			// the standard types still take up a substitution index (unlike the modules)
+			n := swiftType(swiftNew(std.kind, swiftText(skModule, "Swift"), swiftText(skIdentifier, std.name)))
+			st.addSubst(n)
+			return n
+		}
+	}
+	return st.subst(st.index())
+}
+
+// protocol parses a protocol name (a context and a declaration name or a substitution).
+func (st *swiftLegacyState) protocol() *swiftNode {
+	ctx := st.context()
+	if ctx.kind == skProtocol {
+		return swiftType(ctx)
+	}
+	n := swiftType(swiftNew(skProtocol, ctx, st.declName()))
+	st.addSubst(n)
+	return n
+}
+
+func (st *swiftLegacyState) declName() *swiftNode {
+	switch {
+	case st.nextIf('L'):
+		idx := st.indexNode()
+		return swiftNew(skLocalDeclName, idx, st.identifier())
+	case st.nextIf('P'):
+		disc := st.identifier()
+		return swiftNew(skPrivateDeclName, disc, st.identifier())
+	}
+	return st.identifier()
+}
+
+// identifier parses a length prefixed identifier, punycoded ('X') or operator ('o').
+func (st *swiftLegacyState) identifier() *swiftNode {
+	punycode := st.nextIf('X')
+	var fixity string
+	if st.nextIf('o') {
+		switch c := st.next(); c {
+		case 'p':
+			fixity = " prefix"
+		case 'P':
+			fixity = " postfix"
+		case 'i':
+			fixity = " infix"
+		default:
+			st.fail(fmt.Sprintf("unknown operator fixity %q", c))
+		}
+	}
+	n := st.natural()
+	if n <= 0 {
+		st.fail("invalid identifier length")
+	}
+	if st.pos+n > len(st.str) {
+		st.fail("identifier too long")
+	}
+	id := st.str[st.pos : st.pos+n]
+	st.pos += n
+	if punycode {
+		dec, ok := swiftPunycodeDecode(id)
+		if !ok {
+			st.fail("invalid punycode")
+		}
+		id = dec
+	}
+	if len(fixity) > 0 {
+		return swiftText(skOperator, swiftOperatorName(id)+fixity)
+	}
+	return swiftText(skIdentifier, id)
+}
+
+// genericSignature parses the generic parameter counts and requirements up to the closing 'r'.
+func (st *swiftLegacyState) genericSignature() *swiftNode {
+	sig := swiftNew(skGenericSignature)
+	for c := st.peek(); c != 'R' && c != 'r'; c = st.peek() {
+		count := 0
+		if !st.nextIf('z') {
+			count = st.index() + 1
+		}
+		sig.add(&swiftNode{kind: skGenericParamCount, index: uint64(count)})
+	}
+	if len(sig.children) == 0 {
+		sig.add(&swiftNode{kind: skGenericParamCount, index: 1})
+	}
+	if st.nextIf('r') {
+		return sig
+	}
+	st.next() // 'R'
+	for !st.nextIf('r') {
+		param := st.typeParam()
+		switch c := st.next(); c {
+		case 'P':
+			sig.add(swiftNew(skConformanceRequirement, param, st.protocol()))
+		case 'C':
+			sig.add(swiftNew(skConformanceRequirement, param, st.typ()))
+		case 'z':
+			sig.add(swiftNew(skSameTypeRequirement, param, st.typ()))
+		default:
+			st.fail(fmt.Sprintf("unknown generic requirement %q", c))
+		}
+	}
+	return sig
+}
+
+// typeParam parses a generic parameter or one of its associated types.
+func (st *swiftLegacyState) typeParam() *swiftNode {
+	if st.nextIf('w') {
+		base := swiftType(st.genericParamIndex())
+		return swiftType(swiftNew(skDependentMemberType, base, swiftText(skAssociatedTypeRef, st.identifier().text)))
+	}
+	return swiftType(st.genericParamIndex())
+}
+
+// functionType parses the (throwing) argument and result types of a function type.
+func (st *swiftLegacyState) functionType(convention string) *swiftNode {
+	throws := st.nextIf('z')
+	fn := swiftText(skFunctionType, convention)
+	fn.add(swiftNew(skArgumentTuple, st.typ()))
+	fn.add(swiftNew(skReturnType, st.typ()))
+	if throws {
+		fn.add(swiftNew(skThrowsAnnotation))
+	}
+	return swiftType(fn)
+}
+
+func (st *swiftLegacyState) tupleType(variadic bool) *swiftNode {
+	tuple := swiftNew(skTuple)
+	for !st.nextIf('_') {
+		elt := swiftNew(skTupleElement)
+		if isDigit(st.peek()) {
+			elt.add(swiftText(skTupleElementName, st.identifier().text))
+		}
+		elt.add(st.typ())
+		tuple.add(elt)
+	}
+	if variadic && len(tuple.children) > 0 {
+		// the last element of a variadic tuple is mangled as an Array of the element type
+		last := tuple.children[len(tuple.children)-1]
+		ty := last.children[len(last.children)-1]
+		if bg := ty.child(0); bg.kind == skBoundGeneric && bg.child(0).child(0).child(1).text == "Array" {
+			last.children[len(last.children)-1] = bg.child(1).child(0)
+		}
+		last.add(swiftNew(skVariadicMarker))
+	}
+	return swiftType(tuple)
+}
+
+// typ parses a type, returning it wrapped in a Type node.
+func (st *swiftLegacyState) typ() *swiftNode {
+	switch c := st.next(); c {
+	case 'B':
+		if st.nextIf('v') {
+			n := st.natural()
+			if n < 0 || !st.nextIf('B') {
+				st.fail("invalid builtin vector type")
+			}
+			elt := strings.TrimPrefix(swiftNodeToString(swiftType(st.builtinType())), "Builtin.")
+			return swiftType(swiftText(skBuiltinType, fmt.Sprintf("Builtin.Vec%dx%s", n, elt)))
+		}
+		return swiftType(st.builtinType())
+	case 'a':
+		ctx := st.context()
+		n := swiftType(swiftNew(skTypeAlias, ctx, st.declName()))
+		st.addSubst(n)
+		return n
+	case 'b':
+		return st.functionType("@convention(block)")
+	case 'c':
+		return st.functionType("@convention(c)")
+	case 'F', 'f':
+		return st.functionType("")
+	case 'K':
+		return st.functionType("@autoclosure")
+	case 'D':
+		return swiftType(swiftNew(skDynamicSelf, st.typ()))
+	case 'G':
+		base := st.typ()
+		if !base.child(0).kind.isNominal() {
+			st.fail("invalid bound generic nominal type")
+		}
+		args := swiftNew(skTypeList)
+		for !st.nextIf('_') {
+			args.add(st.typ())
+		}
+		return swiftType(swiftNew(skBoundGeneric, base, args))
+	case 'M':
+		return swiftType(swiftNew(skMetatype, st.typ()))
+	case 'P':
+		if st.nextIf('M') {
+			return swiftType(swiftNew(skExistentialMetatype, st.typ()))
+		}
+		protos := swiftNew(skTypeList)
+		for !st.nextIf('_') {
+			protos.add(st.protocol())
+		}
+		return swiftType(swiftNew(skProtocolList, protos))
+	case 'Q':
+		if st.nextIf('d') {
+			depth := st.index() + 1
+			return swiftType(swiftGenericParam(uint64(depth), uint64(st.index())))
+		}
+		return swiftType(swiftGenericParam(0, uint64(st.index())))
+	case 'q':
+		return swiftType(st.genericParamIndex())
+	case 'x':
+		return swiftType(swiftGenericParam(0, 0))
+	case 'w':
+		st.pos--
+		return st.typeParam()
+	case 'R':
+		return swiftType(swiftText(skTypeAttribute, "inout", st.typ()))
+	case 'S':
+		n := st.substitution()
+		if n.kind != skType {
+			st.fail("expected type substitution")
+		}
+		return n
+	case 'T', 't':
+		return st.tupleType(c == 't')
+	case 'u':
+		sig := st.genericSignature()
+		return swiftType(swiftNew(skDependentGenericType, sig, st.typ()))
+	case 'X':
+		switch c := st.next(); c {
+		case 'o':
+			return swiftType(swiftText(skTypeAttribute, "unowned", st.typ()))
+		case 'u':
+			return swiftType(swiftText(skTypeAttribute, "unowned(unsafe)", st.typ()))
+		case 'w':
+			return swiftType(swiftText(skTypeAttribute, "weak", st.typ()))
+		default:
+			st.fail(fmt.Sprintf("unknown special type %q", c))
+		}
+	case 'C', 'V', 'O':
+		k := map[byte]swiftKind{'C': skClass, 'V': skStructure, 'O': skEnum}[c]
+		ctx := st.context()
+		n := swiftType(swiftNew(k, ctx, st.declName()))
+		st.addSubst(n)
+		return n
+	default:
+		st.fail(fmt.Sprintf("unknown type %q", c))
+	}
+	return nil
+}
@@ -0,0 +1,1464 @@
+package demangle
+
+import (
+	"fmt"
+	"strings"
+)
+
+// operator parses the next operator or operand of a Swift 4+ symbol.
+func (st *swiftState) operator() *swiftNode {
+	c := st.next()
+	switch {
+	case c >= 0x01 && c <= 0x17:
+		if st.pos+4 > len(st.str) {
+			st.fail("invalid symbolic reference")
+		}
+		st.pos += 4
+		return swiftType(swiftText(skSymbolicReference, "symbolic reference"))
+	case c >= 0x18 && c <= 0x1f:
+		if st.pos+8 > len(st.str) {
+			st.fail("invalid symbolic reference")
+		}
+		st.pos += 8
+		return swiftType(swiftText(skSymbolicReference, "symbolic reference"))
+	}
+
+	switch c {
+	case 'A':
+		return st.multiSubstitution()
+	case 'B':
+		return swiftType(st.builtinType())
+	case 'C':
+		return st.anyGeneric(skClass)
+	case 'D':
+		return swiftNew(skTypeMangling, st.mustPop(skType))
+	case 'E':
+		return st.extensionContext()
+	case 'F':
+		return st.plainFunction()
+	case 'G':
+		return st.boundGenericType()
+	case 'K':
+		return swiftNew(skThrowsAnnotation)
+	case 'L':
+		return st.localIdentifier()
+	case 'M':
+		return st.metatype()
+	case 'N':
+		return swiftText(skDescriptor, "type metadata for", st.mustPop(skType))
+	case 'O':
+		return st.anyGeneric(skEnum)
+	case 'P':
+		return st.anyGeneric(skProtocol)
+	case 'Q':
+		return st.archetype()
+	case 'R':
+		return st.genericRequirement()
+	case 'S':
+		return st.standardSubstitution()
+	case 'T':
+		return st.thunkOrSpecialization()
+	case 'V':
+		return st.anyGeneric(skStructure)
+	case 'W':
+		return st.witness()
+	case 'X':
+		return st.specialType()
+	case 'Y':
+		return st.concurrencyAnnotation()
+	case 'Z':
+		return swiftNew(skStatic, st.pop(swiftKind.isEntity))
+	case 'a':
+		return st.anyGeneric(skTypeAlias)
+	case 'c':
+		return st.functionType("")
+	case 'd':
+		return swiftNew(skVariadicMarker)
+	case 'f':
+		return st.functionEntity()
+	case 'h':
+		return swiftType(swiftText(skTypeAttribute, "__shared", st.popTypeChild()))
+	case 'i':
+		return st.subscript()
+	case 'l':
+		return st.genericSignature(false)
+	case 'm':
+		return swiftType(swiftNew(skMetatype, st.mustPop(skType)))
+	case 'n':
+		return swiftType(swiftText(skTypeAttribute, "__owned", st.popTypeChild()))
+	case 'o':
+		return st.operatorIdentifier()
+	case 'p':
+		return swiftType(st.protocolList())
+	case 'q':
+		return swiftType(st.genericParamIndex())
+	case 'r':
+		return st.genericSignature(true)
+	case 's':
+		return swiftText(skModule, "Swift")
+	case 't':
+		return st.tupleType()
+	case 'u':
+		sig := st.popKind(skGenericSignature)
+		return swiftType(swiftNew(skDependentGenericType, sig, st.mustPop(skType)))
+	case 'v':
+		return st.accessor(st.entity(skVariable))
+	case 'x':
+		return swiftType(swiftGenericParam(0, 0))
+	case 'y':
+		return swiftNew(skEmptyList)
+	case 'z':
+		return swiftType(swiftText(skTypeAttribute, "inout", st.popTypeChild()))
+	case '_':
+		return swiftNew(skFirstElementMarker)
+	case '.':
+		n := swiftText(skSuffix, st.str[st.pos-1:])
+		st.pos = len(st.str)
+		return n
+	}
+
+	st.pos--
+	return st.identifier()
+}
+
+func swiftGenericParam(depth, index uint64) *swiftNode {
+	return &swiftNode{kind: skGenericParam, text: fmt.Sprintf("%d", depth), index: index}
+}
+
+func (st *swiftState) popTypeChild() *swiftNode {
+	return st.mustPop(skType).child(0)
+}
+
+// popModule pops an identifier or module off the stack as a module.
+func (st *swiftState) popModule() *swiftNode {
+	if id := st.popKind(skIdentifier); id != nil {
+		return swiftText(skModule, id.text)
+	}
+	return st.popKind(skModule)
+}
+
+// popContext pops the parent context of an entity off the stack.
+func (st *swiftState) popContext() *swiftNode {
+	if mod := st.popModule(); mod != nil {
+		return mod
+	}
+	if ty := st.popKind(skType); ty != nil {
+		if len(ty.children) != 1 || !ty.child(0).kind.isContext() {
+			st.fail("invalid context type")
+		}
+		return ty.child(0)
+	}
+	if ctx := st.pop(swiftKind.isContext); ctx != nil {
+		return ctx
+	}
+	st.fail("missing context")
+	return nil
+}
+
+func (st *swiftState) popDeclName() *swiftNode {
+	n := st.pop(swiftKind.isDeclName)
+	if n == nil {
+		st.fail("missing declaration name")
+	}
+	return n
+}
+
+func (st *swiftState) anyGeneric(k swiftKind) *swiftNode {
+	name := st.popDeclName()
+	ctx := st.popContext()
+	n := swiftType(swiftNew(k, ctx, name))
+	st.addSubst(n)
+	return n
+}
+
+// popProtocol pops a protocol type (or its context and name) off the stack.
+func (st *swiftState) popProtocol() *swiftNode {
+	if ty := st.popKind(skType); ty != nil {
+		if p := ty.child(0); p == nil || (p.kind != skProtocol && p.kind != skSymbolicReference) {
+			st.fail("expected protocol")
+		}
+		return ty
+	}
+	name := st.popDeclName()
+	ctx := st.popContext()
+	return swiftType(swiftNew(skProtocol, ctx, name))
+}
+
+func (st *swiftState) multiSubstitution() *swiftNode {
+	repeat := -1
+	for {
+		c := st.next()
+		switch {
+		case isLower(c):
+			n := st.subst(int(c - 'a'))
+			for ; repeat > 1; repeat-- {
+				st.push(n)
+			}
+			st.push(n)
+			repeat = -1
+		case isUpper(c):
+			n := st.subst(int(c - 'A'))
+			for ; repeat > 1; repeat-- {
+				st.push(n)
+			}
+			return n
+		case c == '_':
+			return st.subst(repeat + 27)
+		default:
+			st.pos--
+			if repeat = st.natural(); repeat < 0 {
+				st.fail("invalid substitution")
+			}
+		}
+	}
+}
+
+var swiftStdTypes = map[byte]struct {
+	kind swiftKind
+	name string
+}{
+	'A': {skStructure, "AutoreleasingUnsafeMutablePointer"},
+	'a': {skStructure, "Array"},
+	'b': {skStructure, "Bool"},
+	'D': {skStructure, "Dictionary"},
+	'd': {skStructure, "Double"},
+	'f': {skStructure, "Float"},
+	'h': {skStructure, "Set"},
+	'I': {skStructure, "DefaultIndices"},
+	'i': {skStructure, "Int"},
+	'J': {skStructure, "Character"},
+	'N': {skStructure, "ClosedRange"},
+	'n': {skStructure, "Range"},
+	'O': {skStructure, "ObjectIdentifier"},
+	'P': {skStructure, "UnsafePointer"},
+	'p': {skStructure, "UnsafeMutablePointer"},
+	'R': {skStructure, "UnsafeBufferPointer"},
+	'r': {skStructure, "UnsafeMutableBufferPointer"},
+	'S': {skStructure, "String"},
+	's': {skStructure, "Substring"},
+	'u': {skStructure, "UInt"},
+	'V': {skStructure, "UnsafeRawPointer"},
+	'v': {skStructure, "UnsafeMutableRawPointer"},
+	'W': {skStructure, "UnsafeRawBufferPointer"},
+	'w': {skStructure, "UnsafeMutableRawBufferPointer"},
+	'q': {skEnum, "Optional"},
+	'B': {skProtocol, "BinaryFloatingPoint"},
+	'E': {skProtocol, "Encodable"},
+	'e': {skProtocol, "Decodable"},
+	'F': {skProtocol, "FloatingPoint"},
+	'G': {skProtocol, "RandomNumberGenerator"},
+	'H': {skProtocol, "Hashable"},
+	'j': {skProtocol, "Numeric"},
+	'K': {skProtocol, "BidirectionalCollection"},
+	'k': {skProtocol, "RandomAccessCollection"},
+	'L': {skProtocol, "Comparable"},
+	'l': {skProtocol, "Collection"},
+	'M': {skProtocol, "MutableCollection"},
+	'm': {skProtocol, "RangeReplaceableCollection"},
+	'Q': {skProtocol, "Equatable"},
+	'T': {skProtocol, "Sequence"},
+	't': {skProtocol, "IteratorProtocol"},
+	'U': {skProtocol, "UnsignedInteger"},
+	'X': {skProtocol, "RangeExpression"},
+	'x': {skProtocol, "Strideable"},
+	'Y': {skProtocol, "RawRepresentable"},
+	'y': {skProtocol, "StringProtocol"},
+	'Z': {skProtocol, "SignedInteger"},
+	'z': {skProtocol, "BinaryInteger"},
+}
+
+// swiftStdConcurrencyTypes are the second level (Sc) standard substitutions
+var swiftStdConcurrencyTypes = map[byte]struct {
+	kind swiftKind
+	name string
+}{
+	'A': {skProtocol, "Actor"},
+	'C': {skStructure, "CheckedContinuation"},
+	'c': {skStructure, "UnsafeContinuation"},
+	'E': {skStructure, "CancellationError"},
+	'e': {skStructure, "UnownedSerialExecutor"},
+	'F': {skProtocol, "Executor"},
+	'f': {skProtocol, "SerialExecutor"},
+	'G': {skStructure, "TaskGroup"},
+	'g': {skStructure, "ThrowingTaskGroup"},
+	'I': {skProtocol, "AsyncIteratorProtocol"},
+	'i': {skProtocol, "AsyncSequence"},
+	'J': {skStructure, "UnownedJob"},
+	'M': {skClass, "MainActor"},
+	'P': {skStructure, "TaskPriority"},
+	'S': {skStructure, "AsyncStream"},
+	's': {skStructure, "AsyncThrowingStream"},
+	'T': {skStructure, "Task"},
+	't': {skStructure, "UnsafeCurrentTask"},
+}
+
+func (st *swiftState) standardSubstitution() *swiftNode {
+	switch st.peek() {
+	case 'o':
+		st.pos++
+		return swiftText(skModule, "__C")
+	case 'C':
+		st.pos++
+		return swiftText(skModule, "__C_Synthesized")
+	case 'g':
+		st.pos++
+		opt := swiftType(swiftNew(skBoundGeneric,
+			swiftType(swiftNew(skEnum, swiftText(skModule, "Swift"), swiftText(skIdentifier, "Optional"))),
+			swiftNew(skTypeList, st.mustPop(skType))))
+		st.addSubst(opt)
+		return opt
+	}
+
+	repeat := st.natural()
+	table := swiftStdTypes
+	if st.nextIf('c') {
+		table = swiftStdConcurrencyTypes
+	}
+	std, ok := table[st.next()]
+	if !ok {
+		st.fail("unknown standard substitution")
+	}
+	n := swiftType(swiftNew(std.kind, swiftText(skModule, "Swift"), swiftText(skIdentifier, std.name)))
+	for ; repeat > 1; repeat-- {
+		st.push(n)
+	}
+	return n
+}
+
+func (st *swiftState) builtinType() *swiftNode {
+	var name string
+	switch c := st.next(); c {
+	case 'b':
+		name = "BridgeObject"
+	case 'B':
+		name = "UnsafeValueBuffer"
+	case 'c':
+		name = "RawUnsafeContinuation"
+	case 'D':
+		name = "DefaultActorStorage"
+	case 'd':
+		name = "NonDefaultDistributedActorStorage"
+	case 'e':
+		name = "Executor"
+	case 'f':
+		n := st.index() - 1
+		name = fmt.Sprintf("FPIEEE%d", n)
+	case 'i':
+		n := st.index() - 1
+		name = fmt.Sprintf("Int%d", n)
+	case 'I':
+		name = "IntLiteral"
+	case 'j':
+		name = "Job"
+	case 'O':
+		name = "UnknownObject"
+	case 'o':
+		name = "NativeObject"
+	case 'p':
+		name = "RawPointer"
+	case 't':
+		name = "SILToken"
+	case 'v':
+		n := st.index() - 1
+		elt := st.popTypeChild()
+		return swiftText(skBuiltinType, fmt.Sprintf("Vec%dx%s", n, strings.TrimPrefix(swiftNodeToString(elt), "Builtin.")))
+	case 'w':
+		name = "Word"
+	default:
+		st.fail(fmt.Sprintf("unknown builtin type %q", c))
+	}
+	return swiftText(skBuiltinType, "Builtin."+name)
+}
+
+func (st *swiftState) extensionContext() *swiftNode {
+	sig := st.popKind(skGenericSignature)
+	mod := st.popModule()
+	if mod == nil {
+		st.fail("missing extension module")
+	}
+	typ := st.popTypeChild()
+	return swiftNew(skExtension, mod, typ, sig)
+}
+
+// popFunctionParams pops the parameters or results of a function type.
+func (st *swiftState) popFunctionParams(k swiftKind) *swiftNode {
+	if st.popKind(skEmptyList) != nil {
+		return swiftNew(k, swiftType(swiftNew(skTuple)))
+	}
+	return swiftNew(k, st.mustPop(skType))
+}
+
+// functionType pops a function type with the given convention ("" for a Swift function).
+func (st *swiftState) functionType(convention string) *swiftNode {
+	fn := swiftText(skFunctionType, convention)
+	var attrs []*swiftNode
+	for {
+		attr := st.pop(func(k swiftKind) bool {
+			return k == skThrowsAnnotation || k == skAsyncAnnotation || k == skSendableAnnotation || k == skGlobalActor
+		})
+		if attr == nil {
+			break
+		}
+		attrs = append(attrs, attr)
+	}
+	fn.add(st.popFunctionParams(skArgumentTuple))
+	fn.add(st.popFunctionParams(skReturnType))
+	fn.add(attrs...)
+	return swiftType(fn)
+}
+
+// popFunctionParamLabels pops the argument labels of a function entity.
+func (st *swiftState) popFunctionParamLabels(typ *swiftNode) *swiftNode {
+	if st.popKind(skEmptyList) != nil {
+		return swiftNew(skLabelList)
+	}
+	fn := typ.child(0)
+	if fn != nil && fn.kind == skDependentGenericType {
+		fn = fn.child(1).child(0)
+	}
+	if fn == nil || fn.kind != skFunctionType {
+		return nil
+	}
+	params := fn.child(0).child(0).child(0)
+	num := 1
+	if params.kind == skTuple {
+		num = len(params.children)
+	}
+	if num == 0 {
+		return nil
+	}
+	labels := swiftNew(skLabelList)
+	for i := 0; i < num; i++ {
+		l := st.pop(func(k swiftKind) bool { return k == skIdentifier || k == skFirstElementMarker })
+		if l == nil {
+			st.fail("missing argument label")
+		}
+		labels.add(l)
+	}
+	labels.reverse(0)
+	return labels
+}
+
+func (st *swiftState) plainFunction() *swiftNode {
+	sig := st.popKind(skGenericSignature)
+	typ := st.functionType("")
+	labels := st.popFunctionParamLabels(typ)
+	if sig != nil {
+		typ = swiftType(swiftNew(skDependentGenericType, sig, typ))
+	}
+	name := st.popDeclName()
+	ctx := st.popContext()
+	return swiftNew(skFunction, ctx, name, labels, typ)
+}
+
+// entity pops a variable-like entity (context, name and type).
+func (st *swiftState) entity(k swiftKind) *swiftNode {
+	typ := st.mustPop(skType)
+	labels := st.popFunctionParamLabels(typ)
+	name := st.popDeclName()
+	ctx := st.popContext()
+	return swiftNew(k, ctx, name, labels, typ)
+}
+
+func (st *swiftState) subscript() *swiftNode {
+	priv := st.popKind(skPrivateDeclName)
+	typ := st.mustPop(skType)
+	labels := st.popFunctionParamLabels(typ)
+	ctx := st.popContext()
+	return st.accessor(swiftNew(skSubscript, ctx, labels, typ, priv))
+}
+
+func (st *swiftState) accessor(child *swiftNode) *swiftNode {
+	var name string
+	switch c := st.next(); c {
+	case 'm':
+		name = "materializeForSet"
+	case 's':
+		name = "setter"
+	case 'g':
+		name = "getter"
+	case 'G':
+		name = "globalGetter"
+	case 'w':
+		name = "willset"
+	case 'W':
+		name = "didset"
+	case 'r':
+		name = "read"
+	case 'M':
+		name = "modify"
+	case 'i':
+		name = "init"
+	case 'a', 'l':
+		names := map[byte]string{'O': "owningMutableAddressor", 'o': "nativeOwningMutableAddressor", 'p': "nativePinningMutableAddressor", 'u': "mutableAddressor"}
+		if c == 'l' {
+			names = map[byte]string{'O': "owningAddressor", 'o': "nativeOwningAddressor", 'p': "nativePinningAddressor", 'u': "unsafeAddressor"}
+		}
+		var ok bool
+		if name, ok = names[st.next()]; !ok {
+			st.fail("unknown addressor")
+		}
+	case 'p':
+		return child
+	default:
+		st.fail(fmt.Sprintf("unknown accessor %q", c))
+	}
+	return swiftText(skAccessor, name, child)
+}
+
+func (st *swiftState) functionEntity() *swiftNode {
+	var k swiftKind
+	args := ""
+	switch c := st.next(); c {
+	case 'D':
+		k = skDeallocator
+	case 'd':
+		k = skDestructor
+	case 'E':
+		k = skIVarDestroyer
+	case 'e':
+		k = skIVarInitializer
+	case 'i':
+		k = skInitializer
+	case 'C':
+		k, args = skAllocator, "type"
+	case 'c':
+		k, args = skConstructor, "type"
+	case 'U':
+		k, args = skExplicitClosure, "typeAndIndex"
+	case 'u':
+		k, args = skImplicitClosure, "typeAndIndex"
+	case 'A':
+		k, args = skDefaultArgumentInitializer, "index"
+	case 'P':
+		return swiftText(skDescriptor, "property wrapper backing initializer of", st.pop(swiftKind.isEntity))
+	case 'W':
+		return swiftText(skDescriptor, "property wrapper init from projected value of", st.pop(swiftKind.isEntity))
+	default:
+		st.fail(fmt.Sprintf("unknown function entity %q", c))
+	}
+
+	var nameOrIndex, typ, labels *swiftNode
+	switch args {
+	case "type":
+		nameOrIndex = st.popKind(skPrivateDeclName)
+		typ = st.mustPop(skType)
+		labels = st.popFunctionParamLabels(typ)
+	case "typeAndIndex":
+		nameOrIndex = st.indexNode()
+		typ = st.popKind(skType)
+	case "index":
+		nameOrIndex = st.indexNode()
+	}
+	return swiftNew(k, st.popContext(), labels, typ, nameOrIndex)
+}
+
+func (st *swiftState) localIdentifier() *swiftNode {
+	if st.nextIf('L') {
+		disc := st.mustPop(skIdentifier)
+		name := st.popDeclName()
+		return swiftNew(skPrivateDeclName, disc, name)
+	}
+	if st.nextIf('l') {
+		return swiftNew(skPrivateDeclName, st.mustPop(skIdentifier))
+	}
+	if c := st.peek(); (c >= 'a' && c <= 'j') || (c >= 'A' && c <= 'J') {
+		st.pos++
+		return swiftText(skRelatedEntityDeclName, string(c), st.popDeclName())
+	}
+	disc := st.indexNode()
+	name := st.popDeclName()
+	return swiftNew(skLocalDeclName, disc, name)
+}
+
+func (st *swiftState) operatorIdentifier() *swiftNode {
+	id := st.mustPop(skIdentifier)
+	op := swiftOperatorName(id.text)
+	switch c := st.next(); c {
+	case 'i':
+		return swiftText(skOperator, op+" infix")
+	case 'p':
+		return swiftText(skOperator, op+" prefix")
+	case 'P':
+		return swiftText(skOperator, op+" postfix")
+	default:
+		st.fail(fmt.Sprintf("unknown operator fixity %q", c))
+	}
+	return nil
+}
+
+// swiftOperatorName decodes the operator characters of an operator identifier
+func swiftOperatorName(s string) string {
+	const ops = "& @/= >    <*!|+?%-~   ^ ."
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' && ops[c-'a'] != ' ' {
+			sb.WriteByte(ops[c-'a'])
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+func (st *swiftState) tupleType() *swiftNode {
+	tuple := swiftNew(skTuple)
+	if st.popKind(skEmptyList) == nil {
+		for {
+			first := st.popKind(skFirstElementMarker) != nil
+			elt := swiftNew(skTupleElement)
+			elt.add(st.popKind(skVariadicMarker))
+			if id := st.popKind(skIdentifier); id != nil {
+				elt.add(swiftText(skTupleElementName, id.text))
+			}
+			elt.add(st.mustPop(skType))
+			tuple.add(elt)
+			if first {
+				break
+			}
+		}
+		tuple.reverse(0)
+	}
+	return swiftType(tuple)
+}
+
+func (st *swiftState) popTypeList() *swiftNode {
+	list := swiftNew(skTypeList)
+	if st.popKind(skEmptyList) == nil {
+		for {
+			first := st.popKind(skFirstElementMarker) != nil
+			list.add(st.mustPop(skType))
+			if first {
+				break
+			}
+		}
+		list.reverse(0)
+	}
+	return list
+}
+
+func (st *swiftState) boundGenericType() *swiftNode {
+	var lists []*swiftNode
+	for {
+		list := swiftNew(skTypeList)
+		lists = append(lists, list)
+		for ty := st.popKind(skType); ty != nil; ty = st.popKind(skType) {
+			list.add(ty)
+		}
+		list.reverse(0)
+		if st.popKind(skEmptyList) != nil {
+			break
+		}
+		if st.popKind(skFirstElementMarker) == nil {
+			st.fail("invalid bound generic type")
+		}
+	}
+	nominal := st.popTypeChild()
+	if nominal == nil || (!nominal.kind.isNominal() && nominal.kind != skSymbolicReference) {
+		st.fail("invalid bound generic nominal type")
+	}
+	n := swiftType(st.boundGenericArgs(nominal, lists, 0))
+	st.addSubst(n)
+	return n
+}
+
+func (st *swiftState) boundGenericArgs(nominal *swiftNode, lists []*swiftNode, idx int) *swiftNode {
+	if idx >= len(lists) {
+		return nominal
+	}
+	args := lists[idx]
+	idx++
+	if idx < len(lists) && nominal.kind.isNominal() {
+		// apply the remaining generic arguments to the parent types
+		ctx := nominal.child(0)
+		var parent *swiftNode
+		if ctx.kind == skExtension {
+			parent = swiftNew(skExtension, ctx.child(0), st.boundGenericArgs(ctx.child(1), lists, idx), ctx.child(2))
+		} else if ctx.kind.isNominal() {
+			parent = st.boundGenericArgs(ctx, lists, idx)
+		} else {
+			parent = ctx
+		}
+		nominal = swiftNew(nominal.kind, append([]*swiftNode{parent}, nominal.children[1:]...)...)
+	}
+	if len(args.children) == 0 {
+		return nominal
+	}
+	return swiftNew(skBoundGeneric, swiftType(nominal), args)
+}
+
+func (st *swiftState) genericParamIndex() *swiftNode {
+	if st.nextIf('d') {
+		depth := st.index() + 1
+		index := st.index()
+		return swiftGenericParam(uint64(depth), uint64(index))
+	}
+	if st.nextIf('z') {
+		return swiftGenericParam(0, 0)
+	}
+	return swiftGenericParam(0, uint64(st.index()+1))
+}
+
+func (st *swiftState) genericSignature(hasParamCounts bool) *swiftNode {
+	sig := swiftNew(skGenericSignature)
+	if hasParamCounts {
+		for !st.nextIf('l') {
+			count := 0
+			if !st.nextIf('z') {
+				count = st.index() + 1
+			}
+			sig.add(&swiftNode{kind: skGenericParamCount, index: uint64(count)})
+		}
+	} else {
+		sig.add(&swiftNode{kind: skGenericParamCount, index: 1})
+	}
+	numCounts := len(sig.children)
+	for req := st.pop(swiftKind.isRequirement); req != nil; req = st.pop(swiftKind.isRequirement) {
+		sig.add(req)
+	}
+	sig.reverse(numCounts)
+	return sig
+}
+
+func (st *swiftState) popAssocTypeName() *swiftNode {
+	proto := st.popKind(skType)
+	if proto != nil && proto.child(0).kind != skProtocol {
+		st.fail("invalid associated type protocol")
+	}
+	id := st.mustPop(skIdentifier)
+	return swiftText(skAssociatedTypeRef, id.text, proto)
+}
+
+func (st *swiftState) associatedTypeSimple(base *swiftNode) *swiftNode {
+	name := st.popAssocTypeName()
+	var baseTy *swiftNode
+	if base != nil {
+		baseTy = swiftType(base)
+	} else {
+		baseTy = st.mustPop(skType)
+	}
+	return swiftType(swiftNew(skDependentMemberType, baseTy, name))
+}
+
+func (st *swiftState) associatedTypeCompound(base *swiftNode) *swiftNode {
+	var names []*swiftNode
+	for {
+		first := st.popKind(skFirstElementMarker) != nil
+		names = append(names, st.popAssocTypeName())
+		if first {
+			break
+		}
+	}
+	var baseTy *swiftNode
+	if base != nil {
+		baseTy = swiftType(base)
+	} else {
+		baseTy = st.mustPop(skType)
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		baseTy = swiftType(swiftNew(skDependentMemberType, baseTy, names[i]))
+	}
+	return baseTy
+}
+
+func (st *swiftState) genericRequirement() *swiftNode {
+	constraint, typeKind := "protocol", "generic"
+	switch c := st.next(); c {
+	case 'c':
+		constraint, typeKind = "baseClass", "assoc"
+	case 'C':
+		constraint, typeKind = "baseClass", "compoundAssoc"
+	case 'b':
+		constraint, typeKind = "baseClass", "generic"
+	case 'B':
+		constraint, typeKind = "baseClass", "substitution"
+	case 't':
+		constraint, typeKind = "sameType", "assoc"
+	case 'T':
+		constraint, typeKind = "sameType", "compoundAssoc"
+	case 's':
+		constraint, typeKind = "sameType", "generic"
+	case 'S':
+		constraint, typeKind = "sameType", "substitution"
+	case 'm':
+		constraint, typeKind = "layout", "assoc"
+	case 'M':
+		constraint, typeKind = "layout", "compoundAssoc"
+	case 'l':
+		constraint, typeKind = "layout", "generic"
+	case 'L':
+		constraint, typeKind = "layout", "substitution"
+	case 'p':
+		typeKind = "assoc"
+	case 'P':
+		typeKind = "compoundAssoc"
+	case 'Q':
+		typeKind = "substitution"
+	default:
+		st.pos--
+	}
+
+	var constrTy *swiftNode
+	switch typeKind {
+	case "generic":
+		constrTy = swiftType(st.genericParamIndex())
+	case "assoc":
+		constrTy = st.associatedTypeSimple(st.genericParamIndex())
+		st.addSubst(constrTy)
+	case "compoundAssoc":
+		constrTy = st.associatedTypeCompound(st.genericParamIndex())
+		st.addSubst(constrTy)
+	case "substitution":
+		constrTy = st.mustPop(skType)
+	}
+
+	switch constraint {
+	case "protocol":
+		return swiftNew(skConformanceRequirement, constrTy, st.popProtocol())
+	case "baseClass":
+		return swiftNew(skConformanceRequirement, constrTy, st.mustPop(skType))
+	case "sameType":
+		return swiftNew(skSameTypeRequirement, constrTy, st.mustPop(skType))
+	}
+
+	var layout string
+	switch c := st.next(); c {
+	case 'U':
+		layout = "_UnknownLayout"
+	case 'R':
+		layout = "_RefCountedObject"
+	case 'N':
+		layout = "_NativeRefCountedObject"
+	case 'C':
+		layout = "AnyObject"
+	case 'D':
+		layout = "_NativeClass"
+	case 'T':
+		layout = "_Trivial"
+	case 'E', 'e':
+		size := st.natural()
+		layout = fmt.Sprintf("_Trivial(%d", size)
+		if c == 'e' {
+			st.nextIf('_')
+			layout += fmt.Sprintf(", %d", st.natural())
+		}
+		layout += ")"
+	case 'M', 'm':
+		size := st.natural()
+		layout = fmt.Sprintf("_TrivialAtMost(%d", size)
+		if c == 'm' {
+			st.nextIf('_')
+			layout += fmt.Sprintf(", %d", st.natural())
+		}
+		layout += ")"
+	default:
+		st.fail(fmt.Sprintf("unknown layout constraint %q", c))
+	}
+	return swiftText(skLayoutRequirement, layout, constrTy)
+}
+
+func (st *swiftState) archetype() *swiftNode {
+	switch c := st.next(); c {
+	case 'a':
+		id := st.mustPop(skIdentifier)
+		arch := st.popTypeChild()
+		n := swiftType(swiftNew(skDependentMemberType, swiftType(arch), swiftText(skAssociatedTypeRef, id.text)))
+		st.addSubst(n)
+		return n
+	case 'O':
+		return swiftNew(skOpaqueReturnTypeOf, st.popContext())
+	case 'o':
+		st.index()
+		for st.popKind(skTypeList) != nil {
+		}
+		name := st.pop(nil)
+		if name == nil {
+			st.fail("missing opaque type")
+		}
+		n := swiftType(swiftNew(skOpaqueType, name))
+		st.addSubst(n)
+		return n
+	case 'r', 'R':
+		if c == 'R' {
+			st.index()
+		}
+		return swiftType(swiftText(skOpaqueType, "some"))
+	case 'x':
+		n := st.associatedTypeSimple(nil)
+		st.addSubst(n)
+		return n
+	case 'X':
+		n := st.associatedTypeCompound(nil)
+		st.addSubst(n)
+		return n
+	case 'y':
+		n := st.associatedTypeSimple(st.genericParamIndex())
+		st.addSubst(n)
+		return n
+	case 'Y':
+		n := st.associatedTypeCompound(st.genericParamIndex())
+		st.addSubst(n)
+		return n
+	case 'z':
+		n := st.associatedTypeSimple(swiftGenericParam(0, 0))
+		st.addSubst(n)
+		return n
+	case 'Z':
+		n := st.associatedTypeCompound(swiftGenericParam(0, 0))
+		st.addSubst(n)
+		return n
+	default:
+		st.fail(fmt.Sprintf("unknown archetype %q", c))
+	}
+	return nil
+}
+
+func (st *swiftState) protocolList() *swiftNode {
+	types := swiftNew(skTypeList)
+	if st.popKind(skEmptyList) == nil {
+		for {
+			first := st.popKind(skFirstElementMarker) != nil
+			types.add(st.popProtocol())
+			if first {
+				break
+			}
+		}
+		types.reverse(0)
+	}
+	return swiftNew(skProtocolList, types)
+}
+
+func (st *swiftState) specialType() *swiftNode {
+	switch c := st.next(); c {
+	case 'E':
+		return st.functionType("") // noescape, which swift-demangle does not print
+	case 'A':
+		return st.functionType("@escaping @autoclosure")
+	case 'f':
+		return st.functionType("@convention(thin)")
+	case 'K':
+		return st.functionType("@autoclosure")
+	case 'U':
+		return st.functionType("uncurried")
+	case 'B':
+		return st.functionType("@convention(block)")
+	case 'C':
+		return st.functionType("@convention(c)")
+	case 'o':
+		return swiftType(swiftText(skTypeAttribute, "unowned", st.mustPop(skType)))
+	case 'u':
+		return swiftType(swiftText(skTypeAttribute, "unowned(unsafe)", st.mustPop(skType)))
+	case 'w':
+		return swiftType(swiftText(skTypeAttribute, "weak", st.mustPop(skType)))
+	case 'b':
+		return swiftType(swiftText(skTypeAttribute, "@box", st.mustPop(skType)))
+	case 'D':
+		return swiftType(swiftNew(skDynamicSelf, st.mustPop(skType)))
+	case 'M', 'm':
+		st.next() // metatype representation
+		if c == 'M' {
+			return swiftType(swiftNew(skMetatype, st.mustPop(skType)))
+		}
+		return swiftType(swiftNew(skExistentialMetatype, st.mustPop(skType)))
+	case 'p':
+		return swiftType(swiftNew(skExistentialMetatype, st.mustPop(skType)))
+	case 'c':
+		super := st.mustPop(skType)
+		return swiftType(swiftNew(skProtocolListWithClass, st.protocolList(), super))
+	case 'l':
+		return swiftType(swiftNew(skProtocolListWithAnyObject, st.protocolList()))
+	default:
+		st.fail(fmt.Sprintf("unknown special type %q", c))
+	}
+	return nil
+}
+
+func (st *swiftState) concurrencyAnnotation() *swiftNode {
+	switch c := st.next(); c {
+	case 'a':
+		return swiftNew(skAsyncAnnotation)
+	case 'b':
+		return swiftNew(skSendableAnnotation)
+	case 'c':
+		return swiftNew(skGlobalActor, st.mustPop(skType))
+	default:
+		st.fail(fmt.Sprintf("unknown concurrency annotation %q", c))
+	}
+	return nil
+}
+
+// popProtocolConformance pops a "type : protocol in module" conformance.
+func (st *swiftState) popProtocolConformance() *swiftNode {
+	sig := st.popKind(skGenericSignature)
+	mod := st.popModule()
+	proto := st.popProtocol()
+	typ := st.popKind(skType)
+	if typ == nil {
+		st.popKind(skIdentifier)
+		typ = st.mustPop(skType)
+	}
+	if sig != nil {
+		typ = swiftType(swiftNew(skDependentGenericType, sig, typ))
+	}
+	return swiftNew(skProtocolConformance, typ, proto, mod)
+}
+
+func (st *swiftState) metatype() *swiftNode {
+	descriptor := func(text string, child *swiftNode) *swiftNode {
+		if child == nil {
+			st.fail("missing operand")
+		}
+		return swiftText(skDescriptor, text, child)
+	}
+	switch c := st.next(); c {
+	case 'a':
+		return descriptor("type metadata accessor for", st.mustPop(skType))
+	case 'A':
+		return descriptor("reflection metadata associated type descriptor", st.popProtocolConformance())
+	case 'B':
+		return descriptor("reflection metadata builtin descriptor", st.mustPop(skType))
+	case 'c':
+		return descriptor("protocol conformance descriptor for", st.popProtocolConformance())
+	case 'C':
+		return descriptor("reflection metadata superclass descriptor", st.mustPop(skType))
+	case 'D':
+		return descriptor("demangling cache variable for type metadata for", st.mustPop(skType))
+	case 'f':
+		return descriptor("full type metadata for", st.mustPop(skType))
+	case 'F':
+		return descriptor("reflection metadata field descriptor", st.mustPop(skType))
+	case 'g':
+		return descriptor("opaque type descriptor accessor for", st.pop(nil))
+	case 'h':
+		return descriptor("opaque type descriptor accessor impl for", st.pop(nil))
+	case 'i':
+		return descriptor("type metadata instantiation function for", st.mustPop(skType))
+	case 'I':
+		return descriptor("type metadata instantiation cache for", st.mustPop(skType))
+	case 'j':
+		return descriptor("opaque type descriptor accessor key for", st.pop(nil))
+	case 'k':
+		return descriptor("opaque type descriptor accessor var for", st.pop(nil))
+	case 'K':
+		return descriptor("metadata instantiation cache for", st.pop(nil))
+	case 'l':
+		return descriptor("type metadata singleton initialization cache for", st.mustPop(skType))
+	case 'L':
+		return descriptor("lazy cache variable for type metadata for", st.mustPop(skType))
+	case 'm':
+		return descriptor("metaclass for", st.mustPop(skType))
+	case 'M':
+		return descriptor("canonical specialized generic metaclass for", st.mustPop(skType))
+	case 'n':
+		return descriptor("nominal type descriptor for", st.mustPop(skType))
+	case 'N':
+		return descriptor("noncanonical specialized generic type metadata for", st.mustPop(skType))
+	case 'o':
+		return descriptor("class metadata base offset for", st.mustPop(skType))
+	case 'p':
+		return descriptor("protocol descriptor for", st.popProtocol())
+	case 'P':
+		return descriptor("generic type metadata pattern for", st.mustPop(skType))
+	case 'Q':
+		return descriptor("opaque type descriptor for", st.pop(nil))
+	case 'r':
+		return descriptor("type metadata completion function for", st.mustPop(skType))
+	case 's':
+		return descriptor("ObjC resilient class stub for", st.mustPop(skType))
+	case 'S':
+		return descriptor("protocol self-conformance descriptor for", st.popProtocol())
+	case 't':
+		return descriptor("full ObjC resilient class stub for", st.mustPop(skType))
+	case 'u':
+		return descriptor("method lookup function for", st.mustPop(skType))
+	case 'U':
+		return descriptor("ObjC metadata update function for", st.mustPop(skType))
+	case 'V':
+		return descriptor("property descriptor for", st.pop(swiftKind.isEntity))
+	case 'X':
+		switch c := st.next(); c {
+		case 'E':
+			return descriptor("extension descriptor", st.popContext())
+		case 'M':
+			return descriptor("module descriptor", st.popModule())
+		case 'Y':
+			st.pop(nil) // discriminator
+			return descriptor("anonymous descriptor", st.popContext())
+		case 'X':
+			return descriptor("anonymous descriptor", st.popContext())
+		default:
+			st.fail(fmt.Sprintf("unknown context descriptor %q", c))
+		}
+	case 'z':
+		return descriptor("flag for loading of canonical specialized generic type metadata for", st.mustPop(skType))
+	default:
+		st.fail(fmt.Sprintf("unknown metadata %q", c))
+	}
+	return nil
+}
+
+func (st *swiftState) witness() *swiftNode {
+	descriptor := func(text string, child *swiftNode) *swiftNode {
+		if child == nil {
+			st.fail("missing operand")
+		}
+		return swiftText(skDescriptor, text, child)
+	}
+	switch c := st.next(); c {
+	case 'V':
+		return descriptor("value witness table for", st.mustPop(skType))
+	case 'v':
+		text := "direct field offset for"
+		if st.next() == 'i' {
+			text = "indirect field offset for"
+		}
+		return descriptor(text, st.pop(swiftKind.isEntity))
+	case 'S':
+		return descriptor("protocol self-conformance witness table for", st.popProtocol())
+	case 'P':
+		return descriptor("protocol witness table for", st.popProtocolConformance())
+	case 'p':
+		return descriptor("protocol witness table pattern for", st.popProtocolConformance())
+	case 'G':
+		return descriptor("generic protocol witness table for", st.popProtocolConformance())
+	case 'I':
+		return descriptor("instantiation function for generic protocol witness table for", st.popProtocolConformance())
+	case 'r':
+		return descriptor("resilient protocol witness table for", st.popProtocolConformance())
+	case 'l', 'L':
+		conf := st.popProtocolConformance()
+		typ := st.mustPop(skType)
+		text := "lazy protocol witness table accessor for type %s and conformance %s"
+		if c == 'L' {
+			text = "lazy protocol witness table cache variable for type %s and conformance %s"
+		}
+		return swiftText(skDescriptor2, text, typ, conf)
+	case 'a':
+		return descriptor("protocol witness table accessor for", st.popProtocolConformance())
+	case 't':
+		name := st.popDeclName()
+		conf := st.popProtocolConformance()
+		return swiftText(skDescriptor2, "associated type metadata accessor for %s in %s", name, conf)
+	case 'T':
+		proto := st.popProtocol()
+		typ := st.mustPop(skType)
+		conf := st.popProtocolConformance()
+		return swiftText(skDescriptor2, "associated type witness table accessor for %s in %s",
+			swiftText(skDescriptor2, "%s : %s", typ, proto), conf)
+	case 'b':
+		proto := st.popProtocol()
+		conf := st.popProtocolConformance()
+		return swiftText(skDescriptor2, "base witness table accessor for %s in %s", proto, conf)
+	case 'O':
+		var text string
+		switch c := st.next(); c {
+		case 'y':
+			text = "outlined copy of"
+		case 'e':
+			text = "outlined consume of"
+		case 'r':
+			text = "outlined retain of"
+		case 's':
+			text = "outlined release of"
+		case 'b':
+			text = "outlined initializeWithTake of"
+		case 'c':
+			text = "outlined initializeWithCopy of"
+		case 'd':
+			text = "outlined assignWithTake of"
+		case 'f':
+			text = "outlined assignWithCopy of"
+		case 'h':
+			text = "outlined destroy of"
+		default:
+			st.fail(fmt.Sprintf("unknown outlined operation %q", c))
+		}
+		st.popKind(skGenericSignature)
+		return descriptor(text, st.mustPop(skType))
+	default:
+		st.fail(fmt.Sprintf("unknown witness %q", c))
+	}
+	return nil
+}
+
+func (st *swiftState) thunkOrSpecialization() *swiftNode {
+	entityAttr := func(text string) *swiftNode {
+		e := st.pop(swiftKind.isEntity)
+		if e == nil {
+			st.fail("missing entity")
+		}
+		return swiftText(skDescriptor, text, e)
+	}
+	switch c := st.next(); c {
+	case 'c':
+		return entityAttr("curry thunk of")
+	case 'j':
+		return entityAttr("dispatch thunk of")
+	case 'q':
+		return entityAttr("method descriptor for")
+	case 'S':
+		return entityAttr("protocol self-conformance witness for")
+	case 'E':
+		return entityAttr("distributed thunk for")
+	case 'F':
+		return entityAttr("distributed accessor for")
+	case 'o':
+		return swiftText(skFunctionAttr, "@objc ")
+	case 'O':
+		return swiftText(skFunctionAttr, "@nonobjc ")
+	case 'D':
+		return swiftText(skFunctionAttr, "dynamic ")
+	case 'd':
+		return swiftText(skFunctionAttr, "super ")
+	case 'a':
+		return swiftText(skFunctionAttr, "partial apply ObjC forwarder")
+	case 'A':
+		return swiftText(skFunctionAttr, "partial apply forwarder")
+	case 'm':
+		return swiftText(skFunctionAttr, "merged ")
+	case 'X':
+		return swiftText(skFunctionAttr, "dynamically replaceable variable for ")
+	case 'x':
+		return swiftText(skFunctionAttr, "dynamically replaceable key for ")
+	case 'I':
+		return swiftText(skFunctionAttr, "dynamically replaceable thunk for ")
+	case 'B':
+		return swiftText(skFunctionAttr, "back deployment thunk for ")
+	case 'b':
+		return swiftText(skFunctionAttr, "back deployment fallback for ")
+	case 'Q', 'Y':
+		idx := st.index()
+		text := "await resume partial function for "
+		if c == 'Y' {
+			text = "suspend resume partial function for "
+		}
+		return swiftText(skFunctionAttr, fmt.Sprintf("(%d) %s", idx, text))
+	case 'C':
+		return swiftText(skDescriptor, "coroutine continuation prototype for", st.mustPop(skType))
+	case 'V':
+		base := st.pop(swiftKind.isEntity)
+		derived := st.pop(swiftKind.isEntity)
+		return swiftText(skDescriptor2, "vtable thunk for %s dispatching to %s", base, derived)
+	case 'W':
+		entity := st.pop(swiftKind.isEntity)
+		conf := st.popProtocolConformance()
+		return swiftText(skDescriptor2, "protocol witness for %s in conformance %s", entity, conf)
+	case 'R', 'r', 'y':
+		thunk := swiftNew(skDescriptor2)
+		sig := st.popKind(skGenericSignature)
+		var types []*swiftNode
+		for ty := st.popKind(skType); ty != nil; ty = st.popKind(skType) {
+			types = append(types, ty)
+		}
+		if len(types) < 2 {
+			st.fail("invalid reabstraction thunk")
+		}
+		prefix := "reabstraction thunk helper "
+		if c == 'r' {
+			prefix = "reabstraction thunk "
+		}
+		if sig != nil {
+			prefix += swiftNodeToString(sig) + " "
+		}
+		thunk.text = prefix + "from %s to %s"
+		thunk.add(types[1], types[0])
+		return thunk
+	case 'g', 'G', 'i':
+		text := "generic specialization"
+		switch c {
+		case 'G':
+			text = "generic not re-abstracted specialization"
+		case 'i':
+			text = "inlined generic function"
+		}
+		spec := st.specAttributes(text)
+		for _, ty := range st.popTypeList().children {
+			spec.add(swiftNew(skSpecializationParam, ty))
+		}
+		return spec
+	case 'p':
+		text := "partial specialization"
+		if st.nextIf('G') {
+			text = "generic not re-abstracted partial specialization"
+		}
+		spec := st.specAttributes(text)
+		spec.add(swiftNew(skSpecializationParam, st.mustPop(skType)))
+		return spec
+	case 'f':
+		return st.functionSpecialization()
+	case 'K', 'k':
+		st.popKind(skGenericSignature)
+		for st.popKind(skType) != nil {
+		}
+		text := "key path getter for"
+		if c == 'k' {
+			text = "key path setter for"
+		}
+		return swiftText(skDescriptor, text, st.pop(swiftKind.isEntity))
+	case 'H', 'h':
+		text := "key path equality operator for "
+		if c == 'h' {
+			text = "key path hash function for "
+		}
+		st.popKind(skGenericSignature)
+		var types []string
+		for ty := st.popKind(skType); ty != nil; ty = st.popKind(skType) {
+			types = append([]string{swiftNodeToString(ty)}, types...)
+		}
+		return swiftText(skFunctionAttr, text+strings.Join(types, ", "))
+	case 'l':
+		return swiftText(skDescriptor, "associated type descriptor for", swiftText(skIdentifier, st.popAssocTypeName().text))
+	case 'L':
+		return swiftText(skDescriptor, "protocol requirements base descriptor for", st.popProtocol())
+	case 'M':
+		return swiftText(skDescriptor, "default associated type metadata accessor for", swiftText(skIdentifier, st.popAssocTypeName().text))
+	case 'n', 'N':
+		proto := st.popProtocol()
+		typ := st.mustPop(skType)
+		text := "associated conformance descriptor for %s.%s"
+		if c == 'N' {
+			text = "default associated conformance accessor for %s.%s"
+		}
+		return swiftText(skDescriptor2, text, typ, proto)
+	case 'u':
+		return entityAttr("method descriptor for")
+	case 'v':
+		return swiftText(skFunctionAttr, fmt.Sprintf("outlined variable #%d of ", st.index()))
+	case 'e':
+		var params strings.Builder
+		for !st.nextIf('_') {
+			params.WriteByte(st.next())
+		}
+		return swiftText(skFunctionAttr, "outlined bridged method ("+params.String()+") of ")
+	case 'z', 'Z':
+		return swiftText(skDescriptor, "@objc completion handler block implementation for", st.mustPop(skType))
+	default:
+		st.fail(fmt.Sprintf("unknown thunk %q", c))
+	}
+	return nil
+}
+
+// specAttributes parses the serialized flag and pass ID of a specialization.
+func (st *swiftState) specAttributes(text string) *swiftNode {
+	serialized := st.nextIf('q')
+	st.nextIf('a') // async
+	st.nextIf('m') // metatype params removed
+	pass := st.next()
+	if pass < '0' || pass > '9' {
+		st.fail("invalid specialization pass ID")
+	}
+	spec := swiftText(skSpecialization, text)
+	if serialized {
+		spec.text = "serialized " + spec.text
+	}
+	return spec
+}
+
+func (st *swiftState) functionSpecialization() *swiftNode {
+	spec := st.specAttributes("function signature specialization")
+	var params []string
+	for idx := 0; ; idx++ {
+		if st.nextIf('_') {
+			// return value specialization follows
+			if st.nextIf('n') {
+				break
+			}
+			params = append(params, "Return = "+st.funcSpecParam())
+			break
+		}
+		if p := st.funcSpecParam(); len(p) > 0 {
+			params = append(params, fmt.Sprintf("Arg[%d] = %s", idx, p))
+		}
+	}
+	for _, p := range params {
+		spec.add(swiftText(skSpecializationParam, p))
+	}
+	return spec
+}
+
+func (st *swiftState) funcSpecParam() string {
+	payload := func(kind string) string {
+		if id := st.popKind(skIdentifier); id != nil {
+			return fmt.Sprintf("[%s : %s]", kind, id.text)
+		}
+		return kind
+	}
+	switch c := st.next(); c {
+	case 'n':
+		return ""
+	case 'c':
+		return payload("Closure Propagated")
+	case 'p':
+		switch k := st.next(); k {
+		case 'f':
+			return payload("Constant Propagated Function")
+		case 'g':
+			return payload("Constant Propagated Global")
+		case 'i', 'd':
+			var num strings.Builder
+			for isDigit(st.peek()) || st.peek() == '-' || st.peek() == '.' {
+				num.WriteByte(st.next())
+			}
+			kind := "Constant Propagated Integer"
+			if k == 'd' {
+				kind = "Constant Propagated Float"
+			}
+			return fmt.Sprintf("[%s : %s]", kind, num.String())
+		case 's':
+			enc := "u8"
+			switch st.next() {
+			case 'w':
+				enc = "u16"
+			case 'c':
+				enc = "objc"
+			}
+			if id := st.popKind(skIdentifier); id != nil {
+				return fmt.Sprintf("[Constant Propagated String : %s'%s']", enc, id.text)
+			}
+			return "Constant Propagated String"
+		case 'k':
+			return payload("Constant Propagated KeyPath")
+		default:
+			st.fail(fmt.Sprintf("unknown constant propagation %q", k))
+		}
+	case 'e':
+		return st.funcSpecParamFlags("Existential To Protocol Constrained Generic")
+	case 'd':
+		return st.funcSpecParamFlags("Dead")
+	case 'g':
+		return st.funcSpecParamFlags("Owned To Guaranteed")
+	case 'o':
+		return st.funcSpecParamFlags("Guaranteed To Owned")
+	case 'x':
+		return st.funcSpecParamFlags("Exploded")
+	case 'i':
+		return "Box To Value"
+	case 's':
+		return "Box To Stack"
+	case 'r':
+		return "InOut To Out"
+	default:
+		st.fail(fmt.Sprintf("unknown function specialization param %q", c))
+	}
+	return ""
+}
+
+func (st *swiftState) funcSpecParamFlags(kind string) string {
+	kinds := []string{kind}
+	for {
+		switch st.peek() {
+		case 'D':
+			kinds = append(kinds, "Dead")
+		case 'G':
+			kinds = append(kinds, "Owned To Guaranteed")
+		case 'O':
+			kinds = append(kinds, "Guaranteed To Owned")
+		case 'X':
+			kinds = append(kinds, "Exploded")
+		default:
+			return strings.Join(kinds, " and ")
+		}
+		st.pos++
+	}
+}
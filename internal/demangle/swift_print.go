@@ -0,0 +1,419 @@
+package demangle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// swiftNodeToString prints a demangled Swift symbol tree the way swift-demangle does.
+func swiftNodeToString(n *swiftNode) string {
+	var p swiftPrinter
+	p.print(n)
+	return p.String()
+}
+
+type swiftPrinter struct {
+	strings.Builder
+}
+
+func (p *swiftPrinter) str(n *swiftNode) string {
+	return swiftNodeToString(n)
+}
+
+func (p *swiftPrinter) join(nodes []*swiftNode, sep string) string {
+	var parts []string
+	for _, n := range nodes {
+		parts = append(parts, p.str(n))
+	}
+	return strings.Join(parts, sep)
+}
+
+// swiftGenericParamName returns the sugared name of a generic parameter (A, B, ..., A1, ...)
+func swiftGenericParamName(depth, index uint64) string {
+	var name string
+	for {
+		name = string(rune('A'+index%26)) + name
+		if index < 26 {
+			break
+		}
+		index = index/26 - 1
+	}
+	if depth > 0 {
+		name += strconv.FormatUint(depth, 10)
+	}
+	return name
+}
+
+func (p *swiftPrinter) print(n *swiftNode) {
+	if n == nil {
+		return
+	}
+
+	switch n.kind {
+	case skGlobal:
+		for _, c := range n.children {
+			p.print(c)
+		}
+	case skSuffix:
+		fmt.Fprintf(p, " with unmangled suffix %q", n.text)
+	case skType, skTypeMangling, skReturnType, skSpecializationParam:
+		if len(n.children) == 0 {
+			p.WriteString(n.text)
+		}
+		for _, c := range n.children {
+			p.print(c)
+		}
+	case skIdentifier, skModule, skBuiltinType, skOperator, skSymbolicReference, skAssociatedTypeRef, skTupleElementName:
+		p.WriteString(n.text)
+	case skIndex:
+		fmt.Fprintf(p, "%d", n.index)
+	case skClass, skStructure, skEnum, skProtocol, skTypeAlias, skOtherNominalType:
+		p.printContext(n.child(0))
+		p.print(n.child(1))
+	case skExtension:
+		fmt.Fprintf(p, "(extension in %s):%s", p.str(n.child(0)), p.str(n.child(1)))
+		if sig := n.child(2); sig != nil {
+			fmt.Fprintf(p, " %s", p.str(sig))
+		}
+	case skBoundGeneric:
+		p.printBoundGeneric(n)
+	case skTypeList:
+		p.WriteString(p.join(n.children, ", "))
+	case skTuple:
+		fmt.Fprintf(p, "(%s)", p.join(n.children, ", "))
+	case skTupleElement:
+		variadic := false
+		for _, c := range n.children {
+			switch c.kind {
+			case skVariadicMarker:
+				variadic = true
+			case skTupleElementName:
+				fmt.Fprintf(p, "%s: ", c.text)
+			default:
+				p.print(c)
+			}
+		}
+		if variadic {
+			p.WriteString("...")
+		}
+	case skFunctionType:
+		p.WriteString(p.functionType(n, nil))
+	case skArgumentTuple:
+		p.WriteString(p.params(n, nil))
+	case skTypeAttribute:
+		fmt.Fprintf(p, "%s %s", n.text, p.str(n.child(0)))
+	case skMetatype, skExistentialMetatype:
+		inner := p.str(n.child(0))
+		if isSwiftFunctionType(n.child(0)) {
+			inner = "(" + inner + ")"
+		}
+		suffix := ".Type"
+		if n.kind == skMetatype && isSwiftExistential(n.child(0)) {
+			suffix = ".Protocol"
+		}
+		p.WriteString(inner + suffix)
+	case skProtocolList:
+		if protos := n.child(0); len(protos.children) > 0 {
+			p.WriteString(p.join(protos.children, " & "))
+		} else {
+			p.WriteString("Any")
+		}
+	case skProtocolListWithClass:
+		p.print(n.child(1))
+		if protos := n.child(0).child(0); len(protos.children) > 0 {
+			fmt.Fprintf(p, " & %s", p.join(protos.children, " & "))
+		}
+	case skProtocolListWithAnyObject:
+		if protos := n.child(0).child(0); len(protos.children) > 0 {
+			fmt.Fprintf(p, "%s & ", p.join(protos.children, " & "))
+		}
+		p.WriteString("AnyObject")
+	case skGenericParam:
+		depth, _ := strconv.ParseUint(n.text, 10, 64)
+		p.WriteString(swiftGenericParamName(depth, n.index))
+	case skDependentMemberType:
+		fmt.Fprintf(p, "%s.%s", p.str(n.child(0)), p.str(n.child(1)))
+	case skDependentGenericType:
+		fmt.Fprintf(p, "%s %s", p.str(n.child(0)), p.str(n.child(1)))
+	case skGenericSignature:
+		p.printGenericSignature(n)
+	case skConformanceRequirement:
+		fmt.Fprintf(p, "%s: %s", p.str(n.child(0)), p.str(n.child(1)))
+	case skSameTypeRequirement:
+		fmt.Fprintf(p, "%s == %s", p.str(n.child(0)), p.str(n.child(1)))
+	case skLayoutRequirement:
+		fmt.Fprintf(p, "%s: %s", p.str(n.child(0)), n.text)
+	case skOpaqueReturnTypeOf:
+		fmt.Fprintf(p, "<<opaque return type of %s>>", p.str(n.child(0)))
+	case skOpaqueType:
+		if len(n.children) > 0 {
+			p.print(n.child(0))
+		} else {
+			p.WriteString(n.text)
+		}
+	case skDynamicSelf:
+		p.WriteString("Self")
+	case skLocalDeclName:
+		fmt.Fprintf(p, "%s #%d", p.str(n.child(1)), n.child(0).index+1)
+	case skPrivateDeclName:
+		if len(n.children) > 1 {
+			fmt.Fprintf(p, "(%s in %s)", p.str(n.child(1)), p.str(n.child(0)))
+		} else {
+			fmt.Fprintf(p, "(in %s)", p.str(n.child(0)))
+		}
+	case skRelatedEntityDeclName:
+		fmt.Fprintf(p, "related decl '%s' for %s", n.text, p.str(n.child(0)))
+	case skProtocolConformance:
+		fmt.Fprintf(p, "%s : %s", p.str(n.child(0)), p.str(n.child(1)))
+		if mod := n.child(2); mod != nil {
+			fmt.Fprintf(p, " in %s", p.str(mod))
+		}
+	case skDescriptor:
+		fmt.Fprintf(p, "%s %s", n.text, p.str(n.child(0)))
+	case skDescriptor2:
+		var args []interface{}
+		for _, c := range n.children {
+			args = append(args, p.str(c))
+		}
+		fmt.Fprintf(p, n.text, args...)
+	case skFunctionAttr:
+		if len(n.children) > 0 {
+			fmt.Fprintf(p, "%s for %s", n.text, p.join(n.children, ""))
+		} else {
+			p.WriteString(n.text)
+		}
+	case skSpecialization:
+		p.WriteString(n.text)
+		if len(n.children) > 0 {
+			fmt.Fprintf(p, " <%s>", p.join(n.children, ", "))
+		}
+		p.WriteString(" of ")
+	case skStatic:
+		fmt.Fprintf(p, "static %s", p.str(n.child(0)))
+	case skInitializer:
+		fmt.Fprintf(p, "variable initialization expression of %s", p.str(n.child(0)))
+	case skDefaultArgumentInitializer:
+		fmt.Fprintf(p, "default argument %d of %s", n.child(1).index, p.str(n.child(0)))
+	case skAccessor:
+		p.printEntity(n.child(0), n.text)
+	case skFunction, skVariable, skSubscript, skConstructor, skAllocator, skDestructor, skDeallocator,
+		skIVarInitializer, skIVarDestroyer, skExplicitClosure, skImplicitClosure:
+		p.printEntity(n, "")
+	case skEmptyList, skFirstElementMarker:
+		p.WriteString("_")
+	default:
+		p.WriteString(p.join(n.children, " "))
+	}
+}
+
+// printContext prints the prefix context of a type or entity.
+func (p *swiftPrinter) printContext(ctx *swiftNode) {
+	if ctx == nil {
+		return
+	}
+	p.print(ctx)
+	p.WriteString(".")
+}
+
+func isSwiftFunctionType(n *swiftNode) bool {
+	for n != nil && n.kind == skType {
+		n = n.child(0)
+	}
+	return n != nil && n.kind == skFunctionType
+}
+
+func isSwiftExistential(n *swiftNode) bool {
+	for n != nil && n.kind == skType {
+		n = n.child(0)
+	}
+	return n != nil && (n.kind == skProtocol || n.kind == skProtocolList || n.kind == skProtocolListWithClass || n.kind == skProtocolListWithAnyObject)
+}
+
+func (p *swiftPrinter) printBoundGeneric(n *swiftNode) {
+	nominal := n.child(0).child(0)
+	args := n.child(1).children
+	if nominal.child(0) != nil && nominal.child(0).kind == skModule && nominal.child(0).text == "Swift" {
+		switch name := nominal.child(1).text; {
+		case name == "Optional" && nominal.kind == skEnum && len(args) == 1:
+			arg := p.str(args[0])
+			if isSwiftFunctionType(args[0]) {
+				arg = "(" + arg + ")"
+			}
+			p.WriteString(arg + "?")
+			return
+		case name == "Array" && len(args) == 1:
+			fmt.Fprintf(p, "[%s]", p.str(args[0]))
+			return
+		case name == "Dictionary" && len(args) == 2:
+			fmt.Fprintf(p, "[%s : %s]", p.str(args[0]), p.str(args[1]))
+			return
+		}
+	}
+	fmt.Fprintf(p, "%s<%s>", p.str(nominal), p.join(args, ", "))
+}
+
+func (p *swiftPrinter) printGenericSignature(n *swiftNode) {
+	var params []string
+	var reqs []string
+	depth := uint64(0)
+	for _, c := range n.children {
+		switch c.kind {
+		case skGenericParamCount:
+			for i := uint64(0); i < c.index; i++ {
+				params = append(params, swiftGenericParamName(depth, i))
+			}
+			depth++
+		default:
+			reqs = append(reqs, p.str(c))
+		}
+	}
+	p.WriteString("<" + strings.Join(params, ", "))
+	if len(reqs) > 0 {
+		p.WriteString(" where " + strings.Join(reqs, ", "))
+	}
+	p.WriteString(">")
+}
+
+// params prints the argument tuple of a function type with its labels.
+func (p *swiftPrinter) params(args *swiftNode, labels *swiftNode) string {
+	ty := args.child(0)
+	inner := ty.child(0)
+	if inner == nil || inner.kind != skTuple {
+		if labels != nil && len(labels.children) == 1 {
+			return "(" + swiftLabel(labels.child(0)) + p.str(ty) + ")"
+		}
+		return "(" + p.str(ty) + ")"
+	}
+	if labels == nil || len(labels.children) != len(inner.children) {
+		return p.str(inner)
+	}
+	var parts []string
+	for i, elt := range inner.children {
+		parts = append(parts, swiftLabel(labels.child(i))+p.str(elt))
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func swiftLabel(l *swiftNode) string {
+	if l.kind == skIdentifier {
+		return l.text + ": "
+	}
+	return "_: "
+}
+
+// functionType prints a function type with optional argument labels.
+func (p *swiftPrinter) functionType(fn *swiftNode, labels *swiftNode) string {
+	var sb strings.Builder
+	var async, throws bool
+	for _, c := range fn.children[2:] {
+		switch c.kind {
+		case skAsyncAnnotation:
+			async = true
+		case skThrowsAnnotation:
+			throws = true
+		case skSendableAnnotation:
+			sb.WriteString("@Sendable ")
+		case skGlobalActor:
+			fmt.Fprintf(&sb, "@%s ", p.str(c.child(0)))
+		}
+	}
+	if len(fn.text) > 0 {
+		sb.WriteString(fn.text + " ")
+	}
+	sb.WriteString(p.params(fn.child(0), labels))
+	if async {
+		sb.WriteString(" async")
+	}
+	if throws {
+		sb.WriteString(" throws")
+	}
+	sb.WriteString(" -> " + p.str(fn.child(1)))
+	return sb.String()
+}
+
+// entityType returns the generic signature and function type of an entity's type.
+func (p *swiftPrinter) entityType(typ *swiftNode, labels *swiftNode) (string, string) {
+	if typ == nil {
+		return "", ""
+	}
+	var sig string
+	t := typ.child(0)
+	if t != nil && t.kind == skDependentGenericType {
+		sig = p.str(t.child(0))
+		typ = t.child(1)
+		t = typ.child(0)
+	}
+	if t != nil && t.kind == skFunctionType {
+		return sig, p.functionType(t, labels)
+	}
+	return sig, p.str(typ)
+}
+
+// printEntity prints a (possibly accessor of a) declaration with its context and type.
+func (p *swiftPrinter) printEntity(n *swiftNode, accessor string) {
+	var name, labels, typ, extra *swiftNode
+	for _, c := range n.children[1:] {
+		switch {
+		case c.kind == skLabelList:
+			labels = c
+		case c.kind == skType:
+			typ = c
+		case c.kind == skIndex:
+			extra = c
+		case c.kind.isDeclName() && name == nil:
+			name = c
+		}
+	}
+
+	var base string
+	closure := false
+	switch n.kind {
+	case skFunction, skVariable:
+		base = p.str(name)
+	case skSubscript:
+		base = "subscript"
+	case skConstructor:
+		base = "init"
+	case skAllocator:
+		base = "__allocating_init"
+	case skDestructor:
+		base = "deinit"
+	case skDeallocator:
+		base = "__deallocating_deinit"
+	case skIVarInitializer:
+		base = "__ivar_initializer"
+	case skIVarDestroyer:
+		base = "__ivar_destroyer"
+	case skExplicitClosure:
+		base, closure = fmt.Sprintf("closure #%d", extra.index+1), true
+	case skImplicitClosure:
+		base, closure = fmt.Sprintf("implicit closure #%d", extra.index+1), true
+	}
+	if len(accessor) > 0 {
+		base += "." + accessor
+	}
+
+	ctx := n.child(0)
+	postfix := closure || ctx.kind.isLocalContext()
+	if !postfix {
+		p.printContext(ctx)
+	}
+	p.WriteString(base)
+
+	sig, ty := p.entityType(typ, labels)
+	switch {
+	case len(ty) == 0:
+	case n.kind == skVariable || len(accessor) > 0:
+		fmt.Fprintf(p, "%s : %s", sig, ty)
+	default:
+		if closure || (name != nil && name.kind != skIdentifier && name.kind != skOperator) {
+			p.WriteString(" ")
+		}
+		p.WriteString(sig + ty)
+	}
+
+	if postfix {
+		fmt.Fprintf(p, " in %s", p.str(ctx))
+	}
+}
@@ -0,0 +1,76 @@
+package demangle
+
+import (
+	"errors"
+	"testing"
+)
+
+var swiftTests = []struct {
+	mangled   string
+	demangled string
+}{
+	// Swift 5
+	{"$s4main5ThingV3fooyyF", "main.Thing.foo() -> ()"},
+	{"_$s4main3fooyyF", "main.foo() -> ()"},
+	{"$s4main3FooCACycfC", "main.Foo.__allocating_init() -> main.Foo"},
+	{"$s4main3FooCfD", "main.Foo.__deallocating_deinit"},
+	{"$sSa6appendyyxnF", "Swift.Array.append(__owned A) -> ()"},
+	{"$s4main1xSivp", "main.x : Swift.Int"},
+	{"$s4main1xSivg", "main.x.getter : Swift.Int"},
+	{"$s4main3FooC3barSSvg", "main.Foo.bar.getter : Swift.String"},
+	{"$s4main3FooCMa", "type metadata accessor for main.Foo"},
+	{"$s4main3FooCMn", "nominal type descriptor for main.Foo"},
+	{"$s4main3FooVAA1PAAMc", "protocol conformance descriptor for main.Foo : main.P in main"},
+	{"$sSiSQsWP", "protocol witness table for Swift.Int : Swift.Equatable in Swift"},
+	{"$s4main3fooyySi_SStF", "main.foo(Swift.Int, Swift.String) -> ()"},
+	{"$s4main3fooySiSgSSKF", "main.foo(Swift.String) throws -> Swift.Int?"},
+	{"$s4main3foo1aySi_tYaF", "main.foo(a: Swift.Int) async -> ()"},
+	{"$s4main3fooyxxlF", "main.foo<A>(A) -> A"},
+	{"$s4main3fooyyFyycfU_", "closure #1 () -> () in main.foo() -> ()"},
+	{"$sSS7cStringSSSPys4Int8VG_tcfC", "Swift.String.__allocating_init(cString: Swift.UnsafePointer<Swift.Int8>) -> Swift.String"},
+	{"$sSiSgD", "Swift.Int?"},
+	{"$s4main3fooyyyyXEF", "main.foo(() -> ()) -> ()"},
+	{"$s4main3fooyySiSiXEF", "main.foo((Swift.Int) -> Swift.Int) -> ()"},
+	{"$s4main3fooyyyycF", "main.foo(() -> ()) -> ()"},
+	// Swift 3 and earlier
+	{"_TF4main3fooFT_T_", "main.foo() -> ()"},
+	{"_TFV4main5Thing3foofT_T_", "main.Thing.foo() -> ()"},
+	{"_TFC3foo3bar3basfT3zimCS_3zim_T_", "foo.bar.bas(zim: foo.zim) -> ()"},
+	{"_TFC4main3FoocfT_S0_", "main.Foo.init() -> main.Foo"},
+	{"_TFC4main3FooD", "main.Foo.__deallocating_deinit"},
+	{"_TFC4main3Foog3barSS", "main.Foo.bar.getter : Swift.String"},
+	{"_TFSa6appendfxT_", "Swift.Array.append(A) -> ()"},
+	{"_TFVs5Int32CfT22_builtinIntegerLiteralBi2048__S_", "Swift.Int32.__allocating_init(_builtinIntegerLiteral: Builtin.Int2048) -> Swift.Int32"},
+	{"_TMaC4main3Foo", "type metadata accessor for main.Foo"},
+	{"_TWVC4main3Foo", "value witness table for main.Foo"},
+	{"_TTWSis9EquatablesZFS0_oi2eefTxx_Sb", "protocol witness for static Swift.Equatable.== infix(A, A) -> Swift.Bool in conformance Swift.Int : Swift.Equatable in Swift"},
+}
+
+func TestSwiftToString(t *testing.T) {
+	for _, tt := range swiftTests {
+		got, err := SwiftToString(tt.mangled)
+		if err != nil {
+			t.Errorf("SwiftToString(%q) error = %v", tt.mangled, err)
+			continue
+		}
+		if got != tt.demangled {
+			t.Errorf("SwiftToString(%q) = %q (expected %q)", tt.mangled, got, tt.demangled)
+		}
+	}
+}
+
+func TestSwiftToStringErrors(t *testing.T) {
+	for _, mangled := range []string{
+		"$sSiSgs",            // a type followed by a module
+		"$s4main3fooyyF3bar", // an identifier after the function
+		"_TFC4main3Foog",     // a getter without a name
+		"$s4main3fooyyF99",   // an identifier longer than the symbol
+	} {
+		if got, err := SwiftToString(mangled); err == nil {
+			t.Errorf("SwiftToString(%q) = %q (expected an error)", mangled, got)
+		}
+	}
+	if _, err := SwiftToString("_main"); !errors.Is(err, ErrNotSwiftMangledName) {
+		t.Errorf("SwiftToString(%q) error = %v (expected %v)", "_main", err, ErrNotSwiftMangledName)
+	}
+}
@@ -0,0 +1,229 @@
+// Package emu is a lightweight arm64 emulator that tracks the concrete values built up in registers and memory
+// (adrp/add chains, movk constants, spilled pointers, jump table loads etc.) over a function or basic block.
+//
+// It interprets the integer ALU, loads and stores against the mapped image, and branches. PAC instructions
+// are treated as strips (the value is left unchanged) and calls are stepped over (clobbering x0-x18).
+// Registers and memory the code did not define are unknown and so is anything computed from them.
+package emu
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/blacktop/go-arm64"
+)
+
+const (
+	// StackTop is the initial (known) value of the stack pointer so spills and reloads can be tracked
+	StackTop = 0x7ff0_0000_0000
+	// DefaultMaxSteps is the default maximum number of instructions Run executes
+	DefaultMaxSteps = 10000
+
+	fetchSize = 0x100 // the number of bytes decoded at a time
+)
+
+var (
+	// ErrUnknownCondition is returned by Run when a conditional branch depends on an unknown value
+	ErrUnknownCondition = errors.New("conditional branch on an unknown value")
+	// ErrMaxSteps is returned by Run when it executed Config.MaxSteps instructions
+	ErrMaxSteps = errors.New("maximum number of steps reached")
+)
+
+// Config is the emulator configuration
+type Config struct {
+	// MaxSteps is the maximum number of instructions Run executes (default is DefaultMaxSteps)
+	MaxSteps int
+	// Pointer is applied to every 64-bit value loaded from the backing memory (e.g. to slide dyld_shared_cache pointers)
+	Pointer func(ptr uint64) uint64
+}
+
+// Emulator is the state of the emulated registers and memory
+type Emulator struct {
+	cfg Config
+	mem Memory
+
+	pc    uint64
+	regs  [32]uint64 // x0-x30 and sp
+	known [32]bool
+	nzcv  uint8
+	flags bool // nzcv is known
+
+	stores map[uint64]cell
+	instrs map[uint64]*arm64.Instruction // the decoded instructions by address
+}
+
+// New returns an emulator of the code in mem
+func New(mem Memory, cfg ...*Config) *Emulator {
+	e := &Emulator{
+		cfg:    Config{MaxSteps: DefaultMaxSteps},
+		mem:    mem,
+		stores: make(map[uint64]cell),
+		instrs: make(map[uint64]*arm64.Instruction),
+	}
+	if len(cfg) > 0 && cfg[0] != nil {
+		e.cfg = *cfg[0]
+		if e.cfg.MaxSteps <= 0 {
+			e.cfg.MaxSteps = DefaultMaxSteps
+		}
+	}
+	e.Reset()
+	return e
+}
+
+// Reset clears the registers, flags and stores (the stack pointer is reset to StackTop)
+func (e *Emulator) Reset() {
+	e.regs = [32]uint64{}
+	e.known = [32]bool{}
+	e.regs[spIndex], e.known[spIndex] = StackTop, true
+	e.nzcv, e.flags = 0, false
+	e.stores = make(map[uint64]cell)
+}
+
+// Clone returns a copy of the emulator's state
+// (it shares the decoded instructions so the copies must NOT be used concurrently)
+func (e *Emulator) Clone() *Emulator {
+	c := *e
+	c.stores = make(map[uint64]cell, len(e.stores))
+	for addr, v := range e.stores {
+		c.stores[addr] = v
+	}
+	return &c
+}
+
+// PC returns the address of the next instruction
+func (e *Emulator) PC() uint64 { return e.pc }
+
+// SetPC sets the address of the next instruction
+func (e *Emulator) SetPC(pc uint64) { e.pc = pc }
+
+const (
+	spIndex = 31
+	zrIndex = 32
+)
+
+// regIndex returns the index of a general purpose register (x0-x30, sp or the zero register) and its size in bits
+func regIndex(reg arm64.Register) (int, uint, bool) {
+	switch {
+	case reg >= arm64.REG_W0 && reg <= arm64.REG_W30:
+		return int(reg - arm64.REG_W0), 32, true
+	case reg == arm64.REG_WZR:
+		return zrIndex, 32, true
+	case reg == arm64.REG_WSP:
+		return spIndex, 32, true
+	case reg >= arm64.REG_X0 && reg <= arm64.REG_X30:
+		return int(reg - arm64.REG_X0), 64, true
+	case reg == arm64.REG_XZR:
+		return zrIndex, 64, true
+	case reg == arm64.REG_SP:
+		return spIndex, 64, true
+	}
+	return 0, 0, false
+}
+
+// Reg returns the value of a general purpose register and whether it is known
+func (e *Emulator) Reg(reg arm64.Register) (uint64, bool) {
+	idx, size, ok := regIndex(reg)
+	if !ok {
+		return 0, false
+	}
+	if idx == zrIndex {
+		return 0, true
+	}
+	return truncate(e.regs[idx], size), e.known[idx]
+}
+
+// SetReg sets a general purpose register (writes to w registers zero the top 32 bits)
+func (e *Emulator) SetReg(reg arm64.Register, value uint64) {
+	e.setReg(reg, value, true)
+}
+
+// ClobberReg marks a general purpose register as unknown
+func (e *Emulator) ClobberReg(reg arm64.Register) {
+	e.setReg(reg, 0, false)
+}
+
+func (e *Emulator) setReg(reg arm64.Register, value uint64, known bool) {
+	idx, size, ok := regIndex(reg)
+	if !ok || idx == zrIndex {
+		return
+	}
+	e.regs[idx], e.known[idx] = truncate(value, size), known
+}
+
+// fetch returns the decoded instruction at addr
+func (e *Emulator) fetch(addr uint64) (*arm64.Instruction, error) {
+	if i, ok := e.instrs[addr]; ok {
+		return i, nil
+	}
+
+	data := make([]byte, fetchSize)
+	n, err := e.mem.ReadAtAddr(data, addr)
+	if n < 4 {
+		if err == nil {
+			err = fmt.Errorf("short read")
+		}
+		return nil, fmt.Errorf("failed to read instruction at %#x: %v", addr, err)
+	}
+
+	for r := range arm64.Disassemble(bytes.NewReader(data[:n&^3]), arm64.Options{StartAddress: int64(addr)}) {
+		if r.Error == nil && r.Instruction != nil {
+			e.instrs[r.Instruction.Address()] = r.Instruction
+		}
+	}
+
+	if i, ok := e.instrs[addr]; ok {
+		return i, nil
+	}
+	return nil, fmt.Errorf("failed to decode instruction at %#x", addr)
+}
+
+// Step executes the instruction at the PC and returns it
+func (e *Emulator) Step() (*arm64.Instruction, error) {
+	i, err := e.fetch(e.pc)
+	if err != nil {
+		return nil, err
+	}
+	return i, e.Execute(i)
+}
+
+// Run executes from start until the PC reaches end (if non-zero) or leaves the code at a return, an indirect
+// branch or an exception. The PC is then left at that instruction so its target register can be read.
+func (e *Emulator) Run(start, end uint64) error {
+	e.pc = start
+	for steps := 0; steps < e.cfg.MaxSteps; steps++ {
+		if end != 0 && e.pc == end {
+			return nil
+		}
+		i, err := e.fetch(e.pc)
+		if err != nil {
+			return err
+		}
+		if exits(i.Operation()) {
+			return nil
+		}
+		if err := e.Execute(i); err != nil {
+			return err
+		}
+	}
+	return ErrMaxSteps
+}
+
+// exits returns true if the instruction leaves the code being emulated
+func exits(op arm64.Operation) bool {
+	switch op {
+	case arm64.ARM64_RET, arm64.ARM64_RETAA, arm64.ARM64_RETAB,
+		arm64.ARM64_BR, arm64.ARM64_BRAA, arm64.ARM64_BRAAZ, arm64.ARM64_BRAB, arm64.ARM64_BRABZ,
+		arm64.ARM64_ERET, arm64.ARM64_ERETAA, arm64.ARM64_ERETAB,
+		arm64.ARM64_BRK, arm64.ARM64_HLT, arm64.ARM64_SVC, arm64.ARM64_HVC, arm64.ARM64_SMC:
+		return true
+	}
+	return false
+}
+
+func truncate(value uint64, size uint) uint64 {
+	if size == 32 {
+		return value & 0xffffffff
+	}
+	return value
+}
@@ -0,0 +1,214 @@
+package emu
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/blacktop/go-arm64"
+)
+
+const codeAddr = 0x1000
+
+// testMemory is a byte slice mapped at codeAddr
+type testMemory []byte
+
+func (m testMemory) ReadAtAddr(buf []byte, addr uint64) (int, error) {
+	if addr < codeAddr || addr-codeAddr >= uint64(len(m)) {
+		return 0, fmt.Errorf("address %#x is NOT mapped", addr)
+	}
+	return copy(buf, m[addr-codeAddr:]), nil
+}
+
+// assemble returns the memory of the instruction words (followed by data) mapped at codeAddr
+func assemble(words []uint32, data ...byte) testMemory {
+	m := make(testMemory, 4*len(words), 4*len(words)+len(data))
+	for idx, w := range words {
+		binary.LittleEndian.PutUint32(m[4*idx:], w)
+	}
+	return append(m, data...)
+}
+
+func end(words []uint32) uint64 {
+	return codeAddr + 4*uint64(len(words))
+}
+
+func TestConstants(t *testing.T) {
+	words := []uint32{
+		0xd2a24680, // movz x0, #0x1234, lsl #16
+		0xf28acf00, // movk x0, #0x5678
+		0xf2fbd5a0, // movk x0, #0xdead, lsl #48
+		0xb200f3e1, // mov  x1, #0x5555555555555555 (orr x1, xzr, #0x5555555555555555)
+		0x321c6fe2, // mov  w2, #0xfffffff0 (orr w2, wzr, #0xfffffff0)
+		0x12800003, // mov  w3, #0xffffffff (movn w3, #0)
+	}
+	e := New(assemble(words))
+	if err := e.Run(codeAddr, end(words)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		reg  arm64.Register
+		want uint64
+	}{
+		{arm64.REG_X0, 0xdead000012345678},
+		{arm64.REG_X1, 0x5555555555555555},
+		{arm64.REG_X2, 0xfffffff0},
+		{arm64.REG_X3, 0xffffffff},
+	} {
+		if got, ok := e.Reg(tt.reg); !ok || got != tt.want {
+			t.Errorf("%s = %#x (known: %t) (expected %#x)", tt.reg, got, ok, tt.want)
+		}
+	}
+}
+
+func TestAdrpAdd(t *testing.T) {
+	words := []uint32{
+		0xd0000009, // adrp x9, 0x3000
+		0x91004129, // add  x9, x9, #0x10
+		0xf940052a, // ldr  x10, [x9, #0x8]
+		0x8b0a012b, // add  x11, x9, x10
+	}
+	e := New(assemble(words))
+	if err := e.Run(codeAddr, end(words)); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := e.Reg(arm64.REG_X9); !ok || got != 0x3010 {
+		t.Errorf("x9 = %#x (known: %t) (expected 0x3010)", got, ok)
+	}
+	// nothing is mapped at 0x3018 so the load and everything computed from it are unknown
+	if _, ok := e.Reg(arm64.REG_X10); ok {
+		t.Errorf("x10 is known (expected unknown)")
+	}
+	if _, ok := e.Reg(arm64.REG_X11); ok {
+		t.Errorf("x11 is known (expected unknown)")
+	}
+}
+
+func TestSpillReload(t *testing.T) {
+	words := []uint32{
+		0xd10083ff, // sub  sp, sp, #0x20
+		0xd2802469, // mov  x9, #0x123
+		0xf9000be9, // str  x9, [sp, #0x10]
+		0xa90027e0, // stp  x0, x9, [sp]
+		0xd2800009, // mov  x9, #0
+		0xf9400bea, // ldr  x10, [sp, #0x10]
+		0xa9402fe1, // ldp  x1, x11, [sp]
+		0x910083ff, // add  sp, sp, #0x20
+	}
+	e := New(assemble(words))
+	if err := e.Run(codeAddr, end(words)); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := e.Reg(arm64.REG_X10); !ok || got != 0x123 {
+		t.Errorf("x10 = %#x (known: %t) (expected 0x123)", got, ok)
+	}
+	if got, ok := e.Reg(arm64.REG_X11); !ok || got != 0x123 {
+		t.Errorf("x11 = %#x (known: %t) (expected 0x123)", got, ok)
+	}
+	// x0 was never defined so neither is its reload
+	if _, ok := e.Reg(arm64.REG_X1); ok {
+		t.Errorf("x1 is known (expected unknown)")
+	}
+	if got, ok := e.Reg(arm64.REG_SP); !ok || got != StackTop {
+		t.Errorf("sp = %#x (known: %t) (expected %#x)", got, ok, uint64(StackTop))
+	}
+}
+
+func TestConditionalBranch(t *testing.T) {
+	words := []uint32{
+		0x71000c1f, // 0x1000: cmp  w0, #3
+		0x54000068, // 0x1004: b.hi 0x1010
+		0x52800021, // 0x1008: mov  w1, #1
+		0xd65f03c0, // 0x100c: ret
+		0x52800041, // 0x1010: mov  w1, #2
+		0xd65f03c0, // 0x1014: ret
+	}
+	for _, tt := range []struct {
+		x0   uint64
+		want uint64
+	}{
+		{0, 1},
+		{3, 1},
+		{4, 2},
+		{0xffffffff, 2},  // the comparison is unsigned
+		{0x100000000, 1}, // and only of the low 32 bits
+	} {
+		e := New(assemble(words))
+		e.SetReg(arm64.REG_X0, tt.x0)
+		if err := e.Run(codeAddr, 0); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := e.Reg(arm64.REG_W1); !ok || got != tt.want {
+			t.Errorf("x0 = %#x: w1 = %#x (known: %t) (expected %#x)", tt.x0, got, ok, tt.want)
+		}
+	}
+
+	if err := New(assemble(words)).Run(codeAddr, 0); !errors.Is(err, ErrUnknownCondition) {
+		t.Errorf("Run() with an unknown x0 error = %v (expected %v)", err, ErrUnknownCondition)
+	}
+}
+
+func TestJumpTable(t *testing.T) {
+	words := []uint32{
+		0x71000d1f, // 0x1000: cmp  w8, #3
+		0x54000168, // 0x1004: b.hi 0x1030
+		0x90000009, // 0x1008: adrp x9, 0x1000
+		0x91010129, // 0x100c: add  x9, x9, #0x40
+		0x1000008a, // 0x1010: adr  x10, 0x1020
+		0x3868692b, // 0x1014: ldrb w11, [x9, x8]
+		0x8b0b094a, // 0x1018: add  x10, x10, x11, lsl #2
+		0xd61f0140, // 0x101c: br   x10
+		0x52800020, // 0x1020: mov  w0, #1
+		0xd65f03c0, // 0x1024: ret
+		0x52800040, // 0x1028: mov  w0, #2
+		0x52800060, // 0x102c: mov  w0, #3
+		0xd65f03c0, // 0x1030: ret
+		0xd503201f, // 0x1034: nop
+		0xd503201f, // 0x1038: nop
+		0xd503201f, // 0x103c: nop
+	}
+	mem := assemble(words, 0, 2, 0, 3) // the table at 0x1040
+
+	want := &JumpTable{
+		Branch:  0x101c,
+		Table:   0x1040,
+		Default: 0x1030,
+		Targets: []uint64{0x1020, 0x1028, 0x1020, 0x102c},
+	}
+	jt, err := JumpTableAt(mem, 0x101c, codeAddr, codeAddr+0x40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(jt, want) {
+		t.Errorf("JumpTableAt() = %+v (expected %+v)", jt, want)
+	}
+
+	jts := FindJumpTables(mem, mem[:4*len(words)], codeAddr, codeAddr, codeAddr+0x40)
+	if len(jts) != 1 || !reflect.DeepEqual(jts.At(0x101c), want) {
+		t.Fatalf("FindJumpTables() = %v (expected [%v])", jts, want)
+	}
+	for _, tt := range []struct {
+		addr  uint64
+		label string
+	}{
+		{0x1020, "case 0, 2"},
+		{0x1028, "case 1"},
+		{0x102c, "case 3"},
+		{0x1030, "default"},
+		{0x1024, ""},
+	} {
+		if got := jts.Label(tt.addr); got != tt.label {
+			t.Errorf("Label(%#x) = %q (expected %q)", tt.addr, got, tt.label)
+		}
+	}
+	if got := jt.UniqueTargets(); !reflect.DeepEqual(got, []uint64{0x1020, 0x1028, 0x102c}) {
+		t.Errorf("UniqueTargets() = %#x", got)
+	}
+
+	// the cases must stay inside the function
+	if _, err := JumpTableAt(mem, 0x101c, codeAddr, 0x1028); err == nil {
+		t.Errorf("JumpTableAt() with a case target out of range succeeded")
+	}
+}
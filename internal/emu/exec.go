@@ -0,0 +1,672 @@
+package emu
+
+import (
+	"math/bits"
+
+	"github.com/blacktop/go-arm64"
+)
+
+const (
+	flagN = 1 << 3
+	flagZ = 1 << 2
+	flagC = 1 << 1
+	flagV = 1 << 0
+)
+
+// branchConditions are the condition codes of the conditional branches
+var branchConditions = map[arm64.Operation]arm64.Condition{
+	arm64.ARM64_B_EQ: arm64.COND_EQ,
+	arm64.ARM64_B_NE: arm64.COND_NE,
+	arm64.ARM64_B_CS: arm64.COND_CS,
+	arm64.ARM64_B_HS: arm64.COND_CS,
+	arm64.ARM64_B_CC: arm64.COND_CC,
+	arm64.ARM64_B_LO: arm64.COND_CC,
+	arm64.ARM64_B_MI: arm64.COND_MI,
+	arm64.ARM64_B_PL: arm64.COND_PL,
+	arm64.ARM64_B_VS: arm64.COND_VS,
+	arm64.ARM64_B_VC: arm64.COND_VC,
+	arm64.ARM64_B_HI: arm64.COND_HI,
+	arm64.ARM64_B_LS: arm64.COND_LS,
+	arm64.ARM64_B_GE: arm64.COND_GE,
+	arm64.ARM64_B_LT: arm64.COND_LT,
+	arm64.ARM64_B_GT: arm64.COND_GT,
+	arm64.ARM64_B_LE: arm64.COND_LE,
+	arm64.ARM64_B_AL: arm64.COND_AL,
+	arm64.ARM64_B_NV: arm64.COND_NV,
+}
+
+// Execute executes a decoded instruction and advances the PC
+func (e *Emulator) Execute(i *arm64.Instruction) error {
+	ops := i.Operands()
+	e.pc = i.Address() + 4
+
+	switch op := i.Operation(); op {
+	case arm64.ARM64_NOP, arm64.ARM64_HINT, arm64.ARM64_BTI, arm64.ARM64_DMB, arm64.ARM64_DSB, arm64.ARM64_ISB,
+		arm64.ARM64_PACIASP, arm64.ARM64_PACIBSP, arm64.ARM64_PACIAZ, arm64.ARM64_PACIBZ,
+		arm64.ARM64_PACIA1716, arm64.ARM64_PACIB1716, arm64.ARM64_AUTIASP, arm64.ARM64_AUTIBSP,
+		arm64.ARM64_AUTIAZ, arm64.ARM64_AUTIBZ, arm64.ARM64_AUTIA1716, arm64.ARM64_AUTIB1716, arm64.ARM64_XPACLRI,
+		arm64.ARM64_PACIA, arm64.ARM64_PACIB, arm64.ARM64_PACDA, arm64.ARM64_PACDB,
+		arm64.ARM64_PACIZA, arm64.ARM64_PACIZB, arm64.ARM64_PACDZA, arm64.ARM64_PACDZB,
+		arm64.ARM64_AUTIA, arm64.ARM64_AUTIB, arm64.ARM64_AUTDA, arm64.ARM64_AUTDB,
+		arm64.ARM64_AUTIZA, arm64.ARM64_AUTIZB, arm64.ARM64_AUTDZA, arm64.ARM64_AUTDZB,
+		arm64.ARM64_XPACI, arm64.ARM64_XPACD:
+		// signing and authenticating are treated as strips (the pointer's value is left unchanged)
+		return nil
+
+	case arm64.ARM64_MOV:
+		size := e.size(ops[0])
+		v, ok := e.value(ops[1], size)
+		e.write(ops[0], v, ok)
+	case arm64.ARM64_MOVZ, arm64.ARM64_MOVN:
+		v, _ := e.value(ops[1], e.size(ops[0]))
+		if op == arm64.ARM64_MOVN {
+			v = ^v
+		}
+		e.write(ops[0], v, true)
+	case arm64.ARM64_MOVK:
+		dst, ok := e.value(ops[0], 64)
+		shift := uint(0)
+		if ops[1].ShiftValueUsed {
+			shift = uint(ops[1].ShiftValue)
+		}
+		e.write(ops[0], dst&^(0xffff<<shift)|(ops[1].Immediate&0xffff)<<shift, ok)
+	case arm64.ARM64_ADR, arm64.ARM64_ADRP:
+		e.write(ops[0], ops[1].Immediate, true)
+
+	case arm64.ARM64_ADD, arm64.ARM64_ADDS, arm64.ARM64_SUB, arm64.ARM64_SUBS:
+		size := e.size(ops[0])
+		a, aok := e.value(ops[1], size)
+		b, bok := e.value(ops[2], size)
+		sub := op == arm64.ARM64_SUB || op == arm64.ARM64_SUBS
+		res := e.addWithFlags(a, b, sub, size, aok && bok, op == arm64.ARM64_ADDS || op == arm64.ARM64_SUBS)
+		e.write(ops[0], res, aok && bok)
+	case arm64.ARM64_CMP, arm64.ARM64_CMN:
+		size := e.size(ops[0])
+		a, aok := e.value(ops[0], size)
+		b, bok := e.value(ops[1], size)
+		e.addWithFlags(a, b, op == arm64.ARM64_CMP, size, aok && bok, true)
+	case arm64.ARM64_NEG, arm64.ARM64_NEGS:
+		size := e.size(ops[0])
+		b, ok := e.value(ops[1], size)
+		e.write(ops[0], e.addWithFlags(0, b, true, size, ok, op == arm64.ARM64_NEGS), ok)
+	case arm64.ARM64_MVN:
+		size := e.size(ops[0])
+		b, ok := e.value(ops[1], size)
+		e.write(ops[0], ^b, ok)
+
+	case arm64.ARM64_AND, arm64.ARM64_ANDS, arm64.ARM64_ORR, arm64.ARM64_EOR, arm64.ARM64_BIC, arm64.ARM64_BICS,
+		arm64.ARM64_ORN, arm64.ARM64_EON, arm64.ARM64_LSL, arm64.ARM64_LSR, arm64.ARM64_ASR, arm64.ARM64_ROR,
+		arm64.ARM64_MUL, arm64.ARM64_MNEG, arm64.ARM64_UDIV, arm64.ARM64_SDIV:
+		if len(ops) < 3 {
+			return e.clobber(ops)
+		}
+		size := e.size(ops[0])
+		a, aok := e.value(ops[1], size)
+		b, bok := e.value(ops[2], size)
+		res := binop(op, a, b, size)
+		if op == arm64.ARM64_ANDS || op == arm64.ARM64_BICS {
+			e.setLogicalFlags(res, size, aok && bok)
+		}
+		e.write(ops[0], res, aok && bok)
+	case arm64.ARM64_TST:
+		size := e.size(ops[0])
+		a, aok := e.value(ops[0], size)
+		b, bok := e.value(ops[1], size)
+		e.setLogicalFlags(a&b, size, aok && bok)
+	case arm64.ARM64_MADD, arm64.ARM64_MSUB:
+		size := e.size(ops[0])
+		a, aok := e.value(ops[1], size)
+		b, bok := e.value(ops[2], size)
+		c, cok := e.value(ops[3], size)
+		res := c + a*b
+		if op == arm64.ARM64_MSUB {
+			res = c - a*b
+		}
+		e.write(ops[0], res, aok && bok && cok)
+
+	case arm64.ARM64_SXTB, arm64.ARM64_SXTH, arm64.ARM64_SXTW, arm64.ARM64_UXTB, arm64.ARM64_UXTH:
+		size := e.size(ops[0])
+		v, ok := e.value(ops[1], 64)
+		switch op {
+		case arm64.ARM64_SXTB:
+			v = signExtend(v, 8)
+		case arm64.ARM64_SXTH:
+			v = signExtend(v, 16)
+		case arm64.ARM64_SXTW:
+			v = signExtend(v, 32)
+		case arm64.ARM64_UXTB:
+			v &= 0xff
+		case arm64.ARM64_UXTH:
+			v &= 0xffff
+		}
+		e.write(ops[0], truncate(v, size), ok)
+	case arm64.ARM64_UBFX, arm64.ARM64_SBFX, arm64.ARM64_UBFIZ, arm64.ARM64_SBFIZ, arm64.ARM64_BFI, arm64.ARM64_BFXIL,
+		arm64.ARM64_UBFM, arm64.ARM64_SBFM, arm64.ARM64_BFM:
+		return e.bitfield(op, ops)
+	case arm64.ARM64_EXTR:
+		size := e.size(ops[0])
+		a, aok := e.value(ops[1], size)
+		b, bok := e.value(ops[2], size)
+		lsb := uint(ops[3].Immediate)
+		res := truncate(b, size) >> lsb
+		if lsb > 0 {
+			res |= a << (size - lsb)
+		}
+		e.write(ops[0], res, aok && bok)
+
+	case arm64.ARM64_CSEL, arm64.ARM64_CSINC, arm64.ARM64_CSINV, arm64.ARM64_CSNEG:
+		size := e.size(ops[0])
+		a, aok := e.value(ops[1], size)
+		b, bok := e.value(ops[2], size)
+		cond, cok := e.condition(arm64.Condition(ops[3].Reg[0]))
+		if !cok {
+			e.write(ops[0], 0, false)
+			break
+		}
+		if cond {
+			e.write(ops[0], a, aok)
+			break
+		}
+		switch op {
+		case arm64.ARM64_CSINC:
+			b++
+		case arm64.ARM64_CSINV:
+			b = ^b
+		case arm64.ARM64_CSNEG:
+			b = -b
+		}
+		e.write(ops[0], b, bok)
+	case arm64.ARM64_CSET, arm64.ARM64_CSETM:
+		cond, ok := e.condition(arm64.Condition(ops[1].Reg[0]))
+		var v uint64
+		if cond {
+			v = 1
+			if op == arm64.ARM64_CSETM {
+				v = ^uint64(0)
+			}
+		}
+		e.write(ops[0], v, ok)
+	case arm64.ARM64_CINC, arm64.ARM64_CINV, arm64.ARM64_CNEG:
+		size := e.size(ops[0])
+		a, aok := e.value(ops[1], size)
+		cond, cok := e.condition(arm64.Condition(ops[2].Reg[0]))
+		if cond {
+			switch op {
+			case arm64.ARM64_CINC:
+				a++
+			case arm64.ARM64_CINV:
+				a = ^a
+			case arm64.ARM64_CNEG:
+				a = -a
+			}
+		}
+		e.write(ops[0], a, aok && cok)
+
+	case arm64.ARM64_LDR, arm64.ARM64_LDUR, arm64.ARM64_LDAR, arm64.ARM64_LDAPR, arm64.ARM64_LDXR, arm64.ARM64_LDTR,
+		arm64.ARM64_LDRAA, arm64.ARM64_LDRAB:
+		e.load1(ops, e.regBytes(ops[0]), false)
+	case arm64.ARM64_LDRB, arm64.ARM64_LDURB, arm64.ARM64_LDARB:
+		e.load1(ops, 1, false)
+	case arm64.ARM64_LDRH, arm64.ARM64_LDURH, arm64.ARM64_LDARH:
+		e.load1(ops, 2, false)
+	case arm64.ARM64_LDRSB, arm64.ARM64_LDURSB:
+		e.load1(ops, 1, true)
+	case arm64.ARM64_LDRSH, arm64.ARM64_LDURSH:
+		e.load1(ops, 2, true)
+	case arm64.ARM64_LDRSW, arm64.ARM64_LDURSW:
+		e.load1(ops, 4, true)
+	case arm64.ARM64_LDP, arm64.ARM64_LDNP, arm64.ARM64_LDPSW:
+		e.load2(ops, op == arm64.ARM64_LDPSW)
+	case arm64.ARM64_STR, arm64.ARM64_STUR, arm64.ARM64_STLR, arm64.ARM64_STTR:
+		e.store1(ops, e.regBytes(ops[0]))
+	case arm64.ARM64_STRB, arm64.ARM64_STURB, arm64.ARM64_STLRB:
+		e.store1(ops, 1)
+	case arm64.ARM64_STRH, arm64.ARM64_STURH, arm64.ARM64_STLRH:
+		e.store1(ops, 2)
+	case arm64.ARM64_STP, arm64.ARM64_STNP:
+		e.store2(ops)
+
+	case arm64.ARM64_B:
+		e.pc = ops[0].Immediate
+	case arm64.ARM64_BL, arm64.ARM64_BLR, arm64.ARM64_BLRAA, arm64.ARM64_BLRAAZ, arm64.ARM64_BLRAB, arm64.ARM64_BLRABZ:
+		// step over the call clobbering the caller-saved registers and flags
+		for reg := arm64.REG_X0; reg <= arm64.REG_X18; reg++ {
+			e.ClobberReg(reg)
+		}
+		e.SetReg(arm64.REG_X30, e.pc)
+		e.flags = false
+	case arm64.ARM64_CBZ, arm64.ARM64_CBNZ:
+		v, ok := e.value(ops[0], e.size(ops[0]))
+		if !ok {
+			return e.unknownCondition(i)
+		}
+		if (v == 0) == (op == arm64.ARM64_CBZ) {
+			e.pc = ops[1].Immediate
+		}
+	case arm64.ARM64_TBZ, arm64.ARM64_TBNZ:
+		v, ok := e.value(ops[0], e.size(ops[0]))
+		if !ok {
+			return e.unknownCondition(i)
+		}
+		if (v>>ops[1].Immediate&1 == 0) == (op == arm64.ARM64_TBZ) {
+			e.pc = ops[2].Immediate
+		}
+	default:
+		if cc, ok := branchConditions[op]; ok {
+			cond, ok := e.condition(cc)
+			if !ok {
+				return e.unknownCondition(i)
+			}
+			if cond {
+				e.pc = ops[0].Immediate
+			}
+			break
+		}
+		return e.clobber(ops)
+	}
+
+	return nil
+}
+
+// unknownCondition leaves the PC at the conditional branch
+func (e *Emulator) unknownCondition(i *arm64.Instruction) error {
+	e.pc = i.Address()
+	return ErrUnknownCondition
+}
+
+// clobber marks the destination of an unsupported instruction (and the flags) as unknown
+func (e *Emulator) clobber(ops []arm64.InstructionOperand) error {
+	if len(ops) > 0 && ops[0].OpClass == arm64.REG {
+		e.write(ops[0], 0, false)
+	}
+	e.flags = false
+	return nil
+}
+
+// size returns the size in bits of a register operand
+func (e *Emulator) size(op arm64.InstructionOperand) uint {
+	if _, size, ok := regIndex(arm64.Register(op.Reg[0])); ok {
+		return size
+	}
+	return 64
+}
+
+// regBytes returns the size in bytes of a general purpose or SIMD&FP register operand
+func (e *Emulator) regBytes(op arm64.InstructionOperand) int {
+	reg := arm64.Register(op.Reg[0])
+	if _, size, ok := regIndex(reg); ok {
+		return int(size / 8)
+	}
+	switch {
+	case reg >= arm64.REG_B0 && reg < arm64.REG_H0:
+		return 1
+	case reg >= arm64.REG_H0 && reg < arm64.REG_S0:
+		return 2
+	case reg >= arm64.REG_S0 && reg < arm64.REG_D0:
+		return 4
+	case reg >= arm64.REG_D0 && reg < arm64.REG_Q0:
+		return 8
+	}
+	return 16
+}
+
+// value returns the value of a source operand (shifted or extended) and whether it is known
+func (e *Emulator) value(op arm64.InstructionOperand, size uint) (uint64, bool) {
+	switch op.OpClass {
+	case arm64.IMM32, arm64.IMM64:
+		v := op.Immediate
+		if op.ShiftValueUsed && op.ShiftType == arm64.SHIFT_LSL {
+			v <<= op.ShiftValue
+		}
+		return truncate(v, size), true
+	case arm64.LABEL:
+		return op.Immediate, true
+	case arm64.REG:
+		reg := arm64.Register(op.Reg[0])
+		v, ok := e.Reg(reg)
+		if !ok {
+			return 0, false
+		}
+		_, rsize, _ := regIndex(reg)
+		return truncate(shiftExtend(v, rsize, op.ShiftType, uint(op.ShiftValue)), size), true
+	}
+	return 0, false
+}
+
+// write sets the destination register operand
+func (e *Emulator) write(op arm64.InstructionOperand, value uint64, known bool) {
+	if op.OpClass == arm64.REG {
+		e.setReg(arm64.Register(op.Reg[0]), value, known)
+	}
+}
+
+// address returns the address of a memory operand and writes back its base register
+func (e *Emulator) address(op arm64.InstructionOperand) (uint64, bool) {
+	switch op.OpClass {
+	case arm64.LABEL:
+		return op.Immediate, true
+	case arm64.MEM_REG, arm64.MEM_OFFSET, arm64.MEM_PRE_IDX, arm64.MEM_POST_IDX:
+		base := arm64.Register(op.Reg[0])
+		addr, ok := e.Reg(base)
+		if op.OpClass == arm64.MEM_REG {
+			return addr, ok
+		}
+		next := addr + op.Immediate
+		if op.OpClass == arm64.MEM_OFFSET {
+			return next, ok
+		}
+		e.setReg(base, next, ok)
+		if op.OpClass == arm64.MEM_PRE_IDX {
+			return next, ok
+		}
+		return addr, ok
+	case arm64.MEM_EXTENDED:
+		addr, ok := e.Reg(arm64.Register(op.Reg[0]))
+		index := arm64.Register(op.Reg[1])
+		v, iok := e.Reg(index)
+		_, isize, _ := regIndex(index)
+		amount := uint(0)
+		if op.ShiftValueUsed {
+			amount = uint(op.ShiftValue)
+		}
+		return addr + shiftExtend(v, isize, op.ShiftType, amount), ok && iok
+	}
+	return 0, false
+}
+
+// load1 loads a single register
+func (e *Emulator) load1(ops []arm64.InstructionOperand, size int, signed bool) {
+	if len(ops) < 2 {
+		e.clobber(ops)
+		return
+	}
+	addr, ok := e.address(ops[1])
+	var v uint64
+	if ok {
+		v, ok = e.load(addr, size)
+	}
+	if signed {
+		v = signExtend(v, uint(size*8))
+	}
+	e.write(ops[0], v, ok)
+}
+
+// load2 loads a pair of registers
+func (e *Emulator) load2(ops []arm64.InstructionOperand, signed bool) {
+	if len(ops) < 3 {
+		e.clobber(ops)
+		return
+	}
+	size := e.regBytes(ops[0])
+	if signed {
+		size = 4
+	}
+	addr, ok := e.address(ops[2])
+	for idx := 0; idx < 2; idx++ {
+		var v uint64
+		vok := ok
+		if ok {
+			v, vok = e.load(addr+uint64(idx*size), size)
+		}
+		if signed {
+			v = signExtend(v, 32)
+		}
+		e.write(ops[idx], v, vok)
+	}
+}
+
+// store1 stores a single register
+func (e *Emulator) store1(ops []arm64.InstructionOperand, size int) {
+	if len(ops) < 2 {
+		return
+	}
+	addr, ok := e.address(ops[1])
+	v, vok := e.value(ops[0], 64)
+	if ok {
+		e.store(addr, size, v, vok)
+	}
+}
+
+// store2 stores a pair of registers
+func (e *Emulator) store2(ops []arm64.InstructionOperand) {
+	if len(ops) < 3 {
+		return
+	}
+	size := e.regBytes(ops[0])
+	addr, ok := e.address(ops[2])
+	if !ok {
+		return
+	}
+	for idx := 0; idx < 2; idx++ {
+		v, vok := e.value(ops[idx], 64)
+		e.store(addr+uint64(idx*size), size, v, vok)
+	}
+}
+
+// bitfield executes the bitfield moves and their aliases
+func (e *Emulator) bitfield(op arm64.Operation, ops []arm64.InstructionOperand) error {
+	if len(ops) < 4 {
+		return e.clobber(ops)
+	}
+	size := e.size(ops[0])
+	src, ok := e.value(ops[1], size)
+	a, b := uint(ops[2].Immediate), uint(ops[3].Immediate)
+
+	// convert the raw bitfield moves to their extract/insert aliases
+	switch op {
+	case arm64.ARM64_UBFM, arm64.ARM64_SBFM, arm64.ARM64_BFM:
+		extract := b >= a
+		if extract {
+			b = b - a + 1
+		} else {
+			a, b = size-a, b+1
+		}
+		switch {
+		case op == arm64.ARM64_UBFM && extract:
+			op = arm64.ARM64_UBFX
+		case op == arm64.ARM64_UBFM:
+			op = arm64.ARM64_UBFIZ
+		case op == arm64.ARM64_SBFM && extract:
+			op = arm64.ARM64_SBFX
+		case op == arm64.ARM64_SBFM:
+			op = arm64.ARM64_SBFIZ
+		case extract:
+			op = arm64.ARM64_BFXIL
+		default:
+			op = arm64.ARM64_BFI
+		}
+	}
+
+	lsb, width := a, b
+	mask := uint64(1)<<width - 1
+	if width >= 64 {
+		mask = ^uint64(0)
+	}
+
+	var res uint64
+	switch op {
+	case arm64.ARM64_UBFX:
+		res = src >> lsb & mask
+	case arm64.ARM64_SBFX:
+		res = signExtend(src>>lsb&mask, width)
+	case arm64.ARM64_UBFIZ:
+		res = (src & mask) << lsb
+	case arm64.ARM64_SBFIZ:
+		res = signExtend(src&mask, width) << lsb
+	case arm64.ARM64_BFI, arm64.ARM64_BFXIL:
+		dst, dok := e.value(ops[0], size)
+		ok = ok && dok
+		if op == arm64.ARM64_BFI {
+			res = dst&^(mask<<lsb) | (src&mask)<<lsb
+		} else {
+			res = dst&^mask | src>>lsb&mask
+		}
+	}
+
+	e.write(ops[0], truncate(res, size), ok)
+	return nil
+}
+
+// addWithFlags returns a+b (or a-b) and sets the flags if requested
+func (e *Emulator) addWithFlags(a, b uint64, sub bool, size uint, known, setFlags bool) uint64 {
+	a, b = truncate(a, size), truncate(b, size)
+	var res uint64
+	var carry, overflow bool
+	msb := uint64(1) << (size - 1)
+	if sub {
+		res = truncate(a-b, size)
+		carry = a >= b
+		overflow = (a^b)&(a^res)&msb != 0
+	} else {
+		res = truncate(a+b, size)
+		carry = res < a
+		overflow = ^(a^b)&(a^res)&msb != 0
+	}
+	if setFlags {
+		e.nzcv, e.flags = 0, known
+		if res&msb != 0 {
+			e.nzcv |= flagN
+		}
+		if res == 0 {
+			e.nzcv |= flagZ
+		}
+		if carry {
+			e.nzcv |= flagC
+		}
+		if overflow {
+			e.nzcv |= flagV
+		}
+	}
+	return res
+}
+
+func (e *Emulator) setLogicalFlags(res uint64, size uint, known bool) {
+	res = truncate(res, size)
+	e.nzcv, e.flags = 0, known
+	if res&(1<<(size-1)) != 0 {
+		e.nzcv |= flagN
+	}
+	if res == 0 {
+		e.nzcv |= flagZ
+	}
+}
+
+// condition evaluates a condition code against the flags
+func (e *Emulator) condition(cond arm64.Condition) (bool, bool) {
+	if cond == arm64.COND_AL || cond == arm64.COND_NV {
+		return true, true
+	}
+	if !e.flags {
+		return false, false
+	}
+	n, z, c, v := e.nzcv&flagN != 0, e.nzcv&flagZ != 0, e.nzcv&flagC != 0, e.nzcv&flagV != 0
+	var res bool
+	switch cond &^ 1 {
+	case arm64.COND_EQ:
+		res = z
+	case arm64.COND_CS:
+		res = c
+	case arm64.COND_MI:
+		res = n
+	case arm64.COND_VS:
+		res = v
+	case arm64.COND_HI:
+		res = c && !z
+	case arm64.COND_GE:
+		res = n == v
+	case arm64.COND_GT:
+		res = !z && n == v
+	}
+	// the odd conditions are the inverse of the even ones
+	if cond&1 != 0 {
+		res = !res
+	}
+	return res, true
+}
+
+func binop(op arm64.Operation, a, b uint64, size uint) uint64 {
+	a, b = truncate(a, size), truncate(b, size)
+	switch op {
+	case arm64.ARM64_AND, arm64.ARM64_ANDS:
+		return a & b
+	case arm64.ARM64_ORR:
+		return a | b
+	case arm64.ARM64_EOR:
+		return a ^ b
+	case arm64.ARM64_BIC, arm64.ARM64_BICS:
+		return a &^ b
+	case arm64.ARM64_ORN:
+		return a | ^b
+	case arm64.ARM64_EON:
+		return a ^ ^b
+	case arm64.ARM64_LSL:
+		return a << (b % uint64(size))
+	case arm64.ARM64_LSR:
+		return a >> (b % uint64(size))
+	case arm64.ARM64_ASR:
+		return uint64(int64(signExtend(a, size)) >> (b % uint64(size)))
+	case arm64.ARM64_ROR:
+		return rotateRight(a, uint(b%uint64(size)), size)
+	case arm64.ARM64_MUL:
+		return a * b
+	case arm64.ARM64_MNEG:
+		return -(a * b)
+	case arm64.ARM64_UDIV:
+		if b == 0 {
+			return 0
+		}
+		return a / b
+	case arm64.ARM64_SDIV:
+		if b == 0 {
+			return 0
+		}
+		return uint64(int64(signExtend(a, size)) / int64(signExtend(b, size)))
+	}
+	return 0
+}
+
+// shiftExtend applies a register operand's shift or extend
+func shiftExtend(v uint64, size uint, st arm64.ShiftType, amount uint) uint64 {
+	switch st {
+	case arm64.SHIFT_LSL:
+		return v << amount
+	case arm64.SHIFT_LSR:
+		return truncate(v, size) >> amount
+	case arm64.SHIFT_ASR:
+		return uint64(int64(signExtend(v, size)) >> amount)
+	case arm64.SHIFT_ROR:
+		return rotateRight(v, amount, size)
+	case arm64.SHIFT_UXTB:
+		return (v & 0xff) << amount
+	case arm64.SHIFT_UXTH:
+		return (v & 0xffff) << amount
+	case arm64.SHIFT_UXTW:
+		return (v & 0xffffffff) << amount
+	case arm64.SHIFT_UXTX:
+		return v << amount
+	case arm64.SHIFT_SXTB:
+		return signExtend(v, 8) << amount
+	case arm64.SHIFT_SXTH:
+		return signExtend(v, 16) << amount
+	case arm64.SHIFT_SXTW:
+		return signExtend(v, 32) << amount
+	case arm64.SHIFT_SXTX:
+		return v << amount
+	}
+	return v
+}
+
+func signExtend(v uint64, size uint) uint64 {
+	if size >= 64 || size == 0 {
+		return v
+	}
+	shift := 64 - size
+	return uint64(int64(v<<shift) >> shift)
+}
+
+func rotateRight(v uint64, amount, size uint) uint64 {
+	if size == 32 {
+		return uint64(bits.RotateLeft32(uint32(v), -int(amount)))
+	}
+	return bits.RotateLeft64(v, -int(amount))
+}
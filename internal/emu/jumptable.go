@@ -0,0 +1,276 @@
+package emu
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/go-arm64"
+)
+
+const (
+	// MaxCases is the maximum number of cases of a recovered jump table
+	MaxCases = 0x1000
+
+	dispatchWindow = 16 // the maximum number of instructions between a switch's bounds check and its dispatch
+)
+
+// JumpTable is the jump table of a switch statement recovered from its dispatch, e.g. the clang idiom
+//
+//	cmp   w8, #0x7              ; bounds check
+//	b.hi  default
+//	adrp  x9, table@PAGE
+//	add   x9, x9, table@PAGEOFF
+//	adr   x10, base
+//	ldrb  w11, [x9, x8]         ; or ldrh/ldrsw
+//	add   x10, x10, x11, lsl #2
+//	br    x10                   ; dispatch
+type JumpTable struct {
+	Branch  uint64   `json:"branch"`            // the address of the dispatching br
+	Table   uint64   `json:"table,omitempty"`   // the address of the table (0 if it was not loaded from memory)
+	Default uint64   `json:"default,omitempty"` // the target of the bounds check
+	Targets []uint64 `json:"targets"`           // the target of each case
+}
+
+// String returns a description of the jump table
+func (jt *JumpTable) String() string {
+	if jt.Table > 0 {
+		return fmt.Sprintf("switch table %#x (%d cases)", jt.Table, len(jt.Targets))
+	}
+	return fmt.Sprintf("switch (%d cases)", len(jt.Targets))
+}
+
+// Cases returns the cases that branch to target
+func (jt *JumpTable) Cases(target uint64) []int {
+	var cases []int
+	for idx, t := range jt.Targets {
+		if t == target {
+			cases = append(cases, idx)
+		}
+	}
+	return cases
+}
+
+// Label returns the case label of target (e.g. "case 1, 2" or "default") or "" if the table does NOT branch to it
+func (jt *JumpTable) Label(target uint64) string {
+	cases := jt.Cases(target)
+	if len(cases) == 0 {
+		if target == jt.Default {
+			return "default"
+		}
+		return ""
+	}
+	var labels []string
+	for _, c := range cases {
+		labels = append(labels, fmt.Sprintf("%d", c))
+	}
+	return "case " + strings.Join(labels, ", ")
+}
+
+// UniqueTargets returns the case targets sorted and de-duplicated
+func (jt *JumpTable) UniqueTargets() []uint64 {
+	var targets []uint64
+	seen := make(map[uint64]bool)
+	for _, t := range jt.Targets {
+		if !seen[t] {
+			seen[t] = true
+			targets = append(targets, t)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+	return targets
+}
+
+// JumpTables are the jump tables recovered from a function or a range of code
+type JumpTables []*JumpTable
+
+// At returns the jump table dispatched by the br at addr (or nil)
+func (jts JumpTables) At(addr uint64) *JumpTable {
+	for _, jt := range jts {
+		if jt.Branch == addr {
+			return jt
+		}
+	}
+	return nil
+}
+
+// Label returns the case labels of addr in all the jump tables joined by ; (or "" if it is NOT a case target)
+func (jts JumpTables) Label(addr uint64) string {
+	var labels []string
+	for _, jt := range jts {
+		if label := jt.Label(addr); len(label) > 0 {
+			labels = append(labels, label)
+		}
+	}
+	return strings.Join(labels, " ; ")
+}
+
+// FindJumpTables recovers the jump tables dispatched in code (which is mapped at addr in mem)
+// ignoring the tables with case targets outside of [lo, hi)
+func FindJumpTables(mem Memory, code []byte, addr, lo, hi uint64) JumpTables {
+	var tables JumpTables
+	for off := 0; off+4 <= len(code); off += 4 {
+		if !isBR(binary.LittleEndian.Uint32(code[off:])) {
+			continue
+		}
+		// only emulate the dispatches that follow a bounds check
+		checked := false
+		for back := off - 4; back >= 0 && back >= off-dispatchWindow*4; back -= 4 {
+			if isBoundsCheck(binary.LittleEndian.Uint32(code[back:])) {
+				checked = true
+				break
+			}
+		}
+		if !checked {
+			continue
+		}
+		if jt, err := JumpTableAt(mem, addr+uint64(off), lo, hi); err == nil {
+			tables = append(tables, jt)
+		}
+	}
+	return tables
+}
+
+// isBR returns true if the instruction word is a br
+func isBR(ins uint32) bool {
+	return ins&0xfffffc1f == 0xd61f0000
+}
+
+// isBoundsCheck returns true if the instruction word is a b.hi or b.hs
+func isBoundsCheck(ins uint32) bool {
+	return ins&0xff00001f == 0x54000008 || ins&0xff00001f == 0x54000002
+}
+
+// JumpTableAt recovers the jump table dispatched by the br at addr (the case targets must be in [lo, hi))
+//
+// The dispatch must follow a bounds check of the switch's index (cmp + b.hi/b.hs) and is emulated once
+// for every index allowed by the check to read the br's target.
+func JumpTableAt(mem Memory, addr, lo, hi uint64) (*JumpTable, error) {
+	e := New(mem, &Config{MaxSteps: dispatchWindow * 2})
+
+	br, err := e.fetch(addr)
+	if err != nil {
+		return nil, err
+	}
+	if br.Operation() != arm64.ARM64_BR {
+		return nil, fmt.Errorf("%#x is NOT a br", addr)
+	}
+	target := arm64.Register(br.Operands()[0].Reg[0])
+
+	window := lo
+	if addr-lo > dispatchWindow*4 {
+		window = addr - dispatchWindow*4
+	}
+	// decode the window before the br
+	if _, err := e.fetch(window); err != nil {
+		return nil, err
+	}
+
+	// find the bounds check and the start of its basic block
+	var check, cmp *arm64.Instruction
+	var start uint64
+	for pc := addr - 4; pc >= window && pc < addr; pc -= 4 {
+		i, ok := e.instrs[pc]
+		if !ok {
+			break
+		}
+		if check == nil {
+			if op := i.Operation(); op == arm64.ARM64_B_HI || op == arm64.ARM64_B_HS || op == arm64.ARM64_B_CS {
+				check = i
+			} else if changesFlow(op) {
+				break
+			}
+			continue
+		}
+		if cmp == nil {
+			if i.Operation() != arm64.ARM64_CMP {
+				break
+			}
+			cmp, start = i, pc
+			continue
+		}
+		if changesFlow(i.Operation()) {
+			break
+		}
+		start = pc
+	}
+	if check == nil || cmp == nil {
+		return nil, fmt.Errorf("no bounds check before the br at %#x", addr)
+	}
+	ops := cmp.Operands()
+	if len(ops) < 2 || ops[1].OpClass != arm64.IMM32 && ops[1].OpClass != arm64.IMM64 {
+		return nil, fmt.Errorf("unsupported bounds check at %#x", cmp.Address())
+	}
+	index := arm64.Register(ops[0].Reg[0])
+	count := ops[1].Immediate
+	if ops[1].ShiftValueUsed {
+		count <<= ops[1].ShiftValue
+	}
+	if check.Operation() == arm64.ARM64_B_HI {
+		count++
+	}
+	if count == 0 || count > MaxCases {
+		return nil, fmt.Errorf("invalid number of cases %d at %#x", count, check.Address())
+	}
+
+	// emulate the block up to the bounds check to define the registers the dispatch uses
+	if start < cmp.Address() {
+		if err := e.Run(start, cmp.Address()); err != nil {
+			return nil, err
+		}
+	}
+
+	jt := &JumpTable{
+		Branch:  addr,
+		Default: check.Operands()[0].Immediate,
+	}
+	for idx := uint64(0); idx < count; idx++ {
+		c := e.Clone()
+		c.SetReg(index, idx)
+		c.SetPC(check.Address() + 4)
+		for steps := 0; c.PC() != addr; steps++ {
+			if steps >= dispatchWindow {
+				return nil, fmt.Errorf("case %d does NOT reach the br at %#x", idx, addr)
+			}
+			i, err := c.fetch(c.PC())
+			if err != nil {
+				return nil, err
+			}
+			if changesFlow(i.Operation()) {
+				return nil, fmt.Errorf("case %d does NOT reach the br at %#x", idx, addr)
+			}
+			if idx == 0 && jt.Table == 0 {
+				if ops := i.Operands(); len(ops) > 1 && ops[1].OpClass == arm64.MEM_EXTENDED {
+					jt.Table, _ = c.Reg(arm64.Register(ops[1].Reg[0]))
+				}
+			}
+			if err := c.Execute(i); err != nil {
+				return nil, err
+			}
+		}
+		t, ok := c.Reg(target)
+		if !ok {
+			return nil, fmt.Errorf("unknown target of case %d of the br at %#x", idx, addr)
+		}
+		if t&3 != 0 || t < lo || t >= hi {
+			return nil, fmt.Errorf("invalid target %#x of case %d of the br at %#x", t, idx, addr)
+		}
+		jt.Targets = append(jt.Targets, t)
+	}
+
+	return jt, nil
+}
+
+// changesFlow returns true if the instruction is a branch or leaves the code
+func changesFlow(op arm64.Operation) bool {
+	switch op {
+	case arm64.ARM64_B, arm64.ARM64_BL, arm64.ARM64_BLR, arm64.ARM64_BLRAA, arm64.ARM64_BLRAAZ, arm64.ARM64_BLRAB,
+		arm64.ARM64_BLRABZ, arm64.ARM64_CBZ, arm64.ARM64_CBNZ, arm64.ARM64_TBZ, arm64.ARM64_TBNZ:
+		return true
+	}
+	if _, ok := branchConditions[op]; ok {
+		return true
+	}
+	return exits(op)
+}
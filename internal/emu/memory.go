@@ -0,0 +1,88 @@
+package emu
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/blacktop/go-macho"
+)
+
+// Memory is the memory the emulator fetches instructions and loads data from (a *dyld.CacheImage is a Memory)
+type Memory interface {
+	ReadAtAddr(buf []byte, addr uint64) (int, error)
+}
+
+type machoMemory struct {
+	m *macho.File
+}
+
+// MachO returns the Memory of a MachO's segments
+func MachO(m *macho.File) Memory {
+	return &machoMemory{m: m}
+}
+
+func (mm *machoMemory) ReadAtAddr(buf []byte, addr uint64) (int, error) {
+	off, err := mm.m.GetOffset(addr)
+	if err != nil {
+		return 0, err
+	}
+	return mm.m.ReadAt(buf, int64(off))
+}
+
+// cell is a byte stored by the emulated code
+type cell struct {
+	value byte
+	known bool
+}
+
+// load reads size bytes at addr from the stores (falling back to the backing memory)
+func (e *Emulator) load(addr uint64, size int) (uint64, bool) {
+	buf := make([]byte, 8)
+
+	stored := 0
+	for idx := 0; idx < size; idx++ {
+		if c, ok := e.stores[addr+uint64(idx)]; ok {
+			if !c.known {
+				return 0, false
+			}
+			stored++
+		}
+	}
+
+	if stored < size {
+		if n, err := e.mem.ReadAtAddr(buf[:size], addr); err != nil || n < size {
+			return 0, false
+		}
+	}
+	for idx := 0; idx < size; idx++ {
+		if c, ok := e.stores[addr+uint64(idx)]; ok {
+			buf[idx] = c.value
+		}
+	}
+
+	value := binary.LittleEndian.Uint64(buf)
+	if size == 8 && stored == 0 && e.cfg.Pointer != nil {
+		value = e.cfg.Pointer(value)
+	}
+
+	return value, true
+}
+
+// store writes the low size bytes of value (or unknown bytes) at addr
+func (e *Emulator) store(addr uint64, size int, value uint64, known bool) {
+	for idx := 0; idx < size; idx++ {
+		e.stores[addr+uint64(idx)] = cell{value: byte(value >> (8 * idx)), known: known}
+	}
+}
+
+// Read returns the size byte little endian value at addr as the emulated code would load it
+func (e *Emulator) Read(addr uint64, size int) (uint64, error) {
+	if size < 1 || size > 8 {
+		return 0, fmt.Errorf("invalid read size %d", size)
+	}
+	value, ok := e.load(addr, size)
+	if !ok {
+		return 0, fmt.Errorf("failed to read %d bytes at %#x", size, addr)
+	}
+	return value, nil
+}
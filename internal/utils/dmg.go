@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/pkg/apfs"
+	"github.com/blacktop/ipsw/pkg/dmg"
+	"github.com/pkg/errors"
+)
+
+// ZipFile is an io.ReaderAt over a single file inside a zip archive
+type ZipFile struct {
+	io.ReaderAt
+	Name string
+	Size int64
+
+	closers []func() error
+}
+
+// Close releases the zip archive and any temporary file backing the ZipFile
+func (z *ZipFile) Close() error {
+	var err error
+	for i := len(z.closers) - 1; i >= 0; i-- {
+		if cerr := z.closers[i](); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	z.closers = nil
+	return err
+}
+
+// OpenZipFile opens the first file in the zip archive src that matches filter for random access.
+// Stored (uncompressed) entries are read in place; deflated entries are streamed to a temporary file.
+func OpenZipFile(src string, filter func(f *zip.File) bool) (*ZipFile, error) {
+	zf, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := zf.Stat()
+	if err != nil {
+		zf.Close()
+		return nil, err
+	}
+	zr, err := zip.NewReader(zf, fi.Size())
+	if err != nil {
+		zf.Close()
+		return nil, errors.Wrapf(err, "failed to open zip %s", src)
+	}
+
+	for _, f := range zr.File {
+		if !filter(f) {
+			continue
+		}
+
+		z := &ZipFile{Name: f.Name, Size: int64(f.UncompressedSize64), closers: []func() error{zf.Close}}
+
+		if f.Method == zip.Store {
+			off, err := f.DataOffset()
+			if err != nil {
+				z.Close()
+				return nil, errors.Wrapf(err, "failed to get data offset of %s", f.Name)
+			}
+			z.ReaderAt = io.NewSectionReader(zf, off, z.Size)
+			return z, nil
+		}
+
+		log.Debugf("Streaming compressed %s to temp file", f.Name)
+		tmp, err := ioutil.TempFile("", "ipsw_zip_")
+		if err != nil {
+			z.Close()
+			return nil, errors.Wrap(err, "failed to create temp file")
+		}
+		z.closers = append(z.closers, func() error {
+			tmp.Close()
+			return os.Remove(tmp.Name())
+		})
+		rc, err := f.Open()
+		if err != nil {
+			z.Close()
+			return nil, errors.Wrapf(err, "failed to open %s in zip", f.Name)
+		}
+		_, err = io.Copy(tmp, rc)
+		rc.Close()
+		if err != nil {
+			z.Close()
+			return nil, errors.Wrapf(err, "failed to decompress %s", f.Name)
+		}
+		z.ReaderAt = tmp
+		return z, nil
+	}
+
+	zf.Close()
+	return nil, fmt.Errorf("no matching file found in zip %s", src)
+}
+
+// OpenDMGVolume opens the first APFS volume inside a UDIF disk image without mounting it
+func OpenDMGVolume(r io.ReaderAt, size int64) (*apfs.Volume, error) {
+	d, err := dmg.NewDMG(r, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse DMG")
+	}
+
+	var cr io.ReaderAt = d
+	if p, err := d.APFSPartition(); err == nil {
+		cr = p
+	}
+
+	c, err := apfs.NewContainer(cr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse APFS container")
+	}
+	if len(c.Volumes) == 0 {
+		return nil, fmt.Errorf("no volumes found in APFS container")
+	}
+
+	return c.Volumes[0], nil
+}
@@ -0,0 +1,106 @@
+package vmreader
+
+import (
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/pkg/fixupchains"
+)
+
+// MachO is a BindReader and ImageReader of a MachO that resolves the pointers with its chained fixups or bind info
+type MachO struct {
+	m       *macho.File
+	rebases map[uint64]uint64 // chained fixup rebase targets
+	binds   map[uint64]string // bound symbol names
+	dylibs  map[uint64]string // dylibs of the bound symbols
+}
+
+// NewMachO returns a reader of the MachO m
+func NewMachO(m *macho.File) *MachO {
+	r := &MachO{
+		m:       m,
+		rebases: make(map[uint64]uint64),
+		binds:   make(map[uint64]string),
+		dylibs:  make(map[uint64]string),
+	}
+
+	base := m.GetBaseAddress()
+	if m.HasFixups() {
+		if dcf, err := m.DyldChainedFixups(); err == nil {
+			for _, start := range dcf.Starts {
+				if start.PageStarts == nil {
+					continue
+				}
+				for _, fixup := range start.Fixups {
+					switch f := fixup.(type) {
+					case fixupchains.Bind:
+						r.binds[base+f.Offset()] = f.Name()
+						if int(f.Ordinal()) < len(dcf.Imports) {
+							r.dylibs[base+f.Offset()] = m.LibraryOrdinalName(dcf.Imports[f.Ordinal()].LibOrdinal())
+						}
+					case fixupchains.Rebase:
+						target := f.Target()
+						if targetIsVMOffset(start.PointerFormat, fixup) {
+							target += base
+						}
+						r.rebases[base+f.Offset()] = target
+					}
+				}
+			}
+		}
+	} else if binds, err := m.GetBindInfo(); err == nil {
+		for _, bind := range binds {
+			r.binds[bind.Start+bind.Offset] = bind.Name
+			r.dylibs[bind.Start+bind.Offset] = bind.Dylib
+		}
+	}
+
+	return r
+}
+
+// targetIsVMOffset returns true if the target of a rebase in the pointer format is an offset from the MachO's base address
+func targetIsVMOffset(format fixupchains.DCPtrKind, rebase fixupchains.Fixup) bool {
+	switch format {
+	case fixupchains.DYLD_CHAINED_PTR_ARM64E:
+		_, auth := rebase.(fixupchains.DyldChainedPtrArm64eAuthRebase)
+		return auth
+	case fixupchains.DYLD_CHAINED_PTR_64, fixupchains.DYLD_CHAINED_PTR_32:
+		return false
+	default: // DYLD_CHAINED_PTR_64_OFFSET, DYLD_CHAINED_PTR_ARM64E_USERLAND(24), DYLD_CHAINED_PTR_ARM64E_KERNEL, ...
+		return true
+	}
+}
+
+// ReadAtAddr reads len(buf) bytes at the virtual address addr
+func (r *MachO) ReadAtAddr(buf []byte, addr uint64) (int, error) {
+	off, err := r.m.GetOffset(addr)
+	if err != nil {
+		return 0, err
+	}
+	return r.m.ReadAt(buf, int64(off))
+}
+
+// ReadPointerAtAddr returns the target of the pointer at addr or 0 if it is bound to a symbol
+func (r *MachO) ReadPointerAtAddr(addr uint64) (uint64, error) {
+	if _, ok := r.binds[addr]; ok {
+		return 0, nil
+	}
+	if target, ok := r.rebases[addr]; ok {
+		return target, nil
+	}
+	ptr := make([]byte, 8)
+	if _, err := r.ReadAtAddr(ptr, addr); err != nil {
+		return 0, err
+	}
+	return r.m.ByteOrder.Uint64(ptr), nil
+}
+
+// BindNameAtAddr returns the name of the symbol the pointer at addr is bound to
+func (r *MachO) BindNameAtAddr(addr uint64) (string, bool) {
+	name, ok := r.binds[addr]
+	return name, ok
+}
+
+// ImageAtAddr returns the install name of the dylib the pointer at addr is bound to
+func (r *MachO) ImageAtAddr(addr uint64) (string, bool) {
+	dylib, ok := r.dylibs[addr]
+	return dylib, ok && len(dylib) > 0
+}
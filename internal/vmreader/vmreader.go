@@ -0,0 +1,69 @@
+// Package vmreader reads the memory of MachOs and dyld_shared_cache images by virtual address
+// for the metadata parsers (i.e. Objective-C and Swift).
+package vmreader
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// MaxString is the sanity limit for the cstrings read by ReadCString
+const MaxString = 0x1000
+
+// Reader reads an image's memory by (unslid) virtual address
+type Reader interface {
+	ReadAtAddr(buf []byte, addr uint64) (int, error)
+	// ReadPointerAtAddr returns the target of the pointer at addr
+	// or 0 if it is bound to a symbol in another image
+	ReadPointerAtAddr(addr uint64) (uint64, error)
+}
+
+// A BindReader is a Reader that can also return the name of the symbol
+// a pointer is bound to (e.g. classes imported from other images)
+type BindReader interface {
+	Reader
+	BindNameAtAddr(addr uint64) (string, bool)
+}
+
+// An ImageReader is a Reader that can also return the install name of the image
+// a pointer points into or is bound to (when it is NOT the image being read)
+type ImageReader interface {
+	Reader
+	ImageAtAddr(addr uint64) (string, bool)
+}
+
+// ReadBytes reads up to max bytes at addr stopping at the end of readable memory
+func ReadBytes(r Reader, addr uint64, max int) ([]byte, error) {
+	buf := make([]byte, max)
+	if n, err := r.ReadAtAddr(buf, addr); err == nil || n == max {
+		return buf, nil
+	}
+	// the data might be at the end of a mapping so read it a byte at a time
+	var out []byte
+	b := make([]byte, 1)
+	for len(out) < max {
+		if _, err := r.ReadAtAddr(b, addr+uint64(len(out))); err != nil {
+			if len(out) == 0 {
+				return nil, fmt.Errorf("failed to read at %#x: %v", addr, err)
+			}
+			break
+		}
+		out = append(out, b[0])
+	}
+	return out, nil
+}
+
+// ReadCString reads the cstring at addr (of at most MaxString bytes)
+func ReadCString(r Reader, addr uint64) (string, error) {
+	if addr == 0 {
+		return "", nil
+	}
+	buf, err := ReadBytes(r, addr, MaxString)
+	if err != nil {
+		return "", fmt.Errorf("failed to read cstring at %#x: %v", addr, err)
+	}
+	if end := bytes.IndexByte(buf, 0); end >= 0 {
+		return string(buf[:end]), nil
+	}
+	return string(buf), nil
+}
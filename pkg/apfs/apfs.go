@@ -0,0 +1,184 @@
+// Package apfs implements a read-only, pure Go Apple File System (APFS) reader.
+package apfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+const maxCachedNodes = 8192
+
+// Container is an APFS container
+type Container struct {
+	Volumes []*Volume
+
+	sb        nxSuperblock
+	blockSize uint32
+	omap      *objectMap
+
+	r      io.ReaderAt
+	closer io.Closer
+
+	mu    sync.Mutex
+	nodes map[paddr]*node
+}
+
+// Open opens the named file using os.Open and prepares it for use as an APFS container.
+func Open(name string) (*Container, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewContainer(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	c.closer = f
+	return c, nil
+}
+
+// Close closes the Container.
+// If the Container was created using NewContainer directly instead of Open,
+// Close has no effect.
+func (c *Container) Close() error {
+	var err error
+	if c.closer != nil {
+		err = c.closer.Close()
+		c.closer = nil
+	}
+	return err
+}
+
+// NewContainer creates a new Container for accessing an APFS container in an underlying reader.
+func NewContainer(r io.ReaderAt) (*Container, error) {
+	c := &Container{
+		r:     r,
+		nodes: make(map[paddr]*node),
+	}
+
+	// block zero holds a copy of the container superblock
+	hdr := make([]byte, 4096)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, errors.Wrap(err, "failed to read container superblock")
+	}
+	if err := binary.Read(bytes.NewReader(hdr), binary.LittleEndian, &c.sb); err != nil {
+		return nil, errors.Wrap(err, "failed to parse container superblock")
+	}
+	if c.sb.Magic != nxMagic {
+		return nil, &FormatError{0, "invalid container superblock magic", c.sb.Magic}
+	}
+	c.blockSize = c.sb.BlockSize
+
+	if err := c.findLatestSuperblock(); err != nil {
+		log.Debugf("failed to find latest checkpoint (using block zero superblock): %v", err)
+	}
+
+	log.WithFields(log.Fields{
+		"uuid":       c.sb.UUID,
+		"block_size": c.blockSize,
+		"xid":        c.sb.Obj.Xid,
+	}).Debug("APFS Container")
+
+	var err error
+	c.omap, err = c.readObjectMap(paddr(c.sb.OmapOid))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read container object map")
+	}
+
+	if c.sb.MaxFileSystems > nxMaxFileSystems {
+		return nil, &FormatError{0, "invalid container max file systems", c.sb.MaxFileSystems}
+	}
+
+	for _, fsOid := range c.sb.FsOid[:c.sb.MaxFileSystems] {
+		if fsOid == 0 {
+			continue
+		}
+		v, err := c.openVolume(fsOid)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open volume %#x", fsOid)
+		}
+		c.Volumes = append(c.Volumes, v)
+	}
+
+	return c, nil
+}
+
+// findLatestSuperblock scans the checkpoint descriptor area for the newest valid container superblock
+func (c *Container) findLatestSuperblock() error {
+	if c.sb.XpDescBlocks&0x80000000 != 0 {
+		return fmt.Errorf("non-contiguous checkpoint descriptor area is not supported")
+	}
+
+	latest := c.sb
+	for i := uint32(0); i < c.sb.XpDescBlocks; i++ {
+		data, err := c.readBlock(c.sb.XpDescBase + paddr(i))
+		if err != nil {
+			return err
+		}
+		var o objPhys
+		binary.Read(bytes.NewReader(data), binary.LittleEndian, &o)
+		if o.Type.Type() != objTypeNxSuperblock || !verifyChecksum(data) {
+			continue
+		}
+		var sb nxSuperblock
+		if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &sb); err != nil {
+			return err
+		}
+		if sb.Magic == nxMagic && sb.Obj.Xid > latest.Obj.Xid {
+			latest = sb
+		}
+	}
+	c.sb = latest
+
+	return nil
+}
+
+// readBlock reads the block at physical address addr
+func (c *Container) readBlock(addr paddr) ([]byte, error) {
+	data := make([]byte, c.blockSize)
+	if _, err := c.r.ReadAt(data, int64(addr)*int64(c.blockSize)); err != nil {
+		return nil, errors.Wrapf(err, "failed to read block %#x", addr)
+	}
+	return data, nil
+}
+
+func (c *Container) cachedNode(addr paddr) (*node, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, ok := c.nodes[addr]
+	return n, ok
+}
+
+func (c *Container) cacheNode(addr paddr, n *node) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.nodes) >= maxCachedNodes {
+		c.nodes = make(map[paddr]*node)
+	}
+	c.nodes[addr] = n
+}
+
+// verifyChecksum validates an object's Fletcher-64 checksum
+func verifyChecksum(data []byte) bool {
+	return binary.LittleEndian.Uint64(data) == fletcher64(data[8:])
+}
+
+func fletcher64(data []byte) uint64 {
+	const mod = 0xffffffff
+	var sum1, sum2 uint64
+	for i := 0; i+4 <= len(data); i += 4 {
+		sum1 = (sum1 + uint64(binary.LittleEndian.Uint32(data[i:]))) % mod
+		sum2 = (sum2 + sum1) % mod
+	}
+	c1 := mod - ((sum1 + sum2) % mod)
+	c2 := mod - ((sum1 + c1) % mod)
+	return c2<<32 | c1
+}
@@ -0,0 +1,272 @@
+package apfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// node is a parsed B-tree node
+type node struct {
+	btreeNodePhys
+	data []byte
+	info *btreeInfo
+}
+
+func (n *node) isLeaf() bool {
+	return n.Flags&btnodeLeaf != 0
+}
+
+func (n *node) isRoot() bool {
+	return n.Flags&btnodeRoot != 0
+}
+
+func (n *node) isFixed() bool {
+	return n.Flags&btnodeFixedKVSize != 0
+}
+
+// entry returns the raw key and value bytes of the i-th entry in the node
+func (n *node) entry(i int) ([]byte, []byte, error) {
+	keyStart := btreeNodeHdrSize + int(n.TableSpace.Off) + int(n.TableSpace.Len)
+	valEnd := len(n.data)
+	if n.isRoot() {
+		valEnd -= btreeInfoSize
+	}
+
+	var kOff, kLen, vOff, vLen int
+	if n.isFixed() {
+		toc := btreeNodeHdrSize + int(n.TableSpace.Off) + i*binary.Size(kvoff{})
+		if toc+4 > len(n.data) {
+			return nil, nil, fmt.Errorf("toc entry %d out of bounds", i)
+		}
+		kOff = int(binary.LittleEndian.Uint16(n.data[toc:]))
+		vOff = int(binary.LittleEndian.Uint16(n.data[toc+2:]))
+		kLen = int(n.info.KeySize)
+		if n.isLeaf() {
+			vLen = int(n.info.ValSize)
+		} else {
+			vLen = binary.Size(oid(0))
+		}
+	} else {
+		toc := btreeNodeHdrSize + int(n.TableSpace.Off) + i*binary.Size(kvloc{})
+		if toc+8 > len(n.data) {
+			return nil, nil, fmt.Errorf("toc entry %d out of bounds", i)
+		}
+		kOff = int(binary.LittleEndian.Uint16(n.data[toc:]))
+		kLen = int(binary.LittleEndian.Uint16(n.data[toc+2:]))
+		vOff = int(binary.LittleEndian.Uint16(n.data[toc+4:]))
+		vLen = int(binary.LittleEndian.Uint16(n.data[toc+6:]))
+	}
+
+	k := keyStart + kOff
+	if k+kLen > len(n.data) {
+		return nil, nil, fmt.Errorf("key %d out of bounds", i)
+	}
+	if vOff == 0xffff { // ghost entry (no value)
+		return n.data[k : k+kLen], nil, nil
+	}
+	v := valEnd - vOff
+	if v < 0 || v+vLen > len(n.data) {
+		return nil, nil, fmt.Errorf("value %d out of bounds", i)
+	}
+
+	return n.data[k : k+kLen], n.data[v : v+vLen], nil
+}
+
+// childOid returns the child object id stored in a non-leaf node value
+func childOid(val []byte) oid {
+	return oid(binary.LittleEndian.Uint64(val))
+}
+
+// btree is an on-disk B-tree; child nodes are either physical or virtual (resolved through an omap)
+type btree struct {
+	c    *Container
+	root oid
+	omap *objectMap // nil for physical trees
+	xid  xid
+	info btreeInfo
+}
+
+func (c *Container) newBtree(root oid, physical bool, om *objectMap, maxXid xid) (*btree, error) {
+	t := &btree{c: c, root: root, xid: maxXid}
+	if !physical {
+		t.omap = om
+	}
+	n, err := t.readNode(root)
+	if err != nil {
+		return nil, err
+	}
+	if !n.isRoot() {
+		return nil, fmt.Errorf("btree object %#x is not a root node", root)
+	}
+	t.info = *n.info
+	return t, nil
+}
+
+func (t *btree) readNode(id oid) (*node, error) {
+	addr := paddr(id)
+	if t.omap != nil {
+		val, err := t.omap.lookup(id, t.xid)
+		if err != nil {
+			return nil, err
+		}
+		addr = val.Paddr
+	}
+
+	if n, ok := t.c.cachedNode(addr); ok {
+		return n, nil
+	}
+
+	data, err := t.c.readBlock(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &node{data: data}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &n.btreeNodePhys); err != nil {
+		return nil, fmt.Errorf("failed to read btree node header: %v", err)
+	}
+	if t := n.Obj.Type.Type(); t != objTypeBtree && t != objTypeBtreeNode {
+		return nil, &FormatError{int64(addr) * int64(len(data)), "invalid btree node object type", t}
+	}
+	if n.isRoot() {
+		n.info = &btreeInfo{}
+		if err := binary.Read(bytes.NewReader(data[len(data)-btreeInfoSize:]), binary.LittleEndian, n.info); err != nil {
+			return nil, fmt.Errorf("failed to read btree info: %v", err)
+		}
+	} else {
+		n.info = &t.info
+	}
+
+	t.c.cacheNode(addr, n)
+
+	return n, nil
+}
+
+// walk visits every leaf entry whose key is in range (cmp returns 0) in key order.
+// cmp must return <0 for keys before the range and >0 for keys after it.
+// Returning errStop from fn ends the walk early.
+func (t *btree) walk(cmp func(key []byte) int, fn func(key, val []byte) error) error {
+	err := t.walkNode(t.root, cmp, fn)
+	if err == errStop {
+		return nil
+	}
+	return err
+}
+
+func (t *btree) walkNode(id oid, cmp func(key []byte) int, fn func(key, val []byte) error) error {
+	n, err := t.readNode(id)
+	if err != nil {
+		return err
+	}
+
+	if n.isLeaf() {
+		for i := 0; i < int(n.Nkeys); i++ {
+			k, v, err := n.entry(i)
+			if err != nil {
+				return err
+			}
+			switch c := cmp(k); {
+			case c < 0:
+				continue
+			case c > 0:
+				return errStop
+			}
+			if err := fn(k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := 0; i < int(n.Nkeys); i++ {
+		k, v, err := n.entry(i)
+		if err != nil {
+			return err
+		}
+		if cmp(k) > 0 {
+			return errStop
+		}
+		if i+1 < int(n.Nkeys) { // skip children whose keys all sort before the range
+			next, _, err := n.entry(i + 1)
+			if err != nil {
+				return err
+			}
+			if cmp(next) < 0 {
+				continue
+			}
+		}
+		if err := t.walkNode(childOid(v), cmp, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type stopError struct{}
+
+func (stopError) Error() string { return "stop" }
+
+var errStop error = stopError{}
+
+// objectMap maps virtual object ids to physical addresses (omap_phys_t)
+type objectMap struct {
+	omapPhys
+	tree *btree
+}
+
+func (c *Container) readObjectMap(addr paddr) (*objectMap, error) {
+	data, err := c.readBlock(addr)
+	if err != nil {
+		return nil, err
+	}
+	om := &objectMap{}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &om.omapPhys); err != nil {
+		return nil, fmt.Errorf("failed to read omap: %v", err)
+	}
+	if om.Obj.Type.Type() != objTypeOmap {
+		return nil, &FormatError{int64(addr) * int64(c.blockSize), "invalid omap object type", om.Obj.Type}
+	}
+	om.tree, err = c.newBtree(om.TreeOid, true, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read omap btree: %v", err)
+	}
+	return om, nil
+}
+
+// lookup returns the newest mapping for id with a transaction id <= maxXid
+func (om *objectMap) lookup(id oid, maxXid xid) (*omapVal, error) {
+	var found *omapVal
+	var foundXid xid
+
+	err := om.tree.walk(func(key []byte) int {
+		k := oid(binary.LittleEndian.Uint64(key))
+		switch {
+		case k < id:
+			return -1
+		case k > id:
+			return 1
+		}
+		return 0
+	}, func(key, val []byte) error {
+		kx := xid(binary.LittleEndian.Uint64(key[8:]))
+		if maxXid != 0 && kx > maxXid {
+			return nil
+		}
+		if found == nil || kx >= foundXid {
+			found = &omapVal{}
+			binary.Read(bytes.NewReader(val), binary.LittleEndian, found)
+			foundXid = kx
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("virtual object %#x not found in omap", id)
+	}
+
+	return found, nil
+}
@@ -0,0 +1,282 @@
+package apfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/blacktop/ipsw/pkg/lzfse"
+	"github.com/pkg/errors"
+)
+
+const (
+	decmpfsMagic     = 0x636d7066 // fpmc
+	decmpfsChunkSize = 0x10000
+)
+
+type compressionType uint32
+
+const (
+	cmpUncompressedXattr compressionType = 1
+	cmpZlibXattr         compressionType = 3
+	cmpZlibRsrc          compressionType = 4
+	cmpLzvnXattr         compressionType = 7
+	cmpLzvnRsrc          compressionType = 8
+	cmpRawXattr          compressionType = 9
+	cmpRawRsrc           compressionType = 10
+	cmpLzfseXattr        compressionType = 11
+	cmpLzfseRsrc         compressionType = 12
+	cmpLzbitmapXattr     compressionType = 13
+	cmpLzbitmapRsrc      compressionType = 14
+)
+
+func (c compressionType) String() string {
+	switch c {
+	case cmpUncompressedXattr, cmpRawXattr:
+		return "uncompressed (xattr)"
+	case cmpRawRsrc:
+		return "uncompressed (resource fork)"
+	case cmpZlibXattr:
+		return "zlib (xattr)"
+	case cmpZlibRsrc:
+		return "zlib (resource fork)"
+	case cmpLzvnXattr:
+		return "lzvn (xattr)"
+	case cmpLzvnRsrc:
+		return "lzvn (resource fork)"
+	case cmpLzfseXattr:
+		return "lzfse (xattr)"
+	case cmpLzfseRsrc:
+		return "lzfse (resource fork)"
+	case cmpLzbitmapXattr:
+		return "lzbitmap (xattr)"
+	case cmpLzbitmapRsrc:
+		return "lzbitmap (resource fork)"
+	default:
+		return fmt.Sprintf("unknown(%d)", c)
+	}
+}
+
+// decmpfsHeader is the header of the com.apple.decmpfs xattr
+type decmpfsHeader struct {
+	Magic            uint32
+	CompressionType  compressionType
+	UncompressedSize uint64
+}
+
+func (v *Volume) decmpfsHeader(ino *Inode) (*decmpfsHeader, []byte, error) {
+	data, err := v.xattr(ino.ID, xattrDecmpfsName)
+	if err != nil {
+		return nil, nil, err
+	}
+	var hdr decmpfsHeader
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &hdr); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to parse decmpfs header")
+	}
+	if hdr.Magic != decmpfsMagic {
+		return nil, nil, fmt.Errorf("invalid decmpfs magic %#x", hdr.Magic)
+	}
+	return &hdr, data[binary.Size(hdr):], nil
+}
+
+// decmpfsReader returns an io.ReaderAt over the decompressed contents of a compressed file
+func (v *Volume) decmpfsReader(ino *Inode) (io.ReaderAt, int64, error) {
+	hdr, inline, err := v.decmpfsHeader(ino)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size := int64(hdr.UncompressedSize)
+
+	switch hdr.CompressionType {
+	case cmpUncompressedXattr, cmpRawXattr:
+		return bytes.NewReader(inline), size, nil
+	case cmpZlibXattr:
+		data, err := decompressZlibChunk(inline)
+		if err != nil {
+			return nil, 0, err
+		}
+		return bytes.NewReader(data), size, nil
+	case cmpLzvnXattr:
+		data, err := decompressLzvnChunk(inline, int(size))
+		if err != nil {
+			return nil, 0, err
+		}
+		return bytes.NewReader(data), size, nil
+	case cmpLzfseXattr:
+		data, err := decompressLzfseChunk(inline, int(size))
+		if err != nil {
+			return nil, 0, err
+		}
+		return bytes.NewReader(data), size, nil
+	case cmpZlibRsrc, cmpLzvnRsrc, cmpRawRsrc, cmpLzfseRsrc:
+		rsrc, rsrcSize, err := v.xattrReader(ino.ID, xattrResourceForkName)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "failed to read resource fork")
+		}
+		cr := &chunkedReader{r: rsrc, size: size, cached: -1}
+		switch hdr.CompressionType {
+		case cmpZlibRsrc:
+			err = cr.parseZlibTable(rsrcSize)
+			cr.decode = func(data []byte, _ int) ([]byte, error) { return decompressZlibChunk(data) }
+		case cmpLzvnRsrc:
+			err = cr.parseOffsetTable()
+			cr.decode = decompressLzvnChunk
+		case cmpLzfseRsrc:
+			err = cr.parseOffsetTable()
+			cr.decode = decompressLzfseChunk
+		case cmpRawRsrc:
+			err = cr.parseOffsetTable()
+			cr.decode = func(data []byte, _ int) ([]byte, error) { return data, nil }
+		}
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "failed to parse %s chunk table", hdr.CompressionType)
+		}
+		return cr, size, nil
+	}
+
+	return nil, 0, fmt.Errorf("unsupported decmpfs compression type: %s", hdr.CompressionType)
+}
+
+func decompressZlibChunk(data []byte) ([]byte, error) {
+	if len(data) > 0 && data[0]&0x0f == 0x0f { // stored uncompressed
+		return data[1:], nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+func decompressLzvnChunk(data []byte, size int) ([]byte, error) {
+	if len(data) > 0 && data[0] == 0x06 { // stored uncompressed
+		return data[1:], nil
+	}
+	return lzfse.DecodeLZVN(data, size)
+}
+
+func decompressLzfseChunk(data []byte, _ int) ([]byte, error) {
+	if len(data) > 0 && data[0] == 0xff { // stored uncompressed
+		return data[1:], nil
+	}
+	return lzfse.NewDecoder(data).DecodeBuffer()
+}
+
+type chunk struct {
+	off  int64
+	size int64
+}
+
+// chunkedReader decompresses a resource fork stored as 64K chunks on demand
+type chunkedReader struct {
+	r      io.ReaderAt
+	size   int64
+	chunks []chunk
+	decode func(data []byte, size int) ([]byte, error)
+
+	mu     sync.Mutex
+	cached int
+	data   []byte
+}
+
+// parseOffsetTable parses the LZVN/LZFSE style table of uint32 chunk start offsets
+func (cr *chunkedReader) parseOffsetTable() error {
+	n := int((cr.size + decmpfsChunkSize - 1) / decmpfsChunkSize)
+	table := make([]uint32, n+1)
+	if err := binary.Read(io.NewSectionReader(cr.r, 0, int64(4*(n+1))), binary.LittleEndian, &table); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		cr.chunks = append(cr.chunks, chunk{int64(table[i]), int64(table[i+1]) - int64(table[i])})
+	}
+	return nil
+}
+
+// parseZlibTable parses the classic resource fork (big endian header followed by the cmpf block table)
+func (cr *chunkedReader) parseZlibTable(rsrcSize int64) error {
+	var dataOff uint32
+	if err := binary.Read(io.NewSectionReader(cr.r, 0, 4), binary.BigEndian, &dataOff); err != nil {
+		return err
+	}
+	base := int64(dataOff) + 4
+
+	var count uint32
+	if err := binary.Read(io.NewSectionReader(cr.r, base, 4), binary.LittleEndian, &count); err != nil {
+		return err
+	}
+	entries := make([]struct {
+		Offset uint32
+		Size   uint32
+	}, count)
+	if err := binary.Read(io.NewSectionReader(cr.r, base+4, rsrcSize), binary.LittleEndian, &entries); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		cr.chunks = append(cr.chunks, chunk{base + int64(e.Offset), int64(e.Size)})
+	}
+	return nil
+}
+
+func (cr *chunkedReader) chunk(i int) ([]byte, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if cr.cached == i {
+		return cr.data, nil
+	}
+
+	c := cr.chunks[i]
+	src := make([]byte, c.size)
+	if _, err := cr.r.ReadAt(src, c.off); err != nil && err != io.EOF {
+		return nil, errors.Wrapf(err, "failed to read compressed chunk %d", i)
+	}
+
+	size := decmpfsChunkSize
+	if rem := cr.size - int64(i)*decmpfsChunkSize; rem < int64(size) {
+		size = int(rem)
+	}
+	data, err := cr.decode(src, size)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decompress chunk %d", i)
+	}
+
+	cr.cached, cr.data = i, data
+
+	return data, nil
+}
+
+func (cr *chunkedReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= cr.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && off+int64(n) < cr.size {
+		pos := off + int64(n)
+		idx := int(pos / decmpfsChunkSize)
+		if idx >= len(cr.chunks) {
+			return n, io.ErrUnexpectedEOF
+		}
+		data, err := cr.chunk(idx)
+		if err != nil {
+			return n, err
+		}
+		inChunk := int(pos % decmpfsChunkSize)
+		if inChunk >= len(data) {
+			return n, io.ErrUnexpectedEOF
+		}
+		n += copy(p[n:], data[inChunk:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
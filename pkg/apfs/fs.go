@@ -0,0 +1,368 @@
+package apfs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+const maxSymlinkHops = 40
+
+var (
+	_ fs.FS         = (*Volume)(nil)
+	_ fs.ReadDirFS  = (*Volume)(nil)
+	_ fs.StatFS     = (*Volume)(nil)
+	_ fs.ReadFileFS = (*Volume)(nil)
+)
+
+// resolve walks name from the volume root returning its inode, following symlinks
+// in every path element (and in the last one only if followLast is set)
+func (v *Volume) resolve(op, name string, followLast bool) (*Inode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	root, err := v.inode(rootDirInoNum)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	stack := []*Inode{root}
+	parts := strings.Split(name, "/")
+	hops := 0
+
+	for len(parts) > 0 {
+		elem := parts[0]
+		parts = parts[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+
+		cur := stack[len(stack)-1]
+		if cur.Mode&sIFMT != sIFDIR {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("not a directory")}
+		}
+
+		child, err := v.lookup(cur.ID, elem)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+
+		if child.Mode&sIFMT == sIFLNK && (len(parts) > 0 || followLast) {
+			if hops++; hops > maxSymlinkHops {
+				return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("too many levels of symbolic links")}
+			}
+			target, err := v.xattr(child.ID, xattrSymlinkName)
+			if err != nil {
+				return nil, &fs.PathError{Op: op, Path: name, Err: err}
+			}
+			link := strings.TrimRight(string(target), "\x00")
+			if strings.HasPrefix(link, "/") {
+				stack = stack[:1]
+			}
+			parts = append(strings.Split(link, "/"), parts...)
+			continue
+		}
+
+		stack = append(stack, child)
+	}
+
+	return stack[len(stack)-1], nil
+}
+
+// lookup finds the entry called name in the directory with inode id dir
+func (v *Volume) lookup(dir uint64, name string) (*Inode, error) {
+	recs, err := v.dirRecords(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range recs {
+		if rec.name == name {
+			ino, err := v.inode(rec.fileID)
+			if err != nil {
+				return nil, err
+			}
+			ino.Name = rec.name
+			return ino, nil
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+// Open opens the named file for reading
+func (v *Volume) Open(name string) (fs.File, error) {
+	ino, err := v.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := v.fileInfo(ino, path.Base(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if fi.IsDir() {
+		return &dir{v: v, fi: fi}, nil
+	}
+
+	f := &file{fi: fi}
+	if fi.Mode().IsRegular() {
+		r, err := v.contents(ino)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		f.SectionReader = io.NewSectionReader(r, 0, fi.size)
+	} else {
+		f.SectionReader = io.NewSectionReader(eofReader{}, 0, 0)
+	}
+
+	return f, nil
+}
+
+// contents returns an io.ReaderAt over a regular file's (decompressed) data
+func (v *Volume) contents(ino *Inode) (io.ReaderAt, error) {
+	if ino.IsCompressed() {
+		r, _, err := v.decmpfsReader(ino)
+		return r, err
+	}
+	if ino.dstream == nil {
+		return eofReader{}, nil
+	}
+	return v.dataStream(ino.PrivateID, ino.dstream.Size)
+}
+
+// ReadFile reads the named file and returns its contents
+func (v *Volume) ReadFile(name string) ([]byte, error) {
+	f, err := v.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+
+	data := make([]byte, fi.Size())
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+
+	return data, nil
+}
+
+// Stat returns a FileInfo describing the named file, following symlinks
+func (v *Volume) Stat(name string) (fs.FileInfo, error) {
+	ino, err := v.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return v.fileInfo(ino, path.Base(name))
+}
+
+// Lstat returns a FileInfo describing the named file without following a final symlink
+func (v *Volume) Lstat(name string) (fs.FileInfo, error) {
+	ino, err := v.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return v.fileInfo(ino, path.Base(name))
+}
+
+// ReadLink returns the destination of the named symbolic link
+func (v *Volume) ReadLink(name string) (string, error) {
+	ino, err := v.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if ino.Mode&sIFMT != sIFLNK {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := v.xattr(ino.ID, xattrSymlinkName)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return strings.TrimRight(string(target), "\x00"), nil
+}
+
+// ListXattrs returns the names of the extended attributes of the named file
+func (v *Volume) ListXattrs(name string) ([]string, error) {
+	ino, err := v.resolve("listxattr", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return v.xattrNames(ino.ID)
+}
+
+// GetXattr returns the data of the extended attribute attr of the named file
+func (v *Volume) GetXattr(name, attr string) ([]byte, error) {
+	ino, err := v.resolve("getxattr", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return v.xattr(ino.ID, attr)
+}
+
+// ReadDir reads the named directory and returns its entries sorted by filename
+func (v *Volume) ReadDir(name string) ([]fs.DirEntry, error) {
+	ino, err := v.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if ino.Mode&sIFMT != sIFDIR {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return v.readDir(ino.ID)
+}
+
+func (v *Volume) readDir(id uint64) ([]fs.DirEntry, error) {
+	recs, err := v.dirRecords(id)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, 0, len(recs))
+	for _, rec := range recs {
+		entries = append(entries, &dirEntry{v: v, rec: rec})
+	}
+	return entries, nil
+}
+
+func (v *Volume) fileInfo(ino *Inode, name string) (*fileInfo, error) {
+	fi := &fileInfo{name: name, ino: ino}
+	if name == "." || name == "/" {
+		fi.name = "."
+	}
+
+	switch ino.Mode & sIFMT {
+	case sIFREG:
+		if ino.IsCompressed() {
+			hdr, _, err := v.decmpfsHeader(ino)
+			if err != nil {
+				return nil, err
+			}
+			fi.size = int64(hdr.UncompressedSize)
+		} else if ino.dstream != nil {
+			fi.size = int64(ino.dstream.Size)
+		}
+	case sIFLNK:
+		if target, err := v.xattr(ino.ID, xattrSymlinkName); err == nil {
+			fi.size = int64(len(strings.TrimRight(string(target), "\x00")))
+		}
+	}
+
+	return fi, nil
+}
+
+// fileInfo implements fs.FileInfo
+type fileInfo struct {
+	name string
+	size int64
+	ino  *Inode
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() fs.FileMode  { return fi.ino.FileMode() }
+func (fi *fileInfo) ModTime() time.Time { return fi.ino.Modified }
+func (fi *fileInfo) IsDir() bool        { return fi.Mode().IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return fi.ino }
+
+// dirEntry implements fs.DirEntry
+type dirEntry struct {
+	v   *Volume
+	rec dirRecord
+}
+
+func (d *dirEntry) Name() string { return d.rec.name }
+func (d *dirEntry) IsDir() bool  { return d.rec.typ == dtDir }
+
+func (d *dirEntry) Type() fs.FileMode {
+	switch d.rec.typ {
+	case dtDir:
+		return fs.ModeDir
+	case dtLnk:
+		return fs.ModeSymlink
+	case dtChr:
+		return fs.ModeDevice | fs.ModeCharDevice
+	case dtBlk:
+		return fs.ModeDevice
+	case dtFifo:
+		return fs.ModeNamedPipe
+	case dtSock:
+		return fs.ModeSocket
+	}
+	return 0
+}
+
+func (d *dirEntry) Info() (fs.FileInfo, error) {
+	ino, err := d.v.inode(d.rec.fileID)
+	if err != nil {
+		return nil, err
+	}
+	return d.v.fileInfo(ino, d.rec.name)
+}
+
+// file implements fs.File and io.ReaderAt/io.Seeker for non-directories
+type file struct {
+	*io.SectionReader
+	fi *fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.fi, nil }
+func (f *file) Close() error               { return nil }
+
+// dir implements fs.ReadDirFile
+type dir struct {
+	v       *Volume
+	fi      *fileInfo
+	entries []fs.DirEntry
+	offset  int
+	read    bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.fi, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.fi.name, Err: fmt.Errorf("is a directory")}
+}
+
+func (d *dir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.v.readDir(d.fi.ino.ID)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+
+	n := len(d.entries) - d.offset
+	if n == 0 && count > 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && n > count {
+		n = count
+	}
+	list := d.entries[d.offset : d.offset+n]
+	d.offset += n
+
+	return list, nil
+}
+
+type eofReader struct{}
+
+func (eofReader) ReadAt([]byte, int64) (int, error) { return 0, io.EOF }
@@ -0,0 +1,458 @@
+package apfs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	nxMagic   = 0x4253584E // NXSB
+	apfsMagic = 0x42535041 // APSB
+
+	nxMaxFileSystems = 100
+
+	rootDirParentID = 1
+	rootDirInoNum   = 2
+)
+
+// UUID is a 128-bit universally unique identifier
+type UUID [16]byte
+
+func (u UUID) String() string {
+	return fmt.Sprintf("%02X%02X%02X%02X-%02X%02X-%02X%02X-%02X%02X-%02X%02X%02X%02X%02X%02X",
+		u[0], u[1], u[2], u[3], u[4], u[5], u[6], u[7], u[8], u[9], u[10], u[11], u[12], u[13], u[14], u[15])
+}
+
+type oid uint64
+type xid uint64
+type paddr int64
+
+type objType uint32
+
+const (
+	objTypeMask        objType = 0x0000ffff
+	objStorageTypeMask objType = 0xc0000000
+
+	objVirtual   objType = 0x00000000
+	objEphemeral objType = 0x80000000
+	objPhysical  objType = 0x40000000
+
+	objTypeNxSuperblock objType = 0x00000001
+	objTypeBtree        objType = 0x00000002
+	objTypeBtreeNode    objType = 0x00000003
+	objTypeOmap         objType = 0x0000000b
+	objTypeFs           objType = 0x0000000d
+)
+
+func (t objType) Type() objType {
+	return t & objTypeMask
+}
+
+func (t objType) IsPhysical() bool {
+	return t&objStorageTypeMask == objPhysical
+}
+
+// objPhys is the header for every on-disk object (obj_phys_t)
+type objPhys struct {
+	Cksum   uint64
+	Oid     oid
+	Xid     xid
+	Type    objType
+	Subtype objType
+}
+
+type prange struct {
+	StartPaddr paddr
+	BlockCount uint64
+}
+
+// nxSuperblock is the container superblock (nx_superblock_t)
+type nxSuperblock struct {
+	Obj                        objPhys
+	Magic                      uint32
+	BlockSize                  uint32
+	BlockCount                 uint64
+	Features                   uint64
+	ReadonlyCompatibleFeatures uint64
+	IncompatibleFeatures       uint64
+	UUID                       UUID
+	NextOid                    oid
+	NextXid                    xid
+	XpDescBlocks               uint32
+	XpDataBlocks               uint32
+	XpDescBase                 paddr
+	XpDataBase                 paddr
+	XpDescNext                 uint32
+	XpDataNext                 uint32
+	XpDescIndex                uint32
+	XpDescLen                  uint32
+	XpDataIndex                uint32
+	XpDataLen                  uint32
+	SpacemanOid                oid
+	OmapOid                    oid
+	ReaperOid                  oid
+	TestType                   uint32
+	MaxFileSystems             uint32
+	FsOid                      [nxMaxFileSystems]oid
+	Counters                   [32]uint64
+	BlockedOutPrange           prange
+	EvictMappingTreeOid        oid
+	Flags                      uint64
+	EfiJumpstart               paddr
+	FusionUUID                 UUID
+	Keylocker                  prange
+	EphemeralInfo              [4]uint64
+	TestOid                    oid
+	FusionMtOid                oid
+	FusionWbcOid               oid
+	FusionWbc                  prange
+	NewestMountedVersion       uint64
+	MkbLocker                  prange
+}
+
+// omapPhys is an object map (omap_phys_t)
+type omapPhys struct {
+	Obj              objPhys
+	Flags            uint32
+	SnapCount        uint32
+	TreeType         objType
+	SnapshotTreeType objType
+	TreeOid          oid
+	SnapshotTreeOid  oid
+	MostRecentSnap   xid
+	PendingRevertMin xid
+	PendingRevertMax xid
+}
+
+type omapKey struct {
+	Oid oid
+	Xid xid
+}
+
+type omapVal struct {
+	Flags uint32
+	Size  uint32
+	Paddr paddr
+}
+
+type metaCryptoState struct {
+	MajorVersion    uint16
+	MinorVersion    uint16
+	Cpflags         uint32
+	PersistentClass uint32
+	KeyOsVersion    uint32
+	KeyRevision     uint16
+	Unused          uint16
+}
+
+type modifiedBy struct {
+	ID        [32]byte
+	Timestamp uint64
+	LastXid   xid
+}
+
+type volIncompatFeatures uint64
+
+const (
+	volIncompatCaseInsensitive          volIncompatFeatures = 0x00000001
+	volIncompatDatalessSnaps            volIncompatFeatures = 0x00000002
+	volIncompatEncRolled                volIncompatFeatures = 0x00000004
+	volIncompatNormalizationInsensitive volIncompatFeatures = 0x00000008
+	volIncompatIncompleteRestore        volIncompatFeatures = 0x00000010
+	volIncompatSealedVolume             volIncompatFeatures = 0x00000020
+)
+
+// apfsSuperblock is a volume superblock (apfs_superblock_t)
+type apfsSuperblock struct {
+	Obj                        objPhys
+	Magic                      uint32
+	FsIndex                    uint32
+	Features                   uint64
+	ReadonlyCompatibleFeatures uint64
+	IncompatibleFeatures       volIncompatFeatures
+	UnmountTime                uint64
+	FsReserveBlockCount        uint64
+	FsQuotaBlockCount          uint64
+	FsAllocCount               uint64
+	MetaCrypto                 metaCryptoState
+	RootTreeType               objType
+	ExtentrefTreeType          objType
+	SnapMetaTreeType           objType
+	OmapOid                    oid
+	RootTreeOid                oid
+	ExtentrefTreeOid           oid
+	SnapMetaTreeOid            oid
+	RevertToXid                xid
+	RevertToSblockOid          oid
+	NextObjID                  uint64
+	NumFiles                   uint64
+	NumDirectories             uint64
+	NumSymlinks                uint64
+	NumOtherFsobjects          uint64
+	NumSnapshots               uint64
+	TotalBlocksAlloced         uint64
+	TotalBlocksFreed           uint64
+	VolUUID                    UUID
+	LastModTime                uint64
+	FsFlags                    uint64
+	FormattedBy                modifiedBy
+	ModifiedBy                 [8]modifiedBy
+	VolName                    [256]byte
+	NextDocID                  uint32
+	Role                       uint16
+	Reserved                   uint16
+	RootToXid                  xid
+	ErStateOid                 oid
+	CloneinfoIDEpoch           uint64
+	CloneinfoXid               uint64
+	SnapMetaExtOid             oid
+	VolumeGroupID              UUID
+	IntegrityMetaOid           oid
+	FextTreeOid                oid
+	FextTreeType               objType
+	ReservedType               uint32
+	ReservedOid                oid
+}
+
+func (s apfsSuperblock) Name() string {
+	return strings.TrimRight(string(s.VolName[:]), "\x00")
+}
+
+type btNodeFlags uint16
+
+const (
+	btnodeRoot        btNodeFlags = 0x0001
+	btnodeLeaf        btNodeFlags = 0x0002
+	btnodeFixedKVSize btNodeFlags = 0x0004
+	btnodeHashed      btNodeFlags = 0x0008
+	btnodeNoheader    btNodeFlags = 0x0010
+)
+
+type nloc struct {
+	Off uint16
+	Len uint16
+}
+
+// btreeNodePhys is a B-tree node header (btree_node_phys_t)
+type btreeNodePhys struct {
+	Obj         objPhys
+	Flags       btNodeFlags
+	Level       uint16
+	Nkeys       uint32
+	TableSpace  nloc
+	FreeSpace   nloc
+	KeyFreeList nloc
+	ValFreeList nloc
+}
+
+type kvloc struct {
+	K nloc
+	V nloc
+}
+
+type kvoff struct {
+	K uint16
+	V uint16
+}
+
+// btreeInfo is stored at the end of every root node (btree_info_t)
+type btreeInfo struct {
+	Flags      uint32
+	NodeSize   uint32
+	KeySize    uint32
+	ValSize    uint32
+	LongestKey uint32
+	LongestVal uint32
+	KeyCount   uint64
+	NodeCount  uint64
+}
+
+const (
+	btreeNodeHdrSize = 56
+	btreeInfoSize    = 40
+)
+
+type jObjType uint8
+
+const (
+	apfsTypeAny          jObjType = 0
+	apfsTypeSnapMetadata jObjType = 1
+	apfsTypeExtent       jObjType = 2
+	apfsTypeInode        jObjType = 3
+	apfsTypeXattr        jObjType = 4
+	apfsTypeSiblingLink  jObjType = 5
+	apfsTypeDstreamID    jObjType = 6
+	apfsTypeCryptoState  jObjType = 7
+	apfsTypeFileExtent   jObjType = 8
+	apfsTypeDirRec       jObjType = 9
+	apfsTypeDirStats     jObjType = 10
+	apfsTypeSnapName     jObjType = 11
+	apfsTypeSiblingMap   jObjType = 12
+	apfsTypeFileInfo     jObjType = 13
+)
+
+const (
+	objIDMask    = 0x0fffffffffffffff
+	objTypeShift = 60
+	drecLenMask  = 0x000003ff
+	extLenMask   = 0x00ffffffffffffff
+	drecTypeMask = 0x000f
+)
+
+// jInodeVal is the fixed part of an inode record (j_inode_val_t)
+type jInodeVal struct {
+	ParentID               uint64
+	PrivateID              uint64
+	CreateTime             uint64
+	ModTime                uint64
+	ChangeTime             uint64
+	AccessTime             uint64
+	InternalFlags          uint64
+	NchildrenOrNlink       int32
+	DefaultProtectionClass uint32
+	WriteGenerationCounter uint32
+	BsdFlags               uint32
+	Owner                  uint32
+	Group                  uint32
+	Mode                   uint16
+	Pad1                   uint16
+	UncompressedSize       uint64
+}
+
+const (
+	ufCompressed = 0x00000020
+)
+
+type xfType uint8
+
+const (
+	inoExtTypeSnapXid        xfType = 1
+	inoExtTypeDeltaTreeOid   xfType = 2
+	inoExtTypeDocumentID     xfType = 3
+	inoExtTypeName           xfType = 4
+	inoExtTypePrevFsize      xfType = 5
+	inoExtTypeFinderInfo     xfType = 7
+	inoExtTypeDstream        xfType = 8
+	inoExtTypeDirStatsKey    xfType = 10
+	inoExtTypeFsUUID         xfType = 11
+	inoExtTypeSparseBytes    xfType = 13
+	inoExtTypeRdev           xfType = 14
+	inoExtTypePurgeableFlags xfType = 15
+	inoExtTypeOrigSyncRootID xfType = 16
+)
+
+type xfBlob struct {
+	NumExts  uint16
+	UsedData uint16
+}
+
+type xField struct {
+	Type  xfType
+	Flags uint8
+	Size  uint16
+}
+
+// jDstream describes a data stream (j_dstream_t)
+type jDstream struct {
+	Size              uint64
+	AllocedSize       uint64
+	DefaultCryptoID   uint64
+	TotalBytesWritten uint64
+	TotalBytesRead    uint64
+}
+
+type jDrecVal struct {
+	FileID    uint64
+	DateAdded uint64
+	Flags     uint16
+}
+
+type jFileExtentVal struct {
+	LenAndFlags  uint64
+	PhysBlockNum uint64
+	CryptoID     uint64
+}
+
+type fextTreeKey struct {
+	PrivateID   uint64
+	LogicalAddr uint64
+}
+
+type fextTreeVal struct {
+	LenAndFlags  uint64
+	PhysBlockNum uint64
+}
+
+type xattrFlags uint16
+
+const (
+	xattrDataStream      xattrFlags = 0x0001
+	xattrDataEmbedded    xattrFlags = 0x0002
+	xattrFileSystemOwned xattrFlags = 0x0004
+	xattrReserved8       xattrFlags = 0x0008
+)
+
+type jXattrVal struct {
+	Flags    xattrFlags
+	XdataLen uint16
+}
+
+type jXattrDstream struct {
+	XattrObjID uint64
+	Dstream    jDstream
+}
+
+const (
+	xattrSymlinkName      = "com.apple.fs.symlink"
+	xattrDecmpfsName      = "com.apple.decmpfs"
+	xattrResourceForkName = "com.apple.ResourceFork"
+)
+
+// Dirent types (DT_*)
+type dirType uint16
+
+const (
+	dtUnknown dirType = 0
+	dtFifo    dirType = 1
+	dtChr     dirType = 2
+	dtDir     dirType = 4
+	dtBlk     dirType = 6
+	dtReg     dirType = 8
+	dtLnk     dirType = 10
+	dtSock    dirType = 12
+	dtWht     dirType = 14
+)
+
+// mode_t file types
+const (
+	sIFMT   = 0170000
+	sIFIFO  = 0010000
+	sIFCHR  = 0020000
+	sIFDIR  = 0040000
+	sIFBLK  = 0060000
+	sIFREG  = 0100000
+	sIFLNK  = 0120000
+	sIFSOCK = 0140000
+)
+
+// apfsTime converts an APFS timestamp (nanoseconds since 1970) to a time.Time
+func apfsTime(t uint64) time.Time {
+	return time.Unix(0, int64(t))
+}
+
+// FormatError is returned when an on-disk structure is malformed
+type FormatError struct {
+	off int64
+	msg string
+	val interface{}
+}
+
+func (e *FormatError) Error() string {
+	msg := e.msg
+	if e.val != nil {
+		msg += fmt.Sprintf(" '%v'", e.val)
+	}
+	msg += fmt.Sprintf(" in block at byte %#x", e.off)
+	return msg
+}
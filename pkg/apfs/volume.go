@@ -0,0 +1,550 @@
+package apfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+const apfsFsUnencrypted = 0x00000001
+
+// Volume is an APFS volume inside a Container
+type Volume struct {
+	Name string
+	UUID UUID
+	Role uint16
+
+	c          *Container
+	sb         apfsSuperblock
+	omap       *objectMap
+	fsTree     *btree
+	fextTree   *btree
+	hashedKeys bool
+}
+
+func (c *Container) openVolume(fsOid oid) (*Volume, error) {
+	val, err := c.omap.lookup(fsOid, c.sb.Obj.Xid)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.readBlock(val.Paddr)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Volume{c: c}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &v.sb); err != nil {
+		return nil, errors.Wrap(err, "failed to parse volume superblock")
+	}
+	if v.sb.Magic != apfsMagic {
+		return nil, &FormatError{int64(val.Paddr) * int64(c.blockSize), "invalid volume superblock magic", v.sb.Magic}
+	}
+
+	v.Name = v.sb.Name()
+	v.UUID = v.sb.VolUUID
+	v.Role = v.sb.Role
+	v.hashedKeys = v.sb.IncompatibleFeatures&(volIncompatCaseInsensitive|volIncompatNormalizationInsensitive) != 0
+
+	log.WithFields(log.Fields{
+		"name":   v.Name,
+		"uuid":   v.UUID,
+		"sealed": v.IsSealed(),
+	}).Debug("APFS Volume")
+
+	if v.sb.FsFlags&apfsFsUnencrypted == 0 {
+		log.Warnf("volume %s is encrypted; file contents will not be readable", v.Name)
+	}
+
+	v.omap, err = c.readObjectMap(paddr(v.sb.OmapOid))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read volume object map")
+	}
+
+	v.fsTree, err = c.newBtree(v.sb.RootTreeOid, v.sb.RootTreeType.IsPhysical(), v.omap, v.sb.Obj.Xid)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read volume file-system tree")
+	}
+
+	if v.IsSealed() && v.sb.FextTreeOid != 0 {
+		v.fextTree, err = c.newBtree(v.sb.FextTreeOid, true, nil, 0)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read volume file extent tree")
+		}
+	}
+
+	return v, nil
+}
+
+// IsSealed returns true if the volume is a signed system volume
+func (v *Volume) IsSealed() bool {
+	return v.sb.IncompatibleFeatures&volIncompatSealedVolume != 0
+}
+
+// records calls fn for every file-system record with the given object id and type (apfsTypeAny matches all types)
+func (v *Volume) records(id uint64, typ jObjType, fn func(key, val []byte) error) error {
+	return v.fsTree.walk(func(key []byte) int {
+		hdr := binary.LittleEndian.Uint64(key)
+		kid, kt := hdr&objIDMask, jObjType(hdr>>objTypeShift)
+		switch {
+		case kid < id:
+			return -1
+		case kid > id:
+			return 1
+		case typ == apfsTypeAny:
+			return 0
+		case kt < typ:
+			return -1
+		case kt > typ:
+			return 1
+		}
+		return 0
+	}, fn)
+}
+
+// Inode holds the APFS specific metadata of a file-system object
+type Inode struct {
+	ID        uint64
+	ParentID  uint64
+	PrivateID uint64
+	Name      string
+	Uid       uint32
+	Gid       uint32
+	Mode      uint16
+	BsdFlags  uint32
+	Nlink     int32
+	Rdev      uint32
+	Created   time.Time
+	Modified  time.Time
+	Changed   time.Time
+	Accessed  time.Time
+
+	dstream *jDstream
+}
+
+// IsCompressed returns true if the file's data is stored decmpfs compressed
+func (i *Inode) IsCompressed() bool {
+	return i.BsdFlags&ufCompressed != 0
+}
+
+// FileMode returns the inode's mode as an fs.FileMode
+func (i *Inode) FileMode() fs.FileMode {
+	mode := fs.FileMode(i.Mode & 0777)
+	if i.Mode&04000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if i.Mode&02000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if i.Mode&01000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	switch i.Mode & sIFMT {
+	case sIFDIR:
+		mode |= fs.ModeDir
+	case sIFLNK:
+		mode |= fs.ModeSymlink
+	case sIFCHR:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case sIFBLK:
+		mode |= fs.ModeDevice
+	case sIFIFO:
+		mode |= fs.ModeNamedPipe
+	case sIFSOCK:
+		mode |= fs.ModeSocket
+	}
+	return mode
+}
+
+func (v *Volume) inode(id uint64) (*Inode, error) {
+	var ino *Inode
+	err := v.records(id, apfsTypeInode, func(key, val []byte) error {
+		var err error
+		ino, err = parseInode(id, val)
+		if err != nil {
+			return err
+		}
+		return errStop
+	})
+	if err != nil && err != errStop {
+		return nil, err
+	}
+	if ino == nil {
+		return nil, fmt.Errorf("inode %d not found", id)
+	}
+	return ino, nil
+}
+
+func parseInode(id uint64, val []byte) (*Inode, error) {
+	var iv jInodeVal
+
+	r := bytes.NewReader(val)
+	if err := binary.Read(r, binary.LittleEndian, &iv); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse inode %d", id)
+	}
+
+	ino := &Inode{
+		ID:        id,
+		ParentID:  iv.ParentID,
+		PrivateID: iv.PrivateID,
+		Uid:       iv.Owner,
+		Gid:       iv.Group,
+		Mode:      iv.Mode,
+		BsdFlags:  iv.BsdFlags,
+		Nlink:     iv.NchildrenOrNlink,
+		Created:   apfsTime(iv.CreateTime),
+		Modified:  apfsTime(iv.ModTime),
+		Changed:   apfsTime(iv.ChangeTime),
+		Accessed:  apfsTime(iv.AccessTime),
+	}
+
+	err := parseXFields(val[binary.Size(iv):], func(typ xfType, data []byte) error {
+		switch typ {
+		case inoExtTypeName:
+			ino.Name = string(bytes.TrimRight(data, "\x00"))
+		case inoExtTypeDstream:
+			ino.dstream = &jDstream{}
+			return binary.Read(bytes.NewReader(data), binary.LittleEndian, ino.dstream)
+		case inoExtTypeRdev:
+			if len(data) >= 4 {
+				ino.Rdev = binary.LittleEndian.Uint32(data)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse inode %d extended fields", id)
+	}
+
+	return ino, nil
+}
+
+// parseXFields walks an xf_blob_t of extended fields
+func parseXFields(data []byte, fn func(typ xfType, data []byte) error) error {
+	if len(data) < binary.Size(xfBlob{}) {
+		return nil
+	}
+
+	r := bytes.NewReader(data)
+
+	var blob xfBlob
+	if err := binary.Read(r, binary.LittleEndian, &blob); err != nil {
+		return err
+	}
+
+	fields := make([]xField, blob.NumExts)
+	if err := binary.Read(r, binary.LittleEndian, &fields); err != nil {
+		return err
+	}
+
+	off := binary.Size(blob) + binary.Size(fields)
+	for _, f := range fields {
+		if off+int(f.Size) > len(data) {
+			return fmt.Errorf("extended field %d overruns record", f.Type)
+		}
+		if err := fn(f.Type, data[off:off+int(f.Size)]); err != nil {
+			return err
+		}
+		off += (int(f.Size) + 7) &^ 7
+	}
+
+	return nil
+}
+
+type dirRecord struct {
+	name    string
+	fileID  uint64
+	typ     dirType
+	dateAdd time.Time
+}
+
+// dirRecords returns the directory entries of the directory inode id
+func (v *Volume) dirRecords(id uint64) ([]dirRecord, error) {
+	var recs []dirRecord
+
+	err := v.records(id, apfsTypeDirRec, func(key, val []byte) error {
+		name, err := v.drecName(key)
+		if err != nil {
+			return err
+		}
+		var dv jDrecVal
+		if err := binary.Read(bytes.NewReader(val), binary.LittleEndian, &dv); err != nil {
+			return errors.Wrapf(err, "failed to parse directory record %s", name)
+		}
+		recs = append(recs, dirRecord{
+			name:    name,
+			fileID:  dv.FileID,
+			typ:     dirType(dv.Flags & drecTypeMask),
+			dateAdd: apfsTime(dv.DateAdded),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].name < recs[j].name
+	})
+
+	return recs, nil
+}
+
+// drecName decodes the name from a j_drec_key_t or j_drec_hashed_key_t
+func (v *Volume) drecName(key []byte) (string, error) {
+	if v.hashedKeys && len(key) >= 12 {
+		nameLen := int(binary.LittleEndian.Uint32(key[8:]) & drecLenMask)
+		if 12+nameLen == len(key) {
+			return string(bytes.TrimRight(key[12:], "\x00")), nil
+		}
+	}
+	if len(key) >= 10 {
+		nameLen := int(binary.LittleEndian.Uint16(key[8:]))
+		if 10+nameLen == len(key) {
+			return string(bytes.TrimRight(key[10:], "\x00")), nil
+		}
+	}
+	if len(key) >= 12 { // volume flags did not match the key format
+		return string(bytes.TrimRight(key[12:], "\x00")), nil
+	}
+	return "", fmt.Errorf("malformed directory record key")
+}
+
+type extent struct {
+	logical uint64
+	length  uint64
+	phys    uint64
+}
+
+// extents returns the sorted file extents of the data stream with the given private id
+func (v *Volume) extents(privateID uint64) ([]extent, error) {
+	var exts []extent
+
+	if v.fextTree != nil {
+		err := v.fextTree.walk(func(key []byte) int {
+			id := binary.LittleEndian.Uint64(key)
+			switch {
+			case id < privateID:
+				return -1
+			case id > privateID:
+				return 1
+			}
+			return 0
+		}, func(key, val []byte) error {
+			var fk fextTreeKey
+			var fv fextTreeVal
+			binary.Read(bytes.NewReader(key), binary.LittleEndian, &fk)
+			if err := binary.Read(bytes.NewReader(val), binary.LittleEndian, &fv); err != nil {
+				return err
+			}
+			exts = append(exts, extent{fk.LogicalAddr, fv.LenAndFlags & extLenMask, fv.PhysBlockNum})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(exts) == 0 {
+		err := v.records(privateID, apfsTypeFileExtent, func(key, val []byte) error {
+			var fv jFileExtentVal
+			if err := binary.Read(bytes.NewReader(val), binary.LittleEndian, &fv); err != nil {
+				return err
+			}
+			exts = append(exts, extent{binary.LittleEndian.Uint64(key[8:]), fv.LenAndFlags & extLenMask, fv.PhysBlockNum})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(exts, func(i, j int) bool {
+		return exts[i].logical < exts[j].logical
+	})
+
+	return exts, nil
+}
+
+// extentReader is an io.ReaderAt over a data stream's extents
+type extentReader struct {
+	c       *Container
+	extents []extent
+	size    int64
+}
+
+func (v *Volume) dataStream(privateID uint64, size uint64) (*extentReader, error) {
+	exts, err := v.extents(privateID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read extents for data stream %d", privateID)
+	}
+	return &extentReader{c: v.c, extents: exts, size: int64(size)}, nil
+}
+
+func (r *extentReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	var err error
+	if remain := r.size - off; int64(len(p)) > remain {
+		p = p[:remain]
+		err = io.EOF
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := uint64(off) + uint64(n)
+		i := sort.Search(len(r.extents), func(i int) bool {
+			return r.extents[i].logical+r.extents[i].length > pos
+		})
+		if i == len(r.extents) || r.extents[i].logical > pos { // hole
+			end := uint64(off) + uint64(len(p))
+			if i < len(r.extents) && r.extents[i].logical < end {
+				end = r.extents[i].logical
+			}
+			for ; pos < end; pos++ {
+				p[n] = 0
+				n++
+			}
+			continue
+		}
+
+		e := r.extents[i]
+		chunk := p[n:]
+		if avail := e.logical + e.length - pos; uint64(len(chunk)) > avail {
+			chunk = chunk[:avail]
+		}
+		if e.phys == 0 { // sparse
+			for j := range chunk {
+				chunk[j] = 0
+			}
+		} else if _, rerr := r.c.r.ReadAt(chunk, int64(e.phys)*int64(r.c.blockSize)+int64(pos-e.logical)); rerr != nil {
+			return n, rerr
+		}
+		n += len(chunk)
+	}
+
+	return n, err
+}
+
+// xattr returns the data of the named extended attribute of inode id
+func (v *Volume) xattr(id uint64, name string) ([]byte, error) {
+	var data []byte
+	var found bool
+
+	err := v.records(id, apfsTypeXattr, func(key, val []byte) error {
+		if xattrKeyName(key) != name {
+			return nil
+		}
+		found = true
+		var err error
+		data, err = v.xattrData(val)
+		if err != nil {
+			return err
+		}
+		return errStop
+	})
+	if err != nil && err != errStop {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("xattr %s not found: %w", name, fs.ErrNotExist)
+	}
+
+	return data, nil
+}
+
+// xattrReader returns an io.ReaderAt over the named extended attribute of inode id without reading it into memory
+func (v *Volume) xattrReader(id uint64, name string) (io.ReaderAt, int64, error) {
+	var r io.ReaderAt
+	var size int64
+
+	err := v.records(id, apfsTypeXattr, func(key, val []byte) error {
+		if xattrKeyName(key) != name {
+			return nil
+		}
+		var xv jXattrVal
+		if err := binary.Read(bytes.NewReader(val), binary.LittleEndian, &xv); err != nil {
+			return err
+		}
+		xdata := val[binary.Size(xv):]
+		if xv.Flags&xattrDataStream != 0 {
+			var ds jXattrDstream
+			if err := binary.Read(bytes.NewReader(xdata), binary.LittleEndian, &ds); err != nil {
+				return err
+			}
+			er, err := v.dataStream(ds.XattrObjID, ds.Dstream.Size)
+			if err != nil {
+				return err
+			}
+			r, size = er, int64(ds.Dstream.Size)
+		} else {
+			r, size = bytes.NewReader(xdata), int64(len(xdata))
+		}
+		return errStop
+	})
+	if err != nil && err != errStop {
+		return nil, 0, err
+	}
+	if r == nil {
+		return nil, 0, fmt.Errorf("xattr %s not found: %w", name, fs.ErrNotExist)
+	}
+
+	return r, size, nil
+}
+
+func (v *Volume) xattrData(val []byte) ([]byte, error) {
+	var xv jXattrVal
+	if err := binary.Read(bytes.NewReader(val), binary.LittleEndian, &xv); err != nil {
+		return nil, err
+	}
+	xdata := val[binary.Size(xv):]
+
+	if xv.Flags&xattrDataStream == 0 {
+		return xdata, nil
+	}
+
+	var ds jXattrDstream
+	if err := binary.Read(bytes.NewReader(xdata), binary.LittleEndian, &ds); err != nil {
+		return nil, err
+	}
+	r, err := v.dataStream(ds.XattrObjID, ds.Dstream.Size)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, ds.Dstream.Size)
+	if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func xattrKeyName(key []byte) string {
+	if len(key) < 10 {
+		return ""
+	}
+	nameLen := int(binary.LittleEndian.Uint16(key[8:]))
+	if 10+nameLen > len(key) {
+		nameLen = len(key) - 10
+	}
+	return string(bytes.TrimRight(key[10:10+nameLen], "\x00"))
+}
+
+// xattrNames returns the names of all extended attributes of inode id
+func (v *Volume) xattrNames(id uint64) ([]string, error) {
+	var names []string
+	err := v.records(id, apfsTypeXattr, func(key, val []byte) error {
+		names = append(names, xattrKeyName(key))
+		return nil
+	})
+	return names, err
+}
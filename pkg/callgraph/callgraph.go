@@ -0,0 +1,163 @@
+// Package callgraph builds the call graphs of MachOs and dyld_shared_cache images
+// and exports them as DOT, JSON or GraphML.
+package callgraph
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/apex/log"
+)
+
+// Function is a function's address range
+type Function struct {
+	Start uint64
+	End   uint64
+}
+
+// Program is the code a call graph is built from
+type Program interface {
+	// Function returns the function containing addr
+	Function(addr uint64) (Function, error)
+	// Callees returns the resolved targets of the calls and tail calls in a function
+	Callees(fn Function) ([]uint64, error)
+	// Name returns the symbol name of addr and the image it is in
+	Name(addr uint64) (string, string)
+}
+
+// Node is a function in the call graph
+type Node struct {
+	Addr  uint64 `json:"addr"`
+	Name  string `json:"name"`
+	Image string `json:"image,omitempty"`
+}
+
+// Label returns the node's symbol name or a func_<addr> placeholder
+func (n *Node) Label() string {
+	if len(n.Name) > 0 {
+		return n.Name
+	}
+	return fmt.Sprintf("func_%x", n.Addr)
+}
+
+// Edge is a call from one function to another
+type Edge struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// Graph is a call graph
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []Edge  `json:"edges"`
+
+	nodes map[uint64]*Node
+	edges map[Edge]bool
+}
+
+// New returns an empty call graph
+func New() *Graph {
+	return &Graph{
+		nodes: make(map[uint64]*Node),
+		edges: make(map[Edge]bool),
+	}
+}
+
+// Node returns the node at addr (or nil)
+func (g *Graph) Node(addr uint64) *Node {
+	return g.nodes[addr]
+}
+
+// AddNode adds a function to the graph (if NOT already present)
+func (g *Graph) AddNode(addr uint64, name, image string) *Node {
+	if n, ok := g.nodes[addr]; ok {
+		return n
+	}
+	n := &Node{Addr: addr, Name: name, Image: image}
+	g.nodes[addr] = n
+	g.Nodes = append(g.Nodes, n)
+	return n
+}
+
+// AddEdge adds a call from one function to another (if NOT already present)
+func (g *Graph) AddEdge(from, to uint64) {
+	e := Edge{From: from, To: to}
+	if g.edges[e] {
+		return
+	}
+	g.edges[e] = true
+	g.Edges = append(g.Edges, e)
+}
+
+// Sort sorts the nodes and edges by address
+func (g *Graph) Sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].Addr < g.Nodes[j].Addr })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+}
+
+// Build builds the call graph of the functions reachable from the roots in at most depth calls (0 is unlimited)
+func Build(p Program, roots []uint64, depth int) (*Graph, error) {
+	g := New()
+
+	type work struct {
+		addr  uint64
+		depth int
+	}
+
+	var queue []work
+	visited := make(map[uint64]bool)
+	for _, root := range roots {
+		fn, err := p.Function(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find function at %#x: %v", root, err)
+		}
+		if !visited[fn.Start] {
+			visited[fn.Start] = true
+			name, image := p.Name(fn.Start)
+			g.AddNode(fn.Start, name, image)
+			queue = append(queue, work{addr: fn.Start})
+		}
+	}
+
+	for len(queue) > 0 {
+		w := queue[0]
+		queue = queue[1:]
+
+		if depth > 0 && w.depth >= depth {
+			continue
+		}
+
+		fn, err := p.Function(w.addr)
+		if err != nil {
+			continue // an import or a function outside the program
+		}
+		callees, err := p.Callees(fn)
+		if err != nil {
+			log.Warnf("skipping the callees of %#x: %v", fn.Start, err)
+			continue
+		}
+
+		for _, callee := range callees {
+			// calls into the middle of a function are attributed to the function
+			if cfn, err := p.Function(callee); err == nil {
+				callee = cfn.Start
+			}
+			name, image := p.Name(callee)
+			g.AddNode(callee, name, image)
+			g.AddEdge(fn.Start, callee)
+			if !visited[callee] {
+				visited[callee] = true
+				queue = append(queue, work{addr: callee, depth: w.depth + 1})
+			}
+		}
+	}
+
+	g.Sort()
+
+	return g, nil
+}
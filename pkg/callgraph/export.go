@@ -0,0 +1,144 @@
+package callgraph
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+)
+
+// Formats are the supported call graph output formats
+var Formats = []string{"dot", "json", "graphml"}
+
+// Write writes the call graph to w in the given format
+func (g *Graph) Write(w io.Writer, format string) error {
+	switch format {
+	case "dot":
+		return g.WriteDOT(w)
+	case "json":
+		return g.WriteJSON(w)
+	case "graphml":
+		return g.WriteGraphML(w)
+	default:
+		return fmt.Errorf("unsupported call graph format %s (supported: %v)", format, Formats)
+	}
+}
+
+func nodeID(addr uint64) string {
+	return fmt.Sprintf("n%x", addr)
+}
+
+// WriteDOT writes the call graph as a Graphviz DOT digraph (clustered by image)
+func (g *Graph) WriteDOT(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "digraph callgraph {\n\tnode [shape=box, fontname=\"Menlo\"];"); err != nil {
+		return err
+	}
+
+	var images []string
+	byImage := make(map[string][]*Node)
+	for _, n := range g.Nodes {
+		if _, ok := byImage[n.Image]; !ok {
+			images = append(images, n.Image)
+		}
+		byImage[n.Image] = append(byImage[n.Image], n)
+	}
+	for idx, image := range images {
+		indent := "\t"
+		if len(image) > 0 {
+			fmt.Fprintf(w, "\tsubgraph cluster_%d {\n\t\tlabel=%s;\n", idx, strconv.Quote(filepath.Base(image)))
+			indent = "\t\t"
+		}
+		for _, n := range byImage[image] {
+			fmt.Fprintf(w, "%s%s [label=%s];\n", indent, nodeID(n.Addr), strconv.Quote(n.Label()))
+		}
+		if len(image) > 0 {
+			fmt.Fprintln(w, "\t}")
+		}
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(w, "\t%s -> %s;\n", nodeID(e.From), nodeID(e.To))
+	}
+
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// WriteJSON writes the call graph as JSON
+func (g *Graph) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(g)
+}
+
+type graphmlKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphmlNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+type graphml struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphmlKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphmlNode `xml:"node"`
+		Edges       []graphmlEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// WriteGraphML writes the call graph as GraphML
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphml{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphmlKey{
+			{ID: "name", For: "node", Name: "name", Type: "string"},
+			{ID: "addr", For: "node", Name: "addr", Type: "string"},
+			{ID: "image", For: "node", Name: "image", Type: "string"},
+		},
+	}
+	doc.Graph.ID = "callgraph"
+	doc.Graph.EdgeDefault = "directed"
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphmlNode{
+			ID: nodeID(n.Addr),
+			Data: []graphmlData{
+				{Key: "name", Value: n.Label()},
+				{Key: "addr", Value: fmt.Sprintf("%#x", n.Addr)},
+				{Key: "image", Value: n.Image},
+			},
+		})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphmlEdge{Source: nodeID(e.From), Target: nodeID(e.To)})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
@@ -0,0 +1,154 @@
+package callgraph
+
+import (
+	"bytes"
+
+	"github.com/blacktop/go-arm64"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/emu"
+)
+
+type machoProgram struct {
+	m       *macho.File
+	image   string
+	stubs   map[uint64]uint64 // symbol stub => GOT entry
+	imports map[uint64]string // GOT entry => imported symbol
+	dylibs  map[uint64]string // GOT entry => imported symbol's dylib
+}
+
+// NewMachO returns the Program of an arm64 MachO (calls to imports are resolved through its symbol stubs)
+func NewMachO(m *macho.File, image string) (Program, error) {
+	p := &machoProgram{
+		m:       m,
+		image:   image,
+		stubs:   make(map[uint64]uint64),
+		imports: make(map[uint64]string),
+		dylibs:  make(map[uint64]string),
+	}
+
+	if m.HasFixups() {
+		dcf, err := m.DyldChainedFixups()
+		if err != nil {
+			return nil, err
+		}
+		for _, start := range dcf.Starts {
+			if start.PageStarts != nil {
+				for _, bind := range start.Binds() {
+					p.imports[m.GetBaseAddress()+bind.Offset()] = bind.Name()
+					if int(bind.Ordinal()) < len(dcf.Imports) {
+						p.dylibs[m.GetBaseAddress()+bind.Offset()] = m.LibraryOrdinalName(dcf.Imports[bind.Ordinal()].LibOrdinal())
+					}
+				}
+			}
+		}
+	} else if binds, err := m.GetBindInfo(); err == nil {
+		for _, bind := range binds {
+			p.imports[bind.Start+bind.Offset] = bind.Name
+			p.dylibs[bind.Start+bind.Offset] = bind.Dylib
+		}
+	}
+
+	for _, sec := range m.Sections {
+		if !sec.Flags.IsSymbolStubs() {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, err
+		}
+		// adrp x16, page ; ldr x16, [x16, #off] ; br x16
+		// adrp x17, page ; add x17, x17, #off ; ldr x16, [x17] ; braa x16, x17
+		var prevInstruction arm64.Instruction
+		for i := range arm64.Disassemble(bytes.NewReader(data), arm64.Options{StartAddress: int64(sec.Addr)}) {
+			if i.Error != nil {
+				continue
+			}
+			operation := i.Instruction.Operation()
+			if (operation == arm64.ARM64_LDR || operation == arm64.ARM64_ADD) && prevInstruction.Operation() == arm64.ARM64_ADRP {
+				if operands := i.Instruction.Operands(); operands != nil && prevInstruction.Operands() != nil {
+					adrpRegister := prevInstruction.Operands()[0].Reg[0]
+					adrpImm := prevInstruction.Operands()[1].Immediate
+					if operation == arm64.ARM64_LDR && adrpRegister == operands[1].Reg[0] {
+						adrpImm += operands[1].Immediate
+					} else if operation == arm64.ARM64_ADD && adrpRegister == operands[1].Reg[0] {
+						adrpImm += operands[2].Immediate
+					}
+					p.stubs[prevInstruction.Address()] = adrpImm
+				}
+			}
+			prevInstruction = *i.Instruction
+		}
+	}
+
+	return p, nil
+}
+
+func (p *machoProgram) Function(addr uint64) (Function, error) {
+	fn, err := p.m.GetFunctionForVMAddr(addr)
+	if err != nil {
+		return Function{}, err
+	}
+	return Function{Start: fn.StartAddr, End: fn.EndAddr}, nil
+}
+
+func (p *machoProgram) Callees(fn Function) ([]uint64, error) {
+	off, err := p.m.GetOffset(fn.Start)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, fn.End-fn.Start)
+	if _, err := p.m.ReadAt(data, int64(off)); err != nil {
+		return nil, err
+	}
+	targets := branchTargets(data, fn)
+	// switch cases dispatched out of the function
+	if sec := p.m.FindSectionForVMAddr(fn.Start); sec != nil {
+		for _, jt := range emu.FindJumpTables(emu.MachO(p.m), data, fn.Start, sec.Addr, sec.Addr+sec.Size) {
+			for _, target := range jt.UniqueTargets() {
+				if target < fn.Start || target >= fn.End {
+					targets = append(targets, target)
+				}
+			}
+		}
+	}
+	return targets, nil
+}
+
+func (p *machoProgram) Name(addr uint64) (string, string) {
+	if got, ok := p.stubs[addr]; ok {
+		if name, ok := p.imports[got]; ok {
+			return name, p.dylibs[got]
+		}
+	}
+	if p.m.Symtab != nil {
+		if syms, err := p.m.FindAddressSymbols(addr); err == nil {
+			for _, sym := range syms {
+				if len(sym.Name) > 0 {
+					return sym.Name, p.image
+				}
+			}
+		}
+	}
+	return "", p.image
+}
+
+// branchTargets returns the targets of the calls and the branches out of a function
+func branchTargets(data []byte, fn Function) []uint64 {
+	var targets []uint64
+	for i := range arm64.Disassemble(bytes.NewReader(data), arm64.Options{StartAddress: int64(fn.Start)}) {
+		if i.Error != nil {
+			continue
+		}
+		if op := i.Instruction.Operation(); op != arm64.ARM64_BL && op != arm64.ARM64_B {
+			continue
+		}
+		for _, operand := range i.Instruction.Operands() {
+			if operand.OpClass == arm64.LABEL {
+				if target := operand.Immediate; target < fn.Start || target >= fn.End {
+					targets = append(targets, target)
+				}
+			}
+		}
+	}
+	return targets
+}
@@ -0,0 +1,522 @@
+// Package classdump parses the Objective-C runtime metadata of MachOs and dyld_shared_cache
+// images and generates the Objective-C headers for their classes, protocols and categories.
+package classdump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/vmreader"
+	"github.com/pkg/errors"
+)
+
+// ErrNoObjC is the error for an image that has no Objective-C metadata
+var ErrNoObjC = errors.New("image does NOT contain objc metadata")
+
+const (
+	maxCount = 0x10000 // sanity limit for list counts
+)
+
+// Reader reads an image's memory by (unslid) virtual address
+type Reader = vmreader.Reader
+
+// A BindReader is a Reader that can also return the name of the symbol
+// a pointer is bound to (used for classes imported from other images)
+type BindReader = vmreader.BindReader
+
+// An ImageReader is a Reader that can also return the image a pointer points into or is bound to
+// (used to import the classes and protocols defined in other images)
+type ImageReader = vmreader.ImageReader
+
+// A SelectorBaseReader is a Reader for a dyld_shared_cache where the selectors of
+// small method lists are offsets from the relative method selector base address
+type SelectorBaseReader interface {
+	Reader
+	RelativeSelectorBase() uint64
+}
+
+// Section is an Objective-C metadata section
+type Section struct {
+	Name string
+	Addr uint64
+	Size uint64
+}
+
+type parser struct {
+	r       Reader
+	img     *Image
+	selrefs []Section
+	selBase uint64
+	names   map[uint64]string // class names cache
+}
+
+// Parse parses the Objective-C classes, protocols and categories in the given sections
+func Parse(r Reader, sections []Section) (*Image, error) {
+	var img Image
+
+	p := &parser{r: r, img: &img, names: make(map[uint64]string)}
+	if sr, ok := r.(SelectorBaseReader); ok {
+		p.selBase = sr.RelativeSelectorBase()
+	}
+	for _, sec := range sections {
+		if sec.Name == "__objc_selrefs" {
+			p.selrefs = append(p.selrefs, sec)
+		}
+	}
+
+	found := false
+	for _, sec := range sections {
+		var err error
+		switch sec.Name {
+		case "__objc_classlist":
+			err = p.forEachPointer(sec, func(addr uint64) error {
+				c, err := p.parseClass(addr)
+				if err != nil {
+					return err
+				}
+				img.Classes = append(img.Classes, c)
+				return nil
+			})
+		case "__objc_protolist":
+			err = p.forEachPointer(sec, func(addr uint64) error {
+				proto, err := p.parseProtocol(addr)
+				if err != nil {
+					return err
+				}
+				img.Protocols = append(img.Protocols, proto)
+				return nil
+			})
+		case "__objc_catlist":
+			err = p.forEachPointer(sec, func(addr uint64) error {
+				cat, err := p.parseCategory(addr)
+				if err != nil {
+					return err
+				}
+				img.Categories = append(img.Categories, cat)
+				return nil
+			})
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", sec.Name)
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, ErrNoObjC
+	}
+
+	return &img, nil
+}
+
+/*
+ * Memory access
+ */
+
+func (p *parser) read(addr uint64, v interface{}) error {
+	buf := make([]byte, binary.Size(v))
+	if _, err := p.r.ReadAtAddr(buf, addr); err != nil {
+		return fmt.Errorf("failed to read %T at %#x: %v", v, addr, err)
+	}
+	return binary.Read(bytes.NewReader(buf), binary.LittleEndian, v)
+}
+
+// pointer returns the target of the pointer at addr
+func (p *parser) pointer(addr uint64) (uint64, error) {
+	ptr, err := p.r.ReadPointerAtAddr(addr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read pointer at %#x: %v", addr, err)
+	}
+	return ptr, nil
+}
+
+// stringAt reads the cstring the pointer at addr points to
+func (p *parser) stringAt(addr uint64) (string, error) {
+	ptr, err := p.pointer(addr)
+	if err != nil {
+		return "", err
+	}
+	return vmreader.ReadCString(p.r, ptr)
+}
+
+// imported records the image defining the class or protocol the pointer at addr points to (if it is in another image)
+func (p *parser) imported(images *map[string]string, name string, addr uint64) {
+	ir, ok := p.r.(ImageReader)
+	if !ok || len(name) == 0 {
+		return
+	}
+	if image, ok := ir.ImageAtAddr(addr); ok {
+		if *images == nil {
+			*images = make(map[string]string)
+		}
+		(*images)[name] = image
+	}
+}
+
+// bindName returns the name of the symbol the pointer at addr is bound to
+func (p *parser) bindName(addr uint64) string {
+	if br, ok := p.r.(BindReader); ok {
+		if name, ok := br.BindNameAtAddr(addr); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+func (p *parser) forEachPointer(sec Section, handler func(addr uint64) error) error {
+	for off := uint64(0); off+8 <= sec.Size; off += 8 {
+		ptr, err := p.pointer(sec.Addr + off)
+		if err != nil {
+			return err
+		}
+		if ptr == 0 {
+			continue
+		}
+		if err := handler(ptr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) isSelRef(addr uint64) bool {
+	for _, sec := range p.selrefs {
+		if addr >= sec.Addr && addr < sec.Addr+sec.Size {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Runtime structures
+ */
+
+func (p *parser) readList(addr uint64) (listHeader, error) {
+	var l listHeader
+	if err := p.read(addr, &l); err != nil {
+		return l, err
+	}
+	if l.Count > maxCount {
+		return l, fmt.Errorf("invalid list count %d at %#x", l.Count, addr)
+	}
+	return l, nil
+}
+
+func (p *parser) parseMethods(addr uint64) ([]Method, error) {
+	if addr == 0 {
+		return nil, nil
+	}
+	l, err := p.readList(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var methods []Method
+	small := l.EntSizeAndFlags&smallMethodListFlag != 0
+	for i := uint64(0); i < uint64(l.Count); i++ {
+		maddr := addr + uint64(binary.Size(l)) + i*uint64(l.entSize())
+		var m Method
+		if small {
+			// relative offsets to the selector (ref), the types and the imp
+			var rel [3]int32
+			if err := p.read(maddr, &rel); err != nil {
+				return nil, err
+			}
+			name := uint64(int64(maddr) + int64(rel[0]))
+			if p.selBase != 0 {
+				name = uint64(int64(p.selBase) + int64(rel[0]))
+			} else if p.isSelRef(name) {
+				if name, err = p.pointer(name); err != nil {
+					return nil, err
+				}
+			}
+			if m.Name, err = vmreader.ReadCString(p.r, name); err != nil {
+				return nil, err
+			}
+			if m.Types, err = vmreader.ReadCString(p.r, uint64(int64(maddr+4)+int64(rel[1]))); err != nil {
+				return nil, err
+			}
+			if rel[2] != 0 {
+				m.Imp = uint64(int64(maddr+8) + int64(rel[2]))
+			}
+		} else {
+			if m.Name, err = p.stringAt(maddr); err != nil {
+				return nil, err
+			}
+			if m.Types, err = p.stringAt(maddr + 8); err != nil {
+				return nil, err
+			}
+			if m.Imp, err = p.pointer(maddr + 16); err != nil {
+				return nil, err
+			}
+		}
+		methods = append(methods, m)
+	}
+
+	return methods, nil
+}
+
+func (p *parser) parseIvars(addr uint64) ([]Ivar, error) {
+	if addr == 0 {
+		return nil, nil
+	}
+	l, err := p.readList(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var ivars []Ivar
+	for i := uint64(0); i < uint64(l.Count); i++ {
+		iaddr := addr + uint64(binary.Size(l)) + i*uint64(l.entSize())
+		var it ivarT
+		if err := p.read(iaddr, &it); err != nil {
+			return nil, err
+		}
+		ivar := Ivar{Size: it.Size}
+		if ivar.Name, err = p.stringAt(iaddr + 8); err != nil {
+			return nil, err
+		}
+		if ivar.Type, err = p.stringAt(iaddr + 16); err != nil {
+			return nil, err
+		}
+		// the ivar_t offset field points to the offset variable
+		if off, err := p.pointer(iaddr); err == nil && off != 0 {
+			if err := p.read(off, &ivar.Offset); err != nil {
+				return nil, err
+			}
+		}
+		ivars = append(ivars, ivar)
+	}
+
+	return ivars, nil
+}
+
+func (p *parser) parseProperties(addr uint64) ([]Property, error) {
+	if addr == 0 {
+		return nil, nil
+	}
+	l, err := p.readList(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var props []Property
+	for i := uint64(0); i < uint64(l.Count); i++ {
+		paddr := addr + uint64(binary.Size(l)) + i*uint64(l.entSize())
+		var prop Property
+		if prop.Name, err = p.stringAt(paddr); err != nil {
+			return nil, err
+		}
+		if prop.Attributes, err = p.stringAt(paddr + 8); err != nil {
+			return nil, err
+		}
+		props = append(props, prop)
+	}
+
+	return props, nil
+}
+
+// parseProtocolNames returns the names of the protocols in a protocol_list_t
+func (p *parser) parseProtocolNames(addr uint64) ([]string, error) {
+	if addr == 0 {
+		return nil, nil
+	}
+	var count uint64
+	if err := p.read(addr, &count); err != nil {
+		return nil, err
+	}
+	if count > maxCount {
+		return nil, fmt.Errorf("invalid protocol list count %d at %#x", count, addr)
+	}
+
+	var names []string
+	for i := uint64(0); i < count; i++ {
+		proto, err := p.pointer(addr + 8 + i*8)
+		if err != nil {
+			return nil, err
+		}
+		if proto == 0 {
+			continue
+		}
+		name, err := p.stringAt(proto + 8)
+		if err != nil {
+			return nil, err
+		}
+		p.imported(&p.img.ProtocolImages, name, addr+8+i*8)
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// readClassRO reads the class_ro_t of the objc_class at addr
+func (p *parser) readClassRO(addr uint64) (*classROT, error) {
+	data, err := p.pointer(addr + 32) // objc_class.bits
+	if err != nil {
+		return nil, err
+	}
+	var ro classROT
+	if err := p.read(data&fastDataMask, &ro); err != nil {
+		return nil, err
+	}
+	// resolve the pointers that might be chained fixups
+	ro.Name, _ = p.pointer(data&fastDataMask + 24)
+	ro.BaseMethods, _ = p.pointer(data&fastDataMask + 32)
+	ro.BaseProtocols, _ = p.pointer(data&fastDataMask + 40)
+	ro.Ivars, _ = p.pointer(data&fastDataMask + 48)
+	ro.BaseProperties, _ = p.pointer(data&fastDataMask + 64)
+	return &ro, nil
+}
+
+// className returns the name of the class at addr or of the class the pointer at ptrAddr is bound to
+func (p *parser) className(addr, ptrAddr uint64) string {
+	if addr == 0 {
+		return strings.TrimPrefix(p.bindName(ptrAddr), "_OBJC_CLASS_$_")
+	}
+	if name, ok := p.names[addr]; ok {
+		return name
+	}
+	ro, err := p.readClassRO(addr)
+	if err != nil {
+		return ""
+	}
+	name, _ := vmreader.ReadCString(p.r, ro.Name)
+	p.names[addr] = name
+	return name
+}
+
+func (p *parser) parseClass(addr uint64) (*Class, error) {
+	ro, err := p.readClassRO(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Class{Addr: addr, InstanceSize: ro.InstanceSize}
+	if c.Name, err = vmreader.ReadCString(p.r, ro.Name); err != nil {
+		return nil, err
+	}
+	p.names[addr] = c.Name
+
+	if ro.Flags&roRoot == 0 {
+		super, err := p.pointer(addr + 8)
+		if err != nil {
+			return nil, err
+		}
+		c.SuperClass = p.className(super, addr+8)
+		p.imported(&p.img.ClassImages, c.SuperClass, addr+8)
+	}
+	if c.Protocols, err = p.parseProtocolNames(ro.BaseProtocols); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s protocols", c.Name)
+	}
+	if c.Ivars, err = p.parseIvars(ro.Ivars); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s ivars", c.Name)
+	}
+	if c.Props, err = p.parseProperties(ro.BaseProperties); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s properties", c.Name)
+	}
+	if c.InstanceMethods, err = p.parseMethods(ro.BaseMethods); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s instance methods", c.Name)
+	}
+
+	// the class methods and properties live on the metaclass
+	if isa, err := p.pointer(addr); err == nil && isa != 0 {
+		if mro, err := p.readClassRO(isa); err == nil && mro.Flags&roMeta != 0 {
+			if c.ClassMethods, err = p.parseMethods(mro.BaseMethods); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s class methods", c.Name)
+			}
+			if c.ClassProps, err = p.parseProperties(mro.BaseProperties); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse %s class properties", c.Name)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+func (p *parser) parseProtocol(addr uint64) (*Protocol, error) {
+	var pt protocolT
+	if err := p.read(addr, &pt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	proto := &Protocol{Addr: addr}
+	if proto.Name, err = p.stringAt(addr + 8); err != nil {
+		return nil, err
+	}
+	ptrs := make([]uint64, 6)
+	for i := range ptrs {
+		if ptrs[i], err = p.pointer(addr + 16 + uint64(i)*8); err != nil {
+			return nil, err
+		}
+	}
+	if proto.Protocols, err = p.parseProtocolNames(ptrs[0]); err != nil {
+		return nil, err
+	}
+	lists := []*[]Method{&proto.InstanceMethods, &proto.ClassMethods, &proto.OptionalInstanceMethods, &proto.OptionalClassMethods}
+	for i, list := range lists {
+		if *list, err = p.parseMethods(ptrs[1+i]); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s methods", proto.Name)
+		}
+	}
+	if proto.Props, err = p.parseProperties(ptrs[5]); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s properties", proto.Name)
+	}
+
+	// the extended method types have the class names of the object arguments
+	if pt.Size >= uint32(binary.Size(pt)) {
+		if ext, err := p.pointer(addr + 72); err == nil && ext != 0 {
+			idx := uint64(0)
+			for _, list := range lists {
+				for i := range *list {
+					if types, err := p.stringAt(ext + idx*8); err == nil && len(types) > 0 {
+						(*list)[i].Types = types
+					}
+					idx++
+				}
+			}
+		}
+	}
+
+	return proto, nil
+}
+
+func (p *parser) parseCategory(addr uint64) (*Category, error) {
+	var err error
+	cat := &Category{Addr: addr}
+	if cat.Name, err = p.stringAt(addr); err != nil {
+		return nil, err
+	}
+	cls, err := p.pointer(addr + 8)
+	if err != nil {
+		return nil, err
+	}
+	cat.Class = p.className(cls, addr+8)
+	p.imported(&p.img.ClassImages, cat.Class, addr+8)
+
+	var ptrs [4]uint64
+	for i := range ptrs {
+		if ptrs[i], err = p.pointer(addr + 16 + uint64(i)*8); err != nil {
+			return nil, err
+		}
+	}
+	if cat.InstanceMethods, err = p.parseMethods(ptrs[0]); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s instance methods", cat.Name)
+	}
+	if cat.ClassMethods, err = p.parseMethods(ptrs[1]); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s class methods", cat.Name)
+	}
+	if cat.Protocols, err = p.parseProtocolNames(ptrs[2]); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s protocols", cat.Name)
+	}
+	if cat.Props, err = p.parseProperties(ptrs[3]); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s properties", cat.Name)
+	}
+
+	return cat, nil
+}
@@ -0,0 +1,275 @@
+package classdump
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ctype is a decoded Objective-C type encoding
+type ctype struct {
+	kind      byte   // the encoding char ('^' pointer, '[' array, '{' struct, '(' union, 'b' bitfield, ...)
+	name      string // struct/union tag or the class name of an object
+	quals     []string
+	elem      *ctype
+	count     int // array count or bitfield width
+	fields    []field
+	hasFields bool
+}
+
+type field struct {
+	name string
+	typ  *ctype
+}
+
+var simpleTypes = map[byte]string{
+	'c': "char",
+	'i': "int",
+	's': "short",
+	'l': "long",
+	'q': "long long",
+	'C': "unsigned char",
+	'I': "unsigned int",
+	'S': "unsigned short",
+	'L': "unsigned long",
+	'Q': "unsigned long long",
+	'f': "float",
+	'd': "double",
+	'D': "long double",
+	'B': "BOOL",
+	'v': "void",
+	'*': "char *",
+	'#': "Class",
+	':': "SEL",
+	'?': "void", // unknown (function)
+	't': "__int128",
+	'T': "unsigned __int128",
+}
+
+var typeQualifiers = map[byte]string{
+	'r': "const",
+	'n': "in",
+	'N': "inout",
+	'o': "out",
+	'O': "bycopy",
+	'R': "byref",
+	'V': "oneway",
+	'A': "_Atomic",
+	'j': "_Complex",
+}
+
+// typeParser decodes Objective-C type encodings (@encode) into C types
+type typeParser struct {
+	s   string
+	pos int
+}
+
+func (tp *typeParser) peek() byte {
+	if tp.pos >= len(tp.s) {
+		return 0
+	}
+	return tp.s[tp.pos]
+}
+
+func (tp *typeParser) number() int {
+	start := tp.pos
+	for tp.pos < len(tp.s) && tp.s[tp.pos] >= '0' && tp.s[tp.pos] <= '9' {
+		tp.pos++
+	}
+	n, _ := strconv.Atoi(tp.s[start:tp.pos])
+	return n
+}
+
+// quoted reads a "quoted" string
+func (tp *typeParser) quoted() (string, error) {
+	end := strings.IndexByte(tp.s[tp.pos+1:], '"')
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string in type encoding %q", tp.s)
+	}
+	str := tp.s[tp.pos+1 : tp.pos+1+end]
+	tp.pos += end + 2
+	return str, nil
+}
+
+// parse decodes the next type; namedFields is set when parsing the
+// fields of a struct that encodes its field names
+func (tp *typeParser) parse(namedFields bool) (*ctype, error) {
+	var quals []string
+	for {
+		q, ok := typeQualifiers[tp.peek()]
+		if !ok {
+			break
+		}
+		quals = append(quals, q)
+		tp.pos++
+	}
+
+	if tp.pos >= len(tp.s) {
+		return nil, fmt.Errorf("unexpected end of type encoding %q", tp.s)
+	}
+
+	t := &ctype{kind: tp.s[tp.pos], quals: quals}
+	tp.pos++
+
+	switch t.kind {
+	case '^':
+		elem, err := tp.parse(namedFields)
+		if err != nil {
+			return nil, err
+		}
+		t.elem = elem
+	case '[':
+		t.count = tp.number()
+		elem, err := tp.parse(namedFields)
+		if err != nil {
+			return nil, err
+		}
+		t.elem = elem
+		if tp.peek() != ']' {
+			return nil, fmt.Errorf("unterminated array in type encoding %q", tp.s)
+		}
+		tp.pos++
+	case '{', '(':
+		end := byte('}')
+		if t.kind == '(' {
+			end = ')'
+		}
+		start := tp.pos
+		depth := 0
+		for ; tp.pos < len(tp.s); tp.pos++ {
+			c := tp.s[tp.pos]
+			if c == '<' {
+				depth++
+			} else if c == '>' {
+				depth--
+			} else if depth == 0 && (c == '=' || c == end) {
+				break
+			}
+		}
+		if tp.pos >= len(tp.s) {
+			return nil, fmt.Errorf("unterminated struct in type encoding %q", tp.s)
+		}
+		t.name = tp.s[start:tp.pos]
+		if tp.s[tp.pos] == '=' {
+			tp.pos++
+			t.hasFields = true
+			named := tp.peek() == '"'
+			for tp.peek() != end {
+				var f field
+				if tp.peek() == '"' {
+					name, err := tp.quoted()
+					if err != nil {
+						return nil, err
+					}
+					f.name = name
+				}
+				typ, err := tp.parse(named)
+				if err != nil {
+					return nil, err
+				}
+				f.typ = typ
+				t.fields = append(t.fields, f)
+			}
+		}
+		tp.pos++
+	case 'b':
+		t.count = tp.number()
+	case '@':
+		switch tp.peek() {
+		case '?':
+			tp.pos++
+			t.name = "?" // block
+			// skip the extended block signature
+			if tp.peek() == '<' {
+				depth := 0
+				for ; tp.pos < len(tp.s); tp.pos++ {
+					if tp.s[tp.pos] == '<' {
+						depth++
+					} else if tp.s[tp.pos] == '>' {
+						if depth--; depth == 0 {
+							tp.pos++
+							break
+						}
+					}
+				}
+			}
+		case '"':
+			// in structs with named fields the string might be the name of the next field
+			end := strings.IndexByte(tp.s[tp.pos+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated class name in type encoding %q", tp.s)
+			}
+			if next := tp.pos + end + 2; namedFields && next < len(tp.s) && tp.s[next] != '"' && tp.s[next] != '}' && tp.s[next] != ')' {
+				break
+			}
+			name, err := tp.quoted()
+			if err != nil {
+				return nil, err
+			}
+			t.name = name
+		}
+	default:
+		if _, ok := simpleTypes[t.kind]; !ok {
+			return nil, fmt.Errorf("unknown type %q in type encoding %q", t.kind, tp.s)
+		}
+	}
+
+	return t, nil
+}
+
+// parseMethodTypes decodes a method type encoding into its return and argument types
+func parseMethodTypes(enc string) ([]*ctype, error) {
+	var types []*ctype
+	tp := &typeParser{s: enc}
+	for tp.pos < len(tp.s) {
+		t, err := tp.parse(false)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+		// skip the stack offset
+		if c := tp.peek(); c == '-' || c == '+' {
+			tp.pos++
+		}
+		tp.number()
+	}
+	return types, nil
+}
+
+func parseType(enc string) (*ctype, error) {
+	tp := &typeParser{s: enc}
+	t, err := tp.parse(false)
+	if err != nil {
+		return nil, err
+	}
+	if tp.pos != len(enc) {
+		return nil, fmt.Errorf("trailing data in type encoding %q", enc)
+	}
+	return t, nil
+}
+
+// isIdentifier returns true if s is a valid C identifier
+func isIdentifier(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i, c := range s {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitize turns a (C++) struct name into a valid C identifier
+func sanitize(s string) string {
+	var sb strings.Builder
+	for i, c := range s {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			sb.WriteRune(c)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,605 @@
+package classdump
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/demangle"
+	"github.com/pkg/errors"
+)
+
+// systemStructPrefixes are the prefixes of the structs already defined by the Foundation headers
+var systemStructPrefixes = []string{"CG", "NS", "_NS", "CF", "__CF", "_opaque_pthread", "os_unfair_lock", "__darwin", "_xpc", "timespec", "timeval", "__sFILE", "__sbuf"}
+
+// structRegistry collects the struct and union definitions used by all the headers of an image
+type structRegistry struct {
+	defined map[string]bool
+	defs    []string
+	refs    *renderer // the classes and protocols used by the definitions
+}
+
+func (s *structRegistry) isSystem(tag string) bool {
+	for _, prefix := range systemStructPrefixes {
+		if strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *structRegistry) define(kw, tag string, t *ctype) {
+	if s.defined[tag] {
+		return
+	}
+	s.defined[tag] = true // before the fields in case they are self-referential
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s {\n", kw, tag)
+	for i, f := range t.fields {
+		fmt.Fprintf(&sb, "    %s;\n", s.refs.declare(f.typ, fieldName(f, i)))
+	}
+	sb.WriteString("};\n")
+	s.defs = append(s.defs, sb.String())
+}
+
+func fieldName(f field, i int) string {
+	if isIdentifier(f.name) {
+		return f.name
+	}
+	return fmt.Sprintf("field%d", i+1)
+}
+
+// renderer renders decoded types as C declarations and tracks what a header references
+type renderer struct {
+	structs     *structRegistry
+	classes     map[string]bool
+	protos      map[string]bool
+	usesStructs bool
+}
+
+func newRenderer(structs *structRegistry) *renderer {
+	return &renderer{structs: structs, classes: make(map[string]bool), protos: make(map[string]bool)}
+}
+
+func join(base, name string) string {
+	if len(name) == 0 {
+		return base
+	}
+	if strings.HasSuffix(base, "*") {
+		return base + name
+	}
+	return base + " " + name
+}
+
+// declare returns the C declaration of t called name (or the abstract declarator if name is empty)
+func (r *renderer) declare(t *ctype, name string) string {
+	var quals string
+	if len(t.quals) > 0 {
+		quals = strings.Join(t.quals, " ") + " "
+	}
+
+	switch t.kind {
+	case '^':
+		if t.elem.kind == '[' {
+			return quals + r.declare(t.elem, "(*"+name+")")
+		}
+		if t.elem.kind == '?' {
+			return quals + join("void *", name)
+		}
+		return quals + r.declare(t.elem, "*"+name)
+	case '[':
+		return quals + r.declare(t.elem, fmt.Sprintf("%s[%d]", name, t.count))
+	case 'b':
+		return quals + fmt.Sprintf("%s : %d", join("unsigned int", name), t.count)
+	case '@':
+		return quals + join(r.object(t.name), name)
+	case '{', '(':
+		return quals + join(r.aggregate(t), name)
+	}
+	return quals + join(simpleTypes[t.kind], name)
+}
+
+// object returns the C type of an object with the given encoded class name
+func (r *renderer) object(name string) string {
+	switch name {
+	case "":
+		return "id"
+	case "?":
+		return "id /* block */"
+	}
+	class := name
+	var protos []string
+	if i := strings.IndexByte(name, '<'); i >= 0 {
+		class = name[:i]
+		for _, p := range strings.Split(strings.Trim(name[i:], "<>"), "><") {
+			if len(p) > 0 {
+				protos = append(protos, p)
+				r.protos[p] = true
+			}
+		}
+	}
+	var conforms string
+	if len(protos) > 0 {
+		conforms = "<" + strings.Join(protos, ", ") + ">"
+	}
+	if len(class) == 0 {
+		return "id " + conforms
+	}
+	r.classes[class] = true
+	return class + conforms + " *"
+}
+
+// aggregate returns the C type of a struct or union (registering its definition)
+func (r *renderer) aggregate(t *ctype) string {
+	kw := "struct"
+	if t.kind == '(' {
+		kw = "union"
+	}
+	if len(t.name) == 0 || t.name == "?" {
+		if len(t.fields) == 0 {
+			return "void"
+		}
+		var fields []string
+		for i, f := range t.fields {
+			fields = append(fields, r.declare(f.typ, fieldName(f, i))+";")
+		}
+		return fmt.Sprintf("%s { %s }", kw, strings.Join(fields, " "))
+	}
+	tag := t.name
+	if !isIdentifier(tag) {
+		tag = sanitize(tag)
+	}
+	if !r.structs.isSystem(tag) {
+		if len(t.fields) > 0 {
+			r.structs.define(kw, tag, t)
+		}
+		if r.structs.defined[tag] {
+			r.usesStructs = true
+		}
+	}
+	return kw + " " + tag
+}
+
+func (r *renderer) typeName(t *ctype) string {
+	return strings.TrimSpace(r.declare(t, ""))
+}
+
+func (r *renderer) method(m Method, class bool) string {
+	prefix := "-"
+	if class {
+		prefix = "+"
+	}
+	types, err := parseMethodTypes(m.Types)
+	typeName := func(i int) string {
+		if err != nil || i >= len(types) {
+			return "id"
+		}
+		return r.typeName(types[i])
+	}
+
+	if !strings.Contains(m.Name, ":") {
+		return fmt.Sprintf("%s (%s)%s;", prefix, typeName(0), m.Name)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s (%s)", prefix, typeName(0))
+	parts := strings.Split(m.Name, ":")
+	for i, part := range parts[:len(parts)-1] {
+		if i > 0 {
+			sb.WriteString(" ")
+		}
+		// the first two arguments are self and _cmd
+		fmt.Fprintf(&sb, "%s:(%s)arg%d", part, typeName(i+3), i+1)
+	}
+	sb.WriteString(";")
+	return sb.String()
+}
+
+// splitAttributes splits the encoded attributes of a property
+func splitAttributes(attrs string) []string {
+	var out []string
+	quoted := false
+	depth := 0
+	start := 0
+	for i := 0; i < len(attrs); i++ {
+		switch attrs[i] {
+		case '"':
+			quoted = !quoted
+		case '<', '{', '(', '[':
+			depth++
+		case '>', '}', ')', ']':
+			depth--
+		case ',':
+			if !quoted && depth == 0 {
+				out = append(out, attrs[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if start < len(attrs) {
+		out = append(out, attrs[start:])
+	}
+	return out
+}
+
+// accessors returns the getter and setter selectors of a property
+func accessors(prop Property) (string, string) {
+	getter := prop.Name
+	setter := ""
+	if len(prop.Name) > 0 {
+		setter = "set" + strings.ToUpper(prop.Name[:1]) + prop.Name[1:] + ":"
+	}
+	for _, a := range splitAttributes(prop.Attributes) {
+		switch {
+		case strings.HasPrefix(a, "G"):
+			getter = a[1:]
+		case strings.HasPrefix(a, "S"):
+			setter = a[1:]
+		}
+	}
+	return getter, setter
+}
+
+func (r *renderer) property(prop Property, class bool) string {
+	var enc, memory, getter, setter string
+	var nonatomic, readonly, dynamic bool
+	for _, a := range splitAttributes(prop.Attributes) {
+		if len(a) == 0 {
+			continue
+		}
+		switch a[0] {
+		case 'T':
+			enc = a[1:]
+		case 'R':
+			readonly = true
+		case 'C':
+			memory = "copy"
+		case '&':
+			memory = "strong"
+		case 'W':
+			memory = "weak"
+		case 'N':
+			nonatomic = true
+		case 'G':
+			getter = a[1:]
+		case 'S':
+			setter = a[1:]
+		case 'D':
+			dynamic = true
+		}
+	}
+
+	var attrs []string
+	if class {
+		attrs = append(attrs, "class")
+	}
+	if nonatomic {
+		attrs = append(attrs, "nonatomic")
+	}
+	if readonly {
+		attrs = append(attrs, "readonly")
+	}
+	if len(memory) > 0 {
+		attrs = append(attrs, memory)
+	}
+	if len(getter) > 0 {
+		attrs = append(attrs, "getter="+getter)
+	}
+	if len(setter) > 0 {
+		attrs = append(attrs, "setter="+setter)
+	}
+
+	decl := "id " + prop.Name
+	if t, err := parseType(enc); err == nil {
+		decl = r.declare(t, prop.Name)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("@property ")
+	if len(attrs) > 0 {
+		fmt.Fprintf(&sb, "(%s) ", strings.Join(attrs, ", "))
+	}
+	sb.WriteString(decl + ";")
+	if dynamic {
+		sb.WriteString(" // @dynamic")
+	}
+	return sb.String()
+}
+
+// members renders the properties and methods of a class, category or protocol
+func (r *renderer) members(sb *strings.Builder, props, classProps []Property, instMethods, classMethods []Method) {
+	skip := make(map[string]bool)
+	for _, prop := range props {
+		fmt.Fprintln(sb, r.property(prop, false))
+		getter, setter := accessors(prop)
+		skip["-"+getter] = true
+		skip["-"+setter] = true
+	}
+	for _, prop := range classProps {
+		fmt.Fprintln(sb, r.property(prop, true))
+		getter, setter := accessors(prop)
+		skip["+"+getter] = true
+		skip["+"+setter] = true
+	}
+	if len(props)+len(classProps) > 0 {
+		sb.WriteString("\n")
+	}
+	for _, m := range classMethods {
+		if !skip["+"+m.Name] && !strings.HasPrefix(m.Name, ".") {
+			fmt.Fprintln(sb, r.method(m, true))
+		}
+	}
+	for _, m := range instMethods {
+		if !skip["-"+m.Name] && !strings.HasPrefix(m.Name, ".") {
+			fmt.Fprintln(sb, r.method(m, false))
+		}
+	}
+}
+
+func protocolList(protos []string) string {
+	if len(protos) == 0 {
+		return ""
+	}
+	return " <" + strings.Join(protos, ", ") + ">"
+}
+
+// swiftComment returns a comment with the demangled name of a Swift class
+func swiftComment(name string) string {
+	if strings.HasPrefix(name, "_Tt") {
+		if dem := demangle.Do(name, false, false); dem != name {
+			return "// " + dem + "\n"
+		}
+	}
+	return ""
+}
+
+func (r *renderer) classBody(c *Class) string {
+	var sb strings.Builder
+	sb.WriteString(swiftComment(c.Name))
+	sb.WriteString("@interface " + c.Name)
+	if len(c.SuperClass) > 0 {
+		sb.WriteString(" : " + c.SuperClass)
+	}
+	sb.WriteString(protocolList(c.Protocols) + "\n")
+	if len(c.Ivars) > 0 {
+		sb.WriteString("{\n")
+		for _, ivar := range c.Ivars {
+			decl := "id " + ivar.Name
+			if t, err := parseType(ivar.Type); err == nil {
+				decl = r.declare(t, ivar.Name)
+			}
+			fmt.Fprintf(&sb, "    %s; // %#x\n", decl, ivar.Offset)
+		}
+		sb.WriteString("}\n")
+	}
+	sb.WriteString("\n")
+	r.members(&sb, c.Props, c.ClassProps, c.InstanceMethods, c.ClassMethods)
+	sb.WriteString("@end\n")
+	return sb.String()
+}
+
+func (r *renderer) protocolBody(p *Protocol) string {
+	var sb strings.Builder
+	sb.WriteString("@protocol " + p.Name + protocolList(p.Protocols) + "\n")
+	r.members(&sb, p.Props, nil, p.InstanceMethods, p.ClassMethods)
+	if len(p.OptionalInstanceMethods)+len(p.OptionalClassMethods) > 0 {
+		sb.WriteString("\n@optional\n")
+		r.members(&sb, nil, nil, p.OptionalInstanceMethods, p.OptionalClassMethods)
+	}
+	sb.WriteString("@end\n")
+	return sb.String()
+}
+
+func (r *renderer) categoryBody(c *Category) string {
+	var sb strings.Builder
+	sb.WriteString(swiftComment(c.Class))
+	sb.WriteString(fmt.Sprintf("@interface %s (%s)%s\n", c.Class, c.Name, protocolList(c.Protocols)))
+	r.members(&sb, c.Props, nil, c.InstanceMethods, c.ClassMethods)
+	sb.WriteString("@end\n")
+	return sb.String()
+}
+
+type header struct {
+	name string
+	body string
+	r    *renderer
+	self string   // the class or protocol the header declares
+	deps []string // the headers of the classes and protocols it needs the definitions of
+	// the umbrella headers of the frameworks defining the classes and protocols it imports from other images
+	imports []string
+}
+
+// importFrom imports the umbrella header of the framework defining a class or protocol from another image
+// or (if the defining image is unknown or NOT a framework) forward declares it
+func (h *header) importFrom(forward map[string]bool, images map[string]string, name string) {
+	if len(name) == 0 {
+		return
+	}
+	umbrella, ok := frameworkHeader(images[name])
+	if !ok {
+		forward[name] = true
+		return
+	}
+	forward[name] = false
+	if len(umbrella) == 0 {
+		return
+	}
+	for _, imp := range h.imports {
+		if imp == umbrella {
+			return
+		}
+	}
+	h.imports = append(h.imports, umbrella)
+}
+
+// frameworkHeader returns the umbrella header of the framework at path
+// ("" for the images already imported by Foundation and false if it is NOT a framework)
+func frameworkHeader(path string) (string, bool) {
+	if strings.HasPrefix(filepath.Base(path), "libobjc.") {
+		return "", true
+	}
+	for _, dir := range strings.Split(path, "/") {
+		name := strings.TrimSuffix(dir, ".framework")
+		if name == dir || len(name) == 0 {
+			continue
+		}
+		switch name {
+		case "Foundation", "CoreFoundation":
+			return "", true
+		}
+		return name + "/" + name + ".h", true
+	}
+	return "", false
+}
+
+// Headers returns the Objective-C headers of the image's classes, protocols and categories by file name
+func (img *Image) Headers() map[string]string {
+	structs := &structRegistry{defined: make(map[string]bool)}
+	structs.refs = newRenderer(structs)
+
+	classes := make(map[string]bool)
+	for _, c := range img.Classes {
+		classes[c.Name] = true
+	}
+	protos := make(map[string]bool)
+	for _, p := range img.Protocols {
+		protos[p.Name] = true
+	}
+	// the header needs the definitions of its superclass (or extended class) and of the protocols it adopts
+	needs := func(h *header, class string, names []string) {
+		if classes[class] {
+			h.deps = append(h.deps, class+".h")
+			h.r.classes[class] = false
+		} else {
+			h.importFrom(h.r.classes, img.ClassImages, class)
+		}
+		for _, name := range names {
+			if protos[name] {
+				h.deps = append(h.deps, name+"-Protocol.h")
+			} else {
+				h.importFrom(h.r.protos, img.ProtocolImages, name)
+			}
+		}
+	}
+
+	var headers []header
+	for _, p := range img.Protocols {
+		r := newRenderer(structs)
+		h := header{name: p.Name + "-Protocol.h", body: r.protocolBody(p), r: r, self: p.Name}
+		needs(&h, "", p.Protocols)
+		headers = append(headers, h)
+	}
+	for _, c := range img.Classes {
+		r := newRenderer(structs)
+		h := header{name: c.Name + ".h", body: r.classBody(c), r: r, self: c.Name}
+		needs(&h, c.SuperClass, c.Protocols)
+		headers = append(headers, h)
+	}
+	for _, c := range img.Categories {
+		r := newRenderer(structs)
+		h := header{name: c.Class + "+" + c.Name + ".h", body: r.categoryBody(c), r: r}
+		needs(&h, c.Class, c.Protocols)
+		headers = append(headers, h)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(img.Name), filepath.Ext(img.Name))
+	if len(base) == 0 || base == "." {
+		base = "Image"
+	}
+	structsHeader := base + "-Structs.h"
+
+	out := make(map[string]string)
+	for _, h := range headers {
+		var sb strings.Builder
+		sb.WriteString(img.preamble())
+		if h.r.usesStructs {
+			h.deps = append(h.deps, structsHeader)
+		}
+		for _, imp := range h.imports {
+			fmt.Fprintf(&sb, "#import <%s>\n", imp)
+		}
+		for _, dep := range h.deps {
+			fmt.Fprintf(&sb, "#import \"%s\"\n", dep)
+		}
+		sb.WriteString(forwards(h.r, h.self))
+		sb.WriteString("\n" + h.body)
+
+		name := strings.ReplaceAll(h.name, "/", "_")
+		for i := 2; len(out[name]) > 0; i++ {
+			name = fmt.Sprintf("%s_%d.h", strings.TrimSuffix(strings.ReplaceAll(h.name, "/", "_"), ".h"), i)
+		}
+		out[name] = sb.String()
+	}
+
+	if len(structs.defs) > 0 {
+		var sb strings.Builder
+		sb.WriteString(img.preamble())
+		sb.WriteString(forwards(structs.refs, ""))
+		for _, def := range structs.defs {
+			sb.WriteString("\n" + def)
+		}
+		out[structsHeader] = sb.String()
+	}
+
+	return out
+}
+
+func (img *Image) preamble() string {
+	return fmt.Sprintf("//\n//   Generated by ipsw from %s\n//\n\n#import <Foundation/Foundation.h>\n", img.Name)
+}
+
+// forwards returns the @class and @protocol forward declarations of a header
+func forwards(r *renderer, self string) string {
+	var classes, protos []string
+	for name, ok := range r.classes {
+		if ok && name != self && len(name) > 0 {
+			classes = append(classes, name)
+		}
+	}
+	for name, ok := range r.protos {
+		if ok && name != self {
+			protos = append(protos, name)
+		}
+	}
+	sort.Strings(classes)
+	sort.Strings(protos)
+
+	var sb strings.Builder
+	if len(classes)+len(protos) > 0 {
+		sb.WriteString("\n")
+	}
+	if len(classes) > 0 {
+		fmt.Fprintf(&sb, "@class %s;\n", strings.Join(classes, ", "))
+	}
+	if len(protos) > 0 {
+		fmt.Fprintf(&sb, "@protocol %s;\n", strings.Join(protos, ", "))
+	}
+	return sb.String()
+}
+
+// WriteHeaders writes the Objective-C headers of the image to dir and returns their paths
+func (img *Image) WriteHeaders(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "failed to create headers directory %s", dir)
+	}
+
+	headers := img.Headers()
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(headers[name]), 0644); err != nil {
+			return nil, errors.Wrapf(err, "failed to write header %s", path)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
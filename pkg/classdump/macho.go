@@ -0,0 +1,29 @@
+package classdump
+
+import (
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/vmreader"
+)
+
+// Sections returns the Objective-C metadata sections of a MachO
+func Sections(m *macho.File) []Section {
+	var secs []Section
+	for _, sec := range m.Sections {
+		if strings.HasPrefix(sec.Name, "__objc_") {
+			secs = append(secs, Section{Name: sec.Name, Addr: sec.Addr, Size: sec.Size})
+		}
+	}
+	return secs
+}
+
+// ParseMachO parses the Objective-C metadata of a MachO
+func ParseMachO(m *macho.File) (*Image, error) {
+	secs := Sections(m)
+	if len(secs) == 0 {
+		return nil, ErrNoObjC
+	}
+
+	return Parse(vmreader.NewMachO(m), secs)
+}
@@ -0,0 +1,130 @@
+package classdump
+
+const (
+	roMeta = 1 << 0 // RO_META
+	roRoot = 1 << 1 // RO_ROOT
+
+	fastDataMask = 0x00007ffffffffff8 // FAST_DATA_MASK
+
+	smallMethodListFlag = 0x80000000
+	methodListFlagsMask = 0xffff0003
+)
+
+// class_ro_t
+type classROT struct {
+	Flags          uint32
+	InstanceStart  uint32
+	InstanceSize   uint32
+	Reserved       uint32
+	IvarLayout     uint64
+	Name           uint64
+	BaseMethods    uint64
+	BaseProtocols  uint64
+	Ivars          uint64
+	WeakIvarLayout uint64
+	BaseProperties uint64
+}
+
+// protocol_t
+type protocolT struct {
+	Isa                     uint64
+	Name                    uint64
+	Protocols               uint64
+	InstanceMethods         uint64
+	ClassMethods            uint64
+	OptionalInstanceMethods uint64
+	OptionalClassMethods    uint64
+	InstanceProperties      uint64
+	Size                    uint32
+	Flags                   uint32
+	ExtendedMethodTypes     uint64
+}
+
+// entsize_list_tt header of the method, ivar and property lists
+type listHeader struct {
+	EntSizeAndFlags uint32
+	Count           uint32
+}
+
+func (l listHeader) entSize() uint32 {
+	return l.EntSizeAndFlags &^ methodListFlagsMask
+}
+
+// ivar_t
+type ivarT struct {
+	Offset    uint64
+	Name      uint64
+	Type      uint64
+	Alignment uint32
+	Size      uint32
+}
+
+// Method is an Objective-C method
+type Method struct {
+	Name  string
+	Types string
+	Imp   uint64
+}
+
+// Ivar is an Objective-C instance variable
+type Ivar struct {
+	Name   string
+	Type   string
+	Offset uint32
+	Size   uint32
+}
+
+// Property is an Objective-C property
+type Property struct {
+	Name       string
+	Attributes string
+}
+
+// Class is an Objective-C class
+type Class struct {
+	Name            string
+	SuperClass      string
+	Protocols       []string
+	Ivars           []Ivar
+	Props           []Property
+	ClassProps      []Property
+	InstanceMethods []Method
+	ClassMethods    []Method
+	InstanceSize    uint32
+	Addr            uint64
+}
+
+// Protocol is an Objective-C protocol
+type Protocol struct {
+	Name                    string
+	Protocols               []string
+	InstanceMethods         []Method
+	ClassMethods            []Method
+	OptionalInstanceMethods []Method
+	OptionalClassMethods    []Method
+	Props                   []Property
+	Addr                    uint64
+}
+
+// Category is an Objective-C category
+type Category struct {
+	Name            string
+	Class           string
+	Protocols       []string
+	InstanceMethods []Method
+	ClassMethods    []Method
+	Props           []Property
+	Addr            uint64
+}
+
+// Image is the Objective-C metadata of an image
+type Image struct {
+	Name       string
+	Classes    []*Class
+	Protocols  []*Protocol
+	Categories []*Category
+	// ClassImages and ProtocolImages are the install names of the images defining
+	// the superclasses, extended classes and protocols imported from other images
+	ClassImages    map[string]string
+	ProtocolImages map[string]string
+}
@@ -0,0 +1,54 @@
+package dmg
+
+import "fmt"
+
+// adcDecompress decompresses Apple Data Compression (ADC) data
+func adcDecompress(src []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+
+	for i := 0; i < len(src); {
+		b := src[i]
+		switch {
+		case b&0x80 != 0: // plain run
+			n := int(b&0x7f) + 1
+			if i+1+n > len(src) {
+				return nil, fmt.Errorf("adc: plain run overruns input at %#x", i)
+			}
+			out = append(out, src[i+1:i+1+n]...)
+			i += 1 + n
+		case b&0x40 != 0: // three byte code
+			if i+3 > len(src) {
+				return nil, fmt.Errorf("adc: truncated three byte code at %#x", i)
+			}
+			n := int(b&0x3f) + 4
+			off := int(src[i+1])<<8 | int(src[i+2])
+			if err := adcCopy(&out, off, n); err != nil {
+				return nil, err
+			}
+			i += 3
+		default: // two byte code
+			if i+2 > len(src) {
+				return nil, fmt.Errorf("adc: truncated two byte code at %#x", i)
+			}
+			n := int((b&0x3f)>>2) + 3
+			off := int(b&0x3)<<8 | int(src[i+1])
+			if err := adcCopy(&out, off, n); err != nil {
+				return nil, err
+			}
+			i += 2
+		}
+	}
+
+	return out, nil
+}
+
+func adcCopy(out *[]byte, off, n int) error {
+	start := len(*out) - off - 1
+	if start < 0 {
+		return fmt.Errorf("adc: invalid back reference offset %d", off)
+	}
+	for j := 0; j < n; j++ {
+		*out = append(*out, (*out)[start+j])
+	}
+	return nil
+}
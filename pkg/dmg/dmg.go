@@ -0,0 +1,344 @@
+// Package dmg implements a reader for Apple UDIF disk images (.dmg)
+package dmg
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-plist"
+	"github.com/blacktop/ipsw/pkg/lzfse"
+	"github.com/blacktop/ipsw/pkg/lzma"
+	"github.com/pkg/errors"
+)
+
+const maxCachedChunks = 16
+
+// DMG represents an open UDIF disk image
+type DMG struct {
+	Koly       UDIFResourceFile
+	Partitions []*Partition
+
+	r      io.ReaderAt
+	closer io.Closer
+
+	mu    sync.Mutex
+	cache map[cacheKey][]byte
+	lru   []cacheKey // least recently used first
+}
+
+type cacheKey struct {
+	part  *Partition
+	chunk int
+}
+
+// Open opens the named file using os.Open and prepares it for use as a UDIF disk image.
+func Open(name string) (*DMG, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	d, err := NewDMG(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	d.closer = f
+	return d, nil
+}
+
+// Close closes the DMG.
+// If the DMG was created using NewDMG directly instead of Open,
+// Close has no effect.
+func (d *DMG) Close() error {
+	var err error
+	if d.closer != nil {
+		err = d.closer.Close()
+		d.closer = nil
+	}
+	return err
+}
+
+// NewDMG creates a new DMG for accessing a UDIF image of the given size in an underlying reader.
+func NewDMG(r io.ReaderAt, size int64) (*DMG, error) {
+	d := &DMG{
+		r:     r,
+		cache: make(map[cacheKey][]byte),
+	}
+
+	if size < int64(binary.Size(d.Koly)) {
+		return nil, fmt.Errorf("file too small to be a UDIF image")
+	}
+
+	if err := binary.Read(io.NewSectionReader(r, size-int64(binary.Size(d.Koly)), int64(binary.Size(d.Koly))), binary.BigEndian, &d.Koly); err != nil {
+		return nil, errors.Wrap(err, "failed to read koly trailer")
+	}
+	if string(d.Koly.Signature[:]) != kolyMagic {
+		return nil, fmt.Errorf("invalid koly trailer magic: %q", d.Koly.Signature[:])
+	}
+
+	xml := make([]byte, d.Koly.XMLLength)
+	if _, err := r.ReadAt(xml, int64(d.Koly.XMLOffset)); err != nil {
+		return nil, errors.Wrap(err, "failed to read resource fork plist")
+	}
+
+	var rsrc resourceFork
+	if err := plist.NewDecoder(bytes.NewReader(xml)).Decode(&rsrc); err != nil {
+		return nil, errors.Wrap(err, "failed to parse resource fork plist")
+	}
+
+	for _, blkx := range rsrc.ResourceFork.Blkx {
+		p, err := d.parseBlkx(blkx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse blkx %s", blkx.Name)
+		}
+		d.Partitions = append(d.Partitions, p)
+	}
+
+	sort.Slice(d.Partitions, func(i, j int) bool {
+		return d.Partitions[i].table.SectorNumber < d.Partitions[j].table.SectorNumber
+	})
+
+	return d, nil
+}
+
+func (d *DMG) parseBlkx(blkx blkxResource) (*Partition, error) {
+	p := &Partition{Name: blkx.Name, ID: blkx.ID, d: d}
+	if len(p.Name) == 0 {
+		p.Name = blkx.CFName
+	}
+
+	r := bytes.NewReader(blkx.Data)
+	if err := binary.Read(r, binary.BigEndian, &p.table); err != nil {
+		return nil, errors.Wrap(err, "failed to read mish header")
+	}
+	if p.table.Signature != mishMagic {
+		return nil, fmt.Errorf("invalid mish magic %#x", p.table.Signature)
+	}
+
+	chunks := make([]blkxChunk, p.table.NumChunks)
+	if err := binary.Read(r, binary.BigEndian, &chunks); err != nil {
+		return nil, errors.Wrap(err, "failed to read blkx chunks")
+	}
+	for _, c := range chunks {
+		if c.Type == chunkComment || c.Type == chunkTerminator {
+			continue
+		}
+		p.chunks = append(p.chunks, c)
+	}
+
+	log.WithFields(log.Fields{
+		"name":    p.Name,
+		"sectors": p.table.SectorCount,
+		"chunks":  len(p.chunks),
+	}).Debug("UDIF Partition")
+
+	return p, nil
+}
+
+// Size returns the decompressed size of the whole disk image in bytes
+func (d *DMG) Size() int64 {
+	return int64(d.Koly.SectorCount) * sectorSize
+}
+
+// Partition returns the first partition whose name contains name (e.g. "Apple_APFS")
+func (d *DMG) Partition(name string) (*Partition, error) {
+	for _, p := range d.Partitions {
+		if strings.Contains(p.Name, name) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("partition %s not found in DMG", name)
+}
+
+// APFSPartition returns the partition holding an APFS container
+func (d *DMG) APFSPartition() (*Partition, error) {
+	return d.Partition("Apple_APFS")
+}
+
+// ReadAt reads the decompressed whole disk image
+func (d *DMG) ReadAt(p []byte, off int64) (int, error) {
+	if off >= d.Size() {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= d.Size() {
+			return n, io.EOF
+		}
+		sector := uint64(pos / sectorSize)
+		i := sort.Search(len(d.Partitions), func(i int) bool {
+			t := d.Partitions[i].table
+			return t.SectorNumber+t.SectorCount > sector
+		})
+		if i == len(d.Partitions) || d.Partitions[i].table.SectorNumber > sector {
+			p[n] = 0 // gap between partitions
+			n++
+			continue
+		}
+		part := d.Partitions[i]
+		m, err := part.ReadAt(p[n:], pos-int64(part.table.SectorNumber)*sectorSize)
+		n += m
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return n, nil
+}
+
+// ReadAt reads the decompressed partition data
+func (p *Partition) ReadAt(b []byte, off int64) (int, error) {
+	if off >= p.Size() {
+		return 0, io.EOF
+	}
+
+	var rerr error
+	if remain := p.Size() - off; int64(len(b)) > remain {
+		b = b[:remain]
+		rerr = io.EOF
+	}
+
+	n := 0
+	for n < len(b) {
+		pos := off + int64(n)
+		sector := uint64(pos / sectorSize)
+		i := sort.Search(len(p.chunks), func(i int) bool {
+			return p.chunks[i].SectorNumber+p.chunks[i].SectorCount > sector
+		})
+		if i == len(p.chunks) || p.chunks[i].SectorNumber > sector { // not described; treat as zeros
+			b[n] = 0
+			n++
+			continue
+		}
+		c := p.chunks[i]
+		inChunk := pos - int64(c.SectorNumber)*sectorSize
+		chunkLen := int64(c.SectorCount) * sectorSize
+		want := int64(len(b) - n)
+		if want > chunkLen-inChunk {
+			want = chunkLen - inChunk
+		}
+
+		switch c.Type {
+		case chunkZeroFill, chunkIgnore:
+			for j := int64(0); j < want; j++ {
+				b[n+int(j)] = 0
+			}
+		case chunkRaw:
+			if _, err := p.d.r.ReadAt(b[n:n+int(want)], p.d.dataOffset(p, c)+inChunk); err != nil && err != io.EOF {
+				return n, errors.Wrapf(err, "failed to read raw chunk %d", i)
+			}
+		default:
+			data, err := p.d.chunk(p, i)
+			if err != nil {
+				return n, err
+			}
+			if inChunk >= int64(len(data)) || int64(copy(b[n:n+int(want)], data[inChunk:])) < want {
+				return n, fmt.Errorf("chunk %d decompressed to %d bytes; expected %d", i, len(data), chunkLen)
+			}
+		}
+		n += int(want)
+	}
+
+	return n, rerr
+}
+
+// NewReader returns an io.Reader over the decompressed partition data
+func (p *Partition) NewReader() io.Reader {
+	return io.NewSectionReader(p, 0, p.Size())
+}
+
+// dataOffset returns the file offset of chunk c of partition p
+func (d *DMG) dataOffset(p *Partition, c blkxChunk) int64 {
+	return int64(d.Koly.DataForkOffset + p.table.DataOffset + c.CompressedOffset)
+}
+
+// chunk returns the decompressed data of chunk i of partition p (cached)
+func (d *DMG) chunk(p *Partition, i int) ([]byte, error) {
+	key := cacheKey{p, i}
+
+	d.mu.Lock()
+	if data, ok := d.cache[key]; ok {
+		d.touch(key)
+		d.mu.Unlock()
+		return data, nil
+	}
+	d.mu.Unlock()
+
+	c := p.chunks[i]
+	src := make([]byte, c.CompressedLength)
+	if _, err := d.r.ReadAt(src, d.dataOffset(p, c)); err != nil && err != io.EOF {
+		return nil, errors.Wrapf(err, "failed to read %s chunk %d", c.Type, i)
+	}
+
+	size := int(c.SectorCount * sectorSize)
+
+	var data []byte
+	var err error
+	switch c.Type {
+	case chunkZlib:
+		var zr io.ReadCloser
+		if zr, err = zlib.NewReader(bytes.NewReader(src)); err == nil {
+			data, err = ioutil.ReadAll(zr)
+			zr.Close()
+		}
+	case chunkBzip2:
+		data, err = ioutil.ReadAll(bzip2.NewReader(bytes.NewReader(src)))
+	case chunkLZFSE:
+		data, err = lzfse.NewDecoder(src).DecodeBuffer()
+	case chunkADC:
+		data, err = adcDecompress(src, size)
+	case chunkLZMA:
+		lr := lzma.NewReader(bytes.NewReader(src))
+		data, err = ioutil.ReadAll(lr)
+		lr.Close()
+	default:
+		err = fmt.Errorf("unsupported chunk type %s", c.Type)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decompress %s chunk %d", c.Type, i)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.cache[key]; ok { // another reader decompressed it first
+		d.touch(key)
+		return data, nil
+	}
+	if len(d.lru) >= maxCachedChunks {
+		delete(d.cache, d.lru[0])
+		d.lru = d.lru[1:]
+	}
+	d.cache[key] = data
+	d.lru = append(d.lru, key)
+
+	return data, nil
+}
+
+// touch moves key to the most recently used end of the cache (d.mu must be held)
+func (d *DMG) touch(key cacheKey) {
+	for i, k := range d.lru {
+		if k == key {
+			copy(d.lru[i:], d.lru[i+1:])
+			d.lru[len(d.lru)-1] = key
+			return
+		}
+	}
+}
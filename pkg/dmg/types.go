@@ -0,0 +1,156 @@
+package dmg
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	kolyMagic  = "koly"
+	mishMagic  = 0x6d697368 // mish
+	sectorSize = 512
+)
+
+type udifChecksum struct {
+	Type uint32
+	Size uint32
+	Data [32]uint32
+}
+
+// UDIFResourceFile is the 512 byte koly trailer at the end of every UDIF image
+type UDIFResourceFile struct {
+	Signature             [4]byte
+	Version               uint32
+	HeaderSize            uint32
+	Flags                 uint32
+	RunningDataForkOffset uint64
+	DataForkOffset        uint64
+	DataForkLength        uint64
+	RsrcForkOffset        uint64
+	RsrcForkLength        uint64
+	SegmentNumber         uint32
+	SegmentCount          uint32
+	SegmentID             [16]byte
+	DataChecksum          udifChecksum
+	XMLOffset             uint64
+	XMLLength             uint64
+	Reserved1             [120]byte
+	Checksum              udifChecksum
+	ImageVariant          uint32
+	SectorCount           uint64
+	Reserved2             uint32
+	Reserved3             uint32
+	Reserved4             uint32
+}
+
+type chunkType uint32
+
+const (
+	chunkZeroFill   chunkType = 0x00000000
+	chunkRaw        chunkType = 0x00000001
+	chunkIgnore     chunkType = 0x00000002
+	chunkADC        chunkType = 0x80000004
+	chunkZlib       chunkType = 0x80000005
+	chunkBzip2      chunkType = 0x80000006
+	chunkLZFSE      chunkType = 0x80000007
+	chunkLZMA       chunkType = 0x80000008
+	chunkComment    chunkType = 0x7ffffffe
+	chunkTerminator chunkType = 0xffffffff
+)
+
+func (t chunkType) String() string {
+	switch t {
+	case chunkZeroFill:
+		return "zero-fill"
+	case chunkRaw:
+		return "raw"
+	case chunkIgnore:
+		return "ignore"
+	case chunkADC:
+		return "adc"
+	case chunkZlib:
+		return "zlib"
+	case chunkBzip2:
+		return "bzip2"
+	case chunkLZFSE:
+		return "lzfse"
+	case chunkLZMA:
+		return "lzma"
+	case chunkComment:
+		return "comment"
+	case chunkTerminator:
+		return "terminator"
+	default:
+		return fmt.Sprintf("unknown(%#x)", uint32(t))
+	}
+}
+
+// blkxChunk is a BLKXChunkEntry describing a run of sectors
+type blkxChunk struct {
+	Type             chunkType
+	Comment          uint32
+	SectorNumber     uint64
+	SectorCount      uint64
+	CompressedOffset uint64
+	CompressedLength uint64
+}
+
+// blkxTable is the mish header of a blkx resource
+type blkxTable struct {
+	Signature        uint32
+	Version          uint32
+	SectorNumber     uint64
+	SectorCount      uint64
+	DataOffset       uint64
+	BuffersNeeded    uint32
+	BlockDescriptors uint32
+	Reserved         [6]uint32
+	Checksum         udifChecksum
+	NumChunks        uint32
+}
+
+type blkxResource struct {
+	Attributes string `plist:"Attributes,omitempty"`
+	CFName     string `plist:"CFName,omitempty"`
+	Data       []byte `plist:"Data,omitempty"`
+	ID         string `plist:"ID,omitempty"`
+	Name       string `plist:"Name,omitempty"`
+}
+
+type resourceFork struct {
+	ResourceFork struct {
+		Blkx []blkxResource `plist:"blkx,omitempty"`
+	} `plist:"resource-fork,omitempty"`
+}
+
+// Partition is a blkx resource of a UDIF image
+type Partition struct {
+	Name string
+	ID   string
+
+	table  blkxTable
+	chunks []blkxChunk
+	d      *DMG
+}
+
+// Size returns the decompressed size of the partition in bytes
+func (p *Partition) Size() int64 {
+	return int64(p.table.SectorCount) * sectorSize
+}
+
+// StartSector returns the first sector of the partition in the whole disk image
+func (p *Partition) StartSector() uint64 {
+	return p.table.SectorNumber
+}
+
+func (p *Partition) String() string {
+	var types []string
+	seen := make(map[chunkType]bool)
+	for _, c := range p.chunks {
+		if !seen[c.Type] && c.Type != chunkComment && c.Type != chunkTerminator {
+			seen[c.Type] = true
+			types = append(types, c.Type.String())
+		}
+	}
+	return fmt.Sprintf("%-40s sector=%-10d size=%-12d chunks=%d (%s)", p.Name, p.table.SectorNumber, p.Size(), len(p.chunks), strings.Join(types, ", "))
+}
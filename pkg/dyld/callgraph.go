@@ -0,0 +1,150 @@
+package dyld
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/apex/log"
+	"github.com/blacktop/go-arm64"
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/pkg/callgraph"
+)
+
+// cacheProgram is the callgraph.Program of the code in the dyld_shared_cache
+type cacheProgram struct {
+	f      *File
+	machos map[*CacheImage]*macho.File
+}
+
+func (p *cacheProgram) image(addr uint64) (*CacheImage, *macho.File, error) {
+	image, err := p.f.GetImageContainingTextAddr(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if m, ok := p.machos[image]; ok {
+		return image, m, nil
+	}
+	m, err := image.GetMacho()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %v", image.Name, err)
+	}
+	p.machos[image] = m
+	return image, m, nil
+}
+
+func (p *cacheProgram) Function(addr uint64) (callgraph.Function, error) {
+	_, m, err := p.image(addr)
+	if err != nil {
+		return callgraph.Function{}, err
+	}
+	fn, err := m.GetFunctionForVMAddr(addr)
+	if err != nil {
+		return callgraph.Function{}, err
+	}
+	return callgraph.Function{Start: fn.StartAddr, End: fn.EndAddr}, nil
+}
+
+func (p *cacheProgram) Callees(fn callgraph.Function) ([]uint64, error) {
+	_, m, err := p.image(fn.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	uuid, off, err := p.f.GetOffset(fn.Start)
+	if err != nil {
+		return nil, err
+	}
+	data, err := p.f.ReadBytesForUUID(uuid, int64(off), fn.End-fn.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	triage, err := p.f.FirstPassTriage(m, &types.Function{StartAddr: fn.Start, EndAddr: fn.End}, bytes.NewReader(data), arm64.Options{StartAddress: int64(fn.Start)}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var callees []uint64
+	for _, target := range triage.Calls() {
+		callees = append(callees, p.f.resolveBranch(target))
+	}
+	// switch cases dispatched out of the function
+	for _, jt := range triage.JumpTables() {
+		for _, target := range jt.UniqueTargets() {
+			if target < fn.Start || target >= fn.End {
+				callees = append(callees, target)
+			}
+		}
+	}
+
+	return callees, nil
+}
+
+func (p *cacheProgram) Name(addr uint64) (string, string) {
+	var image string
+	if img, err := p.f.GetImageContainingTextAddr(addr); err == nil {
+		image = img.Name
+	}
+	return p.f.FindSymbol(addr, false), image
+}
+
+func (p *cacheProgram) close() {
+	for _, m := range p.machos {
+		m.Close()
+	}
+}
+
+// resolveBranch follows a branch target through the symbol stubs of the image it is in
+// and the branch/stub islands outside of the images to the function it ends up in
+func (f *File) resolveBranch(target uint64) uint64 {
+	return followBranch(target, f.stubTarget, func(addr uint64) bool {
+		_, err := f.GetImageContainingTextAddr(addr)
+		return err == nil
+	}, f.islandTarget)
+}
+
+// stubTarget returns the target of the symbol stub at addr
+func (f *File) stubTarget(addr uint64) (uint64, bool) {
+	image, err := f.GetImageContainingTextAddr(addr)
+	if err != nil {
+		return 0, false
+	}
+	if !image.Analysis.State.IsStubsDone() {
+		if err := f.ParseSymbolStubs(image); err != nil {
+			log.Debugf("failed to parse symbol stubs for %s: %v", image.Name, err)
+		}
+	}
+	target, ok := image.Analysis.SymbolStubs[addr]
+	return target, ok
+}
+
+// CallGraph returns the call graph of the functions reachable from the roots in at most depth calls (0 is unlimited).
+// If no roots are given every function in the image is a root (calls into other images are resolved through
+// the stubs to the function in the exporting dylib)
+func (f *File) CallGraph(imageName string, roots []uint64, depth int) (*callgraph.Graph, error) {
+	if !f.IsArm64() {
+		return nil, fmt.Errorf("can only build the call graph of arm64 caches")
+	}
+
+	image, err := f.Image(imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &cacheProgram{f: f, machos: make(map[*CacheImage]*macho.File)}
+	defer p.close()
+
+	if len(roots) == 0 {
+		m, err := image.GetMacho()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", image.Name, err)
+		}
+		p.machos[image] = m
+		for _, fn := range m.GetFunctions() {
+			roots = append(roots, fn.StartAddr)
+		}
+	}
+
+	return callgraph.Build(p, roots, depth)
+}
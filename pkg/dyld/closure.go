@@ -0,0 +1,782 @@
+package dyld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/blacktop/go-macho/pkg/trie"
+	"github.com/blacktop/go-macho/types"
+)
+
+const (
+	prebuiltLoaderSetMagic = 0x73703464 // 'sp4d'
+	prebuiltLoaderMagic    = 0x6c347964 // 'l4yd'
+)
+
+// prebuiltLoaderSetHeader is dyld4's PrebuiltLoaderSet header (all offsets are relative to the set)
+type prebuiltLoaderSetHeader struct {
+	Magic                        uint32
+	VersionHash                  uint32
+	Length                       uint32
+	LoadersArrayCount            uint32
+	LoadersArrayOffset           uint32
+	CachePatchCount              uint32
+	CachePatchOffset             uint32
+	DyldCacheUUIDOffset          uint32
+	MustBeMissingPathsCount      uint32
+	MustBeMissingPathsOffset     uint32
+	ObjcSelectorHashTableOffset  uint32
+	ObjcClassHashTableOffset     uint32
+	ObjcProtocolHashTableOffset  uint32
+	Reserved                     uint32
+	ObjcProtocolClassCacheOffset uint64
+}
+
+// prebuiltLoaderHeader is dyld4's PrebuiltLoader header (all offsets are relative to the loader)
+type prebuiltLoaderHeader struct {
+	Magic                        uint32
+	Flags                        uint16
+	Ref                          LoaderRef
+	PathOffset                   uint16
+	DependentLoaderRefsOffset    uint16
+	DependentKindArrayOffset     uint16
+	FixupsLoadCommandOffset      uint16
+	AltPathOffset                uint16
+	FileValidationOffset         uint16
+	Info                         uint16 // hasInitializers:1, isOverridable:1, supportsCatalyst:1, isCatalystOverride:1, regionsCount:12
+	RegionsOffset                uint16
+	DepCount                     uint16
+	BindTargetRefsOffset         uint16
+	BindTargetRefsCount          uint32
+	ObjcBinaryInfoOffset         uint32
+	IndexOfTwin                  uint16
+	Reserved1                    uint16
+	ExportsTrieLoaderOffset      uint64
+	ExportsTrieLoaderSize        uint32
+	VMSpace                      uint32
+	CodeSignatureFileOffset      uint32
+	CodeSignatureSize            uint32
+	PatchTableOffset             uint32
+	OverrideBindTargetRefsOffset uint32
+	OverrideBindTargetRefsCount  uint32
+}
+
+// LoaderRef references a loader in the launch's or the cache dylibs' PrebuiltLoaderSet
+type LoaderRef uint16
+
+// Index is the loader's index in its PrebuiltLoaderSet
+func (r LoaderRef) Index() uint16 {
+	return uint16(r & 0x7fff)
+}
+
+// App returns true if the loader is in the launch's PrebuiltLoaderSet (and NOT the cache dylibs')
+func (r LoaderRef) App() bool {
+	return r&0x8000 != 0
+}
+
+// IsMissingWeakDylib returns true if the ref is to a weak linked dylib that was NOT found
+func (r LoaderRef) IsMissingWeakDylib() bool {
+	return r == 0x7fff
+}
+
+type loaderFlags uint16
+
+var loaderFlagNames = []string{
+	"isPrebuilt",
+	"dylibInDyldCache",
+	"hasObjC",
+	"mayHavePlusLoad",
+	"hasReadOnlyData",
+	"neverUnload",
+	"leaveMapped",
+	"hasReadOnlyObjC",
+	"pre2022Binary",
+	"isPremapped",
+	"hasUUIDLoadCommand",
+	"hasWeakDefs",
+	"hasTLVs",
+	"belowLibSystem",
+}
+
+func (f loaderFlags) List() []string {
+	var flags []string
+	for i, name := range loaderFlagNames {
+		if f&(1<<i) != 0 {
+			flags = append(flags, name)
+		}
+	}
+	return flags
+}
+
+// DependentKind is how a loader links a dependent dylib
+type DependentKind uint8
+
+const (
+	DependentNormal DependentKind = iota
+	DependentWeakLink
+	DependentReexport
+	DependentUpward
+)
+
+func (k DependentKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k DependentKind) String() string {
+	switch k {
+	case DependentNormal:
+		return "normal"
+	case DependentWeakLink:
+		return "weak"
+	case DependentReexport:
+		return "reexport"
+	case DependentUpward:
+		return "upward"
+	default:
+		return fmt.Sprintf("kind(%d)", k)
+	}
+}
+
+// BindTargetRef is a prebuilt bind target (an absolute value or an offset into a loader's image)
+type BindTargetRef uint64
+
+// IsAbsolute returns true if the target is an absolute value
+func (b BindTargetRef) IsAbsolute() bool {
+	return b>>63 != 0
+}
+
+// Value is the target's absolute value
+func (b BindTargetRef) Value() uint64 {
+	return uint64(signExtend(uint64(b)&(1<<63-1), 63))
+}
+
+// LoaderRef is the loader of the image the target is in
+func (b BindTargetRef) LoaderRef() LoaderRef {
+	return LoaderRef(b & 0xffff)
+}
+
+// Offset is the target's offset from the start of the image's __TEXT
+func (b BindTargetRef) Offset() uint64 {
+	high8 := (uint64(b) >> 16) & 0xff
+	low39 := (uint64(b) >> 24) & (1<<39 - 1)
+	return high8<<56 | uint64(signExtend(low39, 39))&(1<<56-1)
+}
+
+// LoaderRegion is a segment that dyld maps for a loader
+type LoaderRegion struct {
+	VMOffset     uint64 `json:"vm_offset"`
+	Perms        string `json:"perms"`
+	IsZeroFill   bool   `json:"zero_fill,omitempty"`
+	ReadOnlyData bool   `json:"read_only_data,omitempty"`
+	FileOffset   uint32 `json:"file_offset"`
+	FileSize     uint32 `json:"file_size"`
+}
+
+// FileValidation is how dyld checks that a loader's file has NOT changed since the closure was built
+type FileValidation struct {
+	SliceOffset     uint64     `json:"slice_offset"`
+	DeviceID        uint64     `json:"device_id"`
+	Inode           uint64     `json:"inode"`
+	Mtime           uint64     `json:"mtime"`
+	CDHash          string     `json:"cdhash,omitempty"`
+	UUID            types.UUID `json:"uuid"`
+	CheckInodeMtime bool       `json:"check_inode_mtime"`
+	CheckCDHash     bool       `json:"check_cdhash"`
+}
+
+type fileValidationInfo struct {
+	SliceOffset     uint64
+	DeviceID        uint64
+	Inode           uint64
+	Mtime           uint64
+	CDHash          [20]byte
+	UUID            types.UUID
+	CheckInodeMtime bool
+	CheckCDHash     bool
+}
+
+// ObjCBinaryInfo is the prebuilt ObjC info of a loader (the offsets are from the start of its image)
+type ObjCBinaryInfo struct {
+	ImageInfoRuntimeOffset         uint64 `json:"image_info_offset"`
+	SelRefsRuntimeOffset           uint32 `json:"selrefs_offset"`
+	SelRefsCount                   uint32 `json:"selrefs_count"`
+	ClassListRuntimeOffset         uint32 `json:"classlist_offset"`
+	ClassListCount                 uint32 `json:"classlist_count"`
+	CategoryListRuntimeOffset      uint32 `json:"catlist_offset"`
+	CategoryCount                  uint32 `json:"catlist_count"`
+	ProtocolListRuntimeOffset      uint32 `json:"protolist_offset"`
+	ProtocolListCount              uint32 `json:"protolist_count"`
+	ClassStableSwiftFixupsOffset   uint32 `json:"-"`
+	ProtocolFixupsOffset           uint32 `json:"-"`
+	SelectorReferencesFixupsOffset uint32 `json:"-"`
+	SelectorReferencesFixupsCount  uint32 `json:"selector_fixups_count"`
+	Flags                          uint8  `json:"-"`
+	ProtocolFixups                 int    `json:"protocol_fixups_count"` // the protocols that need to be fixed up to point to the cache's canonical definitions
+}
+
+// BindTarget is a resolved prebuilt bind target
+type BindTarget struct {
+	Absolute bool   `json:"absolute,omitempty"`
+	Value    uint64 `json:"value,omitempty"` // the absolute value
+	Image    string `json:"image,omitempty"`
+	Offset   uint64 `json:"offset,omitempty"`  // offset from the start of the image's __TEXT
+	Address  uint64 `json:"address,omitempty"` // unslid address (if the image is in the cache)
+	Missing  bool   `json:"missing,omitempty"` // target is in a missing weak linked dylib
+}
+
+func (t BindTarget) String() string {
+	switch {
+	case t.Absolute:
+		return fmt.Sprintf("absolute %#x", t.Value)
+	case t.Missing:
+		return "missing weak import"
+	case t.Address > 0:
+		return fmt.Sprintf("%#x\t(%s+%#x)", t.Address, t.Image, t.Offset)
+	default:
+		return fmt.Sprintf("%s+%#x", t.Image, t.Offset)
+	}
+}
+
+// Dependent is a dylib linked by a loader
+type Dependent struct {
+	Path string        `json:"path"`
+	Kind DependentKind `json:"kind"`
+	Ref  LoaderRef     `json:"-"`
+}
+
+// PrebuiltLoader is a dyld4 prebuilt loader for an image in a launch
+type PrebuiltLoader struct {
+	Path               string          `json:"path"`
+	AltPath            string          `json:"alt_path,omitempty"`
+	Ref                LoaderRef       `json:"ref"`
+	Flags              []string        `json:"flags,omitempty"`
+	HasInitializers    bool            `json:"has_initializers"`
+	IsOverridable      bool            `json:"overridable,omitempty"`
+	SupportsCatalyst   bool            `json:"supports_catalyst,omitempty"`
+	IsCatalystOverride bool            `json:"catalyst_override,omitempty"`
+	IndexOfTwin        uint16          `json:"index_of_twin,omitempty"`
+	VMSpace            uint32          `json:"vm_space"`
+	CodeSignature      [2]uint32       `json:"code_signature"` // file offset and size
+	Dependents         []Dependent     `json:"dependents"`
+	Regions            []LoaderRegion  `json:"regions,omitempty"`
+	FileValidation     *FileValidation `json:"file_validation,omitempty"`
+	ObjC               *ObjCBinaryInfo `json:"objc,omitempty"`
+	BindTargets        []BindTarget    `json:"bind_targets,omitempty"`
+	OverrideBinds      []BindTarget    `json:"override_bind_targets,omitempty"`
+	ExportsTrie        [2]uint64       `json:"exports_trie"` // offset and size
+	dependentRefs      []LoaderRef     // unresolved
+	bindRefs           []BindTargetRef // unresolved
+	overrideBindRefs   []BindTargetRef // unresolved
+}
+
+// CachePatch is a cache dylib's export that a launch's root overrides
+type CachePatch struct {
+	Image    string     `json:"image"`
+	VMOffset uint32     `json:"vm_offset"`
+	Address  uint64     `json:"address"`
+	PatchTo  BindTarget `json:"patch_to"`
+}
+
+// PrebuiltLoaderSet is a dyld4 launch closure (the prebuilt loaders of all the images in a launch)
+type PrebuiltLoaderSet struct {
+	Path             string            `json:"path"`
+	Address          uint64            `json:"address"`
+	VersionHash      uint32            `json:"version_hash"`
+	CacheUUID        *types.UUID       `json:"cache_uuid,omitempty"`
+	Loaders          []PrebuiltLoader  `json:"loaders"`
+	InitializerOrder []string          `json:"initializer_order"`
+	CachePatches     []CachePatch      `json:"cache_patches,omitempty"`
+	MustBeMissing    []string          `json:"must_be_missing,omitempty"`
+	ObjC             map[string]uint64 `json:"objc_tables,omitempty"` // offsets of the prebuilt ObjC hash tables
+	patchRefs        []BindTargetRef   // unresolved
+}
+
+// readPrebuiltLoaderSet reads the PrebuiltLoaderSet at the given unslid address (that is at most max bytes long)
+func (f *File) readPrebuiltLoaderSet(addr, max uint64) (*PrebuiltLoaderSet, error) {
+	uuid, off, err := f.GetOffset(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	dat, err := f.ReadBytesForUUID(uuid, int64(off), uint64(binary.Size(prebuiltLoaderSetHeader{})))
+	if err != nil {
+		return nil, err
+	}
+	var hdr prebuiltLoaderSetHeader
+	if err := binary.Read(bytes.NewReader(dat), f.ByteOrder, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Magic != prebuiltLoaderSetMagic {
+		return nil, fmt.Errorf("invalid PrebuiltLoaderSet magic %#x at %#x", hdr.Magic, addr)
+	}
+	if hdr.Length < uint32(len(dat)) || uint64(hdr.Length) > max {
+		return nil, fmt.Errorf("invalid PrebuiltLoaderSet length %#x at %#x", hdr.Length, addr)
+	}
+
+	if dat, err = f.ReadBytesForUUID(uuid, int64(off), uint64(hdr.Length)); err != nil {
+		return nil, err
+	}
+
+	pset := &PrebuiltLoaderSet{Address: addr, VersionHash: hdr.VersionHash}
+
+	if hdr.DyldCacheUUIDOffset > 0 && int(hdr.DyldCacheUUIDOffset)+16 <= len(dat) {
+		var cuuid types.UUID
+		copy(cuuid[:], dat[hdr.DyldCacheUUIDOffset:])
+		pset.CacheUUID = &cuuid
+	}
+
+	for i := uint32(0); i < hdr.LoadersArrayCount; i++ {
+		pos := hdr.LoadersArrayOffset + i*4
+		if int(pos)+4 > len(dat) {
+			return nil, fmt.Errorf("PrebuiltLoaderSet loaders array out of bounds")
+		}
+		loffset := f.ByteOrder.Uint32(dat[pos:])
+		if int(loffset) >= len(dat) {
+			return nil, fmt.Errorf("PrebuiltLoader %d offset %#x out of bounds", i, loffset)
+		}
+		ldr, err := f.parsePrebuiltLoader(dat[loffset:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PrebuiltLoader %d: %v", i, err)
+		}
+		pset.Loaders = append(pset.Loaders, *ldr)
+	}
+
+	if !fits(dat, uint64(hdr.CachePatchOffset), uint64(hdr.CachePatchCount), 16) {
+		return nil, fmt.Errorf("cache patches out of bounds (%d at offset %#x)", hdr.CachePatchCount, hdr.CachePatchOffset)
+	}
+	r := bytes.NewReader(dat)
+	r.Seek(int64(hdr.CachePatchOffset), 0)
+	for i := uint32(0); i < hdr.CachePatchCount; i++ {
+		var patch struct {
+			CacheDylibIndex    uint32
+			CacheDylibVMOffset uint32
+			PatchTo            BindTargetRef
+		}
+		if err := binary.Read(r, f.ByteOrder, &patch); err != nil {
+			return nil, fmt.Errorf("failed to read cache patch %d: %v", i, err)
+		}
+		cp := CachePatch{VMOffset: patch.CacheDylibVMOffset}
+		if int(patch.CacheDylibIndex) < len(f.Images) {
+			cp.Image = f.Images[patch.CacheDylibIndex].Name
+			cp.Address = f.Images[patch.CacheDylibIndex].LoadAddress + uint64(patch.CacheDylibVMOffset)
+		}
+		pset.CachePatches = append(pset.CachePatches, cp)
+		pset.patchRefs = append(pset.patchRefs, patch.PatchTo)
+	}
+
+	pos := hdr.MustBeMissingPathsOffset
+	for i := uint32(0); i < hdr.MustBeMissingPathsCount && int(pos) < len(dat); i++ {
+		path := cstring(dat[pos:])
+		pset.MustBeMissing = append(pset.MustBeMissing, path)
+		pos += uint32(len(path)) + 1
+	}
+
+	pset.ObjC = make(map[string]uint64)
+	for name, offset := range map[string]uint64{
+		"selectors":            uint64(hdr.ObjcSelectorHashTableOffset),
+		"classes":              uint64(hdr.ObjcClassHashTableOffset),
+		"protocols":            uint64(hdr.ObjcProtocolHashTableOffset),
+		"protocol_class_cache": hdr.ObjcProtocolClassCacheOffset,
+	} {
+		if offset > 0 {
+			pset.ObjC[name] = offset
+		}
+	}
+
+	return pset, nil
+}
+
+// parsePrebuiltLoader parses a PrebuiltLoader (dat starts at the loader)
+func (f *File) parsePrebuiltLoader(dat []byte) (*PrebuiltLoader, error) {
+	var hdr prebuiltLoaderHeader
+	if err := binary.Read(bytes.NewReader(dat), f.ByteOrder, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Magic != prebuiltLoaderMagic {
+		return nil, fmt.Errorf("invalid PrebuiltLoader magic %#x", hdr.Magic)
+	}
+
+	ldr := &PrebuiltLoader{
+		Ref:                hdr.Ref,
+		Flags:              loaderFlags(hdr.Flags).List(),
+		HasInitializers:    hdr.Info&1 != 0,
+		IsOverridable:      hdr.Info&2 != 0,
+		SupportsCatalyst:   hdr.Info&4 != 0,
+		IsCatalystOverride: hdr.Info&8 != 0,
+		IndexOfTwin:        hdr.IndexOfTwin,
+		VMSpace:            hdr.VMSpace,
+		CodeSignature:      [2]uint32{hdr.CodeSignatureFileOffset, hdr.CodeSignatureSize},
+		ExportsTrie:        [2]uint64{hdr.ExportsTrieLoaderOffset, uint64(hdr.ExportsTrieLoaderSize)},
+	}
+	if ldr.IndexOfTwin == 0xffff {
+		ldr.IndexOfTwin = 0
+	}
+
+	if int(hdr.PathOffset) < len(dat) {
+		ldr.Path = cstring(dat[hdr.PathOffset:])
+	}
+	if hdr.AltPathOffset > 0 && int(hdr.AltPathOffset) < len(dat) {
+		ldr.AltPath = cstring(dat[hdr.AltPathOffset:])
+	}
+
+	r := bytes.NewReader(dat)
+
+	if !fits(dat, uint64(hdr.DependentLoaderRefsOffset), uint64(hdr.DepCount), 2) {
+		return nil, fmt.Errorf("dependents out of bounds (%d at offset %#x)", hdr.DepCount, hdr.DependentLoaderRefsOffset)
+	}
+	ldr.dependentRefs = make([]LoaderRef, hdr.DepCount)
+	r.Seek(int64(hdr.DependentLoaderRefsOffset), 0)
+	if err := binary.Read(r, f.ByteOrder, ldr.dependentRefs); err != nil {
+		return nil, fmt.Errorf("failed to read dependents: %v", err)
+	}
+	ldr.Dependents = make([]Dependent, hdr.DepCount)
+	for i, ref := range ldr.dependentRefs {
+		ldr.Dependents[i].Ref = ref
+		if hdr.DependentKindArrayOffset > 0 && int(hdr.DependentKindArrayOffset)+i < len(dat) {
+			ldr.Dependents[i].Kind = DependentKind(dat[int(hdr.DependentKindArrayOffset)+i])
+		}
+	}
+
+	if hdr.FileValidationOffset > 0 {
+		var fv fileValidationInfo
+		r.Seek(int64(hdr.FileValidationOffset), 0)
+		if err := binary.Read(r, f.ByteOrder, &fv); err != nil {
+			return nil, fmt.Errorf("failed to read file validation info: %v", err)
+		}
+		ldr.FileValidation = &FileValidation{
+			SliceOffset:     fv.SliceOffset,
+			DeviceID:        fv.DeviceID,
+			Inode:           fv.Inode,
+			Mtime:           fv.Mtime,
+			UUID:            fv.UUID,
+			CheckInodeMtime: fv.CheckInodeMtime,
+			CheckCDHash:     fv.CheckCDHash,
+		}
+		if fv.CheckCDHash {
+			ldr.FileValidation.CDHash = fmt.Sprintf("%x", fv.CDHash)
+		}
+	}
+
+	r.Seek(int64(hdr.RegionsOffset), 0)
+	for i := 0; i < int(hdr.Info>>4); i++ {
+		var region struct {
+			Info       uint64 // vmOffset:59, perms:3, isZeroFill:1, readOnlyData:1
+			FileOffset uint32
+			FileSize   uint32
+		}
+		if err := binary.Read(r, f.ByteOrder, &region); err != nil {
+			return nil, fmt.Errorf("failed to read region %d: %v", i, err)
+		}
+		ldr.Regions = append(ldr.Regions, LoaderRegion{
+			VMOffset:     region.Info & (1<<59 - 1),
+			Perms:        types.VmProtection((region.Info >> 59) & 7).String(),
+			IsZeroFill:   (region.Info>>62)&1 != 0,
+			ReadOnlyData: (region.Info>>63)&1 != 0,
+			FileOffset:   region.FileOffset,
+			FileSize:     region.FileSize,
+		})
+	}
+
+	if !fits(dat, uint64(hdr.BindTargetRefsOffset), uint64(hdr.BindTargetRefsCount), 8) {
+		return nil, fmt.Errorf("bind targets out of bounds (%d at offset %#x)", hdr.BindTargetRefsCount, hdr.BindTargetRefsOffset)
+	}
+	ldr.bindRefs = make([]BindTargetRef, hdr.BindTargetRefsCount)
+	r.Seek(int64(hdr.BindTargetRefsOffset), 0)
+	if err := binary.Read(r, f.ByteOrder, ldr.bindRefs); err != nil {
+		return nil, fmt.Errorf("failed to read bind targets: %v", err)
+	}
+
+	if hdr.OverrideBindTargetRefsCount > 0 {
+		if !fits(dat, uint64(hdr.OverrideBindTargetRefsOffset), uint64(hdr.OverrideBindTargetRefsCount), 8) {
+			return nil, fmt.Errorf("override bind targets out of bounds (%d at offset %#x)", hdr.OverrideBindTargetRefsCount, hdr.OverrideBindTargetRefsOffset)
+		}
+		ldr.overrideBindRefs = make([]BindTargetRef, hdr.OverrideBindTargetRefsCount)
+		r.Seek(int64(hdr.OverrideBindTargetRefsOffset), 0)
+		if err := binary.Read(r, f.ByteOrder, ldr.overrideBindRefs); err != nil {
+			return nil, fmt.Errorf("failed to read override bind targets: %v", err)
+		}
+	}
+
+	if hdr.ObjcBinaryInfoOffset > 0 {
+		var objc ObjCBinaryInfo
+		r.Seek(int64(hdr.ObjcBinaryInfoOffset), 0)
+		for _, field := range objc.raw() {
+			if err := binary.Read(r, f.ByteOrder, field); err != nil {
+				return nil, fmt.Errorf("failed to read ObjC binary info: %v", err)
+			}
+		}
+		// one bool per protocol in the __objc_protolist
+		if objc.ProtocolFixupsOffset > 0 {
+			start := int(hdr.ObjcBinaryInfoOffset) + int(objc.ProtocolFixupsOffset)
+			for i := 0; i < int(objc.ProtocolListCount) && start+i < len(dat); i++ {
+				if dat[start+i] != 0 {
+					objc.ProtocolFixups++
+				}
+			}
+		}
+		ldr.ObjC = &objc
+	}
+
+	return ldr, nil
+}
+
+// raw returns the on-disk fields of the ObjCBinaryInfo
+func (o *ObjCBinaryInfo) raw() []interface{} {
+	return []interface{}{
+		&o.ImageInfoRuntimeOffset,
+		&o.SelRefsRuntimeOffset,
+		&o.SelRefsCount,
+		&o.ClassListRuntimeOffset,
+		&o.ClassListCount,
+		&o.CategoryListRuntimeOffset,
+		&o.CategoryCount,
+		&o.ProtocolListRuntimeOffset,
+		&o.ProtocolListCount,
+		&o.ClassStableSwiftFixupsOffset,
+		&o.ProtocolFixupsOffset,
+		&o.SelectorReferencesFixupsOffset,
+		&o.SelectorReferencesFixupsCount,
+		&o.Flags,
+	}
+}
+
+// fits returns true if count elements of size bytes at offset are inside dat
+// (so a corrupt count can NOT cause a huge allocation)
+func fits(dat []byte, offset, count, size uint64) bool {
+	return offset <= uint64(len(dat)) && count <= (uint64(len(dat))-offset)/size
+}
+
+func cstring(dat []byte) string {
+	if i := bytes.IndexByte(dat, 0); i >= 0 {
+		return string(dat[:i])
+	}
+	return string(dat)
+}
+
+// GetLaunchLoaderSet returns the dyld4 launch closure (PrebuiltLoaderSet) of a given executable
+func (f *File) GetLaunchLoaderSet(executablePath string) (*PrebuiltLoaderSet, error) {
+	hdr := f.Headers[f.UUID]
+	if hdr.ProgClosuresTrieWithSubCachesAddr == 0 || hdr.ProgClosuresWithSubCachesAddr == 0 {
+		return nil, fmt.Errorf("cache does not contain dyld4 launch closures (PrebuiltLoaderSets)")
+	}
+
+	uuid, off, err := f.GetOffset(hdr.ProgClosuresTrieWithSubCachesAddr)
+	if err != nil {
+		return nil, err
+	}
+	progTrie, err := f.ReadBytesForUUID(uuid, int64(off), uint64(hdr.ProgClosuresTrieWithSubCachesSize))
+	if err != nil {
+		return nil, err
+	}
+	imageNode, err := trie.WalkTrie(progTrie, executablePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find launch closure for %s: %v", executablePath, err)
+	}
+	setOffset, _, err := trie.ReadUleb128FromBuffer(bytes.NewBuffer(progTrie[imageNode:]))
+	if err != nil {
+		return nil, err
+	}
+	if setOffset >= hdr.ProgClosuresWithSubCachesSize {
+		return nil, fmt.Errorf("launch closure offset %#x of %s out of bounds", setOffset, executablePath)
+	}
+
+	pset, err := f.readPrebuiltLoaderSet(hdr.ProgClosuresWithSubCachesAddr+setOffset, hdr.ProgClosuresWithSubCachesSize-setOffset)
+	if err != nil {
+		return nil, err
+	}
+	pset.Path = executablePath
+
+	// the cache dylibs' loaders are needed to resolve the initializer order
+	var dylibs *PrebuiltLoaderSet
+	if hdr.DylibsImageArrayWithSubCachesAddr > 0 && hdr.DylibsImageArrayWithSubCachesAddr < hdr.ProgClosuresWithSubCachesAddr {
+		dylibs, err = f.readPrebuiltLoaderSet(hdr.DylibsImageArrayWithSubCachesAddr, hdr.ProgClosuresWithSubCachesAddr-hdr.DylibsImageArrayWithSubCachesAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cache dylibs PrebuiltLoaderSet: %v", err)
+		}
+	}
+
+	pset.resolve(f, dylibs)
+
+	return pset, nil
+}
+
+// loader returns the loader a ref points to (or nil)
+func (ps *PrebuiltLoaderSet) loader(ref LoaderRef, dylibs *PrebuiltLoaderSet) *PrebuiltLoader {
+	if ref.App() {
+		if int(ref.Index()) < len(ps.Loaders) {
+			return &ps.Loaders[ref.Index()]
+		}
+	} else if dylibs != nil && int(ref.Index()) < len(dylibs.Loaders) {
+		return &dylibs.Loaders[ref.Index()]
+	}
+	return nil
+}
+
+// refPath returns the path of the image a ref points to
+func (ps *PrebuiltLoaderSet) refPath(f *File, ref LoaderRef, dylibs *PrebuiltLoaderSet) string {
+	if ref.IsMissingWeakDylib() {
+		return ""
+	}
+	if l := ps.loader(ref, dylibs); l != nil {
+		return l.Path
+	}
+	if !ref.App() && int(ref.Index()) < len(f.Images) {
+		return f.Images[ref.Index()].Name
+	}
+	return fmt.Sprintf("loader(%#x)", uint16(ref))
+}
+
+func (ps *PrebuiltLoaderSet) bindTarget(f *File, ref BindTargetRef, dylibs *PrebuiltLoaderSet) BindTarget {
+	if ref.IsAbsolute() {
+		return BindTarget{Absolute: true, Value: ref.Value()}
+	}
+	lref := ref.LoaderRef()
+	if lref.IsMissingWeakDylib() {
+		return BindTarget{Missing: true}
+	}
+	bt := BindTarget{Image: ps.refPath(f, lref, dylibs), Offset: ref.Offset()}
+	if !lref.App() && int(lref.Index()) < len(f.Images) {
+		bt.Address = f.Images[lref.Index()].LoadAddress + bt.Offset
+	}
+	return bt
+}
+
+// resolve resolves the loader refs and computes the initializer order
+func (ps *PrebuiltLoaderSet) resolve(f *File, dylibs *PrebuiltLoaderSet) {
+	for i := range ps.Loaders {
+		ldr := &ps.Loaders[i]
+		for j := range ldr.Dependents {
+			ldr.Dependents[j].Path = ps.refPath(f, ldr.Dependents[j].Ref, dylibs)
+		}
+		for _, ref := range ldr.bindRefs {
+			ldr.BindTargets = append(ldr.BindTargets, ps.bindTarget(f, ref, dylibs))
+		}
+		for _, ref := range ldr.overrideBindRefs {
+			ldr.OverrideBinds = append(ldr.OverrideBinds, ps.bindTarget(f, ref, dylibs))
+		}
+	}
+	for i := range ps.CachePatches {
+		ps.CachePatches[i].PatchTo = ps.bindTarget(f, ps.patchRefs[i], dylibs)
+	}
+
+	// initializers run bottom up (a loader's dependents are initialized before it)
+	visited := make(map[LoaderRef]bool)
+	var visit func(ref LoaderRef)
+	visit = func(ref LoaderRef) {
+		if visited[ref] || ref.IsMissingWeakDylib() {
+			return
+		}
+		visited[ref] = true
+		ldr := ps.loader(ref, dylibs)
+		if ldr == nil {
+			return
+		}
+		for _, dep := range ldr.dependentRefs {
+			visit(dep)
+		}
+		if ldr.HasInitializers {
+			ps.InitializerOrder = append(ps.InitializerOrder, ldr.Path)
+		}
+	}
+	// the main executable is the first loader
+	for _, ldr := range ps.Loaders {
+		visit(ldr.Ref)
+	}
+}
+
+func (ps *PrebuiltLoaderSet) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "PrebuiltLoaderSet: %s @ %#x\n", ps.Path, ps.Address)
+	fmt.Fprintf(&sb, "  version hash: %#08x\n", ps.VersionHash)
+	if ps.CacheUUID != nil {
+		fmt.Fprintf(&sb, "  cache UUID:   %s\n", ps.CacheUUID)
+	}
+
+	fmt.Fprintf(&sb, "\nLOADERS (%d)\n", len(ps.Loaders))
+	for idx, ldr := range ps.Loaders {
+		fmt.Fprintf(&sb, "\n%d) %s\n", idx, ldr.Path)
+		if len(ldr.AltPath) > 0 {
+			fmt.Fprintf(&sb, "    alt path:    %s\n", ldr.AltPath)
+		}
+		fmt.Fprintf(&sb, "    ref:         %#04x (app=%t, index=%d)\n", uint16(ldr.Ref), ldr.Ref.App(), ldr.Ref.Index())
+		if len(ldr.Flags) > 0 {
+			fmt.Fprintf(&sb, "    flags:       %s\n", strings.Join(ldr.Flags, ", "))
+		}
+		fmt.Fprintf(&sb, "    initializers: %t\n", ldr.HasInitializers)
+		fmt.Fprintf(&sb, "    vm space:    %#x\n", ldr.VMSpace)
+		if ldr.FileValidation != nil {
+			fmt.Fprintf(&sb, "    validation:  uuid=%s inode=%#x mtime=%#x", ldr.FileValidation.UUID, ldr.FileValidation.Inode, ldr.FileValidation.Mtime)
+			if len(ldr.FileValidation.CDHash) > 0 {
+				fmt.Fprintf(&sb, " cdhash=%s", ldr.FileValidation.CDHash)
+			}
+			sb.WriteString("\n")
+		}
+		for _, region := range ldr.Regions {
+			fmt.Fprintf(&sb, "    region:      vmoff=%#09x fileoff=%#08x filesz=%#08x %s", region.VMOffset, region.FileOffset, region.FileSize, region.Perms)
+			if region.IsZeroFill {
+				sb.WriteString(" zerofill")
+			}
+			if region.ReadOnlyData {
+				sb.WriteString(" read-only-data")
+			}
+			sb.WriteString("\n")
+		}
+		if len(ldr.Dependents) > 0 {
+			sb.WriteString("    dependents:\n")
+			for _, dep := range ldr.Dependents {
+				if dep.Ref.IsMissingWeakDylib() {
+					fmt.Fprintf(&sb, "      (%s)\t<missing>\n", dep.Kind)
+				} else {
+					fmt.Fprintf(&sb, "      (%s)\t%s\n", dep.Kind, dep.Path)
+				}
+			}
+		}
+		if ldr.ObjC != nil {
+			fmt.Fprintf(&sb, "    objc:        classes=%d categories=%d protocols=%d selrefs=%d selector fixups=%d protocol fixups=%d\n",
+				ldr.ObjC.ClassListCount,
+				ldr.ObjC.CategoryCount,
+				ldr.ObjC.ProtocolListCount,
+				ldr.ObjC.SelRefsCount,
+				ldr.ObjC.SelectorReferencesFixupsCount,
+				ldr.ObjC.ProtocolFixups)
+		}
+		if len(ldr.BindTargets) > 0 {
+			fmt.Fprintf(&sb, "    bind targets (%d):\n", len(ldr.BindTargets))
+			for i, bt := range ldr.BindTargets {
+				fmt.Fprintf(&sb, "      [%d] %s\n", i, bt)
+			}
+		}
+		if len(ldr.OverrideBinds) > 0 {
+			fmt.Fprintf(&sb, "    override bind targets (%d):\n", len(ldr.OverrideBinds))
+			for i, bt := range ldr.OverrideBinds {
+				fmt.Fprintf(&sb, "      [%d] %s\n", i, bt)
+			}
+		}
+	}
+
+	if len(ps.InitializerOrder) > 0 {
+		sb.WriteString("\nINITIALIZER ORDER\n")
+		for i, path := range ps.InitializerOrder {
+			fmt.Fprintf(&sb, "  %3d: %s\n", i, path)
+		}
+	}
+
+	if len(ps.CachePatches) > 0 {
+		fmt.Fprintf(&sb, "\nCACHE PATCHES (%d)\n", len(ps.CachePatches))
+		for _, patch := range ps.CachePatches {
+			fmt.Fprintf(&sb, "  %#x\t(%s+%#x) => %s\n", patch.Address, patch.Image, patch.VMOffset, patch.PatchTo)
+		}
+	}
+
+	if len(ps.MustBeMissing) > 0 {
+		sb.WriteString("\nMUST BE MISSING\n")
+		for _, path := range ps.MustBeMissing {
+			fmt.Fprintf(&sb, "  %s\n", path)
+		}
+	}
+
+	return sb.String()
+}
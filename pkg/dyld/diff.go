@@ -0,0 +1,275 @@
+package dyld
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+)
+
+// SectionDelta is the size change of a section in an image present in both caches
+type SectionDelta struct {
+	Name    string `json:"name"`
+	OldSize uint64 `json:"old_size"`
+	NewSize uint64 `json:"new_size"`
+}
+
+// Delta returns the change in size of the section
+func (s SectionDelta) Delta() int64 {
+	return int64(s.NewSize) - int64(s.OldSize)
+}
+
+func (s SectionDelta) String() string {
+	return fmt.Sprintf("%s\t%#x -> %#x\t(%+d)", s.Name, s.OldSize, s.NewSize, s.Delta())
+}
+
+// ImageDiff is the difference between an image present in both caches
+type ImageDiff struct {
+	Name           string         `json:"name"`
+	OldUUID        string         `json:"old_uuid,omitempty"`
+	NewUUID        string         `json:"new_uuid,omitempty"`
+	OldVersion     string         `json:"old_version,omitempty"`
+	NewVersion     string         `json:"new_version,omitempty"`
+	ExportsAdded   []string       `json:"exports_added,omitempty"`
+	ExportsRemoved []string       `json:"exports_removed,omitempty"`
+	Sections       []SectionDelta `json:"sections,omitempty"`
+}
+
+// IsEmpty returns true if the image is unchanged
+func (d *ImageDiff) IsEmpty() bool {
+	return d.OldUUID == d.NewUUID && d.OldVersion == d.NewVersion &&
+		len(d.ExportsAdded) == 0 && len(d.ExportsRemoved) == 0 && len(d.Sections) == 0
+}
+
+// DiffResult is the difference between two dyld_shared_caches
+type DiffResult struct {
+	OldUUID          string       `json:"old_uuid"`
+	NewUUID          string       `json:"new_uuid"`
+	ImagesAdded      []string     `json:"images_added,omitempty"`
+	ImagesRemoved    []string     `json:"images_removed,omitempty"`
+	Images           []*ImageDiff `json:"images,omitempty"`
+	ClassesAdded     []string     `json:"classes_added,omitempty"`
+	ClassesRemoved   []string     `json:"classes_removed,omitempty"`
+	ProtocolsAdded   []string     `json:"protocols_added,omitempty"`
+	ProtocolsRemoved []string     `json:"protocols_removed,omitempty"`
+	SelectorsAdded   []string     `json:"selectors_added,omitempty"`
+	SelectorsRemoved []string     `json:"selectors_removed,omitempty"`
+}
+
+// DiffConfig is the configuration for a dyld_shared_cache Diff
+type DiffConfig struct {
+	Exports  bool // diff each image's exported symbols
+	ObjC     bool // diff the ObjC classes, protocols and selectors
+	Sections bool // diff each image's section sizes
+}
+
+// Diff compares two dyld_shared_caches
+func Diff(old, new *File, conf *DiffConfig) (*DiffResult, error) {
+	res := &DiffResult{
+		OldUUID: old.UUID.String(),
+		NewUUID: new.UUID.String(),
+	}
+
+	oldImages := make(map[string]*CacheImage, len(old.Images))
+	for _, img := range old.Images {
+		oldImages[img.Name] = img
+	}
+	newImages := make(map[string]*CacheImage, len(new.Images))
+	for _, img := range new.Images {
+		newImages[img.Name] = img
+	}
+
+	for _, img := range old.Images {
+		if _, ok := newImages[img.Name]; !ok {
+			res.ImagesRemoved = append(res.ImagesRemoved, img.Name)
+		}
+	}
+
+	for _, img := range new.Images {
+		oimg, ok := oldImages[img.Name]
+		if !ok {
+			res.ImagesAdded = append(res.ImagesAdded, img.Name)
+			continue
+		}
+		log.Debugf("Diffing %s", img.Name)
+		idiff, err := diffImage(oimg, img, conf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to diff image %s", img.Name)
+		}
+		if !idiff.IsEmpty() {
+			res.Images = append(res.Images, idiff)
+		}
+	}
+
+	sort.Strings(res.ImagesAdded)
+	sort.Strings(res.ImagesRemoved)
+	sort.Slice(res.Images, func(i, j int) bool { return res.Images[i].Name < res.Images[j].Name })
+
+	if conf.ObjC {
+		var err error
+		if res.ClassesAdded, res.ClassesRemoved, err = diffObjC(old.GetAllClasses, new.GetAllClasses); err != nil {
+			log.Warnf("failed to diff objc classes: %v", err)
+		}
+		if res.ProtocolsAdded, res.ProtocolsRemoved, err = diffObjC(old.GetAllProtocols, new.GetAllProtocols); err != nil {
+			log.Warnf("failed to diff objc protocols: %v", err)
+		}
+		if res.SelectorsAdded, res.SelectorsRemoved, err = diffObjC(old.GetAllSelectors, new.GetAllSelectors); err != nil {
+			log.Warnf("failed to diff objc selectors: %v", err)
+		}
+	}
+
+	return res, nil
+}
+
+func diffImage(old, new *CacheImage, conf *DiffConfig) (*ImageDiff, error) {
+	d := &ImageDiff{Name: new.Name}
+
+	om, err := old.GetPartialMacho()
+	if err != nil {
+		return nil, err
+	}
+	defer om.Close()
+	nm, err := new.GetPartialMacho()
+	if err != nil {
+		return nil, err
+	}
+	defer nm.Close()
+
+	if ou, nu := om.UUID(), nm.UUID(); ou != nil && nu != nil && ou.String() != nu.String() {
+		d.OldUUID = ou.String()
+		d.NewUUID = nu.String()
+	}
+	if oid, nid := om.DylibID(), nm.DylibID(); oid != nil && nid != nil && oid.CurrentVersion != nid.CurrentVersion {
+		d.OldVersion = oid.CurrentVersion
+		d.NewVersion = nid.CurrentVersion
+	}
+
+	if conf.Sections {
+		oldSizes := make(map[string]uint64)
+		for _, sec := range om.Sections {
+			oldSizes[sec.Seg+"."+sec.Name] = sec.Size
+		}
+		for _, sec := range nm.Sections {
+			name := sec.Seg + "." + sec.Name
+			if osize, ok := oldSizes[name]; !ok || osize != sec.Size {
+				d.Sections = append(d.Sections, SectionDelta{Name: name, OldSize: osize, NewSize: sec.Size})
+			}
+			delete(oldSizes, name)
+		}
+		for name, osize := range oldSizes {
+			d.Sections = append(d.Sections, SectionDelta{Name: name, OldSize: osize})
+		}
+		sort.Slice(d.Sections, func(i, j int) bool { return d.Sections[i].Name < d.Sections[j].Name })
+	}
+
+	if conf.Exports {
+		oldSyms, err := exportNames(old)
+		if err != nil {
+			return nil, err
+		}
+		newSyms, err := exportNames(new)
+		if err != nil {
+			return nil, err
+		}
+		d.ExportsAdded, d.ExportsRemoved = diffStrings(oldSyms, newSyms)
+	}
+
+	return d, nil
+}
+
+func exportNames(image *CacheImage) (map[string]uint64, error) {
+	syms, err := image.cache.getExportTrieSymbols(image)
+	if err != nil {
+		if errors.Is(err, ErrNoExportTrieInMachO) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := make(map[string]uint64, len(syms))
+	for _, sym := range syms {
+		names[sym.Name] = sym.Address
+	}
+	return names, nil
+}
+
+func diffObjC(old, new func(bool) (map[string]uint64, error)) ([]string, []string, error) {
+	oldMap, err := old(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	newMap, err := new(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	added, removed := diffStrings(oldMap, newMap)
+	return added, removed, nil
+}
+
+// diffStrings returns the sorted keys added to and removed from old
+func diffStrings(old, new map[string]uint64) (added []string, removed []string) {
+	for name := range new {
+		if _, ok := old[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// String returns the diff in a unified-diff like text format
+func (d *DiffResult) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", d.OldUUID, d.NewUUID)
+
+	section := func(title string, added, removed []string) {
+		if len(added) == 0 && len(removed) == 0 {
+			return
+		}
+		fmt.Fprintf(&sb, "\n%s (+%d/-%d)\n", title, len(added), len(removed))
+		for _, r := range removed {
+			fmt.Fprintf(&sb, "- %s\n", r)
+		}
+		for _, a := range added {
+			fmt.Fprintf(&sb, "+ %s\n", a)
+		}
+	}
+
+	section("IMAGES", d.ImagesAdded, d.ImagesRemoved)
+
+	if len(d.Images) > 0 {
+		fmt.Fprintf(&sb, "\nCHANGED IMAGES (%d)\n", len(d.Images))
+		for _, img := range d.Images {
+			fmt.Fprintf(&sb, "\n~ %s\n", img.Name)
+			if len(img.OldUUID) > 0 {
+				fmt.Fprintf(&sb, "    uuid:    %s -> %s\n", img.OldUUID, img.NewUUID)
+			}
+			if len(img.OldVersion) > 0 {
+				fmt.Fprintf(&sb, "    version: %s -> %s\n", img.OldVersion, img.NewVersion)
+			}
+			for _, sec := range img.Sections {
+				fmt.Fprintf(&sb, "    section: %s\n", sec)
+			}
+			for _, r := range img.ExportsRemoved {
+				fmt.Fprintf(&sb, "    - %s\n", r)
+			}
+			for _, a := range img.ExportsAdded {
+				fmt.Fprintf(&sb, "    + %s\n", a)
+			}
+		}
+	}
+
+	section("OBJC CLASSES", d.ClassesAdded, d.ClassesRemoved)
+	section("OBJC PROTOCOLS", d.ProtocolsAdded, d.ProtocolsRemoved)
+	section("OBJC SELECTORS", d.SelectorsAdded, d.SelectorsRemoved)
+
+	return sb.String()
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/blacktop/go-macho"
 	"github.com/blacktop/go-macho/types"
 	"github.com/blacktop/ipsw/internal/demangle"
+	"github.com/blacktop/ipsw/internal/emu"
 	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/pkg/errors"
 )
@@ -41,11 +42,13 @@ func (d addrDetails) String() string {
 }
 
 type Triage struct {
-	Dylibs    dylibArray
-	Details   map[uint64]addrDetails
-	function  *types.Function
-	addresses map[uint64]uint64
-	locations []uint64
+	Dylibs     dylibArray
+	Details    map[uint64]addrDetails
+	function   *types.Function
+	addresses  map[uint64]uint64
+	calls      map[uint64]uint64
+	locations  []uint64
+	jumpTables emu.JumpTables
 }
 
 // Contains returns true if Triage immediates contains a given address and will return the instruction address
@@ -67,6 +70,16 @@ func (t *Triage) HasLoc(location uint64) (bool, uint64) {
 	return false, 0
 }
 
+// Calls returns the targets of the calls and the branches out of the disassembled function by instruction address
+func (t *Triage) Calls() map[uint64]uint64 {
+	return t.calls
+}
+
+// JumpTables returns the switch jump tables dispatched in the disassembled function
+func (t *Triage) JumpTables() emu.JumpTables {
+	return t.jumpTables
+}
+
 // IsLocation returns if given address is a local branch location within the disassembled function
 func (t *Triage) IsBranchLocation(addr uint64) bool {
 	for _, loc := range t.locations {
@@ -94,6 +107,9 @@ func (f *File) FirstPassTriage(m *macho.File, fn *types.Function, r io.ReadSeeke
 
 	triage.function = fn
 	triage.addresses = make(map[uint64]uint64)
+	triage.calls = make(map[uint64]uint64)
+
+	var dispatches []uint64
 
 	// extract all immediates
 	for i := range arm64.Disassemble(r, options) {
@@ -102,6 +118,10 @@ func (f *File) FirstPassTriage(m *macho.File, fn *types.Function, r io.ReadSeeke
 			continue
 		}
 
+		if i.Instruction.Operation() == arm64.ARM64_BR {
+			dispatches = append(dispatches, i.Instruction.Address())
+		}
+
 		operation := i.Instruction.Operation().String()
 
 		// lookup adrp/ldr or add address as a cstring or symbol name
@@ -122,6 +142,11 @@ func (f *File) FirstPassTriage(m *macho.File, fn *types.Function, r io.ReadSeeke
 				for _, operand := range operands {
 					if operand.OpClass == arm64.LABEL {
 						triage.addresses[i.Instruction.Address()] = operand.Immediate
+						if op := i.Instruction.Operation(); op == arm64.ARM64_BL || op == arm64.ARM64_B {
+							if fn == nil || operand.Immediate < fn.StartAddr || operand.Immediate >= fn.EndAddr {
+								triage.calls[i.Instruction.Address()] = operand.Immediate
+							}
+						}
 					}
 				}
 			}
@@ -141,6 +166,12 @@ func (f *File) FirstPassTriage(m *macho.File, fn *types.Function, r io.ReadSeeke
 		prevInstruction = *i.Instruction
 	}
 
+	if len(dispatches) > 0 {
+		if err := f.triageJumpTables(&triage, m, dispatches); err != nil {
+			log.Debugf("failed to recover the jump tables dispatched from %#x: %v", dispatches[0], err)
+		}
+	}
+
 	if details {
 		triage.Details = make(map[uint64]addrDetails)
 
@@ -181,6 +212,38 @@ func (f *File) FirstPassTriage(m *macho.File, fn *types.Function, r io.ReadSeeke
 	return &triage, nil
 }
 
+// triageJumpTables recovers the switch jump tables dispatched by the given br instructions
+// and marks their case targets as branch locations
+func (f *File) triageJumpTables(triage *Triage, m *macho.File, dispatches []uint64) error {
+	image, err := f.GetImageContainingTextAddr(dispatches[0])
+	if err != nil {
+		return err
+	}
+	fn := triage.function
+	for _, addr := range dispatches {
+		// the cases of a split function can be outside of it (but NOT outside of its section)
+		sec := m.FindSectionForVMAddr(addr)
+		if sec == nil {
+			continue
+		}
+		jt, err := emu.JumpTableAt(image, addr, sec.Addr, sec.Addr+sec.Size)
+		if err != nil {
+			log.Debugf("no jump table dispatched at %#x: %v", addr, err)
+			continue
+		}
+		triage.jumpTables = append(triage.jumpTables, jt)
+		for _, target := range jt.UniqueTargets() {
+			if fn != nil && (target < fn.StartAddr || target >= fn.EndAddr) {
+				continue
+			}
+			if !triage.IsBranchLocation(target) {
+				triage.locations = append(triage.locations, target)
+			}
+		}
+	}
+	return nil
+}
+
 // ImageDependencies recursively returns all the image's loaded dylibs and those dylibs' loaded dylibs etc
 func (f *File) ImageDependencies(imageName string) error {
 
@@ -217,7 +280,7 @@ func (f *File) ImageDependencies(imageName string) error {
 func (f *File) IsFunctionStart(funcs []types.Function, addr uint64, shouldDemangle bool) (bool, string) {
 	for _, fn := range funcs {
 		if addr == fn.StartAddr {
-			if symName, ok := f.AddressToSymbol[addr]; ok {
+			if symName, ok := f.LookupSymbol(addr); ok {
 				if shouldDemangle {
 					return ok, demangle.Do(symName, false, false)
 				}
@@ -239,7 +302,19 @@ func (f *File) GetSymbolAddress(symbol, imageName string) (uint64, *CacheImage,
 				return sym.Address, image, nil
 			}
 		}
-	} else {
+	}
+
+	if f.symIndex != nil {
+		// Search the symbol index
+		if syms, err := f.symIndex.Find(symbol); err == nil {
+			for _, sym := range syms {
+				image, _ := f.Image(sym.Image)
+				if len(imageName) == 0 || image != nil && strings.EqualFold(filepath.Base(image.Name), filepath.Base(imageName)) {
+					return sym.Address, image, nil
+				}
+			}
+		}
+	} else if len(imageName) == 0 {
 		// Search ALL dylibs for the symbol
 		for _, image := range f.Images {
 			if sym, _ := f.FindExportedSymbolInImage(image.Name, symbol); sym != nil {
@@ -249,6 +324,8 @@ func (f *File) GetSymbolAddress(symbol, imageName string) (uint64, *CacheImage,
 	}
 
 	// Search addr2sym map
+	f.symLock.RLock()
+	defer f.symLock.RUnlock()
 	for addr, sym := range f.AddressToSymbol {
 		if strings.EqualFold(sym, symbol) {
 			return addr, nil, nil
@@ -258,9 +335,9 @@ func (f *File) GetSymbolAddress(symbol, imageName string) (uint64, *CacheImage,
 	return 0, nil, fmt.Errorf("failed to find symbol %s", symbol)
 }
 
-// FindSymbol returns symbol from the addr2symbol map for a given virtual address
+// FindSymbol returns symbol from the addr2symbol map or symbol index for a given virtual address
 func (f *File) FindSymbol(addr uint64, shouldDemangle bool) string {
-	if symName, ok := f.AddressToSymbol[addr]; ok {
+	if symName, ok := f.LookupSymbol(addr); ok {
 		if shouldDemangle {
 			return demangle.Do(symName, false, false)
 		}
@@ -315,25 +392,25 @@ func (f *File) AnalyzeImage(image *CacheImage) error {
 		}
 
 		for entry, target := range image.Analysis.GotPointers {
-			if symName, ok := f.AddressToSymbol[target]; ok {
-				f.AddressToSymbol[entry] = fmt.Sprintf("__got.%s", symName)
+			if symName, ok := f.LookupSymbol(target); ok {
+				f.setSymbol(entry, fmt.Sprintf("__got.%s", symName))
 			} else {
 				if img, err := f.GetImageContainingTextAddr(target); err == nil {
 					if err := f.AnalyzeImage(img); err != nil {
 						return err
 					}
-					if symName, ok := f.AddressToSymbol[target]; ok {
-						f.AddressToSymbol[entry] = fmt.Sprintf("__got.%s", symName)
+					if symName, ok := f.LookupSymbol(target); ok {
+						f.setSymbol(entry, fmt.Sprintf("__got.%s", symName))
 					} else if laptr, ok := image.Analysis.GotPointers[target]; ok {
-						if symName, ok := f.AddressToSymbol[laptr]; ok {
-							f.AddressToSymbol[entry] = fmt.Sprintf("__got.%s", symName)
+						if symName, ok := f.symbolAt(laptr); ok {
+							f.setSymbol(entry, fmt.Sprintf("__got.%s", symName))
 						}
 					} else {
 						utils.Indent(log.Debug, 2)(fmt.Sprintf("no sym found for GOT entry %#x => %#x in %s", entry, target, img.Name))
-						f.AddressToSymbol[entry] = fmt.Sprintf("__got_%x ; %s", target, filepath.Base(img.Name))
+						f.setSymbol(entry, fmt.Sprintf("__got_%x ; %s", target, filepath.Base(img.Name)))
 					}
 				} else {
-					f.AddressToSymbol[entry] = fmt.Sprintf("__got_%x", target)
+					f.setSymbol(entry, fmt.Sprintf("__got_%x", target))
 				}
 
 			}
@@ -347,8 +424,8 @@ func (f *File) AnalyzeImage(image *CacheImage) error {
 		}
 
 		for stub, target := range image.Analysis.SymbolStubs {
-			if symName, ok := f.AddressToSymbol[target]; ok {
-				f.AddressToSymbol[stub] = fmt.Sprintf("j_%s", symName)
+			if symName, ok := f.LookupSymbol(target); ok {
+				f.setSymbol(stub, fmt.Sprintf("j_%s", symName))
 			} else {
 				img, err := f.GetImageContainingTextAddr(target)
 				if err != nil {
@@ -357,15 +434,15 @@ func (f *File) AnalyzeImage(image *CacheImage) error {
 				if err := f.AnalyzeImage(img); err != nil {
 					return err
 				}
-				if symName, ok := f.AddressToSymbol[target]; ok {
-					f.AddressToSymbol[stub] = fmt.Sprintf("j_%s", symName)
+				if symName, ok := f.LookupSymbol(target); ok {
+					f.setSymbol(stub, fmt.Sprintf("j_%s", symName))
 				} else if laptr, ok := image.Analysis.GotPointers[target]; ok {
-					if symName, ok := f.AddressToSymbol[laptr]; ok {
-						f.AddressToSymbol[stub] = fmt.Sprintf("j_%s", symName)
+					if symName, ok := f.symbolAt(laptr); ok {
+						f.setSymbol(stub, fmt.Sprintf("j_%s", symName))
 					}
 				} else {
 					utils.Indent(log.Debug, 2)(fmt.Sprintf("no sym found for stub %#x => %#x in %s", stub, target, img.Name))
-					f.AddressToSymbol[stub] = fmt.Sprintf("__stub_%x ; %s", target, filepath.Base(img.Name))
+					f.setSymbol(stub, fmt.Sprintf("__stub_%x ; %s", target, filepath.Base(img.Name)))
 				}
 			}
 		}
@@ -376,6 +453,12 @@ func (f *File) AnalyzeImage(image *CacheImage) error {
 
 // ParseSymbolStubHelpers parse symbol stub helpers in MachO
 func (f *File) ParseSymbolStubHelpers(image *CacheImage) error {
+	image.Analysis.mu.Lock()
+	defer image.Analysis.mu.Unlock()
+
+	if image.Analysis.State.IsStubHelpersDone() {
+		return nil
+	}
 
 	m, err := image.GetPartialMacho()
 	if err != nil {
@@ -402,8 +485,8 @@ func (f *File) ParseSymbolStubHelpers(image *CacheImage) error {
 				if operands := i.Instruction.Operands(); operands != nil {
 					for _, operand := range operands {
 						if operand.OpClass == arm64.LABEL {
-							if symName, ok := f.AddressToSymbol[operand.Immediate]; ok {
-								f.AddressToSymbol[stubHelperFnStart] = fmt.Sprintf("__stub_helper.%s", symName)
+							if symName, ok := f.symbolAt(operand.Immediate); ok {
+								f.setSymbol(stubHelperFnStart, fmt.Sprintf("__stub_helper.%s", symName))
 							}
 						}
 					}
@@ -421,6 +504,12 @@ func (f *File) ParseSymbolStubHelpers(image *CacheImage) error {
 
 // ParseSymbolStubs parse symbol stubs in MachO
 func (f *File) ParseSymbolStubs(image *CacheImage) error {
+	image.Analysis.mu.Lock()
+	defer image.Analysis.mu.Unlock()
+
+	if image.Analysis.State.IsStubsDone() {
+		return nil
+	}
 
 	m, err := image.GetPartialMacho()
 	if err != nil {
@@ -428,7 +517,7 @@ func (f *File) ParseSymbolStubs(image *CacheImage) error {
 	}
 	defer m.Close()
 
-	image.Analysis.SymbolStubs = make(map[uint64]uint64)
+	stubs := make(map[uint64]uint64)
 
 	for _, sec := range m.Sections {
 		if sec.Flags.IsSymbolStubs() {
@@ -469,7 +558,7 @@ func (f *File) ParseSymbolStubs(image *CacheImage) error {
 							if err != nil {
 								return fmt.Errorf("failed to read pointer at %#x: %v", adrpImm, err)
 							}
-							image.Analysis.SymbolStubs[adrpAddr] = f.SlideInfo.SlidePointer(addr)
+							stubs[adrpAddr] = f.SlideInfo.SlidePointer(addr)
 						}
 					}
 				} else if i.Instruction.Operation() == arm64.ARM64_LDR && prevInst.Operation() == arm64.ARM64_ADD {
@@ -481,14 +570,14 @@ func (f *File) ParseSymbolStubs(image *CacheImage) error {
 						if err != nil {
 							return fmt.Errorf("failed to read pointer at %#x: %v", adrpImm, err)
 						}
-						image.Analysis.SymbolStubs[adrpAddr] = f.SlideInfo.SlidePointer(addr)
+						stubs[adrpAddr] = f.SlideInfo.SlidePointer(addr)
 					}
 				} else if i.Instruction.Operation() == arm64.ARM64_BR && prevInst.Operation() == arm64.ARM64_ADD {
 					// add       	x16, x16, #0x828
 					addRegister := prevInst.Operands()[0].Reg[0] // x16
 					// br        	x16
 					if addRegister == i.Instruction.Operands()[0].Reg[0] {
-						image.Analysis.SymbolStubs[adrpAddr] = adrpImm
+						stubs[adrpAddr] = adrpImm
 					}
 				}
 
@@ -498,6 +587,7 @@ func (f *File) ParseSymbolStubs(image *CacheImage) error {
 		}
 	}
 
+	image.Analysis.SymbolStubs = stubs
 	image.Analysis.State.SetStubs(true)
 
 	return nil
@@ -505,6 +595,12 @@ func (f *File) ParseSymbolStubs(image *CacheImage) error {
 
 // ParseGOT parse global offset table in MachO
 func (f *File) ParseGOT(image *CacheImage) error {
+	image.Analysis.mu.Lock()
+	defer image.Analysis.mu.Unlock()
+
+	if image.Analysis.State.IsGotDone() {
+		return nil
+	}
 
 	m, err := image.GetPartialMacho()
 	if err != nil {
@@ -512,7 +608,7 @@ func (f *File) ParseGOT(image *CacheImage) error {
 	}
 	defer m.Close()
 
-	image.Analysis.GotPointers = make(map[uint64]uint64)
+	gotPointers := make(map[uint64]uint64)
 
 	if authPtr := m.Section("__AUTH_CONST", "__auth_ptr"); authPtr != nil {
 		dat, err := authPtr.Data()
@@ -526,7 +622,7 @@ func (f *File) ParseGOT(image *CacheImage) error {
 		}
 
 		for idx, ptr := range ptrs {
-			image.Analysis.GotPointers[authPtr.Addr+uint64(idx*8)] = f.SlideInfo.SlidePointer(ptr)
+			gotPointers[authPtr.Addr+uint64(idx*8)] = f.SlideInfo.SlidePointer(ptr)
 		}
 	}
 
@@ -543,11 +639,12 @@ func (f *File) ParseGOT(image *CacheImage) error {
 			}
 
 			for idx, ptr := range ptrs {
-				image.Analysis.GotPointers[sec.Addr+uint64(idx*8)] = f.SlideInfo.SlidePointer(ptr)
+				gotPointers[sec.Addr+uint64(idx*8)] = f.SlideInfo.SlidePointer(ptr)
 			}
 		}
 	}
 
+	image.Analysis.GotPointers = gotPointers
 	image.Analysis.State.SetGot(true)
 
 	return nil
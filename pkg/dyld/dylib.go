@@ -0,0 +1,1172 @@
+package dyld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/go-macho/types"
+)
+
+const (
+	lcSegment64         = 0x19
+	lcSymtab            = 0x2
+	lcDysymtab          = 0xb
+	lcCodeSignature     = 0x1d
+	lcSegmentSplitInfo  = 0x1e
+	lcFunctionStarts    = 0x26
+	lcDataInCode        = 0x29
+	lcDyldInfo          = 0x22
+	lcDyldInfoOnly      = 0x80000022
+	lcDyldExportsTrie   = 0x80000033
+	lcDyldChainedFixups = 0x80000034
+	lcLoadDylib         = 0xc
+	lcLoadWeakDylib     = 0x80000018
+	lcReexportDylib     = 0x8000001f
+	lcLoadUpwardDylib   = 0x80000023
+
+	mhDylibInCache = 0x80000000
+
+	sectionTypeMask       = 0xff
+	sZeroFill             = 0x1
+	sNonLazySymbolPointer = 0x6
+	sLazySymbolPointers   = 0x7
+	sSymbolStubs          = 0x8
+	sGBZeroFill           = 0xc
+	sThreadLocalZeroFill  = 0x12
+
+	indirectSymbolLocal = 0x80000000
+	indirectSymbolAbs   = 0x40000000
+
+	bindSpecialDylibFlatLookup          = -2
+	bindTypePointer                     = 0x1
+	bindImmediateMask                   = 0xf
+	bindOpcodeDone                      = 0x00
+	bindOpcodeSetDylibOrdinalImm        = 0x10
+	bindOpcodeSetDylibOrdinalULEB       = 0x20
+	bindOpcodeSetDylibSpecialImm        = 0x30
+	bindOpcodeSetSymbolTrailingFlagsImm = 0x40
+	bindOpcodeSetTypeImm                = 0x50
+	bindOpcodeSetSegmentAndOffsetULEB   = 0x70
+	bindOpcodeDoBind                    = 0x90
+)
+
+type dylibHeader struct {
+	Magic      uint32
+	CPU        uint32
+	SubCPU     uint32
+	Type       uint32
+	NCommands  uint32
+	SizeOfCmds uint32
+	Flags      uint32
+	Reserved   uint32
+}
+
+type dylibSegment struct {
+	Cmd     uint32
+	Len     uint32
+	Name    [16]byte
+	Addr    uint64
+	Memsz   uint64
+	Offset  uint64
+	Filesz  uint64
+	Maxprot int32
+	Prot    int32
+	Nsect   uint32
+	Flag    uint32
+}
+
+type dylibSection struct {
+	Name      [16]byte
+	Seg       [16]byte
+	Addr      uint64
+	Size      uint64
+	Offset    uint32
+	Align     uint32
+	Reloff    uint32
+	Nreloc    uint32
+	Flags     uint32
+	Reserved1 uint32
+	Reserved2 uint32
+	Reserved3 uint32
+}
+
+type dylibSymtab struct {
+	Cmd     uint32
+	Len     uint32
+	Symoff  uint32
+	Nsyms   uint32
+	Stroff  uint32
+	Strsize uint32
+}
+
+type dylibDysymtab struct {
+	Cmd            uint32
+	Len            uint32
+	Ilocalsym      uint32
+	Nlocalsym      uint32
+	Iextdefsym     uint32
+	Nextdefsym     uint32
+	Iundefsym      uint32
+	Nundefsym      uint32
+	Tocoffset      uint32
+	Ntoc           uint32
+	Modtaboff      uint32
+	Nmodtab        uint32
+	Extrefsymoff   uint32
+	Nextrefsyms    uint32
+	Indirectsymoff uint32
+	Nindirectsyms  uint32
+	Extreloff      uint32
+	Nextrel        uint32
+	Locreloff      uint32
+	Nlocrel        uint32
+}
+
+type dylibDyldInfo struct {
+	Cmd          uint32
+	Len          uint32
+	RebaseOff    uint32
+	RebaseSize   uint32
+	BindOff      uint32
+	BindSize     uint32
+	WeakBindOff  uint32
+	WeakBindSize uint32
+	LazyBindOff  uint32
+	LazyBindSize uint32
+	ExportOff    uint32
+	ExportSize   uint32
+}
+
+type dylibLinkEditData struct {
+	Cmd  uint32
+	Len  uint32
+	Off  uint32
+	Size uint32
+}
+
+type dylibSeg struct {
+	dylibSegment
+	index    int // index of the segment's load command amongst the segments
+	newOff   uint64
+	sections []dylibSection
+	data     []byte
+}
+
+func (s *dylibSeg) name() string {
+	return strings.TrimRight(string(s.Name[:]), "\x00")
+}
+
+func (s *dylibSeg) contains(addr uint64) bool {
+	return s.Addr <= addr && addr < s.Addr+uint64(len(s.data))
+}
+
+// dylibBuilder rebuilds a standalone MachO from a dylib in the shared cache
+type dylibBuilder struct {
+	f     *File
+	image *CacheImage
+
+	hdr      dylibHeader
+	cmds     []byte
+	segs     []*dylibSeg
+	linkedit *dylibSeg
+
+	symtab   *dylibSymtab
+	dysymtab *dylibDysymtab
+	dyldInfo *dylibDyldInfo
+	ledata   map[uint32]*dylibLinkEditData // exports trie, function starts and data in code
+
+	indirect []uint32 // indirect symbol table (with cache symbol indexes)
+	binds    []dylibBind
+}
+
+// dylibBind binds a pointer of the image to a symbol exported by one of its dependent dylibs
+type dylibBind struct {
+	addr    uint64
+	ordinal int // dylib ordinal (or a special ordinal <= 0)
+	name    string
+}
+
+// ExtractDylib returns a standalone MachO of the dylib image the way Apple's dsc_extractor would.
+//
+// The segments are laid out contiguously, __LINKEDIT is rebuilt with only the image's export trie,
+// function starts, data in code, symbols (including the local symbols stripped into the .symbols cache),
+// indirect symbols and strings. The cache's slide info is applied so every pointer is an unslid address
+// with its PAC bits stripped, the symbol stubs are restored to load their targets from the GOT/lazy pointers
+// and ObjC selector references are pointed back at the image's own __objc_methname strings.
+// ObjC class references (and the superclass, metaclass and cache pointers of the image's classes) to other images
+// are restored as binds to the symbols exported by the dependent dylibs.
+func (f *File) ExtractDylib(image *CacheImage) ([]byte, error) {
+	b := &dylibBuilder{
+		f:      f,
+		image:  image,
+		ledata: make(map[uint32]*dylibLinkEditData),
+	}
+
+	if err := b.parseLoadCommands(); err != nil {
+		return nil, fmt.Errorf("failed to parse load commands of %s: %v", image.Name, err)
+	}
+	if err := b.readSegments(); err != nil {
+		return nil, fmt.Errorf("failed to read segments of %s: %v", image.Name, err)
+	}
+	if err := b.rebase(); err != nil {
+		return nil, fmt.Errorf("failed to rebase %s: %v", image.Name, err)
+	}
+	if err := b.readIndirectSymbols(); err != nil {
+		return nil, fmt.Errorf("failed to read indirect symbols of %s: %v", image.Name, err)
+	}
+	if f.IsArm64() {
+		if err := b.restoreStubs(); err != nil {
+			return nil, fmt.Errorf("failed to restore stubs of %s: %v", image.Name, err)
+		}
+	}
+	if err := b.fixObjCSelRefs(); err != nil {
+		return nil, fmt.Errorf("failed to fix ObjC selector references of %s: %v", image.Name, err)
+	}
+	if err := b.restoreObjCClassRefs(); err != nil {
+		return nil, fmt.Errorf("failed to restore ObjC class references of %s: %v", image.Name, err)
+	}
+
+	return b.build()
+}
+
+// dylibSize returns the size of the dylib ExtractDylib would return computed from its load commands (without
+// reading its segments). The rebuilt __LINKEDIT is sized from the image's tables without the symbol strings and
+// restored binds (they are only known once extracted) so it is an estimate of the extracted size.
+func (f *File) dylibSize(image *CacheImage) (int64, error) {
+	b := &dylibBuilder{
+		f:      f,
+		image:  image,
+		ledata: make(map[uint32]*dylibLinkEditData),
+	}
+	if err := b.parseLoadCommands(); err != nil {
+		return 0, fmt.Errorf("failed to parse load commands of %s: %v", image.Name, err)
+	}
+
+	var size uint64
+	for _, seg := range b.segs {
+		size += (seg.Filesz + b.pageSize() - 1) &^ (b.pageSize() - 1)
+	}
+	for _, led := range b.ledata {
+		size += uint64(led.Size)
+	}
+	if b.ledata[lcDyldExportsTrie] == nil && b.dyldInfo != nil {
+		size += uint64(b.dyldInfo.ExportSize)
+	}
+	if b.symtab != nil {
+		size += uint64(b.symtab.Nsyms) * uint64(binary.Size(types.Nlist64{}))
+	}
+	if b.dysymtab != nil {
+		size += uint64(b.dysymtab.Nindirectsyms) * 4
+	}
+
+	return int64(size), nil
+}
+
+// pageSize returns the alignment of the extracted dylib's segments
+func (b *dylibBuilder) pageSize() uint64 {
+	if !b.f.IsArm64() {
+		return 0x1000
+	}
+	return 0x4000
+}
+
+func (b *dylibBuilder) read(addr, size uint64) ([]byte, error) {
+	uuid, off, err := b.f.GetOffset(addr)
+	if err != nil {
+		return nil, err
+	}
+	return b.f.ReadBytesForUUID(uuid, int64(off), size)
+}
+
+// linkeditAddr converts a (cache file) __LINKEDIT offset from a load command into its virtual address
+func (b *dylibBuilder) linkeditAddr(off uint32) uint64 {
+	return b.linkedit.Addr + uint64(off) - b.linkedit.Offset
+}
+
+func (b *dylibBuilder) readLinkedit(off, size uint32) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	return b.read(b.linkeditAddr(off), uint64(size))
+}
+
+func (b *dylibBuilder) parseLoadCommands() error {
+	hdr, err := b.read(b.image.Info.Address, uint64(binary.Size(b.hdr)))
+	if err != nil {
+		return err
+	}
+	if err := binary.Read(bytes.NewReader(hdr), b.f.ByteOrder, &b.hdr); err != nil {
+		return err
+	}
+	if b.hdr.Magic != 0xfeedfacf {
+		return fmt.Errorf("unsupported MachO magic %#x (only 64bit dylibs are supported)", b.hdr.Magic)
+	}
+
+	if b.cmds, err = b.read(b.image.Info.Address+uint64(binary.Size(b.hdr)), uint64(b.hdr.SizeOfCmds)); err != nil {
+		return err
+	}
+
+	nsegs := 0
+	for off := 0; off+8 <= len(b.cmds); {
+		cmd := b.f.ByteOrder.Uint32(b.cmds[off:])
+		size := int(b.f.ByteOrder.Uint32(b.cmds[off+4:]))
+		if size < 8 || off+size > len(b.cmds) {
+			return fmt.Errorf("invalid load command %#x size %d at offset %#x", cmd, size, off)
+		}
+		r := bytes.NewReader(b.cmds[off : off+size])
+
+		switch cmd {
+		case lcSegment64:
+			seg := &dylibSeg{index: nsegs}
+			nsegs++
+			if err := binary.Read(r, b.f.ByteOrder, &seg.dylibSegment); err != nil {
+				return err
+			}
+			seg.sections = make([]dylibSection, seg.Nsect)
+			if err := binary.Read(r, b.f.ByteOrder, &seg.sections); err != nil {
+				return err
+			}
+			if seg.name() == "__LINKEDIT" {
+				b.linkedit = seg
+			} else {
+				b.segs = append(b.segs, seg)
+			}
+		case lcSymtab:
+			b.symtab = &dylibSymtab{}
+			if err := binary.Read(r, b.f.ByteOrder, b.symtab); err != nil {
+				return err
+			}
+		case lcDysymtab:
+			b.dysymtab = &dylibDysymtab{}
+			if err := binary.Read(r, b.f.ByteOrder, b.dysymtab); err != nil {
+				return err
+			}
+		case lcDyldInfo, lcDyldInfoOnly:
+			b.dyldInfo = &dylibDyldInfo{}
+			if err := binary.Read(r, b.f.ByteOrder, b.dyldInfo); err != nil {
+				return err
+			}
+		case lcDyldExportsTrie, lcFunctionStarts, lcDataInCode:
+			led := &dylibLinkEditData{}
+			if err := binary.Read(r, b.f.ByteOrder, led); err != nil {
+				return err
+			}
+			b.ledata[cmd] = led
+		}
+
+		off += size
+	}
+
+	if b.linkedit == nil {
+		return errors.New("missing __LINKEDIT segment")
+	}
+
+	return nil
+}
+
+func (b *dylibBuilder) readSegments() (err error) {
+	for _, seg := range b.segs {
+		if seg.Filesz == 0 {
+			continue
+		}
+		if seg.data, err = b.read(seg.Addr, seg.Filesz); err != nil {
+			return fmt.Errorf("failed to read segment %s: %v", seg.name(), err)
+		}
+	}
+	return nil
+}
+
+func (b *dylibBuilder) segmentFor(addr uint64) *dylibSeg {
+	for _, seg := range b.segs {
+		if seg.contains(addr) {
+			return seg
+		}
+	}
+	return nil
+}
+
+func (b *dylibBuilder) readPtr(addr uint64) (uint64, bool) {
+	if seg := b.segmentFor(addr); seg != nil && addr+8 <= seg.Addr+uint64(len(seg.data)) {
+		return b.f.ByteOrder.Uint64(seg.data[addr-seg.Addr:]), true
+	}
+	return 0, false
+}
+
+func (b *dylibBuilder) writePtr(addr, ptr uint64) {
+	if seg := b.segmentFor(addr); seg != nil && addr+8 <= seg.Addr+uint64(len(seg.data)) {
+		b.f.ByteOrder.PutUint64(seg.data[addr-seg.Addr:], ptr)
+	}
+}
+
+func (b *dylibBuilder) writeInstruction(addr uint64, inst uint32) {
+	if seg := b.segmentFor(addr); seg != nil && addr+4 <= seg.Addr+uint64(len(seg.data)) {
+		binary.LittleEndian.PutUint32(seg.data[addr-seg.Addr:], inst)
+	}
+}
+
+// rebase applies the cache's slide info to the image's data segments (unslid targets without PAC bits)
+func (b *dylibBuilder) rebase() error {
+	for _, seg := range b.segs {
+		if len(seg.data) == 0 {
+			continue
+		}
+
+		uuid, mapping, err := b.f.GetMappingForVMAddress(seg.Addr)
+		if err != nil {
+			return err
+		}
+		if mapping.SlideInfoOffset == 0 || mapping.SlideInfoSize == 0 {
+			continue
+		}
+
+		pageSize := uint64(b.f.SlideInfo.GetPageSize())
+		start := (seg.Addr - mapping.Address) / pageSize
+		end := (seg.Addr + uint64(len(seg.data)) - mapping.Address + pageSize - 1) / pageSize
+
+		rebases, err := b.f.GetRebaseInfoForPages(uuid, mapping, start, end)
+		if err != nil {
+			return err
+		}
+
+		for _, rebase := range rebases {
+			if seg.contains(rebase.CacheVMAddress) {
+				b.writePtr(rebase.CacheVMAddress, rebase.Target)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (b *dylibBuilder) readIndirectSymbols() error {
+	if b.dysymtab == nil || b.dysymtab.Nindirectsyms == 0 {
+		return nil
+	}
+
+	data, err := b.readLinkedit(b.dysymtab.Indirectsymoff, b.dysymtab.Nindirectsyms*4)
+	if err != nil {
+		return err
+	}
+
+	b.indirect = make([]uint32, b.dysymtab.Nindirectsyms)
+
+	return binary.Read(bytes.NewReader(data), b.f.ByteOrder, &b.indirect)
+}
+
+// restoreStubs rewrites the cache's optimized stubs (branching straight to their targets)
+// back into stubs loading their target from the GOT/lazy pointer of the same symbol
+func (b *dylibBuilder) restoreStubs() error {
+	if len(b.indirect) == 0 {
+		return nil
+	}
+
+	if !b.image.Analysis.State.IsStubsDone() {
+		if err := b.f.ParseSymbolStubs(b.image); err != nil {
+			return err
+		}
+	}
+	if !b.image.Analysis.State.IsGotDone() {
+		if err := b.f.ParseGOT(b.image); err != nil {
+			return err
+		}
+	}
+
+	// map stub targets to the image's GOT entries pointing at them (for the stubs without a pointer slot of their own)
+	gotSlots := make(map[uint64]uint64)
+	for entry, target := range b.image.Analysis.GotPointers {
+		if target == 0 || b.segmentFor(entry) == nil {
+			continue
+		}
+		if slot, ok := gotSlots[target]; !ok || entry < slot {
+			gotSlots[target] = entry
+		}
+	}
+	gotSlot := func(stub uint64) (uint64, bool) {
+		slot, ok := gotSlots[b.stubTarget(stub)]
+		return slot, ok
+	}
+
+	// map symbol index to its pointer slot
+	slots := make(map[uint32]uint64)
+	authSlots := make(map[uint32]uint64)
+	for _, seg := range b.segs {
+		for _, sec := range seg.sections {
+			switch sec.Flags & sectionTypeMask {
+			case sNonLazySymbolPointer, sLazySymbolPointers:
+				for i := uint64(0); i < sec.Size/8; i++ {
+					idx := int(sec.Reserved1) + int(i)
+					if idx >= len(b.indirect) || b.indirect[idx]&(indirectSymbolLocal|indirectSymbolAbs) != 0 {
+						continue
+					}
+					if strings.HasPrefix(string(sec.Name[:]), "__auth_") {
+						authSlots[b.indirect[idx]] = sec.Addr + i*8
+					} else {
+						slots[b.indirect[idx]] = sec.Addr + i*8
+					}
+				}
+			}
+		}
+	}
+
+	for _, seg := range b.segs {
+		for _, sec := range seg.sections {
+			if sec.Flags&sectionTypeMask != sSymbolStubs || sec.Reserved2 == 0 {
+				continue
+			}
+			stubSize := uint64(sec.Reserved2)
+			for i := uint64(0); i < sec.Size/stubSize; i++ {
+				idx := int(sec.Reserved1) + int(i)
+				if idx >= len(b.indirect) {
+					break
+				}
+				stub := sec.Addr + i*stubSize
+				sym := b.indirect[idx]
+
+				switch stubSize {
+				case 12: // adrp x16, ptr@PAGE; ldr x16, [x16, ptr@PAGEOFF]; br x16
+					slot, ok := slots[sym]
+					if !ok {
+						if slot, ok = authSlots[sym]; !ok {
+							if slot, ok = gotSlot(stub); !ok {
+								continue
+							}
+						}
+					}
+					b.writeInstruction(stub, arm64ADRP(16, stub, slot))
+					b.writeInstruction(stub+4, arm64LDR(16, 16, slot&0xfff))
+					b.writeInstruction(stub+8, 0xd61f0200) // br x16
+					b.restoreSlot(stub, slot)
+				case 16: // adrp x17, ptr@PAGE; add x17, x17, ptr@PAGEOFF; ldr x16, [x17]; braa x16, x17
+					slot, ok := authSlots[sym]
+					if !ok {
+						if slot, ok = slots[sym]; !ok {
+							if slot, ok = gotSlot(stub); !ok {
+								continue
+							}
+						}
+					}
+					b.writeInstruction(stub, arm64ADRP(17, stub, slot))
+					b.writeInstruction(stub+4, arm64ADD(17, 17, slot&0xfff))
+					b.writeInstruction(stub+8, 0xf9400230)  // ldr x16, [x17]
+					b.writeInstruction(stub+12, 0xd71f0a11) // braa x16, x17
+					b.restoreSlot(stub, slot)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// stubTarget returns the target of the optimized stub (resolved through the GOT if the stub branches to a GOT entry)
+func (b *dylibBuilder) stubTarget(stub uint64) uint64 {
+	target, ok := b.image.Analysis.SymbolStubs[stub]
+	if !ok {
+		return 0
+	}
+	if ptr, ok := b.image.Analysis.GotPointers[target]; ok {
+		return ptr
+	}
+	return target
+}
+
+// restoreSlot points an empty pointer slot at the target of the optimized stub
+func (b *dylibBuilder) restoreSlot(stub, slot uint64) {
+	target := b.stubTarget(stub)
+	if target == 0 {
+		return
+	}
+	if ptr, ok := b.readPtr(slot); ok && ptr == 0 {
+		b.writePtr(slot, target)
+	}
+}
+
+func arm64ADRP(rd uint32, pc, target uint64) uint32 {
+	imm := uint32(int64(target&^0xfff-pc&^0xfff) >> 12)
+	return 0x90000000 | (imm&3)<<29 | ((imm>>2)&0x7ffff)<<5 | rd
+}
+
+func arm64LDR(rt, rn uint32, off uint64) uint32 {
+	return 0xf9400000 | uint32((off/8)&0xfff)<<10 | rn<<5 | rt
+}
+
+func arm64ADD(rd, rn uint32, imm uint64) uint32 {
+	return 0x91000000 | uint32(imm&0xfff)<<10 | rn<<5 | rd
+}
+
+// fixObjCSelRefs points the selector references uniqued into other images back at the image's own selector strings
+func (b *dylibBuilder) fixObjCSelRefs() error {
+	var selRefs, methNames []dylibSection
+	for _, seg := range b.segs {
+		for _, sec := range seg.sections {
+			switch strings.TrimRight(string(sec.Name[:]), "\x00") {
+			case "__objc_selrefs":
+				selRefs = append(selRefs, sec)
+			case "__objc_methname":
+				methNames = append(methNames, sec)
+			}
+		}
+	}
+	if len(selRefs) == 0 || len(methNames) == 0 {
+		return nil
+	}
+
+	selectors := make(map[string]uint64)
+	for _, sec := range methNames {
+		seg := b.segmentFor(sec.Addr)
+		if seg == nil || sec.Addr+sec.Size > seg.Addr+uint64(len(seg.data)) {
+			continue
+		}
+		data := seg.data[sec.Addr-seg.Addr : sec.Addr-seg.Addr+sec.Size]
+		for off := 0; off < len(data); {
+			end := bytes.IndexByte(data[off:], 0)
+			if end < 0 {
+				break
+			}
+			if _, ok := selectors[string(data[off:off+end])]; !ok {
+				selectors[string(data[off:off+end])] = sec.Addr + uint64(off)
+			}
+			off += end + 1
+		}
+	}
+
+	for _, sec := range selRefs {
+		for addr := sec.Addr; addr < sec.Addr+sec.Size; addr += 8 {
+			ptr, ok := b.readPtr(addr)
+			if !ok || b.segmentFor(ptr) != nil {
+				continue
+			}
+			sel, err := b.f.GetCString(ptr)
+			if err != nil {
+				continue
+			}
+			if local, ok := selectors[sel]; ok {
+				b.writePtr(addr, local)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readLoadCommands returns the raw load commands of an image
+func (b *dylibBuilder) readLoadCommands(image *CacheImage) ([]byte, error) {
+	var hdr dylibHeader
+	data, err := b.read(image.Info.Address, uint64(binary.Size(hdr)))
+	if err != nil {
+		return nil, err
+	}
+	if err := binary.Read(bytes.NewReader(data), b.f.ByteOrder, &hdr); err != nil {
+		return nil, err
+	}
+	return b.read(image.Info.Address+uint64(binary.Size(hdr)), uint64(hdr.SizeOfCmds))
+}
+
+// dylibLoads returns the install names of the dylibs loaded by the load commands cmds in ordinal order
+// along with the ones they re-export
+func (b *dylibBuilder) dylibLoads(cmds []byte) (loads, reexports []string) {
+	for off := 0; off+12 <= len(cmds); {
+		cmd := b.f.ByteOrder.Uint32(cmds[off:])
+		size := int(b.f.ByteOrder.Uint32(cmds[off+4:]))
+		if size < 8 || off+size > len(cmds) {
+			break
+		}
+		switch cmd {
+		case lcLoadDylib, lcLoadWeakDylib, lcReexportDylib, lcLoadUpwardDylib:
+			var name string
+			if nameOff := int(b.f.ByteOrder.Uint32(cmds[off+8:])); nameOff < size {
+				name = strings.TrimRight(string(cmds[off+nameOff:off+size]), "\x00")
+				if end := strings.IndexByte(name, 0); end >= 0 {
+					name = name[:end]
+				}
+			}
+			loads = append(loads, name)
+			if cmd == lcReexportDylib {
+				reexports = append(reexports, name)
+			}
+		}
+		off += size
+	}
+	return loads, reexports
+}
+
+// dylibOrdinals maps the image's dependent dylibs (and the dylibs they re-export) to their dylib ordinal
+func (b *dylibBuilder) dylibOrdinals() map[*CacheImage]int {
+	ordinals := make(map[*CacheImage]int)
+
+	loads, _ := b.dylibLoads(b.cmds)
+	var deps []*CacheImage
+	for idx, name := range loads {
+		if image, err := b.f.Image(name); err == nil {
+			if _, ok := ordinals[image]; !ok {
+				ordinals[image] = idx + 1
+				deps = append(deps, image)
+			}
+		}
+	}
+
+	for _, dep := range deps {
+		queue := []*CacheImage{dep}
+		for len(queue) > 0 {
+			cmds, err := b.readLoadCommands(queue[0])
+			queue = queue[1:]
+			if err != nil {
+				continue
+			}
+			_, reexports := b.dylibLoads(cmds)
+			for _, name := range reexports {
+				image, err := b.f.Image(name)
+				if err != nil {
+					continue
+				}
+				if _, ok := ordinals[image]; !ok {
+					ordinals[image] = ordinals[dep]
+					queue = append(queue, image)
+				}
+			}
+		}
+	}
+
+	return ordinals
+}
+
+// restoreObjCClassRefs binds the ObjC class references and the class data pointing into other images
+// (e.g. superclasses, root metaclasses and _objc_empty_cache) back to the symbols exported by the dependent dylibs
+func (b *dylibBuilder) restoreObjCClassRefs() error {
+	var refs []dylibSection
+	for _, seg := range b.segs {
+		for _, sec := range seg.sections {
+			switch strings.TrimRight(string(sec.Name[:]), "\x00") {
+			case "__objc_classrefs", "__objc_superrefs", "__objc_data":
+				refs = append(refs, sec)
+			}
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	ordinals := b.dylibOrdinals()
+
+	var images []*CacheImage
+	exports := make(map[*CacheImage]map[uint64]string)
+	imageFor := func(addr uint64) *CacheImage {
+		for _, image := range images {
+			if m, err := image.GetPartialMacho(); err == nil && m.FindSegmentForVMAddr(addr) != nil {
+				return image
+			}
+		}
+		image, err := b.f.GetImageContainingVMAddr(addr)
+		if err != nil {
+			return nil
+		}
+		images = append(images, image)
+		exports[image] = make(map[uint64]string)
+		syms, err := b.f.getExportTrieSymbols(image)
+		if err != nil {
+			return image
+		}
+		for _, sym := range syms {
+			if !sym.Flags.ReExport() {
+				exports[image][sym.Address] = sym.Name
+			}
+		}
+		return image
+	}
+
+	for _, sec := range refs {
+		for addr := sec.Addr; addr+8 <= sec.Addr+sec.Size; addr += 8 {
+			ptr, ok := b.readPtr(addr)
+			if !ok || ptr == 0 || b.segmentFor(ptr) != nil {
+				continue
+			}
+			image := imageFor(ptr)
+			if image == nil {
+				continue
+			}
+			name, ok := exports[image][ptr]
+			if !ok {
+				continue
+			}
+			ordinal, ok := ordinals[image]
+			if !ok {
+				ordinal = bindSpecialDylibFlatLookup
+			}
+			b.binds = append(b.binds, dylibBind{addr: addr, ordinal: ordinal, name: name})
+			b.writePtr(addr, 0)
+		}
+	}
+
+	return nil
+}
+
+// bindOpcodes returns the bind opcodes of the image's binds
+func (b *dylibBuilder) bindOpcodes() []byte {
+	if len(b.binds) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, bind := range b.binds {
+		seg := b.segmentFor(bind.addr)
+		if seg == nil {
+			continue
+		}
+		switch {
+		case bind.ordinal <= 0:
+			buf.WriteByte(bindOpcodeSetDylibSpecialImm | byte(bind.ordinal)&bindImmediateMask)
+		case bind.ordinal <= bindImmediateMask:
+			buf.WriteByte(bindOpcodeSetDylibOrdinalImm | byte(bind.ordinal))
+		default:
+			buf.WriteByte(bindOpcodeSetDylibOrdinalULEB)
+			buf.Write(appendULEB128(nil, uint64(bind.ordinal)))
+		}
+		buf.WriteByte(bindOpcodeSetSymbolTrailingFlagsImm)
+		buf.WriteString(bind.name)
+		buf.WriteByte(0)
+		buf.WriteByte(bindOpcodeSetTypeImm | bindTypePointer)
+		buf.WriteByte(bindOpcodeSetSegmentAndOffsetULEB | byte(seg.index)&bindImmediateMask)
+		buf.Write(appendULEB128(nil, bind.addr-seg.Addr))
+		buf.WriteByte(bindOpcodeDoBind)
+	}
+	buf.WriteByte(bindOpcodeDone)
+
+	return buf.Bytes()
+}
+
+func appendULEB128(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+type linkeditWriter struct {
+	bytes.Buffer
+}
+
+// add appends data 8 byte aligned and returns its offset in the __LINKEDIT
+func (w *linkeditWriter) add(data []byte) uint32 {
+	for w.Len()%8 != 0 {
+		w.WriteByte(0)
+	}
+	off := uint32(w.Len())
+	w.Write(data)
+	return off
+}
+
+// buildSymbols returns the new symbol table, string table and the map from cache symbol indexes to new ones
+func (b *dylibBuilder) buildSymbols() ([]types.Nlist64, []byte, map[uint32]uint32, uint32, uint32, error) {
+	var syms []types.Nlist64
+	strtab := []byte{' ', 0}
+	indexes := make(map[uint32]uint32)
+	strs := make(map[string]uint32)
+
+	addString := func(s string) uint32 {
+		if off, ok := strs[s]; ok {
+			return off
+		}
+		off := uint32(len(strtab))
+		strtab = append(strtab, s...)
+		strtab = append(strtab, 0)
+		strs[s] = off
+		return off
+	}
+
+	if b.symtab == nil {
+		return nil, strtab, indexes, 0, 0, nil
+	}
+
+	strAddr := b.linkeditAddr(b.symtab.Stroff)
+	readRange := func(start, count uint32) error {
+		if count == 0 {
+			return nil
+		}
+		data, err := b.readLinkedit(b.symtab.Symoff+start*uint32(binary.Size(types.Nlist64{})), count*uint32(binary.Size(types.Nlist64{})))
+		if err != nil {
+			return err
+		}
+		nlists := make([]types.Nlist64, count)
+		if err := binary.Read(bytes.NewReader(data), b.f.ByteOrder, &nlists); err != nil {
+			return err
+		}
+		for i, nl := range nlists {
+			name, err := b.f.GetCString(strAddr + uint64(nl.Name))
+			if err != nil {
+				name = ""
+			}
+			nl.Name = addString(name)
+			indexes[start+uint32(i)] = uint32(len(syms))
+			syms = append(syms, nl)
+		}
+		return nil
+	}
+
+	var ilocal, iext, iundef, nlocal, next, nundef uint32
+	if b.dysymtab != nil {
+		ilocal, nlocal = b.dysymtab.Ilocalsym, b.dysymtab.Nlocalsym
+		iext, next = b.dysymtab.Iextdefsym, b.dysymtab.Nextdefsym
+		iundef, nundef = b.dysymtab.Iundefsym, b.dysymtab.Nundefsym
+	} else {
+		iext, next = 0, b.symtab.Nsyms
+	}
+
+	// locals (the ones stripped into the .symbols cache replace the redacted ones left in the image)
+	if err := b.f.GetLocalSymbolsForImage(b.image); err != nil && !errors.Is(err, ErrNoLocals) {
+		return nil, nil, nil, 0, 0, err
+	}
+	if len(b.image.LocalSymbols) > 0 {
+		locals := make([]*CacheLocalSymbol64, len(b.image.LocalSymbols))
+		copy(locals, b.image.LocalSymbols)
+		sort.SliceStable(locals, func(i, j int) bool { return locals[i].Nlist64.Value < locals[j].Nlist64.Value })
+		for _, lsym := range locals {
+			nl := lsym.Nlist64
+			nl.Name = addString(lsym.Name)
+			syms = append(syms, nl)
+		}
+	} else if err := readRange(ilocal, nlocal); err != nil {
+		return nil, nil, nil, 0, 0, fmt.Errorf("failed to read local symbols: %v", err)
+	}
+	nlocal = uint32(len(syms))
+
+	if err := readRange(iext, next); err != nil {
+		return nil, nil, nil, 0, 0, fmt.Errorf("failed to read exported symbols: %v", err)
+	}
+	next = uint32(len(syms)) - nlocal
+
+	if err := readRange(iundef, nundef); err != nil {
+		return nil, nil, nil, 0, 0, fmt.Errorf("failed to read undefined symbols: %v", err)
+	}
+
+	for len(strtab)%8 != 0 {
+		strtab = append(strtab, 0)
+	}
+
+	return syms, strtab, indexes, nlocal, next, nil
+}
+
+func (b *dylibBuilder) build() ([]byte, error) {
+	var le linkeditWriter
+
+	// exports
+	var exportOff, exportSize uint32
+	if led, ok := b.ledata[lcDyldExportsTrie]; ok {
+		exportOff, exportSize = led.Off, led.Size
+	} else if b.dyldInfo != nil {
+		exportOff, exportSize = b.dyldInfo.ExportOff, b.dyldInfo.ExportSize
+	}
+	exports, err := b.readLinkedit(exportOff, exportSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export trie: %v", err)
+	}
+	newExportOff := le.add(exports)
+
+	newLedata := make(map[uint32][2]uint32)
+	for _, cmd := range []uint32{lcFunctionStarts, lcDataInCode} {
+		if led, ok := b.ledata[cmd]; ok {
+			data, err := b.readLinkedit(led.Off, led.Size)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read linkedit data of load command %#x: %v", cmd, err)
+			}
+			newLedata[cmd] = [2]uint32{le.add(data), uint32(len(data))}
+		}
+	}
+	newLedata[lcDyldExportsTrie] = [2]uint32{newExportOff, uint32(len(exports))}
+
+	binds := b.bindOpcodes()
+	bindOff := le.add(binds)
+
+	// symbols
+	syms, strtab, indexes, nlocal, next, err := b.buildSymbols()
+	if err != nil {
+		return nil, err
+	}
+	var symBuf bytes.Buffer
+	if err := binary.Write(&symBuf, b.f.ByteOrder, syms); err != nil {
+		return nil, err
+	}
+	symOff := le.add(symBuf.Bytes())
+
+	indirect := make([]uint32, len(b.indirect))
+	for i, idx := range b.indirect {
+		if idx&(indirectSymbolLocal|indirectSymbolAbs) != 0 {
+			indirect[i] = idx
+		} else if newIdx, ok := indexes[idx]; ok {
+			indirect[i] = newIdx
+		} else {
+			indirect[i] = indirectSymbolLocal
+		}
+	}
+	var indBuf bytes.Buffer
+	if err := binary.Write(&indBuf, b.f.ByteOrder, indirect); err != nil {
+		return nil, err
+	}
+	indirectOff := le.add(indBuf.Bytes())
+	strOff := le.add(strtab)
+
+	// layout segments
+	pageSize := b.pageSize()
+	var fileOff uint64
+	for _, seg := range b.segs {
+		if len(seg.data) == 0 {
+			continue
+		}
+		seg.newOff = fileOff
+		fileOff += (uint64(len(seg.data)) + pageSize - 1) &^ (pageSize - 1)
+	}
+	linkeditOff := fileOff
+	linkeditSize := uint64(le.Len())
+
+	// rewrite the load commands
+	var cmds bytes.Buffer
+	ncmds := uint32(0)
+	for off := 0; off+8 <= len(b.cmds); {
+		cmd := b.f.ByteOrder.Uint32(b.cmds[off:])
+		size := int(b.f.ByteOrder.Uint32(b.cmds[off+4:]))
+		raw := make([]byte, size)
+		copy(raw, b.cmds[off:off+size])
+		off += size
+
+		put := func(field int, v uint32) { b.f.ByteOrder.PutUint32(raw[field:], v) }
+		put64 := func(field int, v uint64) { b.f.ByteOrder.PutUint64(raw[field:], v) }
+
+		switch cmd {
+		case lcDyldChainedFixups, lcSegmentSplitInfo, lcCodeSignature: // not valid outside of the cache
+			continue
+		case lcSegment64:
+			name := strings.TrimRight(string(raw[8:24]), "\x00")
+			if name == "__LINKEDIT" {
+				put64(32, (linkeditSize+pageSize-1)&^(pageSize-1)) // vmsize
+				put64(40, linkeditOff)                             // fileoff
+				put64(48, linkeditSize)                            // filesize
+				break
+			}
+			var seg *dylibSeg
+			for _, s := range b.segs {
+				if s.name() == name {
+					seg = s
+				}
+			}
+			if seg == nil {
+				break
+			}
+			put64(40, seg.newOff)
+			put64(48, uint64(len(seg.data)))
+			for i := range seg.sections {
+				sec := seg.sections[i]
+				secOff := 72 + i*80
+				switch sec.Flags & sectionTypeMask {
+				case sZeroFill, sGBZeroFill, sThreadLocalZeroFill:
+					put(secOff+48, 0)
+				default:
+					if len(seg.data) > 0 {
+						put(secOff+48, uint32(seg.newOff+sec.Addr-seg.Addr))
+					}
+				}
+			}
+		case lcSymtab:
+			put(8, uint32(linkeditOff)+symOff)
+			put(12, uint32(len(syms)))
+			put(16, uint32(linkeditOff)+strOff)
+			put(20, uint32(len(strtab)))
+		case lcDysymtab:
+			var dysym dylibDysymtab
+			binary.Read(bytes.NewReader(raw), b.f.ByteOrder, &dysym)
+			dysym.Ilocalsym, dysym.Nlocalsym = 0, nlocal
+			dysym.Iextdefsym, dysym.Nextdefsym = nlocal, next
+			dysym.Iundefsym, dysym.Nundefsym = nlocal+next, uint32(len(syms))-nlocal-next
+			dysym.Tocoffset, dysym.Ntoc = 0, 0
+			dysym.Modtaboff, dysym.Nmodtab = 0, 0
+			dysym.Extrefsymoff, dysym.Nextrefsyms = 0, 0
+			dysym.Indirectsymoff, dysym.Nindirectsyms = uint32(linkeditOff)+indirectOff, uint32(len(indirect))
+			if len(indirect) == 0 {
+				dysym.Indirectsymoff = 0
+			}
+			dysym.Extreloff, dysym.Nextrel = 0, 0
+			dysym.Locreloff, dysym.Nlocrel = 0, 0
+			var buf bytes.Buffer
+			binary.Write(&buf, b.f.ByteOrder, dysym)
+			copy(raw, buf.Bytes())
+		case lcDyldInfo, lcDyldInfoOnly: // the cache has already applied rebases and binds (besides the restored ones)
+			for field := 8; field < 40; field += 4 {
+				put(field, 0)
+			}
+			if len(binds) > 0 {
+				put(16, uint32(linkeditOff)+bindOff)
+				put(20, uint32(len(binds)))
+			}
+			put(40, uint32(linkeditOff)+newExportOff)
+			put(44, uint32(len(exports)))
+			if len(exports) == 0 {
+				put(40, 0)
+			}
+		case lcDyldExportsTrie, lcFunctionStarts, lcDataInCode:
+			led := newLedata[cmd]
+			put(8, uint32(linkeditOff)+led[0])
+			put(12, led[1])
+		}
+
+		cmds.Write(raw)
+		ncmds++
+	}
+	if b.dyldInfo == nil && len(binds) > 0 {
+		info := dylibDyldInfo{
+			Cmd:      lcDyldInfoOnly,
+			Len:      uint32(binary.Size(dylibDyldInfo{})),
+			BindOff:  uint32(linkeditOff) + bindOff,
+			BindSize: uint32(len(binds)),
+		}
+		if err := binary.Write(&cmds, b.f.ByteOrder, info); err != nil {
+			return nil, err
+		}
+		ncmds++
+	}
+
+	out := make([]byte, linkeditOff+linkeditSize)
+	for _, seg := range b.segs {
+		copy(out[seg.newOff:], seg.data)
+	}
+	copy(out[linkeditOff:], le.Bytes())
+
+	// write the new header and load commands over the ones at the start of __TEXT
+	hdr := b.hdr
+	hdr.NCommands = ncmds
+	hdr.SizeOfCmds = uint32(cmds.Len())
+	hdr.Flags &^= mhDylibInCache
+	var hbuf bytes.Buffer
+	if err := binary.Write(&hbuf, b.f.ByteOrder, hdr); err != nil {
+		return nil, err
+	}
+	hbuf.Write(cmds.Bytes())
+	hdrEnd := binary.Size(hdr) + int(b.hdr.SizeOfCmds)
+	if hdrEnd > len(out) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if hbuf.Len() > hdrEnd {
+		// the added load commands must fit in the padding before the first section
+		for _, seg := range b.segs {
+			for _, sec := range seg.sections {
+				if len(seg.data) > 0 && seg.newOff == 0 && sec.Size > 0 && sec.Addr-seg.Addr < uint64(hbuf.Len()) {
+					return nil, fmt.Errorf("no room for the load commands before section %s", strings.TrimRight(string(sec.Name[:]), "\x00"))
+				}
+			}
+		}
+		hdrEnd = hbuf.Len()
+	}
+	copy(out, make([]byte, hdrEnd))
+	copy(out, hbuf.Bytes())
+
+	return out, nil
+}
@@ -3,9 +3,10 @@ package dyld
 import (
 	"archive/zip"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 
 	"github.com/apex/log"
@@ -14,13 +15,9 @@ import (
 	"github.com/pkg/errors"
 )
 
-func unmount(device string) error {
-	utils.Indent(log.Info, 2)("Unmounting DMG")
-	err := utils.Unmount(device, false)
-	if err != nil {
-		return errors.Wrapf(err, "failed to unmount %s", device)
-	}
-	return nil
+var cacheGlobs = []string{
+	"System/Library/Caches/com.apple.dyld/dyld_shared_cache_arm64*", // iOS
+	"System/Library/dyld/dyld_shared_cache_arm64*",                  // macOS
 }
 
 // Extract extracts dyld_shared_cache from ipsw
@@ -31,60 +28,65 @@ func Extract(ipsw, destPath string) error {
 		return errors.Wrap(err, "failed to parse ipsw info")
 	}
 
-	dmgs, err := utils.Unzip(ipsw, "", func(f *zip.File) bool {
+	dmg, err := utils.OpenZipFile(ipsw, func(f *zip.File) bool {
 		return strings.EqualFold(filepath.Base(f.Name), i.GetOsDmg())
 	})
 	if err != nil {
-		return errors.Wrap(err, "failed extract dyld_shared_cache from ipsw")
+		return errors.Wrapf(err, "failed to open %s in ipsw", i.GetOsDmg())
 	}
+	defer dmg.Close()
 
-	if len(dmgs) == 1 {
-		defer os.Remove(dmgs[0])
-
-		var searchStr, searchStrMacOS, mountPoint string
-		if runtime.GOOS == "darwin" {
-			searchStr = "System/Library/Caches/com.apple.dyld/dyld_shared_cache_arm64*"
-			searchStrMacOS = "System/Library/dyld/dyld_shared_cache_arm64*"
-			os.MkdirAll(destPath, os.ModePerm)
-			mountPoint = "/tmp/ios"
-		} else if runtime.GOOS == "linux" {
-			searchStr = "root/System/Library/Caches/com.apple.dyld/dyld_shared_cache_arm64*"
-			os.MkdirAll(filepath.Join("/data", destPath), os.ModePerm)
-			mountPoint = "/mnt"
-		}
-
-		utils.Indent(log.Info, 2)("Mounting DMG")
-		if err := utils.Mount(dmgs[0], mountPoint); err != nil {
-			return errors.Wrapf(err, "failed to mount %s", dmgs[0])
-		}
-		defer unmount(mountPoint)
+	utils.Indent(log.Info, 2)(fmt.Sprintf("Reading DMG %s", dmg.Name))
+	vol, err := utils.OpenDMGVolume(dmg, dmg.Size)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read filesystem in %s", dmg.Name)
+	}
 
-		matches, err := filepath.Glob(filepath.Join(mountPoint, searchStr))
+	var matches []string
+	for _, pattern := range cacheGlobs {
+		matches, err = fs.Glob(vol, pattern)
 		if err != nil {
 			return err
 		}
-
-		if len(matches) == 0 {
-			matches, err = filepath.Glob(filepath.Join(mountPoint, searchStrMacOS))
-			if err != nil {
-				return err
-			}
-			if len(matches) == 0 {
-				return errors.Errorf("failed to find dyld_shared_cache in ipsw: %s", ipsw)
-			}
-		}
-		for _, match := range matches {
-			dyldDest := filepath.Join(destPath, filepath.Base(match))
-			utils.Indent(log.Info, 3)(fmt.Sprintf("Extracting %s to %s", match, dyldDest))
-			err = utils.Cp(match, dyldDest)
-			if err != nil {
-				return err
-			}
+		if len(matches) > 0 {
+			break
 		}
+	}
+	if len(matches) == 0 {
+		return errors.Errorf("failed to find dyld_shared_cache in ipsw: %s", ipsw)
+	}
 
-	} else {
-		return fmt.Errorf("dyld.Extract found more or less than one DMG (should only be one): %v", dmgs)
+	if err := os.MkdirAll(destPath, os.ModePerm); err != nil {
+		return errors.Wrapf(err, "failed to create destination folder %s", destPath)
+	}
+
+	for _, match := range matches {
+		dyldDest := filepath.Join(destPath, filepath.Base(match))
+		utils.Indent(log.Info, 3)(fmt.Sprintf("Extracting %s to %s", match, dyldDest))
+		if err := copyFromFS(vol, match, dyldDest); err != nil {
+			return errors.Wrapf(err, "failed to extract %s", match)
+		}
 	}
 
 	return nil
 }
+
+func copyFromFS(fsys fs.FS, src, dst string) error {
+	from, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer from.Close()
+
+	to, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(to, from); err != nil {
+		to.Close()
+		return err
+	}
+
+	return to.Close()
+}
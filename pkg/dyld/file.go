@@ -6,10 +6,9 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"math/bits"
-	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho/pkg/codesign"
@@ -67,6 +66,8 @@ type File struct {
 	CodeSignatures map[mtypes.UUID]codesignature
 
 	AddressToSymbol map[uint64]string
+	symLock         sync.RWMutex
+	symIndex        *SymbolIndex
 
 	IsDyld4      bool
 	SubCacheInfo []SubCacheInfo
@@ -74,6 +75,9 @@ type File struct {
 
 	r       map[mtypes.UUID]io.ReaderAt
 	closers map[mtypes.UUID]io.Closer
+	workers int
+	fsOnce  sync.Once
+	dylibFS *dylibFS
 }
 
 // FormatError is returned by some operations if the data does
@@ -110,13 +114,26 @@ func getUUID(r io.ReaderAt) (mtypes.UUID, error) {
 	return uuid, nil
 }
 
-// Open opens the named file using os.Open and prepares it for use as a dyld binary.
-func Open(name string) (*File, error) {
+// Config is the optional configuration for Open
+type Config struct {
+	// MMap memory-maps the cache and its subcaches instead of reading them with pread
+	MMap bool
+	// Workers is the number of images analyzed concurrently by whole-cache operations (defaults to the number of CPUs)
+	Workers int
+}
+
+// Open opens the named file using os.Open (or mmap if requested by the config) and prepares it for use as a dyld binary.
+func Open(name string, cfg ...*Config) (*File, error) {
+	var conf Config
+	if len(cfg) > 0 && cfg[0] != nil {
+		conf = *cfg[0]
+	}
 
 	log.WithFields(log.Fields{
 		"cache": name,
+		"mmap":  conf.MMap,
 	}).Debug("Parsing Cache")
-	f, err := os.Open(name)
+	f, err := openCache(name, conf.MMap)
 	if err != nil {
 		return nil, err
 	}
@@ -127,6 +144,8 @@ func Open(name string) (*File, error) {
 		return nil, err
 	}
 
+	ff.workers = conf.Workers
+
 	if ff.Headers[ff.UUID].ImagesOffset == 0 && ff.Headers[ff.UUID].ImagesCount == 0 {
 
 		ff.IsDyld4 = true // NEW iOS15 dyld4 style caches
@@ -135,7 +154,7 @@ func Open(name string) (*File, error) {
 			log.WithFields(log.Fields{
 				"cache": fmt.Sprintf("%s.%d", name, i),
 			}).Debug("Parsing SubCache")
-			fsub, err := os.Open(fmt.Sprintf("%s.%d", name, i))
+			fsub, err := openCache(fmt.Sprintf("%s.%d", name, i), conf.MMap)
 			if err != nil {
 				return nil, err
 			}
@@ -160,7 +179,7 @@ func Open(name string) (*File, error) {
 			log.WithFields(log.Fields{
 				"cache": name + ".symbols",
 			}).Debug("Parsing SubCache")
-			fsym, err := os.Open(name + ".symbols")
+			fsym, err := openCache(name+".symbols", conf.MMap)
 			if err != nil {
 				return nil, err
 			}
@@ -192,6 +211,10 @@ func Open(name string) (*File, error) {
 // Close has no effect.
 func (f *File) Close() error {
 	var err error
+	if f.symIndex != nil {
+		f.symIndex.Close()
+		f.symIndex = nil
+	}
 	for uuid, closer := range f.closers {
 		if closer != nil {
 			err = closer.Close()
@@ -582,395 +605,99 @@ func (f *File) parseCache(r io.ReaderAt, uuid mtypes.UUID) error {
 
 // GetSlideInfo returns just the slideinfo header info
 func (f *File) GetSlideInfo(uuid mtypes.UUID, mapping *CacheMappingWithSlideInfo) error {
-	_, err := f.parseSlideInfo(uuid, mapping, false, false, 0, 0)
-	return err
+	slideInfo, _, err := f.readSlideInfo(uuid, mapping)
+	if err != nil {
+		log.Errorf("failed to parse dyld slide info: %v", err)
+		return nil
+	}
+	if f.SlideInfo != nil {
+		if f.SlideInfo.GetVersion() != slideInfo.GetVersion() {
+			return fmt.Errorf("found mixed slide info versions: %d and %d", f.SlideInfo.GetVersion(), slideInfo.GetVersion())
+		}
+	}
+	f.SlideInfo = slideInfo // only set while opening the cache so that page walks are safe for concurrent use
+	return nil
 }
 
 // DumpSlideInfo dumps dyld slide info for a given mapping
 func (f *File) DumpSlideInfo(uuid mtypes.UUID, mapping *CacheMappingWithSlideInfo) error {
-	_, err := f.parseSlideInfo(uuid, mapping, true, true, 0, 0)
-	return err
-}
+	slideInfo, _, err := f.readSlideInfo(uuid, mapping)
+	if err != nil {
+		return err
+	}
 
-// GetRebaseInfoForPages returns an offset to rebase address map for a given page index range
-func (f *File) GetRebaseInfoForPages(uuid mtypes.UUID, mapping *CacheMappingWithSlideInfo, start, end uint64) ([]Rebase, error) {
-	return f.parseSlideInfo(uuid, mapping, false, true, start, end)
+	switch slideInfo := slideInfo.(type) {
+	case CacheSlideInfo:
+		fmt.Printf("slide info version = %d\n", slideInfo.Version)
+		fmt.Printf("toc_count          = %d\n", slideInfo.TocCount)
+		fmt.Printf("data page count    = %d\n", mapping.Size/4096)
+	case CacheSlideInfo2:
+		fmt.Printf("slide info version = %d\n", slideInfo.Version)
+		fmt.Printf("page_size          = %d\n", slideInfo.PageSize)
+		fmt.Printf("delta_mask         = %#016x\n", slideInfo.DeltaMask)
+		fmt.Printf("value_add          = %#x\n", slideInfo.ValueAdd)
+		fmt.Printf("page_starts_count  = %d\n", slideInfo.PageStartsCount)
+		fmt.Printf("page_extras_count  = %d\n", slideInfo.PageExtrasCount)
+	case CacheSlideInfo3:
+		fmt.Printf("slide info version = %d\n", slideInfo.Version)
+		fmt.Printf("page_size          = %d\n", slideInfo.PageSize)
+		fmt.Printf("page_starts_count  = %d\n", slideInfo.PageStartsCount)
+		fmt.Printf("auth_value_add     = %#x\n", slideInfo.AuthValueAdd)
+	case CacheSlideInfo4:
+		fmt.Printf("slide info version = %d\n", slideInfo.Version)
+		fmt.Printf("page_size          = %d\n", slideInfo.PageSize)
+		fmt.Printf("delta_mask         = %#016x\n", slideInfo.DeltaMask)
+		fmt.Printf("value_add          = %#016x\n", slideInfo.ValueAdd)
+		fmt.Printf("page_starts_count  = %d\n", slideInfo.PageStartsCount)
+		fmt.Printf("page_extras_count  = %d\n", slideInfo.PageExtrasCount)
+	}
+
+	return f.walkSlideInfo(uuid, mapping, 0, 0, func(p *SlidPointer) error {
+		symName, ok := f.LookupSymbol(p.Target)
+		if !ok {
+			symName = "?"
+		}
+		fmt.Printf("    %s, sym: %s\n", p, symName)
+		return nil
+	})
 }
 
-func (f *File) parseSlideInfo(uuid mtypes.UUID, mapping *CacheMappingWithSlideInfo, dump bool, parsePages bool, startPage, endPage uint64) ([]Rebase, error) {
-	var symName string
+// GetRebaseInfoForPages returns an offset to rebase address map for a given page index range (all the pages if end is 0)
+func (f *File) GetRebaseInfoForPages(uuid mtypes.UUID, mapping *CacheMappingWithSlideInfo, start, end uint64) ([]Rebase, error) {
 	var rebases []Rebase
 
-	sr := io.NewSectionReader(f.r[uuid], 0, 1<<63-1)
-
-	sr.Seek(int64(mapping.SlideInfoOffset), io.SeekStart)
-
-	// get version
-	slideInfoVersionData := make([]byte, 4)
-	sr.Read(slideInfoVersionData)
-	slideInfoVersion := binary.LittleEndian.Uint32(slideInfoVersionData)
-
-	sr.Seek(int64(mapping.SlideInfoOffset), io.SeekStart)
-
-	switch slideInfoVersion {
-	case 1:
-		slideInfo := CacheSlideInfo{}
-		if err := binary.Read(sr, f.ByteOrder, &slideInfo); err != nil {
-			return nil, err
-		}
-
-		if f.SlideInfo != nil {
-			if f.SlideInfo.GetVersion() != slideInfo.GetVersion() {
-				return nil, fmt.Errorf("found mixed slide info versions: %d and %d", f.SlideInfo.GetVersion(), slideInfo.GetVersion())
-			}
-		}
-
-		f.SlideInfo = slideInfo
-
-		if !parsePages {
-			return nil, nil
-		}
-
-		output(dump, "slide info version = %d\n", slideInfo.Version)
-		output(dump, "toc_count          = %d\n", slideInfo.TocCount)
-		output(dump, "data page count    = %d\n", mapping.Size/4096)
-
-		sr.Seek(int64(mapping.SlideInfoOffset+uint64(slideInfo.EntriesOffset)), io.SeekStart)
-		entries := make([]CacheSlideInfoEntry, int(slideInfo.EntriesCount))
-		if err := binary.Read(sr, binary.LittleEndian, &entries); err != nil {
-			return nil, err
-		}
-
-		sr.Seek(int64(mapping.SlideInfoOffset+uint64(slideInfo.TocOffset)), io.SeekStart)
-		tocs := make([]uint16, int(slideInfo.TocCount))
-		if err := binary.Read(sr, binary.LittleEndian, &tocs); err != nil {
-			return nil, err
-		}
-		// FIXME: what should I do for version 1 rebases ?
-		for i, toc := range tocs {
-			output(dump, "%#08x: [% 5d,% 5d] ", int(mapping.Address)+i*4096, i, tocs[i])
-			for j := 0; i < int(slideInfo.EntriesSize); i++ {
-				output(dump, "%02x", entries[toc].bits[j])
-			}
-			output(dump, "\n")
-		}
-	case 2:
-		slideInfo := CacheSlideInfo2{}
-		if err := binary.Read(sr, f.ByteOrder, &slideInfo); err != nil {
-			return nil, err
-		}
-
-		if f.SlideInfo != nil {
-			if f.SlideInfo.GetVersion() != slideInfo.GetVersion() {
-				return nil, fmt.Errorf("found mixed slide info versions: %d and %d", f.SlideInfo.GetVersion(), slideInfo.GetVersion())
-			}
-		}
-
-		f.SlideInfo = slideInfo
-
-		if !parsePages {
-			return nil, nil
-		}
-
-		output(dump, "slide info version = %d\n", slideInfo.Version)
-		output(dump, "page_size          = %d\n", slideInfo.PageSize)
-		output(dump, "delta_mask         = %#016x\n", slideInfo.DeltaMask)
-		output(dump, "value_add          = %#x\n", slideInfo.ValueAdd)
-		output(dump, "page_starts_count  = %d\n", slideInfo.PageStartsCount)
-		output(dump, "page_extras_count  = %d\n", slideInfo.PageExtrasCount)
-
-		var targetValue uint64
-		var pointer uint64
-
-		sr.Seek(int64(mapping.SlideInfoOffset+uint64(slideInfo.PageStartsOffset)), io.SeekStart)
-		starts := make([]uint16, slideInfo.PageStartsCount)
-		if err := binary.Read(sr, binary.LittleEndian, &starts); err != nil {
-			return nil, err
-		}
-
-		if endPage == 0 || endPage > uint64(len(starts)-1) {
-			endPage = uint64(len(starts) - 1) // set end page to MAX
-		}
-
-		sr.Seek(int64(mapping.SlideInfoOffset+uint64(slideInfo.PageExtrasOffset)), io.SeekStart)
-		extras := make([]uint16, int(slideInfo.PageExtrasCount))
-		if err := binary.Read(sr, binary.LittleEndian, &extras); err != nil {
-			return nil, err
-		}
-
-		for i, start := range starts[startPage:endPage] {
-			i += int(startPage)
-			pageAddress := mapping.Address + uint64(uint32(i)*slideInfo.PageSize)
-			pageOffset := mapping.FileOffset + uint64(uint32(i)*slideInfo.PageSize)
-			rebaseChain := func(pageContent uint64, startOffset uint32) error {
-				deltaShift := uint64(bits.TrailingZeros64(slideInfo.DeltaMask) - 2)
-				delta := uint32(1)
-				for delta != 0 {
-					sr.Seek(int64(pageContent+uint64(startOffset)), io.SeekStart)
-					if err := binary.Read(sr, binary.LittleEndian, &pointer); err != nil {
-						return err
-					}
-
-					delta = uint32(pointer & slideInfo.DeltaMask >> deltaShift)
-					targetValue = slideInfo.SlidePointer(pointer)
-
-					if dump {
-						sym, ok := f.AddressToSymbol[targetValue]
-						if !ok {
-							symName = "?"
-						} else {
-							symName = sym
-						}
-						fmt.Printf("    [% 5d + %#04x]: %#016x = %#016x, sym: %s\n", i, startOffset, pointer, targetValue, symName)
-					} else {
-						sym, ok := f.AddressToSymbol[targetValue]
-						if !ok {
-							symName = ""
-						} else {
-							symName = sym
-						}
-						rebases = append(rebases, Rebase{
-							CacheFileOffset: uint64(startOffset) + pageOffset,
-							CacheVMAddress:  uint64(startOffset) + pageAddress,
-							Target:          targetValue,
-							Pointer:         pointer,
-							Symbol:          symName,
-						})
-					}
-					startOffset += delta
-				}
-				return nil
-			}
-
-			if start == DYLD_CACHE_SLIDE_PAGE_ATTR_NO_REBASE {
-				output(dump, "page[% 5d]: no rebasing\n", i)
-			} else if start&DYLD_CACHE_SLIDE_PAGE_ATTR_EXTRA != 0 {
-				output(dump, "page[% 5d]: ", i)
-				j := start & 0x3FFF
-				done := false
-				for !done {
-					aStart := extras[j]
-					output(dump, "start=%#04x ", aStart&0x3FFF)
-					pageStartOffset := (aStart & 0x3FFF) * 4
-					rebaseChain(pageOffset, uint32(pageStartOffset))
-					done = (extras[j] & DYLD_CACHE_SLIDE_PAGE_ATTR_END) != 0
-					j++
-				}
-				output(dump, "\n")
-			} else {
-				output(dump, "page[% 5d]: start=%#04X\n", i, starts[i])
-				rebaseChain(pageOffset, uint32(start*4))
-			}
-		}
-	case 3:
-		slideInfo := CacheSlideInfo3{}
-		if err := binary.Read(sr, binary.LittleEndian, &slideInfo); err != nil {
-			return nil, err
-		}
-
-		if f.SlideInfo != nil {
-			if f.SlideInfo.GetVersion() != slideInfo.GetVersion() {
-				return nil, fmt.Errorf("found mixed slide info versions: %d and %d", f.SlideInfo.GetVersion(), slideInfo.GetVersion())
-			}
-		}
-
-		f.SlideInfo = slideInfo
-
-		if !parsePages {
-			return nil, nil
-		}
-
-		output(dump, "slide info version = %d\n", slideInfo.Version)
-		output(dump, "page_size          = %d\n", slideInfo.PageSize)
-		output(dump, "page_starts_count  = %d\n", slideInfo.PageStartsCount)
-		output(dump, "auth_value_add     = %#x\n", slideInfo.AuthValueAdd)
-
-		var targetValue uint64
-		var pointer CacheSlidePointer3
-
-		starts := make([]uint16, slideInfo.PageStartsCount)
-		if err := binary.Read(sr, binary.LittleEndian, &starts); err != nil {
-			return nil, err
-		}
-
-		if endPage == 0 || endPage > uint64(len(starts)-1) {
-			endPage = uint64(len(starts) - 1) // set end page to MAX
-		}
-
-		for i, start := range starts[startPage:endPage] {
-			i += int(startPage)
-			pageAddress := mapping.Address + uint64(uint32(i)*slideInfo.PageSize)
-			pageOffset := mapping.FileOffset + uint64(uint32(i)*slideInfo.PageSize)
-
-			delta := uint64(start)
-
-			if delta == DYLD_CACHE_SLIDE_V3_PAGE_ATTR_NO_REBASE {
-				output(dump, "page[% 5d]: no rebasing\n", i)
-				continue
-			}
-
-			output(dump, "page[% 5d]: start=0x%04X\n", i, delta)
-
-			rebaseLocation := pageOffset
-			rebaseAddr := pageAddress
-
-			for {
-				rebaseLocation += delta
-				rebaseAddr += delta
-
-				sr.Seek(int64(rebaseLocation), io.SeekStart)
-				if err := binary.Read(sr, binary.LittleEndian, &pointer); err != nil {
-					return nil, err
-				}
-
-				if pointer.Authenticated() {
-					targetValue = slideInfo.AuthValueAdd + pointer.OffsetFromSharedCacheBase()
-				} else {
-					targetValue = pointer.SignExtend51()
-				}
-
-				if dump {
-					sym, ok := f.AddressToSymbol[targetValue]
-					if !ok {
-						symName = "?"
-					} else {
-						symName = sym
-					}
-					fmt.Printf("    [% 5d + 0x%05X] (off: %#x @ vaddr: %#x; raw: %#x => target: %#x) %s, sym: %s\n", i, (uint64)(rebaseLocation-pageOffset), rebaseLocation, rebaseAddr, pointer.Raw(), targetValue, pointer, symName)
-				} else {
-					sym, ok := f.AddressToSymbol[targetValue]
-					if !ok {
-						symName = ""
-					} else {
-						symName = sym
-					}
-					rebases = append(rebases, Rebase{
-						CacheFileOffset: rebaseLocation,
-						CacheVMAddress:  rebaseAddr,
-						Target:          targetValue,
-						Pointer:         pointer,
-						Symbol:          symName,
-					})
-				}
-
-				if pointer.OffsetToNextPointer() == 0 {
-					break
-				}
-
-				delta = pointer.OffsetToNextPointer() * 8
-			}
-		}
-	case 4:
-		slideInfo := CacheSlideInfo4{}
-		if err := binary.Read(sr, f.ByteOrder, &slideInfo); err != nil {
-			return nil, err
-		}
-
-		if f.SlideInfo != nil {
-			if f.SlideInfo.GetVersion() != slideInfo.GetVersion() {
-				return nil, fmt.Errorf("found mixed slide info versions: %d and %d", f.SlideInfo.GetVersion(), slideInfo.GetVersion())
-			}
-		}
-
-		f.SlideInfo = slideInfo
-
-		if !parsePages {
-			return nil, nil
-		}
-
-		output(dump, "slide info version = %d\n", slideInfo.Version)
-		output(dump, "page_size          = %d\n", slideInfo.PageSize)
-		output(dump, "delta_mask         = %#016x\n", slideInfo.DeltaMask)
-		output(dump, "value_add          = %#016x\n", slideInfo.ValueAdd)
-		output(dump, "page_starts_count  = %d\n", slideInfo.PageStartsCount)
-		output(dump, "page_extras_count  = %d\n", slideInfo.PageExtrasCount)
-
-		var targetValue uint64
-		var pointer uint32
-
-		sr.Seek(int64(mapping.SlideInfoOffset+uint64(slideInfo.PageStartsOffset)), io.SeekStart)
-		starts := make([]uint16, slideInfo.PageStartsCount)
-		if err := binary.Read(sr, binary.LittleEndian, &starts); err != nil {
-			return nil, err
-		}
-
-		if endPage == 0 { // set end page to MAX
-			endPage = uint64(len(starts) - 1)
-		}
-
-		sr.Seek(int64(mapping.SlideInfoOffset+uint64(slideInfo.PageExtrasOffset)), io.SeekStart)
-		extras := make([]uint16, int(slideInfo.PageExtrasCount))
-		if err := binary.Read(sr, binary.LittleEndian, &extras); err != nil {
-			return nil, err
-		}
-
-		for i, start := range starts[startPage:endPage] {
-			i += int(startPage)
-			pageAddress := mapping.Address + uint64(uint32(i)*slideInfo.PageSize)
-			pageOffset := mapping.FileOffset + uint64(uint32(i)*slideInfo.PageSize)
-			rebaseChainV4 := func(pageContent uint64, startOffset uint16) error {
-				deltaShift := uint64(bits.TrailingZeros64(slideInfo.DeltaMask) - 2)
-				pageOffset := uint32(startOffset)
-				delta := uint32(1)
-				for delta != 0 {
-					sr.Seek(int64(pageContent+uint64(pageOffset)), io.SeekStart)
-					if err := binary.Read(sr, binary.LittleEndian, &pointer); err != nil {
-						return err
-					}
-
-					delta = uint32(uint64(pointer) & slideInfo.DeltaMask >> deltaShift)
-					targetValue = slideInfo.SlidePointer(uint64(pointer))
-
-					if dump {
-						sym, ok := f.AddressToSymbol[targetValue]
-						if !ok {
-							symName = "?"
-						} else {
-							symName = sym
-						}
-						fmt.Printf("    [% 5d + %#04x]: %#08x = %#08x, sym: %s\n", i, pageOffset, pointer, targetValue, symName)
-					} else {
-						sym, ok := f.AddressToSymbol[targetValue]
-						if !ok {
-							symName = ""
-						} else {
-							symName = sym
-						}
-						rebases = append(rebases, Rebase{
-							CacheFileOffset: pageContent + uint64(pageOffset),
-							CacheVMAddress:  pageContent + uint64(pageAddress),
-							Target:          targetValue,
-							Pointer:         pointer,
-							Symbol:          symName,
-						})
-					}
-					pageOffset += delta
-				}
+	slideInfo, _, err := f.readSlideInfo(uuid, mapping)
+	if err != nil {
+		return nil, err
+	}
 
-				return nil
-			}
-			if start == DYLD_CACHE_SLIDE4_PAGE_NO_REBASE {
-				output(dump, "page[% 5d]: no rebasing\n", i)
-			} else if start&DYLD_CACHE_SLIDE4_PAGE_USE_EXTRA != 0 {
-				output(dump, "page[% 5d]: ", i)
-				j := (start & DYLD_CACHE_SLIDE4_PAGE_INDEX)
-				done := false
-				for !done {
-					aStart := extras[j]
-					output(dump, "start=0x%04X ", aStart&DYLD_CACHE_SLIDE4_PAGE_INDEX)
-					pageStartOffset := (aStart & DYLD_CACHE_SLIDE4_PAGE_INDEX) * 4
-					rebaseChainV4(pageOffset, pageStartOffset)
-					done = (extras[j] & DYLD_CACHE_SLIDE4_PAGE_EXTRA_END) != 0
-					j++
-				}
-				output(dump, "\n")
-			} else {
-				output(dump, "page[% 5d]: start=0x%04X\n", i, starts[i])
-				rebaseChainV4(pageOffset, start*4)
-			}
-		}
-	default:
-		log.Errorf("got unexpected dyld slide info version: %d", slideInfoVersion)
+	var startAddr, endAddr uint64
+	if end > 0 {
+		pageSize := uint64(slideInfo.GetPageSize())
+		startAddr, endAddr = mapping.Address+start*pageSize, mapping.Address+end*pageSize
+	}
+
+	if err := f.walkSlideInfo(uuid, mapping, startAddr, endAddr, func(p *SlidPointer) error {
+		var pointer interface{}
+		switch slideInfo.GetVersion() {
+		case 3:
+			pointer = CacheSlidePointer3(p.Raw)
+		case 4:
+			pointer = uint32(p.Raw)
+		default:
+			pointer = p.Raw
+		}
+		symName, _ := f.LookupSymbol(p.Target)
+		rebases = append(rebases, Rebase{
+			CacheFileOffset: p.CacheFileOffset,
+			CacheVMAddress:  p.CacheVMAddress,
+			Target:          p.Target,
+			Pointer:         pointer,
+			Symbol:          symName,
+		})
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
 	return rebases, nil
@@ -979,6 +706,19 @@ func (f *File) parseSlideInfo(uuid mtypes.UUID, mapping *CacheMappingWithSlideIn
 // ParsePatchInfo parses dyld patch info
 func (f *File) ParsePatchInfo() error {
 	if f.Headers[f.UUID].PatchInfoAddr > 0 {
+		// the v2+ patch_info starts with its version
+		uuid, off, err := f.GetOffset(f.Headers[f.UUID].PatchInfoAddr)
+		if err != nil {
+			return err
+		}
+		dat, err := f.ReadBytesForUUID(uuid, int64(off), 4)
+		if err != nil {
+			return err
+		}
+		if version := f.ByteOrder.Uint32(dat); version == 2 || version == 3 {
+			return f.parsePatchInfoV2(version)
+		}
+
 		// Read dyld patch_info entries.
 		uuid, patchInfoOffset, err := f.GetOffset(f.Headers[f.UUID].PatchInfoAddr + 8)
 		if err != nil {
@@ -1050,13 +790,28 @@ func (f *File) ParsePatchInfo() error {
 						exportName = ""
 					}
 					plocs := make([]CachePatchableLocation, patchExport.PatchLocationsCount)
+					locs := make([]PatchLocation, patchExport.PatchLocationsCount)
 					for locationIndex := uint32(0); locationIndex != patchExport.PatchLocationsCount; locationIndex++ {
-						plocs[locationIndex] = patchableLocations[patchExport.PatchLocationsStartIndex+locationIndex]
+						ploc := patchableLocations[patchExport.PatchLocationsStartIndex+locationIndex]
+						plocs[locationIndex] = ploc
+						locs[locationIndex] = PatchLocation{
+							Address:       ploc.Address(f.Headers[f.UUID].SharedRegionStart),
+							Addend:        ploc.Addend(),
+							High7:         ploc.High7(),
+							Authenticated: ploc.Authenticated(),
+							AddrDiversity: ploc.UsesAddressDiversity(),
+							Discriminator: uint16(ploc.Discriminator()),
+						}
+						if ploc.Authenticated() {
+							locs[locationIndex].Key = KeyName(ploc.Key() << 49)
+						}
 					}
 					f.Images[i].PatchableExports = append(f.Images[i].PatchableExports, patchableExport{
 						Name:           exportName,
 						OffsetOfImpl:   patchExport.CacheOffsetOfImpl,
+						Address:        f.Headers[f.UUID].SharedRegionStart + uint64(patchExport.CacheOffsetOfImpl),
 						PatchLocations: plocs,
+						Locations:      locs,
 					})
 				}
 			}
@@ -0,0 +1,327 @@
+package dyld
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+var (
+	_ fs.FS         = (*dylibFS)(nil)
+	_ fs.ReadDirFS  = (*dylibFS)(nil)
+	_ fs.StatFS     = (*dylibFS)(nil)
+	_ fs.ReadFileFS = (*dylibFS)(nil)
+)
+
+// FS returns a read-only io/fs.FS of the cache's dylibs where every image is a file at its install name
+// path (e.g. usr/lib/libobjc.A.dylib) whose contents are the standalone MachO returned by ExtractDylib.
+//
+// The dylibs are extracted on first access (Open or ReadFile) and then cached for the lifetime of the File.
+// Stat (and DirEntry.Info) does NOT extract: until a dylib is extracted its size is estimated from its segments
+// and __LINKEDIT tables (see dylibSize) and it is the exact size afterwards.
+func (f *File) FS() fs.FS {
+	f.fsOnce.Do(func() {
+		f.dylibFS = newDylibFS(f)
+	})
+	return f.dylibFS
+}
+
+// dylibFS implements fs.FS over the images of a cache
+type dylibFS struct {
+	f    *File
+	root *fsNode
+
+	mu     sync.Mutex
+	dylibs map[*CacheImage]*fsDylib
+}
+
+// fsNode is a directory or a dylib in the install name tree
+type fsNode struct {
+	name     string
+	image    *CacheImage // nil for directories
+	children map[string]*fsNode
+	names    []string // the sorted names of the children
+}
+
+func (n *fsNode) isDir() bool { return n.image == nil }
+
+// fsDylib is an extracted dylib (guarded by once so concurrent opens only extract it once)
+type fsDylib struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+func newDylibFS(f *File) *dylibFS {
+	fsys := &dylibFS{
+		f:      f,
+		root:   &fsNode{name: ".", children: make(map[string]*fsNode)},
+		dylibs: make(map[*CacheImage]*fsDylib),
+	}
+
+	for _, image := range f.Images {
+		name := strings.TrimPrefix(path.Clean("/"+image.Name), "/")
+		if len(name) == 0 {
+			continue
+		}
+		node := fsys.root
+		parts := strings.Split(name, "/")
+		for idx, elem := range parts {
+			child, ok := node.children[elem]
+			if !ok {
+				child = &fsNode{name: elem}
+				if idx == len(parts)-1 {
+					child.image = image
+				} else {
+					child.children = make(map[string]*fsNode)
+				}
+				node.children[elem] = child
+				node.names = append(node.names, elem)
+			} else if !child.isDir() || idx == len(parts)-1 {
+				log.Debugf("skipping %s as it conflicts with %s", image.Name, child.name)
+				break
+			}
+			node = child
+		}
+	}
+
+	var sortNames func(n *fsNode)
+	sortNames = func(n *fsNode) {
+		sort.Strings(n.names)
+		for _, child := range n.children {
+			if child.isDir() {
+				sortNames(child)
+			}
+		}
+	}
+	sortNames(fsys.root)
+
+	return fsys
+}
+
+// lookup returns the node at the given path
+func (fsys *dylibFS) lookup(op, name string) (*fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	node := fsys.root
+	if name == "." {
+		return node, nil
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if !node.isDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fmt.Errorf("not a directory")}
+		}
+		child, ok := node.children[elem]
+		if !ok {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// extract returns the (cached) standalone MachO of the image
+func (fsys *dylibFS) extract(image *CacheImage) ([]byte, error) {
+	fsys.mu.Lock()
+	dylib, ok := fsys.dylibs[image]
+	if !ok {
+		dylib = new(fsDylib)
+		fsys.dylibs[image] = dylib
+	}
+	fsys.mu.Unlock()
+
+	dylib.once.Do(func() {
+		dylib.data, dylib.err = fsys.f.ExtractDylib(image)
+	})
+
+	return dylib.data, dylib.err
+}
+
+// size returns the size of the extracted image (estimated from its load commands if it is NOT extracted yet)
+func (fsys *dylibFS) size(image *CacheImage) (int64, error) {
+	fsys.mu.Lock()
+	_, ok := fsys.dylibs[image]
+	fsys.mu.Unlock()
+	if ok {
+		// the dylib is extracted (or being extracted) so wait for its exact size
+		if data, err := fsys.extract(image); err == nil {
+			return int64(len(data)), nil
+		}
+	}
+	return fsys.f.dylibSize(image)
+}
+
+func (fsys *dylibFS) stat(op string, node *fsNode) (*fsInfo, error) {
+	fi := &fsInfo{node: node}
+	if !node.isDir() {
+		size, err := fsys.size(node.image)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: node.image.Name, Err: err}
+		}
+		fi.size = size
+	}
+	return fi, nil
+}
+
+// Open opens the named dylib (or directory) for reading
+func (fsys *dylibFS) Open(name string) (fs.File, error) {
+	node, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if node.isDir() {
+		return &fsDir{fsys: fsys, fi: &fsInfo{node: node}}, nil
+	}
+	data, err := fsys.extract(node.image)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsFile{
+		Reader: bytes.NewReader(data),
+		fi:     &fsInfo{node: node, size: int64(len(data))},
+	}, nil
+}
+
+// ReadFile returns the standalone MachO of the named dylib
+func (fsys *dylibFS) ReadFile(name string) ([]byte, error) {
+	node, err := fsys.lookup("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if node.isDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	data, err := fsys.extract(node.image)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	// the caller is allowed to modify the returned slice
+	return append([]byte(nil), data...), nil
+}
+
+// Stat returns a FileInfo describing the named dylib (or directory)
+func (fsys *dylibFS) Stat(name string) (fs.FileInfo, error) {
+	node, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.stat("stat", node)
+}
+
+// ReadDir reads the named directory and returns its entries sorted by filename
+func (fsys *dylibFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	node, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !node.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+	}
+	return fsys.readDir(node), nil
+}
+
+func (fsys *dylibFS) readDir(node *fsNode) []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(node.names))
+	for _, name := range node.names {
+		entries = append(entries, &fsDirEntry{fsys: fsys, node: node.children[name]})
+	}
+	return entries
+}
+
+// fsInfo implements fs.FileInfo
+type fsInfo struct {
+	node *fsNode
+	size int64
+}
+
+func (fi *fsInfo) Name() string       { return fi.node.name }
+func (fi *fsInfo) Size() int64        { return fi.size }
+func (fi *fsInfo) ModTime() time.Time { return time.Time{} }
+func (fi *fsInfo) IsDir() bool        { return fi.node.isDir() }
+
+func (fi *fsInfo) Mode() fs.FileMode {
+	if fi.node.isDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0755
+}
+
+// Sys returns the dylib's *CacheImage (or nil for directories)
+func (fi *fsInfo) Sys() interface{} {
+	if fi.node.isDir() {
+		return nil
+	}
+	return fi.node.image
+}
+
+// fsDirEntry implements fs.DirEntry
+type fsDirEntry struct {
+	fsys *dylibFS
+	node *fsNode
+}
+
+func (d *fsDirEntry) Name() string { return d.node.name }
+func (d *fsDirEntry) IsDir() bool  { return d.node.isDir() }
+
+func (d *fsDirEntry) Type() fs.FileMode {
+	if d.node.isDir() {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (d *fsDirEntry) Info() (fs.FileInfo, error) {
+	return d.fsys.stat("stat", d.node)
+}
+
+// fsFile implements fs.File and io.ReaderAt/io.Seeker for the dylibs
+type fsFile struct {
+	*bytes.Reader
+	fi *fsInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) { return f.fi, nil }
+func (f *fsFile) Close() error               { return nil }
+
+// fsDir implements fs.ReadDirFile
+type fsDir struct {
+	fsys    *dylibFS
+	fi      *fsInfo
+	entries []fs.DirEntry
+	offset  int
+	read    bool
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.fi, nil }
+func (d *fsDir) Close() error               { return nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.fi.node.name, Err: fmt.Errorf("is a directory")}
+}
+
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !d.read {
+		d.entries, d.read = d.fsys.readDir(d.fi.node), true
+	}
+
+	n := len(d.entries) - d.offset
+	if n == 0 && count > 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && n > count {
+		n = count
+	}
+	list := d.entries[d.offset : d.offset+n]
+	d.offset += n
+
+	return list, nil
+}
@@ -0,0 +1,73 @@
+package dyld
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/blacktop/ipsw/pkg/gadget"
+)
+
+// FindGadgets returns the ROP/JOP gadgets of up to depth instructions (before the return or indirect branch) in
+// the executable sections of the given images (or ALL images if none are given). The images are disassembled
+// concurrently (see Config.Workers) and the gadgets are de-duplicated across the images in cache order.
+func (f *File) FindGadgets(depth int, images ...*CacheImage) (*gadget.Set, error) {
+	var mu sync.Mutex
+	found := make(map[*CacheImage]*gadget.Set)
+
+	find := func(image *CacheImage) error {
+		set, err := f.findImageGadgets(image, depth)
+		if err != nil {
+			return fmt.Errorf("failed to find gadgets in %s: %v", image.Name, err)
+		}
+		mu.Lock()
+		found[image] = set
+		mu.Unlock()
+		return nil
+	}
+
+	if len(images) == 0 {
+		images = f.Images
+		if err := f.ForEachImage(find); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, image := range images {
+			if err := find(image); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	gadgets := gadget.NewSet(depth)
+	for _, image := range images {
+		gadgets.Merge(found[image])
+	}
+
+	return gadgets, nil
+}
+
+func (f *File) findImageGadgets(image *CacheImage, depth int) (*gadget.Set, error) {
+	m, err := image.GetPartialMacho()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	gadgets := gadget.NewSet(depth)
+	for _, sec := range m.Sections {
+		if attrs := sec.Flags.GetAttributes(); sec.Size == 0 || !attrs.IsPureInstructions() && !attrs.IsSomeInstructions() {
+			continue
+		}
+		uuid, off, err := f.GetOffset(sec.Addr)
+		if err != nil {
+			return nil, err
+		}
+		code, err := f.ReadBytesForUUID(uuid, int64(off), sec.Size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s: %v", sec.Seg, sec.Name, err)
+		}
+		gadgets.Add(image.Name, code, sec.Addr)
+	}
+
+	return gadgets, nil
+}
@@ -0,0 +1,67 @@
+package dyld
+
+import (
+	"fmt"
+
+	"github.com/blacktop/ipsw/pkg/classdump"
+)
+
+// objcCacheReader reads an image's Objective-C metadata out of the dyld_shared_cache
+type objcCacheReader struct {
+	cacheReader
+	selBase uint64
+	image   *CacheImage
+	images  map[uint64]string // the images containing the pointer targets
+}
+
+func (r *objcCacheReader) RelativeSelectorBase() uint64 {
+	return r.selBase
+}
+
+// ImageAtAddr returns the name of the image the pointer at addr points into (if it is NOT the image being read)
+func (r *objcCacheReader) ImageAtAddr(addr uint64) (string, bool) {
+	ptr, err := r.ReadPointerAtAddr(addr)
+	if err != nil || ptr == 0 {
+		return "", false
+	}
+	name, ok := r.images[ptr]
+	if !ok {
+		if image, err := r.f.GetImageContainingVMAddr(ptr); err == nil && image != r.image {
+			name = image.Name
+		}
+		r.images[ptr] = name
+	}
+	return name, len(name) > 0
+}
+
+// GetObjCHeaders parses the Objective-C metadata of a given image for generating its headers
+func (f *File) GetObjCHeaders(imageName string) (*classdump.Image, error) {
+	image, err := f.Image(imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := image.GetPartialMacho()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", image.Name, err)
+	}
+	defer m.Close()
+
+	secs := classdump.Sections(m)
+	if len(secs) == 0 {
+		return nil, classdump.ErrNoObjC
+	}
+
+	r := &objcCacheReader{cacheReader: cacheReader{f: f}, image: image, images: make(map[uint64]string)}
+	if sec, opt, err := f.getOptimizations(); err == nil && opt.Version == 16 {
+		r.selBase = sec.Addr + opt.RelativeMethodSelectorBaseAddressCacheOffset
+	}
+
+	img, err := classdump.Parse(r, secs)
+	if err != nil {
+		return nil, err
+	}
+	img.Name = image.Name
+
+	return img, nil
+}
@@ -17,8 +17,41 @@ type rangeEntry struct {
 
 type patchableExport struct {
 	Name           string
-	OffsetOfImpl   uint32
-	PatchLocations []CachePatchableLocation
+	OffsetOfImpl   uint32 // cache offset (v1) or offset from the dylib (v2+)
+	Address        uint64
+	Kind           PatchKind
+	PatchLocations []CachePatchableLocation // v1 only
+	Locations      []PatchLocation
+}
+
+// PatchLocation is a location in the cache that is rewritten when its export is interposed
+type PatchLocation struct {
+	Address       uint64 `json:"address"`
+	Client        string `json:"client,omitempty"` // the dylib using the export (v2+)
+	GOT           bool   `json:"got,omitempty"`    // the location is a shared GOT entry (v3)
+	Addend        uint64 `json:"addend,omitempty"`
+	High7         uint64 `json:"high7,omitempty"`
+	Authenticated bool   `json:"authenticated,omitempty"`
+	AddrDiversity bool   `json:"addr_div,omitempty"`
+	Key           string `json:"key,omitempty"`
+	Discriminator uint16 `json:"diversity,omitempty"`
+}
+
+func (l PatchLocation) String() string {
+	pStr := fmt.Sprintf("addr: %#x", l.Address)
+	if l.Addend > 0 {
+		pStr += fmt.Sprintf(", addend: %#x", l.Addend)
+	}
+	if l.Authenticated {
+		pStr += fmt.Sprintf(", key: %s, diversity: %#04x, addr_div: %t", l.Key, l.Discriminator, l.AddrDiversity)
+	}
+	if l.GOT {
+		pStr += ", got"
+	}
+	if len(l.Client) > 0 {
+		pStr += fmt.Sprintf("\t%s", l.Client)
+	}
+	return pStr
 }
 
 type astate struct {
@@ -100,6 +133,8 @@ func (a *astate) IsPrivatesDone() bool {
 }
 
 type analysis struct {
+	mu sync.Mutex // serializes the analysis passes of an image
+
 	State        astate
 	Dependencies []string
 	GotPointers  map[uint64]uint64
@@ -128,93 +163,141 @@ type CacheImage struct {
 
 	cache *File // pointer back to the dyld cache that the image belongs to
 	cuuid types.UUID
-	CacheReader
-	m  *macho.File
-	pm *macho.File // partial macho
+	m     *macho.File
+	pm    *macho.File // partial macho
+	mu    sync.Mutex  // guards m
+	pmu   sync.Mutex  // guards pm
+	r     *CacheReader
+	rmu   sync.Mutex // guards r
 }
 
-// NewCacheReader returns a CacheReader that reads from r
+// NewCacheReader returns a CacheReader that reads the image's dyld_shared_cache
 // starting at offset off and stops with EOF after n bytes.
-// It also stubs out the MachoReader required SeekToAddr and ReadAtAddr
-func NewCacheReader(off int64, n int64, u types.UUID) CacheReader {
-	return CacheReader{off, off, off + n, u}
+// It also implements the MachoReader required SeekToAddr and ReadAtAddr
+func (i *CacheImage) NewCacheReader(off int64, n int64) *CacheReader {
+	return &CacheReader{image: i, base: off, off: off, limit: off + n, ruuid: i.cuuid}
 }
 
 // CacheReader implements Read, Seek, and ReadAt on a section
 // of an underlying ReaderAt.
+//
+// Every MachO parsed from an image gets its own CacheReader so that the position
+// of one is never moved by another (the image itself is stateless)
 type CacheReader struct {
+	image *CacheImage
 	base  int64
 	off   int64
 	limit int64
-	ruuid types.UUID
+	ruuid types.UUID // the sub-cache the reader is positioned in
 }
 
-func (i *CacheImage) Read(p []byte) (n int, err error) {
-	if i.off >= i.limit {
+func (r *CacheReader) Read(p []byte) (n int, err error) {
+	if r.off >= r.limit {
 		return 0, io.EOF
 	}
-	if max := i.limit - i.off; int64(len(p)) > max {
+	if max := r.limit - r.off; int64(len(p)) > max {
 		p = p[0:max]
 	}
-	n, err = i.cache.r[i.ruuid].ReadAt(p, i.off)
-	i.off += int64(n)
+	n, err = r.image.cache.r[r.ruuid].ReadAt(p, r.off)
+	r.off += int64(n)
 	return
 }
 
-func (i *CacheImage) Seek(offset int64, whence int) (int64, error) {
+func (r *CacheReader) Seek(offset int64, whence int) (int64, error) {
 	switch whence {
 	default:
 		return 0, fmt.Errorf("Seek: invalid whence")
 	case io.SeekStart:
-		offset += i.base
+		offset += r.base
 	case io.SeekCurrent:
-		offset += i.off
+		offset += r.off
 	case io.SeekEnd:
-		offset += i.limit
+		offset += r.limit
 	}
-	if offset < i.base {
+	if offset < r.base {
 		return 0, fmt.Errorf("Seek: invalid offset")
 	}
-	i.off = offset
-	return offset - i.base, nil
+	r.off = offset
+	return offset - r.base, nil
 }
 
-func (i *CacheImage) ReadAt(p []byte, off int64) (n int, err error) {
-	if i.m == nil {
-		i.m, err = i.GetPartialMacho()
-		if err != nil {
-			return -1, err
-		}
-	}
-	i.ruuid, _, err = i.cache.GetOffset(i.m.Segment("__LINKEDIT").Addr)
-	// i.ruuid, offset, err = i.cache.GetOffset(addr)
-	if err != nil {
-		return -1, err
-	}
-	if off < 0 || off >= i.limit-i.base {
+func (r *CacheReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off >= r.limit-r.base {
 		return 0, io.EOF
 	}
-	off += i.base
-	if max := i.limit - off; int64(len(p)) > max {
-		p = p[0:max]
-		n, err = i.cache.r[i.ruuid].ReadAt(p, off)
+	off += r.base
+	if max := r.limit - off; int64(len(p)) > max {
+		n, err = r.image.ReadAt(p[0:max], off)
 		if err == nil {
 			err = io.EOF
 		}
 		return n, err
 	}
-	// fmt.Printf("image.ReadAt: cache_uuid=%s, uuid=%s, off=%#x\n", i.cuuid, uuid, off)
-	return i.cache.r[i.ruuid].ReadAt(p, off)
+	return r.image.ReadAt(p, off)
 }
 
-func (i *CacheImage) SeekToAddr(addr uint64) error {
-	uuid, offset, err := i.cache.GetOffset(addr)
+func (r *CacheReader) SeekToAddr(addr uint64) error {
+	uuid, offset, err := r.image.cache.GetOffset(addr)
 	if err != nil {
 		return err
 	}
-	i.ruuid = uuid
-	i.Seek(int64(offset), io.SeekStart)
-	return nil
+	r.ruuid = uuid
+	_, err = r.Seek(int64(offset)-r.base, io.SeekStart)
+	return err
+}
+
+// ReadAtAddr reads data at a given virtual address
+func (r *CacheReader) ReadAtAddr(buf []byte, addr uint64) (int, error) {
+	return r.image.ReadAtAddr(buf, addr)
+}
+
+// reader returns the image's own CacheReader (used by its Read, Seek and SeekToAddr)
+func (i *CacheImage) reader() *CacheReader {
+	if i.r == nil {
+		i.r = i.NewCacheReader(0, 1<<63-1)
+	}
+	return i.r
+}
+
+// Read reads from the image's own CacheReader
+//
+// The position is shared by every caller so concurrent workers should each use their own NewCacheReader
+func (i *CacheImage) Read(p []byte) (int, error) {
+	i.rmu.Lock()
+	defer i.rmu.Unlock()
+	return i.reader().Read(p)
+}
+
+// Seek sets the position of the image's own CacheReader
+func (i *CacheImage) Seek(offset int64, whence int) (int64, error) {
+	i.rmu.Lock()
+	defer i.rmu.Unlock()
+	return i.reader().Seek(offset, whence)
+}
+
+// SeekToAddr sets the position of the image's own CacheReader to a given virtual address
+func (i *CacheImage) SeekToAddr(addr uint64) error {
+	i.rmu.Lock()
+	defer i.rmu.Unlock()
+	return i.reader().SeekToAddr(addr)
+}
+
+// ReadAt reads data at an offset in the sub-cache that contains the image's __LINKEDIT
+// (the offsets of the MachO's load commands are relative to it)
+func (i *CacheImage) ReadAt(p []byte, off int64) (n int, err error) {
+	m, err := i.GetPartialMacho()
+	if err != nil {
+		return -1, err
+	}
+	ruuid, _, err := i.cache.GetOffset(m.Segment("__LINKEDIT").Addr)
+	if err != nil {
+		return -1, err
+	}
+	if off < 0 {
+		return 0, io.EOF
+	}
+	// fmt.Printf("image.ReadAt: cache_uuid=%s, uuid=%s, off=%#x\n", i.cuuid, uuid, off)
+	return i.cache.r[ruuid].ReadAt(p, off)
 }
 
 // ReadAtAddr reads data at a given virtual address
@@ -223,20 +306,15 @@ func (i *CacheImage) ReadAtAddr(buf []byte, addr uint64) (int, error) {
 	if err != nil {
 		return -1, err
 	}
-	i.ruuid = uuid
 	// fmt.Printf("image.ReadAt: cache_uuid=%s, uuid=%s, off=%#x\n", i.cuuid, uuid, off)
-	return i.cache.r[i.ruuid].ReadAt(buf, int64(off))
+	return i.cache.r[uuid].ReadAt(buf, int64(off))
 }
 
 // GetOffset returns the offset for a given virtual address
+// (in the sub-cache returned by File.GetOffset)
 func (i *CacheImage) GetOffset(address uint64) (uint64, error) {
-	u, o, err := i.cache.GetOffset(address)
-	if err != nil {
-		return 0, err
-	}
-	i.ruuid = u
-	// fmt.Printf("prim_uuid=%s, cache_uuid=%s, uuid=%s, off=%#x\n", i.cache.UUID, i.cuuid, u, o)
-	return o, nil
+	_, offset, err := i.cache.GetOffset(address)
+	return offset, err
 }
 
 // GetVMAddress returns the virtual address for a given offset
@@ -245,7 +323,13 @@ func (i *CacheImage) GetVMAddress(offset uint64) (uint64, error) {
 }
 
 // GetMacho parses dyld image as a MachO (slow)
+//
+// The MachO is cached and shared by every caller. Its reader keeps a position so it is NOT safe for
+// concurrent use: the ForEachImage workers must only use the MachO of the image they were handed.
 func (i *CacheImage) GetMacho() (*macho.File, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
 	if i.m != nil {
 		return i.m, nil
 	}
@@ -265,13 +349,13 @@ func (i *CacheImage) GetMacho() (*macho.File, error) {
 		rsBase = sec.Addr + opt.RelativeMethodSelectorBaseAddressCacheOffset
 	}
 
-	i.CacheReader = NewCacheReader(0, 1<<63-1, i.cuuid)
 	vma := types.VMAddrConverter{
 		Converter: func(addr uint64) uint64 {
 			return i.cache.SlideInfo.SlidePointer(addr)
 		},
 		VMAddr2Offet: func(address uint64) (uint64, error) {
-			return i.GetOffset(address)
+			offset, err := i.GetOffset(address)
+			return offset, err
 		},
 		Offet2VMAddr: func(offset uint64) (uint64, error) {
 			return i.GetVMAddress(offset)
@@ -280,7 +364,7 @@ func (i *CacheImage) GetMacho() (*macho.File, error) {
 	i.m, err = macho.NewFile(io.NewSectionReader(i.cache.r[i.cuuid], int64(offset), int64(i.TextSegmentSize)), macho.FileConfig{
 		Offset:               int64(offset),
 		SectionReader:        types.NewCustomSectionReader(i.cache.r[i.cuuid], &vma, 0, 1<<63-1),
-		CacheReader:          i,
+		CacheReader:          i.NewCacheReader(0, 1<<63-1),
 		VMAddrConverter:      vma,
 		RelativeSelectorBase: rsBase,
 	})
@@ -292,7 +376,11 @@ func (i *CacheImage) GetMacho() (*macho.File, error) {
 }
 
 // GetPartialMacho parses dyld image as a partial MachO (fast)
+// (it is cached and shared like the MachO returned by GetMacho)
 func (i *CacheImage) GetPartialMacho() (*macho.File, error) {
+	i.pmu.Lock()
+	defer i.pmu.Unlock()
+
 	if i.pm != nil {
 		return i.pm, nil
 	}
@@ -305,7 +393,8 @@ func (i *CacheImage) GetPartialMacho() (*macho.File, error) {
 			return i.cache.SlideInfo.SlidePointer(addr)
 		},
 		VMAddr2Offet: func(address uint64) (uint64, error) {
-			return i.GetOffset(address)
+			offset, err := i.GetOffset(address)
+			return offset, err
 		},
 		Offet2VMAddr: func(offset uint64) (uint64, error) {
 			return i.GetVMAddress(offset)
@@ -328,7 +417,7 @@ func (i *CacheImage) GetPartialMacho() (*macho.File, error) {
 			types.LC_LOAD_UPWARD_DYLIB},
 		Offset:          int64(offset),
 		SectionReader:   types.NewCustomSectionReader(i.cache.r[i.cuuid], &vma, 0, 1<<63-1),
-		CacheReader:     i,
+		CacheReader:     i.NewCacheReader(0, 1<<63-1),
 		VMAddrConverter: vma,
 		// RelativeSelectorBase: rsBase,
 	})
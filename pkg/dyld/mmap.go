@@ -0,0 +1,48 @@
+package dyld
+
+import (
+	"io"
+	"os"
+)
+
+type cacheFile interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// mmapReader is an io.ReaderAt over a read-only memory mapped cache file
+type mmapReader struct {
+	data  []byte
+	unmap func([]byte) error
+}
+
+func (r *mmapReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *mmapReader) Close() error {
+	if r.data == nil {
+		return nil
+	}
+	data := r.data
+	r.data = nil
+	return r.unmap(data)
+}
+
+// openCache opens a cache file, memory mapping it if requested and supported
+func openCache(name string, mmap bool) (cacheFile, error) {
+	if !mmap {
+		return os.Open(name)
+	}
+	return mmapCache(name)
+}
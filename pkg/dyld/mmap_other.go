@@ -0,0 +1,11 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package dyld
+
+import "os"
+
+// mmapCache falls back to reading the cache with pread on platforms without mmap support
+func mmapCache(name string) (cacheFile, error) {
+	return os.Open(name)
+}
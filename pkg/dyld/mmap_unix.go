@@ -0,0 +1,37 @@
+//go:build darwin || linux
+// +build darwin linux
+
+package dyld
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func mmapCache(name string) (cacheFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() // the mapping stays valid after the file is closed
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return &mmapReader{unmap: unix.Munmap}, nil
+	}
+	if int64(int(fi.Size())) != fi.Size() {
+		return nil, fmt.Errorf("%s is too large to mmap", name)
+	}
+
+	data, err := unix.Mmap(int(f.Fd()), 0, int(fi.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mmap %s: %v", name, err)
+	}
+
+	return &mmapReader{data: data, unmap: unix.Munmap}, nil
+}
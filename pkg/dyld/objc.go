@@ -368,7 +368,7 @@ func (f *File) offsetsToMap(offsets []int32, fileOffset int64) map[string]uint64
 			addr, _ := f.GetVMAddressForUUID(f.UUID, uint64(int32(fileOffset)+ptr))
 			objcMap[strings.Trim(s, "\x00")] = addr
 
-			f.AddressToSymbol[addr] = strings.Trim(s, "\x00")
+			f.setSymbol(addr, strings.Trim(s, "\x00"))
 		}
 
 	}
@@ -555,13 +555,13 @@ func (f *File) ClassesForImage(imageNames ...string) error {
 					image.ObjC.ClassRefs[ptr] = c
 
 					if len(image.ObjC.ClassRefs[ptr].Name) > 0 {
-						f.AddressToSymbol[sec.Addr+uint64(idx*8)] = fmt.Sprintf("class_%s", image.ObjC.ClassRefs[ptr].Name)
-						if sym, ok := f.AddressToSymbol[ptr]; ok {
+						f.setSymbol(sec.Addr+uint64(idx*8), fmt.Sprintf("class_%s", image.ObjC.ClassRefs[ptr].Name))
+						if sym, ok := f.symbolAt(ptr); ok {
 							if len(sym) < len(image.ObjC.ClassRefs[ptr].Name) {
-								f.AddressToSymbol[ptr] = image.ObjC.ClassRefs[ptr].Name
+								f.setSymbol(ptr, image.ObjC.ClassRefs[ptr].Name)
 							}
 						} else {
-							f.AddressToSymbol[ptr] = image.ObjC.ClassRefs[ptr].Name
+							f.setSymbol(ptr, image.ObjC.ClassRefs[ptr].Name)
 						}
 					}
 				}
@@ -602,8 +602,8 @@ func (f *File) ProtocolsForImage(imageNames ...string) error {
 			}
 		}
 		for k, v := range image.ObjC.ProtoRefs {
-			f.AddressToSymbol[v.Ptr] = v.Name
-			f.AddressToSymbol[k] = fmt.Sprintf("proto_%s", v.Name)
+			f.setSymbol(v.Ptr, v.Name)
+			f.setSymbol(k, fmt.Sprintf("proto_%s", v.Name))
 		}
 		m.Close()
 	}
@@ -662,13 +662,13 @@ func (f *File) SelectorsForImage(imageNames ...string) error {
 				}
 
 				if len(image.ObjC.SelRefs[ptr].Name) > 0 {
-					f.AddressToSymbol[ptr] = fmt.Sprintf("sel_%s", image.ObjC.SelRefs[ptr].Name)
-					if sym, ok := f.AddressToSymbol[sel]; ok {
+					f.setSymbol(ptr, fmt.Sprintf("sel_%s", image.ObjC.SelRefs[ptr].Name))
+					if sym, ok := f.symbolAt(sel); ok {
 						if len(sym) < len(image.ObjC.SelRefs[ptr].Name) {
-							f.AddressToSymbol[sel] = image.ObjC.SelRefs[ptr].Name
+							f.setSymbol(sel, image.ObjC.SelRefs[ptr].Name)
 						}
 					} else {
-						f.AddressToSymbol[sel] = image.ObjC.SelRefs[ptr].Name
+						f.setSymbol(sel, image.ObjC.SelRefs[ptr].Name)
 					}
 				}
 			}
@@ -750,12 +750,12 @@ func (f *File) MethodsForImage(imageNames ...string) error {
 						Types:     t,
 					})
 					if len(n) > 0 {
-						if sym, ok := f.AddressToSymbol[impVMAddr]; ok {
+						if sym, ok := f.symbolAt(impVMAddr); ok {
 							if len(sym) < len(n) {
-								f.AddressToSymbol[impVMAddr] = n
+								f.setSymbol(impVMAddr, n)
 							}
 						} else {
-							f.AddressToSymbol[impVMAddr] = n
+							f.setSymbol(impVMAddr, n)
 						}
 					}
 				}
@@ -774,8 +774,6 @@ func (f *File) MethodsForImage(imageNames ...string) error {
 
 // ImpCachesForImage dumps all of the Objective-C imp caches for a given image
 func (f *File) ImpCachesForImage(imageNames ...string) error {
-	sr := io.NewSectionReader(f.r[f.UUID], 0, 1<<63-1)
-
 	var optOffsets objc.OptOffsets
 	// var optOffsets objc.OptOffsets2
 	var selectorStringVMAddrStart uint64
@@ -863,11 +861,12 @@ func (f *File) ImpCachesForImage(imageNames ...string) error {
 				}
 
 				if f.SlideInfo.SlidePointer(c.MethodCacheProperties) > 0 {
-					off, err := image.GetOffset(f.SlideInfo.SlidePointer(c.MethodCacheProperties))
+					uuid, off, err := f.GetOffset(f.SlideInfo.SlidePointer(c.MethodCacheProperties))
 					if err != nil {
 						return fmt.Errorf("failed to convert vmaddr: %v", err)
 					}
 
+					sr := io.NewSectionReader(f.r[uuid], 0, 1<<63-1)
 					sr.Seek(int64(off), io.SeekStart)
 
 					var impCache objc.ImpCache
@@ -956,7 +955,7 @@ func (f *File) CFStringsForImage(imageNames ...string) error {
 					}
 
 					if len(image.ObjC.CFStrings[idx].Name) > 0 {
-						f.AddressToSymbol[image.ObjC.CFStrings[idx].Address] = image.ObjC.CFStrings[idx].Name // TODO: check the mem consumption
+						f.setSymbol(image.ObjC.CFStrings[idx].Address, image.ObjC.CFStrings[idx].Name) // TODO: check the mem consumption
 						// fmt.Printf("    %#x: %#v\n", cfstrings[idx].Address, cfstrings[idx].Name)
 					}
 				}
@@ -1110,7 +1109,7 @@ func (f *File) ParseObjcForImage(imageNames ...string) error {
 		images = f.Images
 	}
 
-	for _, image := range images {
+	parse := func(image *CacheImage) error {
 		if err := f.CFStringsForImage(image.Name); err != nil {
 			return fmt.Errorf("failed to parse objc cfstrings for image %s: %v", image.Name, err)
 		}
@@ -1133,6 +1132,18 @@ func (f *File) ParseObjcForImage(imageNames ...string) error {
 		if err := f.ProtocolsForImage(image.Name); err != nil {
 			return fmt.Errorf("failed to parse objc protocols for image %s: %v", image.Name, err)
 		}
+		return nil
+	}
+
+	if len(images) == len(f.Images) {
+		// parse the whole cache concurrently
+		return f.ForEachImage(parse)
+	}
+
+	for _, image := range images {
+		if err := parse(image); err != nil {
+			return err
+		}
 	}
 
 	return nil
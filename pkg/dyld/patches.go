@@ -0,0 +1,179 @@
+package dyld
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// readPatchArray reads the patch table array at the given unslid address into data
+func (f *File) readPatchArray(addr uint64, data interface{}) error {
+	if addr == 0 {
+		return nil
+	}
+	uuid, off, err := f.GetOffset(addr)
+	if err != nil {
+		return err
+	}
+	sr := io.NewSectionReader(f.r[uuid], int64(off), 1<<63-1)
+	return binary.Read(sr, f.ByteOrder, data)
+}
+
+// parsePatchInfoV2 parses the v2/v3 patch tables which record which client dylib uses which export
+func (f *File) parsePatchInfoV2(version uint32) error {
+	var info CachePatchInfoV3
+	if version == 3 {
+		if err := f.readPatchArray(f.Headers[f.UUID].PatchInfoAddr, &info); err != nil {
+			return fmt.Errorf("failed to read patch info v3: %v", err)
+		}
+	} else if err := f.readPatchArray(f.Headers[f.UUID].PatchInfoAddr, &info.CachePatchInfoV2); err != nil {
+		return fmt.Errorf("failed to read patch info v2: %v", err)
+	}
+
+	imagePatches := make([]CacheImagePatchesV2, info.PatchTableArrayCount)
+	if err := f.readPatchArray(info.PatchTableArrayAddr, imagePatches); err != nil {
+		return fmt.Errorf("failed to read image patches: %v", err)
+	}
+	imageExports := make([]CacheImageExportV2, info.PatchImageExportsArrayCount)
+	if err := f.readPatchArray(info.PatchImageExportsArrayAddr, imageExports); err != nil {
+		return fmt.Errorf("failed to read image exports: %v", err)
+	}
+	clients := make([]CacheImageClientsV2, info.PatchClientsArrayCount)
+	if err := f.readPatchArray(info.PatchClientsArrayAddr, clients); err != nil {
+		return fmt.Errorf("failed to read patch clients: %v", err)
+	}
+	clientExports := make([]CachePatchableExportV2, info.PatchClientExportsArrayCount)
+	if err := f.readPatchArray(info.PatchClientExportsArrayAddr, clientExports); err != nil {
+		return fmt.Errorf("failed to read patch client exports: %v", err)
+	}
+	locations := make([]CachePatchableLocationV2, info.PatchLocationArrayCount)
+	if err := f.readPatchArray(info.PatchLocationArrayAddr, locations); err != nil {
+		return fmt.Errorf("failed to read patch locations: %v", err)
+	}
+
+	uuid, off, err := f.GetOffset(info.PatchExportNamesAddr)
+	if err != nil {
+		return err
+	}
+	exportNames, err := f.ReadBytesForUUID(uuid, int64(off), info.PatchExportNamesSize)
+	if err != nil {
+		return fmt.Errorf("failed to read patch export names: %v", err)
+	}
+
+	newLocation := func(addr uint64, loc patchLocationInfo) PatchLocation {
+		pl := PatchLocation{
+			Address:       addr,
+			Addend:        loc.Addend(),
+			High7:         loc.High7(),
+			Authenticated: loc.Authenticated(),
+			AddrDiversity: loc.UsesAddressDiversity(),
+			Discriminator: uint16(loc.Discriminator()),
+		}
+		if loc.Authenticated() {
+			pl.Key = KeyName(loc.Key() << 49)
+		}
+		return pl
+	}
+
+	// the patchable exports by their index in the image exports array
+	exports := make(map[uint32]*patchableExport)
+
+	for i, iPatch := range imagePatches {
+		if i >= len(f.Images) {
+			break
+		}
+		image := f.Images[i]
+		image.PatchableExports = make([]patchableExport, 0, iPatch.PatchExportsCount)
+		for idx := iPatch.PatchExportsStartIndex; idx < iPatch.PatchExportsStartIndex+iPatch.PatchExportsCount && int(idx) < len(imageExports); idx++ {
+			export := imageExports[idx]
+			var name string
+			if off := export.NameOffset(); int(off) < len(exportNames) {
+				name = cstring(exportNames[off:])
+			}
+			image.PatchableExports = append(image.PatchableExports, patchableExport{
+				Name:         name,
+				OffsetOfImpl: export.DylibOffsetOfImpl,
+				Address:      image.LoadAddress + uint64(export.DylibOffsetOfImpl),
+				Kind:         export.Kind(),
+			})
+		}
+		for j := range image.PatchableExports {
+			exports[iPatch.PatchExportsStartIndex+uint32(j)] = &image.PatchableExports[j]
+		}
+	}
+
+	// the locations in each client dylib that use the image's exports
+	for _, iPatch := range imagePatches {
+		for cidx := iPatch.PatchClientsStartIndex; cidx < iPatch.PatchClientsStartIndex+iPatch.PatchClientsCount && int(cidx) < len(clients); cidx++ {
+			client := clients[cidx]
+			if int(client.ClientDylibIndex) >= len(f.Images) {
+				return fmt.Errorf("patch client dylib index %d out of range", client.ClientDylibIndex)
+			}
+			clientImage := f.Images[client.ClientDylibIndex]
+			for eidx := client.PatchExportsStartIndex; eidx < client.PatchExportsStartIndex+client.PatchExportsCount && int(eidx) < len(clientExports); eidx++ {
+				cexport := clientExports[eidx]
+				export, ok := exports[cexport.ImageExportIndex]
+				if !ok {
+					continue
+				}
+				for lidx := cexport.PatchLocationsStartIndex; lidx < cexport.PatchLocationsStartIndex+cexport.PatchLocationsCount && int(lidx) < len(locations); lidx++ {
+					loc := newLocation(clientImage.LoadAddress+uint64(locations[lidx].DylibOffsetOfUse), locations[lidx].Info)
+					loc.Client = clientImage.Name
+					export.Locations = append(export.Locations, loc)
+				}
+			}
+		}
+	}
+
+	if version < 3 || info.GotClientsArrayAddr == 0 {
+		return nil
+	}
+
+	// the shared cache GOT entries that point to the image's exports
+	gotClients := make([]CacheImageGotClientsV3, info.GotClientsArrayCount)
+	if err := f.readPatchArray(info.GotClientsArrayAddr, gotClients); err != nil {
+		return fmt.Errorf("failed to read GOT clients: %v", err)
+	}
+	gotExports := make([]CachePatchableExportV2, info.GotClientExportsArrayCount)
+	if err := f.readPatchArray(info.GotClientExportsArrayAddr, gotExports); err != nil {
+		return fmt.Errorf("failed to read GOT client exports: %v", err)
+	}
+	gotLocations := make([]CachePatchableLocationV3, info.GotLocationArrayCount)
+	if err := f.readPatchArray(info.GotLocationArrayAddr, gotLocations); err != nil {
+		return fmt.Errorf("failed to read GOT locations: %v", err)
+	}
+
+	for _, gotClient := range gotClients {
+		for eidx := gotClient.PatchExportsStartIndex; eidx < gotClient.PatchExportsStartIndex+gotClient.PatchExportsCount && int(eidx) < len(gotExports); eidx++ {
+			gexport := gotExports[eidx]
+			export, ok := exports[gexport.ImageExportIndex]
+			if !ok {
+				continue
+			}
+			for lidx := gexport.PatchLocationsStartIndex; lidx < gexport.PatchLocationsStartIndex+gexport.PatchLocationsCount && int(lidx) < len(gotLocations); lidx++ {
+				loc := newLocation(f.Headers[f.UUID].SharedRegionStart+gotLocations[lidx].CacheOffsetOfUse, gotLocations[lidx].Info)
+				loc.GOT = true
+				export.Locations = append(export.Locations, loc)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetPatchLocations returns every location in the cache that is rewritten when the given export is interposed
+// by the image that exports it (ParsePatchInfo must be called first)
+func (f *File) GetPatchLocations(symbol string) (map[string][]PatchLocation, error) {
+	locations := make(map[string][]PatchLocation)
+	for _, image := range f.Images {
+		for _, export := range image.PatchableExports {
+			if export.Name == symbol {
+				locations[image.Name] = append(locations[image.Name], export.Locations...)
+			}
+		}
+	}
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("no patchable export named %s", symbol)
+	}
+	return locations, nil
+}
@@ -0,0 +1,60 @@
+package dyld
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Workers returns the number of images analyzed concurrently by whole-cache operations
+func (f *File) Workers() int {
+	if f.workers > 0 {
+		return f.workers
+	}
+	return runtime.NumCPU()
+}
+
+// ForEachImage calls fn for every image in the cache on a pool of workers
+// and returns the first error (no new images are handed out after an error)
+func (f *File) ForEachImage(fn func(*CacheImage) error) error {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+
+	images := make(chan *CacheImage)
+	done := make(chan struct{})
+
+	workers := f.Workers()
+	if workers > len(f.Images) {
+		workers = len(f.Images)
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for image := range images {
+				if err := fn(image); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(done)
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, image := range f.Images {
+		select {
+		case images <- image:
+		case <-done:
+			break feed
+		}
+	}
+	close(images)
+	wg.Wait()
+
+	return firstErr
+}
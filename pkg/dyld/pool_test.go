@@ -0,0 +1,125 @@
+package dyld
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	mtypes "github.com/blacktop/go-macho/types"
+)
+
+// newTestFile returns a cache of a main cache (mapped at 0x1000) and a sub-cache (mapped at 0x8000)
+// whose bytes are the low byte of their offset plus 0x00 and 0x80 respectively
+func newTestFile(images, workers int) *File {
+	main, sub := mtypes.UUID{1}, mtypes.UUID{2}
+	data := func(seed byte) []byte {
+		b := make([]byte, 0x1000)
+		for idx := range b {
+			b[idx] = seed + byte(idx)
+		}
+		return b
+	}
+	f := &File{
+		UUID: main,
+		Mappings: map[mtypes.UUID]cacheMappings{
+			main: {{CacheMappingInfo: CacheMappingInfo{Address: 0x1000, Size: 0x1000}}},
+			sub:  {{CacheMappingInfo: CacheMappingInfo{Address: 0x8000, Size: 0x1000}}},
+		},
+		r: map[mtypes.UUID]io.ReaderAt{
+			main: bytes.NewReader(data(0)),
+			sub:  bytes.NewReader(data(0x80)),
+		},
+		workers: workers,
+	}
+	for idx := 0; idx < images; idx++ {
+		f.Images = append(f.Images, &CacheImage{Index: uint32(idx), cache: f, cuuid: main})
+	}
+	return f
+}
+
+func TestForEachImageReaders(t *testing.T) {
+	f := newTestFile(64, 8)
+
+	var visited int32
+	err := f.ForEachImage(func(image *CacheImage) error {
+		atomic.AddInt32(&visited, 1)
+		// every worker moves its own reader back and forth between the sub-caches
+		// while looking up addresses through the other workers' images
+		r := image.NewCacheReader(0, 1<<63-1)
+		for n := 0; n < 0x100; n++ {
+			addr, want := 0x1000+uint64(n), byte(n)
+			if n%2 == 1 {
+				addr, want = 0x8000+uint64(n), 0x80+byte(n)
+			}
+			if err := r.SeekToAddr(addr); err != nil {
+				return err
+			}
+			var b [1]byte
+			if _, err := r.Read(b[:]); err != nil {
+				return err
+			}
+			if b[0] != want {
+				return fmt.Errorf("image %d: read %#x at %#x (expected %#x)", image.Index, b[0], addr, want)
+			}
+			other := f.Images[(int(image.Index)+n)%len(f.Images)]
+			if _, err := other.ReadAtAddr(b[:], addr); err != nil {
+				return err
+			}
+			if b[0] != want {
+				return fmt.Errorf("image %d: read %#x at %#x (expected %#x)", other.Index, b[0], addr, want)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visited != 64 {
+		t.Errorf("visited %d images (expected 64)", visited)
+	}
+}
+
+func TestForEachImageError(t *testing.T) {
+	f := newTestFile(64, 4)
+
+	errBad := errors.New("bad image")
+	var visited int32
+	err := f.ForEachImage(func(image *CacheImage) error {
+		atomic.AddInt32(&visited, 1)
+		if image.Index == 3 {
+			return errBad
+		}
+		return nil
+	})
+	if !errors.Is(err, errBad) {
+		t.Fatalf("ForEachImage() error = %v (expected %v)", err, errBad)
+	}
+	if visited == 64 {
+		t.Errorf("ForEachImage() kept handing out images after an error")
+	}
+}
+
+func TestCacheImageReader(t *testing.T) {
+	f := newTestFile(1, 1)
+	var image io.ReadSeeker = f.Images[0]
+
+	if err := f.Images[0].SeekToAddr(0x8010); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := image.Seek(2, io.SeekCurrent); err != nil {
+		t.Fatal(err)
+	}
+	var b [2]byte
+	if _, err := image.Read(b[:]); err != nil {
+		t.Fatal(err)
+	}
+	if b != [2]byte{0x92, 0x93} {
+		t.Errorf("read %#x at 0x8012 (expected 0x9293)", b)
+	}
+	if off, err := f.Images[0].GetOffset(0x8012); err != nil || off != 0x12 {
+		t.Errorf("GetOffset(0x8012) = %#x, %v (expected 0x12)", off, err)
+	}
+}
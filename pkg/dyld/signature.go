@@ -0,0 +1,108 @@
+package dyld
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/blacktop/ipsw/pkg/signature"
+)
+
+// ScanSignatures scans the executable sections of the given images (or ALL images if none are given) for the
+// signatures and returns the matches in cache order. The images are scanned concurrently (see Config.Workers)
+// and the function containing each match is named with the File's symbol lookups (see OpenOrCreateSymbolIndex).
+func (f *File) ScanSignatures(sigs []*signature.Signature, images ...*CacheImage) ([]signature.Match, error) {
+	var mu sync.Mutex
+	found := make(map[*CacheImage][]signature.Match)
+
+	scan := func(image *CacheImage) error {
+		matches, err := f.scanImageSignatures(image, sigs)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %v", image.Name, err)
+		}
+		mu.Lock()
+		found[image] = matches
+		mu.Unlock()
+		return nil
+	}
+
+	if len(images) == 0 {
+		images = f.Images
+		if err := f.ForEachImage(scan); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, image := range images {
+			if err := scan(image); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var matches []signature.Match
+	for _, image := range images {
+		matches = append(matches, found[image]...)
+	}
+
+	return matches, nil
+}
+
+func (f *File) scanImageSignatures(image *CacheImage, sigs []*signature.Signature) ([]signature.Match, error) {
+	var imageSigs []*signature.Signature
+	for _, sig := range sigs {
+		if sig.AppliesTo(image.Name) {
+			imageSigs = append(imageSigs, sig)
+		}
+	}
+	if len(imageSigs) == 0 {
+		return nil, nil
+	}
+
+	m, err := image.GetPartialMacho()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	var matches []signature.Match
+	for _, sec := range m.Sections {
+		if attrs := sec.Flags.GetAttributes(); sec.Size == 0 || !attrs.IsPureInstructions() && !attrs.IsSomeInstructions() {
+			continue
+		}
+		uuid, off, err := f.GetOffset(sec.Addr)
+		if err != nil {
+			return nil, err
+		}
+		code, err := f.ReadBytesForUUID(uuid, int64(off), sec.Size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s: %v", sec.Seg, sec.Name, err)
+		}
+		section := fmt.Sprintf("%s.%s", sec.Seg, sec.Name)
+		signature.Scan(code, sec.Addr, imageSigs, func(sig *signature.Signature, addr uint64) {
+			matches = append(matches, signature.Match{
+				Rule:    sig.Name,
+				Symbol:  sig.Symbol,
+				Image:   image.Name,
+				Section: section,
+				Address: addr,
+			})
+		})
+	}
+
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	// the partial MachO does NOT have the LC_FUNCTION_STARTS needed to find the containing functions
+	full, err := image.GetMacho()
+	if err != nil {
+		return nil, err
+	}
+	for idx := range matches {
+		if fn, err := full.GetFunctionForVMAddr(matches[idx].Address); err == nil {
+			matches[idx].Function = fn.StartAddr
+			matches[idx].FunctionName = f.FindSymbol(fn.StartAddr, false)
+		}
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,435 @@
+package dyld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/blacktop/go-macho/types"
+)
+
+// SlidPointer is a fully decoded rebase location from the cache's slide info
+type SlidPointer struct {
+	Mapping         string `json:"mapping"`
+	CacheFileOffset uint64 `json:"cache_file_offset"`
+	CacheVMAddress  uint64 `json:"cache_vm_address"`
+	Raw             uint64 `json:"raw"`
+	Target          uint64 `json:"target"`
+	Authenticated   bool   `json:"authenticated"`
+	Key             string `json:"key,omitempty"` // IA, IB, DA or DB
+	AddrDiversity   bool   `json:"addr_div,omitempty"`
+	Diversity       uint16 `json:"diversity,omitempty"`
+	High8           uint8  `json:"high8,omitempty"`
+	Image           string `json:"image,omitempty"` // only set when filtering by image
+}
+
+func (p SlidPointer) String() string {
+	if p.Authenticated {
+		return fmt.Sprintf("%#x: %#016x => %#x\t(auth key: %s, diversity: %#04x, addr_div: %t)", p.CacheVMAddress, p.Raw, p.Target, p.Key, p.Diversity, p.AddrDiversity)
+	}
+	if p.High8 != 0 {
+		return fmt.Sprintf("%#x: %#016x => %#x\t(high8: %#02x)", p.CacheVMAddress, p.Raw, p.Target, p.High8)
+	}
+	return fmt.Sprintf("%#x: %#016x => %#x", p.CacheVMAddress, p.Raw, p.Target)
+}
+
+// SlideInfoFilter selects the slid pointers to iterate over
+type SlideInfoFilter struct {
+	Image    string // only pointers in the image's data segments
+	Mapping  string // only pointers in the mapping with this name (e.g. __AUTH_CONST)
+	AuthOnly bool   // only authenticated pointers
+	AuthData bool   // only mappings with auth flags
+}
+
+// MatchMapping returns true if the filter selects the mapping
+func (filter SlideInfoFilter) MatchMapping(mapping *CacheMappingWithSlideInfo) bool {
+	if len(filter.Mapping) > 0 && !strings.EqualFold(mapping.Name, filter.Mapping) {
+		return false
+	}
+	return !filter.AuthData || mapping.Flags.IsAuthData()
+}
+
+// SlideMapping is a mapping of the cache (or one of its sub-caches) that has slide info
+type SlideMapping struct {
+	UUID types.UUID
+	*CacheMappingWithSlideInfo
+}
+
+// SlideMappings returns the mappings that have slide info (sorted by address)
+func (f *File) SlideMappings() []SlideMapping {
+	var mappings []SlideMapping
+	for uuid := range f.Mappings {
+		if f.Headers[uuid].SlideInfoOffsetUnused > 0 {
+			mappings = append(mappings, SlideMapping{
+				UUID: uuid,
+				CacheMappingWithSlideInfo: &CacheMappingWithSlideInfo{CacheMappingAndSlideInfo: CacheMappingAndSlideInfo{
+					Address:         f.Mappings[uuid][1].Address,    // __DATA
+					Size:            f.Mappings[uuid][1].Size,       // __DATA
+					FileOffset:      f.Mappings[uuid][1].FileOffset, // __DATA
+					SlideInfoOffset: f.Headers[uuid].SlideInfoOffsetUnused,
+					SlideInfoSize:   f.Headers[uuid].SlideInfoSizeUnused,
+				}, Name: "__DATA"},
+			})
+			continue
+		}
+		for _, mapping := range f.MappingsWithSlideInfo[uuid] {
+			if mapping.SlideInfoSize > 0 {
+				mappings = append(mappings, SlideMapping{UUID: uuid, CacheMappingWithSlideInfo: mapping})
+			}
+		}
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].Address < mappings[j].Address
+	})
+	return mappings
+}
+
+type addrRange struct {
+	start uint64
+	end   uint64
+}
+
+// dataRanges returns the address ranges of an image's segments that can contain rebases
+func (f *File) dataRanges(image *CacheImage) ([]addrRange, error) {
+	m, err := image.GetPartialMacho()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", image.Name, err)
+	}
+	defer m.Close()
+
+	var ranges []addrRange
+	for _, seg := range m.Segments() {
+		if seg.Name == "__TEXT" || seg.Name == "__LINKEDIT" {
+			continue
+		}
+		ranges = append(ranges, addrRange{start: seg.Addr, end: seg.Addr + seg.Memsz})
+	}
+	return ranges, nil
+}
+
+// SlidPointers calls handler for every decoded pointer in the cache's slide info that matches the filter (a handler error stops the iteration)
+func (f *File) SlidPointers(filter SlideInfoFilter, handler func(*SlidPointer) error) error {
+	for _, sm := range f.SlideMappings() {
+		if err := f.MappingSlidPointers(sm, filter, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MappingSlidPointers calls handler for every decoded pointer in a mapping's slide info that matches the filter (a handler error stops the iteration)
+func (f *File) MappingSlidPointers(sm SlideMapping, filter SlideInfoFilter, handler func(*SlidPointer) error) error {
+	if !filter.MatchMapping(sm.CacheMappingWithSlideInfo) {
+		return nil
+	}
+
+	var ranges []addrRange
+	var imageName string
+	var startAddr, endAddr uint64
+	if len(filter.Image) > 0 {
+		image, err := f.Image(filter.Image)
+		if err != nil {
+			return err
+		}
+		imageName = image.Name
+		if ranges, err = f.dataRanges(image); err != nil {
+			return err
+		}
+		// only walk the pages that overlap the image's segments
+		for _, r := range ranges {
+			if r.end <= sm.Address || r.start >= sm.Address+sm.Size {
+				continue
+			}
+			if startAddr == 0 || r.start < startAddr {
+				startAddr = r.start
+			}
+			if r.end > endAddr {
+				endAddr = r.end
+			}
+		}
+		if startAddr == 0 {
+			return nil
+		}
+	}
+
+	return f.walkSlideInfo(sm.UUID, sm.CacheMappingWithSlideInfo, startAddr, endAddr, func(p *SlidPointer) error {
+		if filter.AuthOnly && !p.Authenticated {
+			return nil
+		}
+		if ranges != nil {
+			found := false
+			for _, r := range ranges {
+				if r.start <= p.CacheVMAddress && p.CacheVMAddress < r.end {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil
+			}
+			p.Image = imageName
+		}
+		return handler(p)
+	})
+}
+
+// readSlideInfo reads the header of a mapping's slide info
+func (f *File) readSlideInfo(uuid types.UUID, mapping *CacheMappingWithSlideInfo) (slideInfo, []byte, error) {
+	dat, err := f.ReadBytesForUUID(uuid, int64(mapping.SlideInfoOffset), mapping.SlideInfoSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s slide info: %v", mapping.Name, err)
+	}
+	if len(dat) < 4 {
+		return nil, nil, fmt.Errorf("%s slide info is too small", mapping.Name)
+	}
+
+	var info slideInfo
+	r := bytes.NewReader(dat)
+	switch version := binary.LittleEndian.Uint32(dat); version {
+	case 1:
+		var i CacheSlideInfo
+		err = binary.Read(r, f.ByteOrder, &i)
+		info = i
+	case 2:
+		var i CacheSlideInfo2
+		err = binary.Read(r, f.ByteOrder, &i)
+		info = i
+	case 3:
+		var i CacheSlideInfo3
+		err = binary.Read(r, f.ByteOrder, &i)
+		info = i
+	case 4:
+		var i CacheSlideInfo4
+		err = binary.Read(r, f.ByteOrder, &i)
+		info = i
+	default:
+		return nil, nil, fmt.Errorf("unsupported slide info version %d", version)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s slide info header: %v", mapping.Name, err)
+	}
+	if info.GetPageSize() == 0 {
+		return nil, nil, fmt.Errorf("invalid %s slide info page size", mapping.Name)
+	}
+
+	return info, dat, nil
+}
+
+// uint16s reads count uint16s at offset in the slide info (so a corrupt count can NOT cause a huge allocation)
+func (f *File) uint16s(dat []byte, offset, count uint32) ([]uint16, error) {
+	if uint64(offset)+2*uint64(count) > uint64(len(dat)) {
+		return nil, fmt.Errorf("slide info array out of bounds (%d at offset %#x)", count, offset)
+	}
+	vals := make([]uint16, count)
+	for i := range vals {
+		vals[i] = f.ByteOrder.Uint16(dat[offset+2*uint32(i):])
+	}
+	return vals, nil
+}
+
+// walkSlideInfo decodes the pointers of a mapping's slide info in the pages that overlap [startAddr, endAddr) (the whole mapping if endAddr is 0)
+func (f *File) walkSlideInfo(uuid types.UUID, mapping *CacheMappingWithSlideInfo, startAddr, endAddr uint64, handler func(*SlidPointer) error) error {
+	info, dat, err := f.readSlideInfo(uuid, mapping)
+	if err != nil {
+		return err
+	}
+
+	pageSize := uint64(info.GetPageSize())
+
+	// the page index range to walk
+	firstPage, lastPage := uint64(0), (mapping.Size+pageSize-1)/pageSize
+	if endAddr > 0 {
+		if startAddr > mapping.Address {
+			firstPage = (startAddr - mapping.Address) / pageSize
+		}
+		if end := (endAddr - mapping.Address + pageSize - 1) / pageSize; end < lastPage {
+			lastPage = end
+		}
+	}
+
+	readPage := func(page uint64) ([]byte, error) {
+		return f.ReadBytesForUUID(uuid, int64(mapping.FileOffset+page*pageSize), pageSize)
+	}
+
+	newPointer := func(page, offset uint64, raw uint64) *SlidPointer {
+		return &SlidPointer{
+			Mapping:         mapping.Name,
+			CacheFileOffset: mapping.FileOffset + page*pageSize + offset,
+			CacheVMAddress:  mapping.Address + page*pageSize + offset,
+			Raw:             raw,
+		}
+	}
+
+	switch info := info.(type) {
+	case CacheSlideInfo:
+		tocs, err := f.uint16s(dat, info.TocOffset, info.TocCount)
+		if err != nil {
+			return err
+		}
+		if lastPage > uint64(len(tocs)) {
+			lastPage = uint64(len(tocs))
+		}
+		for page := firstPage; page < lastPage; page++ {
+			entry := uint64(info.EntriesOffset) + uint64(tocs[page])*uint64(info.EntriesSize)
+			if entry+uint64(info.EntriesSize) > uint64(len(dat)) {
+				return fmt.Errorf("slide info v1 entry %d out of bounds", tocs[page])
+			}
+			bitmap := dat[entry : entry+uint64(info.EntriesSize)]
+			var content []byte
+			// every bit is a 4-byte word to rebase
+			for i, b := range bitmap {
+				for j := 0; j < 8; j++ {
+					if b&(1<<j) == 0 {
+						continue
+					}
+					offset := uint64(i*8+j) * 4
+					if offset+4 > pageSize {
+						return fmt.Errorf("slide info v1 entry %d out of page bounds", tocs[page])
+					}
+					if content == nil {
+						if content, err = readPage(page); err != nil {
+							return err
+						}
+					}
+					var raw uint64
+					if f.Is64bit() && offset+8 <= pageSize {
+						raw = f.ByteOrder.Uint64(content[offset:])
+					} else {
+						raw = uint64(f.ByteOrder.Uint32(content[offset:]))
+					}
+					p := newPointer(page, offset, raw)
+					p.Target = raw
+					if err := handler(p); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	case CacheSlideInfo2, CacheSlideInfo4:
+		var pageStartsOffset, pageStartsCount, pageExtrasOffset, pageExtrasCount uint32
+		var deltaMask, ptrSize uint64
+		var noRebase, useExtra, extraEnd, indexMask uint16
+		switch info := info.(type) {
+		case CacheSlideInfo2:
+			pageStartsOffset, pageStartsCount, pageExtrasOffset, pageExtrasCount = info.PageStartsOffset, info.PageStartsCount, info.PageExtrasOffset, info.PageExtrasCount
+			deltaMask, ptrSize = info.DeltaMask, 8
+			noRebase, useExtra, extraEnd, indexMask = DYLD_CACHE_SLIDE_PAGE_ATTR_NO_REBASE, DYLD_CACHE_SLIDE_PAGE_ATTR_EXTRA, DYLD_CACHE_SLIDE_PAGE_ATTR_END, 0x3FFF
+		case CacheSlideInfo4:
+			pageStartsOffset, pageStartsCount, pageExtrasOffset, pageExtrasCount = info.PageStartsOffset, info.PageStartsCount, info.PageExtrasOffset, info.PageExtrasCount
+			deltaMask, ptrSize = info.DeltaMask, 4
+			noRebase, useExtra, extraEnd, indexMask = DYLD_CACHE_SLIDE4_PAGE_NO_REBASE, DYLD_CACHE_SLIDE4_PAGE_USE_EXTRA, DYLD_CACHE_SLIDE4_PAGE_EXTRA_END, DYLD_CACHE_SLIDE4_PAGE_INDEX
+		}
+
+		starts, err := f.uint16s(dat, pageStartsOffset, pageStartsCount)
+		if err != nil {
+			return err
+		}
+		extras, err := f.uint16s(dat, pageExtrasOffset, pageExtrasCount)
+		if err != nil {
+			return err
+		}
+
+		if lastPage > uint64(len(starts)) {
+			lastPage = uint64(len(starts))
+		}
+
+		deltaShift := uint64(bits.TrailingZeros64(deltaMask) - 2)
+
+		for page := firstPage; page < lastPage; page++ {
+			start := starts[page]
+			if (ptrSize == 4 && start == noRebase) || (ptrSize == 8 && start&noRebase != 0 && start&useExtra == 0) {
+				continue
+			}
+			content, err := readPage(page)
+			if err != nil {
+				return err
+			}
+			walkChain := func(offset uint64) error {
+				for {
+					if offset+ptrSize > pageSize {
+						return fmt.Errorf("slide info chain offset %#x out of page bounds", offset)
+					}
+					var raw uint64
+					if ptrSize == 8 {
+						raw = f.ByteOrder.Uint64(content[offset:])
+					} else {
+						raw = uint64(f.ByteOrder.Uint32(content[offset:]))
+					}
+					p := newPointer(page, offset, raw)
+					p.Target = info.SlidePointer(raw)
+					if err := handler(p); err != nil {
+						return err
+					}
+					delta := (raw & deltaMask) >> deltaShift
+					if delta == 0 {
+						return nil
+					}
+					offset += delta
+				}
+			}
+			if start&useExtra != 0 {
+				for j := int(start & indexMask); j < len(extras); j++ {
+					if err := walkChain(uint64(extras[j]&indexMask) * 4); err != nil {
+						return err
+					}
+					if extras[j]&extraEnd != 0 {
+						break
+					}
+				}
+			} else if err := walkChain(uint64(start) * 4); err != nil {
+				return err
+			}
+		}
+	case CacheSlideInfo3:
+		starts, err := f.uint16s(dat, uint32(binary.Size(info)), info.PageStartsCount)
+		if err != nil {
+			return err
+		}
+
+		if lastPage > uint64(len(starts)) {
+			lastPage = uint64(len(starts))
+		}
+
+		for page := firstPage; page < lastPage; page++ {
+			delta := uint64(starts[page])
+			if delta == DYLD_CACHE_SLIDE_V3_PAGE_ATTR_NO_REBASE {
+				continue
+			}
+			content, err := readPage(page)
+			if err != nil {
+				return err
+			}
+			offset := uint64(0)
+			for {
+				offset += delta
+				if offset+8 > pageSize {
+					return fmt.Errorf("slide info chain offset %#x out of page bounds", offset)
+				}
+				pointer := CacheSlidePointer3(f.ByteOrder.Uint64(content[offset:]))
+				p := newPointer(page, offset, pointer.Raw())
+				if pointer.Authenticated() {
+					p.Authenticated = true
+					p.Target = info.AuthValueAdd + pointer.OffsetFromSharedCacheBase()
+					p.Key = KeyName(pointer.Raw())
+					p.AddrDiversity = pointer.HasAddressDiversity()
+					p.Diversity = uint16(pointer.DiversityData())
+				} else {
+					p.Target = pointer.SignExtend51()
+					p.High8 = uint8(types.ExtractBits(pointer.Raw(), 43, 8))
+				}
+				if err := handler(p); err != nil {
+					return err
+				}
+				if pointer.OffsetToNextPointer() == 0 {
+					break
+				}
+				delta = pointer.OffsetToNextPointer() * 8
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package dyld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+
+	mtypes "github.com/blacktop/go-macho/types"
+)
+
+func TestWalkSlideInfoV2(t *testing.T) {
+	uuid := mtypes.UUID{1}
+	dat := make([]byte, 0x3000)                               // two data pages followed by the slide info
+	binary.LittleEndian.PutUint64(dat[0x000:], 2<<40|0x10100) // next pointer is 8 bytes further
+	binary.LittleEndian.PutUint64(dat[0x008:], 0x10200)
+
+	var info bytes.Buffer
+	binary.Write(&info, binary.LittleEndian, CacheSlideInfo2{
+		Version:          2,
+		PageSize:         0x1000,
+		PageStartsOffset: 40,
+		PageStartsCount:  2,
+		PageExtrasOffset: 44,
+		DeltaMask:        0x00ffff0000000000,
+	})
+	binary.Write(&info, binary.LittleEndian, []uint16{
+		0x000,     // page 0 starts at offset 0
+		0xffc / 4, // page 1 starts 4 bytes before its end (too close for a pointer)
+	})
+	copy(dat[0x2000:], info.Bytes())
+
+	f := &File{
+		UUID:      uuid,
+		ByteOrder: binary.LittleEndian,
+		r:         map[mtypes.UUID]io.ReaderAt{uuid: bytes.NewReader(dat)},
+	}
+	mapping := &CacheMappingWithSlideInfo{CacheMappingAndSlideInfo: CacheMappingAndSlideInfo{
+		Address:         0x10000,
+		Size:            0x2000,
+		SlideInfoOffset: 0x2000,
+		SlideInfoSize:   uint64(info.Len()),
+	}, Name: "__DATA"}
+
+	var got []SlidPointer
+	if err := f.walkSlideInfo(uuid, mapping, 0x10000, 0x11000, func(p *SlidPointer) error {
+		got = append(got, *p)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []SlidPointer{
+		{Mapping: "__DATA", CacheFileOffset: 0x0, CacheVMAddress: 0x10000, Raw: 2<<40 | 0x10100, Target: 0x10100},
+		{Mapping: "__DATA", CacheFileOffset: 0x8, CacheVMAddress: 0x10008, Raw: 0x10200, Target: 0x10200},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("walkSlideInfo() = %+v (expected %+v)", got, want)
+	}
+
+	if err := f.walkSlideInfo(uuid, mapping, 0, 0, func(*SlidPointer) error { return nil }); err == nil {
+		t.Errorf("walkSlideInfo() with a chain running off the page succeeded")
+	}
+}
@@ -0,0 +1,219 @@
+package dyld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sync"
+	"unicode/utf16"
+
+	"github.com/blacktop/go-macho/types/objc"
+)
+
+const (
+	cfStringIsUnicode = 0x10     // CFString info flag of the strings stored as UTF-16 (instead of NUL terminated ASCII)
+	maxUTF16String    = 0x100000 // sanity limit for the length of UTF-16 CFStrings
+)
+
+// StringMatch is a string in one of an image's string sections
+type StringMatch struct {
+	Image   string `json:"image"`
+	Section string `json:"section"`
+	Address uint64 `json:"address"` // the address of the string (or of the CFString struct for __cfstring)
+	String  string `json:"string"`
+}
+
+// SearchStrings returns the C strings, CFStrings, ObjC selectors and os_log strings in the given images
+// (or ALL images if none are given) that match re. The images are searched concurrently (see Config.Workers)
+// and the matches are returned in cache order.
+func (f *File) SearchStrings(re *regexp.Regexp, images ...*CacheImage) ([]StringMatch, error) {
+	var mu sync.Mutex
+	found := make(map[*CacheImage][]StringMatch)
+
+	search := func(image *CacheImage) error {
+		matches, err := f.searchImageStrings(image, re)
+		if err != nil {
+			return fmt.Errorf("failed to search strings in %s: %v", image.Name, err)
+		}
+		mu.Lock()
+		found[image] = matches
+		mu.Unlock()
+		return nil
+	}
+
+	if len(images) == 0 {
+		images = f.Images
+		if err := f.ForEachImage(search); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, image := range images {
+			if err := search(image); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var matches []StringMatch
+	for _, image := range images {
+		matches = append(matches, found[image]...)
+	}
+
+	return matches, nil
+}
+
+func (f *File) searchImageStrings(image *CacheImage, re *regexp.Regexp) ([]StringMatch, error) {
+	m, err := image.GetPartialMacho()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	var matches []StringMatch
+	for _, sec := range m.Sections {
+		if sec.Size == 0 {
+			continue
+		}
+
+		section := fmt.Sprintf("%s.%s", sec.Seg, sec.Name)
+
+		switch {
+		case sec.Name == "__cfstring":
+			cfstrs := make([]objc.CFString64T, sec.Size/uint64(binary.Size(objc.CFString64T{})))
+			if err := f.readAtAddr(sec.Addr, cfstrs); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %v", section, err)
+			}
+			for idx, cfstr := range cfstrs {
+				if cfstr.Data == 0 {
+					continue
+				}
+				data := cfstr.Data & mask
+				if f.SlideInfo != nil {
+					data = f.SlideInfo.SlidePointer(cfstr.Data)
+				}
+				var str string
+				var err error
+				if cfstr.Info&cfStringIsUnicode != 0 {
+					str, err = f.getUTF16String(data, cfstr.Length)
+				} else {
+					str, err = f.GetCString(data)
+				}
+				if err != nil {
+					continue
+				}
+				if re.MatchString(str) {
+					matches = append(matches, StringMatch{
+						Image:   image.Name,
+						Section: section,
+						Address: sec.Addr + uint64(idx*binary.Size(objc.CFString64T{})),
+						String:  str,
+					})
+				}
+			}
+		case sec.Flags.IsCstringLiterals() || sec.Name == "__objc_methname" || sec.Name == "__oslogstring":
+			uuid, off, err := f.GetOffset(sec.Addr)
+			if err != nil {
+				return nil, err
+			}
+			dat, err := f.ReadBytesForUUID(uuid, int64(off), sec.Size)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %v", section, err)
+			}
+			for start := 0; start < len(dat); {
+				end := bytes.IndexByte(dat[start:], 0)
+				if end < 0 {
+					end = len(dat) - start
+				}
+				if end > 0 {
+					if str := string(dat[start : start+end]); re.MatchString(str) {
+						matches = append(matches, StringMatch{
+							Image:   image.Name,
+							Section: section,
+							Address: sec.Addr + uint64(start),
+							String:  str,
+						})
+					}
+				}
+				start += end + 1
+			}
+		}
+	}
+
+	return matches, nil
+}
+
+// SelRef is an __objc_selrefs entry
+type SelRef struct {
+	Addr     uint64 // the address of the selector reference
+	Selector uint64 // the address of the (uniqued) selector string it points to
+}
+
+// SelectorRefs returns the __objc_selrefs entries of an image by selector
+// (the loads of a selector reference are xrefs to the selector string it points to)
+func (f *File) SelectorRefs(image *CacheImage) (map[string][]SelRef, error) {
+	m, err := image.GetPartialMacho()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+
+	refs := make(map[string][]SelRef)
+	for _, sec := range m.Sections {
+		if sec.Name != "__objc_selrefs" {
+			continue
+		}
+		for addr := sec.Addr; addr+8 <= sec.Addr+sec.Size; addr += 8 {
+			ptr, err := f.ReadPointerAtAddress(addr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read selector reference at %#x: %v", addr, err)
+			}
+			if f.SlideInfo != nil {
+				ptr = f.SlideInfo.SlidePointer(ptr)
+			}
+			sel, err := f.GetCString(ptr)
+			if err != nil {
+				continue
+			}
+			refs[sel] = append(refs[sel], SelRef{Addr: addr, Selector: ptr})
+		}
+	}
+
+	return refs, nil
+}
+
+// getUTF16String reads the UTF-16 string of length code units at the given unslid address
+func (f *File) getUTF16String(addr, length uint64) (string, error) {
+	if length > maxUTF16String {
+		return "", fmt.Errorf("invalid UTF-16 string length %d at %#x", length, addr)
+	}
+	uuid, off, err := f.GetOffset(addr)
+	if err != nil {
+		return "", err
+	}
+	dat, err := f.ReadBytesForUUID(uuid, int64(off), length*2)
+	if err != nil {
+		return "", err
+	}
+	if uint64(len(dat)) < length*2 {
+		return "", fmt.Errorf("failed to read UTF-16 string at %#x", addr)
+	}
+	units := make([]uint16, length)
+	for idx := range units {
+		units[idx] = f.ByteOrder.Uint16(dat[idx*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// readAtAddr reads the structured data at the given unslid address
+func (f *File) readAtAddr(addr uint64, data interface{}) error {
+	uuid, off, err := f.GetOffset(addr)
+	if err != nil {
+		return err
+	}
+	dat, err := f.ReadBytesForUUID(uuid, int64(off), uint64(binary.Size(data)))
+	if err != nil {
+		return err
+	}
+	return binary.Read(bytes.NewReader(dat), f.ByteOrder, data)
+}
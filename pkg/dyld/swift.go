@@ -0,0 +1,56 @@
+package dyld
+
+import (
+	"fmt"
+
+	"github.com/blacktop/ipsw/pkg/swift"
+)
+
+// cacheReader reads an image's Swift metadata out of the dyld_shared_cache
+type cacheReader struct {
+	f *File
+}
+
+func (r *cacheReader) ReadAtAddr(buf []byte, addr uint64) (int, error) {
+	uuid, off, err := r.f.GetOffset(addr)
+	if err != nil {
+		return 0, err
+	}
+	dat, err := r.f.ReadBytesForUUID(uuid, int64(off), uint64(len(buf)))
+	if err != nil {
+		return 0, err
+	}
+	return copy(buf, dat), nil
+}
+
+func (r *cacheReader) ReadPointerAtAddr(addr uint64) (uint64, error) {
+	ptr, err := r.f.ReadPointerAtAddress(addr)
+	if err != nil {
+		return 0, err
+	}
+	if r.f.SlideInfo == nil {
+		return ptr, nil
+	}
+	return r.f.SlideInfo.SlidePointer(ptr), nil
+}
+
+// GetSwiftMetadata parses the Swift reflection metadata of a given image
+func (f *File) GetSwiftMetadata(imageName string) (*swift.Metadata, error) {
+	image, err := f.Image(imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := image.GetPartialMacho()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", image.Name, err)
+	}
+	defer m.Close()
+
+	secs := swift.Sections(m)
+	if len(secs) == 0 {
+		return nil, swift.ErrNoSwift
+	}
+
+	return swift.Parse(&cacheReader{f: f}, secs)
+}
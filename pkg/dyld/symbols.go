@@ -3,21 +3,17 @@ package dyld
 import (
 	"bufio"
 	"bytes"
-	"compress/gzip"
 	"encoding/binary"
-	"encoding/gob"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"text/tabwriter"
 
 	"github.com/apex/log"
 	"github.com/blacktop/go-macho/pkg/trie"
 	"github.com/blacktop/go-macho/types"
-	"github.com/blacktop/ipsw/internal/utils"
 	"github.com/pkg/errors"
 )
 
@@ -31,7 +27,22 @@ var ErrNoExportTrieInCache = errors.New("dyld shared cache does NOT contain expo
 var ErrNoExportTrieInMachO = errors.New("dylib does NOT contain export trie info")
 var ErrSymbolNotInImage = errors.New("dylib does NOT contain symbol")
 
-// ParseLocalSyms parses dyld's private symbols
+// setSymbol adds a symbol to the addr2symbol map (safe for concurrent use)
+func (f *File) setSymbol(addr uint64, name string) {
+	f.symLock.Lock()
+	f.AddressToSymbol[addr] = name
+	f.symLock.Unlock()
+}
+
+// symbolAt returns the symbol in the addr2symbol map at the given address (safe for concurrent use)
+func (f *File) symbolAt(addr uint64) (string, bool) {
+	f.symLock.RLock()
+	defer f.symLock.RUnlock()
+	name, ok := f.AddressToSymbol[addr]
+	return name, ok
+}
+
+// ParseLocalSyms parses dyld's private symbols (the images are parsed concurrently, see Config.Workers)
 func (f *File) ParseLocalSyms() error {
 
 	var uuid types.UUID
@@ -46,87 +57,66 @@ func (f *File) ParseLocalSyms() error {
 		return fmt.Errorf("failed to parse local syms: %w", ErrNoLocals)
 	}
 
-	sr := io.NewSectionReader(f.r[uuid], 0, 1<<63-1)
-
-	stringPool := io.NewSectionReader(f.r[uuid], int64(f.LocalSymInfo.StringsFileOffset), int64(f.LocalSymInfo.StringsSize))
-	sr.Seek(int64(f.LocalSymInfo.NListFileOffset), io.SeekStart)
-
-	for idx := 0; idx < int(f.LocalSymInfo.EntriesCount); idx++ {
-		for e := 0; e < int(f.Images[idx].NlistCount); e++ {
-			nlist := types.Nlist64{}
-			if err := binary.Read(sr, f.ByteOrder, &nlist); err != nil {
-				return err
-			}
-			stringPool.Seek(int64(nlist.Name), io.SeekStart)
-			s, err := bufio.NewReader(stringPool).ReadString('\x00')
-			if err != nil {
-				return fmt.Errorf("failed to read string at: %#x; %v", f.LocalSymInfo.StringsFileOffset+nlist.Name, err)
-			}
-			f.AddressToSymbol[nlist.Value] = strings.Trim(s, "\x00")
-			f.Images[idx].LocalSymbols = append(f.Images[idx].LocalSymbols, &CacheLocalSymbol64{
-				Name:    strings.Trim(s, "\x00"),
-				Nlist64: nlist,
-			})
+	return f.ForEachImage(func(image *CacheImage) error {
+		if image.Index >= f.LocalSymInfo.EntriesCount {
+			return nil
 		}
-	}
-
-	return nil
+		return f.GetLocalSymbolsForImage(image)
+	})
 }
 
+// GetLocalSymbolsForImage parses the private symbols of the given image
 func (f *File) GetLocalSymbolsForImage(image *CacheImage) error {
+	image.Analysis.mu.Lock()
+	defer image.Analysis.mu.Unlock()
 
-	if !image.Analysis.State.IsPrivatesDone() {
-
-		var uuid types.UUID
-
-		if f.IsDyld4 {
-			uuid = f.symUUID
-		} else {
-			uuid = f.UUID
-		}
-
-		if f.Headers[uuid].LocalSymbolsOffset == 0 {
-			image.Analysis.State.SetPrivates(true) // TODO: does this have any bad side-effects ?
-			return fmt.Errorf("failed to parse local syms for image %s: %w", image.Name, ErrNoLocals)
-		}
-
-		sr := io.NewSectionReader(f.r[uuid], 0, 1<<63-1)
+	if image.Analysis.State.IsPrivatesDone() {
+		return nil
+	}
 
-		stringPool := io.NewSectionReader(sr, int64(f.LocalSymInfo.StringsFileOffset), int64(f.LocalSymInfo.StringsSize))
-		sr.Seek(int64(f.LocalSymInfo.NListFileOffset), io.SeekStart)
+	var uuid types.UUID
 
-		for idx := uint32(0); idx < f.LocalSymInfo.EntriesCount; idx++ {
-			// skip over other images
-			if idx != image.Index {
-				sr.Seek(int64(int(f.Images[idx].NlistCount)*binary.Size(types.Nlist64{})), os.SEEK_CUR)
-				continue
-			}
+	if f.IsDyld4 {
+		uuid = f.symUUID
+	} else {
+		uuid = f.UUID
+	}
 
-			for e := 0; e < int(f.Images[idx].NlistCount); e++ {
+	if f.Headers[uuid].LocalSymbolsOffset == 0 {
+		image.Analysis.State.SetPrivates(true) // TODO: does this have any bad side-effects ?
+		return fmt.Errorf("failed to parse local syms for image %s: %w", image.Name, ErrNoLocals)
+	}
 
-				nlist := types.Nlist64{}
-				if err := binary.Read(sr, f.ByteOrder, &nlist); err != nil {
-					return err
-				}
+	if image.Index >= f.LocalSymInfo.EntriesCount {
+		return nil
+	}
 
-				stringPool.Seek(int64(nlist.Name), io.SeekStart)
-				s, err := bufio.NewReader(stringPool).ReadString('\x00')
-				if err != nil {
-					log.Error(errors.Wrapf(err, "failed to read string at: %d", f.LocalSymInfo.StringsFileOffset+nlist.Name).Error())
-				}
+	nlistSize := int64(binary.Size(types.Nlist64{}))
+	sr := io.NewSectionReader(f.r[uuid], int64(f.LocalSymInfo.NListFileOffset)+int64(image.NlistStartIndex)*nlistSize, int64(image.NlistCount)*nlistSize)
+	stringPool := io.NewSectionReader(f.r[uuid], int64(f.LocalSymInfo.StringsFileOffset), int64(f.LocalSymInfo.StringsSize))
 
-				f.AddressToSymbol[nlist.Value] = strings.Trim(s, "\x00")
-				f.Images[idx].LocalSymbols = append(f.Images[idx].LocalSymbols, &CacheLocalSymbol64{
-					Name:    strings.Trim(s, "\x00"),
-					Nlist64: nlist,
-				})
-			}
+	nlists := make([]types.Nlist64, image.NlistCount)
+	if err := binary.Read(sr, f.ByteOrder, nlists); err != nil {
+		return fmt.Errorf("failed to read local syms for image %s: %v", image.Name, err)
+	}
 
-			image.Analysis.State.SetPrivates(true)
-			return nil
+	image.LocalSymbols = make([]*CacheLocalSymbol64, 0, len(nlists))
+	for _, nlist := range nlists {
+		stringPool.Seek(int64(nlist.Name), io.SeekStart)
+		s, err := bufio.NewReader(stringPool).ReadString('\x00')
+		if err != nil {
+			log.Error(errors.Wrapf(err, "failed to read string at: %d", f.LocalSymInfo.StringsFileOffset+nlist.Name).Error())
 		}
+
+		f.setSymbol(nlist.Value, strings.Trim(s, "\x00"))
+		image.LocalSymbols = append(image.LocalSymbols, &CacheLocalSymbol64{
+			Name:    strings.Trim(s, "\x00"),
+			Nlist64: nlist,
+		})
 	}
 
+	image.Analysis.State.SetPrivates(true)
+
 	return nil
 }
 
@@ -322,8 +312,14 @@ func (f *File) getExportTrieSymbols(i *CacheImage) ([]trie.TrieEntry, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse MachO for image %s: %v", filepath.Base(i.Name), err)
 		}
-		if m.DyldExportsTrie() != nil {
-			syms, err := m.DyldExports()
+		if dxt := m.DyldExportsTrie(); dxt != nil {
+			// read the trie through the (stateless) image as re-exporting dylibs look up
+			// this image's exports from other goroutines (see ForEachImage)
+			exportTrie := make([]byte, dxt.Size)
+			if _, err := i.ReadAt(exportTrie, int64(dxt.Offset)); err != nil {
+				return nil, fmt.Errorf("failed to read export trie data for image %s: %v", filepath.Base(i.Name), err)
+			}
+			syms, err := trie.ParseTrie(exportTrie, i.LoadAddress)
 			if err != nil {
 				return nil, fmt.Errorf("failed to get export trie symbols for image %s: %v", filepath.Base(i.Name), err)
 			}
@@ -336,12 +332,12 @@ func (f *File) getExportTrieSymbols(i *CacheImage) ([]trie.TrieEntry, error) {
 		}
 	}
 
-	eTrieOffset, err := i.GetOffset(eTrieAddr)
+	eTrieUUID, eTrieOffset, err := i.cache.GetOffset(eTrieAddr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get offset of export trie addr")
 	}
 
-	sr := io.NewSectionReader(i.cache.r[i.cuuid], 0, 1<<63-1)
+	sr := io.NewSectionReader(i.cache.r[eTrieUUID], 0, 1<<63-1)
 
 	if _, err := sr.Seek(int64(eTrieOffset), io.SeekStart); err != nil {
 		return nil, fmt.Errorf("failed to seek to export trie offset in cache: %v", err)
@@ -360,8 +356,13 @@ func (f *File) getExportTrieSymbols(i *CacheImage) ([]trie.TrieEntry, error) {
 	return syms, nil
 }
 
-// GetAllExportedSymbols prints out all the exported symbols
+// GetAllExportedSymbols prints out all the exported symbols (when not dumping, the images are parsed concurrently)
 func (f *File) GetAllExportedSymbols(dump bool) error {
+	if !dump {
+		return f.ForEachImage(func(image *CacheImage) error {
+			return f.GetAllExportedSymbolsForImage(image, false)
+		})
+	}
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
 	for _, image := range f.Images {
 		if !image.Analysis.State.IsExportsDone() {
@@ -378,7 +379,7 @@ func (f *File) GetAllExportedSymbols(dump bool) error {
 						if dump {
 							fmt.Fprintf(w, "%s\n", sym.String(m))
 						} else {
-							f.AddressToSymbol[sym.Value] = sym.Name
+							f.setSymbol(sym.Value, sym.Name)
 						}
 					}
 					w.Flush()
@@ -388,7 +389,7 @@ func (f *File) GetAllExportedSymbols(dump bool) error {
 							if dump {
 								fmt.Fprintf(w, "%#09x:\t(%s.%s|from %s)\t%s\n", bind.Start+bind.Offset, bind.Segment, bind.Section, bind.Dylib, bind.Name)
 							} else {
-								f.AddressToSymbol[bind.Start+bind.Offset] = bind.Name
+								f.setSymbol(bind.Start+bind.Offset, bind.Name)
 							}
 						}
 						w.Flush()
@@ -414,7 +415,7 @@ func (f *File) GetAllExportedSymbols(dump bool) error {
 						fmt.Fprintf(w, "%s\n", sym)
 						// fmt.Println(sym)
 					} else {
-						f.AddressToSymbol[sym.Address] = sym.Name
+						f.setSymbol(sym.Address, sym.Name)
 						image.Analysis.State.SetExports(true)
 					}
 				}
@@ -428,6 +429,9 @@ func (f *File) GetAllExportedSymbols(dump bool) error {
 
 // GetAllExportedSymbolsForImage prints out all the exported symbols for a given image
 func (f *File) GetAllExportedSymbolsForImage(image *CacheImage, dump bool) error {
+	image.Analysis.mu.Lock()
+	defer image.Analysis.mu.Unlock()
+
 	if !image.Analysis.State.IsExportsDone() {
 		syms, err := f.getExportTrieSymbols(image)
 		if err != nil {
@@ -446,7 +450,7 @@ func (f *File) GetAllExportedSymbolsForImage(image *CacheImage, dump bool) error
 						}
 						fmt.Fprintf(w, "%#09x:\t(%s)\t%s\n", sym.Value, sym.Type.String(sec), sym.Name)
 					} else {
-						f.AddressToSymbol[sym.Value] = sym.Name
+						f.setSymbol(sym.Value, sym.Name)
 					}
 				}
 				w.Flush()
@@ -456,7 +460,7 @@ func (f *File) GetAllExportedSymbolsForImage(image *CacheImage, dump bool) error
 						if dump {
 							fmt.Fprintf(w, "%#09x:\t(%s.%s|from %s)\t%s\n", bind.Start+bind.Offset, bind.Segment, bind.Section, bind.Dylib, bind.Name)
 						} else {
-							f.AddressToSymbol[bind.Start+bind.Offset] = bind.Name
+							f.setSymbol(bind.Start+bind.Offset, bind.Name)
 						}
 					}
 					w.Flush()
@@ -478,7 +482,7 @@ func (f *File) GetAllExportedSymbolsForImage(image *CacheImage, dump bool) error
 				if dump {
 					fmt.Println(sym)
 				} else {
-					f.AddressToSymbol[sym.Address] = sym.Name
+					f.setSymbol(sym.Address, sym.Name)
 				}
 			}
 		}
@@ -489,100 +493,6 @@ func (f *File) GetAllExportedSymbolsForImage(image *CacheImage, dump bool) error
 	return nil
 }
 
-// OpenOrCreateA2SCache returns an address to symbol map if the cache file exists
-// otherwise it will create a NEW one
-func (f *File) OpenOrCreateA2SCache(cacheFile string) error {
-	if _, err := os.Stat(cacheFile); os.IsNotExist(err) {
-		log.Info("parsing public symbols...")
-		err = f.GetAllExportedSymbols(false)
-		if err != nil {
-			// return err
-			log.Errorf("failed to parse all exported symbols: %v", err)
-		}
-
-		log.Info("parsing private symbols...")
-		err = f.ParseLocalSyms()
-		if errors.Is(err, ErrNoLocals) {
-			utils.Indent(log.Warn, 2)("cache does NOT contain local symbols")
-		} else if err != nil {
-			return err
-		}
-
-		err = f.SaveAddrToSymMap(cacheFile)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	}
-
-	a2sFile, err := os.Open(cacheFile)
-	if err != nil {
-		return err
-	}
-	gzr, err := gzip.NewReader(a2sFile)
-	if err != nil {
-		return fmt.Errorf("failed to create gzip reader: %v", err)
-	}
-	// Decoding the serialized data
-	err = gob.NewDecoder(gzr).Decode(&f.AddressToSymbol)
-	if err != nil {
-		return err
-	}
-	gzr.Close()
-	a2sFile.Close()
-
-	return nil
-}
-
-// SaveAddrToSymMap saves the dyld address-to-symbol map to disk
-func (f *File) SaveAddrToSymMap(dest string) error {
-	var err error
-	var of *os.File
-
-	buff := new(bytes.Buffer)
-
-	of, err = os.Create(dest)
-	if errors.Is(err, os.ErrPermission) {
-		var e *os.PathError
-		if errors.As(err, &e) {
-			log.Errorf("failed to create address to symbol cache file %s (%v)", e.Path, e.Err)
-		}
-		tmpDir := os.TempDir()
-		if runtime.GOOS == "darwin" {
-			tmpDir = "/tmp"
-		}
-		tempa2sfile := filepath.Join(tmpDir, f.UUID.String()+".a2s")
-		of, err = os.Create(tempa2sfile)
-		if err != nil {
-			return err
-		}
-		utils.Indent(log.Warn, 2)("creating in the temp folder")
-		utils.Indent(log.Warn, 3)(fmt.Sprintf("to use in the future you must supply the flag: --cache %s ", tempa2sfile))
-	} else if err != nil {
-		return err
-	}
-	defer of.Close()
-
-	e := gob.NewEncoder(buff)
-
-	// Encoding the map
-	err = e.Encode(f.AddressToSymbol)
-	if err != nil {
-		return fmt.Errorf("failed to encode addr2sym map to binary: %v", err)
-	}
-
-	gzw := gzip.NewWriter(of)
-	defer gzw.Close()
-
-	_, err = buff.WriteTo(gzw)
-	if err != nil {
-		return fmt.Errorf("failed to write addr2sym map to gzip file: %v", err)
-	}
-
-	return nil
-}
-
 func (f *File) FindExportedSymbol(symbolName string) (*trie.TrieEntry, error) {
 
 	for _, image := range f.Images {
@@ -0,0 +1,798 @@
+package dyld
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/apex/log"
+	mtypes "github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/demangle"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/pkg/errors"
+)
+
+// ErrSymbolNotIndexed is the error for a symbol query that has no matches in the symbol index
+var ErrSymbolNotIndexed = errors.New("symbol not found in symbol index")
+
+const (
+	symIndexMagic     = "DSCSYMIX"
+	symIndexVersion   = 1
+	symIndexEntrySize = 32
+	symIndexExt       = ".symidx"
+	noImage           = ^uint32(0)
+)
+
+// SymbolType is the kind of a symbol in the symbol index
+type SymbolType uint8
+
+const (
+	SymbolExport SymbolType = iota + 1 // exported symbol (export trie)
+	SymbolLocal                        // private symbol (.symbols local nlists)
+	SymbolObjC                         // ObjC selector/class/protocol name
+	SymbolStub                         // symbol stub
+)
+
+func (t SymbolType) String() string {
+	switch t {
+	case SymbolExport:
+		return "export"
+	case SymbolLocal:
+		return "local"
+	case SymbolObjC:
+		return "objc"
+	case SymbolStub:
+		return "stub"
+	default:
+		return fmt.Sprintf("SymbolType(%d)", t)
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (t SymbolType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// IndexedSymbol is a symbol in the symbol index
+type IndexedSymbol struct {
+	Name      string     `json:"name"`
+	Demangled string     `json:"demangled,omitempty"`
+	Image     string     `json:"image,omitempty"`
+	Address   uint64     `json:"address"`
+	Size      uint64     `json:"size,omitempty"`
+	Type      SymbolType `json:"type"`
+}
+
+func (s IndexedSymbol) String() string {
+	name := s.Name
+	if len(s.Demangled) > 0 {
+		name = s.Demangled
+	}
+	return fmt.Sprintf("%#09x:\t(%s|size=%#x)\t%s\t%s", s.Address, s.Type, s.Size, name, filepath.Base(s.Image))
+}
+
+type symIndexHeader struct {
+	Magic     [8]byte
+	Version   uint32
+	NumSyms   uint32
+	UUID      mtypes.UUID
+	NumImages uint32
+	_         uint32
+	ImagesOff uint64 // image name string offsets
+	SymsOff   uint64 // entries sorted by address
+	NamesOff  uint64 // entry indexes sorted by name
+	StrsOff   uint64
+	StrsSize  uint64
+}
+
+type symIndexEntry struct {
+	Address   uint64
+	Size      uint64
+	Name      uint32
+	Demangled uint32
+	Image     uint32
+	Type      SymbolType
+}
+
+func (e *symIndexEntry) put(b []byte) {
+	binary.LittleEndian.PutUint64(b[0:], e.Address)
+	binary.LittleEndian.PutUint64(b[8:], e.Size)
+	binary.LittleEndian.PutUint32(b[16:], e.Name)
+	binary.LittleEndian.PutUint32(b[20:], e.Demangled)
+	binary.LittleEndian.PutUint32(b[24:], e.Image)
+	b[28] = byte(e.Type)
+}
+
+func (e *symIndexEntry) get(b []byte) {
+	e.Address = binary.LittleEndian.Uint64(b[0:])
+	e.Size = binary.LittleEndian.Uint64(b[8:])
+	e.Name = binary.LittleEndian.Uint32(b[16:])
+	e.Demangled = binary.LittleEndian.Uint32(b[20:])
+	e.Image = binary.LittleEndian.Uint32(b[24:])
+	e.Type = SymbolType(b[28])
+}
+
+// SymbolIndex is an on-disk index of all the symbols in a dyld_shared_cache.
+//
+// Entries are stored sorted by address with a second table sorted by name so
+// that address, range, name and prefix queries are binary searches on the file.
+type SymbolIndex struct {
+	UUID mtypes.UUID
+	Path string
+
+	hdr    symIndexHeader
+	images []string
+	r      io.ReaderAt
+	closer io.Closer
+}
+
+// OpenSymbolIndex opens the symbol index file at path
+func OpenSymbolIndex(path string) (*SymbolIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := NewSymbolIndex(f)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "failed to open symbol index %s", path)
+	}
+	idx.Path = path
+	idx.closer = f
+	return idx, nil
+}
+
+// NewSymbolIndex creates a new SymbolIndex for accessing a symbol index in an underlying reader
+func NewSymbolIndex(r io.ReaderAt) (*SymbolIndex, error) {
+	idx := &SymbolIndex{r: r}
+
+	if err := binary.Read(io.NewSectionReader(r, 0, 1<<63-1), binary.LittleEndian, &idx.hdr); err != nil {
+		return nil, fmt.Errorf("failed to read symbol index header: %v", err)
+	}
+	if string(idx.hdr.Magic[:]) != symIndexMagic {
+		return nil, fmt.Errorf("invalid symbol index magic: %q", idx.hdr.Magic[:])
+	}
+	if idx.hdr.Version != symIndexVersion {
+		return nil, fmt.Errorf("unsupported symbol index version %d (expected %d)", idx.hdr.Version, symIndexVersion)
+	}
+	idx.UUID = idx.hdr.UUID
+
+	offs := make([]uint32, idx.hdr.NumImages)
+	if err := binary.Read(io.NewSectionReader(r, int64(idx.hdr.ImagesOff), int64(4*len(offs))), binary.LittleEndian, offs); err != nil {
+		return nil, fmt.Errorf("failed to read symbol index images: %v", err)
+	}
+	for _, off := range offs {
+		name, err := idx.str(off)
+		if err != nil {
+			return nil, err
+		}
+		idx.images = append(idx.images, name)
+	}
+
+	return idx, nil
+}
+
+// Close closes the SymbolIndex
+func (i *SymbolIndex) Close() error {
+	var err error
+	if i.closer != nil {
+		err = i.closer.Close()
+		i.closer = nil
+	}
+	return err
+}
+
+// Len returns the number of symbols in the index
+func (i *SymbolIndex) Len() int {
+	return int(i.hdr.NumSyms)
+}
+
+func (i *SymbolIndex) entry(n int) (symIndexEntry, error) {
+	var e symIndexEntry
+	var b [symIndexEntrySize]byte
+	if _, err := i.r.ReadAt(b[:], int64(i.hdr.SymsOff)+int64(n)*symIndexEntrySize); err != nil {
+		return e, fmt.Errorf("failed to read symbol index entry %d: %v", n, err)
+	}
+	e.get(b[:])
+	return e, nil
+}
+
+func (i *SymbolIndex) byName(n int) (symIndexEntry, error) {
+	var b [4]byte
+	if _, err := i.r.ReadAt(b[:], int64(i.hdr.NamesOff)+int64(n)*4); err != nil {
+		return symIndexEntry{}, fmt.Errorf("failed to read symbol index name entry %d: %v", n, err)
+	}
+	return i.entry(int(binary.LittleEndian.Uint32(b[:])))
+}
+
+func (i *SymbolIndex) str(off uint32) (string, error) {
+	if uint64(off) >= i.hdr.StrsSize {
+		return "", fmt.Errorf("symbol index string offset %#x out of bounds", off)
+	}
+	var sb strings.Builder
+	buf := make([]byte, 128)
+	for pos := int64(i.hdr.StrsOff) + int64(off); ; pos += int64(len(buf)) {
+		n, err := i.r.ReadAt(buf, pos)
+		if end := bytes.IndexByte(buf[:n], 0); end >= 0 {
+			sb.Write(buf[:end])
+			return sb.String(), nil
+		}
+		sb.Write(buf[:n])
+		if err != nil {
+			return "", fmt.Errorf("failed to read symbol index string at %#x: %v", off, err)
+		}
+	}
+}
+
+func (i *SymbolIndex) symbol(e symIndexEntry) (*IndexedSymbol, error) {
+	var err error
+	sym := &IndexedSymbol{Address: e.Address, Size: e.Size, Type: e.Type}
+	if sym.Name, err = i.str(e.Name); err != nil {
+		return nil, err
+	}
+	if e.Demangled != 0 {
+		if sym.Demangled, err = i.str(e.Demangled); err != nil {
+			return nil, err
+		}
+	}
+	if e.Image != noImage && int(e.Image) < len(i.images) {
+		sym.Image = i.images[e.Image]
+	}
+	return sym, nil
+}
+
+// searchIndex returns the first entry in [0, count) for which less is false
+func searchIndex(count int, less func(int) (bool, error)) (int, error) {
+	var err error
+	n := sort.Search(count, func(n int) bool {
+		if err != nil {
+			return true
+		}
+		l, e := less(n)
+		if e != nil {
+			err = e
+			return true
+		}
+		return !l
+	})
+	return n, err
+}
+
+func (i *SymbolIndex) lowerBoundAddr(addr uint64) (int, error) {
+	return searchIndex(i.Len(), func(n int) (bool, error) {
+		e, err := i.entry(n)
+		return e.Address < addr, err
+	})
+}
+
+// Lookup returns the symbol at the given virtual address
+func (i *SymbolIndex) Lookup(addr uint64) (*IndexedSymbol, error) {
+	n, err := i.lowerBoundAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if n < i.Len() {
+		e, err := i.entry(n)
+		if err != nil {
+			return nil, err
+		}
+		if e.Address == addr {
+			return i.symbol(e)
+		}
+	}
+	return nil, fmt.Errorf("no symbol at %#x: %w", addr, ErrSymbolNotIndexed)
+}
+
+// Containing returns the symbol whose [address, address+size) range contains the given virtual address
+func (i *SymbolIndex) Containing(addr uint64) (*IndexedSymbol, error) {
+	n, err := searchIndex(i.Len(), func(n int) (bool, error) {
+		e, err := i.entry(n)
+		return e.Address <= addr, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// check the symbols at the closest address below addr
+	for n--; n >= 0; n-- {
+		e, err := i.entry(n)
+		if err != nil {
+			return nil, err
+		}
+		if e.Address == addr || addr < e.Address+e.Size {
+			return i.symbol(e)
+		}
+		if n == 0 {
+			break
+		}
+		if prev, err := i.entry(n - 1); err != nil || prev.Address != e.Address {
+			break
+		}
+	}
+	return nil, fmt.Errorf("no symbol contains %#x: %w", addr, ErrSymbolNotIndexed)
+}
+
+// Range returns all the symbols with an address in [start, end)
+func (i *SymbolIndex) Range(start, end uint64) ([]*IndexedSymbol, error) {
+	var syms []*IndexedSymbol
+
+	n, err := i.lowerBoundAddr(start)
+	if err != nil {
+		return nil, err
+	}
+	for ; n < i.Len(); n++ {
+		e, err := i.entry(n)
+		if err != nil {
+			return nil, err
+		}
+		if e.Address >= end {
+			break
+		}
+		sym, err := i.symbol(e)
+		if err != nil {
+			return nil, err
+		}
+		syms = append(syms, sym)
+	}
+
+	return syms, nil
+}
+
+func (i *SymbolIndex) lowerBoundName(name string) (int, error) {
+	return searchIndex(i.Len(), func(n int) (bool, error) {
+		e, err := i.byName(n)
+		if err != nil {
+			return false, err
+		}
+		s, err := i.str(e.Name)
+		return s < name, err
+	})
+}
+
+func (i *SymbolIndex) matchNames(name string, match func(string) bool) ([]*IndexedSymbol, error) {
+	var syms []*IndexedSymbol
+
+	n, err := i.lowerBoundName(name)
+	if err != nil {
+		return nil, err
+	}
+	for ; n < i.Len(); n++ {
+		e, err := i.byName(n)
+		if err != nil {
+			return nil, err
+		}
+		s, err := i.str(e.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !match(s) {
+			break
+		}
+		sym, err := i.symbol(e)
+		if err != nil {
+			return nil, err
+		}
+		syms = append(syms, sym)
+	}
+
+	return syms, nil
+}
+
+// Find returns all the symbols with the given name
+func (i *SymbolIndex) Find(name string) ([]*IndexedSymbol, error) {
+	return i.matchNames(name, func(s string) bool { return s == name })
+}
+
+// Prefix returns all the symbols whose name starts with prefix
+func (i *SymbolIndex) Prefix(prefix string) ([]*IndexedSymbol, error) {
+	return i.matchNames(prefix, func(s string) bool { return strings.HasPrefix(s, prefix) })
+}
+
+// Regex returns all the symbols whose name or demangled name matches re
+func (i *SymbolIndex) Regex(re *regexp.Regexp) ([]*IndexedSymbol, error) {
+	var syms []*IndexedSymbol
+
+	// a full scan is cheaper with the string table in memory
+	strs := make([]byte, i.hdr.StrsSize)
+	if _, err := i.r.ReadAt(strs, int64(i.hdr.StrsOff)); err != nil {
+		return nil, fmt.Errorf("failed to read symbol index strings: %v", err)
+	}
+	str := func(off uint32) string {
+		if end := bytes.IndexByte(strs[off:], 0); end >= 0 {
+			return string(strs[off : int(off)+end])
+		}
+		return string(strs[off:])
+	}
+
+	br := bufio.NewReaderSize(io.NewSectionReader(i.r, int64(i.hdr.SymsOff), int64(i.Len())*symIndexEntrySize), 1<<20)
+	var b [symIndexEntrySize]byte
+	for n := 0; n < i.Len(); n++ {
+		if _, err := io.ReadFull(br, b[:]); err != nil {
+			return nil, fmt.Errorf("failed to read symbol index entry %d: %v", n, err)
+		}
+		var e symIndexEntry
+		e.get(b[:])
+		if uint64(e.Name) >= i.hdr.StrsSize || uint64(e.Demangled) >= i.hdr.StrsSize {
+			return nil, fmt.Errorf("symbol index entry %d string offset out of bounds", n)
+		}
+		if re.MatchString(str(e.Name)) || (e.Demangled != 0 && re.MatchString(str(e.Demangled))) {
+			sym := &IndexedSymbol{
+				Name:    str(e.Name),
+				Address: e.Address,
+				Size:    e.Size,
+				Type:    e.Type,
+			}
+			if e.Demangled != 0 {
+				sym.Demangled = str(e.Demangled)
+			}
+			if e.Image != noImage && int(e.Image) < len(i.images) {
+				sym.Image = i.images[e.Image]
+			}
+			syms = append(syms, sym)
+		}
+	}
+
+	return syms, nil
+}
+
+/*
+ * Building the index
+ */
+
+type symIndexBuilder struct {
+	f       *File
+	entries []symIndexEntry
+	names   []string
+	byAddr  map[uint64]string
+	texts   imageTexts
+}
+
+func (b *symIndexBuilder) add(addr uint64, name string, image uint32, typ SymbolType) {
+	if addr == 0 || len(name) == 0 {
+		return
+	}
+	b.entries = append(b.entries, symIndexEntry{Address: addr, Image: image, Type: typ, Name: uint32(len(b.names))})
+	b.names = append(b.names, name)
+	if typ != SymbolObjC && typ != SymbolStub {
+		if _, ok := b.byAddr[addr]; !ok {
+			b.byAddr[addr] = name
+		}
+	}
+}
+
+// imageTexts are the cache's images sorted by __TEXT address
+type imageTexts []*CacheImage
+
+func newImageTexts(images []*CacheImage) imageTexts {
+	texts := append(imageTexts(nil), images...)
+	sort.Slice(texts, func(i, j int) bool {
+		return texts[i].CacheImageTextInfo.LoadAddress < texts[j].CacheImageTextInfo.LoadAddress
+	})
+	return texts
+}
+
+// lookup returns the index of the image whose __TEXT contains addr (or noImage)
+func (t imageTexts) lookup(addr uint64) uint32 {
+	n := sort.Search(len(t), func(n int) bool {
+		return t[n].CacheImageTextInfo.LoadAddress > addr
+	}) - 1
+	if n >= 0 && addr < t[n].CacheImageTextInfo.LoadAddress+uint64(t[n].TextSegmentSize) {
+		return t[n].Index
+	}
+	return noImage
+}
+
+func (b *symIndexBuilder) addExports() {
+	for idx, image := range b.f.Images {
+		syms, err := b.f.getExportTrieSymbols(image)
+		if err != nil {
+			if !errors.Is(err, ErrNoExportTrieInMachO) {
+				utils.Indent(log.Debug, 2)(err.Error())
+				continue
+			}
+			m, err := image.GetMacho()
+			if err != nil {
+				utils.Indent(log.Debug, 2)(err.Error())
+				continue
+			}
+			for _, sym := range m.Symtab.Syms {
+				b.add(sym.Value, sym.Name, uint32(idx), SymbolExport)
+			}
+			continue
+		}
+		for _, sym := range syms {
+			if sym.Flags.ReExport() {
+				continue
+			}
+			b.add(sym.Address, sym.Name, uint32(idx), SymbolExport)
+		}
+	}
+}
+
+func (b *symIndexBuilder) addLocals() error {
+	if err := b.f.ParseLocalSyms(); err != nil {
+		return err
+	}
+	for idx, image := range b.f.Images {
+		for _, sym := range image.LocalSymbols {
+			b.add(sym.Nlist64.Value, sym.Name, uint32(idx), SymbolLocal)
+		}
+	}
+	return nil
+}
+
+func (b *symIndexBuilder) addObjC() {
+	for _, get := range []func(bool) (map[string]uint64, error){b.f.GetAllSelectors, b.f.GetAllClasses, b.f.GetAllProtocols} {
+		objcMap, err := get(false)
+		if err != nil {
+			utils.Indent(log.Debug, 2)(err.Error())
+			continue
+		}
+		for name, addr := range objcMap {
+			b.add(addr, name, b.texts.lookup(addr), SymbolObjC)
+		}
+	}
+}
+
+func (b *symIndexBuilder) addStubs() {
+	for idx, image := range b.f.Images {
+		if err := b.f.ParseSymbolStubs(image); err != nil {
+			utils.Indent(log.Debug, 2)(fmt.Sprintf("failed to parse symbol stubs for %s: %v", image.Name, err))
+			continue
+		}
+		for stub, target := range image.Analysis.SymbolStubs {
+			if name, ok := b.byAddr[target]; ok {
+				b.add(stub, "j_"+name, uint32(idx), SymbolStub)
+			}
+		}
+	}
+}
+
+// finish sorts and de-duplicates the entries and calculates their sizes
+func (b *symIndexBuilder) finish() {
+	sort.SliceStable(b.entries, func(i, j int) bool {
+		if b.entries[i].Address != b.entries[j].Address {
+			return b.entries[i].Address < b.entries[j].Address
+		}
+		return b.entries[i].Type < b.entries[j].Type
+	})
+
+	uniq := b.entries[:0]
+	for i, e := range b.entries {
+		if i > 0 && e.Address == uniq[len(uniq)-1].Address && b.names[e.Name] == b.names[uniq[len(uniq)-1].Name] {
+			continue
+		}
+		uniq = append(uniq, e)
+	}
+	b.entries = uniq
+
+	// a symbol extends to the next symbol in the same image
+	for i := range b.entries {
+		if b.entries[i].Type == SymbolObjC {
+			b.entries[i].Size = uint64(len(b.names[b.entries[i].Name]) + 1)
+			continue
+		}
+		for j := i + 1; j < len(b.entries); j++ {
+			if b.entries[j].Address == b.entries[i].Address || b.entries[j].Type == SymbolObjC {
+				continue
+			}
+			if b.entries[j].Image == b.entries[i].Image {
+				b.entries[i].Size = b.entries[j].Address - b.entries[i].Address
+			}
+			break
+		}
+	}
+}
+
+// write serializes the index
+func (b *symIndexBuilder) write(w io.Writer) error {
+	var strs bytes.Buffer
+	strOffs := make(map[string]uint32)
+	strs.WriteByte(0) // offset 0 is the empty string
+	addStr := func(s string) uint32 {
+		if off, ok := strOffs[s]; ok {
+			return off
+		}
+		off := uint32(strs.Len())
+		strs.WriteString(s)
+		strs.WriteByte(0)
+		strOffs[s] = off
+		return off
+	}
+
+	images := make([]uint32, len(b.f.Images))
+	for idx, image := range b.f.Images {
+		images[idx] = addStr(image.Name)
+	}
+
+	byName := make([]uint32, len(b.entries))
+	for idx := range b.entries {
+		byName[idx] = uint32(idx)
+	}
+	sort.SliceStable(byName, func(i, j int) bool {
+		return b.names[b.entries[byName[i]].Name] < b.names[b.entries[byName[j]].Name]
+	})
+
+	syms := make([]byte, len(b.entries)*symIndexEntrySize)
+	for idx, e := range b.entries {
+		name := b.names[e.Name]
+		e.Name = addStr(name)
+		if dem := demangle.Do(name, false, false); dem != name {
+			e.Demangled = addStr(dem)
+		}
+		e.put(syms[idx*symIndexEntrySize:])
+	}
+
+	hdr := symIndexHeader{
+		Version:   symIndexVersion,
+		NumSyms:   uint32(len(b.entries)),
+		UUID:      b.f.UUID,
+		NumImages: uint32(len(images)),
+	}
+	copy(hdr.Magic[:], symIndexMagic)
+	hdr.ImagesOff = uint64(binary.Size(hdr))
+	hdr.SymsOff = hdr.ImagesOff + uint64(4*len(images))
+	hdr.NamesOff = hdr.SymsOff + uint64(len(syms))
+	hdr.StrsOff = hdr.NamesOff + uint64(4*len(byName))
+	hdr.StrsSize = uint64(strs.Len())
+
+	bw := bufio.NewWriter(w)
+	for _, v := range []interface{}{hdr, images, syms, byName} {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	if _, err := strs.WriteTo(bw); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// SymbolIndexPath returns the default location of the symbol index for the cache
+func (f *File) SymbolIndexPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ipsw", "dyld", f.UUID.String()+symIndexExt), nil
+}
+
+// CreateSymbolIndex parses all the exported, private, ObjC and stub symbols in the cache and saves them as a symbol index at dest
+func (f *File) CreateSymbolIndex(dest string) (*SymbolIndex, error) {
+	b := &symIndexBuilder{
+		f:      f,
+		byAddr: make(map[uint64]string),
+		texts:  newImageTexts(f.Images),
+	}
+
+	log.Info("parsing public symbols...")
+	b.addExports()
+
+	log.Info("parsing private symbols...")
+	if err := b.addLocals(); errors.Is(err, ErrNoLocals) {
+		utils.Indent(log.Warn, 2)("cache does NOT contain local symbols")
+	} else if err != nil {
+		return nil, err
+	}
+
+	log.Info("parsing objc symbols...")
+	b.addObjC()
+
+	if f.IsArm64() {
+		log.Info("parsing symbol stubs...")
+		b.addStubs()
+	}
+
+	b.finish()
+
+	dest, err := saveIndex(f.UUID, dest, symIndexExt, "--cache", b.write)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save symbol index: %v", err)
+	}
+
+	utils.Indent(log.Info, 2)(fmt.Sprintf("Created symbol index with %d symbols: %s", len(b.entries), dest))
+
+	return OpenSymbolIndex(dest)
+}
+
+// saveIndex atomically writes an index file to dest (falling back to the temp folder if dest is NOT writable)
+func saveIndex(uuid mtypes.UUID, dest, ext, flag string, write func(io.Writer) error) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); errors.Is(err, os.ErrPermission) {
+		dest = tempIndexPath(uuid, dest, ext, flag)
+	} else if err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dest), filepath.Base(dest)+".*")
+	if errors.Is(err, os.ErrPermission) {
+		dest = tempIndexPath(uuid, dest, ext, flag)
+		tmp, err = ioutil.TempFile(filepath.Dir(dest), filepath.Base(dest)+".*")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create index file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write index: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return "", err
+	}
+
+	return dest, nil
+}
+
+func tempIndexPath(uuid mtypes.UUID, dest, ext, flag string) string {
+	log.Errorf("failed to create index file %s (%v)", dest, os.ErrPermission)
+	tmpDir := os.TempDir()
+	if runtime.GOOS == "darwin" {
+		tmpDir = "/tmp"
+	}
+	dest = filepath.Join(tmpDir, uuid.String()+ext)
+	utils.Indent(log.Warn, 2)("creating in the temp folder")
+	utils.Indent(log.Warn, 3)(fmt.Sprintf("to use in the future you must supply the flag: %s %s ", flag, dest))
+	return dest
+}
+
+// OpenOrCreateSymbolIndex opens the cache's symbol index at path (or the default SymbolIndexPath if empty)
+// creating it if it does NOT exist or was built for a different cache. The index is then used by the File's symbol lookups
+func (f *File) OpenOrCreateSymbolIndex(path string) (*SymbolIndex, error) {
+	if f.symIndex != nil {
+		return f.symIndex, nil
+	}
+
+	if len(path) == 0 {
+		var err error
+		if path, err = f.SymbolIndexPath(); err != nil {
+			return nil, fmt.Errorf("failed to get symbol index path: %v", err)
+		}
+	}
+
+	idx, err := OpenSymbolIndex(path)
+	if err == nil && idx.UUID != f.UUID {
+		log.Warnf("symbol index %s is for cache %s (expected %s)", path, idx.UUID, f.UUID)
+		idx.Close()
+		err = fmt.Errorf("symbol index UUID mismatch")
+	}
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("re-creating symbol index: %v", err)
+		}
+		log.Info("Creating dyld_shared_cache symbol index (this only happens once per cache)...")
+		if idx, err = f.CreateSymbolIndex(path); err != nil {
+			return nil, err
+		}
+	}
+
+	f.symIndex = idx
+
+	return idx, nil
+}
+
+// LookupSymbol returns the name of the symbol at the given virtual address
+// checking the analysis symbols first and then the symbol index (if opened)
+func (f *File) LookupSymbol(addr uint64) (string, bool) {
+	if name, ok := f.symbolAt(addr); ok {
+		return name, true
+	}
+	if f.symIndex != nil {
+		if sym, err := f.symIndex.Lookup(addr); err == nil {
+			return sym.Name, true
+		}
+	}
+	return "", false
+}
@@ -244,7 +244,7 @@ func (i CacheSlideInfo) GetVersion() uint32 {
 	return i.Version
 }
 func (i CacheSlideInfo) GetPageSize() uint32 {
-	return 0
+	return 4096
 }
 func (i CacheSlideInfo) SlidePointer(ptr uint64) uint64 {
 	return ptr // TODO: finish this
@@ -630,10 +630,132 @@ func (p CachePatchableLocation) String(cacheBase uint64) string {
 	if p.Addend() > 0 {
 		pStr += fmt.Sprintf(", addend: %#x", p.Addend())
 	}
-	pStr += fmt.Sprintf(", key: %s, auth: %t", KeyName(uint64(p)), p.Authenticated())
+	pStr += fmt.Sprintf(", key: %s, auth: %t", KeyName(p.Key()<<49), p.Authenticated())
 	return pStr
 }
 
+// CachePatchInfoV2 is the dyld_cache_patch_info_v2 struct (v3 adds the GOT patch tables)
+type CachePatchInfoV2 struct {
+	PatchTableVersion            uint32 // == 2 or 3
+	PatchLocationVersion         uint32 // == 0 for now
+	PatchTableArrayAddr          uint64 // (unslid) address of array for dyld_cache_image_patches_v2 for each image
+	PatchTableArrayCount         uint64 // count of patch table entries
+	PatchImageExportsArrayAddr   uint64 // (unslid) address of array for image exports
+	PatchImageExportsArrayCount  uint64 // count of patch table entries
+	PatchClientsArrayAddr        uint64 // (unslid) address of array for patch clients
+	PatchClientsArrayCount       uint64 // count of patch clients entries
+	PatchClientExportsArrayAddr  uint64 // (unslid) address of array for patch client exports
+	PatchClientExportsArrayCount uint64 // count of patch client exports entries
+	PatchLocationArrayAddr       uint64 // (unslid) address of array for patch locations for each patch
+	PatchLocationArrayCount      uint64 // count of patch location entries
+	PatchExportNamesAddr         uint64 // blob of strings of export names for patches
+	PatchExportNamesSize         uint64 // size of string blob of export names for patches
+}
+
+// CachePatchInfoV3 is the dyld_cache_patch_info_v3 struct
+type CachePatchInfoV3 struct {
+	CachePatchInfoV2
+	GotClientsArrayAddr        uint64 // (unslid) address of array for dyld_cache_image_got_clients_v3 for each image
+	GotClientsArrayCount       uint64 // count of got clients entries.  Should always match the patchTableArrayCount
+	GotClientExportsArrayAddr  uint64 // (unslid) address of array for patch exports for each GOT image
+	GotClientExportsArrayCount uint64 // count of patch exports entries
+	GotLocationArrayAddr       uint64 // (unslid) address of array for patch locations for each GOT patch
+	GotLocationArrayCount      uint64 // count of patch location entries
+}
+
+type CacheImagePatchesV2 struct {
+	PatchClientsStartIndex uint32
+	PatchClientsCount      uint32
+	PatchExportsStartIndex uint32 // Points to dyld_cache_image_export_v2[]
+	PatchExportsCount      uint32
+}
+
+type CacheImageExportV2 struct {
+	DylibOffsetOfImpl uint32 // Offset from the dylib we used to find a dyld_cache_image_patches_v2
+	ExportName        uint32 // exportNameOffset:28, patchKind:4
+}
+
+func (e CacheImageExportV2) NameOffset() uint32 {
+	return e.ExportName & 0x0FFFFFFF
+}
+func (e CacheImageExportV2) Kind() PatchKind {
+	return PatchKind(e.ExportName >> 28)
+}
+
+// PatchKind is the kind of a patchable export
+type PatchKind uint32
+
+const (
+	PatchKindRegular PatchKind = iota
+	PatchKindCfObj2
+	PatchKindObjcClass
+)
+
+func (k PatchKind) String() string {
+	switch k {
+	case PatchKindRegular:
+		return "regular"
+	case PatchKindCfObj2:
+		return "cfobj2"
+	case PatchKindObjcClass:
+		return "objc_class"
+	default:
+		return fmt.Sprintf("kind(%d)", k)
+	}
+}
+
+type CacheImageClientsV2 struct {
+	ClientDylibIndex       uint32
+	PatchExportsStartIndex uint32 // Points to dyld_cache_patchable_export_v2[]
+	PatchExportsCount      uint32
+}
+
+type CachePatchableExportV2 struct {
+	ImageExportIndex         uint32 // Points to dyld_cache_image_export_v2
+	PatchLocationsStartIndex uint32 // Points to dyld_cache_patchable_location_v2[]
+	PatchLocationsCount      uint32
+}
+
+type CacheImageGotClientsV3 struct {
+	PatchExportsStartIndex uint32 // Points to dyld_cache_patchable_export_v3[]
+	PatchExportsCount      uint32
+}
+
+// CachePatchableLocationV2 is the dyld_cache_patchable_location_v2 struct
+type CachePatchableLocationV2 struct {
+	DylibOffsetOfUse uint32 // Offset from the dylib we used to get a dyld_cache_image_clients_v2
+	Info             patchLocationInfo
+}
+
+// CachePatchableLocationV3 is the dyld_cache_patchable_location_v3 struct
+type CachePatchableLocationV3 struct {
+	CacheOffsetOfUse uint64 // Offset from the cache header
+	Info             patchLocationInfo
+	_                uint32 // padding for 64bit alignment
+}
+
+// patchLocationInfo is the high7:7, addend:5, authenticated:1, usesAddressDiversity:1, key:2, discriminator:16 bitfield of a patch location
+type patchLocationInfo uint32
+
+func (p patchLocationInfo) High7() uint64 {
+	return types.ExtractBits(uint64(p), 0, 7)
+}
+func (p patchLocationInfo) Addend() uint64 {
+	return types.ExtractBits(uint64(p), 7, 5) // 0..31
+}
+func (p patchLocationInfo) Authenticated() bool {
+	return types.ExtractBits(uint64(p), 12, 1) != 0
+}
+func (p patchLocationInfo) UsesAddressDiversity() bool {
+	return types.ExtractBits(uint64(p), 13, 1) != 0
+}
+func (p patchLocationInfo) Key() uint64 {
+	return types.ExtractBits(uint64(p), 14, 2)
+}
+func (p patchLocationInfo) Discriminator() uint64 {
+	return types.ExtractBits(uint64(p), 16, 16)
+}
+
 type SubCacheInfo struct {
 	UUID           types.UUID
 	CumulativeSize uint64
@@ -8,12 +8,6 @@ import (
 	"github.com/blacktop/go-macho/types"
 )
 
-func output(show bool, fmtStr string, args ...interface{}) {
-	if show {
-		fmt.Printf(fmtStr, args...)
-	}
-}
-
 // Is64bit returns if dyld is 64bit or not
 func (f *File) Is64bit() bool {
 	return strings.Contains(f.Headers[f.UUID].Magic.String(), "64")
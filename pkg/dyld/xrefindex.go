@@ -0,0 +1,706 @@
+package dyld
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/apex/log"
+	mtypes "github.com/blacktop/go-macho/types"
+	"github.com/blacktop/ipsw/internal/emu"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	xrefIndexMagic     = "DSCXREFX"
+	xrefIndexVersion   = 3
+	xrefIndexEntrySize = 16
+	xrefIndexExt       = ".xrefidx"
+	xrefTypeShift      = 56 // the xref type is stored in the top byte of the source address
+)
+
+// XrefType is the kind of a cross reference in the xref index
+type XrefType uint8
+
+const (
+	XrefCall     XrefType = iota + 1 // BL (through stubs and branch islands)
+	XrefJump                         // B (through stubs and branch islands)
+	XrefAddr                         // ADR or ADRP+ADD
+	XrefData                         // ADRP+LDR/STR or LDR (literal)
+	XrefGOT                          // load of a GOT entry (the target is the GOT entry's target)
+	XrefSelRef                       // load of a selector reference (the target is the selector)
+	XrefClassRef                     // load of a class reference (the target is the class)
+	XrefCString                      // address of a cstring
+	XrefCase                         // BR of a switch jump table (the target is a case)
+)
+
+func (t XrefType) String() string {
+	switch t {
+	case XrefCall:
+		return "call"
+	case XrefJump:
+		return "jump"
+	case XrefAddr:
+		return "addr"
+	case XrefData:
+		return "data"
+	case XrefGOT:
+		return "got"
+	case XrefSelRef:
+		return "selref"
+	case XrefClassRef:
+		return "classref"
+	case XrefCString:
+		return "cstring"
+	case XrefCase:
+		return "case"
+	default:
+		return fmt.Sprintf("XrefType(%d)", t)
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (t XrefType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Xref is a cross reference in the xref index
+type Xref struct {
+	From   uint64   `json:"from"`
+	Target uint64   `json:"target"`
+	Type   XrefType `json:"type"`
+}
+
+type xrefIndexHeader struct {
+	Magic      [8]byte
+	Version    uint32
+	NumXrefs   uint32
+	UUID       mtypes.UUID
+	NumStrings uint32
+	_          uint32
+	XrefsOff   uint64 // entries sorted by target
+	StringsOff uint64 // cstring targets sorted by address
+	StrsOff    uint64
+	StrsSize   uint64
+}
+
+type xrefIndexEntry struct {
+	Target uint64
+	From   uint64 // type<<xrefTypeShift | source address
+}
+
+func (e xrefIndexEntry) xref() Xref {
+	return Xref{
+		From:   e.From &^ (0xff << xrefTypeShift),
+		Target: e.Target,
+		Type:   XrefType(e.From >> xrefTypeShift),
+	}
+}
+
+// XrefIndex is an on-disk index of the cross references of all the code in a dyld_shared_cache.
+//
+// Entries are stored sorted by target so that finding all the references to an address is a binary
+// search on the file. The referenced cstrings are also stored so they can be looked up by value.
+type XrefIndex struct {
+	UUID mtypes.UUID
+	Path string
+
+	hdr    xrefIndexHeader
+	r      io.ReaderAt
+	closer io.Closer
+}
+
+// OpenXrefIndex opens the xref index file at path
+func OpenXrefIndex(path string) (*XrefIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := NewXrefIndex(f)
+	if err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "failed to open xref index %s", path)
+	}
+	idx.Path = path
+	idx.closer = f
+	return idx, nil
+}
+
+// NewXrefIndex creates a new XrefIndex for accessing an xref index in an underlying reader
+func NewXrefIndex(r io.ReaderAt) (*XrefIndex, error) {
+	idx := &XrefIndex{r: r}
+
+	if err := binary.Read(io.NewSectionReader(r, 0, 1<<63-1), binary.LittleEndian, &idx.hdr); err != nil {
+		return nil, fmt.Errorf("failed to read xref index header: %v", err)
+	}
+	if string(idx.hdr.Magic[:]) != xrefIndexMagic {
+		return nil, fmt.Errorf("invalid xref index magic: %q", idx.hdr.Magic[:])
+	}
+	if idx.hdr.Version != xrefIndexVersion {
+		return nil, fmt.Errorf("unsupported xref index version %d (expected %d)", idx.hdr.Version, xrefIndexVersion)
+	}
+	idx.UUID = idx.hdr.UUID
+
+	return idx, nil
+}
+
+// Close closes the XrefIndex
+func (i *XrefIndex) Close() error {
+	var err error
+	if i.closer != nil {
+		err = i.closer.Close()
+		i.closer = nil
+	}
+	return err
+}
+
+// Len returns the number of xrefs in the index
+func (i *XrefIndex) Len() int {
+	return int(i.hdr.NumXrefs)
+}
+
+func (i *XrefIndex) entry(n int) (xrefIndexEntry, error) {
+	var b [xrefIndexEntrySize]byte
+	if _, err := i.r.ReadAt(b[:], int64(i.hdr.XrefsOff)+int64(n)*xrefIndexEntrySize); err != nil {
+		return xrefIndexEntry{}, fmt.Errorf("failed to read xref index entry %d: %v", n, err)
+	}
+	return xrefIndexEntry{
+		Target: binary.LittleEndian.Uint64(b[0:]),
+		From:   binary.LittleEndian.Uint64(b[8:]),
+	}, nil
+}
+
+// To returns all the cross references to the given virtual address
+func (i *XrefIndex) To(target uint64) ([]Xref, error) {
+	var xrefs []Xref
+
+	n, err := searchIndex(i.Len(), func(n int) (bool, error) {
+		e, err := i.entry(n)
+		return e.Target < target, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for ; n < i.Len(); n++ {
+		e, err := i.entry(n)
+		if err != nil {
+			return nil, err
+		}
+		if e.Target != target {
+			break
+		}
+		xrefs = append(xrefs, e.xref())
+	}
+
+	return xrefs, nil
+}
+
+// FindString returns the addresses of the referenced cstrings (and selector names) equal to s
+func (i *XrefIndex) FindString(s string) ([]uint64, error) {
+	var addrs []uint64
+
+	strs := make([]byte, i.hdr.StrsSize)
+	if _, err := i.r.ReadAt(strs, int64(i.hdr.StrsOff)); err != nil {
+		return nil, fmt.Errorf("failed to read xref index strings: %v", err)
+	}
+
+	br := bufio.NewReader(io.NewSectionReader(i.r, int64(i.hdr.StringsOff), int64(i.hdr.NumStrings)*xrefIndexEntrySize))
+	var b [xrefIndexEntrySize]byte
+	for n := uint32(0); n < i.hdr.NumStrings; n++ {
+		if _, err := io.ReadFull(br, b[:]); err != nil {
+			return nil, fmt.Errorf("failed to read xref index string %d: %v", n, err)
+		}
+		off := binary.LittleEndian.Uint32(b[8:])
+		if uint64(off)+uint64(len(s)) >= uint64(len(strs)) {
+			continue
+		}
+		if string(strs[off:int(off)+len(s)]) == s && strs[int(off)+len(s)] == 0 {
+			addrs = append(addrs, binary.LittleEndian.Uint64(b[0:]))
+		}
+	}
+
+	return addrs, nil
+}
+
+/*
+ * Building the index
+ */
+
+type xrefSection struct {
+	start uint64
+	end   uint64
+	typ   XrefType
+}
+
+type xrefIndexBuilder struct {
+	f       *File
+	entries []xrefIndexEntry
+	strings map[uint64]string
+	texts   imageTexts
+	stubs   map[uint64]uint64 // symbol stub => target
+	got     map[uint64]uint64 // GOT entry => target
+	islands map[uint64]uint64 // branch/stub island => target
+	secs    []xrefSection     // the current image's selrefs, classrefs and cstrings
+	mu      *sync.Mutex       // guards the entries, strings and islands shared by the image workers
+}
+
+// fork returns a builder for a single image that shares the cache wide maps with b
+func (b *xrefIndexBuilder) fork() *xrefIndexBuilder {
+	return &xrefIndexBuilder{
+		f:       b.f,
+		strings: b.strings,
+		texts:   b.texts,
+		stubs:   b.stubs,
+		got:     b.got,
+		islands: b.islands,
+		mu:      b.mu,
+	}
+}
+
+// merge adds the xrefs found by a forked builder
+func (b *xrefIndexBuilder) merge(wb *xrefIndexBuilder) {
+	b.mu.Lock()
+	b.entries = append(b.entries, wb.entries...)
+	b.mu.Unlock()
+}
+
+func (b *xrefIndexBuilder) add(from, target uint64, typ XrefType) {
+	if target == 0 {
+		return
+	}
+	b.entries = append(b.entries, xrefIndexEntry{Target: target, From: uint64(typ)<<xrefTypeShift | from})
+}
+
+func (b *xrefIndexBuilder) section(addr uint64) XrefType {
+	for _, sec := range b.secs {
+		if sec.start <= addr && addr < sec.end {
+			return sec.typ
+		}
+	}
+	return 0
+}
+
+func (b *xrefIndexBuilder) pointer(addr uint64) uint64 {
+	ptr, err := b.f.ReadPointerAtAddress(addr)
+	if err != nil {
+		return 0
+	}
+	if b.f.SlideInfo == nil {
+		return ptr
+	}
+	return b.f.SlideInfo.SlidePointer(ptr)
+}
+
+// addString saves the cstring at addr so it can be looked up by value
+func (b *xrefIndexBuilder) addString(addr uint64) bool {
+	b.mu.Lock()
+	_, ok := b.strings[addr]
+	b.mu.Unlock()
+	if ok {
+		return true
+	}
+	str, err := b.f.GetCString(addr)
+	if err != nil {
+		return false
+	}
+	b.mu.Lock()
+	b.strings[addr] = str
+	b.mu.Unlock()
+	return true
+}
+
+// addAddr adds a reference to an address computed by ADR or ADRP+ADD
+func (b *xrefIndexBuilder) addAddr(from, addr uint64) {
+	if b.section(addr) != XrefCString || !b.addString(addr) {
+		b.add(from, addr, XrefAddr)
+		return
+	}
+	b.add(from, addr, XrefCString)
+}
+
+// addLoad adds a reference to an address loaded from (or stored to)
+func (b *xrefIndexBuilder) addLoad(from, addr uint64) {
+	if target, ok := b.got[addr]; ok {
+		b.add(from, b.resolveBranch(target), XrefGOT)
+		return
+	}
+	switch typ := b.section(addr); typ {
+	case XrefSelRef: // the target is the selector's name so it can be found with FindString
+		target := b.pointer(addr)
+		if target != 0 {
+			b.addString(target)
+		}
+		b.add(from, target, typ)
+	case XrefClassRef:
+		b.add(from, b.pointer(addr), typ)
+	default:
+		b.add(from, addr, XrefData)
+	}
+}
+
+// resolveBranch follows a branch target through the symbol stubs and the islands of the cache
+func (b *xrefIndexBuilder) resolveBranch(target uint64) uint64 {
+	return followBranch(target, b.stub, func(addr uint64) bool { return b.texts.lookup(addr) != noImage }, b.island)
+}
+
+// followBranch follows a branch target through the symbol stubs and the islands outside of
+// the images (the BranchPools of older caches and the stub islands of the newer sub-caches)
+func followBranch(target uint64, stub func(uint64) (uint64, bool), inImage func(uint64) bool, island func(uint64) (uint64, bool)) uint64 {
+	for hops := 0; hops < 4; hops++ {
+		if next, ok := stub(target); ok {
+			target = next
+			continue
+		}
+		if inImage(target) {
+			break
+		}
+		next, ok := island(target)
+		if !ok {
+			break
+		}
+		target = next
+	}
+	return target
+}
+
+func (b *xrefIndexBuilder) stub(addr uint64) (uint64, bool) {
+	target, ok := b.stubs[addr]
+	return target, ok
+}
+
+func (b *xrefIndexBuilder) island(addr uint64) (uint64, bool) {
+	b.mu.Lock()
+	target, ok := b.islands[addr]
+	b.mu.Unlock()
+	if ok {
+		return target, target != 0
+	}
+	target, ok = b.f.islandTarget(addr)
+	b.mu.Lock()
+	b.islands[addr] = target
+	b.mu.Unlock()
+	return target, ok
+}
+
+// islandTarget decodes the target of a branch island (b target) or a stub island (adrp x16 + add/ldr x16 + br x16)
+func (f *File) islandTarget(addr uint64) (uint64, bool) {
+	uuid, off, err := f.GetOffset(addr)
+	if err != nil {
+		return 0, false
+	}
+	dat, err := f.ReadBytesForUUID(uuid, int64(off), 12)
+	if err != nil || len(dat) < 12 {
+		return 0, false
+	}
+	ins := []uint32{
+		binary.LittleEndian.Uint32(dat[0:]),
+		binary.LittleEndian.Uint32(dat[4:]),
+		binary.LittleEndian.Uint32(dat[8:]),
+	}
+
+	var target uint64
+	switch {
+	case ins[0]&0xfc000000 == 0x14000000: // b
+		target = uint64(int64(addr) + signExtend(uint64(ins[0]&0x3ffffff), 26)*4)
+	case isADRP(ins[0]) && isBranchRegister(ins[2]):
+		page := adrpTarget(addr, ins[0])
+		switch {
+		case isADD(ins[1]):
+			target = page + addImm(ins[1])
+		case ins[1]&0xffc00000 == 0xf9400000: // ldr x, [x, #imm]
+			if ptr, err := f.ReadPointerAtAddress(page + uint64((ins[1]>>10)&0xfff)<<3); err == nil {
+				target = ptr
+				if f.SlideInfo != nil {
+					target = f.SlideInfo.SlidePointer(ptr)
+				}
+			}
+		}
+	}
+
+	return target, target != 0
+}
+
+func signExtend(v uint64, bits uint) int64 {
+	shift := 64 - bits
+	return int64(v<<shift) >> shift
+}
+
+func isADRP(ins uint32) bool {
+	return ins&0x9f000000 == 0x90000000
+}
+
+func adrpTarget(pc uint64, ins uint32) uint64 {
+	imm := uint64((ins>>5)&0x7ffff)<<2 | uint64((ins>>29)&3)
+	return uint64(int64(pc&^0xfff) + signExtend(imm, 21)<<12)
+}
+
+func isADD(ins uint32) bool { // add (immediate, 64-bit)
+	return ins&0xff800000 == 0x91000000
+}
+
+func addImm(ins uint32) uint64 {
+	imm := uint64((ins >> 10) & 0xfff)
+	if ins&(1<<22) != 0 {
+		imm <<= 12
+	}
+	return imm
+}
+
+func isBranchRegister(ins uint32) bool { // br, braa, brab, braaz and brabz
+	return ins&0xfffffc1f == 0xd61f0000 || ins&0xfffff800 == 0xd61f0800 || ins&0xfffff800 == 0xd71f0800
+}
+
+// scan decodes the ADR(P) address computations, loads and branches in a code section
+func (b *xrefIndexBuilder) scan(code []byte, addr uint64) {
+	var regs [32]uint64 // the addresses tracked in the registers
+	var valid uint32    // the registers holding a tracked address
+
+	for off := 0; off+4 <= len(code); off += 4 {
+		pc := addr + uint64(off)
+		ins := binary.LittleEndian.Uint32(code[off:])
+		rd := ins & 31
+		rn := (ins >> 5) & 31
+
+		switch {
+		case isADRP(ins):
+			regs[rd] = adrpTarget(pc, ins)
+			valid |= 1 << rd
+			continue
+		case ins&0x9f000000 == 0x10000000: // adr
+			b.addAddr(pc, uint64(int64(pc)+signExtend(uint64((ins>>5)&0x7ffff)<<2|uint64((ins>>29)&3), 21)))
+		case isADD(ins) && valid&(1<<rn) != 0:
+			target := regs[rn] + addImm(ins)
+			b.addAddr(pc, target)
+			regs[rd] = target
+			valid |= 1 << rd
+			continue
+		case ins&0x3b000000 == 0x39000000 && valid&(1<<rn) != 0: // ldr/str (immediate, unsigned offset)
+			scale := ins >> 30
+			if ins&(1<<26) != 0 && ins&(1<<23) != 0 { // 128-bit SIMD&FP
+				scale = 4
+			}
+			b.addLoad(pc, regs[rn]+uint64((ins>>10)&0xfff)<<scale)
+		case ins&0x3b000000 == 0x18000000: // ldr (literal)
+			b.addLoad(pc, uint64(int64(pc)+signExtend(uint64((ins>>5)&0x7ffff), 19)*4))
+		case ins&0x7c000000 == 0x14000000: // b and bl
+			target := b.resolveBranch(uint64(int64(pc) + signExtend(uint64(ins&0x3ffffff), 26)*4))
+			if ins&0x80000000 != 0 {
+				b.add(pc, target, XrefCall)
+				valid &^= 0x7ffff // the call clobbers x0-x18
+			} else {
+				b.add(pc, target, XrefJump)
+				valid = 0
+			}
+			continue
+		case isBranchRegister(ins) || ins&0xfffffc1f == 0xd65f0000: // br or ret
+			valid = 0
+			continue
+		}
+
+		// conservatively assume every other instruction overwrites its destination register
+		valid &^= 1 << rd
+	}
+}
+
+func (b *xrefIndexBuilder) addImage(image *CacheImage) error {
+	m, err := image.GetPartialMacho()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	b.secs = b.secs[:0]
+	for _, sec := range m.Sections {
+		var typ XrefType
+		switch {
+		case sec.Name == "__objc_selrefs":
+			typ = XrefSelRef
+		case sec.Name == "__objc_classrefs" || sec.Name == "__objc_superrefs":
+			typ = XrefClassRef
+		case sec.Flags.IsCstringLiterals():
+			typ = XrefCString
+		default:
+			continue
+		}
+		b.secs = append(b.secs, xrefSection{start: sec.Addr, end: sec.Addr + sec.Size, typ: typ})
+	}
+
+	for _, sec := range m.Sections {
+		if sec.Seg != "__TEXT" || sec.Name != "__text" {
+			continue
+		}
+		uuid, off, err := b.f.GetOffset(sec.Addr)
+		if err != nil {
+			return err
+		}
+		code, err := b.f.ReadBytesForUUID(uuid, int64(off), sec.Size)
+		if err != nil {
+			return err
+		}
+		b.scan(code, sec.Addr)
+		for _, jt := range emu.FindJumpTables(image, code, sec.Addr, sec.Addr, sec.Addr+sec.Size) {
+			for _, target := range jt.UniqueTargets() {
+				b.add(jt.Branch, target, XrefCase)
+			}
+		}
+	}
+
+	return nil
+}
+
+// write serializes the index
+func (b *xrefIndexBuilder) write(w io.Writer) error {
+	sort.Slice(b.entries, func(i, j int) bool {
+		if b.entries[i].Target != b.entries[j].Target {
+			return b.entries[i].Target < b.entries[j].Target
+		}
+		return b.entries[i].From < b.entries[j].From
+	})
+
+	var strs bytes.Buffer
+	strs.WriteByte(0)
+	addrs := make([]uint64, 0, len(b.strings))
+	for addr := range b.strings {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	strTable := make([]byte, len(addrs)*xrefIndexEntrySize)
+	for idx, addr := range addrs {
+		binary.LittleEndian.PutUint64(strTable[idx*xrefIndexEntrySize:], addr)
+		binary.LittleEndian.PutUint32(strTable[idx*xrefIndexEntrySize+8:], uint32(strs.Len()))
+		strs.WriteString(b.strings[addr])
+		strs.WriteByte(0)
+	}
+
+	hdr := xrefIndexHeader{
+		Version:    xrefIndexVersion,
+		NumXrefs:   uint32(len(b.entries)),
+		UUID:       b.f.UUID,
+		NumStrings: uint32(len(addrs)),
+	}
+	copy(hdr.Magic[:], xrefIndexMagic)
+	hdr.XrefsOff = uint64(binary.Size(hdr))
+	hdr.StringsOff = hdr.XrefsOff + uint64(len(b.entries)*xrefIndexEntrySize)
+	hdr.StrsOff = hdr.StringsOff + uint64(len(strTable))
+	hdr.StrsSize = uint64(strs.Len())
+
+	bw := bufio.NewWriterSize(w, 1<<20)
+	if err := binary.Write(bw, binary.LittleEndian, hdr); err != nil {
+		return err
+	}
+	var e [xrefIndexEntrySize]byte
+	for _, entry := range b.entries {
+		binary.LittleEndian.PutUint64(e[0:], entry.Target)
+		binary.LittleEndian.PutUint64(e[8:], entry.From)
+		if _, err := bw.Write(e[:]); err != nil {
+			return err
+		}
+	}
+	if _, err := bw.Write(strTable); err != nil {
+		return err
+	}
+	if _, err := strs.WriteTo(bw); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// XrefIndexPath returns the default location of the xref index for the cache
+func (f *File) XrefIndexPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ipsw", "dyld", f.UUID.String()+xrefIndexExt), nil
+}
+
+// CreateXrefIndex disassembles the code of every image in the cache and saves all the cross references as an xref index at dest
+func (f *File) CreateXrefIndex(dest string) (*XrefIndex, error) {
+	if !f.IsArm64() {
+		return nil, fmt.Errorf("can only index the xrefs of arm64 caches")
+	}
+
+	b := &xrefIndexBuilder{
+		f:       f,
+		strings: make(map[uint64]string),
+		texts:   newImageTexts(f.Images),
+		stubs:   make(map[uint64]uint64),
+		got:     make(map[uint64]uint64),
+		islands: make(map[uint64]uint64),
+		mu:      new(sync.Mutex),
+	}
+
+	log.Info("parsing symbol stubs and GOTs...")
+	f.ForEachImage(func(image *CacheImage) error {
+		if err := f.ParseSymbolStubs(image); err != nil {
+			utils.Indent(log.Debug, 2)(fmt.Sprintf("failed to parse symbol stubs for %s: %v", image.Name, err))
+		}
+		if err := f.ParseGOT(image); err != nil {
+			utils.Indent(log.Debug, 2)(fmt.Sprintf("failed to parse GOT for %s: %v", image.Name, err))
+		}
+		return nil
+	})
+	for _, image := range f.Images {
+		for stub, target := range image.Analysis.SymbolStubs {
+			b.stubs[stub] = target
+		}
+		for entry, target := range image.Analysis.GotPointers {
+			b.got[entry] = target
+		}
+	}
+
+	log.Info("disassembling images...")
+	f.ForEachImage(func(image *CacheImage) error {
+		utils.Indent(log.Debug, 2)(fmt.Sprintf("indexing %s", image.Name))
+		wb := b.fork()
+		if err := wb.addImage(image); err != nil {
+			utils.Indent(log.Warn, 2)(fmt.Sprintf("failed to index xrefs of %s: %v", image.Name, err))
+		}
+		b.merge(wb)
+		return nil
+	})
+
+	dest, err := saveIndex(f.UUID, dest, xrefIndexExt, "--xrefs", b.write)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save xref index: %v", err)
+	}
+
+	utils.Indent(log.Info, 2)(fmt.Sprintf("Created xref index with %d xrefs: %s", len(b.entries), dest))
+
+	return OpenXrefIndex(dest)
+}
+
+// OpenOrCreateXrefIndex opens the cache's xref index at path (or the default XrefIndexPath if empty)
+// creating it if it does NOT exist or was built for a different cache
+func (f *File) OpenOrCreateXrefIndex(path string) (*XrefIndex, error) {
+	if len(path) == 0 {
+		var err error
+		if path, err = f.XrefIndexPath(); err != nil {
+			return nil, fmt.Errorf("failed to get xref index path: %v", err)
+		}
+	}
+
+	idx, err := OpenXrefIndex(path)
+	if err == nil && idx.UUID != f.UUID {
+		log.Warnf("xref index %s is for cache %s (expected %s)", path, idx.UUID, f.UUID)
+		idx.Close()
+		err = fmt.Errorf("xref index UUID mismatch")
+	}
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("re-creating xref index: %v", err)
+		}
+		log.Info("Creating dyld_shared_cache xref index (this only happens once per cache)...")
+		return f.CreateXrefIndex(path)
+	}
+
+	return idx, nil
+}
@@ -0,0 +1,79 @@
+package dyld
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+
+	mtypes "github.com/blacktop/go-macho/types"
+)
+
+func TestXrefIndexStrings(t *testing.T) {
+	uuid := mtypes.UUID{1}
+	dat := make([]byte, 0x1000) // mapped at 0x1000
+	for idx, ins := range []uint32{
+		0x90000008, // 0x1000: adrp x8, 0x1000
+		0xf9440101, // 0x1004: ldr  x1, [x8, #0x800]  (selref)
+		0x90000009, // 0x1008: adrp x9, 0x1000
+		0x91280129, // 0x100c: add  x9, x9, #0xa00    (cstring)
+	} {
+		binary.LittleEndian.PutUint32(dat[4*idx:], ins)
+	}
+	binary.LittleEndian.PutUint64(dat[0x800:], 0x1900) // the selref points to the selector's name
+	copy(dat[0x900:], "initWithFrame:\x00")
+	copy(dat[0xa00:], "Hello, World!\x00")
+
+	f := &File{
+		UUID:     uuid,
+		Mappings: map[mtypes.UUID]cacheMappings{uuid: {{CacheMappingInfo: CacheMappingInfo{Address: 0x1000, Size: 0x1000}}}},
+		r:        map[mtypes.UUID]io.ReaderAt{uuid: bytes.NewReader(dat)},
+	}
+	b := &xrefIndexBuilder{
+		f:       f,
+		strings: make(map[uint64]string),
+		islands: make(map[uint64]uint64),
+		mu:      new(sync.Mutex),
+		secs: []xrefSection{
+			{start: 0x1800, end: 0x1808, typ: XrefSelRef},
+			{start: 0x1a00, end: 0x1a10, typ: XrefCString},
+		},
+	}
+	b.scan(dat[:16], 0x1000)
+
+	var buf bytes.Buffer
+	if err := b.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := NewXrefIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		str   string
+		xrefs []Xref
+	}{
+		{"initWithFrame:", []Xref{{From: 0x1004, Target: 0x1900, Type: XrefSelRef}}},
+		{"Hello, World!", []Xref{{From: 0x100c, Target: 0x1a00, Type: XrefCString}}},
+		{"initWithFrame", nil},
+	} {
+		addrs, err := idx.FindString(tt.str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var xrefs []Xref
+		for _, addr := range addrs {
+			x, err := idx.To(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			xrefs = append(xrefs, x...)
+		}
+		if !reflect.DeepEqual(xrefs, tt.xrefs) {
+			t.Errorf("xrefs to %q = %+v (expected %+v)", tt.str, xrefs, tt.xrefs)
+		}
+	}
+}
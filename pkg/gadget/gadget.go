@@ -0,0 +1,237 @@
+// Package gadget finds the ROP/JOP gadgets of arm64 MachOs and dyld_shared_cache images
+// by disassembling backwards from every return and indirect branch.
+package gadget
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blacktop/go-arm64"
+)
+
+// DefaultDepth is the default maximum number of instructions before a gadget's terminator
+const DefaultDepth = 5
+
+// Location is where a gadget is in the code
+type Location struct {
+	Image   string `json:"image,omitempty"`
+	Address uint64 `json:"address"`
+}
+
+// Gadget is a sequence of instructions ending in a return or an indirect branch
+type Gadget struct {
+	Instructions []string   `json:"instructions"`
+	Terminator   string     `json:"terminator"`
+	PAC          bool       `json:"pac"` // the return address or branch target is authenticated
+	Locations    []Location `json:"locations"`
+}
+
+// String returns the gadget's instructions separated by ;
+func (g *Gadget) String() string {
+	return strings.Join(g.Instructions, " ; ")
+}
+
+var gprRE = regexp.MustCompile(`^[xw]([0-9]+)$`)
+
+// regRE returns the regex that matches reg as an operand (x0 and w0 are the same register)
+func regRE(reg string) *regexp.Regexp {
+	reg = strings.ToLower(reg)
+	if m := gprRE.FindStringSubmatch(reg); m != nil {
+		return regexp.MustCompile(`\b[xw]` + m[1] + `\b`)
+	}
+	return regexp.MustCompile(`\b` + regexp.QuoteMeta(reg) + `\b`)
+}
+
+// Uses returns true if any of the gadget's instructions has reg as an operand (x0 and w0 are the same register)
+func (g *Gadget) Uses(reg string) bool {
+	return g.uses(regRE(reg))
+}
+
+func (g *Gadget) uses(re *regexp.Regexp) bool {
+	for _, instr := range g.Instructions {
+		if _, operands := splitInstr(instr); re.MatchString(operands) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches returns true if re matches the gadget's instructions (as returned by String)
+func (g *Gadget) Matches(re *regexp.Regexp) bool {
+	return re.MatchString(g.String())
+}
+
+func splitInstr(instr string) (string, string) {
+	if idx := strings.IndexByte(instr, ' '); idx > 0 {
+		return instr[:idx], instr[idx+1:]
+	}
+	return instr, ""
+}
+
+// Set is a collection of gadgets de-duplicated by their instructions
+type Set struct {
+	Gadgets []*Gadget
+
+	depth  int
+	byText map[string]*Gadget
+}
+
+// NewSet returns an empty gadget set that finds gadgets of up to depth instructions before their terminator
+func NewSet(depth int) *Set {
+	if depth < 0 {
+		depth = DefaultDepth
+	}
+	return &Set{
+		depth:  depth,
+		byText: make(map[string]*Gadget),
+	}
+}
+
+func (s *Set) add(g *Gadget) {
+	text := g.String()
+	if dup, ok := s.byText[text]; ok {
+		dup.Locations = append(dup.Locations, g.Locations...)
+		return
+	}
+	s.byText[text] = g
+	s.Gadgets = append(s.Gadgets, g)
+}
+
+// Merge adds the gadgets of another set (in order)
+func (s *Set) Merge(other *Set) {
+	for _, g := range other.Gadgets {
+		s.add(&Gadget{
+			Instructions: g.Instructions,
+			Terminator:   g.Terminator,
+			PAC:          g.PAC,
+			Locations:    append([]Location(nil), g.Locations...),
+		})
+	}
+}
+
+// Filter returns the gadgets for which keep returns true
+func (s *Set) Filter(keep func(g *Gadget) bool) []*Gadget {
+	var gadgets []*Gadget
+	for _, g := range s.Gadgets {
+		if keep == nil || keep(g) {
+			gadgets = append(gadgets, g)
+		}
+	}
+	return gadgets
+}
+
+type instruction struct {
+	op   arm64.Operation
+	text string
+	ok   bool
+}
+
+// Add finds the gadgets in code (which is mapped at addr in image)
+func (s *Set) Add(image string, code []byte, addr uint64) {
+	instrs := make([]instruction, 0, len(code)/4)
+	for i := range arm64.Disassemble(bytes.NewReader(code[:len(code)&^3]), arm64.Options{StartAddress: int64(addr)}) {
+		if i.Error != nil || i.Instruction == nil {
+			instrs = append(instrs, instruction{})
+			continue
+		}
+		op := i.Instruction.Operation()
+		text := op.String()
+		if operands := strings.TrimSpace(i.Instruction.OpStr()); len(operands) > 0 {
+			text += " " + operands
+		}
+		instrs = append(instrs, instruction{op: op, text: text, ok: true})
+	}
+
+	for end, term := range instrs {
+		if !term.ok || !isTerminator(term.op) {
+			continue
+		}
+		// walk backwards until the depth or an instruction that changes the control flow
+		for start := end; start >= 0 && end-start <= s.depth; start-- {
+			if start < end && (!instrs[start].ok || endsGadget(instrs[start].op)) {
+				break
+			}
+			g := &Gadget{
+				Terminator: term.text,
+				PAC:        isAuthenticated(term.op),
+				Locations:  []Location{{Image: image, Address: addr + uint64(start*4)}},
+			}
+			for _, instr := range instrs[start : end+1] {
+				g.Instructions = append(g.Instructions, instr.text)
+				if isAuth(instr.op) {
+					g.PAC = true
+				}
+			}
+			s.add(g)
+		}
+	}
+}
+
+// isTerminator returns true if the instruction is a return or an indirect branch
+func isTerminator(op arm64.Operation) bool {
+	switch op {
+	case arm64.ARM64_RET, arm64.ARM64_RETAA, arm64.ARM64_RETAB,
+		arm64.ARM64_BR, arm64.ARM64_BRAA, arm64.ARM64_BRAAZ, arm64.ARM64_BRAB, arm64.ARM64_BRABZ,
+		arm64.ARM64_BLR, arm64.ARM64_BLRAA, arm64.ARM64_BLRAAZ, arm64.ARM64_BLRAB, arm64.ARM64_BLRABZ:
+		return true
+	}
+	return false
+}
+
+// isAuthenticated returns true if the terminator authenticates its return address or branch target
+func isAuthenticated(op arm64.Operation) bool {
+	switch op {
+	case arm64.ARM64_RETAA, arm64.ARM64_RETAB,
+		arm64.ARM64_BRAA, arm64.ARM64_BRAAZ, arm64.ARM64_BRAB, arm64.ARM64_BRABZ,
+		arm64.ARM64_BLRAA, arm64.ARM64_BLRAAZ, arm64.ARM64_BLRAB, arm64.ARM64_BLRABZ:
+		return true
+	}
+	return false
+}
+
+// isAuth returns true if the instruction authenticates a pointer
+func isAuth(op arm64.Operation) bool {
+	switch op {
+	case arm64.ARM64_AUTDA, arm64.ARM64_AUTDB, arm64.ARM64_AUTDZA, arm64.ARM64_AUTDZB,
+		arm64.ARM64_AUTIA, arm64.ARM64_AUTIA1716, arm64.ARM64_AUTIASP, arm64.ARM64_AUTIAZ,
+		arm64.ARM64_AUTIB, arm64.ARM64_AUTIB1716, arm64.ARM64_AUTIBSP, arm64.ARM64_AUTIBZ,
+		arm64.ARM64_AUTIZA, arm64.ARM64_AUTIZB:
+		return true
+	}
+	return false
+}
+
+// endsGadget returns true if execution can NOT fall through the instruction to the rest of the gadget
+func endsGadget(op arm64.Operation) bool {
+	switch op {
+	case arm64.ARM64_B, arm64.ARM64_BL, arm64.ARM64_CBZ, arm64.ARM64_CBNZ, arm64.ARM64_TBZ, arm64.ARM64_TBNZ,
+		arm64.ARM64_BRK, arm64.ARM64_HLT, arm64.ARM64_ERET, arm64.ARM64_ERETAA, arm64.ARM64_ERETAB:
+		return true
+	}
+	return isTerminator(op) || strings.HasPrefix(op.String(), "b.")
+}
+
+// Filters returns a gadget filter that keeps the gadgets that use ALL the registers and match the regex (if given)
+func Filters(regs []string, expr string) (func(g *Gadget) bool, error) {
+	var re *regexp.Regexp
+	if len(expr) > 0 {
+		var err error
+		if re, err = regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("invalid gadget regex %s: %v", expr, err)
+		}
+	}
+	var regREs []*regexp.Regexp
+	for _, reg := range regs {
+		regREs = append(regREs, regRE(reg))
+	}
+	return func(g *Gadget) bool {
+		for _, r := range regREs {
+			if !g.uses(r) {
+				return false
+			}
+		}
+		return re == nil || g.Matches(re)
+	}, nil
+}
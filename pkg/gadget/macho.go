@@ -0,0 +1,22 @@
+package gadget
+
+import (
+	"fmt"
+
+	"github.com/blacktop/go-macho"
+)
+
+// AddMachO finds the gadgets in the executable sections of a MachO
+func (s *Set) AddMachO(m *macho.File, image string) error {
+	for _, sec := range m.Sections {
+		if attrs := sec.Flags.GetAttributes(); !attrs.IsPureInstructions() && !attrs.IsSomeInstructions() {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return fmt.Errorf("failed to read %s.%s: %v", sec.Seg, sec.Name, err)
+		}
+		s.Add(image, data, sec.Addr)
+	}
+	return nil
+}
@@ -317,10 +317,34 @@ func (s *Decoder) decode() error {
 				return nil
 			}
 			if s.blockMagic == LZFSE_UNCOMPRESSED_BLOCK_MAGIC {
-				return fmt.Errorf("found LZFSE_UNCOMPRESSED_BLOCK_MAGIC block - not implimented")
+				var header uncompressedBlockHeader
+				if err := binary.Read(s.src, binary.LittleEndian, &header); err != nil {
+					return fmt.Errorf("failed to read LZFSE_UNCOMPRESSED_BLOCK_MAGIC header: %v", err)
+				}
+				if _, err := io.CopyN(&s.dst, s.src, int64(header.NRawBytes)); err != nil {
+					return fmt.Errorf("failed to copy %d raw bytes from uncompressed block: %v", header.NRawBytes, err)
+				}
+				s.blockMagic = LZFSE_NO_BLOCK_MAGIC
+				s.syncReaders()
+				continue
 			}
 			if s.blockMagic == LZFSE_COMPRESSEDLZVN_BLOCK_MAGIC {
-				return fmt.Errorf("found LZFSE_COMPRESSEDLZVN_BLOCK_MAGIC block - not implimented")
+				var header lzvnCompressedBlockHeader
+				if err := binary.Read(s.src, binary.LittleEndian, &header); err != nil {
+					return fmt.Errorf("failed to read LZFSE_COMPRESSEDLZVN_BLOCK_MAGIC header: %v", err)
+				}
+				payload := make([]byte, header.NPayloadBytes)
+				if _, err := io.ReadFull(s.src, payload); err != nil {
+					return fmt.Errorf("failed to read %d byte lzvn payload: %v", header.NPayloadBytes, err)
+				}
+				out, err := lzvnDecode(s.dst.Bytes(), payload, int(header.NRawBytes))
+				if err != nil {
+					return fmt.Errorf("failed to decode lzvn block: %v", err)
+				}
+				s.dst.Write(out)
+				s.blockMagic = LZFSE_NO_BLOCK_MAGIC
+				s.syncReaders()
+				continue
 			}
 			if s.blockMagic == LZFSE_COMPRESSEDV1_BLOCK_MAGIC || s.blockMagic == LZFSE_COMPRESSEDV2_BLOCK_MAGIC {
 				var header1 compressedBlockHeaderV1
@@ -1,5 +1,10 @@
 package lzfse
 
+import (
+	"encoding/binary"
+	"fmt"
+)
+
 type lzvnOpCode byte
 
 const (
@@ -53,3 +58,113 @@ var opcode_table = [256]lzvnOpCode{
 	large_match, small_match, small_match, small_match, small_match, small_match, small_match, small_match,
 	small_match, small_match, small_match, small_match, small_match, small_match, small_match, small_match,
 }
+
+// DecodeLZVN decompresses a raw LZVN stream (no block header) of size uncompressed bytes.
+func DecodeLZVN(src []byte, size int) ([]byte, error) {
+	return lzvnDecode(nil, src, size)
+}
+
+// lzvnDecode decodes an LZVN payload, match distances may reach back into history
+func lzvnDecode(history, src []byte, size int) ([]byte, error) {
+	var L, M, D, prevD int
+
+	out := make([]byte, 0, size)
+
+	for i := 0; i < len(src); {
+		opc := src[i]
+		need := func(n int) error {
+			if i+n > len(src) {
+				return fmt.Errorf("truncated lzvn opcode %#02x at offset %#x", opc, i)
+			}
+			return nil
+		}
+
+		switch opcode_table[opc] {
+		case small_distance: // LLMMMDDD DDDDDDDD
+			if err := need(2); err != nil {
+				return nil, err
+			}
+			L = int(opc >> 6)
+			M = int((opc>>3)&7) + 3
+			D = int(opc&7)<<8 | int(src[i+1])
+			i += 2
+		case medium_distance: // 101LLMMM DDDDDDMM DDDDDDDD
+			if err := need(3); err != nil {
+				return nil, err
+			}
+			opc23 := int(binary.LittleEndian.Uint16(src[i+1:]))
+			L = int((opc >> 3) & 3)
+			M = (int(opc&7)<<2 | opc23&3) + 3
+			D = opc23 >> 2
+			i += 3
+		case large_distance: // LLMMM111 DDDDDDDD DDDDDDDD
+			if err := need(3); err != nil {
+				return nil, err
+			}
+			L = int(opc >> 6)
+			M = int((opc>>3)&7) + 3
+			D = int(binary.LittleEndian.Uint16(src[i+1:]))
+			i += 3
+		case previous_distance: // LLMMM110
+			L = int(opc >> 6)
+			M = int((opc>>3)&7) + 3
+			D = prevD
+			i++
+		case small_match: // 1111MMMM
+			L = 0
+			M = int(opc & 0xf)
+			D = prevD
+			i++
+		case large_match: // 11110000 MMMMMMMM
+			if err := need(2); err != nil {
+				return nil, err
+			}
+			L = 0
+			M = int(src[i+1]) + 16
+			D = prevD
+			i += 2
+		case small_literal: // 1110LLLL
+			L = int(opc & 0xf)
+			M = 0
+			i++
+		case large_literal: // 11100000 LLLLLLLL
+			if err := need(2); err != nil {
+				return nil, err
+			}
+			L = int(src[i+1]) + 16
+			M = 0
+			i += 2
+		case nop:
+			i++
+			continue
+		case end_of_stream:
+			return out, nil
+		default:
+			return nil, fmt.Errorf("undefined lzvn opcode %#02x at offset %#x", opc, i)
+		}
+
+		if L > 0 {
+			if i+L > len(src) {
+				return nil, fmt.Errorf("lzvn literal of %d bytes overruns source at offset %#x", L, i)
+			}
+			out = append(out, src[i:i+L]...)
+			i += L
+		}
+
+		if M > 0 {
+			if D == 0 || D > len(out)+len(history) {
+				return nil, fmt.Errorf("invalid lzvn match distance %d at offset %#x", D, i)
+			}
+			for j := 0; j < M; j++ {
+				if p := len(out) - D; p >= 0 {
+					out = append(out, out[p])
+				} else {
+					out = append(out, history[len(history)+p])
+				}
+			}
+			prevD = D
+		}
+	}
+
+	return out, nil
+}
@@ -202,6 +202,14 @@ type compressedBlockHeaderV2 struct {
 		LZFSE_ENCODE_D_SYMBOLS + LZFSE_ENCODE_LITERAL_SYMBOLS)]uint8
 }
 
+// uncompressedBlockHeader uncompressed block header.
+type uncompressedBlockHeader struct {
+	// Magic number, always LZFSE_UNCOMPRESSED_BLOCK_MAGIC.
+	Magic magic
+	// Number of raw bytes in block.
+	NRawBytes uint32
+}
+
 // lzvnCompressedBlockHeader LZVN compressed block header.
 type lzvnCompressedBlockHeader struct {
 	// Magic number, always LZFSE_COMPRESSEDLZVN_BLOCK_MAGIC.
@@ -26,12 +26,15 @@
 package bom
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
 	"time"
 )
 
@@ -52,18 +55,43 @@ type BOMPointer struct {
 
 type blockPointers []BOMPointer
 
-func (bp blockPointers) lookup(r io.ReadSeeker, i int, into interface{}) error {
-	elem := bp[i]
+// BOMInfoEntry is an entry of the BomInfo variable
+type BOMInfoEntry struct {
+	Unknown0 uint32
+	Unknown1 uint32
+	Unknown2 uint32 // checksum ?
+	Unknown3 uint32
+}
 
-	if _, err := r.Seek(int64(elem.Address), 0); err != nil {
-		return err
-	}
+// BOMInfo is the BomInfo variable
+type BOMInfo struct {
+	Version             uint32
+	NumberOfPaths       uint32 // number of paths in the Paths tree (including directories)
+	NumberOfInfoEntries uint32
+	Entries             []BOMInfoEntry
+}
 
-	if err := binary.Read(r, binary.BigEndian, into); err != nil {
-		return err
-	}
+// BOMVIndex is the VIndex variable
+type BOMVIndex struct {
+	Unknown0     uint32 // always 1
+	IndexToVTree uint32
+	Unknown2     uint32 // always 0
+	Unknown3     uint8  // always 0
+	// Entries are the entries of the tree at IndexToVTree
+	Entries []BOMVIndexEntry `json:"entries,omitempty"`
+}
 
-	return nil
+// BOMVIndexEntry is an entry of the VIndex tree (its format is undocumented so the key and value blocks are kept raw)
+type BOMVIndexEntry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type vindex struct {
+	Unknown0     uint32
+	IndexToVTree uint32
+	Unknown2     uint32
+	Unknown3     uint8
 }
 
 type tree struct {
@@ -83,8 +111,8 @@ type paths struct {
 }
 
 type pathIndices struct {
-	Index0 uint32
-	Index1 uint32
+	Index0 uint32 // value
+	Index1 uint32 // key
 }
 
 type pathInfo1 struct {
@@ -101,54 +129,174 @@ type pathInfo2 struct {
 	Group          uint32
 	ModTime        uint32
 	Size           uint32
-	_              uint8 // unknown
-	Checksum       uint32
-	DevType        uint32
+	_              uint8  // unknown
+	Checksum       uint32 // device type for TypeDev
 	LinkNameLength uint32
+	// char linkName[]
 }
 
 var ErrInvalidFormat = errors.New("bom: invalid format")
 
-// Read returns os.FileInfo from an io.Reader
-func Read(r io.ReaderAt) ([]os.FileInfo, error) {
-	var header BOMHeader
+const (
+	TypeFile = 1
+	TypeDir  = 2
+	TypeLink = 3
+	TypeDev  = 4
+)
+
+// BOM is a parsed Bill of Materials (BOMStore) file
+type BOM struct {
+	Header BOMHeader  `json:"header"`
+	Info   *BOMInfo   `json:"info,omitempty"`
+	VIndex *BOMVIndex `json:"vindex,omitempty"`
+	// Files are the entries of the Paths tree
+	Files []*File `json:"files"`
+	// HardLinks are the groups of paths in the HLIndex tree
+	HardLinks [][]string `json:"hard_links,omitempty"`
+	// Vars are the block indexes of every BOM variable
+	Vars map[string]uint32 `json:"vars"`
+
+	blocks blockPointers
+	r      io.ReaderAt
+}
+
+// File is an entry of the BOM Paths tree
+type File struct {
+	ID       uint32    `json:"id"`
+	Parent   uint32    `json:"parent,omitempty"`
+	Path     string    `json:"path"`
+	Type     uint8     `json:"type"`
+	Arch     uint16    `json:"arch,omitempty"`
+	Perms    uint16    `json:"mode"` // unix st_mode
+	Uid      uint32    `json:"uid"`
+	Gid      uint32    `json:"gid"`
+	Modified time.Time `json:"mod_time"`
+	Size64   uint64    `json:"size"`
+	Checksum uint32    `json:"checksum,omitempty"` // CRC32 (cksum) of the file data
+	DevType  uint32    `json:"dev_type,omitempty"`
+	LinkName string    `json:"link_name,omitempty"`
+}
+
+// Name returns the full path of the file
+func (f *File) Name() string {
+	return f.Path
+}
+
+// Size returns the size of the file
+func (f *File) Size() int64 {
+	return int64(f.Size64)
+}
+
+// Mode returns the file mode
+func (f *File) Mode() os.FileMode {
+	mode := os.FileMode(f.Perms & 0777)
+	switch f.Perms & 0170000 {
+	case 0040000:
+		mode |= os.ModeDir
+	case 0120000:
+		mode |= os.ModeSymlink
+	case 0020000:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case 0060000:
+		mode |= os.ModeDevice
+	case 0010000:
+		mode |= os.ModeNamedPipe
+	case 0140000:
+		mode |= os.ModeSocket
+	}
+	if f.Perms&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if f.Perms&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if f.Perms&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// ModTime returns the modification time of the file
+func (f *File) ModTime() time.Time {
+	return f.Modified
+}
+
+// IsDir returns true if the file is a directory
+func (f *File) IsDir() bool {
+	return f.Type == TypeDir
+}
+
+// Sys returns the *File itself
+func (f *File) Sys() interface{} {
+	return f
+}
+
+// String returns the file as a lsbom line
+func (f *File) String() string {
+	path := f.Path
+	if path != "." {
+		path = "./" + path
+	}
+	switch f.Type {
+	case TypeDir:
+		return fmt.Sprintf("%s\t%o\t%d/%d", path, f.Perms, f.Uid, f.Gid)
+	case TypeLink:
+		return fmt.Sprintf("%s\t%o\t%d/%d\t%d\t%d\t%s", path, f.Perms, f.Uid, f.Gid, f.Size64, f.Checksum, f.LinkName)
+	case TypeDev:
+		return fmt.Sprintf("%s\t%o\t%d/%d\t%d", path, f.Perms, f.Uid, f.Gid, f.DevType)
+	default:
+		return fmt.Sprintf("%s\t%o\t%d/%d\t%d\t%d", path, f.Perms, f.Uid, f.Gid, f.Size64, f.Checksum)
+	}
+}
+
+// Open opens the named BOM file
+func Open(name string) (*BOM, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(bytes.NewReader(data))
+}
+
+// Parse parses every variable of the BOM in r
+func Parse(r io.ReaderAt) (*BOM, error) {
+	b := &BOM{
+		Vars: make(map[string]uint32),
+		r:    r,
+	}
+
 	br := io.NewSectionReader(r, 0, 1<<63-1)
-	if err := binary.Read(br, binary.BigEndian, &header); err != nil {
+	if err := binary.Read(br, binary.BigEndian, &b.Header); err != nil {
 		return nil, err
 	}
 
-	if string(header.Magic[0:]) != "BOMStore" {
+	if string(b.Header.Magic[0:]) != "BOMStore" {
 		return nil, ErrInvalidFormat
 	}
 
-	if _, err := br.Seek(int64(header.IndexOffset), io.SeekStart); err != nil {
+	if _, err := br.Seek(int64(b.Header.IndexOffset), io.SeekStart); err != nil {
 		return nil, err
 	}
 
 	var numBlockTablePointers uint32
-
 	if err := binary.Read(br, binary.BigEndian, &numBlockTablePointers); err != nil {
 		return nil, err
 	}
 
-	blockPointers := make(blockPointers, numBlockTablePointers)
-
-	if err := binary.Read(br, binary.BigEndian, &blockPointers); err != nil {
+	b.blocks = make(blockPointers, numBlockTablePointers)
+	if err := binary.Read(br, binary.BigEndian, &b.blocks); err != nil {
 		return nil, err
 	}
 
-	if _, err := br.Seek(int64(header.VarsOffset), 0); err != nil {
+	if _, err := br.Seek(int64(b.Header.VarsOffset), io.SeekStart); err != nil {
 		return nil, err
 	}
 
 	var numVars uint32
-
 	if err := binary.Read(br, binary.BigEndian, &numVars); err != nil {
 		return nil, err
 	}
 
-	fileInfo := make([]os.FileInfo, 0)
-
 	for i := 0; i < int(numVars); i++ {
 		var index uint32
 		var length uint8
@@ -156,181 +304,320 @@ func Read(r io.ReaderAt) ([]os.FileInfo, error) {
 		if err := binary.Read(br, binary.BigEndian, &index); err != nil {
 			return nil, err
 		}
-
 		if err := binary.Read(br, binary.BigEndian, &length); err != nil {
 			return nil, err
 		}
 
 		name := make([]byte, length)
-
 		if err := binary.Read(br, binary.BigEndian, &name); err != nil {
 			return nil, err
 		}
 
-		if strings.Contains(string(name[:]), "Paths") {
-			var tree tree
-
-			if err := blockPointers.lookup(br, int(index), &tree); err != nil {
-				return nil, err
-			}
-
-			var paths paths
+		b.Vars[string(name)] = index
+	}
 
-			if err := blockPointers.lookup(br, int(tree.Child), &paths); err != nil {
-				return nil, err
-			}
+	if index, ok := b.Vars["BomInfo"]; ok {
+		if err := b.parseInfo(index); err != nil {
+			return nil, fmt.Errorf("failed to parse BomInfo: %v", err)
+		}
+	}
+	if index, ok := b.Vars["Paths"]; ok {
+		if err := b.parsePaths(index); err != nil {
+			return nil, fmt.Errorf("failed to parse Paths: %v", err)
+		}
+	}
+	if index, ok := b.Vars["Size64"]; ok {
+		if err := b.parseSize64(index); err != nil {
+			return nil, fmt.Errorf("failed to parse Size64: %v", err)
+		}
+	}
+	if index, ok := b.Vars["HLIndex"]; ok {
+		if err := b.parseHLIndex(index); err != nil {
+			return nil, fmt.Errorf("failed to parse HLIndex: %v", err)
+		}
+	}
+	if index, ok := b.Vars["VIndex"]; ok {
+		if err := b.parseVIndex(index); err != nil {
+			return nil, fmt.Errorf("failed to parse VIndex: %v", err)
+		}
+	}
 
-			indices := make([]pathIndices, paths.Count)
+	return b, nil
+}
 
-			if err := binary.Read(br, binary.BigEndian, &indices); err != nil {
-				return nil, err
-			}
+// Read returns os.FileInfo from an io.Reader
+func Read(r io.ReaderAt) ([]os.FileInfo, error) {
+	b, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
 
-			for paths.IsLeaf == 0 {
-				if err := blockPointers.lookup(br, int(indices[0].Index0), &paths); err != nil {
-					return nil, err
-				}
+	fileInfo := make([]os.FileInfo, 0, len(b.Files))
+	for _, f := range b.Files {
+		fileInfo = append(fileInfo, f)
+	}
 
-				indices = make([]pathIndices, paths.Count)
+	return fileInfo, nil
+}
 
-				if err := binary.Read(br, binary.BigEndian, &indices); err != nil {
-					return nil, err
-				}
-			}
+// block returns the data of the block at index i
+func (b *BOM) block(i uint32) ([]byte, error) {
+	if int(i) >= len(b.blocks) {
+		return nil, fmt.Errorf("block index %d out of range (%d blocks)", i, len(b.blocks))
+	}
+	data := make([]byte, b.blocks[i].Length)
+	if _, err := b.r.ReadAt(data, int64(b.blocks[i].Address)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
 
-			parents := make(map[uint32]uint32)
-			filepaths := make(map[uint32]string)
+func (b *BOM) read(i uint32, into interface{}) error {
+	data, err := b.block(i)
+	if err != nil {
+		return err
+	}
+	return binary.Read(bytes.NewReader(data), binary.BigEndian, into)
+}
 
-			for {
-				for j := 0; j < int(paths.Count); j++ {
-					index0 := indices[j].Index0
-					index1 := indices[j].Index1
+// walkTree calls fn with the key and value block indexes of every leaf entry of the tree at index
+func (b *BOM) walkTree(index uint32, fn func(key, value uint32) error) error {
+	var t tree
+	if err := b.read(index, &t); err != nil {
+		return err
+	}
+	if string(t.Tree[:]) != "tree" {
+		return ErrInvalidFormat
+	}
 
-					var parent uint32
+	readNode := func(i uint32) (*paths, []pathIndices, error) {
+		data, err := b.block(i)
+		if err != nil {
+			return nil, nil, err
+		}
+		r := bytes.NewReader(data)
+		var p paths
+		if err := binary.Read(r, binary.BigEndian, &p); err != nil {
+			return nil, nil, err
+		}
+		indices := make([]pathIndices, p.Count)
+		if err := binary.Read(r, binary.BigEndian, &indices); err != nil {
+			return nil, nil, err
+		}
+		return &p, indices, nil
+	}
 
-					if err := blockPointers.lookup(br, int(index1), &parent); err != nil {
-						return nil, err
-					}
+	p, indices, err := readNode(t.Child)
+	if err != nil {
+		return err
+	}
 
-					name, err := readString(br)
+	for p.IsLeaf == 0 {
+		if len(indices) == 0 {
+			return nil
+		}
+		if p, indices, err = readNode(indices[0].Index0); err != nil {
+			return err
+		}
+	}
 
-					if err != nil {
-						return nil, err
-					}
+	for {
+		for _, idx := range indices {
+			if err := fn(idx.Index1, idx.Index0); err != nil {
+				return err
+			}
+		}
+		if p.Forward == 0 {
+			return nil
+		}
+		if p, indices, err = readNode(p.Forward); err != nil {
+			return err
+		}
+	}
+}
 
-					var pathInfo1 pathInfo1
+func (b *BOM) parseInfo(index uint32) error {
+	data, err := b.block(index)
+	if err != nil {
+		return err
+	}
+	r := bytes.NewReader(data)
 
-					if err := blockPointers.lookup(br, int(index0), &pathInfo1); err != nil {
-						return nil, err
-					}
+	b.Info = &BOMInfo{}
+	if err := binary.Read(r, binary.BigEndian, &b.Info.Version); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &b.Info.NumberOfPaths); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &b.Info.NumberOfInfoEntries); err != nil {
+		return err
+	}
+	b.Info.Entries = make([]BOMInfoEntry, b.Info.NumberOfInfoEntries)
 
-					var pathInfo2 pathInfo2
+	return binary.Read(r, binary.BigEndian, &b.Info.Entries)
+}
 
-					if err := blockPointers.lookup(br, int(pathInfo1.Index), &pathInfo2); err != nil {
-						return nil, err
-					}
+func (b *BOM) parsePaths(index uint32) error {
+	parents := make(map[uint32]uint32)
+	filepaths := make(map[uint32]string)
 
-					if parent > 0 {
-						parents[pathInfo1.ID] = parent
-						filepaths[pathInfo1.ID] = name
-					}
+	return b.walkTree(index, func(key, value uint32) error {
+		kdata, err := b.block(key)
+		if err != nil {
+			return err
+		}
+		if len(kdata) < 4 {
+			return ErrInvalidFormat
+		}
+		parent := binary.BigEndian.Uint32(kdata)
+		name := string(kdata[4:])
+		if i := bytes.IndexByte(kdata[4:], 0); i >= 0 {
+			name = string(kdata[4 : 4+i])
+		}
 
-					for parentID := parent; parentID > 0; parentID = parents[parentID] {
-						name = filepath.Join(filepaths[parentID], name)
-					}
+		var pi1 pathInfo1
+		if err := b.read(value, &pi1); err != nil {
+			return err
+		}
 
-					f := &bomFile{
-						id:      int(pathInfo1.ID),
-						name:    name,
-						parent:  int(parent),
-						mode:    os.FileMode(pathInfo2.Mode),
-						isDir:   pathInfo2.Type == TypeDir,
-						modTime: time.Unix(int64(pathInfo2.ModTime), 0),
-						size:    int64(pathInfo2.Size),
-					}
+		idata, err := b.block(pi1.Index)
+		if err != nil {
+			return err
+		}
+		r := bytes.NewReader(idata)
+		var pi2 pathInfo2
+		if err := binary.Read(r, binary.BigEndian, &pi2); err != nil {
+			return err
+		}
 
-					fileInfo = append(fileInfo, f)
-				}
+		if parent > 0 {
+			parents[pi1.ID] = parent
+			filepaths[pi1.ID] = name
+		}
 
-				if paths.Forward == 0 {
-					break
-				} else {
-					err := blockPointers.lookup(br, int(paths.Forward), &paths)
+		for parentID := parent; parentID > 0; parentID = parents[parentID] {
+			name = filepath.Join(filepaths[parentID], name)
+		}
 
-					if err != nil {
-						return nil, err
-					}
+		f := &File{
+			ID:       pi1.ID,
+			Parent:   parent,
+			Path:     name,
+			Type:     pi2.Type,
+			Arch:     pi2.Architecture,
+			Perms:    pi2.Mode,
+			Uid:      pi2.User,
+			Gid:      pi2.Group,
+			Modified: time.Unix(int64(pi2.ModTime), 0),
+			Size64:   uint64(pi2.Size),
+		}
 
-					indices = make([]pathIndices, paths.Count)
+		switch pi2.Type {
+		case TypeDev:
+			f.DevType = pi2.Checksum
+		default:
+			f.Checksum = pi2.Checksum
+		}
 
-					if err := binary.Read(br, binary.BigEndian, &indices); err != nil {
-						return nil, err
-					}
-				}
+		if pi2.Type == TypeLink && pi2.LinkNameLength > 0 {
+			link := make([]byte, pi2.LinkNameLength)
+			if _, err := io.ReadFull(r, link); err != nil {
+				return fmt.Errorf("failed to read link name of %s: %v", name, err)
 			}
+			f.LinkName = string(bytes.TrimRight(link, "\x00"))
 		}
-	}
 
-	return fileInfo, nil
-}
+		b.Files = append(b.Files, f)
 
-func readString(r io.Reader) (string, error) {
-	var b byte
-	var str string
+		return nil
+	})
+}
 
-	for {
-		err := binary.Read(r, binary.BigEndian, &b)
+// parseSize64 applies the 64bit sizes of files larger than 4GB
+func (b *BOM) parseSize64(index uint32) error {
+	sizes := make(map[uint32]uint64)
 
-		if err != nil {
-			return str, err
+	if err := b.walkTree(index, func(key, value uint32) error {
+		var id uint32
+		if err := b.read(key, &id); err != nil {
+			return err
 		}
-
-		if b == '\x00' {
-			return str, nil
+		var size uint64
+		if err := b.read(value, &size); err != nil {
+			return err
 		}
-
-		str += string(b)
+		sizes[id] = size
+		return nil
+	}); err != nil {
+		return err
 	}
-}
 
-const (
-	TypeFile = 1
-	TypeDir  = 2
-	TypeLink = 3
-	TypeDev  = 4
-)
-
-type bomFile struct {
-	id      int
-	name    string
-	size    int64
-	mode    os.FileMode
-	modTime time.Time
-	isDir   bool
-
-	parent int
-}
-
-func (b *bomFile) Name() string {
-	return b.name
-}
+	for _, f := range b.Files {
+		if size, ok := sizes[f.ID]; ok {
+			f.Size64 = size
+		}
+	}
 
-func (b *bomFile) Size() int64 {
-	return b.size
+	return nil
 }
 
-func (b *bomFile) Mode() os.FileMode {
-	return b.mode
-}
+// parseHLIndex parses the hard link groups, each entry's value is a tree of the paths sharing an inode
+func (b *BOM) parseHLIndex(index uint32) error {
+	byID := make(map[uint32]string, len(b.Files))
+	for _, f := range b.Files {
+		byID[f.ID] = f.Path
+	}
 
-func (b *bomFile) ModTime() time.Time {
-	return b.modTime
+	return b.walkTree(index, func(key, value uint32) error {
+		var links []string
+		if err := b.walkTree(value, func(k, _ uint32) error {
+			data, err := b.block(k)
+			if err != nil {
+				return err
+			}
+			if len(data) == 4 { // file ID
+				if path, ok := byID[binary.BigEndian.Uint32(data)]; ok {
+					links = append(links, path)
+					return nil
+				}
+			}
+			links = append(links, string(bytes.TrimRight(data, "\x00")))
+			return nil
+		}); err != nil {
+			return err
+		}
+		if len(links) > 0 {
+			sort.Strings(links)
+			b.HardLinks = append(b.HardLinks, links)
+		}
+		return nil
+	})
 }
 
-func (b *bomFile) IsDir() bool {
-	return b.isDir
-}
+// parseVIndex parses the VIndex variable and walks its tree
+func (b *BOM) parseVIndex(index uint32) error {
+	var vi vindex
+	if err := b.read(index, &vi); err != nil {
+		return err
+	}
+	b.VIndex = &BOMVIndex{
+		Unknown0:     vi.Unknown0,
+		IndexToVTree: vi.IndexToVTree,
+		Unknown2:     vi.Unknown2,
+		Unknown3:     vi.Unknown3,
+	}
 
-func (b *bomFile) Sys() interface{} {
-	return nil
+	return b.walkTree(vi.IndexToVTree, func(key, value uint32) error {
+		k, err := b.block(key)
+		if err != nil {
+			return err
+		}
+		v, err := b.block(value)
+		if err != nil {
+			return err
+		}
+		b.VIndex.Entries = append(b.VIndex.Entries, BOMVIndexEntry{Key: k, Value: v})
+		return nil
+	})
 }
@@ -0,0 +1,161 @@
+package bom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testBOM builds a BOMStore from its blocks (block 0 is the null block) and variables
+type testBOM struct {
+	blocks [][]byte
+	vars   []string
+	index  []uint32
+}
+
+func (t *testBOM) add(v ...interface{}) uint32 {
+	var buf bytes.Buffer
+	for _, data := range v {
+		binary.Write(&buf, binary.BigEndian, data)
+	}
+	t.blocks = append(t.blocks, buf.Bytes())
+	return uint32(len(t.blocks))
+}
+
+// addTree adds a tree with a single leaf node of the key/value pairs
+func (t *testBOM) addTree(kvs ...uint32) uint32 {
+	var indices []pathIndices
+	for i := 0; i < len(kvs); i += 2 {
+		indices = append(indices, pathIndices{Index0: kvs[i+1], Index1: kvs[i]})
+	}
+	leaf := t.add(paths{IsLeaf: 1, Count: uint16(len(indices))}, indices)
+	return t.add(tree{Tree: [4]byte{'t', 'r', 'e', 'e'}, Version: 1, Child: leaf, BlockSize: 4096, PathCount: uint32(len(indices))})
+}
+
+func (t *testBOM) addVar(name string, index uint32) {
+	t.vars = append(t.vars, name)
+	t.index = append(t.index, index)
+}
+
+// addFile adds a Paths tree key and value for a file
+func (t *testBOM) addFile(id, parent uint32, name string, info pathInfo2, linkName string) (uint32, uint32) {
+	key := t.add(parent, []byte(name+"\x00"))
+	pi2 := t.add(info, []byte(linkName))
+	return key, t.add(pathInfo1{ID: id, Index: pi2})
+}
+
+func (t *testBOM) bytes() []byte {
+	var data bytes.Buffer
+	hdrSize := binary.Size(BOMHeader{})
+	ptrs := []BOMPointer{{}}
+	for _, blk := range t.blocks {
+		ptrs = append(ptrs, BOMPointer{Address: uint32(hdrSize + data.Len()), Length: uint32(len(blk))})
+		data.Write(blk)
+	}
+
+	var index bytes.Buffer
+	binary.Write(&index, binary.BigEndian, uint32(len(ptrs)))
+	binary.Write(&index, binary.BigEndian, ptrs)
+
+	var vars bytes.Buffer
+	binary.Write(&vars, binary.BigEndian, uint32(len(t.vars)))
+	for i, name := range t.vars {
+		binary.Write(&vars, binary.BigEndian, t.index[i])
+		vars.WriteByte(byte(len(name)))
+		vars.WriteString(name)
+	}
+
+	hdr := BOMHeader{
+		Version:        1,
+		NumberOfBlocks: uint32(len(ptrs)),
+		IndexOffset:    uint32(hdrSize + data.Len()),
+		IndexLength:    uint32(index.Len()),
+		VarsOffset:     uint32(hdrSize + data.Len() + index.Len()),
+		VarsLength:     uint32(vars.Len()),
+	}
+	copy(hdr.Magic[:], "BOMStore")
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, hdr)
+	data.WriteTo(&out)
+	index.WriteTo(&out)
+	vars.WriteTo(&out)
+	return out.Bytes()
+}
+
+func newTestBOM(size uint32, checksum uint32) *testBOM {
+	var t testBOM
+	dirKey, dirValue := t.addFile(1, 0, ".", pathInfo2{Type: TypeDir, Mode: 040755}, "")
+	binKey, binValue := t.addFile(2, 1, "bin", pathInfo2{Type: TypeDir, Mode: 040755}, "")
+	lsKey, lsValue := t.addFile(3, 2, "ls", pathInfo2{Type: TypeFile, Mode: 0100755, ModTime: 1, Size: size, Checksum: checksum}, "")
+	shKey, shValue := t.addFile(4, 2, "sh", pathInfo2{Type: TypeLink, Mode: 0120755, LinkNameLength: 3}, "ls\x00")
+	t.addVar("Paths", t.addTree(dirKey, dirValue, binKey, binValue, lsKey, lsValue, shKey, shValue))
+	t.addVar("VIndex", t.add(vindex{Unknown0: 1, IndexToVTree: t.addTree(t.add([]byte("key")), t.add([]byte("value")))}))
+	return &t
+}
+
+func TestParse(t *testing.T) {
+	b, err := Parse(bytes.NewReader(newTestBOM(42, 1234).bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range b.Files {
+		got = append(got, f.String())
+	}
+	want := []string{
+		".\t40755\t0/0",
+		"./bin\t40755\t0/0",
+		"./bin/ls\t100755\t0/0\t42\t1234",
+		"./bin/sh\t120755\t0/0\t0\t0\tls",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() files = %q (expected %q)", got, want)
+	}
+	if ls := b.Files[2]; !ls.ModTime().Equal(time.Unix(1, 0)) || ls.Mode() != 0755 || ls.Size() != 42 {
+		t.Errorf("bin/ls mod time %v, mode %v, size %d (expected %v, %v, 42)", ls.ModTime(), ls.Mode(), ls.Size(), time.Unix(1, 0), 0755)
+	}
+
+	wantVIndex := &BOMVIndex{Unknown0: 1, IndexToVTree: b.VIndex.IndexToVTree, Entries: []BOMVIndexEntry{{Key: []byte("key"), Value: []byte("value")}}}
+	if !reflect.DeepEqual(b.VIndex, wantVIndex) {
+		t.Errorf("Parse() VIndex = %+v (expected %+v)", b.VIndex, wantVIndex)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	data := newTestBOM(42, 1234).bytes()
+	copy(data, "BOMStorX")
+	if _, err := Parse(bytes.NewReader(data)); err != ErrInvalidFormat {
+		t.Errorf("Parse() with a bad magic error = %v (expected %v)", err, ErrInvalidFormat)
+	}
+	if _, err := Parse(bytes.NewReader(data[:16])); err == nil {
+		t.Errorf("Parse() of a truncated header succeeded")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	oldBOM, err := Parse(bytes.NewReader(newTestBOM(42, 1234).bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newBOM, err := Parse(bytes.NewReader(newTestBOM(43, 5678).bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bin/sh is removed and bin/zsh is added
+	newBOM.Files = append(newBOM.Files[:3], &File{Path: "bin/zsh", Type: TypeFile})
+
+	res := Diff(oldBOM, newBOM)
+	if len(res.Added) != 1 || res.Added[0].Path != "bin/zsh" {
+		t.Errorf("Diff() added = %v (expected [bin/zsh])", res.Added)
+	}
+	if len(res.Removed) != 1 || res.Removed[0].Path != "bin/sh" {
+		t.Errorf("Diff() removed = %v (expected [bin/sh])", res.Removed)
+	}
+	if len(res.Changed) != 1 || res.Changed[0].String() != "bin/ls\t(size 42 -> 43, checksum 1234 -> 5678)" {
+		t.Errorf("Diff() changed = %v (expected [bin/ls (size 42 -> 43, checksum 1234 -> 5678)])", res.Changed)
+	}
+}
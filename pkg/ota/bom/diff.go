@@ -0,0 +1,85 @@
+package bom
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Change is a file present in both BOMs whose metadata differs
+type Change struct {
+	Path string `json:"path"`
+	Old  *File  `json:"old"`
+	New  *File  `json:"new"`
+}
+
+// String returns the changed fields of the file
+func (c Change) String() string {
+	var changes []string
+	if c.Old.Type != c.New.Type {
+		changes = append(changes, fmt.Sprintf("type %d -> %d", c.Old.Type, c.New.Type))
+	}
+	if c.Old.Perms != c.New.Perms {
+		changes = append(changes, fmt.Sprintf("mode %o -> %o", c.Old.Perms, c.New.Perms))
+	}
+	if c.Old.Uid != c.New.Uid || c.Old.Gid != c.New.Gid {
+		changes = append(changes, fmt.Sprintf("owner %d/%d -> %d/%d", c.Old.Uid, c.Old.Gid, c.New.Uid, c.New.Gid))
+	}
+	if c.Old.Size64 != c.New.Size64 {
+		changes = append(changes, fmt.Sprintf("size %d -> %d", c.Old.Size64, c.New.Size64))
+	}
+	if c.Old.Checksum != c.New.Checksum {
+		changes = append(changes, fmt.Sprintf("checksum %d -> %d", c.Old.Checksum, c.New.Checksum))
+	}
+	if c.Old.LinkName != c.New.LinkName {
+		changes = append(changes, fmt.Sprintf("link %s -> %s", c.Old.LinkName, c.New.LinkName))
+	}
+	if c.Old.DevType != c.New.DevType {
+		changes = append(changes, fmt.Sprintf("dev %d -> %d", c.Old.DevType, c.New.DevType))
+	}
+	return fmt.Sprintf("%s\t(%s)", c.Path, strings.Join(changes, ", "))
+}
+
+// DiffResult is the file-level difference between two BOMs
+type DiffResult struct {
+	Added   []*File  `json:"added,omitempty"`
+	Removed []*File  `json:"removed,omitempty"`
+	Changed []Change `json:"changed,omitempty"`
+}
+
+// Diff compares the files of the old and new BOMs (modification times are ignored)
+func Diff(oldBOM, newBOM *BOM) *DiffResult {
+	var res DiffResult
+
+	oldFiles := make(map[string]*File, len(oldBOM.Files))
+	for _, f := range oldBOM.Files {
+		oldFiles[f.Path] = f
+	}
+	newFiles := make(map[string]*File, len(newBOM.Files))
+	for _, f := range newBOM.Files {
+		newFiles[f.Path] = f
+	}
+
+	for _, nf := range newBOM.Files {
+		of, ok := oldFiles[nf.Path]
+		if !ok {
+			res.Added = append(res.Added, nf)
+			continue
+		}
+		if of.Type != nf.Type || of.Perms != nf.Perms || of.Uid != nf.Uid || of.Gid != nf.Gid ||
+			of.Size64 != nf.Size64 || of.Checksum != nf.Checksum || of.LinkName != nf.LinkName || of.DevType != nf.DevType {
+			res.Changed = append(res.Changed, Change{Path: nf.Path, Old: of, New: nf})
+		}
+	}
+	for _, of := range oldBOM.Files {
+		if _, ok := newFiles[of.Path]; !ok {
+			res.Removed = append(res.Removed, of)
+		}
+	}
+
+	sort.Slice(res.Added, func(i, j int) bool { return res.Added[i].Path < res.Added[j].Path })
+	sort.Slice(res.Removed, func(i, j int) bool { return res.Removed[i].Path < res.Removed[j].Path })
+	sort.Slice(res.Changed, func(i, j int) bool { return res.Changed[i].Path < res.Changed[j].Path })
+
+	return &res
+}
@@ -0,0 +1,179 @@
+// Package bxdiff applies the BXDIFF50 binary patches found in incremental (delta) OTAs.
+//
+// BXDIFF50 is a bsdiff variant; after the header come the compressed control,
+// diff and extra sections. The control section is a list of (add, copy, seek)
+// triples: add bytes of the diff section are added to the source, copy bytes
+// of the extra section are copied verbatim and then the source is seeked.
+package bxdiff
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/blacktop/ipsw/pkg/lzma"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+)
+
+// Magic is the magic of a BXDIFF50 patch
+const Magic = "BXDIFF50"
+
+// Header is the BXDIFF50 patch header
+type Header struct {
+	Magic       [8]byte
+	Unknown1    uint64
+	PatchedSize uint64 // size of the patched file
+	ControlSize uint64 // compressed size of the control section
+	Unknown2    uint64
+	DiffSize    uint64   // compressed size of the diff section
+	PatchedHash [20]byte // SHA1 of the patched file
+	SourceHash  [20]byte // SHA1 of the source file
+}
+
+type control struct {
+	Add  int64 // bytes to add from the diff section
+	Copy int64 // bytes to copy from the extra section
+	Seek int64 // bytes to seek in the source
+}
+
+var (
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// IsPatch returns true if data starts with the BXDIFF50 magic
+func IsPatch(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// ParseHeader parses the BXDIFF50 header at the start of patch
+func ParseHeader(patch []byte) (*Header, error) {
+	var hdr Header
+	if err := binary.Read(bytes.NewReader(patch), binary.LittleEndian, &hdr); err != nil {
+		return nil, errors.Wrap(err, "failed to read BXDIFF50 header")
+	}
+	if string(hdr.Magic[:]) != Magic {
+		return nil, fmt.Errorf("invalid BXDIFF50 magic: %q", hdr.Magic[:])
+	}
+	return &hdr, nil
+}
+
+// Patch applies the BXDIFF50 patch to the source file src writing the patched file to w
+func Patch(src io.ReaderAt, patch []byte, w io.Writer) error {
+	hdr, err := ParseHeader(patch)
+	if err != nil {
+		return err
+	}
+
+	off := uint64(binary.Size(hdr))
+	if off+hdr.ControlSize+hdr.DiffSize > uint64(len(patch)) {
+		return fmt.Errorf("BXDIFF50 sections (control %#x, diff %#x) exceed patch size %#x", hdr.ControlSize, hdr.DiffSize, len(patch))
+	}
+	ctrlData := patch[off : off+hdr.ControlSize]
+	diffData := patch[off+hdr.ControlSize : off+hdr.ControlSize+hdr.DiffSize]
+	extraData := patch[off+hdr.ControlSize+hdr.DiffSize:]
+
+	cr, err := newSectionReader(ctrlData)
+	if err != nil {
+		return errors.Wrap(err, "failed to decompress control section")
+	}
+	ctrl, err := ioutil.ReadAll(cr)
+	if err != nil {
+		return errors.Wrap(err, "failed to decompress control section")
+	}
+	dr, err := newSectionReader(diffData)
+	if err != nil {
+		return errors.Wrap(err, "failed to decompress diff section")
+	}
+	er, err := newSectionReader(extraData)
+	if err != nil {
+		return errors.Wrap(err, "failed to decompress extra section")
+	}
+
+	h := sha1.New()
+	out := io.MultiWriter(w, h)
+
+	var written uint64
+	var srcPos int64
+	buf := make([]byte, 64*1024)
+	old := make([]byte, 64*1024)
+
+	for r := bytes.NewReader(ctrl); r.Len() >= 24 && written < hdr.PatchedSize; {
+		var c control
+		for _, v := range []*int64{&c.Add, &c.Copy, &c.Seek} {
+			var raw uint64
+			binary.Read(r, binary.LittleEndian, &raw)
+			*v = offtin(raw)
+		}
+		if c.Add < 0 || c.Copy < 0 || written+uint64(c.Add)+uint64(c.Copy) > hdr.PatchedSize {
+			return fmt.Errorf("corrupt BXDIFF50 control entry: add=%d copy=%d seek=%d", c.Add, c.Copy, c.Seek)
+		}
+
+		// add the diff bytes to the source bytes
+		for left := c.Add; left > 0; {
+			n := int64(len(buf))
+			if left < n {
+				n = left
+			}
+			if _, err := io.ReadFull(dr, buf[:n]); err != nil {
+				return errors.Wrap(err, "failed to read diff section")
+			}
+			m, err := src.ReadAt(old[:n], srcPos)
+			if err != nil && err != io.EOF {
+				return errors.Wrap(err, "failed to read source file")
+			}
+			for i := 0; i < m; i++ { // bytes past the end of the source are taken as is
+				buf[i] += old[i]
+			}
+			if _, err := out.Write(buf[:n]); err != nil {
+				return err
+			}
+			srcPos += n
+			left -= n
+		}
+
+		// copy the extra bytes
+		if _, err := io.CopyN(out, er, c.Copy); err != nil {
+			return errors.Wrap(err, "failed to read extra section")
+		}
+
+		written += uint64(c.Add + c.Copy)
+		srcPos += c.Seek
+	}
+
+	if written != hdr.PatchedSize {
+		return fmt.Errorf("patched size %#x does not match expected size %#x", written, hdr.PatchedSize)
+	}
+	if hdr.PatchedHash != [20]byte{} && !bytes.Equal(h.Sum(nil), hdr.PatchedHash[:]) {
+		return fmt.Errorf("patched file SHA1 %x does not match expected %x", h.Sum(nil), hdr.PatchedHash)
+	}
+
+	return nil
+}
+
+// offtin decodes a bsdiff sign-magnitude integer
+func offtin(v uint64) int64 {
+	if v&(1<<63) != 0 {
+		return -int64(v &^ (1 << 63))
+	}
+	return int64(v)
+}
+
+// newSectionReader decompresses a bzip2, xz or LZMA compressed patch section
+func newSectionReader(data []byte) (io.Reader, error) {
+	switch {
+	case len(data) == 0:
+		return bytes.NewReader(nil), nil
+	case bytes.HasPrefix(data, bzip2Magic):
+		return bzip2.NewReader(bytes.NewReader(data)), nil
+	case bytes.HasPrefix(data, xzMagic):
+		return xz.NewReader(bytes.NewReader(data))
+	default:
+		return lzma.NewReader(bytes.NewReader(data)), nil
+	}
+}
@@ -0,0 +1,90 @@
+package bxdiff
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/blacktop/ipsw/pkg/lzma"
+	"github.com/ulikunitz/xz"
+)
+
+func compress(t *testing.T, data []byte, useXZ bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if useXZ {
+		xw, err := xz.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = xw
+	} else {
+		w = lzma.NewWriter(&buf)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// makePatch returns a BXDIFF50 patch of src into dst (adding all of src and copying the rest of dst)
+func makePatch(t *testing.T, src, dst []byte) []byte {
+	t.Helper()
+	var ctrl bytes.Buffer
+	binary.Write(&ctrl, binary.LittleEndian, []uint64{uint64(len(src)), uint64(len(dst) - len(src)), 0})
+	diff := make([]byte, len(src))
+	for i := range diff {
+		diff[i] = dst[i] - src[i]
+	}
+
+	ctrlData := compress(t, ctrl.Bytes(), true)
+	diffData := compress(t, diff, false)
+	hdr := Header{
+		PatchedSize: uint64(len(dst)),
+		ControlSize: uint64(len(ctrlData)),
+		DiffSize:    uint64(len(diffData)),
+		PatchedHash: sha1.Sum(dst),
+		SourceHash:  sha1.Sum(src),
+	}
+	copy(hdr.Magic[:], Magic)
+
+	var patch bytes.Buffer
+	binary.Write(&patch, binary.LittleEndian, hdr)
+	patch.Write(ctrlData)
+	patch.Write(diffData)
+	patch.Write(compress(t, dst[len(src):], false))
+	return patch.Bytes()
+}
+
+func TestPatch(t *testing.T) {
+	src := []byte("The quick brown fox jumps over the lazy dog")
+	dst := []byte("The quick brown cat jumps over the lazy dog and the sleepy owl")
+	patch := makePatch(t, src, dst)
+
+	if !IsPatch(patch) {
+		t.Fatalf("IsPatch() = false")
+	}
+	var out bytes.Buffer
+	if err := Patch(bytes.NewReader(src), patch, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), dst) {
+		t.Errorf("Patch() = %q (expected %q)", out.Bytes(), dst)
+	}
+
+	// patching the wrong source file fails the SHA1 check
+	if err := Patch(bytes.NewReader([]byte("The quick brown dog jumps over the lazy fox")), patch, ioutil.Discard); err == nil {
+		t.Errorf("Patch() of the wrong source succeeded")
+	}
+	// a truncated patch fails
+	if err := Patch(bytes.NewReader(src), patch[:binary.Size(Header{})+4], ioutil.Discard); err == nil {
+		t.Errorf("Patch() with a truncated patch succeeded")
+	}
+}
@@ -0,0 +1,164 @@
+package ota
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+	"github.com/blacktop/ipsw/pkg/ota/bxdiff"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// Patch rebuilds the files of a delta OTA by applying its BXDIFF50 patches to the files in baseDir
+// (the files shipped whole are copied as is)
+func Patch(otaZIP, baseDir, outputDir string) error {
+
+	zr, err := zip.OpenReader(otaZIP)
+	if err != nil {
+		return errors.Wrap(err, "failed to open ota zip")
+	}
+	defer zr.Close()
+
+	folder, err := getFolder(&zr.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to get folder for OTA: %v", err)
+	}
+	outputDir = filepath.Join(outputDir, folder)
+
+	var validPayload = regexp.MustCompile(`payloadv2/.*(patches|payload)`)
+
+	sortFileByNameAscend(zr.File)
+
+	patched := 0
+	for _, f := range zr.File {
+		if !validPayload.MatchString(f.Name) || f.FileInfo().IsDir() {
+			continue
+		}
+		utils.Indent(log.WithFields(log.Fields{
+			"filename": f.Name,
+			"size":     humanize.Bytes(f.UncompressedSize64),
+		}).Debug, 2)("Processing OTA payload")
+		n, err := patchPayload(f, baseDir, outputDir)
+		if err != nil {
+			return errors.Wrapf(err, "failed to patch %s", f.Name)
+		}
+		patched += n
+	}
+
+	if patched == 0 {
+		return fmt.Errorf("no BXDIFF50 patches found in %s", otaZIP)
+	}
+
+	return nil
+}
+
+func patchPayload(payload *zip.File, baseDir, outputDir string) (int, error) {
+	rc, err := payload.Open()
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to open file in zip: %s", payload.Name)
+	}
+	defer rc.Close()
+
+	pr, err := NewPayloadReader(rc, 0)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to read payload %s", payload.Name)
+	}
+	defer pr.Close()
+
+	patched := 0
+	yr := NewReader(pr)
+	for {
+		ent, data, err := yr.Next()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, ErrInvalidFormat) {
+			utils.Indent(log.Debug, 2)(fmt.Sprintf("Skipping %s: %v", payload.Name, err))
+			return 0, nil
+		}
+		if err != nil {
+			return patched, err
+		}
+		if ent.Type != RegularFile {
+			continue
+		}
+
+		fname := filepath.Join(outputDir, filepath.Clean(string(filepath.Separator)+ent.Path))
+
+		br := bufio.NewReader(data)
+		if magic, _ := br.Peek(len(bxdiff.Magic)); !bxdiff.IsPatch(magic) {
+			// the file is shipped whole
+			if err := writeFile(br, fname, ent.Mod); err != nil {
+				return patched, errors.Wrapf(err, "failed to write %s", ent.Path)
+			}
+			utils.Indent(log.Debug, 2)(fmt.Sprintf("Copied %s\t%s to %s", ent.Mod, ent.Path, fname))
+			continue
+		}
+
+		patch, err := ioutil.ReadAll(br)
+		if err != nil {
+			return patched, errors.Wrapf(err, "failed to read patch %s", ent.Path)
+		}
+
+		if err := applyPatch(filepath.Join(baseDir, filepath.Clean(string(filepath.Separator)+ent.Path)), patch, fname, ent.Mod); err != nil {
+			return patched, errors.Wrapf(err, "failed to patch %s", ent.Path)
+		}
+		utils.Indent(log.Info, 2)(fmt.Sprintf("Patched %s\t%s\t%s to %s", ent.Mod, humanize.Bytes(uint64(len(patch))), ent.Path, fname))
+		patched++
+	}
+
+	return patched, nil
+}
+
+func applyPatch(src string, patch []byte, dst string, mode os.FileMode) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return errors.Wrap(err, "failed to open base file")
+	}
+	defer sf.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0200)
+	if err != nil {
+		return err
+	}
+	defer df.Close()
+
+	w := bufio.NewWriter(df)
+	if err := bxdiff.Patch(sf, patch, w); err != nil {
+		df.Close()
+		os.Remove(dst)
+		return err
+	}
+
+	return w.Flush()
+}
+
+func writeFile(r io.Reader, dst string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+
+	df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0200)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(df, r); err != nil {
+		df.Close()
+		return err
+	}
+
+	return df.Close()
+}
@@ -0,0 +1,270 @@
+package ota
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+
+	"github.com/blacktop/ipsw/pkg/lzfse"
+	"github.com/blacktop/ipsw/pkg/lzma"
+	"github.com/pkg/errors"
+)
+
+const pbzxMagic = 0x70627a78
+
+// Apple Archive block compressed streams are framed as 'pbz' followed by the compression algorithm
+const (
+	pbzPrefix = "pbz"
+	pbzLZMA   = 'x' // pbzx: xz (or LZMA alone) chunks
+	pbzLZFSE  = 'e' // pbze: LZFSE (bvx2/bvxn/bvx-) chunks
+	pbzZlib   = 'z' // pbzz: zlib chunks
+	pbzLZ4    = '4' // pbz4: LZ4 chunks (unsupported)
+)
+
+type pbzxHeader struct {
+	Magic            uint32
+	UncompressedSize uint64
+}
+
+type pbzxChunkHeader struct {
+	Flags uint64 // uncompressed size of the chunk
+	Size  uint64 // compressed size of the chunk
+}
+
+// xzMagic is the magic of an xz stream header
+var xzMagic = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// pbzxReader decompresses the chunks of a pbzx (or pbze/pbzz) stream in parallel while
+// returning the decompressed data in order (keeping at most a few chunks in memory)
+type pbzxReader struct {
+	algo    byte
+	results chan chan chunkResult
+	done    chan struct{}
+	cur     []byte
+	err     error
+}
+
+// NewPbzxReader returns an io.ReadCloser that decompresses the pbzx, pbze or pbzz stream r using up to workers goroutines (0 uses every CPU)
+func NewPbzxReader(r io.Reader, workers int) (io.ReadCloser, error) {
+	var hdr pbzxHeader
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return nil, errors.Wrap(err, "failed to read pbzx header")
+	}
+	if hdr.Magic>>8 != pbzxMagic>>8 {
+		return nil, errors.New("src not a pbzx stream")
+	}
+
+	algo := byte(hdr.Magic)
+	switch algo {
+	case pbzLZMA, pbzLZFSE, pbzZlib:
+	case pbzLZ4:
+		return nil, errors.New("LZ4 compressed (pbz4) streams are not supported")
+	default:
+		return nil, fmt.Errorf("unsupported block compressed stream: %s%c", pbzPrefix, algo)
+	}
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	pr := &pbzxReader{
+		algo:    algo,
+		results: make(chan chan chunkResult, workers),
+		done:    make(chan struct{}),
+	}
+
+	go pr.produce(r, workers)
+
+	return pr, nil
+}
+
+func (pr *pbzxReader) produce(r io.Reader, workers int) {
+	defer close(pr.results)
+
+	sem := make(chan struct{}, workers)
+
+	for {
+		var chunk pbzxChunkHeader
+		if err := binary.Read(r, binary.BigEndian, &chunk); err != nil {
+			if err != io.EOF {
+				pr.send(chunkResult{err: errors.Wrap(err, "failed to read pbzx chunk header")})
+			}
+			return
+		}
+
+		data := make([]byte, chunk.Size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			pr.send(chunkResult{err: errors.Wrap(err, "failed to read pbzx chunk")})
+			return
+		}
+
+		res := make(chan chunkResult, 1)
+		select {
+		case pr.results <- res:
+		case <-pr.done:
+			return
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-pr.done:
+			return
+		}
+		go func(flags uint64, data []byte) {
+			defer func() { <-sem }()
+			res <- decodePbzxChunk(pr.algo, flags, data)
+		}(chunk.Flags, data)
+	}
+}
+
+func (pr *pbzxReader) send(res chunkResult) {
+	ch := make(chan chunkResult, 1)
+	ch <- res
+	select {
+	case pr.results <- ch:
+	case <-pr.done:
+	}
+}
+
+func decodePbzxChunk(algo byte, size uint64, data []byte) chunkResult {
+	if uint64(len(data)) == size && !bytes.HasPrefix(data, xzMagic) { // chunk is stored uncompressed
+		return chunkResult{data: data}
+	}
+
+	var err error
+	var rc io.ReadCloser
+
+	switch algo {
+	case pbzLZMA:
+		if !bytes.HasPrefix(data, xzMagic) {
+			if !isLZMAAlone(data) { // chunk is stored uncompressed
+				return chunkResult{data: data}
+			}
+			rc = lzma.NewReader(bytes.NewReader(data))
+		} else if rc, err = NewXZReader(bytes.NewReader(data)); err != nil {
+			return chunkResult{err: errors.Wrap(err, "failed to create xz reader")}
+		}
+	case pbzLZFSE:
+		dec, err := lzfse.NewDecoder(data).DecodeBuffer()
+		if err != nil {
+			return chunkResult{err: errors.Wrap(err, "failed to lzfse decompress chunk")}
+		}
+		return chunkResult{data: dec}
+	case pbzZlib:
+		if rc, err = newZlibReader(bytes.NewReader(data)); err != nil {
+			return chunkResult{err: errors.Wrap(err, "failed to create zlib reader")}
+		}
+	}
+	defer rc.Close()
+
+	out := bytes.NewBuffer(make([]byte, 0, size))
+	if _, err := io.Copy(out, rc); err != nil {
+		return chunkResult{err: errors.Wrap(err, "failed to decompress pbzx chunk")}
+	}
+
+	return chunkResult{data: out.Bytes()}
+}
+
+// isLZMAAlone checks for a valid LZMA alone header (properties byte, dictionary size and uncompressed size)
+func isLZMAAlone(data []byte) bool {
+	if len(data) < 13 {
+		return false
+	}
+	return data[0] < 9*5*5 && binary.LittleEndian.Uint32(data[1:]) >= 1<<12
+}
+
+// isZlib checks for a valid zlib stream header (CMF/FLG pair)
+func isZlib(data []byte) bool {
+	if len(data) < 2 {
+		return false
+	}
+	return data[0]&0x0f == 8 && data[0]>>4 <= 7 && binary.BigEndian.Uint16(data)%31 == 0
+}
+
+// newZlibReader reads a zlib stream or (as written by Apple's compression library) a raw deflate stream
+func newZlibReader(r io.Reader) (io.ReadCloser, error) {
+	var hdr [2]byte
+	n, _ := io.ReadFull(r, hdr[:])
+	mr := io.MultiReader(bytes.NewReader(hdr[:n]), r)
+	if isZlib(hdr[:n]) {
+		return zlib.NewReader(mr)
+	}
+	return flate.NewReader(mr), nil
+}
+
+func (pr *pbzxReader) Read(p []byte) (int, error) {
+	for len(pr.cur) == 0 {
+		if pr.err != nil {
+			return 0, pr.err
+		}
+		res, ok := <-pr.results
+		if !ok {
+			pr.err = io.EOF
+			continue
+		}
+		r := <-res
+		if r.err != nil {
+			pr.err = r.err
+			continue
+		}
+		pr.cur = r.data
+	}
+
+	n := copy(p, pr.cur)
+	pr.cur = pr.cur[n:]
+
+	return n, nil
+}
+
+// Close stops the decompression pipeline
+func (pr *pbzxReader) Close() error {
+	select {
+	case <-pr.done:
+	default:
+		close(pr.done)
+	}
+	return nil
+}
+
+// NewPayloadReader returns a reader over the Apple Archive inside an OTA payload
+// (block compressed pbzx/pbze/pbzz, LZFSE, xz, zlib or raw)
+func NewPayloadReader(r io.Reader, workers int) (io.ReadCloser, error) {
+	var magic [6]byte
+	n, err := io.ReadFull(r, magic[:])
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read payload magic: %v", err)
+	}
+
+	mr := io.MultiReader(bytes.NewReader(magic[:n]), r)
+
+	switch {
+	case bytes.HasPrefix(magic[:n], []byte(pbzPrefix)):
+		return NewPbzxReader(mr, workers)
+	case bytes.HasPrefix(magic[:n], []byte("bvx")):
+		data, err := ioutil.ReadAll(mr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lzfse payload: %v", err)
+		}
+		dec, err := lzfse.NewDecoder(data).DecodeBuffer()
+		if err != nil {
+			return nil, fmt.Errorf("failed to lzfse decompress payload: %v", err)
+		}
+		return ioutil.NopCloser(bytes.NewReader(dec)), nil
+	case bytes.HasPrefix(magic[:n], xzMagic):
+		return NewXZReader(mr)
+	case isZlib(magic[:n]):
+		return zlib.NewReader(mr)
+	}
+
+	return ioutil.NopCloser(mr), nil
+}
@@ -0,0 +1,491 @@
+package ota
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/blacktop/ipsw/internal/utils"
+)
+
+const (
+	yaa1Header = 0x31414159 // YAA1
+	aa01Header = 0x31304141 // AA01
+)
+
+// ErrInvalidFormat is returned by Reader.Next when the stream does NOT start with a YAA/AA (or legacy) entry
+var ErrInvalidFormat = errors.New("ota: not an Apple Archive")
+
+// legacyEntry is the pre iOS 14.x OTA payload entry header
+type legacyEntry struct {
+	Usually_0x210Or_0x110 uint32
+	Usually_0x00_00       uint16 //_00_00;
+	FileSize              uint32
+	ModTime               uint64
+	Whatever              uint16
+	Usually_0x20          uint16
+	NameLen               uint16
+	Uid                   uint16
+	Gid                   uint16
+	Perms                 uint16
+	//  char name[0];
+	// Followed by file contents
+}
+
+type entryType byte
+
+const (
+	BlockSpecial     entryType = 'B'
+	CharacterSpecial entryType = 'C'
+	Directory        entryType = 'D'
+	RegularFile      entryType = 'F'
+	SymbolicLink     entryType = 'L'
+	Metadata         entryType = 'M'
+	Fifo             entryType = 'P'
+	Socket           entryType = 'S'
+)
+
+// Entry is a YAA entry type
+type Entry struct {
+	Type entryType   // entry type
+	Path string      // entry path
+	Link string      // link path
+	Name string      // entry name
+	Uid  uint32      // user id
+	Gid  uint32      // group id
+	Mod  fs.FileMode // access mode
+	Flag uint32      // BSD flags
+	Dev  uint32      // device id
+	Ino  uint64      // inode number
+	Hlc  uint64      // hard link cluster id
+	Clc  uint64      // clone cluster id
+	Slc  uint64      // symlink cluster id
+	Mtm  time.Time   // modification time
+	Btm  time.Time   // creation time
+	Ctm  time.Time   // status change time
+	Size uint64      // file data size
+	Siz  uint64      // file size (when the data is not stored in the entry)
+	Duz  uint64      // disk usage
+	Idx  uint64      // entry index in the archive
+	Idz  uint64      // entry size in the archive
+	Yop  byte        // patch operation
+	Lbl  string      // label
+	Aft  byte        // AppleFSCompression type
+	Afr  uint32      // AppleFSCompression resource size
+	Fli  uint32      // file list index
+	Cks  uint32      // CRC32 of the file data
+	Sh1  []byte      // SHA1 of the file data
+	Sh2  []byte      // SHA256 of the file data
+	Sh3  []byte      // SHA384 of the file data
+	Sh5  []byte      // SHA512 of the file data
+	Xat  []byte      // extended attributes blob
+	Acl  []byte      // access control list blob
+	// Fields holds the values of every header field without a dedicated member above
+	Fields map[string]interface{}
+}
+
+// Reader provides sequential access to the entries of a YAA/AA archive stream.
+// Reader.Next advances to the next entry in the archive (including the first),
+// and returns a reader over the entry's data; like archive/tar, the data of the
+// previous entry is skipped automatically.
+type Reader struct {
+	r       *bufio.Reader
+	cur     io.Reader
+	err     error
+	entries int // number of entries read
+}
+
+// NewReader creates a new Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 1<<20)}
+}
+
+// Next advances to the next entry in the archive.
+// io.EOF is returned at the end of the input.
+func (yr *Reader) Next() (*Entry, io.Reader, error) {
+	if yr.err != nil {
+		return nil, nil, yr.err
+	}
+
+	if yr.cur != nil { // skip unread data of the previous entry
+		if _, err := io.Copy(ioutil.Discard, yr.cur); err != nil {
+			yr.err = err
+			return nil, nil, err
+		}
+		yr.cur = nil
+	}
+
+	ent, blobs, err := yr.readHeader()
+	if err != nil {
+		yr.err = err
+		return nil, nil, err
+	}
+	yr.entries++
+
+	// blobs are stored after the header in field order; the ones preceding DAT
+	// are read now and the ones following it once the entry data has been consumed
+	data := &entryData{r: yr.r, ent: ent}
+	for i, b := range blobs {
+		if b.key == "DAT" {
+			data.n = int64(b.size)
+			data.rest = blobs[i+1:]
+			break
+		}
+		if err := ent.readBlob(yr.r, b); err != nil {
+			yr.err = err
+			return nil, nil, err
+		}
+	}
+	yr.cur = data
+
+	return ent, yr.cur, nil
+}
+
+// entryData reads the DAT blob of an entry followed by the blobs stored after it
+type entryData struct {
+	r    *bufio.Reader
+	ent  *Entry
+	n    int64
+	rest []blob
+}
+
+func (d *entryData) Read(p []byte) (int, error) {
+	if d.n <= 0 {
+		for len(d.rest) > 0 {
+			b := d.rest[0]
+			d.rest = d.rest[1:]
+			if err := d.ent.readBlob(d.r, b); err != nil {
+				return 0, err
+			}
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > d.n {
+		p = p[:d.n]
+	}
+	n, err := d.r.Read(p)
+	d.n -= int64(n)
+	if err == io.EOF && d.n > 0 {
+		err = io.ErrUnexpectedEOF
+	} else if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (yr *Reader) readHeader() (*Entry, []blob, error) {
+	var magic uint32
+	if err := binary.Read(yr.r, binary.LittleEndian, &magic); err != nil {
+		return nil, nil, err // io.EOF only if the input ended right after the previous entry
+	}
+
+	if magic != yaa1Header && magic != aa01Header { // pre iOS14.x OTA file
+		ent, err := yr.readLegacyHeader(magic)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ent, []blob{{key: "DAT", size: ent.Size}}, nil
+	}
+
+	var headerSize uint16
+	if err := binary.Read(yr.r, binary.LittleEndian, &headerSize); err != nil {
+		return nil, nil, truncated(err)
+	}
+	if int(headerSize) < binary.Size(magic)+binary.Size(headerSize) {
+		return nil, nil, fmt.Errorf("invalid YAA header size: %d", headerSize)
+	}
+	header := make([]byte, int(headerSize)-binary.Size(magic)-binary.Size(headerSize))
+	if _, err := io.ReadFull(yr.r, header); err != nil {
+		return nil, nil, truncated(err)
+	}
+
+	ent, blobs, err := decodeHeader(header)
+	if err != nil {
+		// dump header if in Verbose mode
+		utils.Indent(log.Debug, 2)(hex.Dump(header))
+		return nil, nil, err
+	}
+
+	return ent, blobs, nil
+}
+
+func (yr *Reader) readLegacyHeader(magic uint32) (*Entry, error) {
+	var e legacyEntry
+
+	// the magic we already consumed is the first (big endian) field of the legacy header
+	var first [4]byte
+	binary.LittleEndian.PutUint32(first[:], magic)
+	if err := binary.Read(io.MultiReader(bytes.NewReader(first[:]), yr.r), binary.BigEndian, &e); err != nil {
+		return nil, truncated(err)
+	}
+
+	// 0x10030000 seem to be framworks and other important platform binaries (or symlinks?)
+	if e.Usually_0x210Or_0x110 != 0x10010000 && e.Usually_0x210Or_0x110 != 0x10020000 && e.Usually_0x210Or_0x110 != 0x10030000 {
+		if yr.entries == 0 {
+			return nil, ErrInvalidFormat
+		}
+		return nil, io.EOF // trailing data after the last entry
+	}
+
+	fileName := make([]byte, e.NameLen)
+	if _, err := io.ReadFull(yr.r, fileName); err != nil {
+		return nil, truncated(err)
+	}
+
+	return &Entry{
+		Type: RegularFile,
+		Path: string(fileName),
+		Uid:  uint32(e.Uid),
+		Gid:  uint32(e.Gid),
+		Mod:  fileMode(uint64(e.Perms)),
+		Mtm:  time.Unix(int64(e.ModTime), 0),
+		Size: uint64(e.FileSize),
+	}, nil
+}
+
+// truncated returns io.ErrUnexpectedEOF for an io.EOF in the middle of an entry
+func truncated(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// maxBlobSize is the largest non-DAT blob (XAT, ACL, ...) kept in memory; larger ones are skipped
+const maxBlobSize = 64 * 1024 * 1024
+
+// blob is a header field whose value is stored after the header
+type blob struct {
+	key  string
+	size uint64
+}
+
+// decodeHeader decodes the fields of an Apple Archive header.
+//
+// Each field is a 3 char key followed by a subtype char describing how its value is encoded:
+//
+//	'*'                  flag, no value
+//	'1' '2' '4' '8'      unsigned integer of that many bytes
+//	'P'                  string prefixed by its uint16 length
+//	'S' 'T'              timespec (uint64 seconds, plus uint32 nanoseconds for 'T')
+//	'F' 'G' 'H' 'I' 'J'  CRC32, SHA1, SHA256, SHA384 and SHA512 digests
+//	'A' 'B' 'C'          blob, whose uint16, uint32 or uint64 size is in the header and data after it
+//
+// As the subtype gives the size of every value, fields with unknown keys are kept in Entry.Fields.
+func decodeHeader(header []byte) (*Entry, []blob, error) {
+	var blobs []blob
+
+	ent := &Entry{}
+	r := bytes.NewReader(header)
+
+	for r.Len() > 0 {
+		var field [4]byte
+		if _, err := io.ReadFull(r, field[:]); err != nil {
+			return nil, nil, fmt.Errorf("failed to read YAA header field: %v", err)
+		}
+		key := string(field[:3])
+
+		switch subtype := field[3]; subtype {
+		case '*':
+			ent.setField(key, true)
+		case '1', '2', '4', '8':
+			v, err := readUint(r, int(subtype-'0'))
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read YAA %s field: %v", field, err)
+			}
+			ent.setUint(key, v)
+		case 'A', 'B', 'C':
+			v, err := readUint(r, map[byte]int{'A': 2, 'B': 4, 'C': 8}[subtype])
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read YAA %s field: %v", field, err)
+			}
+			blobs = append(blobs, blob{key: key, size: v})
+			if key == "DAT" {
+				ent.Size = v
+			}
+		case 'P':
+			length, err := readUint(r, 2)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read YAA %s field: %v", field, err)
+			}
+			str := make([]byte, length)
+			if _, err := io.ReadFull(r, str); err != nil {
+				return nil, nil, fmt.Errorf("failed to read YAA %s field: %v", field, err)
+			}
+			ent.setString(key, string(str))
+		case 'S', 'T':
+			secs, err := readUint(r, 8)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read YAA %s field: %v", field, err)
+			}
+			var nsecs uint64
+			if subtype == 'T' {
+				if nsecs, err = readUint(r, 4); err != nil {
+					return nil, nil, fmt.Errorf("failed to read YAA %s field: %v", field, err)
+				}
+			}
+			ent.setTime(key, time.Unix(int64(secs), int64(nsecs)))
+		case 'F', 'G', 'H', 'I', 'J':
+			digest := make([]byte, map[byte]int{'F': 4, 'G': 20, 'H': 32, 'I': 48, 'J': 64}[subtype])
+			if _, err := io.ReadFull(r, digest); err != nil {
+				return nil, nil, fmt.Errorf("failed to read YAA %s field: %v", field, err)
+			}
+			ent.setDigest(key, digest)
+		default:
+			return nil, nil, fmt.Errorf("found unsupported YAA header field encoding: %s", field)
+		}
+	}
+
+	return ent, blobs, nil
+}
+
+func readUint(r io.Reader, size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:size]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+func (e *Entry) setField(key string, value interface{}) {
+	if e.Fields == nil {
+		e.Fields = make(map[string]interface{})
+	}
+	e.Fields[key] = value
+}
+
+// fileMode converts the unix permission bits of an entry into an fs.FileMode
+func fileMode(mode uint64) fs.FileMode {
+	m := fs.FileMode(mode & 0777)
+	if mode&04000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
+
+func (e *Entry) setUint(key string, v uint64) {
+	switch key {
+	case "TYP":
+		e.Type = entryType(v)
+	case "UID":
+		e.Uid = uint32(v)
+	case "GID":
+		e.Gid = uint32(v)
+	case "MOD":
+		e.Mod = fileMode(v)
+	case "FLG":
+		e.Flag = uint32(v)
+	case "DEV":
+		e.Dev = uint32(v)
+	case "INO":
+		e.Ino = v
+	case "HLC":
+		e.Hlc = v
+	case "CLC":
+		e.Clc = v
+	case "SLC":
+		e.Slc = v
+	case "SIZ":
+		e.Siz = v
+	case "DUZ":
+		e.Duz = v
+	case "IDX":
+		e.Idx = v
+	case "IDZ":
+		e.Idz = v
+	case "YOP":
+		e.Yop = byte(v)
+	case "AFT":
+		e.Aft = byte(v)
+	case "AFR":
+		e.Afr = uint32(v)
+	case "FLI":
+		e.Fli = uint32(v)
+	default:
+		e.setField(key, v)
+	}
+}
+
+func (e *Entry) setString(key, v string) {
+	switch key {
+	case "PAT":
+		e.Path = v
+	case "LNK":
+		e.Link = v
+	case "NAM":
+		e.Name = v
+	case "LBL":
+		e.Lbl = v
+	default:
+		e.setField(key, v)
+	}
+}
+
+func (e *Entry) setTime(key string, v time.Time) {
+	switch key {
+	case "MTM":
+		e.Mtm = v
+	case "BTM":
+		e.Btm = v
+	case "CTM":
+		e.Ctm = v
+	default:
+		e.setField(key, v)
+	}
+}
+
+func (e *Entry) setDigest(key string, v []byte) {
+	switch key {
+	case "CKS":
+		e.Cks = binary.LittleEndian.Uint32(v)
+	case "SH1":
+		e.Sh1 = v
+	case "SH2":
+		e.Sh2 = v
+	case "SH3":
+		e.Sh3 = v
+	case "SH5":
+		e.Sh5 = v
+	default:
+		e.setField(key, v)
+	}
+}
+
+// readBlob reads (or skips if too large) the data of a non-DAT blob field
+func (e *Entry) readBlob(r io.Reader, b blob) error {
+	if b.size > maxBlobSize {
+		utils.Indent(log.Debug, 2)(fmt.Sprintf("Skipping %d byte %s blob of %s", b.size, b.key, e.Path))
+		_, err := io.CopyN(ioutil.Discard, r, int64(b.size))
+		return truncated(err)
+	}
+
+	data := make([]byte, b.size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return fmt.Errorf("failed to read YAA %s blob: %v", b.key, err)
+	}
+
+	switch b.key {
+	case "XAT":
+		e.Xat = data
+	case "ACL":
+		e.Acl = data
+	default:
+		e.setField(b.key, data)
+	}
+
+	return nil
+}
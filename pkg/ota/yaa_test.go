@@ -0,0 +1,79 @@
+package ota
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// yaaEntry returns a YAA1 entry of a regular file
+func yaaEntry(path string, data []byte) []byte {
+	var fields bytes.Buffer
+	fields.WriteString("TYP1F")
+	fields.WriteString("PATP")
+	binary.Write(&fields, binary.LittleEndian, uint16(len(path)))
+	fields.WriteString(path)
+	fields.WriteString("DATA")
+	binary.Write(&fields, binary.LittleEndian, uint16(len(data)))
+
+	var ent bytes.Buffer
+	ent.WriteString("YAA1")
+	binary.Write(&ent, binary.LittleEndian, uint16(6+fields.Len()))
+	fields.WriteTo(&ent)
+	ent.Write(data)
+	return ent.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	archive := append(yaaEntry("a.txt", []byte("hello")), yaaEntry("b.txt", []byte("world!"))...)
+
+	yr := NewReader(bytes.NewReader(archive))
+	for _, want := range []struct {
+		path string
+		data string
+	}{
+		{"a.txt", "hello"},
+		{"b.txt", "world!"},
+	} {
+		ent, r, err := yr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ent.Path != want.path || ent.Type != RegularFile || string(data) != want.data {
+			t.Errorf("Next() = %s (%v) %q (expected %s %q)", ent.Path, ent.Type, data, want.path, want.data)
+		}
+	}
+	if _, _, err := yr.Next(); err != io.EOF {
+		t.Errorf("Next() at the end error = %v (expected %v)", err, io.EOF)
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	entry := yaaEntry("a.txt", []byte("hello"))
+	for _, tt := range []struct {
+		name    string
+		archive []byte
+	}{
+		{"magic", append(entry, "YA"...)},
+		{"header", append(entry, entry[:10]...)},
+		{"data", append(entry, entry[:len(entry)-2]...)},
+	} {
+		yr := NewReader(bytes.NewReader(tt.archive))
+		var err error
+		for err == nil {
+			var r io.Reader
+			if _, r, err = yr.Next(); err == nil {
+				_, err = ioutil.ReadAll(r)
+			}
+		}
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("archive with a truncated %s: error = %v (expected %v)", tt.name, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package signature
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bytePattern is a byte signature where every byte is compared under a mask
+type bytePattern struct {
+	value  []byte
+	mask   []byte
+	anchor int // the index of the first fully masked byte (or -1 if there is none)
+}
+
+// parseBytes parses a hex byte pattern
+//
+// Bytes may be written separately or run together ("fd7bbfa9" == "fd 7b bf a9"), a ? matches any nibble
+// ("?? ?? ?? 94" matches a bl and "1?" any byte from 0x10 to 0x1f) and value/mask compares only the masked
+// bits of a byte ("e0/f0" matches any byte from 0xe0 to 0xef).
+func parseBytes(s string) (*bytePattern, error) {
+	bp := &bytePattern{anchor: -1}
+
+	for _, tok := range strings.Fields(strings.ToLower(s)) {
+		if parts := strings.Split(tok, "/"); len(parts) > 1 {
+			if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+				return nil, fmt.Errorf("invalid masked byte %q (expected value/mask e.g. e0/f0)", tok)
+			}
+			value, err := strconv.ParseUint(parts[0], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid masked byte %q: %v", tok, err)
+			}
+			mask, err := strconv.ParseUint(parts[1], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid masked byte %q: %v", tok, err)
+			}
+			bp.value = append(bp.value, byte(value&mask))
+			bp.mask = append(bp.mask, byte(mask))
+			continue
+		}
+		if len(tok)%2 != 0 {
+			return nil, fmt.Errorf("invalid byte token %q (odd number of nibbles)", tok)
+		}
+		for i := 0; i < len(tok); i += 2 {
+			var value, mask byte
+			for _, c := range tok[i : i+2] {
+				value, mask = value<<4, mask<<4
+				switch {
+				case c == '?':
+				case '0' <= c && c <= '9':
+					value |= byte(c - '0')
+					mask |= 0xf
+				case 'a' <= c && c <= 'f':
+					value |= byte(c - 'a' + 10)
+					mask |= 0xf
+				default:
+					return nil, fmt.Errorf("invalid byte token %q", tok)
+				}
+			}
+			bp.value = append(bp.value, value)
+			bp.mask = append(bp.mask, mask)
+		}
+	}
+
+	if len(bp.value) == 0 {
+		return nil, fmt.Errorf("empty byte pattern")
+	}
+
+	for idx, mask := range bp.mask {
+		if mask == 0xff {
+			bp.anchor = idx
+			break
+		}
+	}
+
+	return bp, nil
+}
+
+// matchAt returns true if the pattern matches data at off
+func (bp *bytePattern) matchAt(data []byte, off int) bool {
+	if off+len(bp.value) > len(data) {
+		return false
+	}
+	for idx, value := range bp.value {
+		if data[off+idx]&bp.mask[idx] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// findAll returns the offsets of all the (possibly overlapping) matches in data
+func (bp *bytePattern) findAll(data []byte) []int {
+	var offs []int
+
+	if bp.anchor < 0 {
+		for off := 0; off+len(bp.value) <= len(data); off++ {
+			if bp.matchAt(data, off) {
+				offs = append(offs, off)
+			}
+		}
+		return offs
+	}
+
+	// jump between the occurrences of the first exact byte instead of testing every offset
+	for pos := bp.anchor; pos < len(data); {
+		idx := bytes.IndexByte(data[pos:], bp.value[bp.anchor])
+		if idx < 0 {
+			break
+		}
+		pos += idx
+		if off := pos - bp.anchor; bp.matchAt(data, off) {
+			offs = append(offs, off)
+		}
+		pos++
+	}
+
+	return offs
+}
@@ -0,0 +1,98 @@
+package signature
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blacktop/go-arm64"
+)
+
+// instrPattern matches the disassembly of a single instruction
+type instrPattern struct {
+	re *regexp.Regexp // nil matches any instruction
+}
+
+var (
+	spaceRE = regexp.MustCompile(`\s+`)
+	punctRE = regexp.MustCompile(` ?([,\[\]{}!]) ?`)
+)
+
+// normalize lowercases an instruction and removes the whitespace that is not between the mnemonic and its operands
+func normalize(instr string) string {
+	instr = spaceRE.ReplaceAllString(strings.ToLower(strings.TrimSpace(instr)), " ")
+	return punctRE.ReplaceAllString(instr, "$1")
+}
+
+// parseInstrs parses a ; separated arm64 instruction pattern
+//
+// Every instruction is matched against its disassembly (e.g. "ldr x16, [x16, #0x18]") where a ? matches a single
+// register or immediate ("x?" or "#?"), a * matches anything ("adrp x?, *") and a lone * matches any instruction.
+func parseInstrs(s string) ([]*instrPattern, error) {
+	var ips []*instrPattern
+
+	for _, instr := range strings.Split(s, ";") {
+		instr = normalize(instr)
+		if len(instr) == 0 {
+			continue
+		}
+		if instr == "*" {
+			ips = append(ips, &instrPattern{})
+			continue
+		}
+		var expr strings.Builder
+		expr.WriteString("^")
+		for _, c := range instr {
+			switch c {
+			case '?':
+				expr.WriteString(`[^ ,\[\]{}!]+`)
+			case '*':
+				expr.WriteString(`.*`)
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+		expr.WriteString("$")
+		re, err := regexp.Compile(expr.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid instruction %q: %v", instr, err)
+		}
+		ips = append(ips, &instrPattern{re: re})
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("empty instruction pattern")
+	}
+
+	return ips, nil
+}
+
+// disassemble returns the normalized disassembly of every instruction in code ("" if it failed to decode)
+func disassemble(code []byte, addr uint64) []string {
+	instrs := make([]string, 0, len(code)/4)
+	for i := range arm64.Disassemble(bytes.NewReader(code[:len(code)&^3]), arm64.Options{StartAddress: int64(addr)}) {
+		if i.Error != nil || i.Instruction == nil {
+			instrs = append(instrs, "")
+			continue
+		}
+		instrs = append(instrs, normalize(i.Instruction.Operation().String()+" "+i.Instruction.OpStr()))
+	}
+	return instrs
+}
+
+// matchInstrs returns true if the instruction pattern matches the start of instrs
+func matchInstrs(ips []*instrPattern, instrs []string) bool {
+	if len(ips) > len(instrs) {
+		return false
+	}
+	for idx, ip := range ips {
+		if ip.re == nil {
+			continue
+		}
+		if len(instrs[idx]) == 0 || !ip.re.MatchString(instrs[idx]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package signature
+
+import (
+	"fmt"
+
+	"github.com/blacktop/go-macho"
+)
+
+// ScanMachO scans the executable sections of a MachO for the signatures
+func ScanMachO(m *macho.File, sigs []*Signature) ([]Match, error) {
+	var matches []Match
+
+	for _, sec := range m.Sections {
+		if attrs := sec.Flags.GetAttributes(); !attrs.IsPureInstructions() && !attrs.IsSomeInstructions() {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s.%s: %v", sec.Seg, sec.Name, err)
+		}
+		section := fmt.Sprintf("%s.%s", sec.Seg, sec.Name)
+		Scan(data, sec.Addr, sigs, func(sig *Signature, addr uint64) {
+			match := Match{
+				Rule:    sig.Name,
+				Symbol:  sig.Symbol,
+				Section: section,
+				Address: addr,
+			}
+			if fn, err := m.GetFunctionForVMAddr(addr); err == nil {
+				match.Function = fn.StartAddr
+				if syms, err := m.FindAddressSymbols(fn.StartAddr); err == nil {
+					for _, sym := range syms {
+						if len(sym.Name) > 0 {
+							match.FunctionName = sym.Name
+							break
+						}
+					}
+				}
+			}
+			matches = append(matches, match)
+		})
+	}
+
+	return matches, nil
+}
@@ -0,0 +1,159 @@
+// Package signature finds code in MachOs and dyld_shared_cache images by byte patterns
+// (with wildcards and masks) and arm64 instruction patterns.
+package signature
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Rule is a signature as it is written in a rules file
+type Rule struct {
+	Name   string `yaml:"name" json:"name"`
+	Symbol string `yaml:"symbol,omitempty" json:"symbol,omitempty"` // the symbol the signature locates
+	Image  string `yaml:"image,omitempty" json:"image,omitempty"`   // only scan the cache images whose name contains this
+	Bytes  string `yaml:"bytes,omitempty" json:"bytes,omitempty"`   // e.g. "fd 7b bf a9 ?? ?? ?? 94 e0/f0"
+	Instrs string `yaml:"instrs,omitempty" json:"instrs,omitempty"` // e.g. "adrp x?, *; ldr x?, [x?, #0x18]; blr x?"
+}
+
+// Rules is the format of a rules file
+type Rules struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// Signature is a compiled Rule
+type Signature struct {
+	Rule
+
+	bytes  *bytePattern
+	instrs []*instrPattern
+}
+
+// Parse compiles a Rule into a Signature
+func Parse(rule Rule) (*Signature, error) {
+	if len(rule.Bytes) == 0 && len(rule.Instrs) == 0 {
+		return nil, fmt.Errorf("signature %s has neither a byte nor an instruction pattern", rule.Name)
+	}
+
+	sig := &Signature{Rule: rule}
+
+	if len(rule.Bytes) > 0 {
+		bp, err := parseBytes(rule.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signature %s byte pattern: %v", rule.Name, err)
+		}
+		sig.bytes = bp
+	}
+
+	if len(rule.Instrs) > 0 {
+		ips, err := parseInstrs(rule.Instrs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signature %s instruction pattern: %v", rule.Name, err)
+		}
+		sig.instrs = ips
+	}
+
+	return sig, nil
+}
+
+// LoadRules parses the signatures in a YAML rules file
+//
+//	rules:
+//	  - name: objc_msgSend
+//	    image: libobjc.A.dylib
+//	    bytes: "e1 ?? ?? f9 1f 00 00 f1"
+//	  - name: vtable_call
+//	    instrs: "adrp x?, *; ldr x?, [x?, #0x18]; blr x?"
+func LoadRules(path string) ([]*Signature, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file %s: %v", path, err)
+	}
+
+	var rules Rules
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse rules file %s: %v", path, err)
+	}
+
+	var sigs []*Signature
+	for idx, rule := range rules.Rules {
+		if len(rule.Name) == 0 {
+			rule.Name = fmt.Sprintf("rule_%d", idx)
+		}
+		sig, err := Parse(rule)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+
+	return sigs, nil
+}
+
+// AppliesTo returns true if the signature should be scanned for in the given image
+func (s *Signature) AppliesTo(image string) bool {
+	return len(s.Image) == 0 || strings.Contains(image, s.Image)
+}
+
+// Match is a location where a signature matched
+type Match struct {
+	Rule         string `json:"rule"`
+	Symbol       string `json:"symbol,omitempty"`
+	Image        string `json:"image,omitempty"`
+	Section      string `json:"section"`
+	Address      uint64 `json:"address"`
+	Function     uint64 `json:"function,omitempty"` // the start of the function containing the match
+	FunctionName string `json:"function_name,omitempty"`
+}
+
+// String returns the match as it is printed by the sig commands
+func (m Match) String() string {
+	s := fmt.Sprintf("%#x: %s", m.Address, m.Rule)
+	if len(m.Symbol) > 0 && m.Symbol != m.Rule {
+		s += fmt.Sprintf(" (%s)", m.Symbol)
+	}
+	if m.Function > 0 {
+		if len(m.FunctionName) > 0 {
+			s += fmt.Sprintf("\tin %s+%#x", m.FunctionName, m.Address-m.Function)
+		} else {
+			s += fmt.Sprintf("\tin func_%x+%#x", m.Function, m.Address-m.Function)
+		}
+	}
+	if len(m.Image) > 0 {
+		s += fmt.Sprintf("\t(%s|%s)", m.Section, filepath.Base(m.Image))
+	} else {
+		s += fmt.Sprintf("\t(%s)", m.Section)
+	}
+	return s
+}
+
+// Scan calls handler for every address in code (which is mapped at addr) where one of the signatures matches.
+// Instruction patterns (and signatures with both kinds of pattern) only match at instruction boundaries.
+func Scan(code []byte, addr uint64, sigs []*Signature, handler func(sig *Signature, addr uint64)) {
+	var instrs []string // the normalized disassembly of code (only decoded if needed)
+
+	for _, sig := range sigs {
+		if sig.instrs != nil && instrs == nil {
+			instrs = disassemble(code, addr)
+		}
+		switch {
+		case sig.bytes != nil:
+			for _, off := range sig.bytes.findAll(code) {
+				if sig.instrs != nil && (off%4 != 0 || !matchInstrs(sig.instrs, instrs[off/4:])) {
+					continue
+				}
+				handler(sig, addr+uint64(off))
+			}
+		case sig.instrs != nil:
+			for idx := range instrs {
+				if matchInstrs(sig.instrs, instrs[idx:]) {
+					handler(sig, addr+uint64(idx*4))
+				}
+			}
+		}
+	}
+}
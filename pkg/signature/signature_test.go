@@ -0,0 +1,155 @@
+package signature
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBytePattern(t *testing.T) {
+	data := []byte{0xfd, 0x7b, 0xbf, 0xa9, 0x12, 0x34, 0x56, 0x94, 0xe3, 0xfd, 0x7b, 0x1f}
+	for _, tt := range []struct {
+		pattern string
+		want    []int
+	}{
+		{"fd 7b", []int{0, 9}},
+		{"fd7bbfa9", []int{0}},
+		{"?? ?? ?? 94", []int{4}},
+		{"94 e?", []int{7}},
+		{"e0/f0 fd", []int{8}},
+		{"7b 1?", []int{10}},
+		{"7b ?f", []int{1, 10}},
+		{"00/00 7b", []int{0, 9}}, // a zero mask matches any byte
+		{"a9 ?? ?? ?? ?? ?? ?? ?? ??", []int{3}},
+		{"a9 ?? ?? ?? ?? ?? ?? ?? ?? ??", nil}, // runs past the end of data
+		{"ff", nil},
+	} {
+		bp, err := parseBytes(tt.pattern)
+		if err != nil {
+			t.Errorf("parseBytes(%q) error = %v", tt.pattern, err)
+			continue
+		}
+		if got := bp.findAll(data); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("findAll(%q) = %v (expected %v)", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestParseBytesErrors(t *testing.T) {
+	for _, pattern := range []string{
+		"",         // empty
+		"fd 7",     // odd number of nibbles
+		"fd zz",    // not hex
+		"e0/f",     // short mask
+		"e0/f0/ff", // two masks
+		"e0/gg",    // mask not hex
+	} {
+		if _, err := parseBytes(pattern); err == nil {
+			t.Errorf("parseBytes(%q) succeeded (expected an error)", pattern)
+		}
+	}
+}
+
+func TestMatchInstrs(t *testing.T) {
+	instrs := []string{
+		"adrp x16,0x1e3be9000",
+		"ldr x16,[x16,#0x18]",
+		"blr x16",
+	}
+	for _, tt := range []struct {
+		pattern string
+		want    bool
+	}{
+		{"adrp x?, *; ldr x?, [x?, #0x18]; blr x?", true},
+		{"ADRP  X16, * ; LDR X16,[X16,#0x18]", true},
+		{"*; ldr x?, [x?, #?]; *", true},
+		{"adrp x?, *; ldr x?, [x?, #0x20]", false},
+		{"adrp x?, *; ldr w?, *", false},
+		{"adrp x?, *; ldr x?, *; blr x?; ret", false}, // longer than instrs
+		{"adrp x1?, *", true},
+		{"adrp x?, 0x1e3be9", false}, // a pattern matches the whole instruction
+	} {
+		ips, err := parseInstrs(tt.pattern)
+		if err != nil {
+			t.Errorf("parseInstrs(%q) error = %v", tt.pattern, err)
+			continue
+		}
+		if got := matchInstrs(ips, instrs); got != tt.want {
+			t.Errorf("matchInstrs(%q) = %t (expected %t)", tt.pattern, got, tt.want)
+		}
+	}
+
+	if _, err := parseInstrs(" ; ;"); err == nil {
+		t.Errorf("parseInstrs() of an empty pattern succeeded")
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	sigs, err := LoadRules(write("good.yml", `rules:
+  - name: objc_msgSend
+    image: libobjc.A.dylib
+    bytes: "e1 ?? ?? f9 1f 00 00 f1"
+  - instrs: "adrp x?, *; ldr x?, [x?, #0x18]; blr x?"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 2 || sigs[0].Name != "objc_msgSend" || sigs[1].Name != "rule_1" {
+		t.Fatalf("LoadRules() = %v (expected objc_msgSend and rule_1)", sigs)
+	}
+	if !sigs[0].AppliesTo("/usr/lib/libobjc.A.dylib") || sigs[0].AppliesTo("/usr/lib/libc++.1.dylib") || !sigs[1].AppliesTo("/usr/lib/libc++.1.dylib") {
+		t.Errorf("AppliesTo() does not filter by image")
+	}
+
+	for _, tt := range []struct {
+		name  string
+		rules string
+	}{
+		{"unknown field", "rules:\n  - name: a\n    byte: \"fd 7b\"\n"},
+		{"no pattern", "rules:\n  - name: a\n    image: libobjc.A.dylib\n"},
+		{"bad bytes", "rules:\n  - name: a\n    bytes: \"fd 7\"\n"},
+		{"empty instrs", "rules:\n  - name: a\n    instrs: \";\"\n"},
+		{"not yaml", "rules: [\n"},
+	} {
+		if sigs, err := LoadRules(write("bad.yml", tt.rules)); err == nil {
+			t.Errorf("LoadRules() of a rule with %s = %v (expected an error)", tt.name, sigs)
+		}
+	}
+	if _, err := LoadRules(filepath.Join(dir, "missing.yml")); err == nil {
+		t.Errorf("LoadRules() of a missing file succeeded")
+	}
+}
+
+func TestScan(t *testing.T) {
+	code := []byte{0x1f, 0x20, 0x03, 0xd5, 0xc0, 0x03, 0x5f, 0xd6, 0x1f, 0x20, 0x03, 0xd5} // nop; ret; nop
+	sigs := []*Signature{}
+	for _, rule := range []Rule{
+		{Name: "nop", Bytes: "1f 20 03 d5"},
+		{Name: "misaligned", Bytes: "d5 c0"},
+	} {
+		sig, err := Parse(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigs = append(sigs, sig)
+	}
+
+	var got []Match
+	Scan(code, 0x1000, sigs, func(sig *Signature, addr uint64) {
+		got = append(got, Match{Rule: sig.Name, Address: addr})
+	})
+	want := []Match{{Rule: "nop", Address: 0x1000}, {Rule: "nop", Address: 0x1008}, {Rule: "misaligned", Address: 0x1003}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Scan() = %v (expected %v)", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+package swift
+
+import (
+	"strings"
+
+	"github.com/blacktop/go-macho"
+	"github.com/blacktop/ipsw/internal/vmreader"
+)
+
+// Sections returns the Swift metadata sections of a MachO
+func Sections(m *macho.File) []Section {
+	var secs []Section
+	for _, sec := range m.Sections {
+		if strings.HasPrefix(sec.Name, "__swift5_") {
+			secs = append(secs, Section{Name: sec.Name, Addr: sec.Addr, Size: sec.Size})
+		}
+	}
+	return secs
+}
+
+// ParseMachO parses the Swift reflection metadata of a MachO
+func ParseMachO(m *macho.File) (*Metadata, error) {
+	secs := Sections(m)
+	if len(secs) == 0 {
+		return nil, ErrNoSwift
+	}
+	return Parse(vmreader.NewMachO(m), secs)
+}
@@ -0,0 +1,494 @@
+// Package swift parses the Swift 5 reflection metadata (__swift5_* sections) of MachOs and dyld_shared_cache images.
+package swift
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/blacktop/ipsw/internal/vmreader"
+	"github.com/pkg/errors"
+)
+
+// ErrNoSwift is the error for an image that has no Swift reflection metadata
+var ErrNoSwift = errors.New("image does NOT contain swift5 metadata")
+
+const (
+	maxNameDepth = 16      // max context descriptor parent chain
+	maxFields    = 0x10000 // sanity limit for field/associated type records
+)
+
+// Reader reads an image's memory by (unslid) virtual address
+type Reader = vmreader.Reader
+
+// Section is a Swift metadata section
+type Section struct {
+	Name string
+	Addr uint64
+	Size uint64
+}
+
+type parser struct {
+	r     Reader
+	names map[uint64]string // context descriptor names cache
+}
+
+// Parse parses the Swift reflection metadata in the given sections
+func Parse(r Reader, sections []Section) (*Metadata, error) {
+	var err error
+	var md Metadata
+
+	p := &parser{r: r, names: make(map[uint64]string)}
+
+	found := false
+	for _, sec := range sections {
+		switch sec.Name {
+		case "__swift5_types":
+			md.Types, err = p.parseTypes(sec)
+		case "__swift5_protos":
+			md.Protocols, err = p.parseProtocols(sec)
+		case "__swift5_proto":
+			md.Conformances, err = p.parseConformances(sec)
+		case "__swift5_assocty":
+			md.AssociatedTypes, err = p.parseAssociatedTypes(sec)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", sec.Name)
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, ErrNoSwift
+	}
+
+	return &md, nil
+}
+
+/*
+ * Memory access
+ */
+
+func (p *parser) read(addr uint64, v interface{}) error {
+	buf := make([]byte, binary.Size(v))
+	if _, err := p.r.ReadAtAddr(buf, addr); err != nil {
+		return fmt.Errorf("failed to read %T at %#x: %v", v, addr, err)
+	}
+	return binary.Read(bytes.NewReader(buf), binary.LittleEndian, v)
+}
+
+func (p *parser) readInt32(addr uint64) (int32, error) {
+	var v int32
+	err := p.read(addr, &v)
+	return v, err
+}
+
+// relative returns the target of the relative direct pointer at addr
+func (p *parser) relative(addr uint64) (uint64, error) {
+	off, err := p.readInt32(addr)
+	if err != nil || off == 0 {
+		return 0, err
+	}
+	return uint64(int64(addr) + int64(off)), nil
+}
+
+// indirectable returns the target of the relative indirectable pointer at addr
+func (p *parser) indirectable(addr uint64) (uint64, error) {
+	off, err := p.readInt32(addr)
+	if err != nil || off == 0 {
+		return 0, err
+	}
+	target := uint64(int64(addr) + int64(off&^1))
+	if off&1 == 0 {
+		return target, nil
+	}
+	return p.r.ReadPointerAtAddr(target)
+}
+
+func (p *parser) relativeString(addr uint64) (string, error) {
+	target, err := p.relative(addr)
+	if err != nil || target == 0 {
+		return "", err
+	}
+	return vmreader.ReadCString(p.r, target)
+}
+
+/*
+ * Names
+ */
+
+// contextName returns the fully qualified name of the context descriptor at addr
+func (p *parser) contextName(addr uint64) string {
+	return p.qualifiedName(addr, 0)
+}
+
+func (p *parser) qualifiedName(addr uint64, depth int) string {
+	if addr == 0 {
+		return "<external>"
+	}
+	if name, ok := p.names[addr]; ok {
+		return name
+	}
+	if depth > maxNameDepth {
+		return "<?>"
+	}
+
+	var cd contextDescriptor
+	if err := p.read(addr, &cd); err != nil {
+		return fmt.Sprintf("<unknown %#x>", addr)
+	}
+
+	var name string
+	switch cd.Flags.Kind() {
+	case KindModule, KindProtocol, KindClass, KindStruct, KindEnum:
+		n, err := p.relativeString(addr + 8)
+		if err != nil {
+			return fmt.Sprintf("<unknown %#x>", addr)
+		}
+		name = n
+	case KindExtension:
+		// the extended context is a mangled type name
+		if target, err := p.relative(addr + 8); err == nil && target != 0 {
+			name = p.mangledName(target)
+			p.names[addr] = name
+			return name
+		}
+		name = "extension"
+	case KindAnonymous:
+		name = ""
+	case KindOpaqueType:
+		name = "<opaque>"
+	default:
+		return fmt.Sprintf("<%s %#x>", cd.Flags.Kind(), addr)
+	}
+
+	if cd.Parent != 0 {
+		if parent, err := p.indirectable(addr + 4); err == nil {
+			if pname := p.qualifiedName(parent, depth+1); len(pname) > 0 {
+				if len(name) == 0 {
+					name = pname
+				} else {
+					name = pname + "." + name
+				}
+			}
+		}
+	}
+
+	p.names[addr] = name
+
+	return name
+}
+
+// stdTypes are the standard library type manglings
+var stdTypes = map[string]string{
+	"Sa":   "Swift.Array",
+	"Sb":   "Swift.Bool",
+	"SD":   "Swift.Dictionary",
+	"Sd":   "Swift.Double",
+	"Sf":   "Swift.Float",
+	"Sh":   "Swift.Set",
+	"Si":   "Swift.Int",
+	"Sq":   "Swift.Optional",
+	"SS":   "Swift.String",
+	"Su":   "Swift.UInt",
+	"Sv":   "Swift.UnsafeMutableRawPointer",
+	"SV":   "Swift.UnsafeRawPointer",
+	"yt":   "()",
+	"ypXp": "Any.Type",
+	"yp":   "Any",
+	"yXl":  "AnyObject",
+}
+
+// mangledName returns the mangled type name at addr with its symbolic references resolved
+func (p *parser) mangledName(addr uint64) string {
+	buf, err := vmreader.ReadBytes(p.r, addr, vmreader.MaxString)
+	if err != nil {
+		return fmt.Sprintf("<unknown %#x>", addr)
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(buf) && buf[i] != 0; i++ {
+		switch b := buf[i]; {
+		case b >= 0x01 && b <= 0x17: // symbolic reference (32-bit relative offset)
+			if i+5 > len(buf) {
+				return sb.String()
+			}
+			off := int32(binary.LittleEndian.Uint32(buf[i+1:]))
+			target := uint64(int64(addr) + int64(i+1) + int64(off))
+			switch b {
+			case 0x01: // direct context descriptor
+				sb.WriteString(p.contextName(target))
+			case 0x02: // indirect context descriptor
+				ptr, err := p.r.ReadPointerAtAddr(target)
+				if err != nil {
+					ptr = 0
+				}
+				sb.WriteString(p.contextName(ptr))
+			default:
+				fmt.Fprintf(&sb, "<symbolic %#x>", target)
+			}
+			i += 4
+		case b >= 0x18 && b <= 0x1f: // symbolic reference (absolute pointer)
+			i += 8
+			sb.WriteString("<symbolic>")
+		default:
+			sb.WriteByte(b)
+		}
+	}
+
+	if name, ok := stdTypes[sb.String()]; ok {
+		return name
+	}
+
+	return sb.String()
+}
+
+func (p *parser) relativeMangledName(addr uint64) (string, error) {
+	target, err := p.relative(addr)
+	if err != nil || target == 0 {
+		return "", err
+	}
+	return p.mangledName(target), nil
+}
+
+/*
+ * Sections
+ */
+
+func (p *parser) parseTypes(sec Section) ([]*Type, error) {
+	var types []*Type
+
+	for addr := sec.Addr; addr+4 <= sec.Addr+sec.Size; addr += 4 {
+		off, err := p.readInt32(addr)
+		if err != nil {
+			return nil, err
+		}
+		kind := TypeReferenceKind(off & 0x3)
+		target := uint64(int64(addr) + int64(off&^0x3))
+		switch kind {
+		case DirectTypeDescriptor:
+		case IndirectTypeDescriptor:
+			if target, err = p.r.ReadPointerAtAddr(target); err != nil {
+				return nil, err
+			}
+		default: // ObjC class references
+			continue
+		}
+		if target == 0 {
+			continue
+		}
+		typ, err := p.parseType(target)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, typ)
+	}
+
+	return types, nil
+}
+
+func (p *parser) parseType(addr uint64) (*Type, error) {
+	var err error
+	var desc typeContextDescriptor
+
+	if err := p.read(addr, &desc); err != nil {
+		return nil, err
+	}
+
+	typ := &Type{
+		Address: addr,
+		Kind:    desc.Flags.Kind(),
+		Name:    p.contextName(addr),
+		Flags:   desc.Flags,
+	}
+
+	if typ.AccessFunction, err = p.relative(addr + 12); err != nil {
+		return nil, err
+	}
+
+	switch typ.Kind {
+	case KindClass:
+		// the superclass mangled name follows the type context descriptor
+		if typ.SuperClass, err = p.relativeMangledName(addr + uint64(binary.Size(desc))); err != nil {
+			return nil, err
+		}
+	case KindStruct, KindEnum:
+	default:
+		return typ, nil
+	}
+
+	fields, err := p.relative(addr + 16)
+	if err != nil {
+		return nil, err
+	}
+	if fields != 0 {
+		if typ.Fields, err = p.parseFields(fields); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse fields of %s", typ.Name)
+		}
+	}
+
+	return typ, nil
+}
+
+func (p *parser) parseFields(addr uint64) ([]Field, error) {
+	var fields []Field
+	var fd fieldDescriptor
+
+	if err := p.read(addr, &fd); err != nil {
+		return nil, err
+	}
+	if fd.NumFields > maxFields || (fd.NumFields > 0 && fd.FieldRecordSize < uint16(binary.Size(fieldRecord{}))) {
+		return nil, fmt.Errorf("invalid field descriptor at %#x (%d fields of size %d)", addr, fd.NumFields, fd.FieldRecordSize)
+	}
+
+	recAddr := addr + uint64(binary.Size(fd))
+	for i := uint32(0); i < fd.NumFields; i, recAddr = i+1, recAddr+uint64(fd.FieldRecordSize) {
+		var rec fieldRecord
+		if err := p.read(recAddr, &rec); err != nil {
+			return nil, err
+		}
+		f := Field{Flags: rec.Flags}
+		var err error
+		if f.Name, err = p.relativeString(recAddr + 8); err != nil {
+			return nil, err
+		}
+		if f.Type, err = p.relativeMangledName(recAddr + 4); err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+func (p *parser) parseProtocols(sec Section) ([]*Protocol, error) {
+	var protos []*Protocol
+
+	for addr := sec.Addr; addr+4 <= sec.Addr+sec.Size; addr += 4 {
+		target, err := p.indirectable(addr)
+		if err != nil {
+			return nil, err
+		}
+		if target == 0 {
+			continue
+		}
+		var desc protocolDescriptor
+		if err := p.read(target, &desc); err != nil {
+			return nil, err
+		}
+		proto := &Protocol{
+			Address:         target,
+			Name:            p.contextName(target),
+			NumRequirements: desc.NumRequirements,
+		}
+		names, err := p.relativeString(target + 20)
+		if err != nil {
+			return nil, err
+		}
+		proto.AssociatedTypes = strings.Fields(names)
+		protos = append(protos, proto)
+	}
+
+	return protos, nil
+}
+
+func (p *parser) parseConformances(sec Section) ([]*Conformance, error) {
+	var confs []*Conformance
+
+	for addr := sec.Addr; addr+4 <= sec.Addr+sec.Size; addr += 4 {
+		target, err := p.relative(addr)
+		if err != nil {
+			return nil, err
+		}
+		if target == 0 {
+			continue
+		}
+		var desc conformanceDescriptor
+		if err := p.read(target, &desc); err != nil {
+			return nil, err
+		}
+		conf := &Conformance{Address: target, Flags: desc.Flags}
+
+		proto, err := p.indirectable(target)
+		if err != nil {
+			return nil, err
+		}
+		conf.Protocol = p.contextName(proto)
+
+		switch desc.Flags.TypeReferenceKind() {
+		case DirectTypeDescriptor:
+			typ, err := p.relative(target + 4)
+			if err != nil {
+				return nil, err
+			}
+			conf.Type = p.contextName(typ)
+		case IndirectTypeDescriptor:
+			ptr, err := p.relative(target + 4)
+			if err != nil {
+				return nil, err
+			}
+			typ, err := p.r.ReadPointerAtAddr(ptr)
+			if err != nil {
+				return nil, err
+			}
+			conf.Type = p.contextName(typ)
+		case DirectObjCClassName:
+			if conf.Type, err = p.relativeString(target + 4); err != nil {
+				return nil, err
+			}
+		default:
+			conf.Type = "<objc class>"
+		}
+
+		if conf.WitnessTable, err = p.relative(target + 8); err != nil {
+			return nil, err
+		}
+
+		confs = append(confs, conf)
+	}
+
+	return confs, nil
+}
+
+func (p *parser) parseAssociatedTypes(sec Section) ([]*AssociatedType, error) {
+	var ats []*AssociatedType
+
+	for addr := sec.Addr; addr < sec.Addr+sec.Size; {
+		var desc associatedTypeDescriptor
+		if err := p.read(addr, &desc); err != nil {
+			return nil, err
+		}
+		if desc.NumAssociatedTypes > maxFields || desc.AssociatedTypeRecordSize < uint32(binary.Size(associatedTypeRecord{})) {
+			return nil, fmt.Errorf("invalid associated type descriptor at %#x (%d types of size %d)", addr, desc.NumAssociatedTypes, desc.AssociatedTypeRecordSize)
+		}
+
+		at := &AssociatedType{Address: addr}
+		var err error
+		if at.ConformingType, err = p.relativeMangledName(addr); err != nil {
+			return nil, err
+		}
+		if at.Protocol, err = p.relativeMangledName(addr + 4); err != nil {
+			return nil, err
+		}
+
+		recAddr := addr + uint64(binary.Size(desc))
+		for i := uint32(0); i < desc.NumAssociatedTypes; i, recAddr = i+1, recAddr+uint64(desc.AssociatedTypeRecordSize) {
+			var rec AssociatedTypeRecord
+			if rec.Name, err = p.relativeString(recAddr); err != nil {
+				return nil, err
+			}
+			if rec.Type, err = p.relativeMangledName(recAddr + 4); err != nil {
+				return nil, err
+			}
+			at.Types = append(at.Types, rec)
+		}
+
+		ats = append(ats, at)
+		addr = recAddr
+	}
+
+	return ats, nil
+}
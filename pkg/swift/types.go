@@ -0,0 +1,362 @@
+package swift
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ContextDescriptorKind is the kind of a Swift context descriptor
+type ContextDescriptorKind uint8
+
+const (
+	KindModule     ContextDescriptorKind = 0
+	KindExtension  ContextDescriptorKind = 1
+	KindAnonymous  ContextDescriptorKind = 2
+	KindProtocol   ContextDescriptorKind = 3
+	KindOpaqueType ContextDescriptorKind = 4
+	KindClass      ContextDescriptorKind = 16
+	KindStruct     ContextDescriptorKind = 17
+	KindEnum       ContextDescriptorKind = 18
+)
+
+func (k ContextDescriptorKind) String() string {
+	switch k {
+	case KindModule:
+		return "module"
+	case KindExtension:
+		return "extension"
+	case KindAnonymous:
+		return "anonymous"
+	case KindProtocol:
+		return "protocol"
+	case KindOpaqueType:
+		return "opaque type"
+	case KindClass:
+		return "class"
+	case KindStruct:
+		return "struct"
+	case KindEnum:
+		return "enum"
+	default:
+		return fmt.Sprintf("kind(%d)", k)
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (k ContextDescriptorKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// ContextDescriptorFlags are the flags of a Swift context descriptor
+type ContextDescriptorFlags uint32
+
+// Kind returns the kind of the context descriptor
+func (f ContextDescriptorFlags) Kind() ContextDescriptorKind {
+	return ContextDescriptorKind(f & 0x1f)
+}
+
+// IsGeneric returns true if the context has generic parameters
+func (f ContextDescriptorFlags) IsGeneric() bool {
+	return f&0x80 != 0
+}
+
+// IsUnique returns true if the context descriptor is unique
+func (f ContextDescriptorFlags) IsUnique() bool {
+	return f&0x40 != 0
+}
+
+// Version returns the format version of the context descriptor
+func (f ContextDescriptorFlags) Version() uint8 {
+	return uint8(f >> 8)
+}
+
+// KindSpecificFlags returns the flags specific to the kind of context descriptor
+func (f ContextDescriptorFlags) KindSpecificFlags() uint16 {
+	return uint16(f >> 16)
+}
+
+// TypeReferenceKind is the kind of a type reference in a type metadata record or conformance
+type TypeReferenceKind uint8
+
+const (
+	DirectTypeDescriptor   TypeReferenceKind = 0
+	IndirectTypeDescriptor TypeReferenceKind = 1
+	DirectObjCClassName    TypeReferenceKind = 2
+	IndirectObjCClass      TypeReferenceKind = 3
+)
+
+// FieldDescriptorKind is the kind of a Swift field descriptor
+type FieldDescriptorKind uint16
+
+const (
+	FDKStruct           FieldDescriptorKind = 0
+	FDKClass            FieldDescriptorKind = 1
+	FDKEnum             FieldDescriptorKind = 2
+	FDKMultiPayloadEnum FieldDescriptorKind = 3
+	FDKProtocol         FieldDescriptorKind = 4
+	FDKClassProtocol    FieldDescriptorKind = 5
+	FDKObjCProtocol     FieldDescriptorKind = 6
+	FDKObjCClass        FieldDescriptorKind = 7
+)
+
+// FieldRecordFlags are the flags of a Swift field record
+type FieldRecordFlags uint32
+
+const (
+	FieldIsIndirectCase FieldRecordFlags = 0x1
+	FieldIsVar          FieldRecordFlags = 0x2
+	FieldIsArtificial   FieldRecordFlags = 0x4
+)
+
+// ConformanceFlags are the flags of a Swift protocol conformance descriptor
+type ConformanceFlags uint32
+
+// TypeReferenceKind returns the kind of the conforming type reference
+func (f ConformanceFlags) TypeReferenceKind() TypeReferenceKind {
+	return TypeReferenceKind((f >> 3) & 0x7)
+}
+
+// IsRetroactive returns true if the conformance is retroactive
+func (f ConformanceFlags) IsRetroactive() bool {
+	return f&0x40 != 0
+}
+
+// IsSynthesizedNonUnique returns true if the conformance was synthesized by the compiler
+func (f ConformanceFlags) IsSynthesizedNonUnique() bool {
+	return f&0x80 != 0
+}
+
+// NumConditionalRequirements returns the number of conditional requirements of the conformance
+func (f ConformanceFlags) NumConditionalRequirements() uint8 {
+	return uint8(f >> 8)
+}
+
+// HasResilientWitnesses returns true if the conformance has resilient witnesses
+func (f ConformanceFlags) HasResilientWitnesses() bool {
+	return f&0x10000 != 0
+}
+
+// HasGenericWitnessTable returns true if the conformance has a generic witness table
+func (f ConformanceFlags) HasGenericWitnessTable() bool {
+	return f&0x20000 != 0
+}
+
+/*
+ * On-disk structures (all relative pointers are relative to their own address)
+ */
+
+type contextDescriptor struct {
+	Flags  ContextDescriptorFlags
+	Parent int32
+}
+
+type typeContextDescriptor struct {
+	contextDescriptor
+	Name           int32
+	AccessFunction int32
+	Fields         int32
+}
+
+type protocolDescriptor struct {
+	contextDescriptor
+	Name                       int32
+	NumRequirementsInSignature uint32
+	NumRequirements            uint32
+	AssociatedTypeNames        int32
+}
+
+type fieldDescriptor struct {
+	MangledTypeName int32
+	Superclass      int32
+	Kind            FieldDescriptorKind
+	FieldRecordSize uint16
+	NumFields       uint32
+}
+
+type fieldRecord struct {
+	Flags           FieldRecordFlags
+	MangledTypeName int32
+	FieldName       int32
+}
+
+type conformanceDescriptor struct {
+	Protocol     int32
+	TypeRef      int32
+	WitnessTable int32
+	Flags        ConformanceFlags
+}
+
+type associatedTypeDescriptor struct {
+	ConformingTypeName       int32
+	ProtocolTypeName         int32
+	NumAssociatedTypes       uint32
+	AssociatedTypeRecordSize uint32
+}
+
+type associatedTypeRecord struct {
+	Name                int32
+	SubstitutedTypeName int32
+}
+
+/*
+ * Parsed metadata
+ */
+
+// Field is a stored property of a class/struct or a case of an enum
+type Field struct {
+	Name  string           `json:"name"`
+	Type  string           `json:"type,omitempty"`
+	Flags FieldRecordFlags `json:"flags,omitempty"`
+}
+
+// Type is a Swift nominal type (class, struct or enum)
+type Type struct {
+	Address        uint64                 `json:"address"`
+	Kind           ContextDescriptorKind  `json:"kind"`
+	Name           string                 `json:"name"`
+	Flags          ContextDescriptorFlags `json:"flags"`
+	AccessFunction uint64                 `json:"access_function,omitempty"`
+	SuperClass     string                 `json:"super_class,omitempty"`
+	Fields         []Field                `json:"fields,omitempty"`
+}
+
+func (t *Type) String() string {
+	var sb strings.Builder
+
+	generic := ""
+	if t.Flags.IsGeneric() {
+		generic = "<…>"
+	}
+	fmt.Fprintf(&sb, "%s %s%s", t.Kind, t.Name, generic)
+	if len(t.SuperClass) > 0 {
+		fmt.Fprintf(&sb, ": %s", t.SuperClass)
+	}
+	fmt.Fprintf(&sb, " { // %#x\n", t.Address)
+	for _, f := range t.Fields {
+		switch {
+		case t.Kind == KindEnum:
+			indirect := ""
+			if f.Flags&FieldIsIndirectCase != 0 {
+				indirect = "indirect "
+			}
+			if len(f.Type) > 0 {
+				fmt.Fprintf(&sb, "    %scase %s(%s)\n", indirect, f.Name, f.Type)
+			} else {
+				fmt.Fprintf(&sb, "    %scase %s\n", indirect, f.Name)
+			}
+		case f.Flags&FieldIsVar != 0:
+			fmt.Fprintf(&sb, "    var %s: %s\n", f.Name, f.Type)
+		default:
+			fmt.Fprintf(&sb, "    let %s: %s\n", f.Name, f.Type)
+		}
+	}
+	sb.WriteString("}")
+
+	return sb.String()
+}
+
+// Protocol is a Swift protocol
+type Protocol struct {
+	Address         uint64   `json:"address"`
+	Name            string   `json:"name"`
+	NumRequirements uint32   `json:"num_requirements"`
+	AssociatedTypes []string `json:"associated_types,omitempty"`
+}
+
+func (p *Protocol) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "protocol %s { // %#x (%d requirements)\n", p.Name, p.Address, p.NumRequirements)
+	for _, at := range p.AssociatedTypes {
+		fmt.Fprintf(&sb, "    associatedtype %s\n", at)
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// Conformance is a Swift protocol conformance
+type Conformance struct {
+	Address      uint64           `json:"address"`
+	Type         string           `json:"type"`
+	Protocol     string           `json:"protocol"`
+	WitnessTable uint64           `json:"witness_table,omitempty"`
+	Flags        ConformanceFlags `json:"flags"`
+}
+
+func (c *Conformance) String() string {
+	var attrs []string
+	if c.Flags.IsRetroactive() {
+		attrs = append(attrs, "retroactive")
+	}
+	if c.Flags.IsSynthesizedNonUnique() {
+		attrs = append(attrs, "synthesized")
+	}
+	if n := c.Flags.NumConditionalRequirements(); n > 0 {
+		attrs = append(attrs, fmt.Sprintf("%d conditional requirements", n))
+	}
+	extra := ""
+	if len(attrs) > 0 {
+		extra = fmt.Sprintf(" (%s)", strings.Join(attrs, ", "))
+	}
+	return fmt.Sprintf("extension %s: %s {} // %#x witness table: %#x%s", c.Type, c.Protocol, c.Address, c.WitnessTable, extra)
+}
+
+// AssociatedTypeRecord is an associated type witness of a conformance
+type AssociatedTypeRecord struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// AssociatedType are the associated type witnesses of a type conforming to a protocol
+type AssociatedType struct {
+	Address        uint64                 `json:"address"`
+	ConformingType string                 `json:"conforming_type"`
+	Protocol       string                 `json:"protocol"`
+	Types          []AssociatedTypeRecord `json:"types"`
+}
+
+func (a *AssociatedType) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "extension %s: %s { // %#x\n", a.ConformingType, a.Protocol, a.Address)
+	for _, t := range a.Types {
+		fmt.Fprintf(&sb, "    typealias %s = %s\n", t.Name, t.Type)
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// Metadata is the Swift reflection metadata of an image
+type Metadata struct {
+	Types           []*Type           `json:"types,omitempty"`
+	Protocols       []*Protocol       `json:"protocols,omitempty"`
+	Conformances    []*Conformance    `json:"conformances,omitempty"`
+	AssociatedTypes []*AssociatedType `json:"associated_types,omitempty"`
+}
+
+func (m *Metadata) String() string {
+	var sb strings.Builder
+	section := func(title string, n int) {
+		if n > 0 {
+			fmt.Fprintf(&sb, "%s\n%s\n\n", title, strings.Repeat("=", len(title)))
+		}
+	}
+	section("TYPES", len(m.Types))
+	for _, t := range m.Types {
+		fmt.Fprintf(&sb, "%s\n\n", t)
+	}
+	section("PROTOCOLS", len(m.Protocols))
+	for _, p := range m.Protocols {
+		fmt.Fprintf(&sb, "%s\n\n", p)
+	}
+	section("PROTOCOL CONFORMANCES", len(m.Conformances))
+	for _, c := range m.Conformances {
+		fmt.Fprintf(&sb, "%s\n", c)
+	}
+	if len(m.Conformances) > 0 {
+		sb.WriteString("\n")
+	}
+	section("ASSOCIATED TYPES", len(m.AssociatedTypes))
+	for _, a := range m.AssociatedTypes {
+		fmt.Fprintf(&sb, "%s\n\n", a)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}